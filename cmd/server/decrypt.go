@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/livekit/egress/pkg/encryption"
+	"github.com/livekit/egress/pkg/errors"
+)
+
+func runDecrypt(c *cli.Context) error {
+	if c.String("key") == "" {
+		return errors.ErrInvalidInput("key")
+	}
+	if c.String("in") == "" || c.String("out") == "" {
+		return errors.ErrInvalidInput("in and out")
+	}
+
+	b, err := os.ReadFile(c.String("key"))
+	if err != nil {
+		return err
+	}
+	key, err := encryption.ParsePrivateKey(string(b))
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(c.String("in"))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	dest, err := os.Create(c.String("out"))
+	if err != nil {
+		return err
+	}
+
+	err = encryption.Decrypt(dest, src, key)
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(c.String("out"))
+	}
+	return err
+}
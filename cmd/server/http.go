@@ -1,17 +1,25 @@
 package main
 
 import (
+	"encoding/json"
 	"net/http"
 
+	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/service"
 	"github.com/livekit/protocol/logger"
 )
 
 type httpHandler struct {
-	svc *service.Service
+	svc  *service.Service
+	conf *config.ServiceConfig
 }
 
-func (h *httpHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/ladder" {
+		h.serveLadder(w, r)
+		return
+	}
+
 	info, err := h.svc.Status()
 	if err != nil {
 		logger.Errorw("failed to read status", err)
@@ -20,3 +28,25 @@ func (h *httpHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	_, _ = w.Write(info)
 }
+
+// serveLadder returns the encodings an egress described by the posted LadderRequest would use on this node
+func (h *httpHandler) serveLadder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req := &config.LadderRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ladder, err := config.SuggestLadder(h.conf, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ladder)
+}
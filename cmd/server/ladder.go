@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+)
+
+func runSuggestLadder(c *cli.Context) error {
+	// the node config adds hls renditions, proxy files and content hints, but is not required
+	configBody, err := getConfigBody(c)
+	if err != nil && err != errors.ErrNoConfig {
+		return err
+	}
+	conf, err := config.NewServiceConfig(configBody)
+	if err != nil {
+		return err
+	}
+
+	ladder, err := config.SuggestLadder(conf, &config.LadderRequest{
+		RequestType:      c.String("request-type"),
+		AudioOnly:        c.Bool("audio-only"),
+		Outputs:          c.StringSlice("outputs"),
+		Preset:           c.String("preset"),
+		Width:            int32(c.Int("width")),
+		Height:           int32(c.Int("height")),
+		Framerate:        int32(c.Int("framerate")),
+		VideoBitrate:     int32(c.Int("video-bitrate")),
+		AudioBitrate:     int32(c.Int("audio-bitrate")),
+		KeyFrameInterval: c.Float64("key-frame-interval"),
+		SourceWidth:      int32(c.Int("source-width")),
+		SourceHeight:     int32(c.Int("source-height")),
+		SourceFramerate:  int32(c.Int("source-framerate")),
+	})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ladder)
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
 	"syscall"
 
 	"github.com/urfave/cli/v2"
@@ -14,7 +15,9 @@ import (
 
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pprof"
 	"github.com/livekit/egress/pkg/service"
+	"github.com/livekit/egress/pkg/telemetry"
 	"github.com/livekit/egress/version"
 	"github.com/livekit/protocol/egress"
 	"github.com/livekit/protocol/logger"
@@ -48,10 +51,117 @@ func main() {
 					&cli.IntFlag{
 						Name: "version",
 					},
+					&cli.StringFlag{
+						Name:  "trace-parent",
+						Usage: "W3C traceparent of the service span which launched the handler",
+					},
 				},
 				Action: runHandler,
 				Hidden: true,
 			},
+			{
+				Name:        "replay",
+				Usage:       "re-issues a request from a stored EgressInfo or manifest",
+				Description: "starts a new egress with the same request as a previous one, optionally with new outputs",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "info",
+						Usage: "EgressInfo json file",
+					},
+					&cli.StringFlag{
+						Name:  "manifest",
+						Usage: "egress manifest json file",
+					},
+					&cli.StringFlag{
+						Name:  "outputs",
+						Usage: "json file with replacement outputs, in the format of the original request type",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "print the request without sending it",
+					},
+				},
+				Action: runReplay,
+			},
+			{
+				Name:        "decrypt",
+				Usage:       "decrypts a file uploaded with encryption enabled",
+				Description: "decrypts a file using the private key matching the configured encryption public_key",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "key",
+						Usage: "PEM encoded RSA private key file",
+					},
+					&cli.StringFlag{
+						Name:  "in",
+						Usage: "encrypted file",
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "decrypted file",
+					},
+				},
+				Action: runDecrypt,
+			},
+			{
+				Name:        "suggest-ladder",
+				Usage:       "prints the encodings an egress would use",
+				Description: "validates a request with the given options and outputs against the node config, and prints each encoding with its resolution and bitrates",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "request-type",
+						Usage: "room_composite (default), web or track_composite",
+					},
+					&cli.BoolFlag{
+						Name: "audio-only",
+					},
+					&cli.StringSliceFlag{
+						Name:  "outputs",
+						Usage: "mp4, ogg, hls or rtmp",
+					},
+					&cli.StringFlag{
+						Name:  "preset",
+						Usage: "encoding preset, such as H264_720P_30",
+					},
+					&cli.IntFlag{Name: "width"},
+					&cli.IntFlag{Name: "height"},
+					&cli.IntFlag{Name: "framerate"},
+					&cli.IntFlag{
+						Name:  "video-bitrate",
+						Usage: "kbps",
+					},
+					&cli.IntFlag{
+						Name:  "audio-bitrate",
+						Usage: "kbps",
+					},
+					&cli.Float64Flag{Name: "key-frame-interval"},
+					&cli.IntFlag{
+						Name:  "source-width",
+						Usage: "width of the published video or web page, to warn about upscaling",
+					},
+					&cli.IntFlag{Name: "source-height"},
+					&cli.IntFlag{Name: "source-framerate"},
+				},
+				Action: runSuggestLadder,
+			},
+			{
+				Name:        "reconcile-uploads",
+				Usage:       "uploads files spooled after failed uploads",
+				Description: "uploads every file in the upload_spool directory, and reports file outputs with their new location. Files which fail again are kept",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "no-report",
+						Usage: "don't report uploaded file outputs to the server",
+					},
+				},
+				Action: runReconcileUploads,
+			},
+			{
+				Name:        "config-schema",
+				Usage:       "prints the config schema as json",
+				Description: "lists every config field with its type, default, and environment variable, for deployment tooling",
+				Action:      runConfigSchema,
+			},
 		},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
@@ -74,25 +184,42 @@ func main() {
 	}
 }
 
-func runService(c *cli.Context) error {
+func getConfigBody(c *cli.Context) (string, error) {
 	configFile := c.String("config")
 	configBody := c.String("config-body")
 	if configBody == "" {
 		if configFile == "" {
-			return errors.ErrNoConfig
+			return "", errors.ErrNoConfig
 		}
 		content, err := os.ReadFile(configFile)
 		if err != nil {
-			return err
+			return "", err
 		}
 		configBody = string(content)
 	}
+	return configBody, nil
+}
+
+func runService(c *cli.Context) error {
+	configBody, err := getConfigBody(c)
+	if err != nil {
+		return err
+	}
 
 	conf, err := config.NewServiceConfig(configBody)
 	if err != nil {
 		return err
 	}
 
+	if err = telemetry.StartService(conf.Telemetry, conf.NodeID, conf.ClusterID); err != nil {
+		return err
+	}
+	defer telemetry.Stop()
+
+	if err = conf.StartClock(); err != nil {
+		logger.Warnw("could not synchronize clock, using system time", err)
+	}
+
 	rc, err := lkredis.GetRedisClient(conf.Redis)
 	if err != nil {
 		return err
@@ -100,7 +227,7 @@ func runService(c *cli.Context) error {
 
 	bus := psrpc.NewRedisMessageBus(rc)
 	rpcServerV0 := egress.NewRedisRPCServer(rc)
-	ioClient, err := rpc.NewIOInfoClient(conf.NodeID, bus)
+	ioClient, err := service.NewIOClient(conf.IOClient, conf.NodeID, bus)
 	if err != nil {
 		return err
 	}
@@ -111,7 +238,7 @@ func runService(c *cli.Context) error {
 
 	if conf.HealthPort != 0 {
 		go func() {
-			_ = http.ListenAndServe(fmt.Sprintf(":%d", conf.HealthPort), &httpHandler{svc: svc})
+			_ = http.ListenAndServe(fmt.Sprintf(":%d", conf.HealthPort), &httpHandler{svc: svc, conf: conf})
 		}()
 	}
 
@@ -124,8 +251,13 @@ func runService(c *cli.Context) error {
 	go func() {
 		select {
 		case sig := <-stopChan:
-			logger.Infow("exit requested, finishing recording then shutting down", "signal", sig)
-			svc.Stop(false)
+			if conf.ShutdownDeadline > 0 {
+				logger.Infow("exit requested, stopping recording and shutting down after uploads", "signal", sig, "deadline", conf.ShutdownDeadline)
+				svc.Drain()
+			} else {
+				logger.Infow("exit requested, finishing recording then shutting down", "signal", sig)
+				svc.Stop(false)
+			}
 		case sig := <-killChan:
 			logger.Infow("exit requested, stopping recording and shutting down", "signal", sig)
 			svc.Stop(true)
@@ -168,6 +300,18 @@ func runHandler(c *cli.Context) error {
 
 	logger.Debugw("handler launched")
 
+	if conf.HandlerGC != nil && conf.HandlerGC.Ballast > 0 {
+		// the ballast is never written, so it takes no resident memory
+		ballast := make([]byte, conf.HandlerGC.Ballast<<20)
+		defer runtime.KeepAlive(ballast)
+	}
+
+	err = telemetry.StartHandler(conf.Telemetry, conf.NodeID, conf.ClusterID, conf.HandlerID, req.EgressId, c.String("trace-parent"))
+	if err != nil {
+		return err
+	}
+	defer telemetry.Stop()
+
 	err = os.MkdirAll(conf.TmpDir, 0755)
 	if err != nil {
 		return err
@@ -179,8 +323,9 @@ func runHandler(c *cli.Context) error {
 		return err
 	}
 
+	// SIGTERM reaches handlers when a node shuts down its whole process group
 	killChan := make(chan os.Signal, 1)
-	signal.Notify(killChan, syscall.SIGINT)
+	signal.Notify(killChan, syscall.SIGINT, syscall.SIGTERM)
 
 	var handler interface {
 		Kill()
@@ -196,13 +341,17 @@ func runHandler(c *cli.Context) error {
 		}
 	} else {
 		bus := psrpc.NewRedisMessageBus(rc)
-		ioClient, err := rpc.NewIOInfoClient(conf.NodeID, bus)
+		ioClient, err := service.NewIOClient(conf.IOClient, conf.NodeID, bus)
 		if err != nil {
 			return err
 		}
 		handler, err = service.NewHandler(conf, bus, ioClient)
 		if err != nil {
-			if errors.IsFatal(err) {
+			if conf.RetryFailedStarts && errors.IsRetryable(err) {
+				// service will retry on another node
+				logger.Warnw("retryable error", err)
+				return cli.Exit(err.Error(), service.RetryExitCode)
+			} else if errors.IsFatal(err) {
 				// service will send info update and shut down
 				logger.Errorw("fatal error", err)
 				return err
@@ -213,6 +362,12 @@ func runHandler(c *cli.Context) error {
 		}
 	}
 
+	profiler, err := pprof.StartContinuousProfiler(conf, req.EgressId)
+	if err != nil {
+		logger.Warnw("could not start continuous profiler", err)
+	}
+	defer profiler.Stop()
+
 	go func() {
 		sig := <-killChan
 		logger.Infow("exit requested, stopping recording and shutting down", "signal", sig)
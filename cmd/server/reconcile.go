@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/service"
+	lkredis "github.com/livekit/protocol/redis"
+	"github.com/livekit/protocol/rpc"
+	"github.com/livekit/psrpc"
+)
+
+func runReconcileUploads(c *cli.Context) error {
+	configBody, err := getConfigBody(c)
+	if err != nil {
+		return err
+	}
+	conf, err := config.NewServiceConfig(configBody)
+	if err != nil {
+		return err
+	}
+	if conf.UploadSpool == nil {
+		return errors.ErrInvalidInput("upload_spool")
+	}
+
+	var ioClient rpc.IOInfoClient
+	if !c.Bool("no-report") {
+		rc, err := lkredis.GetRedisClient(conf.Redis)
+		if err != nil {
+			return err
+		}
+		ioClient, err = service.NewIOClient(conf.IOClient, conf.NodeID, psrpc.NewRedisMessageBus(rc))
+		if err != nil {
+			return err
+		}
+	}
+
+	uploaded, remaining := service.ReconcileUploads(conf, ioClient, nil)
+	fmt.Printf("uploaded %d spooled files, %d remaining\n", uploaded, remaining)
+	if remaining > 0 {
+		return fmt.Errorf("%d spooled files could not be uploaded", remaining)
+	}
+	return nil
+}
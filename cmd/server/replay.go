@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/sink"
+	"github.com/livekit/egress/pkg/replay"
+	"github.com/livekit/protocol/livekit"
+	lkredis "github.com/livekit/protocol/redis"
+	"github.com/livekit/protocol/rpc"
+	"github.com/livekit/psrpc"
+)
+
+func runReplay(c *cli.Context) error {
+	var req *rpc.StartEgressRequest
+	switch {
+	case c.String("info") != "":
+		b, err := os.ReadFile(c.String("info"))
+		if err != nil {
+			return err
+		}
+		info := &livekit.EgressInfo{}
+		if err = protojson.Unmarshal(b, info); err != nil {
+			return err
+		}
+		if req, err = replay.FromEgressInfo(info); err != nil {
+			return err
+		}
+
+	case c.String("manifest") != "":
+		b, err := os.ReadFile(c.String("manifest"))
+		if err != nil {
+			return err
+		}
+		manifest := &sink.Manifest{}
+		if err = json.Unmarshal(b, manifest); err != nil {
+			return err
+		}
+		if req, err = replay.FromManifest(manifest); err != nil {
+			return err
+		}
+		if c.String("outputs") == "" {
+			return errors.ErrInvalidInput("outputs")
+		}
+
+	default:
+		return errors.ErrInvalidInput("info or manifest")
+	}
+
+	if outputs := c.String("outputs"); outputs != "" {
+		b, err := os.ReadFile(outputs)
+		if err != nil {
+			return err
+		}
+		if err = replay.ReplaceOutputs(req, b); err != nil {
+			return err
+		}
+	}
+
+	if c.Bool("dry-run") {
+		fmt.Println(protojson.Format(req))
+		return nil
+	}
+
+	configBody, err := getConfigBody(c)
+	if err != nil {
+		return err
+	}
+	conf, err := config.NewServiceConfig(configBody)
+	if err != nil {
+		return err
+	}
+
+	rc, err := lkredis.GetRedisClient(conf.Redis)
+	if err != nil {
+		return err
+	}
+	client, err := rpc.NewEgressInternalClient(conf.NodeID, psrpc.NewRedisMessageBus(rc))
+	if err != nil {
+		return err
+	}
+
+	info, err := client.StartEgress(context.Background(), conf.ClusterID, req)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(protojson.Format(info))
+	return nil
+}
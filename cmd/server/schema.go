@@ -0,0 +1,22 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/livekit/egress/pkg/config"
+)
+
+func runConfigSchema(_ *cli.Context) error {
+	schema, err := config.GetSchema()
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(schema)
+}
@@ -0,0 +1,61 @@
+package clock
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+
+	"github.com/livekit/protocol/logger"
+)
+
+// Source measures the difference between a reference clock and the system clock
+type Source interface {
+	Offset() (time.Duration, error)
+}
+
+var (
+	offset    atomic.Int64
+	startOnce sync.Once
+)
+
+// Start measures the offset of the reference clock, then keeps it updated in the background.
+// Only the first call has any effect, since handlers may share a process.
+func Start(src Source, interval time.Duration) error {
+	var err error
+	startOnce.Do(func() {
+		var o time.Duration
+		if o, err = src.Offset(); err != nil {
+			return
+		}
+		offset.Store(int64(o))
+		logger.Infow("clock synchronized", "offset", o)
+
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				o, err := src.Offset()
+				if err != nil {
+					// keep the last offset, which drifts slowly
+					logger.Warnw("failed to synchronize clock", err)
+					continue
+				}
+				offset.Store(int64(o))
+				logger.Debugw("clock synchronized", "offset", o)
+			}
+		}()
+	})
+	return err
+}
+
+// Now returns the wall clock time of the reference clock, or the system time if there is none.
+// The pipeline clock is unaffected, so only wall clock metadata is disciplined.
+func Now() time.Time {
+	return time.Now().Add(Offset())
+}
+
+// Offset is added to system times to convert them to the reference clock
+func Offset() time.Duration {
+	return time.Duration(offset.Load())
+}
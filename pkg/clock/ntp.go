@@ -0,0 +1,106 @@
+package clock
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	ntpSamples = 4
+	ntpTimeout = time.Second * 2
+
+	// seconds between the ntp epoch (1900) and the unix epoch
+	ntpEpochOffset = 2208988800
+)
+
+type ntpSource struct {
+	server string
+}
+
+// NewNTPSource queries an NTP server using SNTP
+func NewNTPSource(server string) Source {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	return &ntpSource{
+		server: server,
+	}
+}
+
+// Offset keeps the sample with the lowest round trip delay, which has the least asymmetry error
+func (s *ntpSource) Offset() (time.Duration, error) {
+	var best, bestDelay time.Duration
+	var err error
+	for i := 0; i < ntpSamples; i++ {
+		o, delay, e := s.query()
+		if e != nil {
+			err = e
+			continue
+		}
+		if bestDelay == 0 || delay < bestDelay {
+			best, bestDelay = o, delay
+		}
+	}
+	if bestDelay == 0 {
+		return 0, err
+	}
+	return best, nil
+}
+
+func (s *ntpSource) query() (time.Duration, time.Duration, error) {
+	conn, err := net.Dial("udp", s.server)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if err = conn.SetDeadline(time.Now().Add(ntpTimeout)); err != nil {
+		return 0, 0, err
+	}
+
+	req := make([]byte, 48)
+	req[0] = 0x23 // version 4, client mode
+	t1 := time.Now()
+	binary.BigEndian.PutUint64(req[40:], toNTPTime(t1))
+	if _, err = conn.Write(req); err != nil {
+		return 0, 0, err
+	}
+
+	res := make([]byte, 48)
+	n, err := conn.Read(res)
+	t4 := time.Now()
+	if err != nil {
+		return 0, 0, err
+	}
+	if n < 48 || res[0]&0x7 != 4 || res[1] == 0 {
+		return 0, 0, errors.New("invalid ntp response")
+	}
+	if binary.BigEndian.Uint64(res[24:]) != binary.BigEndian.Uint64(req[40:]) {
+		return 0, 0, errors.New("ntp response does not match request")
+	}
+
+	t2 := fromNTPTime(binary.BigEndian.Uint64(res[32:]))
+	t3 := fromNTPTime(binary.BigEndian.Uint64(res[40:]))
+
+	offset := (t2.Sub(t1) + t3.Sub(t4)) / 2
+	delay := t4.Sub(t1) - t3.Sub(t2)
+	if delay <= 0 {
+		delay = 1
+	}
+	return offset, delay, nil
+}
+
+func toNTPTime(t time.Time) uint64 {
+	sec := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return sec<<32 | frac
+}
+
+func fromNTPTime(v uint64) time.Time {
+	sec := int64(v>>32) - ntpEpochOffset
+	nsec := int64((v & 0xffffffff) * uint64(time.Second) >> 32)
+	return time.Unix(sec, nsec)
+}
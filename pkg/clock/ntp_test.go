@@ -0,0 +1,46 @@
+package clock
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNTPSource(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	// a server which runs 3 seconds ahead
+	ahead := time.Second * 3
+	go func() {
+		buf := make([]byte, 48)
+		for {
+			_, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			res := make([]byte, 48)
+			res[0] = 0x24 // version 4, server mode
+			res[1] = 1    // stratum
+			copy(res[24:32], buf[40:48])
+			now := toNTPTime(time.Now().Add(ahead))
+			binary.BigEndian.PutUint64(res[32:], now)
+			binary.BigEndian.PutUint64(res[40:], now)
+			_, _ = conn.WriteTo(res, addr)
+		}
+	}()
+
+	offset, err := NewNTPSource(conn.LocalAddr().String()).Offset()
+	require.NoError(t, err)
+	require.InDelta(t, ahead.Seconds(), offset.Seconds(), 0.01)
+}
+
+func TestNTPTime(t *testing.T) {
+	now := time.Unix(1683154504, 814142000)
+	// ntp fractions are 2^-32 seconds, so nanoseconds can be rounded down
+	require.InDelta(t, float64(now.UnixNano()), float64(fromNTPTime(toNTPTime(now)).UnixNano()), 2)
+}
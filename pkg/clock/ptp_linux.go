@@ -0,0 +1,46 @@
+package clock
+
+import (
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+type ptpSource struct {
+	device    string
+	utcOffset time.Duration
+}
+
+// NewPTPSource reads a PTP hardware clock, which ptp4l keeps synchronized to the grandmaster.
+// The hardware clock normally runs on TAI, so utcOffset is subtracted to get UTC.
+func NewPTPSource(device string, utcOffset time.Duration) Source {
+	return &ptpSource{
+		device:    device,
+		utcOffset: utcOffset,
+	}
+}
+
+func (s *ptpSource) Offset() (time.Duration, error) {
+	f, err := os.Open(s.device)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	// FD_TO_CLOCKID
+	clockID := (^int(f.Fd()) << 3) | 3
+
+	var ts syscall.Timespec
+	before := time.Now()
+	if _, _, errno := syscall.Syscall(syscall.SYS_CLOCK_GETTIME, uintptr(clockID), uintptr(unsafe.Pointer(&ts)), 0); errno != 0 {
+		return 0, errno
+	}
+	after := time.Now()
+
+	ptp := time.Unix(ts.Unix()).Add(-s.utcOffset)
+	system := before.Add(after.Sub(before) / 2)
+	return ptp.Sub(system), nil
+}
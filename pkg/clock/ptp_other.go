@@ -0,0 +1,19 @@
+//go:build !linux
+
+package clock
+
+import (
+	"errors"
+	"time"
+)
+
+type ptpSource struct{}
+
+// NewPTPSource is only supported on linux
+func NewPTPSource(_ string, _ time.Duration) Source {
+	return &ptpSource{}
+}
+
+func (s *ptpSource) Offset() (time.Duration, error) {
+	return 0, errors.New("ptp clocks are only supported on linux")
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/tinyzimmer/go-gst/gst/app"
+
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+)
+
+// ISO 639 code, optionally followed by BCP 47 subtags
+var languageCodeRegexp = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]+)*$`)
+
+// AlternateAudio is an extra audio track, muxed into mp4 and hls outputs next to the main audio
+type AlternateAudio struct {
+	*AlternateAudioTrackConfig
+
+	TrackID     string
+	Src         *app.Source
+	CodecParams webrtc.RTPCodecParameters
+}
+
+// updateAlternateAudio lists the configured alternate audio tracks for track composite mp4 and hls outputs.
+// The sdk source removes any which are not published when it joins the room
+func (p *PipelineConfig) updateAlternateAudio() {
+	if p.AlternateAudio == nil || p.AlternateAudioTracks != nil ||
+		p.SourceType != types.SourceTypeSDK || p.TrackID != "" || !p.AudioEnabled || p.ShareRoomConnections {
+		return
+	}
+
+	// other outputs only carry the main audio
+	file := p.GetFileConfig()
+	segments := p.GetSegmentConfig()
+	if (file == nil || file.OutputType != types.OutputTypeMP4) &&
+		(segments == nil || segments.OutputType != types.OutputTypeHLS) {
+		return
+	}
+
+	for i := range p.AlternateAudio.Tracks {
+		p.AlternateAudioTracks = append(p.AlternateAudioTracks, &AlternateAudio{
+			AlternateAudioTrackConfig: &p.AlternateAudio.Tracks[i],
+		})
+	}
+}
+
+// updateAudioRenditions adds an audio only hls rendition for each alternate audio track,
+// listed in a master playlist as alternate audio of the main output
+func (p *PipelineConfig) updateAudioRenditions() {
+	o := p.GetSegmentConfig()
+	if len(p.AlternateAudioTracks) == 0 || o == nil || o.OutputType != types.OutputTypeHLS || o.AudioRenditions != nil {
+		return
+	}
+
+	ext := types.FileExtensionForOutputType[o.OutputType]
+	playlistName := strings.TrimSuffix(o.PlaylistFilename, string(ext))
+	o.MasterPlaylistFilename = fmt.Sprintf("%s_master%s", playlistName, ext)
+
+	for _, a := range p.AlternateAudioTracks {
+		conf := *o
+		conf.SegmentsInfo = &livekit.SegmentsInfo{}
+		conf.PlaylistFilename = fmt.Sprintf("%s_%s%s", playlistName, a.Language, ext)
+		conf.SegmentPrefix = fmt.Sprintf("%s_%s", o.SegmentPrefix, a.Language)
+		conf.DisableManifest = true
+		conf.MasterPlaylistFilename = ""
+		conf.Renditions = nil
+		conf.AudioRenditions = nil
+		conf.AudioRendition = a
+		conf.Segments = nil
+		conf.SegmentsInfo.PlaylistName = path.Join(conf.StorageDir, conf.PlaylistFilename)
+
+		o.AudioRenditions = append(o.AudioRenditions, &conf)
+		p.Info.SegmentResults = append(p.Info.SegmentResults, conf.SegmentsInfo)
+	}
+}
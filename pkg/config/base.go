@@ -1,8 +1,14 @@
 package config
 
 import (
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/logging"
+	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
 	"github.com/livekit/protocol/logger"
 	"github.com/livekit/protocol/redis"
@@ -20,16 +26,87 @@ type BaseConfig struct {
 	Insecure             bool               `yaml:"insecure"`        // allow chrome to connect to an insecure websocket
 	LocalOutputDirectory string             `yaml:"local_directory"` // used for temporary storage before upload
 	Logging              logger.Config      `yaml:"logging"`
-	LogLevel             string             `yaml:"log_level"`      // TODO: deprecate
-	ClusterID            string             `yaml:"cluster_id"`     // Which cluster this egress belongs to
-	BackupStorage        string             `yaml:"backup_storage"` // Files will be moved here if the upload fails
+	LogLevel             string             `yaml:"log_level"`              // TODO: deprecate
+	LogLevels            map[string]string  `yaml:"log_levels"`             // per subsystem (source, sink, upload, ipc) log levels
+	LogSampling          map[string]uint64  `yaml:"log_sampling"`           // per subsystem, only log one in every n repeated debug messages
+	ClusterID            string             `yaml:"cluster_id"`             // Which cluster this egress belongs to
+	BackupStorage        string             `yaml:"backup_storage"`         // Files will be moved here if the upload fails
+	LocalCopyDirectory   string             `yaml:"local_copy_directory"`   // Files will also be kept here, whether or not the upload succeeds
+	ContentHint          types.ContentHint  `yaml:"content_hint"`           // motion (default), detail, or text. Requests can't set it
+	ScratchDirectory     string             `yaml:"scratch_directory"`      // handler working directories (default os.TempDir())
+	ScratchQuota         int64              `yaml:"scratch_quota"`          // max MB of local storage per egress, 0 for unlimited
+	RetryFailedStarts    bool               `yaml:"retry_failed_starts"`    // send requests to another node when startup fails because of a node-local issue
+	QCReport             bool               `yaml:"qc_report"`              // upload a loudness and quality report next to file and segment outputs
+	FaststartMP4         bool               `yaml:"faststart_mp4"`          // write the moov atom at the front of mp4 files, for progressive playback
+	ShareRoomConnections bool               `yaml:"share_room_connections"` // sdk egresses for the same room running in one process share a room connection
+	WebMVideoCodec       string             `yaml:"webm_video_codec"`       // vp8 (default) or vp9, used when webm outputs are transcoded
+	HEVC                 bool               `yaml:"hevc"`                   // encode mp4 and ts file outputs with h265 instead of h264
+	AudioOnlyFallback    bool               `yaml:"audio_only_fallback"`    // track composite egresses continue audio only with blank video when the video track is lost
+	HLSSegmentFormat     string             `yaml:"hls_segment_format"`     // ts (default) or fmp4, for CMAF segments with a shared init segment
+	SyncGroups           bool               `yaml:"sync_groups"`            // egresses for the same room which overlap on a node share a sync epoch
+	SegmentPartitions    string             `yaml:"segment_partitions"`     // day or hour, to upload segments under {year}/{month}/{day}/({hour}/) prefixes
+	FeatureFlags         map[string]bool    `yaml:"feature_flags"`          // experimental pipeline behaviors, enabled per node
+	OutputUpdates        bool               `yaml:"output_updates"`         // build outputs with tees, so that segment and file outputs can be added or stopped while running
+	SDKReconnect         time.Duration      `yaml:"sdk_reconnect"`          // max room signaling outage bridged by rejoining, instead of ending track and track composite egress
+	RecoverUploads       bool               `yaml:"recover_uploads"`        // resume file uploads interrupted by a crash, when the handler exits and on service start
 
-	S3     *S3Config    `yaml:"s3"`
-	Azure  *AzureConfig `yaml:"azure"`
-	GCP    *GCPConfig   `yaml:"gcp"`
-	AliOSS *S3Config    `yaml:"alioss"`
+	S3     *S3Config     `yaml:"s3"`
+	Azure  *AzureConfig  `yaml:"azure"`
+	GCP    *GCPConfig    `yaml:"gcp"`
+	AliOSS *AliOSSConfig `yaml:"alioss"`
+	Local  *LocalConfig  `yaml:"local"`
 
-	SessionLimits `yaml:"session_limits"`
+	GoogleDrive *GoogleDriveConfig `yaml:"google_drive"`
+	Dropbox     *DropboxConfig     `yaml:"dropbox"`
+	HTTP        *HTTPUploadConfig  `yaml:"http_upload"`
+
+	SessionLimits  `yaml:"session_limits"`
+	EndTriggers    map[string]string      `yaml:"end_triggers"` // by request type, template, room_closed, participant_left or stop_egress
+	IOClient       IOClientConfig         `yaml:"io_client"`
+	UploadRetry    UploadRetryConfig      `yaml:"upload_retry"`
+	ChromeLaunch   ChromeLaunchConfig     `yaml:"chrome_launch"`
+	DisplayPool    DisplayPoolConfig      `yaml:"display_pool"`
+	PulseSink      PulseSinkConfig        `yaml:"pulse_sink"`
+	HandlerGC      *HandlerGCConfig       `yaml:"handler_gc"`      // GOGC, GOMEMLIMIT and a heap ballast for each handler process
+	ProxyFile      *ProxyFileConfig       `yaml:"proxy_file"`      // low bitrate copy of video file outputs
+	Timecode       *TimecodeConfig        `yaml:"timecode"`        // SMPTE timecode for transcoded video
+	Trim           *TrimConfig            `yaml:"trim"`            // drop media before and after offsets from the start of recording
+	Slate          *SlateConfig           `yaml:"slate"`           // shown instead of video before it starts, while muted, and after it ends
+	Watermark      *WatermarkConfig       `yaml:"watermark"`       // image drawn over transcoded composite and web video
+	TemplateToken  *TemplateTokenConfig   `yaml:"template_token"`  // restricted, short lived tokens for room composite templates
+	Participant    *ParticipantConfig     `yaml:"participant"`     // identity, name, and metadata of the egress as seen by the room
+	MuteIndicator  *MuteIndicatorConfig   `yaml:"mute_indicator"`  // frozen or dropped video and silence while tracks are muted
+	ComfortNoise   *ComfortNoiseConfig    `yaml:"comfort_noise"`   // noise instead of silence during audio dropouts, for audio only egress
+	Loudness       *LoudnessConfig        `yaml:"loudness"`        // EBU R128 loudness normalization of transcoded audio
+	AudioLayout    *AudioChannelsConfig   `yaml:"audio_channels"`  // mono downmix or channel mapping of transcoded audio
+	Preview        *PreviewConfig         `yaml:"preview"`         // upload a jpeg of the first frames next to file and segment outputs
+	Muxers         map[string]MuxerConfig `yaml:"muxers"`          // per format (mp4, ts, webm, ogg, ivf) muxer and property overrides
+	LowLatencyHLS  *LowLatencyHLSConfig   `yaml:"low_latency_hls"` // write hls segments as LL-HLS partial segments
+	CMAFChunked    *CMAFChunkedConfig     `yaml:"cmaf_chunked"`    // stream fmp4 segments to http storage while they are written
+	HLSEncryption  *HLSEncryptionConfig   `yaml:"hls_encryption"`  // AES-128 encryption of hls segments, listed with EXT-X-KEY
+	HLSLadder      []HLSRenditionConfig   `yaml:"hls_ladder"`      // extra hls renditions of room composite egress, listed in a master playlist
+	AlternateAudio *AlternateAudioConfig  `yaml:"alternate_audio"` // extra language tagged audio tracks in track composite mp4 and hls outputs
+	RTMPReconnect  *RTMPReconnectConfig   `yaml:"rtmp_reconnect"`  // reconnect rtmp outputs after errors, instead of removing them
+	CBR            *CBRConfig             `yaml:"cbr"`             // constant bitrate video and padding of rtmp outputs and ts segments
+	PlaylistURIs   *PlaylistURIConfig     `yaml:"playlist_uris"`   // absolute segment uris in uploaded playlists
+	Encryption     *EncryptionConfig      `yaml:"encryption"`      // encrypt files before upload
+	UploadHook     *UploadHookConfig      `yaml:"upload_hook"`     // scan files before upload
+	UploadHeaders  []UploadHeadersConfig  `yaml:"upload_headers"`  // content type and cache control of uploaded files, by filename
+	UploadReplicas []UploadReplicaConfig  `yaml:"upload_replicas"` // storage every file of every egress on the node is also uploaded to
+	UploadSpool    *UploadSpoolConfig     `yaml:"upload_spool"`    // keep files which could not be uploaded, and upload them later
+	Checksums      *ChecksumConfig        `yaml:"checksums"`       // sha256 and md5 of uploaded files and segments, listed in the manifest
+	ManifestFormat string                 `yaml:"manifest_format"` // v1 or v2 (default v1)
+	PostProcessing []PostProcessConfig    `yaml:"post_processing"` // commands run on file outputs before upload, in order
+	Telemetry      *TelemetryConfig       `yaml:"telemetry"`       // OTLP trace and metric export
+	Clock          *ClockConfig           `yaml:"clock"`           // NTP or PTP reference for wall clock metadata
+	Profiling      *ProfilingConfig       `yaml:"profiling"`       // continuous profiling of each handler
+	ICE            *ICEConfig             `yaml:"ice"`             // room connection overrides for track and track composite egress
+	NetworkStats   *NetworkStatsConfig    `yaml:"network_stats"`   // periodic loss, jitter and bitrate of each subscribed track
+	FileIndex      *FileIndexConfig       `yaml:"file_index"`      // timestamp to byte offset sidecar for ivf and ogg track egress files
+	S3Multipart    *S3MultipartConfig     `yaml:"s3_multipart"`    // resumable multipart s3 uploads
+	S3SSE          *S3SSEConfig           `yaml:"s3_sse"`          // server-side encryption of s3 uploads
+	S3Object       *S3ObjectConfig        `yaml:"s3_object"`       // storage class, acl and tags of s3 uploads
+	S3AssumeRole   []S3AssumeRoleConfig   `yaml:"s3_assume_role"`  // temporary credentials for s3 uploads, by bucket
 }
 
 type S3Config struct {
@@ -52,16 +129,34 @@ func (c *S3Config) ToS3Upload() *livekit.S3Upload {
 	}
 }
 
-func (c *S3Config) ToAliOSSUpload() *livekit.AliOSSUpload {
+type AliOSSConfig struct {
+	AccessKey   string `yaml:"access_key"` // (env ALIBABA_CLOUD_ACCESS_KEY_ID)
+	Secret      string `yaml:"secret"`     // (env ALIBABA_CLOUD_ACCESS_KEY_SECRET)
+	Region      string `yaml:"region"`     // e.g. cn-hangzhou, used for the public endpoint if endpoint is empty
+	Endpoint    string `yaml:"endpoint"`   // e.g. oss-cn-hangzhou-internal.aliyuncs.com
+	Bucket      string `yaml:"bucket"`
+	PartSize    int64  `yaml:"part_size"`   // MB, files larger than one part are uploaded in parts (default 16)
+	Concurrency int    `yaml:"concurrency"` // parts uploaded at once (default 4)
+}
+
+func (c *AliOSSConfig) ToAliOSSUpload() *livekit.AliOSSUpload {
 	return &livekit.AliOSSUpload{
 		AccessKey: c.AccessKey,
 		Secret:    c.Secret,
 		Region:    c.Region,
-		Endpoint:  c.Endpoint,
+		Endpoint:  aliOSSEndpoint(c.Endpoint, c.Region),
 		Bucket:    c.Bucket,
 	}
 }
 
+// aliOSSEndpoint returns the public endpoint of the region if no endpoint is set
+func aliOSSEndpoint(endpoint, region string) string {
+	if endpoint != "" || region == "" {
+		return endpoint
+	}
+	return fmt.Sprintf("oss-%s.aliyuncs.com", strings.TrimPrefix(region, "oss-"))
+}
+
 type AzureConfig struct {
 	AccountName   string `yaml:"account_name"` // (env AZURE_STORAGE_ACCOUNT)
 	AccountKey    string `yaml:"account_key"`  // (env AZURE_STORAGE_KEY)
@@ -88,10 +183,394 @@ func (c *GCPConfig) ToGCPUpload() *livekit.GCPUpload {
 	}
 }
 
-type SessionLimits struct {
-	FileOutputMaxDuration    time.Duration `yaml:"file_output_max_duration"`
-	StreamOutputMaxDuration  time.Duration `yaml:"stream_output_max_duration"`
-	SegmentOutputMaxDuration time.Duration `yaml:"segment_output_max_duration"`
+// LocalConfig uploads to a mounted filesystem (NFS, SMB) instead of object storage
+type LocalConfig struct {
+	Directory    string `yaml:"directory"`      // mount point used as the storage root
+	MinFreeSpace int64  `yaml:"min_free_space"` // MB which must remain free after an upload
+}
+
+// GoogleDriveConfig uploads to a user's Google Drive, authorized with an OAuth refresh token
+type GoogleDriveConfig struct {
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	RefreshToken string `yaml:"refresh_token"`
+	FolderID     string `yaml:"folder_id"` // parent folder (default My Drive)
+}
+
+// DropboxConfig uploads to a user's Dropbox, authorized with an OAuth refresh token
+type DropboxConfig struct {
+	AppKey       string `yaml:"app_key"`
+	AppSecret    string `yaml:"app_secret"`
+	RefreshToken string `yaml:"refresh_token"`
+	Directory    string `yaml:"directory"` // prepended to each path (default app folder root)
+}
+
+// HTTPUploadConfig sends each file to a custom ingest endpoint
+type HTTPUploadConfig struct {
+	URL       string            `yaml:"url"`        // {path} is replaced by the storage path, otherwise the path is appended
+	Method    string            `yaml:"method"`     // PUT (default) sends the file as the body, POST sends a multipart form
+	Headers   map[string]string `yaml:"headers"`    // added to every request
+	FormField string            `yaml:"form_field"` // multipart field name for POST (default file)
+}
+
+type ProxyFileConfig struct {
+	Width        int32  `yaml:"width"`         // default 640
+	Height       int32  `yaml:"height"`        // default 360
+	VideoBitrate int32  `yaml:"video_bitrate"` // default 500
+	Suffix       string `yaml:"suffix"`        // appended to the filename (default _proxy)
+}
+
+type TimecodeConfig struct {
+	Start  string `yaml:"start"`   // HH:MM:SS:FF timecode of the first frame (default wall clock)
+	BurnIn bool   `yaml:"burn_in"` // draw the timecode over the video
+}
+
+type TrimConfig struct {
+	StartOffset time.Duration `yaml:"start_offset"` // media before this offset is dropped
+	EndOffset   time.Duration `yaml:"end_offset"`   // egress ends at this offset (default unlimited)
+}
+
+type SlateConfig struct {
+	Image string `yaml:"image"` // png or jpeg file, scaled to the output resolution
+	Color string `yaml:"color"` // #RRGGBB color used when there is no image (default #000000)
+}
+
+type ParticipantConfig struct {
+	Identity string `yaml:"identity"` // must contain {egress_id}. {room_name} and {node_id} are also replaced (default {egress_id})
+	Name     string `yaml:"name"`     // display name
+	Metadata string `yaml:"metadata"` // participant metadata, e.g. json read by in-room UIs
+	Visible  bool   `yaml:"visible"`  // listed to other participants, instead of hidden (default false)
+}
+
+type TemplateTokenConfig struct {
+	Policy string        `yaml:"policy"` // always, or fallback to only replace missing request tokens (default always)
+	TTL    time.Duration `yaml:"ttl"`    // token lifetime (default 10m)
+}
+
+const (
+	TemplateTokenAlways   = "always"
+	TemplateTokenFallback = "fallback"
+)
+
+type MuteIndicatorConfig struct {
+	Video string `yaml:"video"` // freeze (last frame) or drop (black frames) (default freeze)
+	Badge string `yaml:"badge"` // text drawn over muted video (default none)
+}
+
+const (
+	MuteVideoFreeze = "freeze"
+	MuteVideoDrop   = "drop"
+)
+
+const (
+	ManifestFormatV1 = "v1" // flat, unversioned
+	ManifestFormatV2 = "v2" // versioned, with the request, timings, codec parameters and results of each output
+)
+
+type ComfortNoiseConfig struct {
+	Wave   string        `yaml:"wave"`   // white-noise, pink-noise, or red-noise (default pink-noise)
+	Volume float64       `yaml:"volume"` // between 0 and 1 (default 0.01)
+	Gap    time.Duration `yaml:"gap"`    // how long audio can be missing before noise is added (default 250ms)
+}
+
+type WatermarkConfig struct {
+	Image    string  `yaml:"image"`    // png or jpeg file, or an http(s) url downloaded when the egress starts
+	Position string  `yaml:"position"` // top-left, top-right, bottom-left, or bottom-right (default bottom-right)
+	Opacity  float64 `yaml:"opacity"`  // between 0 and 1 (default 1)
+	Margin   int     `yaml:"margin"`   // distance from the edges, in pixels (default 16)
+	Width    int     `yaml:"width"`    // scaled width in pixels, keeping the aspect ratio (default image width)
+}
+
+type AudioChannelsConfig struct {
+	Channels  int32  `yaml:"channels"`   // 1 or 2 (default 2)
+	Mapping   string `yaml:"mapping"`    // mix, left, right, or swap (stereo only) (default mix)
+	AudioOnly bool   `yaml:"audio_only"` // only applied to egresses without video
+}
+
+const (
+	ChannelMappingMix   = "mix"
+	ChannelMappingLeft  = "left"
+	ChannelMappingRight = "right"
+	ChannelMappingSwap  = "swap"
+)
+
+type LoudnessConfig struct {
+	Target   float64 `yaml:"target"`    // loudness target in LUFS, between -70 and -5 (default -23)
+	TruePeak float64 `yaml:"true_peak"` // peak limit in dBFS, between -9 and 0 (default -1)
+	MaxGain  float64 `yaml:"max_gain"`  // maximum boost or cut in dB, so that background noise is not raised to the target (default 12)
+}
+
+type PreviewConfig struct {
+	Delay   time.Duration `yaml:"delay"`   // time after the first frame to capture (default 2s)
+	Quality int           `yaml:"quality"` // jpeg quality between 1 and 100 (default 80)
+}
+
+type LowLatencyHLSConfig struct {
+	PartDuration time.Duration `yaml:"part_duration"` // duration of each partial segment (default 1s)
+}
+
+type CMAFChunkedConfig struct {
+	ChunkDuration time.Duration `yaml:"chunk_duration"` // duration of each fragment sent (default 500ms)
+}
+
+type HLSRenditionConfig struct {
+	Name         string `yaml:"name"`          // appended to the playlist and segment names, e.g. 720p
+	Width        int32  `yaml:"width"`         // in landscape. Swapped for portrait layouts
+	Height       int32  `yaml:"height"`        // in landscape. Swapped for portrait layouts
+	VideoBitrate int32  `yaml:"video_bitrate"` // kbps
+}
+
+type AlternateAudioConfig struct {
+	Language string                      `yaml:"language"` // language of the main audio track, e.g. en (default und)
+	Name     string                      `yaml:"name"`     // name of the main audio track in hls players (default Main)
+	Tracks   []AlternateAudioTrackConfig `yaml:"tracks"`
+}
+
+type AlternateAudioTrackConfig struct {
+	Language            string `yaml:"language"`             // ISO 639 language code, unique
+	Name                string `yaml:"name"`                 // name in hls players (default the language)
+	ParticipantIdentity string `yaml:"participant_identity"` // audio published by this participant
+	TrackName           string `yaml:"track_name"`           // only the track with this name (default any audio track)
+}
+
+type HLSEncryptionConfig struct {
+	Key              string           `yaml:"key"`               // static 16 byte key, hex encoded (default generated keys)
+	KeyURI           string           `yaml:"key_uri"`           // EXT-X-KEY uri. {key} is replaced by the key filename (default the uploaded key file)
+	RotationInterval int              `yaml:"rotation_interval"` // segments per key, 0 to never rotate
+	KeyServer        *KeyServerConfig `yaml:"key_server"`        // fetch keys from a key server instead
+}
+
+const (
+	DRMWidevine = "widevine"
+	DRMFairPlay = "fairplay"
+)
+
+// KeyServerConfig fetches content keys, and any DRM signaling, from an external key server
+type KeyServerConfig struct {
+	URL        string            `yaml:"url"`
+	Headers    map[string]string `yaml:"headers"`     // added to every request, e.g. for auth
+	DRMSystems []string          `yaml:"drm_systems"` // widevine and/or fairplay signaling requested from the key server
+	Timeout    time.Duration     `yaml:"timeout"`     // per request (default 10s)
+}
+
+// PlaylistURIConfig replaces the relative uris in uploaded playlists, so that they can be played directly from storage or a CDN
+type PlaylistURIConfig struct {
+	BaseURL       string        `yaml:"base_url"`       // prepended to the storage path of each file
+	Presign       bool          `yaml:"presign"`        // use presigned urls instead (s3 and alioss only)
+	PresignExpiry time.Duration `yaml:"presign_expiry"` // how long presigned urls are valid (default 24h, max 7 days)
+}
+
+type EncryptionConfig struct {
+	PublicKey string `yaml:"public_key"` // PEM encoded RSA public key
+}
+
+type UploadHookConfig struct {
+	Command []string          `yaml:"command"` // run with the local file path appended. A non-zero exit code vetoes the upload
+	URL     string            `yaml:"url"`     // receives the file in a POST. A 4xx response vetoes the upload
+	Headers map[string]string `yaml:"headers"` // added to url requests
+	Timeout time.Duration     `yaml:"timeout"` // per file (default 5m)
+}
+
+type UploadHeadersConfig struct {
+	Match        string `yaml:"match"`         // filename pattern, e.g. *.m3u8
+	ContentType  string `yaml:"content_type"`  // replaces the content type of the output
+	CacheControl string `yaml:"cache_control"` // Cache-Control header
+}
+
+// UploadReplicaConfig is an additional destination of every uploaded file, with exactly one storage
+type UploadReplicaConfig struct {
+	Name     string        `yaml:"name"`     // names the destination in logs and the manifest
+	Required bool          `yaml:"required"` // the egress fails if an upload fails here, after the output storage has the file
+	S3       *S3Config     `yaml:"s3"`
+	Azure    *AzureConfig  `yaml:"azure"`
+	GCP      *GCPConfig    `yaml:"gcp"`
+	AliOSS   *AliOSSConfig `yaml:"alioss"`
+	Local    *LocalConfig  `yaml:"local"`
+}
+
+// GetUploadConfig returns the storage of the replica, or nil if there is none
+func (c *UploadReplicaConfig) GetUploadConfig() interface{} {
+	switch {
+	case c.S3 != nil:
+		return c.S3.ToS3Upload()
+	case c.Azure != nil:
+		return c.Azure.ToAzureUpload()
+	case c.GCP != nil:
+		return c.GCP.ToGCPUpload()
+	case c.AliOSS != nil:
+		return c.AliOSS.ToAliOSSUpload()
+	case c.Local != nil:
+		return c.Local
+	default:
+		return nil
+	}
+}
+
+func (c *UploadReplicaConfig) storageCount() int {
+	count := 0
+	for _, set := range []bool{c.S3 != nil, c.Azure != nil, c.GCP != nil, c.AliOSS != nil, c.Local != nil} {
+		if set {
+			count++
+		}
+	}
+	return count
+}
+
+type PostProcessConfig struct {
+	Name    string        `yaml:"name"`    // names the step in logs and the manifest
+	Command []string      `yaml:"command"` // {input}, {output} and {artifacts} are replaced in each argument
+	Timeout time.Duration `yaml:"timeout"` // default 10m
+}
+
+type IOClientConfig struct {
+	Timeout          time.Duration `yaml:"timeout"`           // deadline for each attempt
+	MaxAttempts      int           `yaml:"max_attempts"`      // attempts per update
+	Backoff          time.Duration `yaml:"backoff"`           // added to the deadline after each attempt
+	BreakerThreshold int           `yaml:"breaker_threshold"` // consecutive failures before non-final updates are held
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`  // how long non-final updates are held for, before the latest one of each egress is sent
+}
+
+// UploadRetryConfig is used by every storage in place of the retries of each SDK
+type UploadRetryConfig struct {
+	MaxRetries     int           `yaml:"max_retries"`     // after the first attempt (default 5)
+	RequestTimeout time.Duration `yaml:"request_timeout"` // deadline for each request to s3, gcp, azure, dropbox or http storage (default none, 32s for gcp)
+	MinDelay       time.Duration `yaml:"min_delay"`       // before the first retry (default 100ms)
+	MaxDelay       time.Duration `yaml:"max_delay"`       // (default 5s)
+	Multiplier     float64       `yaml:"multiplier"`      // delay growth after each retry (default 2)
+}
+
+// UploadSpoolConfig keeps files which could not be uploaded after every retry, so that a storage outage doesn't lose them
+type UploadSpoolConfig struct {
+	Directory     string        `yaml:"directory"`      // must survive restarts, and not be the local_directory
+	RetryInterval time.Duration `yaml:"retry_interval"` // time between uploads of spooled files by the service (default 5m)
+}
+
+// ChromeLaunchConfig limits how many handlers on a node launch xvfb and chrome at once
+type ChromeLaunchConfig struct {
+	MaxConcurrent int           `yaml:"max_concurrent"` // launches at once, across all handlers (default 1)
+	QueueTimeout  time.Duration `yaml:"queue_timeout"`  // max time to wait for a launch slot (default 1m)
+	Timeout       time.Duration `yaml:"timeout"`        // deadline for chrome to start and load the page (default 30s)
+	Retries       int           `yaml:"retries"`        // relaunches after a failed or timed out launch (default 1)
+	Backoff       time.Duration `yaml:"backoff"`        // before the first retry, doubled after each (default 1s)
+
+	FirstFrameTimeout time.Duration `yaml:"first_frame_timeout"` // max time from the start of recording to the first captured frame (default 0, disabled)
+}
+
+// CBRConfig keeps rtmp outputs and ts segments at a near constant bitrate, for CDNs and receivers which reject variable bitrates
+type CBRConfig struct {
+	VBVBuffer   time.Duration `yaml:"vbv_buffer"`   // h264 hrd buffer, smaller is closer to constant at the cost of quality (default 1s, max 10s)
+	MuxOverhead float64       `yaml:"mux_overhead"` // ts padding rate above the video and audio bitrates, as a fraction (default 0.1)
+}
+
+type RTMPReconnectConfig struct {
+	Window      time.Duration `yaml:"window"`       // max time spent reconnecting before the output is removed (default 1m)
+	Backoff     time.Duration `yaml:"backoff"`      // before the first attempt, doubled after each (default 1s)
+	MaxBackoff  time.Duration `yaml:"max_backoff"`  // default 10s
+	Buffer      time.Duration `yaml:"buffer"`       // media kept while disconnected, and sent after reconnecting (default 5s, max 30s)
+	MaxAttempts int           `yaml:"max_attempts"` // attempts before the output is removed, even within the window (default 0, no limit)
+}
+
+// S3MultipartConfig uploads s3 files in parts, checkpointed to disk so that an interrupted upload resumes
+type S3MultipartConfig struct {
+	PartSize    int64 `yaml:"part_size"`   // MB, at least 5 (default 16)
+	Concurrency int   `yaml:"concurrency"` // parts uploaded at once (default 4)
+}
+
+// S3SSEConfig sets the server-side encryption headers of every s3 upload, for buckets which require them
+type S3SSEConfig struct {
+	Type     string `yaml:"type"`       // sse-s3 or sse-kms
+	KMSKeyID string `yaml:"kms_key_id"` // sse-kms only. The aws managed key is used if empty
+}
+
+const (
+	S3SSETypeS3  = "sse-s3"
+	S3SSETypeKMS = "sse-kms"
+)
+
+// S3AssumeRoleConfig uploads into buckets owned by other accounts with temporary credentials, instead of long-lived keys
+type S3AssumeRoleConfig struct {
+	Bucket      string        `yaml:"bucket"` // empty to use the role for every bucket without its own
+	RoleARN     string        `yaml:"role_arn"`
+	ExternalID  string        `yaml:"external_id"`  // required by the trust policy of the role, if any
+	SessionName string        `yaml:"session_name"` // default egress
+	Duration    time.Duration `yaml:"duration"`     // of each set of credentials, which are refreshed before they expire (default 15m)
+}
+
+// S3ObjectConfig is applied to every s3 upload, so that files land with the right lifecycle and taxonomy
+type S3ObjectConfig struct {
+	StorageClass string            `yaml:"storage_class"` // e.g. INTELLIGENT_TIERING (default the bucket default)
+	ACL          string            `yaml:"acl"`           // canned acl, e.g. bucket-owner-full-control
+	Tags         map[string]string `yaml:"tags"`          // added to the tagging of each request
+}
+
+var (
+	s3StorageClasses = map[string]bool{
+		"STANDARD": true, "REDUCED_REDUNDANCY": true, "STANDARD_IA": true, "ONEZONE_IA": true, "INTELLIGENT_TIERING": true,
+		"GLACIER": true, "GLACIER_IR": true, "DEEP_ARCHIVE": true, "OUTPOSTS": true,
+	}
+	s3CannedACLs = map[string]bool{
+		"private": true, "public-read": true, "public-read-write": true, "authenticated-read": true,
+		"aws-exec-read": true, "bucket-owner-read": true, "bucket-owner-full-control": true,
+	}
+)
+
+// DisplayPoolConfig is the range of X display numbers handlers allocate from
+type DisplayPoolConfig struct {
+	Start int `yaml:"start"` // first display number (default 10)
+	Size  int `yaml:"size"`  // number of displays (default 1000)
+}
+
+// PulseSinkConfig is the format of the null sink each web egress captures chrome audio from
+type PulseSinkConfig struct {
+	SampleRate int `yaml:"sample_rate"` // default 48000
+	Channels   int `yaml:"channels"`    // 1 or 2 (default 2)
+}
+
+// HandlerGCConfig tunes the garbage collector of handler processes, which are separate from the service
+type HandlerGCConfig struct {
+	GOGC        string `yaml:"gogc"`         // GOGC, a percentage or off
+	MemoryLimit string `yaml:"memory_limit"` // GOMEMLIMIT, e.g. 2GiB
+	Ballast     int64  `yaml:"ballast"`      // MB allocated and never touched, which raises the heap size of the first collections
+}
+
+// same format as GOMEMLIMIT
+var memoryLimitRegexp = regexp.MustCompile(`^(off|\d+(B|KiB|MiB|GiB|TiB)?)$`)
+
+type ClockConfig struct {
+	NTPServer    string        `yaml:"ntp_server"`     // host or host:port
+	PTPDevice    string        `yaml:"ptp_device"`     // PTP hardware clock disciplined by ptp4l, e.g. /dev/ptp0
+	PTPUTCOffset time.Duration `yaml:"ptp_utc_offset"` // subtracted from the PTP clock, which runs on TAI (default 37s)
+	SyncInterval time.Duration `yaml:"sync_interval"`  // default 1m
+}
+
+type TelemetryConfig struct {
+	Endpoint        string            `yaml:"endpoint"`         // OTLP/HTTP collector, e.g. http://otel-collector:4318
+	Headers         map[string]string `yaml:"headers"`          // sent with each export, e.g. for auth
+	ServiceName     string            `yaml:"service_name"`     // default egress
+	MetricsInterval time.Duration     `yaml:"metrics_interval"` // default 15s
+	DisableMetrics  bool              `yaml:"disable_metrics"`  // only export traces
+}
+
+type ICEConfig struct {
+	ForceRelay bool `yaml:"force_relay"` // only use relay candidates from the TURN servers sent by the server
+}
+
+type NetworkStatsConfig struct {
+	Interval      time.Duration `yaml:"interval"`       // time between updates (default 10s)
+	LossThreshold float64       `yaml:"loss_threshold"` // packet loss fraction recorded as a packet_loss event (default 0.05)
+}
+
+type FileIndexConfig struct {
+	Interval       time.Duration `yaml:"interval"`        // minimum time between entries. Video entries are added at keyframes (default 1s)
+	UpdateInterval time.Duration `yaml:"update_interval"` // time between uploads while recording (default 1m)
+}
+
+type ProfilingConfig struct {
+	Interval      time.Duration `yaml:"interval"`       // time between profiles (default 5m)
+	CPUDuration   time.Duration `yaml:"cpu_duration"`   // length of each cpu profile (default 10s)
+	Profiles      []string      `yaml:"profiles"`       // cpu, heap, allocs, goroutine, block, mutex, or threadcreate (default cpu and heap)
+	StoragePrefix string        `yaml:"storage_prefix"` // path prefix used when uploading to the default storage (default profiles)
+	PyroscopeURL  string        `yaml:"pyroscope_url"`  // send profiles to pyroscope instead of storage
 }
 
 func (c *BaseConfig) initLogger(values ...interface{}) error {
@@ -100,9 +579,9 @@ func (c *BaseConfig) initLogger(values ...interface{}) error {
 		c.Logging.Level = c.LogLevel
 	}
 
-	zl, err := logger.NewZapLogger(&c.Logging)
+	zl, err := logging.NewLogger(c.Logging, c.LogLevels, c.LogSampling)
 	if err != nil {
-		return err
+		return errors.ErrCouldNotParseConfig(err)
 	}
 
 	l := zl.WithValues(values...)
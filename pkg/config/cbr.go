@@ -0,0 +1,39 @@
+package config
+
+import (
+	"github.com/livekit/egress/pkg/types"
+)
+
+// CBREncoding returns true if h264 video is encoded at a constant bitrate, padded with filler data.
+// Rtmp outputs and ts segments need it, other outputs share the encoder
+func (p *PipelineConfig) CBREncoding() bool {
+	if p.CBR == nil || !p.VideoEnabled {
+		return false
+	}
+	if o := p.GetStreamConfig(); o != nil && o.OutputType == types.OutputTypeRTMP {
+		return true
+	}
+	o := p.GetSegmentConfig()
+	return o != nil && o.OutputType == types.OutputTypeHLS && !o.FMP4
+}
+
+// TSMuxRate returns the rate the ts segments of an output are padded to with null packets, in bits per second,
+// or 0 if they are not padded
+func (p *PipelineConfig) TSMuxRate(o *SegmentConfig) uint64 {
+	if p.CBR == nil || o.OutputType != types.OutputTypeHLS || o.FMP4 {
+		return 0
+	}
+
+	var kbps int32
+	if p.AudioEnabled {
+		kbps += p.AudioBitrate
+	}
+	switch {
+	case o.AudioRendition != nil:
+	case o.Rendition != nil:
+		kbps += o.Rendition.VideoBitrate
+	case p.VideoEnabled:
+		kbps += p.VideoBitrate
+	}
+	return uint64(float64(kbps) * 1000 * (1 + p.CBR.MuxOverhead))
+}
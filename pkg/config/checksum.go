@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+)
+
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumMD5    = "md5"
+)
+
+// ChecksumConfig lists checksums of uploaded files and segments in the manifest, for integrity verification downstream
+type ChecksumConfig struct {
+	Algorithms  []string `yaml:"algorithms"`    // sha256 and/or md5 (default sha256)
+	SetOnObject bool     `yaml:"set_on_object"` // also store them as object metadata, on storage which supports it
+}
+
+// Checksums are hex encoded, of the file as stored, after any encryption
+type Checksums struct {
+	SHA256 string `json:"sha256,omitempty"`
+	MD5    string `json:"md5,omitempty"`
+}
+
+func (c *ChecksumConfig) validate() error {
+	if len(c.Algorithms) == 0 {
+		c.Algorithms = []string{ChecksumSHA256}
+	}
+	for _, a := range c.Algorithms {
+		switch a {
+		case ChecksumSHA256, ChecksumMD5:
+		default:
+			return fmt.Errorf("invalid checksum algorithm %s", a)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package config
+
+import (
+	"github.com/livekit/egress/pkg/clock"
+)
+
+// StartClock synchronizes wall clock metadata with the configured NTP or PTP reference
+func (c *BaseConfig) StartClock() error {
+	if c.Clock == nil {
+		return nil
+	}
+
+	var src clock.Source
+	if c.Clock.PTPDevice != "" {
+		src = clock.NewPTPSource(c.Clock.PTPDevice, c.Clock.PTPUTCOffset)
+	} else {
+		src = clock.NewNTPSource(c.Clock.NTPServer)
+	}
+	return clock.Start(src, c.Clock.SyncInterval)
+}
@@ -2,10 +2,15 @@ package config
 
 import (
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/egress/pkg/util"
+	"github.com/livekit/protocol/auth"
 	"github.com/livekit/protocol/livekit"
 	"github.com/livekit/protocol/rpc"
 )
@@ -56,6 +61,17 @@ func TestRedactUpload(t *testing.T) {
 	require.Equal(t, "access", output.UploadConfig.(*livekit.S3Upload).AccessKey)
 }
 
+func TestAliOSSEndpoint(t *testing.T) {
+	conf := &AliOSSConfig{Region: "cn-hangzhou", Bucket: "bucket"}
+	require.Equal(t, "oss-cn-hangzhou.aliyuncs.com", conf.ToAliOSSUpload().Endpoint)
+
+	conf.Region = "oss-cn-shanghai"
+	require.Equal(t, "oss-cn-shanghai.aliyuncs.com", conf.ToAliOSSUpload().Endpoint)
+
+	conf.Endpoint = "oss-cn-shanghai-internal.aliyuncs.com"
+	require.Equal(t, "oss-cn-shanghai-internal.aliyuncs.com", conf.ToAliOSSUpload().Endpoint)
+}
+
 func TestRedactStreamKeys(t *testing.T) {
 	t.Cleanup(func() {
 		_ = os.Remove("test_stream/")
@@ -179,3 +195,1040 @@ func TestSegmentNaming(t *testing.T) {
 		require.Equal(t, test.expectedSegmentPrefix, o.SegmentPrefix)
 	}
 }
+
+func TestHighResolutionEncoding(t *testing.T) {
+	for _, test := range []struct {
+		name            string
+		options         *livekit.EncodingOptions
+		expectedBitrate int32
+		expectErr       bool
+	}{
+		{
+			name:            "1440p30",
+			options:         &livekit.EncodingOptions{Width: 2560, Height: 1440},
+			expectedBitrate: 8000,
+		},
+		{
+			name:            "4k60",
+			options:         &livekit.EncodingOptions{Width: 3840, Height: 2160, Framerate: 60},
+			expectedBitrate: 24000,
+		},
+		{
+			name:            "portrait 4k30",
+			options:         &livekit.EncodingOptions{Width: 2160, Height: 3840},
+			expectedBitrate: 16000,
+		},
+		{
+			name:            "custom bitrate",
+			options:         &livekit.EncodingOptions{Width: 3840, Height: 2160, VideoBitrate: 20000},
+			expectedBitrate: 20000,
+		},
+		{
+			name:            "720p keeps default bitrate",
+			options:         &livekit.EncodingOptions{Width: 1280, Height: 720},
+			expectedBitrate: 4500,
+		},
+		{
+			name:            "1080p60 keeps default bitrate",
+			options:         &livekit.EncodingOptions{Framerate: 60},
+			expectedBitrate: 4500,
+		},
+		{
+			name:            "4k60 key frame interval",
+			options:         &livekit.EncodingOptions{Width: 3840, Height: 2160, Framerate: 60, KeyFrameInterval: 2},
+			expectedBitrate: 24000,
+		},
+		{
+			name:      "negative key frame interval",
+			options:   &livekit.EncodingOptions{KeyFrameInterval: -1},
+			expectErr: true,
+		},
+		{
+			name:      "key frame interval under one frame",
+			options:   &livekit.EncodingOptions{Framerate: 15, KeyFrameInterval: 0.05},
+			expectErr: true,
+		},
+		{
+			name:      "framerate too high",
+			options:   &livekit.EncodingOptions{Framerate: 120},
+			expectErr: true,
+		},
+		{
+			name:      "resolution too high",
+			options:   &livekit.EncodingOptions{Width: 3840, Height: 3840},
+			expectErr: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p := &PipelineConfig{
+				VideoConfig: VideoConfig{Width: 1920, Height: 1080, Framerate: 30, VideoBitrate: 4500},
+			}
+			err := p.applyAdvanced(test.options)
+			if test.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedBitrate, p.VideoBitrate)
+		})
+	}
+
+	factor := GetEncodingCostFactor(&rpc.StartEgressRequest{
+		Request: &rpc.StartEgressRequest_RoomComposite{
+			RoomComposite: &livekit.RoomCompositeEgressRequest{
+				Options: &livekit.RoomCompositeEgressRequest_Advanced{
+					Advanced: &livekit.EncodingOptions{Width: 3840, Height: 2160, Framerate: 60},
+				},
+			},
+		},
+	})
+	require.Equal(t, float64(8), factor)
+}
+
+func TestProxyFile(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.Remove("test_proxy/")
+	})
+
+	conf := &ServiceConfig{
+		BaseConfig: BaseConfig{
+			NodeID: "server",
+			ProxyFile: &ProxyFileConfig{
+				Width:        640,
+				Height:       360,
+				VideoBitrate: 500,
+				Suffix:       "_proxy",
+			},
+		},
+	}
+
+	req := &rpc.StartEgressRequest{
+		EgressId: "test_proxy",
+		Request: &rpc.StartEgressRequest_RoomComposite{
+			RoomComposite: &livekit.RoomCompositeEgressRequest{
+				RoomName: "room",
+				Output: &livekit.RoomCompositeEgressRequest_File{
+					File: &livekit.EncodedFileOutput{
+						Filepath: "recordings/archive.mp4",
+						Output: &livekit.EncodedFileOutput_S3{
+							S3: &livekit.S3Upload{
+								Bucket: "bucket",
+							},
+						},
+					},
+				},
+			},
+		},
+		Token: "token",
+		WsUrl: "wss://egress.com",
+	}
+
+	p, err := GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+
+	require.Len(t, p.Outputs, 2)
+	require.Equal(t, 2, p.OutputCount)
+	require.Len(t, p.Info.FileResults, 2)
+
+	proxy := p.GetProxyFileConfig()
+	require.NotNil(t, proxy)
+	require.Equal(t, "recordings/archive_proxy.mp4", proxy.StorageFilepath)
+	require.Equal(t, proxy.StorageFilepath, p.Info.FileResults[1].Filename)
+	require.True(t, proxy.DisableManifest)
+	require.NotNil(t, proxy.UploadConfig)
+
+	// the proxy keeps the aspect ratio of the output
+	for _, test := range []struct {
+		width, height           int32
+		proxyWidth, proxyHeight int32
+	}{
+		{1920, 1080, 640, 360},
+		{1080, 1920, 360, 640},
+		{1440, 1080, 480, 360},
+		{2560, 1080, 640, 270},
+	} {
+		p.Width, p.Height = test.width, test.height
+		width, height := p.ProxyResolution()
+		require.Equal(t, test.proxyWidth, width, "%dx%d", test.width, test.height)
+		require.Equal(t, test.proxyHeight, height, "%dx%d", test.width, test.height)
+	}
+
+	// h264 can't be muxed into webm, so webm outputs get an mp4 proxy
+	webm := &PipelineConfig{
+		BaseConfig: conf.BaseConfig,
+		Outputs: map[types.EgressType]OutputConfig{
+			types.EgressTypeFile: &FileConfig{
+				outputConfig:    outputConfig{OutputType: types.OutputTypeWebM},
+				StorageFilepath: "recordings/archive.webm",
+				LocalFilepath:   "archive.webm",
+			},
+		},
+		Info: &livekit.EgressInfo{},
+	}
+	webm.VideoEnabled = true
+	webm.VideoTranscoding = true
+	webm.updateProxyFileOutput()
+	proxy = webm.GetProxyFileConfig()
+	require.Equal(t, types.OutputTypeMP4, proxy.OutputType)
+	require.Equal(t, "recordings/archive_proxy.mp4", proxy.StorageFilepath)
+	require.Equal(t, "archive_proxy.mp4", proxy.LocalFilepath)
+
+	// audio only requests have nothing to proxy
+	req.GetRoomComposite().AudioOnly = true
+	p, err = GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+	require.Nil(t, p.GetProxyFileConfig())
+	require.Len(t, p.Info.FileResults, 1)
+}
+
+func TestHLSLadder(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test_ladder/")
+	})
+
+	conf := &ServiceConfig{
+		BaseConfig: BaseConfig{
+			NodeID: "server",
+			HLSLadder: []HLSRenditionConfig{
+				{Name: "720p", Width: 1280, Height: 720, VideoBitrate: 2500},
+				{Name: "360p", Width: 640, Height: 360, VideoBitrate: 600},
+			},
+		},
+	}
+
+	req := &rpc.StartEgressRequest{
+		EgressId: "test_ladder",
+		Request: &rpc.StartEgressRequest_RoomComposite{
+			RoomComposite: &livekit.RoomCompositeEgressRequest{
+				RoomName: "room",
+				Output: &livekit.RoomCompositeEgressRequest_Segments{
+					Segments: &livekit.SegmentedFileOutput{
+						FilenamePrefix: "test_ladder/segment",
+						PlaylistName:   "test_ladder/playlist.m3u8",
+					},
+				},
+			},
+		},
+		Token: "token",
+		WsUrl: "wss://egress.com",
+	}
+
+	p, err := GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+
+	o := p.GetSegmentConfig()
+	require.NotNil(t, o)
+	require.Equal(t, "playlist_master.m3u8", o.MasterPlaylistFilename)
+	require.Len(t, o.Renditions, 2)
+	require.Len(t, p.Info.SegmentResults, 3)
+
+	r := o.Renditions[1]
+	require.Equal(t, "playlist_360p.m3u8", r.PlaylistFilename)
+	require.Equal(t, "segment_360p", r.SegmentPrefix)
+	require.Equal(t, "splitmuxsink_360p", r.SinkName())
+	require.Equal(t, "test_ladder/playlist_360p.m3u8", p.Info.SegmentResults[2].PlaylistName)
+	require.True(t, r.DisableManifest)
+	require.Empty(t, r.MasterPlaylistFilename)
+
+	// audio only requests have no renditions
+	req.GetRoomComposite().AudioOnly = true
+	p, err = GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+	require.Empty(t, p.GetSegmentConfig().Renditions)
+	require.Len(t, p.Info.SegmentResults, 1)
+}
+
+func TestAlternateAudio(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test_alternate/")
+	})
+
+	conf := &ServiceConfig{
+		BaseConfig: BaseConfig{
+			NodeID: "server",
+			AlternateAudio: &AlternateAudioConfig{
+				Language: "en",
+				Name:     "English",
+				Tracks: []AlternateAudioTrackConfig{
+					{Language: "es", Name: "Español", ParticipantIdentity: "interpreter-es"},
+				},
+			},
+		},
+	}
+
+	req := &rpc.StartEgressRequest{
+		EgressId: "test_alternate",
+		Request: &rpc.StartEgressRequest_TrackComposite{
+			TrackComposite: &livekit.TrackCompositeEgressRequest{
+				RoomName:     "room",
+				AudioTrackId: "TR_audio",
+				VideoTrackId: "TR_video",
+				Output: &livekit.TrackCompositeEgressRequest_Segments{
+					Segments: &livekit.SegmentedFileOutput{
+						FilenamePrefix: "test_alternate/segment",
+						PlaylistName:   "test_alternate/playlist.m3u8",
+					},
+				},
+			},
+		},
+		Token: "token",
+		WsUrl: "wss://egress.com",
+	}
+
+	p, err := GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+	require.Len(t, p.AlternateAudioTracks, 1)
+	require.Equal(t, "es", p.AlternateAudioTracks[0].Language)
+
+	// renditions are added once the sdk source has found the tracks
+	o := p.GetSegmentConfig()
+	require.Empty(t, o.AudioRenditions)
+	require.NoError(t, p.UpdateInfoFromSDK("room", nil))
+	require.Equal(t, "playlist_master.m3u8", o.MasterPlaylistFilename)
+	require.Len(t, o.AudioRenditions, 1)
+	require.Len(t, p.Info.SegmentResults, 2)
+
+	r := o.AudioRenditions[0]
+	require.Equal(t, "playlist_es.m3u8", r.PlaylistFilename)
+	require.Equal(t, "segment_es", r.SegmentPrefix)
+	require.Equal(t, "splitmuxsink_audio_es", r.SinkName())
+	require.True(t, r.DisableManifest)
+
+	// without published tracks, there is nothing to add
+	p, err = GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+	p.AlternateAudioTracks = nil
+	require.NoError(t, p.UpdateInfoFromSDK("room", nil))
+	require.Empty(t, p.GetSegmentConfig().AudioRenditions)
+	require.Empty(t, p.GetSegmentConfig().MasterPlaylistFilename)
+}
+
+func TestSuggestLadder(t *testing.T) {
+	conf := &ServiceConfig{
+		BaseConfig: BaseConfig{
+			NodeID: "server",
+			HLSLadder: []HLSRenditionConfig{
+				{Name: "360p", Width: 640, Height: 360, VideoBitrate: 600},
+			},
+		},
+	}
+
+	ladder, err := SuggestLadder(conf, &LadderRequest{
+		Outputs:      []string{"mp4", "hls"},
+		Preset:       "H264_720P_30",
+		SourceWidth:  640,
+		SourceHeight: 480,
+	})
+	require.NoError(t, err)
+	require.Len(t, ladder.Rungs, 2)
+
+	main := ladder.Rungs[0]
+	require.Equal(t, "main", main.Name)
+	require.Len(t, main.Outputs, 2)
+	require.Equal(t, int32(1280), main.Width)
+	require.Equal(t, int32(720), main.Height)
+	require.Equal(t, int32(3000), main.VideoBitrate)
+	require.Equal(t, int32(128), main.AudioBitrate)
+	require.NotZero(t, main.SegmentDuration)
+
+	rendition := ladder.Rungs[1]
+	require.Equal(t, "360p", rendition.Name)
+	require.Equal(t, int32(600), rendition.VideoBitrate)
+
+	// only the main encoding is larger than the source
+	require.Len(t, ladder.Warnings, 1)
+
+	_, err = SuggestLadder(conf, &LadderRequest{Outputs: []string{"mp4"}, Preset: "H264_720P_30", Width: 1280})
+	require.Error(t, err)
+	_, err = SuggestLadder(conf, &LadderRequest{Outputs: []string{"flv"}})
+	require.Error(t, err)
+}
+
+func TestAddSegmentOutput(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test_update/")
+	})
+
+	conf := &ServiceConfig{
+		BaseConfig: BaseConfig{
+			NodeID:        "server",
+			OutputUpdates: true,
+		},
+	}
+
+	req := &rpc.StartEgressRequest{
+		EgressId: "test_update",
+		Request: &rpc.StartEgressRequest_RoomComposite{
+			RoomComposite: &livekit.RoomCompositeEgressRequest{
+				RoomName: "room",
+				Output: &livekit.RoomCompositeEgressRequest_File{
+					File: &livekit.EncodedFileOutput{
+						Filepath: "test_update/recording.mp4",
+					},
+				},
+			},
+		},
+		Token: "token",
+		WsUrl: "wss://egress.com",
+	}
+
+	p, err := GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+	keyFrameInterval := p.KeyFrameInterval
+
+	// json playlists need webm segments
+	_, err = p.AddSegmentOutput(&livekit.SegmentedFileOutput{PlaylistName: "test_update/playlist.json"})
+	require.Error(t, err)
+	require.Nil(t, p.GetSegmentConfig())
+
+	o, err := p.AddSegmentOutput(&livekit.SegmentedFileOutput{
+		FilenamePrefix:  "test_update/live",
+		SegmentDuration: 2,
+	})
+	require.NoError(t, err)
+	require.Equal(t, o, p.GetSegmentConfig())
+	require.Equal(t, "live.m3u8", o.PlaylistFilename)
+	require.Equal(t, 2, p.OutputCount)
+	require.Len(t, p.Info.SegmentResults, 1)
+	require.Equal(t, keyFrameInterval, p.KeyFrameInterval)
+
+	_, err = p.AddSegmentOutput(&livekit.SegmentedFileOutput{FilenamePrefix: "test_update/other"})
+	require.Error(t, err)
+}
+
+func TestVideoCodecPreferences(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.Remove("test_vp9/")
+	})
+
+	conf := &ServiceConfig{
+		BaseConfig: BaseConfig{
+			NodeID:         "server",
+			WebMVideoCodec: "vp9",
+		},
+	}
+
+	file := &livekit.EncodedFileOutput{
+		Filepath: "recordings/archive.webm",
+		Output: &livekit.EncodedFileOutput_S3{
+			S3: &livekit.S3Upload{
+				Bucket: "bucket",
+			},
+		},
+	}
+	req := &rpc.StartEgressRequest{
+		EgressId: "test_vp9",
+		Request: &rpc.StartEgressRequest_RoomComposite{
+			RoomComposite: &livekit.RoomCompositeEgressRequest{
+				RoomName: "room",
+				Output: &livekit.RoomCompositeEgressRequest_File{
+					File: file,
+				},
+			},
+		},
+		Token: "token",
+		WsUrl: "wss://egress.com",
+	}
+
+	p, err := GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+	require.Equal(t, types.MimeTypeVP9, p.VideoOutCodec)
+
+	// h264 is still used for mp4
+	file.Filepath = "recordings/archive.mp4"
+	p, err = GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+	require.Equal(t, types.MimeTypeH264, p.VideoOutCodec)
+
+	// unless hevc is enabled
+	conf.HEVC = true
+	p, err = GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+	require.Equal(t, types.MimeTypeH265, p.VideoOutCodec)
+
+	// vp8 by default
+	conf.WebMVideoCodec = ""
+	file.Filepath = "recordings/archive.webm"
+	p, err = GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+	require.Equal(t, types.MimeTypeVP8, p.VideoOutCodec)
+}
+
+func TestAudioValidation(t *testing.T) {
+	conf := &ServiceConfig{
+		BaseConfig: BaseConfig{
+			NodeID: "server",
+		},
+	}
+
+	for _, test := range []struct {
+		name     string
+		fileType livekit.EncodedFileType
+		advanced *livekit.EncodingOptions
+		err      string
+	}{
+		{
+			name:     "aac in ogg",
+			fileType: livekit.EncodedFileType_OGG,
+			advanced: &livekit.EncodingOptions{AudioCodec: livekit.AudioCodec_AAC},
+			err:      "allowed: audio/opus",
+		},
+		{
+			name:     "opus bitrate",
+			fileType: livekit.EncodedFileType_OGG,
+			advanced: &livekit.EncodingOptions{AudioBitrate: 1000},
+			err:      "must be between 6 and 510",
+		},
+		{
+			name:     "aac frequency",
+			fileType: livekit.EncodedFileType_MP4,
+			advanced: &livekit.EncodingOptions{AudioCodec: livekit.AudioCodec_AAC, AudioFrequency: 12345},
+			err:      "allowed: 8000, 16000, 22050, 24000, 32000, 44100, 48000",
+		},
+		{
+			name:     "valid",
+			fileType: livekit.EncodedFileType_MP4,
+			advanced: &livekit.EncodingOptions{AudioCodec: livekit.AudioCodec_AAC, AudioBitrate: 192, AudioFrequency: 48000},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req := &rpc.StartEgressRequest{
+				EgressId: "test_audio_validation",
+				Request: &rpc.StartEgressRequest_RoomComposite{
+					RoomComposite: &livekit.RoomCompositeEgressRequest{
+						RoomName:  "room",
+						AudioOnly: true,
+						Output: &livekit.RoomCompositeEgressRequest_File{
+							File: &livekit.EncodedFileOutput{
+								FileType: test.fileType,
+								Filepath: "/tmp/test_audio_validation",
+							},
+						},
+						Options: &livekit.RoomCompositeEgressRequest_Advanced{
+							Advanced: test.advanced,
+						},
+					},
+				},
+				Token: "token",
+				WsUrl: "wss://egress.com",
+			}
+
+			_, err := GetValidatedPipelineConfig(conf, req)
+			if test.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, test.err)
+			}
+		})
+	}
+}
+
+func TestMP3Output(t *testing.T) {
+	conf := &ServiceConfig{
+		BaseConfig: BaseConfig{
+			NodeID: "server",
+		},
+	}
+
+	composite := &livekit.RoomCompositeEgressRequest{
+		RoomName:  "room",
+		AudioOnly: true,
+		Output: &livekit.RoomCompositeEgressRequest_File{
+			File: &livekit.EncodedFileOutput{
+				Filepath: "/tmp/test_mp3/podcast.mp3",
+			},
+		},
+	}
+	req := &rpc.StartEgressRequest{
+		EgressId: "test_mp3",
+		Request: &rpc.StartEgressRequest_RoomComposite{
+			RoomComposite: composite,
+		},
+		Token: "token",
+		WsUrl: "wss://egress.com",
+	}
+
+	p, err := GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+	require.Equal(t, types.OutputTypeMP3, p.GetFileConfig().OutputType)
+	require.Equal(t, types.MimeTypeMP3, p.AudioOutCodec)
+	require.Equal(t, "/tmp/test_mp3/podcast.mp3", p.GetFileConfig().StorageFilepath)
+
+	// mp3 files are audio only
+	composite.AudioOnly = false
+	_, err = GetValidatedPipelineConfig(conf, req)
+	require.Error(t, err)
+}
+
+func TestWAVOutput(t *testing.T) {
+	conf := &ServiceConfig{
+		BaseConfig: BaseConfig{
+			NodeID: "server",
+		},
+	}
+
+	track := &livekit.TrackEgressRequest{
+		RoomName: "room",
+		TrackId:  "TR_audio",
+		Output: &livekit.TrackEgressRequest_File{
+			File: &livekit.DirectFileOutput{
+				Filepath: "/tmp/test_wav/call.wav",
+			},
+		},
+	}
+	req := &rpc.StartEgressRequest{
+		EgressId: "test_wav",
+		Request: &rpc.StartEgressRequest_Track{
+			Track: track,
+		},
+		Token: "token",
+		WsUrl: "wss://egress.com",
+	}
+
+	p, err := GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+	require.Equal(t, types.OutputTypeWAV, p.GetFileConfig().OutputType)
+	require.Equal(t, "/tmp/test_wav/call.wav", p.GetFileConfig().StorageFilepath)
+
+	// headerless pcm
+	track.Output = &livekit.TrackEgressRequest_File{
+		File: &livekit.DirectFileOutput{
+			Filepath: "/tmp/test_wav/call.raw",
+		},
+	}
+	p, err = GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+	require.Equal(t, types.OutputTypeRaw, p.GetFileConfig().OutputType)
+	require.Equal(t, "/tmp/test_wav/call.raw", p.GetFileConfig().StorageFilepath)
+}
+
+func TestPlacementRules(t *testing.T) {
+	conf := &ServiceConfig{
+		Labels: map[string]string{"region": "eu"},
+		PlacementRules: []PlacementRule{
+			{
+				RequestTypes:   []string{"web"},
+				RequiredLabels: map[string]string{"gpu": "true"},
+			},
+			{
+				RoomPrefix:     "eu-",
+				RequiredLabels: map[string]string{"region": "eu"},
+			},
+		},
+	}
+
+	web := &rpc.StartEgressRequest{
+		Request: &rpc.StartEgressRequest_Web{
+			Web: &livekit.WebEgressRequest{Url: "https://livekit.io"},
+		},
+	}
+	require.False(t, conf.MatchesPlacement(web))
+
+	room := &rpc.StartEgressRequest{
+		Request: &rpc.StartEgressRequest_RoomComposite{
+			RoomComposite: &livekit.RoomCompositeEgressRequest{RoomName: "eu-room"},
+		},
+	}
+	require.True(t, conf.MatchesPlacement(room))
+
+	conf.Labels["region"] = "us"
+	require.False(t, conf.MatchesPlacement(room))
+
+	room.GetRoomComposite().RoomName = "us-room"
+	require.True(t, conf.MatchesPlacement(room))
+}
+
+func TestHandlerBinaries(t *testing.T) {
+	binaries := []HandlerBinaryConfig{
+		{Path: "/usr/local/bin/egress-canary", RequestTypes: []string{"web"}, Fraction: 0.1},
+		{Path: "/usr/local/bin/egress-next", Fraction: 0.2},
+		{Path: "/usr/local/bin/egress-track", RequestTypes: []string{"track"}},
+	}
+	require.Error(t, validateHandlerBinaries(binaries))
+
+	// fractions only add up for the request types they match
+	binaries[1].RequestTypes = []string{"web", "room_composite"}
+	require.NoError(t, validateHandlerBinaries(binaries))
+	require.Equal(t, float64(1), binaries[2].Fraction)
+
+	binaries = append(binaries, HandlerBinaryConfig{Path: "/usr/local/bin/egress-web", RequestTypes: []string{"web"}, Fraction: 0.7})
+	require.NoError(t, validateHandlerBinaries(binaries))
+	binaries[3].Fraction = 0.8
+	require.Error(t, validateHandlerBinaries(binaries))
+}
+
+func TestSessionLimitOverrides(t *testing.T) {
+	limits := SessionLimits{
+		FileOutputMaxDuration: time.Hour,
+		SegmentOutputMaxCount: 1000,
+		RequestTypeLimits: map[string]SessionLimits{
+			"track": {
+				FileOutputMaxDuration: time.Hour * 4,
+				FileOutputMaxSize:     2048,
+			},
+		},
+	}
+
+	track := limits.forRequestType("track")
+	require.Equal(t, time.Hour*4, track.FileOutputMaxDuration)
+	require.Equal(t, int64(2048), track.FileOutputMaxSize)
+	require.Equal(t, int64(1000), track.SegmentOutputMaxCount)
+
+	web := limits.forRequestType("web")
+	require.Equal(t, time.Hour, web.FileOutputMaxDuration)
+	require.Zero(t, web.FileOutputMaxSize)
+}
+
+func TestParseTimecode(t *testing.T) {
+	frames, err := ParseTimecode("01:00:00:00", 30)
+	require.NoError(t, err)
+	require.Equal(t, 3600*30, frames)
+
+	frames, err = ParseTimecode("00:00:01;05", 25)
+	require.NoError(t, err)
+	require.Equal(t, 30, frames)
+
+	_, err = ParseTimecode("00:00:00:30", 30)
+	require.Error(t, err)
+
+	_, err = ParseTimecode("24:00:00:00", 30)
+	require.Error(t, err)
+
+	_, err = ParseTimecode("1:00:00", 30)
+	require.Error(t, err)
+}
+
+func TestSlate(t *testing.T) {
+	color, err := ParseColor("#1a2B3c")
+	require.NoError(t, err)
+	require.Equal(t, uint32(0xff1a2b3c), color)
+
+	_, err = ParseColor("#fff")
+	require.Error(t, err)
+
+	_, err = ParseColor("#gggggg")
+	require.Error(t, err)
+
+	decoder, err := SlateDecoder("/etc/egress/slate.JPG")
+	require.NoError(t, err)
+	require.Equal(t, "jpegdec", decoder)
+
+	_, err = SlateDecoder("/etc/egress/slate.gif")
+	require.Error(t, err)
+}
+
+func TestWatermark(t *testing.T) {
+	w := &WatermarkConfig{Image: "https://example.com/logo.PNG?v=2"}
+	require.NoError(t, w.validate())
+	require.True(t, w.IsRemote())
+	require.Equal(t, "logo.PNG", w.ImageName())
+	require.Equal(t, WatermarkBottomRight, w.Position)
+	require.Equal(t, 1.0, w.Opacity)
+
+	x, y := w.Offsets()
+	require.Equal(t, -16, x)
+	require.Equal(t, -16, y)
+
+	w = &WatermarkConfig{Image: "/etc/egress/logo.jpg", Position: WatermarkTopRight, Margin: 8}
+	require.NoError(t, w.validate())
+	require.False(t, w.IsRemote())
+	x, y = w.Offsets()
+	require.Equal(t, -8, x)
+	require.Equal(t, 8, y)
+
+	require.Error(t, (&WatermarkConfig{Image: "/etc/egress/logo.gif"}).validate())
+	require.Error(t, (&WatermarkConfig{Image: "/etc/egress/logo.png", Position: "center"}).validate())
+	require.Error(t, (&WatermarkConfig{Image: "/etc/egress/logo.png", Opacity: 2}).validate())
+}
+
+func TestTemplateToken(t *testing.T) {
+	conf := &ServiceConfig{
+		BaseConfig: BaseConfig{
+			NodeID:    "server",
+			ApiKey:    "key",
+			ApiSecret: "secret",
+			TemplateToken: &TemplateTokenConfig{
+				Policy: TemplateTokenAlways,
+				TTL:    time.Minute * 5,
+			},
+		},
+	}
+
+	req := &rpc.StartEgressRequest{
+		EgressId: "test_template_token",
+		Request: &rpc.StartEgressRequest_RoomComposite{
+			RoomComposite: &livekit.RoomCompositeEgressRequest{
+				RoomName: "room",
+				Output: &livekit.RoomCompositeEgressRequest_File{
+					File: &livekit.EncodedFileOutput{
+						Filepath: "/tmp/test_template_token.mp4",
+					},
+				},
+			},
+		},
+		Token: "token",
+		WsUrl: "wss://egress.com",
+	}
+
+	p, err := GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+	require.NotEqual(t, "token", p.Token)
+
+	v, err := auth.ParseAPIToken(p.Token)
+	require.NoError(t, err)
+	require.Equal(t, "test_template_token", v.Identity())
+	claims, err := v.Verify("secret")
+	require.NoError(t, err)
+	require.Equal(t, "room", claims.Video.Room)
+	require.True(t, claims.Video.Hidden)
+	require.False(t, *claims.Video.CanPublish)
+	require.True(t, *claims.Video.CanSubscribe)
+
+	conf.TemplateToken.Policy = TemplateTokenFallback
+	p, err = GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+	require.Equal(t, "token", p.Token)
+}
+
+func TestParticipant(t *testing.T) {
+	conf := &ServiceConfig{
+		BaseConfig: BaseConfig{
+			NodeID:    "server",
+			ApiKey:    "key",
+			ApiSecret: "secret",
+			Participant: &ParticipantConfig{
+				Identity: "recorder_{room_name}_{egress_id}",
+				Name:     "Recorder",
+				Metadata: `{"role":"recorder"}`,
+				Visible:  true,
+			},
+		},
+	}
+
+	req := &rpc.StartEgressRequest{
+		EgressId: "test_participant",
+		Request: &rpc.StartEgressRequest_TrackComposite{
+			TrackComposite: &livekit.TrackCompositeEgressRequest{
+				RoomName:     "room",
+				AudioTrackId: "audio",
+				Output: &livekit.TrackCompositeEgressRequest_File{
+					File: &livekit.EncodedFileOutput{
+						Filepath: "/tmp/test_participant.ogg",
+					},
+				},
+			},
+		},
+		WsUrl: "wss://egress.com",
+	}
+
+	p, err := GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+
+	v, err := auth.ParseAPIToken(p.Token)
+	require.NoError(t, err)
+	require.Equal(t, "recorder_room_test_participant", v.Identity())
+	claims, err := v.Verify("secret")
+	require.NoError(t, err)
+	require.Equal(t, "Recorder", claims.Name)
+	require.Equal(t, `{"role":"recorder"}`, claims.Metadata)
+	require.False(t, claims.Video.Hidden)
+	require.True(t, claims.Video.Recorder)
+}
+
+func TestFeatureFlags(t *testing.T) {
+	conf := &BaseConfig{
+		FeatureFlags: map[string]bool{"b": true, "a": true, "c": false},
+	}
+	require.True(t, conf.FeatureEnabled("a"))
+	require.False(t, conf.FeatureEnabled("c"))
+	require.False(t, conf.FeatureEnabled("d"))
+	require.Equal(t, []string{"a", "b"}, conf.EnabledFeatures())
+
+	require.Empty(t, (&BaseConfig{}).EnabledFeatures())
+}
+
+func TestAudioChannels(t *testing.T) {
+	require.Equal(t, "<<(float)0.5, (float)0.5>>", getMixMatrix(1, ChannelMappingMix))
+	require.Equal(t, "<<(float)1.0, (float)0.0>>", getMixMatrix(1, ChannelMappingLeft))
+	require.Equal(t, "<<(float)0.0, (float)1.0>, <(float)1.0, (float)0.0>>", getMixMatrix(2, ChannelMappingSwap))
+	require.Equal(t, "", getMixMatrix(2, ChannelMappingMix))
+
+	p := &PipelineConfig{
+		BaseConfig: BaseConfig{
+			AudioLayout: &AudioChannelsConfig{Channels: 1, Mapping: ChannelMappingMix, AudioOnly: true},
+		},
+		AudioConfig: AudioConfig{AudioTranscoding: true, AudioChannels: 2},
+		VideoConfig: VideoConfig{VideoEnabled: true},
+	}
+	p.updateAudioChannels()
+	require.Equal(t, int32(2), p.AudioChannels)
+	require.Equal(t, "", p.AudioMixMatrix)
+
+	p.VideoEnabled = false
+	p.updateAudioChannels()
+	require.Equal(t, int32(1), p.AudioChannels)
+	require.Equal(t, "<<(float)0.5, (float)0.5>>", p.AudioMixMatrix)
+}
+
+func TestSchema(t *testing.T) {
+	schema, err := GetSchema()
+	require.NoError(t, err)
+
+	fields := make(map[string]*SchemaField)
+	for _, f := range schema.Service {
+		fields[f.Name] = f
+	}
+
+	require.Equal(t, envAPIKey, fields["api_key"].Env)
+	require.Nil(t, fields["api_key"].Default)
+	require.Equal(t, "duration", fields["kill_grace_period"].Type)
+	require.Equal(t, defaultKillGracePeriod.String(), fields["kill_grace_period"].Default)
+	require.Equal(t, "2s", fields["preview.delay"].Default)
+	require.Equal(t, "string", fields["handler_binaries[].path"].Type)
+	require.Equal(t, "map<string,bool>", fields["feature_flags"].Type)
+
+	var pipeline []string
+	for _, f := range schema.Pipeline {
+		pipeline = append(pipeline, f.Name)
+	}
+	require.Equal(t, []string{"handler_id", "tmp_dir", "sync_group.id", "sync_group.epoch"}, pipeline)
+}
+
+func TestCBR(t *testing.T) {
+	p := &PipelineConfig{
+		BaseConfig: BaseConfig{CBR: &CBRConfig{VBVBuffer: time.Second, MuxOverhead: 0.1}},
+		Outputs: map[types.EgressType]OutputConfig{
+			types.EgressTypeSegments: &SegmentConfig{outputConfig: outputConfig{OutputType: types.OutputTypeHLS}},
+		},
+	}
+	p.AudioEnabled = true
+	p.AudioBitrate = 128
+	p.VideoEnabled = true
+	p.VideoBitrate = 3000
+	require.True(t, p.CBREncoding())
+
+	o := p.GetSegmentConfig()
+	require.Equal(t, uint64(3440800), p.TSMuxRate(o))
+	require.Equal(t, uint64(1240800), p.TSMuxRate(&SegmentConfig{
+		outputConfig: outputConfig{OutputType: types.OutputTypeHLS},
+		Rendition:    &HLSRenditionConfig{VideoBitrate: 1000},
+	}))
+
+	o.FMP4 = true
+	require.False(t, p.CBREncoding())
+	require.Zero(t, p.TSMuxRate(o))
+
+	p.CBR = nil
+	o.FMP4 = false
+	require.False(t, p.CBREncoding())
+	require.Zero(t, p.TSMuxRate(o))
+}
+
+func TestMuxers(t *testing.T) {
+	conf := &BaseConfig{
+		Muxers: map[string]MuxerConfig{
+			"mp4": {Element: "qtmux", Properties: map[string]string{"faststart": "true"}},
+			"ts":  {Properties: map[string]string{"alignment": "7"}},
+		},
+	}
+	require.NoError(t, conf.validateMuxers())
+
+	p := &PipelineConfig{BaseConfig: *conf}
+	element, properties := p.GetMuxer(types.OutputTypeMP4)
+	require.Equal(t, "qtmux", element)
+	require.Equal(t, "true", properties["faststart"])
+
+	element, properties = p.GetMuxer(types.OutputTypeTS)
+	require.Equal(t, "mpegtsmux", element)
+	require.Equal(t, "7", properties["alignment"])
+
+	element, properties = p.GetMuxer(types.OutputTypeWebM)
+	require.Equal(t, "webmmux", element)
+	require.Nil(t, properties)
+
+	conf.Muxers["mp4"] = MuxerConfig{Element: "webmmux"}
+	require.Error(t, conf.validateMuxers())
+
+	conf.Muxers = map[string]MuxerConfig{"mkv": {}}
+	require.Error(t, conf.validateMuxers())
+}
+
+func TestEndTriggers(t *testing.T) {
+	conf := &BaseConfig{
+		EndTriggers: map[string]string{
+			"web":   EndTriggerStopEgress,
+			"track": EndTriggerRoomClosed,
+		},
+	}
+	require.NoError(t, conf.validateEndTriggers())
+	require.Equal(t, EndTriggerStopEgress, conf.getEndTrigger("web"))
+	require.Equal(t, EndTriggerTemplate, conf.getEndTrigger("room_composite"))
+	require.Equal(t, EndTriggerRoomClosed, conf.getEndTrigger("track"))
+	require.Equal(t, EndTriggerParticipantLeft, conf.getEndTrigger("track_composite"))
+
+	conf.EndTriggers["room_composite"] = EndTriggerParticipantLeft
+	require.Error(t, conf.validateEndTriggers())
+
+	conf.EndTriggers = map[string]string{"sip": EndTriggerStopEgress}
+	require.Error(t, conf.validateEndTriggers())
+}
+
+func TestSegmentCount(t *testing.T) {
+	o := &SegmentConfig{SegmentsInfo: &livekit.SegmentsInfo{}}
+
+	// segments are counted by the sink while the limit monitor reads the count (run with -race)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			o.IncSegmentCount()
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		require.LessOrEqual(t, o.GetSegmentCount(), int64(1000))
+	}
+	wg.Wait()
+
+	require.Equal(t, int64(1000), o.GetSegmentCount())
+	require.Equal(t, int64(1000), o.SegmentsInfo.SegmentCount)
+}
+
+func TestChecksums(t *testing.T) {
+	conf := &ChecksumConfig{}
+	require.NoError(t, conf.validate())
+	require.Equal(t, []string{ChecksumSHA256}, conf.Algorithms)
+
+	conf.Algorithms = []string{ChecksumSHA256, ChecksumMD5}
+	require.NoError(t, conf.validate())
+
+	conf.Algorithms = []string{"crc32"}
+	require.Error(t, conf.validate())
+}
+
+func TestRTMPReconnect(t *testing.T) {
+	conf := &RTMPReconnectConfig{}
+	require.NoError(t, conf.validate())
+	require.Equal(t, defaultRTMPReconnectBuffer, conf.Buffer)
+
+	require.Equal(t, util.Backoff{
+		Backoff:    defaultRTMPReconnectBackoff,
+		MaxBackoff: defaultRTMPReconnectMaxBackoff,
+		Window:     defaultRTMPReconnectWindow,
+	}, conf.GetBackoff())
+
+	// max_backoff is at least the first backoff
+	conf = &RTMPReconnectConfig{Window: time.Second, Backoff: time.Second * 5}
+	require.NoError(t, conf.validate())
+	require.Equal(t, time.Second*5, conf.MaxBackoff)
+
+	conf = &RTMPReconnectConfig{MaxAttempts: 3}
+	require.NoError(t, conf.validate())
+	require.Equal(t, 3, conf.GetBackoff().MaxAttempts)
+
+	// the buffer is kept in memory while reconnecting
+	conf = &RTMPReconnectConfig{Buffer: maxRTMPReconnectBuffer}
+	require.NoError(t, conf.validate())
+	require.Error(t, (&RTMPReconnectConfig{Buffer: maxRTMPReconnectBuffer + time.Second}).validate())
+	require.Error(t, (&RTMPReconnectConfig{MaxAttempts: -1}).validate())
+}
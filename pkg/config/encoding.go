@@ -4,8 +4,35 @@ import (
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/rpc"
 )
 
+const (
+	maxWidth     = 3840
+	maxHeight    = 3840
+	maxPixels    = 3840 * 2160
+	maxFramerate = 60
+
+	// text content stays legible at lower framerates, leaving more bits for each frame
+	textMaxFramerate = 15
+
+	// pixel rate of the default 1080p30 encoding, used as the baseline for cpu cost
+	defaultPixelRate = 1920 * 1080 * 30
+
+	// outputs up to 1080p keep the default bitrate when it is not set
+	defaultPixels = 1920 * 1080
+)
+
+// default video bitrates (kbps) by resolution tier above 1080p, for 30fps and 60fps
+var videoBitrateTiers = []struct {
+	pixels    int32
+	bitrate30 int32
+	bitrate60 int32
+}{
+	{pixels: 2560 * 1440, bitrate30: 8000, bitrate60: 12000},
+	{pixels: 3840 * 2160, bitrate30: 16000, bitrate60: 24000},
+}
+
 func (p *PipelineConfig) applyPreset(preset livekit.EncodingOptionsPreset) {
 	switch preset {
 	case livekit.EncodingOptionsPreset_H264_720P_30:
@@ -78,19 +105,23 @@ func (p *PipelineConfig) applyAdvanced(advanced *livekit.EncodingOptions) error
 	}
 
 	if advanced.Width > 0 {
-		if advanced.Width < 16 || advanced.Width%2 == 1 {
+		if advanced.Width < 16 || advanced.Width > maxWidth || advanced.Width%2 == 1 {
 			return errors.ErrInvalidInput("width")
 		}
 		p.Width = advanced.Width
 	}
 
 	if advanced.Height > 0 {
-		if advanced.Height < 16 || advanced.Height%2 == 1 {
+		if advanced.Height < 16 || advanced.Height > maxHeight || advanced.Height%2 == 1 {
 			return errors.ErrInvalidInput("height")
 		}
 		p.Height = advanced.Height
 	}
 
+	if p.Width*p.Height > maxPixels {
+		return errors.ErrInvalidInput("width and height")
+	}
+
 	switch advanced.Depth {
 	case 0:
 	case 8, 16, 24:
@@ -100,14 +131,103 @@ func (p *PipelineConfig) applyAdvanced(advanced *livekit.EncodingOptions) error
 	}
 
 	if advanced.Framerate != 0 {
+		if advanced.Framerate < 0 || advanced.Framerate > maxFramerate {
+			return errors.ErrInvalidInput("framerate")
+		}
 		p.Framerate = advanced.Framerate
 	}
 	if advanced.VideoBitrate != 0 {
 		p.VideoBitrate = advanced.VideoBitrate
+	} else if p.Width*p.Height > defaultPixels {
+		p.VideoBitrate = getDefaultVideoBitrate(p.Width, p.Height, p.Framerate)
 	}
+
 	if advanced.KeyFrameInterval != 0 {
+		// the encoders take the interval in frames, which must be at least one at the output framerate
+		if advanced.KeyFrameInterval < 0 || advanced.KeyFrameInterval*float64(p.Framerate) < 1 {
+			return errors.ErrInvalidInput("key_frame_interval")
+		}
 		p.KeyFrameInterval = advanced.KeyFrameInterval
 	}
 
 	return nil
 }
+
+func (p *PipelineConfig) applyContentHint() {
+	if p.ContentHint == types.ContentHintText && p.Framerate > textMaxFramerate {
+		p.Framerate = textMaxFramerate
+	}
+}
+
+// getDefaultVideoBitrate picks a bitrate for the smallest resolution tier above 1080p that fits the output
+func getDefaultVideoBitrate(width, height, framerate int32) int32 {
+	pixels := width * height
+	tier := videoBitrateTiers[len(videoBitrateTiers)-1]
+	for _, t := range videoBitrateTiers {
+		if pixels <= t.pixels {
+			tier = t
+			break
+		}
+	}
+
+	if framerate > 30 {
+		return tier.bitrate60
+	}
+	return tier.bitrate30
+}
+
+// GetEncodingCostFactor estimates the encoding cost of a request relative to the default 1080p30 encoding.
+// Requests which do not exceed 1080p30 have a factor of 1.
+func GetEncodingCostFactor(req *rpc.StartEgressRequest) float64 {
+	p := &PipelineConfig{
+		VideoConfig: VideoConfig{
+			Width:     1920,
+			Height:    1080,
+			Framerate: 30,
+		},
+	}
+
+	switch r := req.Request.(type) {
+	case *rpc.StartEgressRequest_RoomComposite:
+		if r.RoomComposite.AudioOnly {
+			return 1
+		}
+		switch opts := r.RoomComposite.Options.(type) {
+		case *livekit.RoomCompositeEgressRequest_Preset:
+			p.applyPreset(opts.Preset)
+		case *livekit.RoomCompositeEgressRequest_Advanced:
+			_ = p.applyAdvanced(opts.Advanced)
+		}
+
+	case *rpc.StartEgressRequest_Web:
+		if r.Web.AudioOnly {
+			return 1
+		}
+		switch opts := r.Web.Options.(type) {
+		case *livekit.WebEgressRequest_Preset:
+			p.applyPreset(opts.Preset)
+		case *livekit.WebEgressRequest_Advanced:
+			_ = p.applyAdvanced(opts.Advanced)
+		}
+
+	case *rpc.StartEgressRequest_TrackComposite:
+		if r.TrackComposite.VideoTrackId == "" {
+			return 1
+		}
+		switch opts := r.TrackComposite.Options.(type) {
+		case *livekit.TrackCompositeEgressRequest_Preset:
+			p.applyPreset(opts.Preset)
+		case *livekit.TrackCompositeEgressRequest_Advanced:
+			_ = p.applyAdvanced(opts.Advanced)
+		}
+
+	default:
+		return 1
+	}
+
+	factor := float64(p.Width) * float64(p.Height) * float64(p.Framerate) / defaultPixelRate
+	if factor < 1 {
+		return 1
+	}
+	return factor
+}
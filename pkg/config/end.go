@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+)
+
+const (
+	EndTriggerTemplate        = "template"         // the room composite or web template logs END_RECORDING
+	EndTriggerRoomClosed      = "room_closed"      // the room is closed, or can't be rejoined
+	EndTriggerParticipantLeft = "participant_left" // every recorded track is unpublished, or the room is closed
+	EndTriggerStopEgress      = "stop_egress"      // only StopEgress, or a limit
+
+	// other reasons an egress can end, recorded like the triggers
+	EndedByLimitReached = "limit_reached"
+	EndedByTrim         = "trim"
+	EndedByShutdown     = "shutdown"
+)
+
+// endTriggers lists the triggers each request type supports, starting with its default
+var endTriggers = map[string][]string{
+	"room_composite":  {EndTriggerTemplate, EndTriggerStopEgress},
+	"web":             {EndTriggerTemplate, EndTriggerStopEgress},
+	"track_composite": {EndTriggerParticipantLeft, EndTriggerRoomClosed, EndTriggerStopEgress},
+	"track":           {EndTriggerParticipantLeft, EndTriggerRoomClosed, EndTriggerStopEgress},
+}
+
+func (c *BaseConfig) validateEndTriggers() error {
+	for requestType, trigger := range c.EndTriggers {
+		supported, ok := endTriggers[requestType]
+		if !ok {
+			return fmt.Errorf("invalid end_triggers request type %s", requestType)
+		}
+
+		valid := false
+		for _, t := range supported {
+			if t == trigger {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid %s end trigger %s, must be one of %v", requestType, trigger, supported)
+		}
+	}
+
+	return nil
+}
+
+// getEndTrigger returns the configured end trigger of a request type, or its default
+func (c *BaseConfig) getEndTrigger(requestType string) string {
+	if trigger, ok := c.EndTriggers[requestType]; ok {
+		return trigger
+	}
+	return endTriggers[requestType][0]
+}
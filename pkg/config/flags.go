@@ -0,0 +1,20 @@
+package config
+
+import "sort"
+
+// FeatureEnabled returns true if an experimental behavior is enabled on this node
+func (c *BaseConfig) FeatureEnabled(flag string) bool {
+	return c.FeatureFlags[flag]
+}
+
+// EnabledFeatures returns the names of all enabled flags, sorted
+func (c *BaseConfig) EnabledFeatures() []string {
+	enabled := make([]string, 0, len(c.FeatureFlags))
+	for flag, on := range c.FeatureFlags {
+		if on {
+			enabled = append(enabled, flag)
+		}
+	}
+	sort.Strings(enabled)
+	return enabled
+}
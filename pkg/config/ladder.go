@@ -0,0 +1,285 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/rpc"
+)
+
+const (
+	LadderRequestRoomComposite  = "room_composite"
+	LadderRequestWeb            = "web"
+	LadderRequestTrackComposite = "track_composite"
+
+	LadderOutputMP4  = "mp4"
+	LadderOutputOGG  = "ogg"
+	LadderOutputHLS  = "hls"
+	LadderOutputRTMP = "rtmp"
+)
+
+// LadderRequest describes an egress, so that the encodings it would use can be shown before it is started
+type LadderRequest struct {
+	RequestType string   `json:"request_type"` // room_composite (default), web or track_composite
+	AudioOnly   bool     `json:"audio_only"`
+	Outputs     []string `json:"outputs"` // mp4, ogg, hls or rtmp, at most one of each kind
+
+	// encoding options, either a preset name such as H264_720P_30 or advanced options
+	Preset           string  `json:"preset,omitempty"`
+	Width            int32   `json:"width,omitempty"`
+	Height           int32   `json:"height,omitempty"`
+	Framerate        int32   `json:"framerate,omitempty"`
+	VideoBitrate     int32   `json:"video_bitrate,omitempty"` // kbps
+	AudioBitrate     int32   `json:"audio_bitrate,omitempty"` // kbps
+	KeyFrameInterval float64 `json:"key_frame_interval,omitempty"`
+
+	// the published video for track composite, or the page size for web, used to warn about upscaling
+	SourceWidth     int32 `json:"source_width,omitempty"`
+	SourceHeight    int32 `json:"source_height,omitempty"`
+	SourceFramerate int32 `json:"source_framerate,omitempty"`
+}
+
+// Ladder lists each encoding the egress would run, with the outputs it feeds
+type Ladder struct {
+	Rungs    []*LadderRung `json:"rungs"`
+	Warnings []string      `json:"warnings,omitempty"`
+}
+
+type LadderRung struct {
+	Name             string   `json:"name"` // main, proxy, or the name of an hls rendition
+	Outputs          []string `json:"outputs"`
+	VideoCodec       string   `json:"video_codec,omitempty"`
+	Width            int32    `json:"width,omitempty"`
+	Height           int32    `json:"height,omitempty"`
+	Framerate        int32    `json:"framerate,omitempty"`
+	VideoBitrate     int32    `json:"video_bitrate,omitempty"` // kbps
+	KeyFrameInterval float64  `json:"key_frame_interval,omitempty"`
+	AudioCodec       string   `json:"audio_codec,omitempty"`
+	AudioBitrate     int32    `json:"audio_bitrate,omitempty"` // kbps
+	AudioFrequency   int32    `json:"audio_frequency,omitempty"`
+	SegmentDuration  int      `json:"segment_duration,omitempty"` // seconds, hls only
+}
+
+// SuggestLadder validates a request built from the ladder request with this node's config, the same way a
+// started egress would be, and returns the resulting encodings
+func SuggestLadder(conf *ServiceConfig, req *LadderRequest) (*Ladder, error) {
+	start, err := req.toStartEgressRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	// outputs are written locally without storage, so that nothing is created while validating
+	base := conf.BaseConfig
+	base.S3 = nil
+	base.GCP = nil
+	base.Azure = nil
+	base.AliOSS = nil
+	base.Local = nil
+	base.GoogleDrive = nil
+	base.Dropbox = nil
+	base.HTTP = nil
+
+	p, err := GetValidatedPipelineConfig(&ServiceConfig{BaseConfig: base}, start)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.getLadder(req), nil
+}
+
+func (r *LadderRequest) toStartEgressRequest() (*rpc.StartEgressRequest, error) {
+	var options *livekit.EncodingOptions
+	advanced := r.Width != 0 || r.Height != 0 || r.Framerate != 0 || r.VideoBitrate != 0 || r.AudioBitrate != 0 || r.KeyFrameInterval != 0
+	if advanced {
+		if r.Preset != "" {
+			return nil, errors.ErrInvalidInput("preset and advanced options")
+		}
+		options = &livekit.EncodingOptions{
+			Width:            r.Width,
+			Height:           r.Height,
+			Framerate:        r.Framerate,
+			VideoBitrate:     r.VideoBitrate,
+			AudioBitrate:     r.AudioBitrate,
+			KeyFrameInterval: r.KeyFrameInterval,
+		}
+	}
+	var preset livekit.EncodingOptionsPreset
+	if r.Preset != "" {
+		value, ok := livekit.EncodingOptionsPreset_value[strings.ToUpper(r.Preset)]
+		if !ok {
+			return nil, errors.ErrInvalidInput("preset")
+		}
+		preset = livekit.EncodingOptionsPreset(value)
+	}
+
+	var files []*livekit.EncodedFileOutput
+	var streams []*livekit.StreamOutput
+	var segments []*livekit.SegmentedFileOutput
+	for _, o := range r.Outputs {
+		switch strings.ToLower(o) {
+		case LadderOutputMP4:
+			files = append(files, &livekit.EncodedFileOutput{FileType: livekit.EncodedFileType_MP4, Filepath: "ladder.mp4"})
+		case LadderOutputOGG:
+			files = append(files, &livekit.EncodedFileOutput{FileType: livekit.EncodedFileType_OGG, Filepath: "ladder.ogg"})
+		case LadderOutputHLS:
+			segments = append(segments, &livekit.SegmentedFileOutput{FilenamePrefix: "ladder", PlaylistName: "ladder.m3u8"})
+		case LadderOutputRTMP:
+			streams = append(streams, &livekit.StreamOutput{Protocol: livekit.StreamProtocol_RTMP, Urls: []string{"rtmp://ladder/live/key"}})
+		default:
+			return nil, errors.ErrInvalidInput(fmt.Sprintf("output %s", o))
+		}
+	}
+	if len(files)+len(streams)+len(segments) == 0 {
+		return nil, errors.ErrInvalidInput("outputs")
+	}
+
+	req := &rpc.StartEgressRequest{
+		EgressId: "EG_ladder",
+		Token:    "ladder",
+		WsUrl:    "wss://ladder",
+	}
+	switch r.RequestType {
+	case "", LadderRequestRoomComposite:
+		rc := &livekit.RoomCompositeEgressRequest{
+			RoomName:       "ladder",
+			AudioOnly:      r.AudioOnly,
+			FileOutputs:    files,
+			StreamOutputs:  streams,
+			SegmentOutputs: segments,
+		}
+		if options != nil {
+			rc.Options = &livekit.RoomCompositeEgressRequest_Advanced{Advanced: options}
+		} else if r.Preset != "" {
+			rc.Options = &livekit.RoomCompositeEgressRequest_Preset{Preset: preset}
+		}
+		req.Request = &rpc.StartEgressRequest_RoomComposite{RoomComposite: rc}
+
+	case LadderRequestWeb:
+		web := &livekit.WebEgressRequest{
+			Url:            "https://ladder",
+			AudioOnly:      r.AudioOnly,
+			FileOutputs:    files,
+			StreamOutputs:  streams,
+			SegmentOutputs: segments,
+		}
+		if options != nil {
+			web.Options = &livekit.WebEgressRequest_Advanced{Advanced: options}
+		} else if r.Preset != "" {
+			web.Options = &livekit.WebEgressRequest_Preset{Preset: preset}
+		}
+		req.Request = &rpc.StartEgressRequest_Web{Web: web}
+
+	case LadderRequestTrackComposite:
+		tc := &livekit.TrackCompositeEgressRequest{
+			RoomName:       "ladder",
+			AudioTrackId:   "TR_ladder_audio",
+			FileOutputs:    files,
+			StreamOutputs:  streams,
+			SegmentOutputs: segments,
+		}
+		if !r.AudioOnly {
+			tc.VideoTrackId = "TR_ladder_video"
+		}
+		if options != nil {
+			tc.Options = &livekit.TrackCompositeEgressRequest_Advanced{Advanced: options}
+		} else if r.Preset != "" {
+			tc.Options = &livekit.TrackCompositeEgressRequest_Preset{Preset: preset}
+		}
+		req.Request = &rpc.StartEgressRequest_TrackComposite{TrackComposite: tc}
+
+	default:
+		return nil, errors.ErrInvalidInput("request_type")
+	}
+
+	return req, nil
+}
+
+func (p *PipelineConfig) getLadder(req *LadderRequest) *Ladder {
+	ladder := &Ladder{}
+
+	main := &LadderRung{Name: "main"}
+	for egressType, o := range p.Outputs {
+		if egressType != types.EgressTypeProxyFile {
+			main.Outputs = append(main.Outputs, string(o.GetOutputType()))
+		}
+	}
+	sort.Strings(main.Outputs)
+	if p.VideoEnabled {
+		main.VideoCodec = string(p.VideoOutCodec)
+		main.Width = p.Width
+		main.Height = p.Height
+		main.Framerate = p.Framerate
+		main.VideoBitrate = p.VideoBitrate
+		main.KeyFrameInterval = p.KeyFrameInterval
+	}
+	if p.AudioEnabled {
+		main.AudioCodec = string(p.AudioOutCodec)
+		main.AudioBitrate = p.AudioBitrate
+		main.AudioFrequency = p.AudioFrequency
+	}
+	segments := p.GetSegmentConfig()
+	if segments != nil {
+		main.SegmentDuration = segments.SegmentDuration
+	}
+	ladder.Rungs = append(ladder.Rungs, main)
+
+	if o := p.GetProxyFileConfig(); o != nil && p.ProxyFile != nil {
+		width, height := p.ProxyResolution()
+		ladder.Rungs = append(ladder.Rungs, &LadderRung{
+			Name:             "proxy",
+			Outputs:          []string{string(o.OutputType)},
+			VideoCodec:       string(types.MimeTypeH264),
+			Width:            width,
+			Height:           height,
+			Framerate:        p.Framerate,
+			VideoBitrate:     p.ProxyFile.VideoBitrate,
+			KeyFrameInterval: p.KeyFrameInterval,
+			AudioCodec:       main.AudioCodec,
+			AudioBitrate:     main.AudioBitrate,
+			AudioFrequency:   main.AudioFrequency,
+		})
+	}
+
+	if segments != nil {
+		for _, r := range segments.Renditions {
+			width, height := r.Rendition.Resolution(p)
+			ladder.Rungs = append(ladder.Rungs, &LadderRung{
+				Name:             r.Rendition.Name,
+				Outputs:          []string{string(r.OutputType)},
+				VideoCodec:       string(p.VideoOutCodec),
+				Width:            width,
+				Height:           height,
+				Framerate:        p.Framerate,
+				VideoBitrate:     r.Rendition.VideoBitrate,
+				KeyFrameInterval: p.KeyFrameInterval,
+				AudioCodec:       main.AudioCodec,
+				AudioBitrate:     main.AudioBitrate,
+				AudioFrequency:   main.AudioFrequency,
+				SegmentDuration:  r.SegmentDuration,
+			})
+		}
+	}
+
+	if p.VideoEnabled && req.SourceWidth > 0 && req.SourceHeight > 0 {
+		for _, r := range ladder.Rungs {
+			if r.Width*r.Height > req.SourceWidth*req.SourceHeight {
+				ladder.Warnings = append(ladder.Warnings, fmt.Sprintf(
+					"%s is %dx%d, larger than the %dx%d source, so its video is upscaled",
+					r.Name, r.Width, r.Height, req.SourceWidth, req.SourceHeight,
+				))
+			}
+		}
+	}
+	if p.VideoEnabled && req.SourceFramerate > 0 && p.Framerate > req.SourceFramerate {
+		ladder.Warnings = append(ladder.Warnings, fmt.Sprintf(
+			"output framerate %d is higher than the source framerate %d, so frames are repeated",
+			p.Framerate, req.SourceFramerate,
+		))
+	}
+
+	return ladder
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"time"
+)
+
+type SessionLimits struct {
+	FileOutputMaxDuration    time.Duration `yaml:"file_output_max_duration"`
+	StreamOutputMaxDuration  time.Duration `yaml:"stream_output_max_duration"`
+	SegmentOutputMaxDuration time.Duration `yaml:"segment_output_max_duration"`
+	FileOutputMaxSize        int64         `yaml:"file_output_max_size"`     // MB
+	SegmentOutputMaxCount    int64         `yaml:"segment_output_max_count"` // number of segments written
+
+	// overrides for room_composite, web, track_composite, or track requests
+	RequestTypeLimits map[string]SessionLimits `yaml:"request_types"`
+}
+
+// forRequestType returns the limits with any request type overrides applied
+func (l SessionLimits) forRequestType(requestType string) SessionLimits {
+	o, ok := l.RequestTypeLimits[requestType]
+	if !ok {
+		return l
+	}
+
+	if o.FileOutputMaxDuration != 0 {
+		l.FileOutputMaxDuration = o.FileOutputMaxDuration
+	}
+	if o.StreamOutputMaxDuration != 0 {
+		l.StreamOutputMaxDuration = o.StreamOutputMaxDuration
+	}
+	if o.SegmentOutputMaxDuration != 0 {
+		l.SegmentOutputMaxDuration = o.SegmentOutputMaxDuration
+	}
+	if o.FileOutputMaxSize != 0 {
+		l.FileOutputMaxSize = o.FileOutputMaxSize
+	}
+	if o.SegmentOutputMaxCount != 0 {
+		l.SegmentOutputMaxCount = o.SegmentOutputMaxCount
+	}
+
+	return l
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/livekit/egress/pkg/types"
+)
+
+// MuxerConfig overrides the muxer used for an output format
+type MuxerConfig struct {
+	Element    string            `yaml:"element"`    // must be one of the supported muxers for the format
+	Properties map[string]string `yaml:"properties"` // gstreamer property overrides, e.g. faststart: true
+}
+
+var (
+	muxerFormats = map[string]types.OutputType{
+		"mp4":  types.OutputTypeMP4,
+		"ts":   types.OutputTypeTS,
+		"webm": types.OutputTypeWebM,
+		"ogg":  types.OutputTypeOGG,
+		"mp3":  types.OutputTypeMP3,
+		"wav":  types.OutputTypeWAV,
+		"ivf":  types.OutputTypeIVF,
+	}
+
+	// the first element is the default
+	muxerElements = map[types.OutputType][]string{
+		types.OutputTypeMP4:  {"mp4mux", "qtmux"},
+		types.OutputTypeTS:   {"mpegtsmux"},
+		types.OutputTypeWebM: {"webmmux"},
+		types.OutputTypeOGG:  {"oggmux"},
+		types.OutputTypeMP3:  {"xingmux", "id3v2mux"},
+		types.OutputTypeWAV:  {"wavenc"},
+		types.OutputTypeIVF:  {"avmux_ivf"},
+	}
+)
+
+func (c *BaseConfig) validateMuxers() error {
+	for format, muxer := range c.Muxers {
+		outputType, ok := muxerFormats[format]
+		if !ok {
+			return fmt.Errorf("invalid muxer format %s", format)
+		}
+		if muxer.Element == "" {
+			continue
+		}
+
+		valid := false
+		for _, element := range muxerElements[outputType] {
+			if element == muxer.Element {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid %s muxer %s, must be one of %v", format, muxer.Element, muxerElements[outputType])
+		}
+	}
+
+	return nil
+}
+
+// GetMuxer returns the muxer element and property overrides for an output type
+func (p *PipelineConfig) GetMuxer(outputType types.OutputType) (string, map[string]string) {
+	element := muxerElements[outputType][0]
+	for format, muxer := range p.Muxers {
+		if muxerFormats[format] != outputType {
+			continue
+		}
+		if muxer.Element != "" {
+			element = muxer.Element
+		}
+		return element, muxer.Properties
+	}
+
+	return element, nil
+}
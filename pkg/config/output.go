@@ -182,19 +182,37 @@ func (p *PipelineConfig) getUploadConfig(upload uploader) interface{} {
 		return azure
 	}
 	if ali := upload.GetAliOSS(); ali != nil {
+		ali.Endpoint = aliOSSEndpoint(ali.Endpoint, ali.Region)
 		return ali
 	}
-	if p.S3 != nil {
-		return p.S3.ToS3Upload()
+	return p.GetDefaultUploadConfig()
+}
+
+// GetDefaultUploadConfig returns the storage configured for this node, if any
+func (c *BaseConfig) GetDefaultUploadConfig() interface{} {
+	if c.S3 != nil {
+		return c.S3.ToS3Upload()
+	}
+	if c.GCP != nil {
+		return c.GCP.ToGCPUpload()
+	}
+	if c.Azure != nil {
+		return c.Azure.ToAzureUpload()
+	}
+	if c.AliOSS != nil {
+		return c.AliOSS.ToAliOSSUpload()
+	}
+	if c.Local != nil {
+		return c.Local
 	}
-	if p.GCP != nil {
-		return p.GCP.ToGCPUpload()
+	if c.GoogleDrive != nil {
+		return c.GoogleDrive
 	}
-	if p.Azure != nil {
-		return p.Azure.ToAzureUpload()
+	if c.Dropbox != nil {
+		return c.Dropbox
 	}
-	if p.AliOSS != nil {
-		return p.AliOSS.ToAliOSSUpload()
+	if c.HTTP != nil {
+		return c.HTTP
 	}
 	return nil
 }
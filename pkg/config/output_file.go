@@ -5,8 +5,8 @@ import (
 	"os"
 	"path"
 	"strings"
-	"time"
 
+	"github.com/livekit/egress/pkg/clock"
 	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
 )
@@ -20,6 +20,7 @@ type FileConfig struct {
 
 	DisableManifest bool
 	UploadConfig    interface{}
+	Checksums       *Checksums // of the uploaded file, set with checksums
 }
 
 func (p *PipelineConfig) GetFileConfig() *FileConfig {
@@ -30,6 +31,19 @@ func (p *PipelineConfig) GetFileConfig() *FileConfig {
 	return o.(*FileConfig)
 }
 
+// FaststartFilepath is where mp4 media is buffered until the moov atom can be written
+func (o *FileConfig) FaststartFilepath() string {
+	return fmt.Sprintf("%s.mdat", o.LocalFilepath)
+}
+
+func (p *PipelineConfig) GetProxyFileConfig() *FileConfig {
+	o, ok := p.Outputs[types.EgressTypeProxyFile]
+	if !ok {
+		return nil
+	}
+	return o.(*FileConfig)
+}
+
 func (p *PipelineConfig) getEncodedFileConfig(file *livekit.EncodedFileOutput) (*FileConfig, error) {
 	var outputType types.OutputType
 
@@ -56,6 +70,18 @@ type fileOutput interface {
 }
 
 func (p *PipelineConfig) getFileConfig(outputType types.OutputType, file fileOutput) (*FileConfig, error) {
+	// there are no mp3, wav or raw pcm file types, so they are selected by extension
+	if outputType == types.OutputTypeUnknownFile {
+		switch {
+		case strings.HasSuffix(file.GetFilepath(), types.FileExtensionMP3):
+			outputType = types.OutputTypeMP3
+		case strings.HasSuffix(file.GetFilepath(), types.FileExtensionWAV):
+			outputType = types.OutputTypeWAV
+		case strings.HasSuffix(file.GetFilepath(), types.FileExtensionRaw):
+			outputType = types.OutputTypeRaw
+		}
+	}
+
 	conf := &FileConfig{
 		outputConfig:    outputConfig{OutputType: outputType},
 		FileInfo:        &livekit.FileInfo{},
@@ -79,7 +105,7 @@ func (p *PipelineConfig) getFileConfig(outputType types.OutputType, file fileOut
 }
 
 func (p *PipelineConfig) getFilenameInfo() (string, map[string]string) {
-	now := time.Now()
+	now := clock.Now()
 	utc := fmt.Sprintf("%s%03d", now.Format("20060102150405"), now.UnixMilli()%1000)
 	if p.Info.RoomName != "" {
 		return p.Info.RoomName, map[string]string{
@@ -104,7 +130,7 @@ func (o *FileConfig) updateFilepath(p *PipelineConfig, identifier string, replac
 
 	if o.StorageFilepath == "" || strings.HasSuffix(o.StorageFilepath, "/") {
 		// generate filepath
-		o.StorageFilepath = fmt.Sprintf("%s%s-%s%s", o.StorageFilepath, identifier, time.Now().Format("2006-01-02T150405"), ext)
+		o.StorageFilepath = fmt.Sprintf("%s%s-%s%s", o.StorageFilepath, identifier, clock.Now().Format("2006-01-02T150405"), ext)
 	} else if !strings.HasSuffix(o.StorageFilepath, string(ext)) {
 		// check for existing (incorrect) extension
 		if extIdx := strings.LastIndex(o.StorageFilepath, "."); extIdx > -1 {
@@ -148,6 +174,67 @@ func (o *FileConfig) updateFilepath(p *PipelineConfig, identifier string, replac
 	return nil
 }
 
+// the proxy file is a low bitrate copy of the file output, written next to it
+func (p *PipelineConfig) updateProxyFileOutput() {
+	o := p.GetFileConfig()
+	if p.ProxyFile == nil || o == nil || !p.VideoEnabled || !p.VideoTranscoding {
+		return
+	}
+
+	// the proxy is always encoded with h264, so outputs which can't hold it get an mp4 proxy
+	outputType := o.OutputType
+	if !types.CodecCompatibility[outputType][types.MimeTypeH264] {
+		outputType = types.OutputTypeMP4
+	}
+
+	conf := p.GetProxyFileConfig()
+	if conf == nil {
+		conf = &FileConfig{
+			outputConfig:    outputConfig{OutputType: outputType},
+			FileInfo:        &livekit.FileInfo{},
+			DisableManifest: true,
+			UploadConfig:    o.UploadConfig,
+		}
+
+		p.Outputs[types.EgressTypeProxyFile] = conf
+		p.OutputCount++
+		p.Info.FileResults = append(p.Info.FileResults, conf.FileInfo)
+	}
+
+	ext := types.FileExtensionForOutputType[conf.OutputType]
+	conf.StorageFilepath = proxyFilepath(o.StorageFilepath, p.ProxyFile.Suffix, ext)
+	conf.LocalFilepath = proxyFilepath(o.LocalFilepath, p.ProxyFile.Suffix, ext)
+	conf.FileInfo.Filename = conf.StorageFilepath
+}
+
+func proxyFilepath(filepath, suffix string, ext types.FileExtension) string {
+	return fmt.Sprintf("%s%s%s", strings.TrimSuffix(filepath, path.Ext(filepath)), suffix, ext)
+}
+
+// ProxyResolution returns the size of the proxy, within the configured size and with the aspect ratio of the output
+func (p *PipelineConfig) ProxyResolution() (int32, int32) {
+	width, height := p.Orient(p.ProxyFile.Width, p.ProxyFile.Height)
+	if p.Width <= 0 || p.Height <= 0 {
+		return width, height
+	}
+
+	if int64(width)*int64(p.Height) > int64(height)*int64(p.Width) {
+		width = int32(int64(height) * int64(p.Width) / int64(p.Height))
+	} else {
+		height = int32(int64(width) * int64(p.Height) / int64(p.Width))
+	}
+
+	// encoders need even sizes
+	width, height = width&^1, height&^1
+	if width < 2 {
+		width = 2
+	}
+	if height < 2 {
+		height = 2
+	}
+	return width, height
+}
+
 func clean(filepath string) string {
 	hasEndingSlash := strings.HasSuffix(filepath, "/")
 	filepath = path.Clean(filepath)
@@ -2,11 +2,15 @@ package config
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"path"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/livekit/egress/pkg/clock"
+	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
 )
@@ -21,9 +25,52 @@ type SegmentConfig struct {
 	SegmentPrefix    string
 	SegmentSuffix    livekit.SegmentedFileSuffix
 	SegmentDuration  int
+	FMP4             bool                 // fragmented mp4 (CMAF) hls segments, instead of mpeg ts
+	PartitionLayout  string               // time layout of the storage prefix for each segment, if partitioned
+	HLSEncryption    *HLSEncryptionConfig // aes-128 encrypted hls segments
+
+	// multi-rendition hls only
+	MasterPlaylistFilename string
+	Renditions             []*SegmentConfig    // lower resolution copies, with their own playlists
+	Rendition              *HLSRenditionConfig // set for each of the renditions
+	AudioRenditions        []*SegmentConfig    // audio only alternate audio tracks, with their own playlists
+	AudioRendition         *AlternateAudio     // set for each of the audio renditions
+
+	// low latency hls only
+	PartDuration    time.Duration
+	PartsPerSegment int
+
+	// chunked cmaf only. Segments are written in fragments of this duration, and streamed to http storage as they are written
+	ChunkDuration time.Duration
 
 	DisableManifest bool
 	UploadConfig    interface{}
+
+	Segments []*SegmentEntry // one for each completed segment, in order
+
+	segmentCount int64 // SegmentsInfo.SegmentCount, which can also be read while segments are written
+}
+
+const (
+	SegmentPartitionDay  = "day"
+	SegmentPartitionHour = "hour"
+)
+
+const (
+	SegmentUploaded     = "uploaded"
+	SegmentBackedUp     = "backup" // moved to backup storage after a failed upload
+	SegmentUploadFailed = "failed"
+)
+
+// SegmentEntry describes a single segment, which livekit.SegmentsInfo has no room for
+type SegmentEntry struct {
+	Filename     string    `json:"filename"`
+	Duration     float64   `json:"duration"`   // seconds
+	Size         int64     `json:"size"`       // bytes
+	StartPTS     int64     `json:"start_pts"`  // running time of the first buffer, in ns
+	StartTime    time.Time `json:"start_time"` // wall clock time of the first buffer
+	UploadStatus string    `json:"upload_status"`
+	Checksums
 }
 
 func (p *PipelineConfig) GetSegmentConfig() *SegmentConfig {
@@ -34,6 +81,18 @@ func (p *PipelineConfig) GetSegmentConfig() *SegmentConfig {
 	return o.(*SegmentConfig)
 }
 
+// IncSegmentCount counts a completed segment, and returns the new count
+func (o *SegmentConfig) IncSegmentCount() int64 {
+	count := atomic.AddInt64(&o.segmentCount, 1)
+	o.SegmentsInfo.SegmentCount = count
+	return count
+}
+
+// GetSegmentCount can be called from any goroutine
+func (o *SegmentConfig) GetSegmentCount() int64 {
+	return atomic.LoadInt64(&o.segmentCount)
+}
+
 // segments should always be added last, so we can check keyframe interval from file/stream
 func (p *PipelineConfig) getSegmentConfig(segments *livekit.SegmentedFileOutput) (*SegmentConfig, error) {
 	conf := &SegmentConfig{
@@ -68,6 +127,46 @@ func (p *PipelineConfig) getSegmentConfig(segments *livekit.SegmentedFileOutput)
 		conf.OutputType = types.OutputTypeHLS
 	}
 
+	// a json playlist selects webm segments for media source extensions
+	if strings.HasSuffix(segments.PlaylistName, types.FileExtensionJSON) {
+		conf.OutputType = types.OutputTypeMSE
+	}
+
+	// the pinned protocol's SegmentedFileOutput has no segment format, so fmp4 can only be selected for the node
+	if conf.OutputType == types.OutputTypeHLS && p.HLSSegmentFormat == "fmp4" {
+		conf.FMP4 = true
+		if h, ok := conf.UploadConfig.(*HTTPUploadConfig); ok && p.CMAFChunked != nil && h.Method != http.MethodPost {
+			// a multipart form can't be sent in chunks
+			conf.ChunkDuration = p.CMAFChunked.ChunkDuration
+		}
+	}
+
+	// partitions are relative to the playlist, so they are only used when uploading
+	if conf.UploadConfig != nil {
+		switch p.SegmentPartitions {
+		case SegmentPartitionDay:
+			conf.PartitionLayout = "2006/01/02"
+		case SegmentPartitionHour:
+			conf.PartitionLayout = "2006/01/02/15"
+		}
+	}
+
+	if conf.OutputType == types.OutputTypeHLS && p.HLSEncryption != nil {
+		conf.HLSEncryption = p.HLSEncryption
+	}
+
+	if conf.OutputType == types.OutputTypeHLS && p.LowLatencyHLS != nil {
+		segmentDuration := time.Duration(conf.SegmentDuration) * time.Second
+		conf.PartDuration = p.LowLatencyHLS.PartDuration
+		if conf.PartDuration > segmentDuration {
+			conf.PartDuration = segmentDuration
+		}
+		conf.PartsPerSegment = int(segmentDuration / conf.PartDuration)
+
+		// every part starts with a key frame, so that players can start from any part
+		p.KeyFrameInterval = conf.PartDuration.Seconds()
+	}
+
 	// filename
 	err := conf.updatePrefixAndPlaylist(p)
 	if err != nil {
@@ -77,6 +176,93 @@ func (p *PipelineConfig) getSegmentConfig(segments *livekit.SegmentedFileOutput)
 	return conf, nil
 }
 
+// AddSegmentOutput adds an hls output to a running egress. The encoders are already running,
+// so its codecs and key frame interval can't be changed.
+func (p *PipelineConfig) AddSegmentOutput(segments *livekit.SegmentedFileOutput) (*SegmentConfig, error) {
+	if p.GetSegmentConfig() != nil {
+		return nil, errors.ErrInvalidInput("multiple segmented file outputs")
+	}
+	if p.VideoEnabled && p.VideoOutCodec != types.MimeTypeH264 {
+		return nil, errors.ErrIncompatible(types.OutputTypeHLS, p.VideoOutCodec)
+	}
+	if p.AudioEnabled && p.AudioOutCodec != types.MimeTypeAAC {
+		return nil, errors.ErrIncompatible(types.OutputTypeHLS, p.AudioOutCodec)
+	}
+
+	keyFrameInterval := p.KeyFrameInterval
+	conf, err := p.getSegmentConfig(segments)
+	p.KeyFrameInterval = keyFrameInterval
+	if err != nil {
+		return nil, err
+	}
+	if conf.OutputType != types.OutputTypeHLS {
+		return nil, errors.ErrNotSupported("adding mse segment outputs")
+	}
+	if conf.PartDuration > 0 {
+		// parts need a key frame interval matching the part duration
+		return nil, errors.ErrNotSupported("adding low latency hls outputs")
+	}
+
+	p.Outputs[types.EgressTypeSegments] = conf
+	p.OutputCount++
+	p.Info.SegmentResults = append(p.Info.SegmentResults, conf.SegmentsInfo)
+
+	return conf, nil
+}
+
+// renditions are lower resolution copies of the hls output, listed together with it in a master playlist
+func (p *PipelineConfig) updateHLSRenditions() {
+	o := p.GetSegmentConfig()
+	if len(p.HLSLadder) == 0 || o == nil || o.OutputType != types.OutputTypeHLS ||
+		p.SourceType != types.SourceTypeWeb || !p.VideoEnabled || o.Renditions != nil {
+		return
+	}
+
+	ext := types.FileExtensionForOutputType[o.OutputType]
+	playlistName := strings.TrimSuffix(o.PlaylistFilename, string(ext))
+	o.MasterPlaylistFilename = fmt.Sprintf("%s_master%s", playlistName, ext)
+
+	for i := range p.HLSLadder {
+		r := &p.HLSLadder[i]
+
+		conf := *o
+		conf.SegmentsInfo = &livekit.SegmentsInfo{}
+		conf.PlaylistFilename = fmt.Sprintf("%s_%s%s", playlistName, r.Name, ext)
+		conf.SegmentPrefix = fmt.Sprintf("%s_%s", o.SegmentPrefix, r.Name)
+		conf.DisableManifest = true
+		conf.MasterPlaylistFilename = ""
+		conf.Renditions = nil
+		conf.Rendition = r
+		conf.Segments = nil
+		conf.SegmentsInfo.PlaylistName = path.Join(conf.StorageDir, conf.PlaylistFilename)
+
+		o.Renditions = append(o.Renditions, &conf)
+		p.Info.SegmentResults = append(p.Info.SegmentResults, conf.SegmentsInfo)
+	}
+}
+
+// SinkName returns the name of the splitmuxsink writing a rendition, or an empty string for the main output
+func (o *SegmentConfig) SinkName() string {
+	switch {
+	case o.Rendition != nil:
+		return fmt.Sprintf("splitmuxsink_%s", o.Rendition.Name)
+	case o.AudioRendition != nil:
+		return fmt.Sprintf("splitmuxsink_audio_%s", o.AudioRendition.Language)
+	default:
+		return ""
+	}
+}
+
+// Resolution returns the size of a rendition, in the same orientation as the output
+func (r *HLSRenditionConfig) Resolution(p *PipelineConfig) (int32, int32) {
+	return p.Orient(r.Width, r.Height)
+}
+
+// PartFilename returns the name of a low latency hls part. Parts are numbered independently of segments.
+func (o *SegmentConfig) PartFilename(index int) string {
+	return fmt.Sprintf("%s_part%05d%s", o.SegmentPrefix, index, types.FileExtensionTS)
+}
+
 func (o *SegmentConfig) updatePrefixAndPlaylist(p *PipelineConfig) error {
 	identifier, replacements := p.getFilenameInfo()
 
@@ -113,7 +299,7 @@ func (o *SegmentConfig) updatePrefixAndPlaylist(p *PipelineConfig) error {
 		if filePrefix != "" {
 			playlistName = filePrefix
 		} else {
-			playlistName = fmt.Sprintf("%s-%s", identifier, time.Now().Format("2006-01-02T150405"))
+			playlistName = fmt.Sprintf("%s-%s", identifier, clock.Now().Format("2006-01-02T150405"))
 		}
 	}
 
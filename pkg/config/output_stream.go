@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
 )
@@ -10,6 +12,32 @@ type StreamConfig struct {
 
 	Urls       []string
 	StreamInfo map[string]*livekit.StreamInfo
+	Stats      []*StreamStats // totals for each finished stream
+}
+
+// StreamStats are delivery totals for a stream url, which livekit.StreamInfo has no room for
+type StreamStats struct {
+	Url            string `json:"url"` // redacted
+	Duration       int64  `json:"duration"`
+	BytesSent      uint64 `json:"bytes_sent"`
+	AverageBitrate int64  `json:"average_bitrate"` // bits per second
+	Reconnects     int    `json:"reconnects"`
+	Error          string `json:"error,omitempty"`
+	FailureCause   string `json:"failure_cause,omitempty"` // user, system or unknown, if the stream failed
+}
+
+func NewStreamStats(info *livekit.StreamInfo, bytesSent uint64, reconnects int) *StreamStats {
+	s := &StreamStats{
+		Url:        info.Url,
+		Duration:   info.Duration,
+		BytesSent:  bytesSent,
+		Reconnects: reconnects,
+		Error:      info.Error,
+	}
+	if info.Duration > 0 {
+		s.AverageBitrate = int64(float64(bytesSent*8) / time.Duration(info.Duration).Seconds())
+	}
+	return s
 }
 
 func (p *PipelineConfig) GetStreamConfig() *StreamConfig {
@@ -2,7 +2,10 @@ package config
 
 import (
 	"context"
+	"fmt"
 	"net/url"
+	"path"
+	"sort"
 	"strings"
 	"time"
 
@@ -14,8 +17,8 @@ import (
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/egress/pkg/util"
-	"github.com/livekit/protocol/egress"
 	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
 	"github.com/livekit/protocol/rpc"
 	"github.com/livekit/protocol/tracer"
 )
@@ -28,8 +31,9 @@ const (
 type PipelineConfig struct {
 	BaseConfig `yaml:",inline"`
 
-	HandlerID string `yaml:"handler_id"`
-	TmpDir    string `yaml:"tmp_dir"`
+	HandlerID string     `yaml:"handler_id"`
+	TmpDir    string     `yaml:"tmp_dir"`
+	SyncGroup *SyncGroup `yaml:"sync_group"` // set by the service when sync_groups is enabled
 
 	SourceConfig `yaml:"-"`
 	AudioConfig  `yaml:"-"`
@@ -38,9 +42,29 @@ type PipelineConfig struct {
 	Outputs     map[types.EgressType]OutputConfig `yaml:"-"`
 	OutputCount int
 
-	GstReady chan struct{}       `yaml:"-"`
-	Failure  chan error          `yaml:"-"`
-	Info     *livekit.EgressInfo `yaml:"-"`
+	GstReady     chan struct{}       `yaml:"-"`
+	Failure      chan error          `yaml:"-"`
+	Info         *livekit.EgressInfo `yaml:"-"`
+	LimitReached types.LimitType     `yaml:"-"` // set when the egress ends with EGRESS_LIMIT_REACHED
+	RequestType  string              `yaml:"-"` // room_composite, web, track_composite or track
+	EndTrigger   string              `yaml:"-"` // what ends the egress, other than StopEgress and limits
+	EndedBy      string              `yaml:"-"` // set to the trigger or other reason once the egress is ending
+	FailureCause errors.FailureCause `yaml:"-"` // set with Info.Error, user, system or unknown
+	VideoLostAt  int64               `yaml:"-"` // set when the egress continued audio only after losing video
+	StartOffset  int64               `yaml:"-"` // ns from the sync group epoch to the first sample
+	PreviewFile  *livekit.FileInfo   `yaml:"-"` // set once the preview image is uploaded
+}
+
+// SetFailure sets the error of the egress, and what caused it
+func (p *PipelineConfig) SetFailure(err error) {
+	p.Info.Error = err.Error()
+	p.FailureCause = errors.GetFailureCause(err)
+}
+
+// SyncGroup is shared by egresses for the same room which overlap on a node, so that their files can be aligned
+type SyncGroup struct {
+	ID    string `yaml:"id"`
+	Epoch int64  `yaml:"epoch"` // unix ns, when the group's first egress was launched
 }
 
 type SourceConfig struct {
@@ -72,20 +96,26 @@ type SDKSourceParams struct {
 	VideoInCodec        types.MimeType
 	AudioCodecParams    webrtc.RTPCodecParameters
 	VideoCodecParams    webrtc.RTPCodecParameters
+
+	AlternateAudioTracks []*AlternateAudio // in config order, once subscribed
 }
 
 type AudioConfig struct {
 	AudioEnabled     bool
 	AudioTranscoding bool
 	AudioOutCodec    types.MimeType
+	AudioCodecReason string
 	AudioBitrate     int32
 	AudioFrequency   int32
+	AudioChannels    int32
+	AudioMixMatrix   string // audioconvert mix-matrix from the two input channels, empty for stereo passthrough
 }
 
 type VideoConfig struct {
 	VideoEnabled     bool
 	VideoTranscoding bool
 	VideoOutCodec    types.MimeType
+	VideoCodecReason string
 	VideoProfile     types.Profile
 	Width            int32
 	Height           int32
@@ -116,6 +146,40 @@ func NewPipelineConfig(confString string, req *rpc.StartEgressRequest) (*Pipelin
 		return nil, err
 	}
 
+	// before the request is parsed, so that filename templates use the reference clock
+	if err := p.StartClock(); err != nil {
+		logger.Warnw("could not synchronize clock, using system time", err)
+	}
+
+	return p, p.Update(req)
+}
+
+// NewInProcessPipelineConfig is used for handlers running inside the service process, which keep the service logger
+func NewInProcessPipelineConfig(conf *ServiceConfig, handlerID string, req *rpc.StartEgressRequest) (*PipelineConfig, error) {
+	p := &PipelineConfig{
+		BaseConfig: conf.BaseConfig,
+		HandlerID:  handlerID,
+		TmpDir:     path.Join(conf.ScratchDirectory, handlerID),
+		Outputs:    make(map[types.EgressType]OutputConfig),
+		GstReady:   make(chan struct{}),
+		Failure:    make(chan error, 10),
+	}
+
+	return p, p.Update(req)
+}
+
+// NewSharedPipelineConfig creates the config for an egress added to a running handler process
+func NewSharedPipelineConfig(conf *PipelineConfig, handlerID string, req *rpc.StartEgressRequest) (*PipelineConfig, error) {
+	p := &PipelineConfig{
+		BaseConfig: conf.BaseConfig,
+		HandlerID:  handlerID,
+		TmpDir:     conf.TmpDir,
+		SyncGroup:  conf.SyncGroup, // shared handlers only host egresses for the same room
+		Outputs:    make(map[types.EgressType]OutputConfig),
+		GstReady:   make(chan struct{}),
+		Failure:    make(chan error, 10),
+	}
+
 	return p, p.Update(req)
 }
 
@@ -146,6 +210,7 @@ func (p *PipelineConfig) Update(request *rpc.StartEgressRequest) error {
 	p.AudioConfig = AudioConfig{
 		AudioBitrate:   128,
 		AudioFrequency: 44100,
+		AudioChannels:  2,
 	}
 	p.VideoConfig = VideoConfig{
 		VideoProfile: types.ProfileMain,
@@ -326,6 +391,10 @@ func (p *PipelineConfig) Update(request *rpc.StartEgressRequest) error {
 		return errors.ErrInvalidInput("request")
 	}
 
+	p.RequestType, _ = getRequestInfo(request)
+	p.SessionLimits = p.SessionLimits.forRequestType(p.RequestType)
+	p.EndTrigger = p.getEndTrigger(p.RequestType)
+
 	// connection info
 	if connectionInfoRequired {
 		if p.Info.RoomName == "" {
@@ -333,10 +402,19 @@ func (p *PipelineConfig) Update(request *rpc.StartEgressRequest) error {
 		}
 
 		// token
-		if request.Token != "" {
+		if p.mintTemplateToken(request.Token) {
+			if p.ApiKey == "" || p.ApiSecret == "" {
+				return errors.ErrInvalidInput("api key/secret")
+			}
+			token, err := p.buildToken(p.TemplateToken.TTL)
+			if err != nil {
+				return err
+			}
+			p.Token = token
+		} else if request.Token != "" {
 			p.Token = request.Token
 		} else if p.ApiKey != "" && p.ApiSecret != "" {
-			token, err := egress.BuildEgressToken(p.Info.EgressId, p.ApiKey, p.ApiSecret, p.Info.RoomName)
+			token, err := p.buildToken(egressTokenTTL)
 			if err != nil {
 				return err
 			}
@@ -353,6 +431,10 @@ func (p *PipelineConfig) Update(request *rpc.StartEgressRequest) error {
 		}
 	}
 
+	if p.VideoTranscoding {
+		p.applyContentHint()
+	}
+
 	if p.TrackID == "" {
 		// Track egress output format decision happens after join
 		err := p.validateAndUpdateOutputParams()
@@ -378,38 +460,171 @@ func (p *PipelineConfig) validateAndUpdateOutputParams() error {
 
 	// Select a codec compatible with all outputs
 	if p.AudioEnabled {
-		for _, o := range p.Outputs {
-			if compatibleAudioCodecs[types.DefaultAudioCodecs[o.GetOutputType()]] {
-				p.AudioOutCodec = types.DefaultAudioCodecs[o.GetOutputType()]
-				break
-			}
-		}
+		p.AudioOutCodec, p.AudioCodecReason = p.selectCodec(
+			p.AudioOutCodec, compatibleAudioCodecs, types.DefaultAudioCodecs, types.AudioCodecPriority,
+		)
 		if p.AudioOutCodec == "" {
-			// No default codec found. Pick a random compatible one
-			for k, _ := range compatibleAudioCodecs {
-				p.AudioOutCodec = k
-			}
+			return errors.ErrNoCompatibleCodec
 		}
+		logger.Debugw("selected audio codec", "codec", p.AudioOutCodec, "reason", p.AudioCodecReason)
 	}
 
 	if p.VideoEnabled {
-		for _, o := range p.Outputs {
-			if compatibleVideoCodecs[types.DefaultVideoCodecs[o.GetOutputType()]] {
-				p.VideoOutCodec = types.DefaultVideoCodecs[o.GetOutputType()]
+		p.VideoOutCodec, p.VideoCodecReason = p.selectCodec(
+			p.VideoOutCodec, compatibleVideoCodecs, types.DefaultVideoCodecs, types.VideoCodecPriority,
+		)
+		if p.VideoOutCodec == "" {
+			return errors.ErrNoCompatibleCodec
+		}
+		p.applyVideoCodecPreferences(compatibleVideoCodecs)
+		logger.Debugw("selected video codec", "codec", p.VideoOutCodec, "reason", p.VideoCodecReason)
+	}
+
+	p.updateAudioChannels()
+
+	if err = p.validateAudioParams(); err != nil {
+		return err
+	}
+
+	p.updateProxyFileOutput()
+	p.updateHLSRenditions()
+	p.updateAlternateAudio()
+
+	return nil
+}
+
+// Orient swaps a landscape size for portrait outputs, so that scaled copies keep the layout's orientation
+func (p *PipelineConfig) Orient(width, height int32) (int32, int32) {
+	if p.Height > p.Width {
+		return height, width
+	}
+	return width, height
+}
+
+// updateAudioChannels applies the configured channel count and mapping
+func (p *PipelineConfig) updateAudioChannels() {
+	c := p.AudioLayout
+	if c == nil || !p.AudioTranscoding || (c.AudioOnly && p.VideoEnabled) {
+		return
+	}
+
+	p.AudioChannels = c.Channels
+	p.AudioMixMatrix = getMixMatrix(c.Channels, c.Mapping)
+}
+
+// getMixMatrix returns a serialized matrix with a row for each output channel, and a column for each input channel
+func getMixMatrix(channels int32, mapping string) string {
+	var rows []string
+	switch {
+	case channels == 1 && mapping == ChannelMappingLeft:
+		rows = []string{"1.0, 0.0"}
+	case channels == 1 && mapping == ChannelMappingRight:
+		rows = []string{"0.0, 1.0"}
+	case channels == 1:
+		rows = []string{"0.5, 0.5"}
+	case mapping == ChannelMappingLeft:
+		rows = []string{"1.0, 0.0", "1.0, 0.0"}
+	case mapping == ChannelMappingRight:
+		rows = []string{"0.0, 1.0", "0.0, 1.0"}
+	case mapping == ChannelMappingSwap:
+		rows = []string{"0.0, 1.0", "1.0, 0.0"}
+	default:
+		return ""
+	}
+
+	for i, row := range rows {
+		values := strings.Split(row, ", ")
+		for j, v := range values {
+			values[j] = "(float)" + v
+		}
+		rows[i] = fmt.Sprintf("<%s>", strings.Join(values, ", "))
+	}
+	return fmt.Sprintf("<%s>", strings.Join(rows, ", "))
+}
+
+// checks bitrate and sample rate against the selected audio codec, before any pipeline is built
+func (p *PipelineConfig) validateAudioParams() error {
+	if !p.AudioEnabled || !p.AudioTranscoding {
+		return nil
+	}
+
+	if r, ok := types.AudioBitrateRanges[p.AudioOutCodec]; ok {
+		if p.AudioBitrate < r[0] || p.AudioBitrate > r[1] {
+			return errors.ErrInvalidRange(fmt.Sprintf("audio bitrate for %s", p.AudioOutCodec), p.AudioBitrate, r[0], r[1])
+		}
+	}
+
+	if frequencies, ok := types.AudioFrequencies[p.AudioOutCodec]; ok {
+		allowed := make([]string, 0, len(frequencies))
+		valid := false
+		for _, f := range frequencies {
+			if f == p.AudioFrequency {
+				valid = true
 				break
 			}
+			allowed = append(allowed, fmt.Sprint(f))
 		}
-		if p.VideoOutCodec == "" {
-			// No default codec found. Pick a random compatible one
-			for k, _ := range compatibleVideoCodecs {
-				p.VideoOutCodec = k
-			}
+		if !valid {
+			return errors.ErrInvalidValue(fmt.Sprintf("audio frequency for %s", p.AudioOutCodec), p.AudioFrequency, allowed)
 		}
 	}
 
 	return nil
 }
 
+// selectCodec picks a codec deterministically: a requested codec always wins, followed by the default codec
+// of the first output (ordered by egress type) which every output supports, then the codec priority order
+func (p *PipelineConfig) selectCodec(
+	requested types.MimeType,
+	compatible map[types.MimeType]bool,
+	defaults map[types.OutputType]types.MimeType,
+	priority []types.MimeType,
+) (types.MimeType, string) {
+	if requested != "" {
+		return requested, "requested"
+	}
+
+	egressTypes := make([]types.EgressType, 0, len(p.Outputs))
+	for egressType := range p.Outputs {
+		egressTypes = append(egressTypes, egressType)
+	}
+	sort.Slice(egressTypes, func(i, j int) bool { return egressTypes[i] < egressTypes[j] })
+
+	for _, egressType := range egressTypes {
+		outputType := p.Outputs[egressType].GetOutputType()
+		if codec := defaults[outputType]; compatible[codec] {
+			return codec, fmt.Sprintf("default for %s output (%s)", egressType, outputType)
+		}
+	}
+
+	for _, codec := range priority {
+		if compatible[codec] {
+			return codec, "first compatible codec by priority"
+		}
+	}
+
+	return "", ""
+}
+
+// applyVideoCodecPreferences replaces the selected codec with the one preferred by this node, if every output supports it.
+// h265 is a node preference rather than a request option because the pinned protocol's VideoCodec has no h265 value,
+// and its StreamProtocol no srt, so there is nothing in a request to select them with
+func (p *PipelineConfig) applyVideoCodecPreferences(compatible map[types.MimeType]bool) {
+	if p.VideoCodecReason == "requested" {
+		return
+	}
+
+	switch {
+	case p.VideoOutCodec == types.MimeTypeVP8 && p.WebMVideoCodec == "vp9" && compatible[types.MimeTypeVP9]:
+		p.VideoOutCodec = types.MimeTypeVP9
+		p.VideoCodecReason = "webm_video_codec"
+
+	case p.VideoOutCodec == types.MimeTypeH264 && p.HEVC && compatible[types.MimeTypeH265]:
+		p.VideoOutCodec = types.MimeTypeH265
+		p.VideoCodecReason = "hevc"
+	}
+}
+
 func (p *PipelineConfig) validateAndUpdateOutputCodecs() (compatibleAudioCodecs map[types.MimeType]bool, compatibleVideoCodecs map[types.MimeType]bool, err error) {
 	compatibleAudioCodecs = make(map[types.MimeType]bool)
 	compatibleVideoCodecs = make(map[types.MimeType]bool)
@@ -429,7 +644,8 @@ func (p *PipelineConfig) validateAndUpdateOutputCodecs() (compatibleAudioCodecs
 					return nil, nil, errors.ErrNoCompatibleCodec
 				} else {
 					// Return a more specific error if a codec was provided
-					return nil, nil, errors.ErrIncompatible(o.GetOutputType(), p.AudioOutCodec)
+					return nil, nil, errors.ErrIncompatibleCodec(o.GetOutputType(), p.AudioOutCodec,
+						types.GetCompatibleCodecs(o.GetOutputType(), types.AllOutputAudioCodecs))
 				}
 			}
 		}
@@ -445,11 +661,12 @@ func (p *PipelineConfig) validateAndUpdateOutputCodecs() (compatibleAudioCodecs
 		for _, o := range p.Outputs {
 			compatibleVideoCodecs = types.GetMapIntersection(compatibleVideoCodecs, types.CodecCompatibility[o.GetOutputType()])
 			if len(compatibleVideoCodecs) == 0 {
-				if p.AudioOutCodec == "" {
+				if p.VideoOutCodec == "" {
 					return nil, nil, errors.ErrNoCompatibleCodec
 				} else {
 					// Return a more specific error if a codec was provided
-					return nil, nil, errors.ErrIncompatible(o.GetOutputType(), p.VideoOutCodec)
+					return nil, nil, errors.ErrIncompatibleCodec(o.GetOutputType(), p.VideoOutCodec,
+						types.GetCompatibleCodecs(o.GetOutputType(), types.AllOutputVideoCodecs))
 				}
 			}
 		}
@@ -497,7 +714,10 @@ func (p *PipelineConfig) UpdateInfoFromSDK(identifier string, replacements map[s
 	for egressType, c := range p.Outputs {
 		switch egressType {
 		case types.EgressTypeFile:
-			return c.(*FileConfig).updateFilepath(p, identifier, replacements)
+			if err := c.(*FileConfig).updateFilepath(p, identifier, replacements); err != nil {
+				return err
+			}
+			p.updateProxyFileOutput()
 
 		case types.EgressTypeSegments:
 			o := c.(*SegmentConfig)
@@ -508,6 +728,7 @@ func (p *PipelineConfig) UpdateInfoFromSDK(identifier string, replacements map[s
 			o.SegmentsInfo.PlaylistName = stringReplace(o.SegmentsInfo.PlaylistName, replacements)
 		}
 	}
+	p.updateAudioRenditions()
 
 	return nil
 }
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/livekit/protocol/rpc"
+)
+
+type PlacementRule struct {
+	RequestTypes   []string          `yaml:"request_types"`   // room_composite, web, track_composite, or track (default all)
+	RoomPrefix     string            `yaml:"room_prefix"`     // only applies to rooms with this prefix
+	RequiredLabels map[string]string `yaml:"required_labels"` // node labels needed to run matching requests
+}
+
+// MatchesPlacement returns false if a placement rule applies to the request and this node is missing a required label
+func (c *ServiceConfig) MatchesPlacement(req *rpc.StartEgressRequest) bool {
+	requestType, roomName := getRequestInfo(req)
+
+	for _, rule := range c.PlacementRules {
+		if !rule.matches(requestType, roomName) {
+			continue
+		}
+		for k, v := range rule.RequiredLabels {
+			if c.Labels[k] != v {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (r *PlacementRule) matches(requestType, roomName string) bool {
+	if r.RoomPrefix != "" && !strings.HasPrefix(roomName, r.RoomPrefix) {
+		return false
+	}
+	if len(r.RequestTypes) == 0 {
+		return true
+	}
+	for _, t := range r.RequestTypes {
+		if t == requestType {
+			return true
+		}
+	}
+	return false
+}
+
+func getRequestInfo(req *rpc.StartEgressRequest) (requestType string, roomName string) {
+	switch r := req.Request.(type) {
+	case *rpc.StartEgressRequest_RoomComposite:
+		return "room_composite", r.RoomComposite.RoomName
+	case *rpc.StartEgressRequest_Web:
+		return "web", ""
+	case *rpc.StartEgressRequest_TrackComposite:
+		return "track_composite", r.TrackComposite.RoomName
+	case *rpc.StartEgressRequest_Track:
+		return "track", r.Track.RoomName
+	}
+	return "", ""
+}
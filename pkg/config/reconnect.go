@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/livekit/egress/pkg/util"
+)
+
+func (c *RTMPReconnectConfig) validate() error {
+	if c.Window <= 0 {
+		c.Window = defaultRTMPReconnectWindow
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = defaultRTMPReconnectBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultRTMPReconnectMaxBackoff
+	}
+	if c.MaxBackoff < c.Backoff {
+		c.MaxBackoff = c.Backoff
+	}
+	if c.Buffer <= 0 {
+		c.Buffer = defaultRTMPReconnectBuffer
+	}
+	if c.Buffer > maxRTMPReconnectBuffer {
+		return fmt.Errorf("rtmp_reconnect buffer must be at most %s", maxRTMPReconnectBuffer)
+	}
+	if c.MaxAttempts < 0 {
+		return fmt.Errorf("rtmp_reconnect max_attempts must not be negative")
+	}
+	return nil
+}
+
+// GetBackoff returns the reconnect schedule. Attempts stop once the next wait would pass the window, or after max_attempts.
+func (c *RTMPReconnectConfig) GetBackoff() util.Backoff {
+	return util.Backoff{
+		Backoff:     c.Backoff,
+		MaxBackoff:  c.MaxBackoff,
+		Window:      c.Window,
+		MaxAttempts: c.MaxAttempts,
+	}
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	envAPIKey    = "LIVEKIT_API_KEY"
+	envAPISecret = "LIVEKIT_API_SECRET"
+	envWsURL     = "LIVEKIT_WS_URL"
+)
+
+// fields which can be set with environment variables instead of the config file
+var envOverrides = map[string]string{
+	"api_key":    envAPIKey,
+	"api_secret": envAPISecret,
+	"ws_url":     envWsURL,
+}
+
+// Schema describes every field of the service config, and the pipeline config fields which are set by the service
+type Schema struct {
+	Service  []*SchemaField `json:"service"`
+	Pipeline []*SchemaField `json:"pipeline"`
+}
+
+// SchemaField is a single config value. Nested fields are named by their yaml path, with [] for list items
+// and {} for map values, e.g. handler_binaries[].path.
+type SchemaField struct {
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Default interface{} `json:"default,omitempty"`
+	Env     string      `json:"env,omitempty"`
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// GetSchema reflects over the config structs. Defaults are read from the effective config of an empty config file,
+// and from each optional section when it is set to {}.
+func GetSchema() (*Schema, error) {
+	defaults, err := NewServiceConfig("")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Schema{}
+	walkSchema(&s.Service, "", reflect.TypeOf(*defaults), reflect.ValueOf(*defaults), true)
+
+	// base config fields are listed with the service
+	shared := make(map[string]bool)
+	for _, f := range s.Service {
+		shared[f.Name] = true
+	}
+	var pipeline []*SchemaField
+	walkSchema(&pipeline, "", reflect.TypeOf(PipelineConfig{}), reflect.Value{}, false)
+	for _, f := range pipeline {
+		if !shared[f.Name] {
+			s.Pipeline = append(s.Pipeline, f)
+		}
+	}
+
+	return s, nil
+}
+
+func walkSchema(fields *[]*SchemaField, prefix string, t reflect.Type, v reflect.Value, topLevel bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, inline, ok := yamlName(f)
+		if !ok {
+			continue
+		}
+
+		var fv reflect.Value
+		if v.IsValid() {
+			fv = v.Field(i)
+		}
+
+		if inline {
+			walkSchema(fields, prefix, f.Type, fv, topLevel)
+			continue
+		}
+
+		path := name
+		if prefix != "" {
+			path = fmt.Sprintf("%s.%s", prefix, name)
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+			if fv.IsValid() {
+				if fv.IsNil() {
+					fv = reflect.Value{}
+					if topLevel && ft.Kind() == reflect.Struct {
+						fv = sectionDefaults(name)
+					}
+				} else {
+					fv = fv.Elem()
+				}
+			}
+		}
+
+		switch {
+		case ft.Kind() == reflect.Struct:
+			walkSchema(fields, path, ft, fv, false)
+
+		case ft.Kind() == reflect.Slice && elemStruct(ft) != nil:
+			walkSchema(fields, path+"[]", elemStruct(ft), reflect.Value{}, false)
+
+		case ft.Kind() == reflect.Map && elemStruct(ft) != nil:
+			walkSchema(fields, path+"{}", elemStruct(ft), reflect.Value{}, false)
+
+		default:
+			field := &SchemaField{
+				Name: path,
+				Type: typeName(ft),
+			}
+			if topLevel {
+				field.Env = envOverrides[path]
+			}
+			// values from the environment are not defaults, and may be secrets
+			if field.Env == "" && fv.IsValid() && !fv.IsZero() {
+				field.Default = defaultValue(fv)
+			}
+			*fields = append(*fields, field)
+		}
+	}
+}
+
+// sectionDefaults returns the defaults of an optional top level section, or an invalid value if it has required fields
+func sectionDefaults(name string) reflect.Value {
+	conf, err := NewServiceConfig(fmt.Sprintf("%s: {}", name))
+	if err != nil {
+		return reflect.Value{}
+	}
+
+	return findField(reflect.ValueOf(*conf), name)
+}
+
+func findField(v reflect.Value, name string) reflect.Value {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		fieldName, inline, ok := yamlName(t.Field(i))
+		switch {
+		case !ok:
+			continue
+		case inline:
+			if found := findField(v.Field(i), name); found.IsValid() {
+				return found
+			}
+		case fieldName == name:
+			if fv := v.Field(i); fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				return fv.Elem()
+			}
+			return reflect.Value{}
+		}
+	}
+	return reflect.Value{}
+}
+
+func yamlName(f reflect.StructField) (name string, inline bool, ok bool) {
+	tag, ok := f.Tag.Lookup("yaml")
+	if !ok || tag == "-" || !f.IsExported() {
+		return "", false, false
+	}
+
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "inline" {
+			return "", true, true
+		}
+	}
+	return parts[0], false, parts[0] != ""
+}
+
+func elemStruct(t reflect.Type) reflect.Type {
+	e := t.Elem()
+	if e.Kind() == reflect.Ptr {
+		e = e.Elem()
+	}
+	if e.Kind() == reflect.Struct && e != durationType {
+		return e
+	}
+	return nil
+}
+
+func typeName(t reflect.Type) string {
+	if t == durationType {
+		return "duration"
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeName(t.Elem())
+	case reflect.Bool:
+		return "bool"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Slice:
+		return fmt.Sprintf("list<%s>", typeName(t.Elem()))
+	case reflect.Map:
+		return fmt.Sprintf("map<%s,%s>", typeName(t.Key()), typeName(t.Elem()))
+	default:
+		return t.Kind().String()
+	}
+}
+
+func defaultValue(v reflect.Value) interface{} {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Kind() == reflect.Ptr {
+		return defaultValue(v.Elem())
+	}
+	return v.Interface()
+}
@@ -1,13 +1,20 @@
 package config
 
 import (
+	"encoding/hex"
 	"fmt"
+	"net/http"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 
+	"github.com/livekit/egress/pkg/encryption"
 	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/utils"
 )
 
@@ -19,6 +26,110 @@ const (
 
 	defaultTemplatePort         = 7980
 	defaultTemplateBaseTemplate = "http://localhost:%d/"
+
+	defaultIOClientTimeout          = time.Second * 3
+	defaultIOClientMaxAttempts      = 3
+	defaultIOClientBackoff          = time.Second
+	defaultIOClientBreakerThreshold = 5
+	defaultIOClientBreakerCooldown  = time.Second * 30
+
+	defaultKillGracePeriod = time.Second * 30
+
+	defaultUploadRetryMaxRetries = 5
+	defaultUploadRetryMinDelay   = time.Millisecond * 100
+	defaultUploadRetryMaxDelay   = time.Second * 5
+	defaultUploadRetryMultiplier = 2
+
+	defaultUploadSpoolRetryInterval = time.Minute * 5
+
+	defaultChromeLaunchMaxConcurrent = 1
+	defaultChromeLaunchQueueTimeout  = time.Minute
+	defaultChromeLaunchTimeout       = time.Second * 30
+	defaultChromeLaunchRetries       = 1
+	defaultChromeLaunchBackoff       = time.Second
+
+	defaultDisplayPoolStart = 10
+	defaultDisplayPoolSize  = 1000
+
+	defaultPulseSinkSampleRate = 48000
+	defaultPulseSinkChannels   = 2
+
+	defaultWatchdogInterval        = time.Minute
+	defaultWatchdogMaxGoroutines   = 10000
+	defaultWatchdogGoroutineGrowth = 100
+	defaultWatchdogFDGrowth        = 20
+
+	defaultProfilingInterval      = time.Minute * 5
+	defaultProfilingCPUDuration   = time.Second * 10
+	defaultProfilingStoragePrefix = "profiles"
+
+	defaultPTPUTCOffset      = time.Second * 37
+	defaultClockSyncInterval = time.Minute
+
+	defaultNetworkStatsInterval      = time.Second * 10
+	defaultNetworkStatsLossThreshold = 0.05
+
+	defaultFileIndexInterval       = time.Second
+	defaultFileIndexUpdateInterval = time.Minute
+
+	defaultTelemetryServiceName     = "egress"
+	defaultTelemetryMetricsInterval = time.Second * 15
+
+	defaultProxyWidth        = 640
+	defaultProxyHeight       = 360
+	defaultProxyVideoBitrate = 500
+	defaultProxySuffix       = "_proxy"
+
+	defaultPartDuration  = time.Second
+	defaultChunkDuration = time.Millisecond * 500
+
+	defaultRTMPReconnectWindow     = time.Minute
+	defaultRTMPReconnectBackoff    = time.Second
+	defaultRTMPReconnectMaxBackoff = time.Second * 10
+	defaultRTMPReconnectBuffer     = time.Second * 5
+	maxRTMPReconnectBuffer         = time.Second * 30
+
+	defaultCBRVBVBuffer   = time.Second
+	maxCBRVBVBuffer       = time.Second * 10
+	defaultCBRMuxOverhead = 0.1
+
+	defaultS3PartSize    = 16
+	minS3PartSize        = 5
+	defaultS3Concurrency = 4
+
+	defaultS3RoleSessionName = "egress"
+	defaultS3RoleDuration    = time.Minute * 15
+
+	defaultPreviewDelay   = time.Second * 2
+	defaultPreviewQuality = 80
+
+	defaultKeyServerTimeout = time.Second * 10
+
+	defaultMainAudioLanguage = "und"
+	defaultMainAudioName     = "Main"
+
+	defaultPresignExpiry = time.Hour * 24
+	maxPresignExpiry     = time.Hour * 24 * 7
+
+	defaultSlateColor = "#000000"
+
+	defaultWatermarkOpacity = 1
+	defaultWatermarkMargin  = 16
+
+	defaultTemplateTokenTTL = time.Minute * 10
+
+	defaultComfortNoiseWave   = "pink-noise"
+	defaultComfortNoiseVolume = 0.01
+	defaultComfortNoiseGap    = time.Millisecond * 250
+
+	defaultLoudnessTarget   = -23
+	defaultLoudnessTruePeak = -1
+	defaultLoudnessMaxGain  = 12
+
+	defaultHTTPFormField = "file"
+
+	defaultUploadHookTimeout  = time.Minute * 5
+	defaultPostProcessTimeout = time.Minute * 10
 )
 
 type ServiceConfig struct {
@@ -29,7 +140,32 @@ type ServiceConfig struct {
 	PrometheusPort   int `yaml:"prometheus_port"`
 	DebugHandlerPort int `yaml:"debug_handler_port"` // Port used to launch the egress debug handler. 0 means debug handler disabled.
 
+	InProcessHandlers bool                  `yaml:"in_process_handlers"` // run handlers inside the service process instead of launching a new process per egress
+	HandlerBinaries   []HandlerBinaryConfig `yaml:"handler_binaries"`    // alternate handler builds, first match is used
+	KillGracePeriod   time.Duration         `yaml:"kill_grace_period"`   // time handlers have to finish after being killed before they are force killed
+	ShutdownDeadline  time.Duration         `yaml:"shutdown_deadline"`   // on SIGTERM, stop egresses and give them this long to finalize and upload, instead of waiting for them to end
+	MaxConcurrentWeb  int                   `yaml:"max_concurrent_web"`  // max room composite and web egress running at once, 0 for no limit
+	TracksPerHandler  int                   `yaml:"tracks_per_handler"`  // max track egresses for the same room sharing one handler process (default 1)
+
+	Labels         map[string]string `yaml:"labels"`          // node labels, such as gpu or region
+	PlacementRules []PlacementRule   `yaml:"placement_rules"` // requests matching a rule are only accepted by nodes with its required labels
+
 	CPUCostConfig `yaml:"cpu_cost"` // CPU costs for various egress types
+	Watchdog      WatchdogConfig    `yaml:"watchdog"` // goroutine and file descriptor leak detection
+}
+
+type WatchdogConfig struct {
+	Interval        time.Duration `yaml:"interval"`         // time between checks (default 1m)
+	MaxGoroutines   int           `yaml:"max_goroutines"`   // default 10000
+	MaxFDs          int           `yaml:"max_fds"`          // default 80% of the open file limit
+	GoroutineGrowth int           `yaml:"goroutine_growth"` // allowed growth while idle before warning (default 100)
+	FDGrowth        int           `yaml:"fd_growth"`        // allowed fd and unix socket growth while idle before warning (default 20)
+}
+
+type HandlerBinaryConfig struct {
+	Path         string   `yaml:"path"`          // handler executable
+	RequestTypes []string `yaml:"request_types"` // room_composite, web, track_composite, or track (default all)
+	Fraction     float64  `yaml:"fraction"`      // share of matching requests to run with this binary (default 1)
 }
 
 type CPUCostConfig struct {
@@ -42,9 +178,9 @@ type CPUCostConfig struct {
 func NewServiceConfig(confString string) (*ServiceConfig, error) {
 	conf := &ServiceConfig{
 		BaseConfig: BaseConfig{
-			ApiKey:    os.Getenv("LIVEKIT_API_KEY"),
-			ApiSecret: os.Getenv("LIVEKIT_API_SECRET"),
-			WsUrl:     os.Getenv("LIVEKIT_WS_URL"),
+			ApiKey:    os.Getenv(envAPIKey),
+			ApiSecret: os.Getenv(envAPISecret),
+			WsUrl:     os.Getenv(envWsURL),
 			LogLevel:  "info",
 		},
 		TemplatePort: defaultTemplatePort,
@@ -72,13 +208,744 @@ func NewServiceConfig(confString string) (*ServiceConfig, error) {
 		conf.TrackCpuCost = trackCpuCost
 	}
 
+	switch conf.ContentHint {
+	case "", types.ContentHintMotion, types.ContentHintDetail, types.ContentHintText:
+	default:
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid content_hint %s", conf.ContentHint))
+	}
+
+	if conf.IOClient.Timeout <= 0 {
+		conf.IOClient.Timeout = defaultIOClientTimeout
+	}
+	if conf.IOClient.MaxAttempts <= 0 {
+		conf.IOClient.MaxAttempts = defaultIOClientMaxAttempts
+	}
+	if conf.IOClient.Backoff <= 0 {
+		conf.IOClient.Backoff = defaultIOClientBackoff
+	}
+	if conf.IOClient.BreakerThreshold <= 0 {
+		conf.IOClient.BreakerThreshold = defaultIOClientBreakerThreshold
+	}
+	if conf.IOClient.BreakerCooldown <= 0 {
+		conf.IOClient.BreakerCooldown = defaultIOClientBreakerCooldown
+	}
+
+	if conf.UploadRetry.MaxRetries < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid upload_retry max_retries %d", conf.UploadRetry.MaxRetries))
+	} else if conf.UploadRetry.MaxRetries == 0 {
+		conf.UploadRetry.MaxRetries = defaultUploadRetryMaxRetries
+	}
+	if conf.UploadRetry.RequestTimeout < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("upload_retry request_timeout cannot be negative"))
+	}
+	if conf.UploadRetry.MinDelay <= 0 {
+		conf.UploadRetry.MinDelay = defaultUploadRetryMinDelay
+	}
+	if conf.UploadRetry.MaxDelay <= 0 {
+		conf.UploadRetry.MaxDelay = defaultUploadRetryMaxDelay
+	}
+	if conf.UploadRetry.MaxDelay < conf.UploadRetry.MinDelay {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("upload_retry max_delay is less than min_delay"))
+	}
+	if conf.UploadRetry.Multiplier == 0 {
+		conf.UploadRetry.Multiplier = defaultUploadRetryMultiplier
+	} else if conf.UploadRetry.Multiplier < 1 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid upload_retry multiplier %v", conf.UploadRetry.Multiplier))
+	}
+
+	if conf.ChromeLaunch.MaxConcurrent <= 0 {
+		conf.ChromeLaunch.MaxConcurrent = defaultChromeLaunchMaxConcurrent
+	}
+	if conf.ChromeLaunch.QueueTimeout <= 0 {
+		conf.ChromeLaunch.QueueTimeout = defaultChromeLaunchQueueTimeout
+	}
+	if conf.ChromeLaunch.Timeout <= 0 {
+		conf.ChromeLaunch.Timeout = defaultChromeLaunchTimeout
+	}
+	if conf.ChromeLaunch.Retries < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid chrome_launch retries %d", conf.ChromeLaunch.Retries))
+	} else if conf.ChromeLaunch.Retries == 0 {
+		conf.ChromeLaunch.Retries = defaultChromeLaunchRetries
+	}
+	if conf.ChromeLaunch.FirstFrameTimeout < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("chrome_launch first_frame_timeout cannot be negative"))
+	}
+	if conf.ChromeLaunch.Backoff <= 0 {
+		conf.ChromeLaunch.Backoff = defaultChromeLaunchBackoff
+	}
+
+	if conf.DisplayPool.Start < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid display_pool start %d", conf.DisplayPool.Start))
+	} else if conf.DisplayPool.Start == 0 {
+		// :0 is usually a real display
+		conf.DisplayPool.Start = defaultDisplayPoolStart
+	}
+	if conf.DisplayPool.Size < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid display_pool size %d", conf.DisplayPool.Size))
+	} else if conf.DisplayPool.Size == 0 {
+		conf.DisplayPool.Size = defaultDisplayPoolSize
+	}
+
+	if conf.PulseSink.SampleRate < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid pulse_sink sample_rate %d", conf.PulseSink.SampleRate))
+	} else if conf.PulseSink.SampleRate == 0 {
+		conf.PulseSink.SampleRate = defaultPulseSinkSampleRate
+	}
+	switch conf.PulseSink.Channels {
+	case 0:
+		conf.PulseSink.Channels = defaultPulseSinkChannels
+	case 1, 2:
+	default:
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid pulse_sink channels %d", conf.PulseSink.Channels))
+	}
+
+	if conf.HandlerGC != nil {
+		if gogc := conf.HandlerGC.GOGC; gogc != "" && gogc != "off" {
+			if percent, err := strconv.Atoi(gogc); err != nil || percent <= 0 {
+				return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("handler_gc gogc must be a positive percentage or off"))
+			}
+		}
+		if limit := conf.HandlerGC.MemoryLimit; limit != "" && !memoryLimitRegexp.MatchString(limit) {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid handler_gc memory_limit %s", limit))
+		}
+		if conf.HandlerGC.Ballast < 0 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("handler_gc ballast cannot be negative"))
+		}
+	}
+
+	if conf.MaxConcurrentWeb < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid max_concurrent_web %d", conf.MaxConcurrentWeb))
+	}
+	if conf.TracksPerHandler <= 0 {
+		conf.TracksPerHandler = 1
+	}
+
+	if conf.KillGracePeriod <= 0 {
+		conf.KillGracePeriod = defaultKillGracePeriod
+	}
+	if conf.ShutdownDeadline < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid shutdown_deadline %s", conf.ShutdownDeadline))
+	}
+
+	if conf.Watchdog.Interval <= 0 {
+		conf.Watchdog.Interval = defaultWatchdogInterval
+	}
+	if conf.Watchdog.MaxGoroutines <= 0 {
+		conf.Watchdog.MaxGoroutines = defaultWatchdogMaxGoroutines
+	}
+	if conf.Watchdog.GoroutineGrowth <= 0 {
+		conf.Watchdog.GoroutineGrowth = defaultWatchdogGoroutineGrowth
+	}
+	if conf.Watchdog.FDGrowth <= 0 {
+		conf.Watchdog.FDGrowth = defaultWatchdogFDGrowth
+	}
+
+	if err := validateHandlerBinaries(conf.HandlerBinaries); err != nil {
+		return nil, errors.ErrCouldNotParseConfig(err)
+	}
+
+	for _, rule := range conf.PlacementRules {
+		for _, requestType := range rule.RequestTypes {
+			switch requestType {
+			case "room_composite", "web", "track_composite", "track":
+			default:
+				return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid placement rule request type %s", requestType))
+			}
+		}
+	}
+
+	for requestType := range conf.SessionLimits.RequestTypeLimits {
+		switch requestType {
+		case "room_composite", "web", "track_composite", "track":
+		default:
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid session limit request type %s", requestType))
+		}
+	}
+
+	if conf.ProxyFile != nil {
+		if conf.ProxyFile.Width <= 0 {
+			conf.ProxyFile.Width = defaultProxyWidth
+		}
+		if conf.ProxyFile.Height <= 0 {
+			conf.ProxyFile.Height = defaultProxyHeight
+		}
+		if conf.ProxyFile.VideoBitrate <= 0 {
+			conf.ProxyFile.VideoBitrate = defaultProxyVideoBitrate
+		}
+		if conf.ProxyFile.Suffix == "" {
+			conf.ProxyFile.Suffix = defaultProxySuffix
+		}
+	}
+
+	if conf.Timecode != nil && conf.Timecode.Start != "" {
+		// frames are checked against the framerate of each request
+		if _, err := ParseTimecode(conf.Timecode.Start, 0); err != nil {
+			return nil, errors.ErrCouldNotParseConfig(err)
+		}
+	}
+
+	switch conf.WebMVideoCodec {
+	case "", "vp8", "vp9":
+	default:
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("webm_video_codec must be vp8 or vp9"))
+	}
+
+	if err := conf.validateMuxers(); err != nil {
+		return nil, errors.ErrCouldNotParseConfig(err)
+	}
+	if err := conf.validateEndTriggers(); err != nil {
+		return nil, errors.ErrCouldNotParseConfig(err)
+	}
+	if conf.Checksums != nil {
+		if err := conf.Checksums.validate(); err != nil {
+			return nil, errors.ErrCouldNotParseConfig(err)
+		}
+	}
+	switch conf.ManifestFormat {
+	case "":
+		conf.ManifestFormat = ManifestFormatV1
+	case ManifestFormatV1, ManifestFormatV2:
+	default:
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("manifest_format must be v1 or v2"))
+	}
+
+	if conf.Trim != nil {
+		if conf.Trim.StartOffset < 0 || conf.Trim.EndOffset < 0 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("trim offsets cannot be negative"))
+		}
+		if conf.Trim.EndOffset != 0 && conf.Trim.EndOffset <= conf.Trim.StartOffset {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("trim end_offset must be after start_offset"))
+		}
+	}
+
+	if conf.HTTP != nil {
+		if conf.HTTP.URL == "" {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("http_upload url required"))
+		}
+		switch conf.HTTP.Method {
+		case "":
+			conf.HTTP.Method = http.MethodPut
+		case http.MethodPut, http.MethodPost:
+		default:
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("http_upload method must be PUT or POST"))
+		}
+		if conf.HTTP.FormField == "" {
+			conf.HTTP.FormField = defaultHTTPFormField
+		}
+	}
+
+	if conf.Encryption != nil {
+		if _, err := encryption.ParsePublicKey(conf.Encryption.PublicKey); err != nil {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid encryption public_key: %w", err))
+		}
+	}
+
+	if conf.UploadHook != nil {
+		if (len(conf.UploadHook.Command) == 0) == (conf.UploadHook.URL == "") {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("upload_hook requires either a command or a url"))
+		}
+		if conf.UploadHook.Timeout <= 0 {
+			conf.UploadHook.Timeout = defaultUploadHookTimeout
+		}
+	}
+
+	for _, h := range conf.UploadHeaders {
+		if _, err := path.Match(h.Match, ""); h.Match == "" || err != nil {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid upload_headers match %q", h.Match))
+		}
+		if h.ContentType == "" && h.CacheControl == "" {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("upload_headers %s requires a content_type or cache_control", h.Match))
+		}
+	}
+
+	replicas := make(map[string]bool)
+	for i := range conf.UploadReplicas {
+		r := &conf.UploadReplicas[i]
+		if r.Name == "" || r.storageCount() != 1 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("upload_replicas require a name and exactly one storage"))
+		}
+		if replicas[r.Name] {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("duplicate upload_replicas name %s", r.Name))
+		}
+		replicas[r.Name] = true
+	}
+
+	names := make(map[string]bool)
+	for i := range conf.PostProcessing {
+		step := &conf.PostProcessing[i]
+		if step.Name == "" || len(step.Command) == 0 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("post_processing steps require a name and command"))
+		}
+		if names[step.Name] {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("duplicate post_processing step %s", step.Name))
+		}
+		names[step.Name] = true
+		if step.Timeout <= 0 {
+			step.Timeout = defaultPostProcessTimeout
+		}
+	}
+
+	switch conf.HLSSegmentFormat {
+	case "", "ts":
+	case "fmp4":
+		if conf.LowLatencyHLS != nil {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("low_latency_hls requires ts segments"))
+		}
+	default:
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("hls_segment_format must be ts or fmp4"))
+	}
+
+	switch conf.SegmentPartitions {
+	case "", SegmentPartitionDay, SegmentPartitionHour:
+	default:
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("segment_partitions must be day or hour"))
+	}
+
+	if conf.CMAFChunked != nil {
+		if conf.HLSSegmentFormat != "fmp4" {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("cmaf_chunked requires fmp4 segments"))
+		}
+		if conf.HLSEncryption != nil {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("cmaf_chunked is not supported with hls_encryption"))
+		}
+		if conf.CMAFChunked.ChunkDuration < 0 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("cmaf_chunked chunk_duration cannot be negative"))
+		}
+		if conf.CMAFChunked.ChunkDuration == 0 {
+			conf.CMAFChunked.ChunkDuration = defaultChunkDuration
+		}
+	}
+
+	if conf.HLSEncryption != nil {
+		if conf.LowLatencyHLS != nil {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("hls_encryption is not supported with low_latency_hls"))
+		}
+		if conf.HLSEncryption.KeyServer != nil {
+			ks := conf.HLSEncryption.KeyServer
+			if conf.HLSEncryption.Key != "" || conf.HLSEncryption.KeyURI != "" {
+				return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("hls_encryption key_server cannot be used with key or key_uri"))
+			}
+			if ks.URL == "" {
+				return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("hls_encryption key_server url required"))
+			}
+			for _, system := range ks.DRMSystems {
+				switch system {
+				case DRMWidevine, DRMFairPlay:
+				default:
+					return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid drm system %s", system))
+				}
+			}
+			if ks.Timeout <= 0 {
+				ks.Timeout = defaultKeyServerTimeout
+			}
+		}
+		if conf.HLSEncryption.Key != "" {
+			if key, err := hex.DecodeString(conf.HLSEncryption.Key); err != nil || len(key) != 16 {
+				return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("hls_encryption key must be 32 hex characters"))
+			}
+			if conf.HLSEncryption.RotationInterval != 0 {
+				return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("hls_encryption rotation_interval requires generated keys"))
+			}
+		}
+		if conf.HLSEncryption.RotationInterval < 0 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("hls_encryption rotation_interval cannot be negative"))
+		}
+	}
+
+	if conf.PlaylistURIs != nil {
+		if (conf.PlaylistURIs.BaseURL == "") == !conf.PlaylistURIs.Presign {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("playlist_uris requires either base_url or presign"))
+		}
+		if conf.PlaylistURIs.PresignExpiry < 0 || conf.PlaylistURIs.PresignExpiry > maxPresignExpiry {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("playlist_uris presign_expiry must be between 0 and 7 days"))
+		}
+		if conf.PlaylistURIs.Presign && conf.PlaylistURIs.PresignExpiry == 0 {
+			conf.PlaylistURIs.PresignExpiry = defaultPresignExpiry
+		}
+	}
+
+	if conf.Slate != nil {
+		if conf.Slate.Image != "" {
+			if _, err := SlateDecoder(conf.Slate.Image); err != nil {
+				return nil, errors.ErrCouldNotParseConfig(err)
+			}
+		} else if conf.Slate.Color == "" {
+			conf.Slate.Color = defaultSlateColor
+		}
+		if conf.Slate.Color != "" {
+			if _, err := ParseColor(conf.Slate.Color); err != nil {
+				return nil, errors.ErrCouldNotParseConfig(err)
+			}
+		}
+	}
+
+	if conf.Watermark != nil {
+		if err := conf.Watermark.validate(); err != nil {
+			return nil, errors.ErrCouldNotParseConfig(err)
+		}
+	}
+
+	if conf.Participant != nil {
+		if conf.Participant.Identity == "" {
+			conf.Participant.Identity = "{egress_id}"
+		} else if !strings.Contains(conf.Participant.Identity, "{egress_id}") {
+			// egresses in the same room would otherwise replace each other
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("participant identity must contain {egress_id}"))
+		}
+	}
+
+	if conf.TemplateToken != nil {
+		switch conf.TemplateToken.Policy {
+		case "":
+			conf.TemplateToken.Policy = TemplateTokenAlways
+		case TemplateTokenAlways, TemplateTokenFallback:
+		default:
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("template_token policy must be always or fallback"))
+		}
+		if conf.TemplateToken.TTL < 0 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("template_token ttl cannot be negative"))
+		}
+		if conf.TemplateToken.TTL == 0 {
+			conf.TemplateToken.TTL = defaultTemplateTokenTTL
+		}
+	}
+
+	if conf.MuteIndicator != nil {
+		switch conf.MuteIndicator.Video {
+		case "":
+			conf.MuteIndicator.Video = MuteVideoFreeze
+		case MuteVideoFreeze, MuteVideoDrop:
+		default:
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("mute_indicator video must be freeze or drop"))
+		}
+	}
+
+	if conf.ComfortNoise != nil {
+		switch conf.ComfortNoise.Wave {
+		case "":
+			conf.ComfortNoise.Wave = defaultComfortNoiseWave
+		case "white-noise", "pink-noise", "red-noise":
+		default:
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("comfort_noise wave must be white-noise, pink-noise, or red-noise"))
+		}
+		if conf.ComfortNoise.Volume < 0 || conf.ComfortNoise.Volume > 1 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("comfort_noise volume must be between 0 and 1"))
+		}
+		if conf.ComfortNoise.Volume == 0 {
+			conf.ComfortNoise.Volume = defaultComfortNoiseVolume
+		}
+		if conf.ComfortNoise.Gap < 0 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("comfort_noise gap cannot be negative"))
+		}
+		if conf.ComfortNoise.Gap == 0 {
+			conf.ComfortNoise.Gap = defaultComfortNoiseGap
+		}
+	}
+
+	if conf.AudioLayout != nil {
+		switch conf.AudioLayout.Channels {
+		case 0:
+			conf.AudioLayout.Channels = 2
+		case 1, 2:
+		default:
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("audio_channels channels must be 1 or 2"))
+		}
+		switch conf.AudioLayout.Mapping {
+		case "":
+			conf.AudioLayout.Mapping = ChannelMappingMix
+		case ChannelMappingMix, ChannelMappingLeft, ChannelMappingRight:
+		case ChannelMappingSwap:
+			if conf.AudioLayout.Channels == 1 {
+				return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("audio_channels swap mapping requires 2 channels"))
+			}
+		default:
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("audio_channels mapping must be mix, left, right, or swap"))
+		}
+	}
+
+	if conf.Loudness != nil {
+		// a target of 0 is out of range, so it is treated as unset
+		if conf.Loudness.Target == 0 {
+			conf.Loudness.Target = defaultLoudnessTarget
+		}
+		if conf.Loudness.TruePeak == 0 {
+			conf.Loudness.TruePeak = defaultLoudnessTruePeak
+		}
+		if conf.Loudness.MaxGain == 0 {
+			conf.Loudness.MaxGain = defaultLoudnessMaxGain
+		}
+		if conf.Loudness.Target < -70 || conf.Loudness.Target > -5 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("loudness target must be between -70 and -5 LUFS"))
+		}
+		if conf.Loudness.TruePeak < -9 || conf.Loudness.TruePeak > 0 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("loudness true_peak must be between -9 and 0 dBFS"))
+		}
+		if conf.Loudness.MaxGain < 0 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("loudness max_gain cannot be negative"))
+		}
+	}
+
+	if conf.Preview != nil {
+		if conf.Preview.Delay < 0 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("preview delay cannot be negative"))
+		}
+		if conf.Preview.Delay == 0 {
+			conf.Preview.Delay = defaultPreviewDelay
+		}
+		if conf.Preview.Quality < 0 || conf.Preview.Quality > 100 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("preview quality must be between 1 and 100"))
+		}
+		if conf.Preview.Quality == 0 {
+			conf.Preview.Quality = defaultPreviewQuality
+		}
+	}
+
+	renditions := make(map[string]bool)
+	for _, r := range conf.HLSLadder {
+		if r.Name == "" || strings.ContainsAny(r.Name, "/. ") {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("hls_ladder name %q invalid", r.Name))
+		}
+		if renditions[r.Name] {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("hls_ladder name %s used more than once", r.Name))
+		}
+		renditions[r.Name] = true
+		if r.Width <= 0 || r.Height <= 0 || r.Width%2 != 0 || r.Height%2 != 0 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("hls_ladder %s width and height must be positive and even", r.Name))
+		}
+		if r.VideoBitrate <= 0 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("hls_ladder %s video_bitrate required", r.Name))
+		}
+	}
+
+	if conf.AlternateAudio != nil {
+		if conf.AlternateAudio.Language == "" {
+			conf.AlternateAudio.Language = defaultMainAudioLanguage
+		}
+		if conf.AlternateAudio.Name == "" {
+			conf.AlternateAudio.Name = defaultMainAudioName
+		}
+		languages := map[string]bool{conf.AlternateAudio.Language: true}
+		for i := range conf.AlternateAudio.Tracks {
+			t := &conf.AlternateAudio.Tracks[i]
+			if !languageCodeRegexp.MatchString(t.Language) {
+				return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("alternate_audio language %q invalid", t.Language))
+			}
+			if languages[t.Language] {
+				return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("alternate_audio language %s used more than once", t.Language))
+			}
+			languages[t.Language] = true
+			if t.ParticipantIdentity == "" {
+				return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("alternate_audio %s participant_identity required", t.Language))
+			}
+			if t.Name == "" {
+				t.Name = t.Language
+			}
+		}
+	}
+
+	if conf.CBR != nil {
+		if conf.CBR.VBVBuffer < 0 || conf.CBR.VBVBuffer > maxCBRVBVBuffer {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("cbr vbv_buffer must be between 0 and %s", maxCBRVBVBuffer))
+		}
+		if conf.CBR.VBVBuffer == 0 {
+			conf.CBR.VBVBuffer = defaultCBRVBVBuffer
+		}
+		if conf.CBR.MuxOverhead < 0 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("cbr mux_overhead cannot be negative"))
+		}
+		if conf.CBR.MuxOverhead == 0 {
+			conf.CBR.MuxOverhead = defaultCBRMuxOverhead
+		}
+	}
+
+	if conf.RTMPReconnect != nil {
+		if err := conf.RTMPReconnect.validate(); err != nil {
+			return nil, errors.ErrCouldNotParseConfig(err)
+		}
+	}
+
+	if conf.S3Multipart != nil {
+		if conf.S3Multipart.PartSize == 0 {
+			conf.S3Multipart.PartSize = defaultS3PartSize
+		} else if conf.S3Multipart.PartSize < minS3PartSize {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("s3_multipart part_size must be at least %d MB", minS3PartSize))
+		}
+		if conf.S3Multipart.Concurrency <= 0 {
+			conf.S3Multipart.Concurrency = defaultS3Concurrency
+		}
+	}
+
+	if conf.AliOSS != nil && (conf.AliOSS.PartSize < 0 || conf.AliOSS.Concurrency < 0) {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("alioss part_size and concurrency cannot be negative"))
+	}
+
+	if conf.S3SSE != nil {
+		switch conf.S3SSE.Type {
+		case S3SSETypeS3:
+			if conf.S3SSE.KMSKeyID != "" {
+				return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("s3_sse kms_key_id requires type %s", S3SSETypeKMS))
+			}
+		case S3SSETypeKMS:
+		default:
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("s3_sse type must be %s or %s", S3SSETypeS3, S3SSETypeKMS))
+		}
+	}
+
+	roleBuckets := make(map[string]bool)
+	for i := range conf.S3AssumeRole {
+		role := &conf.S3AssumeRole[i]
+		if role.RoleARN == "" {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("s3_assume_role role_arn required"))
+		}
+		if roleBuckets[role.Bucket] {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("s3_assume_role bucket %q used more than once", role.Bucket))
+		}
+		roleBuckets[role.Bucket] = true
+		if role.SessionName == "" {
+			role.SessionName = defaultS3RoleSessionName
+		}
+		if role.Duration <= 0 {
+			role.Duration = defaultS3RoleDuration
+		}
+	}
+
+	if conf.S3Object != nil {
+		if conf.S3Object.StorageClass != "" && !s3StorageClasses[conf.S3Object.StorageClass] {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("unknown s3_object storage_class %s", conf.S3Object.StorageClass))
+		}
+		if conf.S3Object.ACL != "" && !s3CannedACLs[conf.S3Object.ACL] {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("unknown s3_object acl %s", conf.S3Object.ACL))
+		}
+	}
+
+	if conf.LowLatencyHLS != nil {
+		if conf.LowLatencyHLS.PartDuration < 0 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("low_latency_hls part_duration cannot be negative"))
+		}
+		if conf.LowLatencyHLS.PartDuration == 0 {
+			conf.LowLatencyHLS.PartDuration = defaultPartDuration
+		}
+	}
+
+	if conf.Clock != nil {
+		if (conf.Clock.NTPServer == "") == (conf.Clock.PTPDevice == "") {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("clock requires either ntp_server or ptp_device"))
+		}
+		if conf.Clock.PTPUTCOffset == 0 {
+			conf.Clock.PTPUTCOffset = defaultPTPUTCOffset
+		}
+		if conf.Clock.SyncInterval <= 0 {
+			conf.Clock.SyncInterval = defaultClockSyncInterval
+		}
+	}
+
+	if conf.NetworkStats != nil {
+		if conf.NetworkStats.Interval < 0 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("network_stats interval cannot be negative"))
+		}
+		if conf.NetworkStats.Interval == 0 {
+			conf.NetworkStats.Interval = defaultNetworkStatsInterval
+		}
+		if conf.NetworkStats.LossThreshold < 0 || conf.NetworkStats.LossThreshold > 1 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("network_stats loss_threshold must be between 0 and 1"))
+		}
+		if conf.NetworkStats.LossThreshold == 0 {
+			conf.NetworkStats.LossThreshold = defaultNetworkStatsLossThreshold
+		}
+	}
+
+	if conf.FileIndex != nil {
+		if conf.FileIndex.Interval < 0 || conf.FileIndex.UpdateInterval < 0 {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("file_index intervals cannot be negative"))
+		}
+		if conf.FileIndex.Interval == 0 {
+			conf.FileIndex.Interval = defaultFileIndexInterval
+		}
+		if conf.FileIndex.UpdateInterval == 0 {
+			conf.FileIndex.UpdateInterval = defaultFileIndexUpdateInterval
+		}
+	}
+
+	if conf.Telemetry != nil {
+		if conf.Telemetry.Endpoint == "" {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("telemetry endpoint required"))
+		}
+		if conf.Telemetry.ServiceName == "" {
+			conf.Telemetry.ServiceName = defaultTelemetryServiceName
+		}
+		if conf.Telemetry.MetricsInterval <= 0 {
+			conf.Telemetry.MetricsInterval = defaultTelemetryMetricsInterval
+		}
+	}
+
+	if conf.Profiling != nil {
+		if conf.Profiling.Interval <= 0 {
+			conf.Profiling.Interval = defaultProfilingInterval
+		}
+		if conf.Profiling.CPUDuration <= 0 {
+			conf.Profiling.CPUDuration = defaultProfilingCPUDuration
+		}
+		if conf.Profiling.CPUDuration >= conf.Profiling.Interval {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("profiling cpu_duration must be less than interval"))
+		}
+		if len(conf.Profiling.Profiles) == 0 {
+			conf.Profiling.Profiles = []string{"cpu", "heap"}
+		}
+		for _, profile := range conf.Profiling.Profiles {
+			switch profile {
+			case "cpu", "heap", "allocs", "goroutine", "block", "mutex", "threadcreate":
+			default:
+				return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid profile %s", profile))
+			}
+		}
+		if conf.Profiling.StoragePrefix == "" {
+			conf.Profiling.StoragePrefix = defaultProfilingStoragePrefix
+		}
+		if conf.Profiling.PyroscopeURL == "" && conf.GetDefaultUploadConfig() == nil {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("profiling requires storage or pyroscope_url"))
+		}
+	}
+
 	if conf.TemplateBase == "" {
 		conf.TemplateBase = fmt.Sprintf(defaultTemplateBaseTemplate, conf.TemplatePort)
 	}
 
+	if conf.Local != nil {
+		if conf.Local.Directory == "" {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("local upload directory required"))
+		}
+		if info, err := os.Stat(conf.Local.Directory); err != nil || !info.IsDir() {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid local upload directory %s", conf.Local.Directory))
+		}
+	}
+
+	conf.ScratchDirectory = path.Clean(conf.ScratchDirectory)
+	if conf.ScratchDirectory == "." {
+		conf.ScratchDirectory = os.TempDir()
+	}
+	if conf.SDKReconnect < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid sdk_reconnect %s", conf.SDKReconnect))
+	}
+
+	if conf.ScratchQuota < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid scratch_quota %d", conf.ScratchQuota))
+	}
+
 	conf.LocalOutputDirectory = path.Clean(conf.LocalOutputDirectory)
 	if conf.LocalOutputDirectory == "." {
-		conf.LocalOutputDirectory = os.TempDir()
+		conf.LocalOutputDirectory = conf.ScratchDirectory
+	}
+
+	if conf.UploadSpool != nil {
+		if conf.UploadSpool.Directory == "" {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("upload_spool directory is required"))
+		}
+		if path.Clean(conf.UploadSpool.Directory) == conf.LocalOutputDirectory {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("upload_spool directory cannot be the local_directory"))
+		}
+		if conf.UploadSpool.RetryInterval <= 0 {
+			conf.UploadSpool.RetryInterval = defaultUploadSpoolRetryInterval
+		}
 	}
 
 	if err := conf.initLogger("nodeID", conf.NodeID, "clusterID", conf.ClusterID); err != nil {
@@ -87,3 +954,40 @@ func NewServiceConfig(confString string) (*ServiceConfig, error) {
 
 	return conf, nil
 }
+
+// validateHandlerBinaries defaults each fraction to 1, and checks that the fractions of the binaries matching
+// each request type add up to at most 1, since a single draw picks between them
+func validateHandlerBinaries(binaries []HandlerBinaryConfig) error {
+	totals := make(map[string]float64)
+	for i := range binaries {
+		b := &binaries[i]
+		if b.Path == "" {
+			return fmt.Errorf("handler binary path required")
+		}
+		for _, requestType := range b.RequestTypes {
+			switch requestType {
+			case "room_composite", "web", "track_composite", "track":
+			default:
+				return fmt.Errorf("invalid handler binary request type %s", requestType)
+			}
+		}
+		if b.Fraction < 0 || b.Fraction > 1 {
+			return fmt.Errorf("invalid handler binary fraction %v", b.Fraction)
+		}
+		if b.Fraction == 0 {
+			b.Fraction = 1
+		}
+
+		requestTypes := b.RequestTypes
+		if len(requestTypes) == 0 {
+			requestTypes = []string{"room_composite", "web", "track_composite", "track"}
+		}
+		for _, requestType := range requestTypes {
+			// allows for rounding, such as 0.1 + 0.2 + 0.7
+			if totals[requestType] += b.Fraction; totals[requestType] > 1+1e-9 {
+				return fmt.Errorf("handler binary fractions for %s requests add up to more than 1", requestType)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ParseColor converts an #RRGGBB color into the ARGB value used by videotestsrc
+func ParseColor(color string) (uint32, error) {
+	hex := strings.TrimPrefix(color, "#")
+	if len(hex) != 6 {
+		return 0, fmt.Errorf("invalid color %s, expected #RRGGBB", color)
+	}
+
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid color %s, expected #RRGGBB", color)
+	}
+
+	return 0xff000000 | uint32(rgb), nil
+}
+
+// SlateDecoder returns the element used to decode a slate image
+func SlateDecoder(image string) (string, error) {
+	switch strings.ToLower(path.Ext(image)) {
+	case ".png":
+		return "pngdec", nil
+	case ".jpg", ".jpeg":
+		return "jpegdec", nil
+	default:
+		return "", fmt.Errorf("invalid slate image %s, must be png or jpeg", image)
+	}
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var timecodeRegexp = regexp.MustCompile(`^(\d{2}):(\d{2}):(\d{2})[:;](\d{2})$`)
+
+// ParseTimecode converts an SMPTE timecode (HH:MM:SS:FF) into a frame count
+func ParseTimecode(timecode string, framerate int32) (int, error) {
+	match := timecodeRegexp.FindStringSubmatch(timecode)
+	if match == nil {
+		return 0, fmt.Errorf("invalid timecode %s, expected HH:MM:SS:FF", timecode)
+	}
+
+	var parts [4]int
+	for i := range parts {
+		parts[i], _ = strconv.Atoi(match[i+1])
+	}
+	hours, minutes, seconds, frames := parts[0], parts[1], parts[2], parts[3]
+	if hours > 23 || minutes > 59 || seconds > 59 {
+		return 0, fmt.Errorf("invalid timecode %s", timecode)
+	}
+	if framerate > 0 && frames >= int(framerate) {
+		return 0, fmt.Errorf("invalid timecode %s, frames must be less than %d", timecode, framerate)
+	}
+
+	return ((hours*60+minutes)*60+seconds)*int(framerate) + frames, nil
+}
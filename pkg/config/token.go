@@ -0,0 +1,51 @@
+package config
+
+import (
+	"time"
+
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/auth"
+)
+
+const egressTokenTTL = time.Hour * 24
+
+// mintTemplateToken returns true if the room composite template should join with a token minted by the egress
+func (p *PipelineConfig) mintTemplateToken(requestToken string) bool {
+	if p.TemplateToken == nil || p.SourceType != types.SourceTypeWeb {
+		return false
+	}
+	return p.TemplateToken.Policy == TemplateTokenAlways || requestToken == ""
+}
+
+// buildToken returns a token which can only subscribe to a single room, as a recorder
+func (p *PipelineConfig) buildToken(ttl time.Duration) (string, error) {
+	f := false
+	t := true
+	grant := &auth.VideoGrant{
+		RoomJoin:             true,
+		Room:                 p.Info.RoomName,
+		CanSubscribe:         &t,
+		CanPublish:           &f,
+		CanPublishData:       &f,
+		CanUpdateOwnMetadata: &f,
+		Hidden:               true,
+		Recorder:             true,
+	}
+
+	at := auth.NewAccessToken(p.ApiKey, p.ApiSecret).
+		SetIdentity(p.Info.EgressId).
+		SetValidFor(ttl)
+
+	if p.Participant != nil {
+		at.SetIdentity(stringReplace(p.Participant.Identity, map[string]string{
+			"{egress_id}": p.Info.EgressId,
+			"{room_name}": p.Info.RoomName,
+			"{node_id}":   p.NodeID,
+		}))
+		at.SetName(p.Participant.Name)
+		at.SetMetadata(p.Participant.Metadata)
+		grant.Hidden = !p.Participant.Visible
+	}
+
+	return at.AddGrant(grant).ToJWT()
+}
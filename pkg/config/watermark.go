@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	WatermarkTopLeft     = "top-left"
+	WatermarkTopRight    = "top-right"
+	WatermarkBottomLeft  = "bottom-left"
+	WatermarkBottomRight = "bottom-right"
+)
+
+func (w *WatermarkConfig) validate() error {
+	if w.Image == "" {
+		return fmt.Errorf("watermark image is required")
+	}
+	if _, err := SlateDecoder(w.ImageName()); err != nil {
+		return fmt.Errorf("invalid watermark image %s, must be png or jpeg", w.Image)
+	}
+
+	switch w.Position {
+	case "":
+		w.Position = WatermarkBottomRight
+	case WatermarkTopLeft, WatermarkTopRight, WatermarkBottomLeft, WatermarkBottomRight:
+	default:
+		return fmt.Errorf("watermark position must be top-left, top-right, bottom-left, or bottom-right")
+	}
+
+	if w.Opacity < 0 || w.Opacity > 1 {
+		return fmt.Errorf("watermark opacity must be between 0 and 1")
+	}
+	if w.Opacity == 0 {
+		w.Opacity = defaultWatermarkOpacity
+	}
+	if w.Margin < 0 {
+		return fmt.Errorf("watermark margin cannot be negative")
+	}
+	if w.Margin == 0 {
+		w.Margin = defaultWatermarkMargin
+	}
+	if w.Width < 0 {
+		return fmt.Errorf("watermark width cannot be negative")
+	}
+
+	return nil
+}
+
+// IsRemote returns true if the image needs to be downloaded
+func (w *WatermarkConfig) IsRemote() bool {
+	return strings.HasPrefix(w.Image, "http://") || strings.HasPrefix(w.Image, "https://")
+}
+
+// ImageName returns the image filename, without any url query
+func (w *WatermarkConfig) ImageName() string {
+	if w.IsRemote() {
+		if u, err := url.Parse(w.Image); err == nil {
+			return path.Base(u.Path)
+		}
+	}
+	return path.Base(w.Image)
+}
+
+// Offsets returns the overlay offsets from the nearest edges. Negative values are measured from the right and bottom.
+func (w *WatermarkConfig) Offsets() (x, y int) {
+	x, y = w.Margin, w.Margin
+	switch w.Position {
+	case WatermarkTopRight:
+		x = -x
+	case WatermarkBottomLeft:
+		y = -y
+	case WatermarkBottomRight:
+		x, y = -x, -y
+	}
+	return x, y
+}
@@ -0,0 +1,192 @@
+// Package encryption implements the envelope format used to encrypt outputs before upload.
+//
+// Each file gets a random AES-256 key, wrapped with the configured RSA public key (OAEP, SHA-256).
+// The file is then sealed with AES-GCM in 64KiB chunks, using a counter nonce whose last byte marks
+// the final chunk, so that truncated or reordered files fail to decrypt.
+//
+//	magic (6 bytes) | wrapped key length (uint16) | wrapped key | chunks...
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	chunkSize      = 64 * 1024
+	keySize        = 32
+	aesGCMOverhead = 16
+)
+
+var magic = []byte("LKENC1")
+
+var ErrInvalidFile = errors.New("invalid or truncated encrypted file")
+
+// ParsePublicKey parses a PEM encoded RSA public key (PKIX or PKCS#1)
+func ParsePublicKey(s string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("public key must be PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key must be an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// ParsePrivateKey parses a PEM encoded RSA private key (PKCS#8 or PKCS#1)
+func ParsePrivateKey(s string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("private key must be PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key must be an RSA key")
+	}
+	return rsaKey, nil
+}
+
+func Encrypt(dst io.Writer, src io.Reader, publicKey *rsa.PublicKey) error {
+	fileKey := make([]byte, keySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return err
+	}
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, fileKey, magic)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, len(magic)+2, len(magic)+2+len(wrapped))
+	copy(header, magic)
+	binary.BigEndian.PutUint16(header[len(magic):], uint16(len(wrapped)))
+	header = append(header, wrapped...)
+	if _, err = dst.Write(header); err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(fileKey)
+	if err != nil {
+		return err
+	}
+
+	// read one byte ahead, so the final chunk can be marked
+	r := bufio.NewReaderSize(src, chunkSize+1)
+	buf := make([]byte, chunkSize)
+	var out []byte
+	for counter := uint64(0); ; counter++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		final := n < chunkSize
+		if !final {
+			if _, peekErr := r.Peek(1); peekErr == io.EOF {
+				final = true
+			}
+		}
+
+		out = aead.Seal(out[:0], nonce(counter, final), buf[:n], nil)
+		if _, err = dst.Write(out); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+func Decrypt(dst io.Writer, src io.Reader, privateKey *rsa.PrivateKey) error {
+	r := bufio.NewReaderSize(src, chunkSize+aesGCMOverhead+1)
+
+	header := make([]byte, len(magic)+2)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(magic)]) != string(magic) {
+		return ErrInvalidFile
+	}
+	wrapped := make([]byte, binary.BigEndian.Uint16(header[len(magic):]))
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return ErrInvalidFile
+	}
+
+	fileKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, wrapped, magic)
+	if err != nil {
+		return fmt.Errorf("could not unwrap file key: %w", err)
+	}
+
+	aead, err := newAEAD(fileKey)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, chunkSize+aesGCMOverhead)
+	var out []byte
+	for counter := uint64(0); ; counter++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return ErrInvalidFile
+		}
+
+		final := n < len(buf)
+		if !final {
+			if _, peekErr := r.Peek(1); peekErr == io.EOF {
+				final = true
+			}
+		}
+
+		out, err = aead.Open(out[:0], nonce(counter, final), buf[:n], nil)
+		if err != nil {
+			return ErrInvalidFile
+		}
+		if _, err = dst.Write(out); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func nonce(counter uint64, final bool) []byte {
+	n := make([]byte, 12)
+	binary.BigEndian.PutUint64(n[3:11], counter)
+	if final {
+		n[11] = 1
+	}
+	return n
+}
@@ -0,0 +1,43 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryption(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PUBLIC KEY",
+		Bytes: x509.MarshalPKCS1PublicKey(&privateKey.PublicKey),
+	}))
+	publicKey, err := ParsePublicKey(publicPEM)
+	require.NoError(t, err)
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, 3*chunkSize + 100} {
+		plaintext := make([]byte, size)
+		_, err = rand.Read(plaintext)
+		require.NoError(t, err)
+
+		encrypted := &bytes.Buffer{}
+		require.NoError(t, Encrypt(encrypted, bytes.NewReader(plaintext), publicKey))
+
+		decrypted := &bytes.Buffer{}
+		require.NoError(t, Decrypt(decrypted, bytes.NewReader(encrypted.Bytes()), privateKey))
+		require.True(t, bytes.Equal(plaintext, decrypted.Bytes()))
+
+		// dropping the final chunk is detected
+		if size > chunkSize {
+			truncated := encrypted.Bytes()[:encrypted.Len()-100-aesGCMOverhead]
+			require.ErrorIs(t, Decrypt(&bytes.Buffer{}, bytes.NewReader(truncated), privateKey), ErrInvalidFile)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package errors
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/livekit/psrpc"
+)
+
+// FailureCause tells whether a failed egress was caused by its request or by the node running it,
+// so that billing can exempt system failures and operators can alert on system failure rates
+type FailureCause string
+
+const (
+	FailureCauseUser    FailureCause = "user"
+	FailureCauseSystem  FailureCause = "system"
+	FailureCauseUnknown FailureCause = "unknown"
+)
+
+// GetFailureCause classifies an error by its psrpc code. Errors without a code, such as
+// panics or gstreamer failures, are system failures.
+func GetFailureCause(err error) FailureCause {
+	var psrpcErr psrpc.Error
+	if !errors.As(err, &psrpcErr) {
+		return FailureCauseSystem
+	}
+
+	switch psrpcErr.Code() {
+	case psrpc.InvalidArgument,
+		psrpc.MalformedRequest,
+		psrpc.NotFound,
+		psrpc.NotAcceptable,
+		psrpc.AlreadyExists,
+		psrpc.PermissionDenied,
+		psrpc.OutOfRange,
+		psrpc.Unauthenticated:
+		return FailureCauseUser
+	case psrpc.Unknown:
+		return FailureCauseUnknown
+	default:
+		return FailureCauseSystem
+	}
+}
+
+var (
+	// the destination refused the connection or the stream
+	streamDestinationFailures = []string{
+		"connection refused", "could not resolve", "failed to resolve", "no such host", "name or service not known",
+		"rejected", "unauthorized", "forbidden", "stream not found", "bad stream key", "invalid url", "bad uri",
+	}
+	// the network between the node and the destination failed
+	streamNetworkFailures = []string{
+		"timed out", "timeout", "connection reset", "broken pipe", "network is unreachable", "closed by peer",
+	}
+)
+
+// ErrStreamFailed classifies a failed stream by its underlying error. Failures of the destination are user errors,
+// of the network to it unknown, and any other, such as a muxer failure, system errors
+func ErrStreamFailed(err error) error {
+	var psrpcErr psrpc.Error
+	if errors.As(err, &psrpcErr) {
+		return err
+	}
+
+	msg := strings.ToLower(err.Error())
+	if d, ok := err.(interface{ DebugString() string }); ok {
+		// gstreamer errors only have the reason in their debug info
+		msg += " " + strings.ToLower(d.DebugString())
+	}
+
+	switch {
+	case containsAny(msg, streamDestinationFailures):
+		return psrpc.NewError(psrpc.InvalidArgument, err)
+	case containsAny(msg, streamNetworkFailures):
+		return psrpc.NewError(psrpc.Unknown, err)
+	default:
+		return psrpc.NewError(psrpc.Internal, err)
+	}
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package errors
 import (
 	"errors"
 	"fmt"
+	"runtime/debug"
 	"strings"
 
 	"github.com/livekit/psrpc"
@@ -15,9 +16,11 @@ var (
 	ErrStreamAlreadyExists        = psrpc.NewErrorf(psrpc.AlreadyExists, "stream already exists")
 	ErrNonStreamingPipeline       = psrpc.NewErrorf(psrpc.InvalidArgument, "UpdateStream called on non-streaming egress")
 	ErrEgressNotFound             = psrpc.NewErrorf(psrpc.NotFound, "egress not found")
+	ErrEgressEnding               = psrpc.NewErrorf(psrpc.FailedPrecondition, "egress is ending")
 	ErrProfileNotFound            = psrpc.NewErrorf(psrpc.NotFound, "profile not found")
 	ErrNoCompatibleCodec          = psrpc.NewErrorf(psrpc.InvalidArgument, "no supported codec is compatible with all outputs")
 	ErrNoCompatibleFileOutputType = psrpc.NewErrorf(psrpc.InvalidArgument, "no supported file output type is compatible with the selected codecs")
+	ErrNoFrames                   = psrpc.NewErrorf(psrpc.Internal, "no frames from display capture")
 )
 
 func New(err string) error {
@@ -54,6 +57,47 @@ func IsFatal(err error) bool {
 	return errors.As(err, &e)
 }
 
+// RetryableError is caused by a node-local resource issue, and the request may succeed on another node
+type RetryableError struct {
+	err error
+}
+
+func (e *RetryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.err
+}
+
+func Retryable(err error) error {
+	return &RetryableError{err}
+}
+
+func IsRetryable(err error) bool {
+	e := &RetryableError{}
+
+	return errors.As(err, &e)
+}
+
+// PanicError is created from a recovered panic, and holds the stack of the panicking goroutine
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// NewPanicError must be called from the deferred function which recovered the panic
+func NewPanicError(value interface{}) *PanicError {
+	return &PanicError{
+		Value: value,
+		Stack: debug.Stack(),
+	}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
 func ErrCouldNotParseConfig(err error) error {
 	return psrpc.NewErrorf(psrpc.InvalidArgument, "could not parse config: %v", err)
 }
@@ -66,6 +110,23 @@ func ErrIncompatible(format, codec interface{}) error {
 	return psrpc.NewErrorf(psrpc.InvalidArgument, "format %v incompatible with codec %v", format, codec)
 }
 
+func ErrIncompatibleCodec(format, codec interface{}, allowed []string) error {
+	return psrpc.NewErrorf(psrpc.InvalidArgument, "format %v incompatible with codec %v, allowed: %s", format, codec, strings.Join(allowed, ", "))
+}
+
+func ErrInvalidRange(field string, value, min, max int32) error {
+	return psrpc.NewErrorf(psrpc.InvalidArgument, "request has invalid field %s: %d, must be between %d and %d", field, value, min, max)
+}
+
+func ErrInvalidValue(field string, value interface{}, allowed []string) error {
+	return psrpc.NewErrorf(psrpc.InvalidArgument, "request has invalid field %s: %v, allowed: %s", field, value, strings.Join(allowed, ", "))
+}
+
+func ErrIncompatibleHandler(handlerVersion string, protocolVersion, minProtocolVersion int32) error {
+	return psrpc.NewErrorf(psrpc.FailedPrecondition,
+		"handler %s (protocol %d, min %d) is incompatible with this service", handlerVersion, protocolVersion, minProtocolVersion)
+}
+
 func ErrInvalidInput(field string) error {
 	return psrpc.NewErrorf(psrpc.InvalidArgument, "request has missing or invalid field: %s", field)
 }
@@ -96,6 +157,11 @@ func ErrUploadFailed(location string, err error) error {
 	return psrpc.NewErrorf(psrpc.Unknown, "%s upload failed: %v", location, err)
 }
 
+// ErrUploadVetoed is returned when the upload hook rejects a file
+func ErrUploadVetoed(location string, reason string) error {
+	return psrpc.NewErrorf(psrpc.PermissionDenied, "%s upload vetoed by upload hook: %s", location, reason)
+}
+
 func ErrWebsocketClosed(addr string) error {
 	return psrpc.NewErrorf(psrpc.Internal, "websocket already closed: %s", addr)
 }
@@ -11,3 +11,46 @@ func TestFatalError(t *testing.T) {
 	assert.True(t, IsFatal(Fatal(ErrNoConfig)))
 	assert.Equal(t, ErrNoConfig, Fatal(ErrNoConfig).(*FatalError).Unwrap())
 }
+
+func TestPanicError(t *testing.T) {
+	var err error
+	func() {
+		defer func() {
+			err = NewPanicError(recover())
+		}()
+		panic("nil map")
+	}()
+
+	panicErr := &PanicError{}
+	assert.True(t, As(err, &panicErr))
+	assert.Equal(t, "panic: nil map", err.Error())
+	assert.Contains(t, string(panicErr.Stack), "TestPanicError")
+}
+
+func TestFailureCause(t *testing.T) {
+	assert.Equal(t, FailureCauseUser, GetFailureCause(ErrInvalidInput("room_name")))
+	assert.Equal(t, FailureCauseSystem, GetFailureCause(Fatal(ErrProcessStartFailed(New("no display")))))
+	assert.Equal(t, FailureCauseSystem, GetFailureCause(New("pipeline frozen")))
+	assert.Equal(t, FailureCauseUnknown, GetFailureCause(ErrUploadFailed("S3", New("timeout"))))
+}
+
+type debugError struct {
+	message string
+	debug   string
+}
+
+func (e *debugError) Error() string       { return e.message }
+func (e *debugError) DebugString() string { return e.debug }
+
+func TestStreamFailureCause(t *testing.T) {
+	assert.Equal(t, FailureCauseUser, GetFailureCause(ErrStreamFailed(New("bad stream key"))))
+	assert.Equal(t, FailureCauseUser, GetFailureCause(ErrStreamFailed(&debugError{
+		message: "Could not open resource for writing.",
+		debug:   "gstrtmp2sink.c(1074): gst_rtmp2_sink_task_func (): /GstPipeline:pipeline/GstRtmp2Sink:sink_0:\nFailed to connect: Connection refused",
+	})))
+	assert.Equal(t, FailureCauseUnknown, GetFailureCause(ErrStreamFailed(New("Connection timed out"))))
+	assert.Equal(t, FailureCauseSystem, GetFailureCause(ErrStreamFailed(New("Internal data stream error."))))
+
+	// errors which were already classified keep their cause
+	assert.Equal(t, FailureCauseUser, GetFailureCause(ErrStreamFailed(ErrInvalidUrl("rtmp://", "missing host"))))
+}
@@ -22,8 +22,14 @@ const _ = grpc.SupportPackageIsVersion7
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type EgressHandlerClient interface {
+	Handshake(ctx context.Context, in *HandshakeRequest, opts ...grpc.CallOption) (*HandshakeResponse, error)
 	GetPipelineDot(ctx context.Context, in *GstPipelineDebugDotRequest, opts ...grpc.CallOption) (*GstPipelineDebugDotResponse, error)
 	GetPProf(ctx context.Context, in *PProfRequest, opts ...grpc.CallOption) (*PProfResponse, error)
+	SetLogLevel(ctx context.Context, in *SetLogLevelRequest, opts ...grpc.CallOption) (*SetLogLevelResponse, error)
+	AddEgress(ctx context.Context, in *AddEgressRequest, opts ...grpc.CallOption) (*AddEgressResponse, error)
+	WaitEgress(ctx context.Context, in *WaitEgressRequest, opts ...grpc.CallOption) (*WaitEgressResponse, error)
+	GetFeatureFlags(ctx context.Context, in *FeatureFlagsRequest, opts ...grpc.CallOption) (*FeatureFlagsResponse, error)
+	UpdateOutputs(ctx context.Context, in *UpdateOutputsRequest, opts ...grpc.CallOption) (*UpdateOutputsResponse, error)
 }
 
 type egressHandlerClient struct {
@@ -34,6 +40,15 @@ func NewEgressHandlerClient(cc grpc.ClientConnInterface) EgressHandlerClient {
 	return &egressHandlerClient{cc}
 }
 
+func (c *egressHandlerClient) Handshake(ctx context.Context, in *HandshakeRequest, opts ...grpc.CallOption) (*HandshakeResponse, error) {
+	out := new(HandshakeResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/Handshake", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *egressHandlerClient) GetPipelineDot(ctx context.Context, in *GstPipelineDebugDotRequest, opts ...grpc.CallOption) (*GstPipelineDebugDotResponse, error) {
 	out := new(GstPipelineDebugDotResponse)
 	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/GetPipelineDot", in, out, opts...)
@@ -52,12 +67,63 @@ func (c *egressHandlerClient) GetPProf(ctx context.Context, in *PProfRequest, op
 	return out, nil
 }
 
+func (c *egressHandlerClient) SetLogLevel(ctx context.Context, in *SetLogLevelRequest, opts ...grpc.CallOption) (*SetLogLevelResponse, error) {
+	out := new(SetLogLevelResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/SetLogLevel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *egressHandlerClient) AddEgress(ctx context.Context, in *AddEgressRequest, opts ...grpc.CallOption) (*AddEgressResponse, error) {
+	out := new(AddEgressResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/AddEgress", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *egressHandlerClient) WaitEgress(ctx context.Context, in *WaitEgressRequest, opts ...grpc.CallOption) (*WaitEgressResponse, error) {
+	out := new(WaitEgressResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/WaitEgress", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *egressHandlerClient) GetFeatureFlags(ctx context.Context, in *FeatureFlagsRequest, opts ...grpc.CallOption) (*FeatureFlagsResponse, error) {
+	out := new(FeatureFlagsResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/GetFeatureFlags", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *egressHandlerClient) UpdateOutputs(ctx context.Context, in *UpdateOutputsRequest, opts ...grpc.CallOption) (*UpdateOutputsResponse, error) {
+	out := new(UpdateOutputsResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/UpdateOutputs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // EgressHandlerServer is the server API for EgressHandler service.
 // All implementations must embed UnimplementedEgressHandlerServer
 // for forward compatibility
 type EgressHandlerServer interface {
+	Handshake(context.Context, *HandshakeRequest) (*HandshakeResponse, error)
 	GetPipelineDot(context.Context, *GstPipelineDebugDotRequest) (*GstPipelineDebugDotResponse, error)
 	GetPProf(context.Context, *PProfRequest) (*PProfResponse, error)
+	SetLogLevel(context.Context, *SetLogLevelRequest) (*SetLogLevelResponse, error)
+	AddEgress(context.Context, *AddEgressRequest) (*AddEgressResponse, error)
+	WaitEgress(context.Context, *WaitEgressRequest) (*WaitEgressResponse, error)
+	GetFeatureFlags(context.Context, *FeatureFlagsRequest) (*FeatureFlagsResponse, error)
+	UpdateOutputs(context.Context, *UpdateOutputsRequest) (*UpdateOutputsResponse, error)
 	mustEmbedUnimplementedEgressHandlerServer()
 }
 
@@ -65,12 +131,30 @@ type EgressHandlerServer interface {
 type UnimplementedEgressHandlerServer struct {
 }
 
+func (UnimplementedEgressHandlerServer) Handshake(context.Context, *HandshakeRequest) (*HandshakeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Handshake not implemented")
+}
 func (UnimplementedEgressHandlerServer) GetPipelineDot(context.Context, *GstPipelineDebugDotRequest) (*GstPipelineDebugDotResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetPipelineDot not implemented")
 }
 func (UnimplementedEgressHandlerServer) GetPProf(context.Context, *PProfRequest) (*PProfResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetPProf not implemented")
 }
+func (UnimplementedEgressHandlerServer) SetLogLevel(context.Context, *SetLogLevelRequest) (*SetLogLevelResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetLogLevel not implemented")
+}
+func (UnimplementedEgressHandlerServer) AddEgress(context.Context, *AddEgressRequest) (*AddEgressResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddEgress not implemented")
+}
+func (UnimplementedEgressHandlerServer) WaitEgress(context.Context, *WaitEgressRequest) (*WaitEgressResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WaitEgress not implemented")
+}
+func (UnimplementedEgressHandlerServer) GetFeatureFlags(context.Context, *FeatureFlagsRequest) (*FeatureFlagsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFeatureFlags not implemented")
+}
+func (UnimplementedEgressHandlerServer) UpdateOutputs(context.Context, *UpdateOutputsRequest) (*UpdateOutputsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateOutputs not implemented")
+}
 func (UnimplementedEgressHandlerServer) mustEmbedUnimplementedEgressHandlerServer() {}
 
 // UnsafeEgressHandlerServer may be embedded to opt out of forward compatibility for this service.
@@ -84,6 +168,24 @@ func RegisterEgressHandlerServer(s grpc.ServiceRegistrar, srv EgressHandlerServe
 	s.RegisterService(&EgressHandler_ServiceDesc, srv)
 }
 
+func _EgressHandler_Handshake_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HandshakeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).Handshake(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/Handshake",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).Handshake(ctx, req.(*HandshakeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _EgressHandler_GetPipelineDot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(GstPipelineDebugDotRequest)
 	if err := dec(in); err != nil {
@@ -120,6 +222,96 @@ func _EgressHandler_GetPProf_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _EgressHandler_SetLogLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLogLevelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).SetLogLevel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/SetLogLevel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).SetLogLevel(ctx, req.(*SetLogLevelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EgressHandler_AddEgress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddEgressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).AddEgress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/AddEgress",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).AddEgress(ctx, req.(*AddEgressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EgressHandler_WaitEgress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WaitEgressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).WaitEgress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/WaitEgress",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).WaitEgress(ctx, req.(*WaitEgressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EgressHandler_GetFeatureFlags_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FeatureFlagsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).GetFeatureFlags(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/GetFeatureFlags",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).GetFeatureFlags(ctx, req.(*FeatureFlagsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EgressHandler_UpdateOutputs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateOutputsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).UpdateOutputs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/UpdateOutputs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).UpdateOutputs(ctx, req.(*UpdateOutputsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // EgressHandler_ServiceDesc is the grpc.ServiceDesc for EgressHandler service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -127,6 +319,10 @@ var EgressHandler_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "ipc.EgressHandler",
 	HandlerType: (*EgressHandlerServer)(nil),
 	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Handshake",
+			Handler:    _EgressHandler_Handshake_Handler,
+		},
 		{
 			MethodName: "GetPipelineDot",
 			Handler:    _EgressHandler_GetPipelineDot_Handler,
@@ -135,6 +331,26 @@ var EgressHandler_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetPProf",
 			Handler:    _EgressHandler_GetPProf_Handler,
 		},
+		{
+			MethodName: "SetLogLevel",
+			Handler:    _EgressHandler_SetLogLevel_Handler,
+		},
+		{
+			MethodName: "AddEgress",
+			Handler:    _EgressHandler_AddEgress_Handler,
+		},
+		{
+			MethodName: "WaitEgress",
+			Handler:    _EgressHandler_WaitEgress_Handler,
+		},
+		{
+			MethodName: "GetFeatureFlags",
+			Handler:    _EgressHandler_GetFeatureFlags_Handler,
+		},
+		{
+			MethodName: "UpdateOutputs",
+			Handler:    _EgressHandler_UpdateOutputs_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "ipc.proto",
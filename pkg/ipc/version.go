@@ -0,0 +1,18 @@
+package ipc
+
+const (
+	// ProtocolVersion is incremented whenever the service/handler interface changes
+	ProtocolVersion = 6
+
+	// SharedHandlerProtocolVersion is the first version where handlers can run additional track egresses
+	SharedHandlerProtocolVersion = 4
+
+	// MinProtocolVersion is the oldest version this binary can work with on the other side.
+	// Handlers built before the handshake existed report version 1.
+	MinProtocolVersion = 1
+)
+
+// IsCompatible checks the versions reported by the other side of the handshake
+func IsCompatible(protocolVersion, minProtocolVersion int32) bool {
+	return protocolVersion >= MinProtocolVersion && minProtocolVersion <= ProtocolVersion
+}
@@ -0,0 +1,211 @@
+package logging
+
+import (
+	"fmt"
+	"sync"
+
+	"go.uber.org/atomic"
+
+	"github.com/livekit/protocol/logger"
+)
+
+const (
+	Source = "source"
+	Sink   = "sink"
+	Upload = "upload"
+	IPC    = "ipc"
+)
+
+var Subsystems = []string{Source, Sink, Upload, IPC}
+
+type level int32
+
+const (
+	levelDebug level = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = map[string]level{
+	"debug": levelDebug,
+	"info":  levelInfo,
+	"warn":  levelWarn,
+	"error": levelError,
+}
+
+type subsystem struct {
+	level          atomic.Int32
+	sampleInterval atomic.Uint64
+	sampleCounts   sync.Map
+}
+
+var (
+	defaultLevel atomic.Int32
+	subsystems   = make(map[string]*subsystem)
+)
+
+func init() {
+	defaultLevel.Store(int32(levelInfo))
+	for _, name := range Subsystems {
+		s := &subsystem{}
+		s.level.Store(-1)
+		subsystems[name] = s
+	}
+}
+
+// NewLogger builds the root logger. The underlying logger always logs at debug level,
+// so that subsystem levels can be raised at runtime above the default level.
+func NewLogger(conf logger.Config, levels map[string]string, sampling map[string]uint64) (logger.Logger, error) {
+	l, ok := levelNames[conf.Level]
+	if !ok && conf.Level != "" {
+		return nil, fmt.Errorf("invalid log level %s", conf.Level)
+	}
+	if conf.Level == "" {
+		l = levelInfo
+	}
+	defaultLevel.Store(int32(l))
+
+	for name, lvl := range levels {
+		if err := SetLevel(name, lvl); err != nil {
+			return nil, err
+		}
+	}
+	for name, interval := range sampling {
+		if err := SetSampleInterval(name, interval); err != nil {
+			return nil, err
+		}
+	}
+
+	conf.Level = "debug"
+	zl, err := logger.NewZapLogger(&conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// the wrapper adds a frame between the caller and the zap logger
+	return &levelLogger{Logger: zl.WithCallDepth(1)}, nil
+}
+
+// Configure sets both the level and sample interval of a subsystem
+func Configure(name, lvl string, sampleInterval uint64) error {
+	if err := SetLevel(name, lvl); err != nil {
+		return err
+	}
+	return SetSampleInterval(name, sampleInterval)
+}
+
+// SetLevel changes the level of a subsystem. An empty level resets it to the default level.
+func SetLevel(name, lvl string) error {
+	s, ok := subsystems[name]
+	if !ok {
+		return fmt.Errorf("invalid log subsystem %s", name)
+	}
+	if lvl == "" {
+		s.level.Store(-1)
+		return nil
+	}
+	l, ok := levelNames[lvl]
+	if !ok {
+		return fmt.Errorf("invalid log level %s", lvl)
+	}
+	s.level.Store(int32(l))
+	return nil
+}
+
+// SetSampleInterval only logs one in every interval repeated debug messages of a subsystem. 0 or 1 disables sampling.
+func SetSampleInterval(name string, interval uint64) error {
+	s, ok := subsystems[name]
+	if !ok {
+		return fmt.Errorf("invalid log subsystem %s", name)
+	}
+	s.sampleInterval.Store(interval)
+	return nil
+}
+
+// Logger returns a logger for the given subsystem, which should be one of Subsystems
+func Logger(name string) logger.Logger {
+	var l logger.Logger
+	if root, ok := logger.GetLogger().(*levelLogger); ok {
+		l = root.Logger
+	} else {
+		// not created by NewLogger, account for the wrapper frame
+		l = logger.GetLogger().WithCallDepth(1)
+	}
+
+	return &levelLogger{
+		Logger:    l.WithName(name),
+		subsystem: subsystems[name],
+	}
+}
+
+type levelLogger struct {
+	logger.Logger
+	subsystem *subsystem
+}
+
+func (l *levelLogger) enabled(lvl level) bool {
+	min := defaultLevel.Load()
+	if l.subsystem != nil {
+		if s := l.subsystem.level.Load(); s >= 0 {
+			min = s
+		}
+	}
+	return int32(lvl) >= min
+}
+
+func (l *levelLogger) sampled(msg string) bool {
+	if l.subsystem == nil {
+		return true
+	}
+	interval := l.subsystem.sampleInterval.Load()
+	if interval <= 1 {
+		return true
+	}
+	v, _ := l.subsystem.sampleCounts.LoadOrStore(msg, atomic.NewUint64(0))
+	return v.(*atomic.Uint64).Inc()%interval == 1
+}
+
+func (l *levelLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	if l.enabled(levelDebug) && l.sampled(msg) {
+		l.Logger.Debugw(msg, keysAndValues...)
+	}
+}
+
+func (l *levelLogger) Infow(msg string, keysAndValues ...interface{}) {
+	if l.enabled(levelInfo) {
+		l.Logger.Infow(msg, keysAndValues...)
+	}
+}
+
+func (l *levelLogger) Warnw(msg string, err error, keysAndValues ...interface{}) {
+	if l.enabled(levelWarn) {
+		l.Logger.Warnw(msg, err, keysAndValues...)
+	}
+}
+
+func (l *levelLogger) Errorw(msg string, err error, keysAndValues ...interface{}) {
+	if l.enabled(levelError) {
+		l.Logger.Errorw(msg, err, keysAndValues...)
+	}
+}
+
+func (l *levelLogger) WithValues(keysAndValues ...interface{}) logger.Logger {
+	return &levelLogger{Logger: l.Logger.WithValues(keysAndValues...), subsystem: l.subsystem}
+}
+
+func (l *levelLogger) WithName(name string) logger.Logger {
+	return &levelLogger{Logger: l.Logger.WithName(name), subsystem: l.subsystem}
+}
+
+func (l *levelLogger) WithCallDepth(depth int) logger.Logger {
+	return &levelLogger{Logger: l.Logger.WithCallDepth(depth), subsystem: l.subsystem}
+}
+
+func (l *levelLogger) WithItemSampler() logger.Logger {
+	return &levelLogger{Logger: l.Logger.WithItemSampler(), subsystem: l.subsystem}
+}
+
+func (l *levelLogger) WithoutSampler() logger.Logger {
+	return &levelLogger{Logger: l.Logger.WithoutSampler(), subsystem: l.subsystem}
+}
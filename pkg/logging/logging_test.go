@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubsystemLevels(t *testing.T) {
+	t.Cleanup(func() {
+		_ = Configure(Sink, "", 0)
+	})
+
+	l := &levelLogger{subsystem: subsystems[Sink]}
+	require.False(t, l.enabled(levelDebug))
+	require.True(t, l.enabled(levelInfo))
+
+	require.NoError(t, SetLevel(Sink, "debug"))
+	require.True(t, l.enabled(levelDebug))
+
+	require.NoError(t, SetLevel(Sink, "error"))
+	require.False(t, l.enabled(levelWarn))
+
+	require.NoError(t, SetLevel(Sink, ""))
+	require.True(t, l.enabled(levelInfo))
+
+	require.Error(t, SetLevel("pipeline", "debug"))
+	require.Error(t, SetLevel(Sink, "verbose"))
+}
+
+func TestSampling(t *testing.T) {
+	t.Cleanup(func() {
+		_ = Configure(Upload, "", 0)
+	})
+
+	l := &levelLogger{subsystem: subsystems[Upload]}
+	require.True(t, l.sampled("upload complete"))
+	require.True(t, l.sampled("upload complete"))
+
+	require.NoError(t, SetSampleInterval(Upload, 3))
+	logged := 0
+	for i := 0; i < 9; i++ {
+		if l.sampled("segment uploaded") {
+			logged++
+		}
+	}
+	require.Equal(t, 3, logged)
+}
@@ -0,0 +1,36 @@
+package input
+
+import (
+	"github.com/livekit/egress/pkg/config"
+)
+
+// buildAlternateAudio decodes and encodes each alternate audio track like the main audio, without loudness
+// normalization or qc analysis
+func (b *Bin) buildAlternateAudio(p *config.PipelineConfig) error {
+	for _, alt := range p.AlternateAudioTracks {
+		a := &AudioInput{name: "audio_" + alt.Language}
+		if err := a.buildSDKDecoder(p, alt.Src, alt.CodecParams); err != nil {
+			return err
+		}
+
+		if trimEnabled(p) {
+			trim, err := b.buildTrim(a.name+"_trim", p)
+			if err != nil {
+				return err
+			}
+			a.mixer = append(a.mixer, trim)
+		}
+
+		if p.AudioTranscoding {
+			if err := a.buildEncoder(p); err != nil {
+				return err
+			}
+		}
+
+		if err := a.addTo(b.bin); err != nil {
+			return err
+		}
+		b.alternateAudio = append(b.alternateAudio, a)
+	}
+	return nil
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/pion/webrtc/v3"
 	"github.com/tinyzimmer/go-gst/gst"
+	"github.com/tinyzimmer/go-gst/gst/app"
 
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
@@ -15,18 +17,22 @@ import (
 const audioMixerLatency = uint64(2e9)
 
 type AudioInput struct {
+	name string // element and pad name prefix
+
 	decoder []*gst.Element
 	testSrc []*gst.Element
 	mixer   []*gst.Element
 	encoder *gst.Element
+
+	comfortNoise *comfortNoise
 }
 
 func (b *Bin) buildAudioInput(p *config.PipelineConfig) error {
-	a := &AudioInput{}
+	a := &AudioInput{name: "audio"}
 
 	switch p.SourceType {
 	case types.SourceTypeSDK:
-		if err := a.buildSDKDecoder(p); err != nil {
+		if err := a.buildSDKDecoder(p, p.AudioSrc, p.AudioCodecParams); err != nil {
 			return err
 		}
 
@@ -36,33 +42,75 @@ func (b *Bin) buildAudioInput(p *config.PipelineConfig) error {
 		}
 	}
 
+	if trimEnabled(p) {
+		trim, err := b.buildTrim("audio_trim", p)
+		if err != nil {
+			return err
+		}
+		if a.mixer != nil {
+			a.mixer = append(a.mixer, trim)
+		} else {
+			a.decoder = append(a.decoder, trim)
+		}
+	}
+
+	if p.AudioTranscoding && p.Loudness != nil {
+		loudness, err := buildLoudness(p)
+		if err != nil {
+			return err
+		}
+		if a.mixer != nil {
+			a.mixer = append(a.mixer, loudness...)
+		} else {
+			a.decoder = append(a.decoder, loudness...)
+		}
+	}
+
+	if p.QCReport {
+		analysis, err := b.buildAudioAnalysis(p)
+		if err != nil {
+			return err
+		}
+		if a.mixer != nil {
+			a.mixer = append(a.mixer, analysis)
+		} else {
+			a.decoder = append(a.decoder, analysis)
+		}
+	}
+
 	if p.AudioTranscoding {
 		if err := a.buildEncoder(p); err != nil {
 			return err
 		}
 	}
 
-	// Add elements to bin
-	if err := b.bin.AddMany(a.decoder...); err != nil {
+	if err := a.addTo(b.bin); err != nil {
+		return err
+	}
+
+	b.audio = a
+	return nil
+}
+
+func (a *AudioInput) addTo(bin *gst.Bin) error {
+	if err := bin.AddMany(a.decoder...); err != nil {
 		return errors.ErrGstPipelineError(err)
 	}
 	if a.testSrc != nil {
-		if err := b.bin.AddMany(a.testSrc...); err != nil {
+		if err := bin.AddMany(a.testSrc...); err != nil {
 			return errors.ErrGstPipelineError(err)
 		}
 	}
 	if a.mixer != nil {
-		if err := b.bin.AddMany(a.mixer...); err != nil {
+		if err := bin.AddMany(a.mixer...); err != nil {
 			return errors.ErrGstPipelineError(err)
 		}
 	}
 	if a.encoder != nil {
-		if err := b.bin.Add(a.encoder); err != nil {
+		if err := bin.Add(a.encoder); err != nil {
 			return errors.ErrGstPipelineError(err)
 		}
 	}
-
-	b.audio = a
 	return nil
 }
 
@@ -105,7 +153,7 @@ func (a *AudioInput) Link() (*gst.GhostPad, error) {
 		srcPad = builder.GetSrcPad(a.decoder)
 	}
 
-	return gst.NewGhostPad("audio_src", srcPad), nil
+	return gst.NewGhostPad(fmt.Sprintf("%s_src", a.name), srcPad), nil
 }
 
 func (a *AudioInput) buildWebDecoder(p *config.PipelineConfig) error {
@@ -121,8 +169,7 @@ func (a *AudioInput) buildWebDecoder(p *config.PipelineConfig) error {
 	return a.addConverter(p)
 }
 
-func (a *AudioInput) buildSDKDecoder(p *config.PipelineConfig) error {
-	src := p.AudioSrc
+func (a *AudioInput) buildSDKDecoder(p *config.PipelineConfig, src *app.Source, codecParams webrtc.RTPCodecParameters) error {
 	src.Element.SetArg("format", "time")
 	if err := src.Element.SetProperty("is-live", true); err != nil {
 		return err
@@ -130,11 +177,11 @@ func (a *AudioInput) buildSDKDecoder(p *config.PipelineConfig) error {
 	a.decoder = []*gst.Element{src.Element}
 
 	switch {
-	case strings.EqualFold(p.AudioCodecParams.MimeType, string(types.MimeTypeOpus)):
+	case strings.EqualFold(codecParams.MimeType, string(types.MimeTypeOpus)):
 		if err := src.Element.SetProperty("caps", gst.NewCapsFromString(
 			fmt.Sprintf(
 				"application/x-rtp,media=audio,payload=%d,encoding-name=OPUS,clock-rate=%d",
-				p.AudioCodecParams.PayloadType, p.AudioCodecParams.ClockRate,
+				codecParams.PayloadType, codecParams.ClockRate,
 			),
 		)); err != nil {
 			return errors.ErrGstPipelineError(err)
@@ -153,7 +200,7 @@ func (a *AudioInput) buildSDKDecoder(p *config.PipelineConfig) error {
 		a.decoder = append(a.decoder, rtpOpusDepay, opusDec)
 
 	default:
-		return errors.ErrNotSupported(p.AudioCodecParams.MimeType)
+		return errors.ErrNotSupported(codecParams.MimeType)
 	}
 
 	if err := a.addConverter(p); err != nil {
@@ -164,7 +211,7 @@ func (a *AudioInput) buildSDKDecoder(p *config.PipelineConfig) error {
 }
 
 func (a *AudioInput) addConverter(p *config.PipelineConfig) error {
-	audioQueue, err := builder.BuildQueue("audio_input_queue", p.Latency, true)
+	audioQueue, err := builder.BuildQueue(fmt.Sprintf("%s_input_queue", a.name), p.Latency, true)
 	if err != nil {
 		return err
 	}
@@ -179,12 +226,32 @@ func (a *AudioInput) addConverter(p *config.PipelineConfig) error {
 		return errors.ErrGstPipelineError(err)
 	}
 
+	if p.AudioMixMatrix == "" {
+		capsFilter, err := getCapsFilter(p)
+		if err != nil {
+			return err
+		}
+
+		a.decoder = append(a.decoder, audioQueue, audioConvert, audioResample, capsFilter)
+		return nil
+	}
+
+	// the mix matrix maps both decoded channels to the output channels
+	stereoCaps, err := buildCapsFilter(p, 2)
+	if err != nil {
+		return err
+	}
+	mixConvert, err := gst.NewElementWithName("audioconvert", fmt.Sprintf("%s_channel_mix", a.name))
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	mixConvert.SetArg("mix-matrix", p.AudioMixMatrix)
 	capsFilter, err := getCapsFilter(p)
 	if err != nil {
 		return err
 	}
 
-	a.decoder = append(a.decoder, audioQueue, audioConvert, audioResample, capsFilter)
+	a.decoder = append(a.decoder, audioQueue, audioConvert, audioResample, stereoCaps, mixConvert, capsFilter)
 	return nil
 }
 
@@ -202,6 +269,9 @@ func (a *AudioInput) buildMixer(p *config.PipelineConfig) error {
 	if err = audioTestSrc.SetProperty("is-live", true); err != nil {
 		return errors.ErrGstPipelineError(err)
 	}
+	if p.ComfortNoise != nil && !p.VideoEnabled {
+		a.addComfortNoise(p, audioTestSrc)
+	}
 	audioCaps, err := getCapsFilter(p)
 	if err != nil {
 		return err
@@ -246,6 +316,23 @@ func (a *AudioInput) buildEncoder(p *config.PipelineConfig) error {
 		}
 		a.encoder = encoder
 
+	case types.MimeTypeMP3:
+		encoder, err := gst.NewElement("lamemp3enc")
+		if err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		// target bitrate, constant bitrate
+		if err = encoder.SetProperty("target", 1); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = encoder.SetProperty("bitrate", int(p.AudioBitrate)); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = encoder.SetProperty("cbr", true); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		a.encoder = encoder
+
 	case types.MimeTypeRawAudio:
 		return nil
 
@@ -257,15 +344,19 @@ func (a *AudioInput) buildEncoder(p *config.PipelineConfig) error {
 }
 
 func getCapsFilter(p *config.PipelineConfig) (*gst.Element, error) {
+	return buildCapsFilter(p, p.AudioChannels)
+}
+
+func buildCapsFilter(p *config.PipelineConfig, channels int32) (*gst.Element, error) {
 	var caps *gst.Caps
 	switch p.AudioOutCodec {
 	case types.MimeTypeOpus, types.MimeTypeRawAudio:
 		caps = gst.NewCapsFromString(
-			"audio/x-raw,format=S16LE,layout=interleaved,rate=48000,channels=2",
+			fmt.Sprintf("audio/x-raw,format=S16LE,layout=interleaved,rate=48000,channels=%d", channels),
 		)
-	case types.MimeTypeAAC:
+	case types.MimeTypeAAC, types.MimeTypeMP3:
 		caps = gst.NewCapsFromString(
-			fmt.Sprintf("audio/x-raw,format=S16LE,layout=interleaved,rate=%d,channels=2", p.AudioFrequency),
+			fmt.Sprintf("audio/x-raw,format=S16LE,layout=interleaved,rate=%d,channels=%d", p.AudioFrequency, channels),
 		)
 	default:
 		return nil, errors.ErrNotSupported(string(p.AudioOutCodec))
@@ -2,11 +2,14 @@ package input
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/tinyzimmer/go-gst/gst"
 
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/qc"
 	"github.com/livekit/protocol/tracer"
 )
 
@@ -15,6 +18,19 @@ type Bin struct {
 
 	audio *AudioInput
 	video *VideoInput
+
+	alternateAudio     []*AudioInput // in config order
+	alternateAudioPads []*gst.GhostPad
+
+	// in-pipeline analysis for qc reports
+	audioAnalyzer *qc.AudioAnalyzer
+	videoAnalyzer *qc.VideoAnalyzer
+	timeline      *qc.Timeline // mute periods, outages and packet loss, nil without a mute indicator, sdk reconnects or network stats
+	network       *qc.NetworkAnalyzer
+
+	trimEnded sync.Once
+	onTrimEnd func()
+	onPreview func(frame []byte, width, height int)
 }
 
 func New(ctx context.Context, pipeline *gst.Pipeline, p *config.PipelineConfig) (*Bin, error) {
@@ -24,11 +40,20 @@ func New(ctx context.Context, pipeline *gst.Pipeline, p *config.PipelineConfig)
 	b := &Bin{
 		bin: gst.NewBin("bin"),
 	}
+	if p.MuteIndicator != nil || p.SDKReconnect > 0 || p.NetworkStats != nil {
+		b.timeline = qc.NewTimeline(time.Now())
+	}
+	if p.NetworkStats != nil {
+		b.network = qc.NewNetworkAnalyzer(b.timeline, p.NetworkStats.LossThreshold)
+	}
 
 	if p.AudioEnabled {
 		if err := b.buildAudioInput(p); err != nil {
 			return nil, err
 		}
+		if err := b.buildAlternateAudio(p); err != nil {
+			return nil, err
+		}
 	}
 
 	if p.VideoEnabled {
@@ -44,7 +69,15 @@ func New(ctx context.Context, pipeline *gst.Pipeline, p *config.PipelineConfig)
 	return b, nil
 }
 
-func (b *Bin) Link() (audioPad, videoPad *gst.GhostPad, err error) {
+// FirstFrame is closed once display capture produces a frame. It is nil unless video comes from a web source
+func (b *Bin) FirstFrame() <-chan struct{} {
+	if b.video == nil || b.video.captured == nil {
+		return nil
+	}
+	return b.video.captured.Watch()
+}
+
+func (b *Bin) Link() (audioPad, videoPad, videoProxyPad *gst.GhostPad, err error) {
 	// link audio elements
 	if b.audio != nil {
 		audioPad, err = b.audio.Link()
@@ -56,10 +89,21 @@ func (b *Bin) Link() (audioPad, videoPad *gst.GhostPad, err error) {
 			return
 		}
 	}
+	for _, a := range b.alternateAudio {
+		var pad *gst.GhostPad
+		if pad, err = a.Link(); err != nil {
+			return
+		}
+		if !b.bin.AddPad(pad.Pad) {
+			err = errors.ErrGhostPadFailed
+			return
+		}
+		b.alternateAudioPads = append(b.alternateAudioPads, pad)
+	}
 
 	// link video elements
 	if b.video != nil {
-		videoPad, err = b.video.Link()
+		videoPad, videoProxyPad, err = b.video.Link()
 		if err != nil {
 			return
 		}
@@ -67,7 +111,30 @@ func (b *Bin) Link() (audioPad, videoPad *gst.GhostPad, err error) {
 			err = errors.ErrGhostPadFailed
 			return
 		}
+		if videoProxyPad != nil && !b.bin.AddPad(videoProxyPad.Pad) {
+			err = errors.ErrGhostPadFailed
+			return
+		}
+		for _, pad := range b.video.renditionPads {
+			if !b.bin.AddPad(pad.Pad) {
+				err = errors.ErrGhostPadFailed
+				return
+			}
+		}
 	}
 
 	return
 }
+
+// GetRenditionPads returns the encoded video of each hls rendition, once linked
+func (b *Bin) GetRenditionPads() []*gst.GhostPad {
+	if b.video == nil {
+		return nil
+	}
+	return b.video.renditionPads
+}
+
+// GetAlternateAudioPads returns the encoded audio of each alternate audio track, once linked
+func (b *Bin) GetAlternateAudioPads() []*gst.GhostPad {
+	return b.alternateAudioPads
+}
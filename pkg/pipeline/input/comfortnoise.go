@@ -0,0 +1,90 @@
+package input
+
+import (
+	"time"
+
+	"github.com/frostbyte73/core"
+	"github.com/tinyzimmer/go-gst/gst"
+	"go.uber.org/atomic"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/protocol/logger"
+)
+
+// comfortNoise raises the mixer's test source from silence to low level noise while no audio is being received,
+// so that audio only destinations keep hearing something during publisher dropouts
+type comfortNoise struct {
+	testSrc    *gst.Element
+	volume     float64
+	gap        time.Duration
+	lastBuffer atomic.Int64
+	active     atomic.Bool
+	muted      atomic.Bool
+	done       core.Fuse
+}
+
+func (a *AudioInput) addComfortNoise(p *config.PipelineConfig, testSrc *gst.Element) {
+	testSrc.SetArg("wave", p.ComfortNoise.Wave)
+
+	c := &comfortNoise{
+		testSrc: testSrc,
+		volume:  p.ComfortNoise.Volume,
+		gap:     p.ComfortNoise.Gap,
+		done:    core.NewFuse(),
+	}
+	c.lastBuffer.Store(time.Now().UnixNano())
+
+	// the last decoder element feeds the mixer
+	src := a.decoder[len(a.decoder)-1].GetStaticPad("src")
+	src.AddProbe(gst.PadProbeTypeBuffer|gst.PadProbeTypeEventDownstream, func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+		if event := info.GetEvent(); event != nil {
+			if event.Type() == gst.EventTypeEOS {
+				c.done.Break()
+			}
+			return gst.PadProbeOK
+		}
+
+		c.lastBuffer.Store(time.Now().UnixNano())
+		if c.active.CompareAndSwap(true, false) {
+			c.setVolume(0)
+		}
+		return gst.PadProbeOK
+	})
+
+	a.comfortNoise = c
+	go c.monitor()
+}
+
+func (c *comfortNoise) monitor() {
+	ticker := time.NewTicker(c.gap / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done.Watch():
+			return
+		case <-ticker.C:
+			if c.muted.Load() {
+				continue
+			}
+			if time.Since(time.Unix(0, c.lastBuffer.Load())) > c.gap && c.active.CompareAndSwap(false, true) {
+				logger.Debugw("audio dropout, adding comfort noise")
+				c.setVolume(c.volume)
+			}
+		}
+	}
+}
+
+// setMuted keeps the test source silent while the track is muted
+func (c *comfortNoise) setMuted(muted bool) {
+	c.muted.Store(muted)
+	if muted && c.active.CompareAndSwap(true, false) {
+		c.setVolume(0)
+	}
+}
+
+func (c *comfortNoise) setVolume(volume float64) {
+	if err := c.testSrc.SetProperty("volume", volume); err != nil {
+		logger.Errorw("failed to set comfort noise volume", err)
+	}
+}
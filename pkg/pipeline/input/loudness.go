@@ -0,0 +1,95 @@
+package input
+
+import (
+	"math"
+	"time"
+
+	"github.com/frostbyte73/core"
+	"github.com/tinyzimmer/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/qc"
+	"github.com/livekit/protocol/logger"
+)
+
+const (
+	loudnessWindow   = time.Second * 10
+	loudnessInterval = time.Millisecond * 100
+	loudnessMaxStep  = 0.1 // dB per interval, so that gain changes are not heard as pumping
+)
+
+// loudness normalizes transcoded audio towards an EBU R128 loudness target. The gated loudness of the last
+// few seconds is measured in front of a volume element, whose gain is adjusted slowly, followed by a peak limiter.
+type loudness struct {
+	meter  *qc.LoudnessMeter
+	volume *gst.Element
+	conf   *config.LoudnessConfig
+	gain   float64
+	done   core.Fuse
+}
+
+func buildLoudness(p *config.PipelineConfig) ([]*gst.Element, error) {
+	l := &loudness{
+		meter: qc.NewLoudnessMeter(getSampleRate(p), int(p.AudioChannels), loudnessWindow),
+		conf:  p.Loudness,
+		done:  core.NewFuse(),
+	}
+
+	tap, err := buildAnalysisTap("audio_loudness", func(buffer *gst.Buffer) {
+		l.meter.Write(getSamples(buffer))
+	})
+	if err != nil {
+		return nil, err
+	}
+	tap.GetStaticPad("src").AddProbe(gst.PadProbeTypeEventDownstream, func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+		if event := info.GetEvent(); event != nil && event.Type() == gst.EventTypeEOS {
+			l.done.Break()
+		}
+		return gst.PadProbeOK
+	})
+
+	l.volume, err = gst.NewElementWithName("volume", "audio_loudness_gain")
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	// peaks above the limit are compressed with a soft knee
+	limiter, err := gst.NewElementWithName("audiodynamic", "audio_loudness_limiter")
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	limiter.SetArg("mode", "compressor")
+	limiter.SetArg("characteristics", "soft-knee")
+	if err = limiter.SetProperty("threshold", float32(math.Pow(10, p.Loudness.TruePeak/20))); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = limiter.SetProperty("ratio", float32(0)); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	go l.monitor()
+
+	return []*gst.Element{tap, l.volume, limiter}, nil
+}
+
+func (l *loudness) monitor() {
+	ticker := time.NewTicker(loudnessInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done.Watch():
+			return
+		case <-ticker.C:
+			gain := qc.NormalizationGain(l.gain, l.meter.Loudness(), l.conf.Target, l.conf.MaxGain, loudnessMaxStep)
+			if gain == l.gain {
+				continue
+			}
+			l.gain = gain
+			if err := l.volume.SetProperty("volume", math.Pow(10, gain/20)); err != nil {
+				logger.Errorw("failed to set loudness gain", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package input
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/frostbyte73/core"
+	"github.com/tinyzimmer/go-gst/gst"
+	"github.com/tinyzimmer/go-gst/gst/app"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/builder"
+	"github.com/livekit/egress/pkg/pipeline/qc"
+	"github.com/livekit/protocol/logger"
+)
+
+// muteIndicator switches decoded video to the last live frame or to black frames while video is muted,
+// optionally drawing a badge over it
+type muteIndicator struct {
+	selector *gst.Element
+	srcElem  *gst.Element
+	src      *app.Source
+	badge    *gst.Element // nil without badge text
+	livePad  *gst.Pad
+	mutePad  *gst.Pad
+	interval time.Duration
+	freeze   bool
+
+	mu      sync.Mutex
+	frame   []byte // last live frame, or black
+	muted   bool
+	ended   bool
+	pushes  int // incremented each time muted, so that only the latest push loop runs
+	stopped core.Fuse
+}
+
+func (v *VideoInput) buildMuteIndicator(p *config.PipelineConfig) error {
+	selector, err := gst.NewElementWithName("input-selector", "video_mute_selector")
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	// the muted frames are timestamped on push, so switching must follow the clock rather than segment times
+	selector.SetArg("sync-mode", "clock")
+
+	src, err := gst.NewElementWithName("appsrc", "video_mute_src")
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = src.SetProperty("caps", gst.NewCapsFromString(
+		fmt.Sprintf("video/x-raw,framerate=%d/1,format=I420,width=%d,height=%d,colorimetry=bt709,chroma-site=mpeg2,pixel-aspect-ratio=1/1",
+			p.Framerate, p.Width, p.Height,
+		)),
+	); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	src.SetArg("format", "time")
+	if err = src.SetProperty("is-live", true); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = src.SetProperty("do-timestamp", true); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+
+	m := &muteIndicator{
+		selector: selector,
+		srcElem:  src,
+		src:      app.SrcFromElement(src),
+		livePad:  selector.GetRequestPad("sink_%u"),
+		mutePad:  selector.GetRequestPad("sink_%u"),
+		interval: time.Second / time.Duration(p.Framerate),
+		freeze:   p.MuteIndicator.Video == config.MuteVideoFreeze,
+		frame:    blackFrame(int(p.Width), int(p.Height)),
+		stopped:  core.NewFuse(),
+	}
+	if err = selector.SetProperty("active-pad", m.livePad); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+
+	m.livePad.AddProbe(gst.PadProbeTypeBuffer|gst.PadProbeTypeEventDownstream, func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+		if event := info.GetEvent(); event != nil {
+			if event.Type() == gst.EventTypeEOS {
+				// the selector only forwards EOS from the active pad
+				m.end()
+			}
+			return gst.PadProbeOK
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.freeze && !m.muted {
+			if buffer := info.GetBuffer(); buffer != nil {
+				data := buffer.Map(gst.MapRead).Bytes()
+				if len(data) == len(m.frame) {
+					copy(m.frame, data)
+				}
+				buffer.Unmap()
+			}
+		}
+		return gst.PadProbeOK
+	})
+
+	v.elements = append(v.elements, selector)
+
+	if p.MuteIndicator.Badge != "" {
+		badge, err := gst.NewElementWithName("textoverlay", "video_mute_badge")
+		if err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = badge.SetProperty("text", p.MuteIndicator.Badge); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		badge.SetArg("valignment", "top")
+		badge.SetArg("halignment", "left")
+		if err = badge.SetProperty("font-desc", fmt.Sprintf("Sans, %d", p.Height/24)); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = badge.SetProperty("shaded-background", true); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = badge.SetProperty("silent", true); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		m.badge = badge
+		v.elements = append(v.elements, badge)
+	}
+
+	v.mute = m
+	return nil
+}
+
+// blackFrame returns a limited range black I420 frame
+func blackFrame(width, height int) []byte {
+	ySize := width * height
+	chromaSize := ((width + 1) / 2) * ((height + 1) / 2)
+	frame := make([]byte, ySize+2*chromaSize)
+	for i := range frame {
+		if i < ySize {
+			frame[i] = 16
+		} else {
+			frame[i] = 128
+		}
+	}
+	return frame
+}
+
+func (m *muteIndicator) link() error {
+	return builder.LinkPads(
+		"mute indicator", m.srcElem.GetStaticPad("src"),
+		"video mute selector", m.mutePad,
+	)
+}
+
+func (m *muteIndicator) setMuted(muted bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ended || m.muted == muted {
+		return
+	}
+
+	if muted {
+		m.pushes++
+		go m.pushFrames(m.pushes)
+		m.switchTo(m.mutePad)
+	} else {
+		m.switchTo(m.livePad)
+	}
+	m.muted = muted
+
+	if m.badge != nil {
+		if err := m.badge.SetProperty("silent", !muted); err != nil {
+			logger.Errorw("failed to update mute badge", err)
+		}
+	}
+}
+
+// end switches back to the live pad, so that its EOS is forwarded
+func (m *muteIndicator) end() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ended {
+		return
+	}
+	m.ended = true
+	m.stopped.Break()
+	if m.muted {
+		m.switchTo(m.livePad)
+		m.muted = false
+	}
+}
+
+// switchTo must be called while holding the lock
+func (m *muteIndicator) switchTo(pad *gst.Pad) {
+	if err := m.selector.SetProperty("active-pad", pad); err != nil {
+		logger.Errorw("failed to switch mute indicator", err)
+		return
+	}
+	logger.Debugw("mute indicator switched", "muted", pad == m.mutePad)
+}
+
+// pushFrames pushes the frozen or black frame at the output framerate until unmuted
+func (m *muteIndicator) pushFrames(push int) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.mu.Lock()
+		if !m.muted || m.pushes != push {
+			m.mu.Unlock()
+			return
+		}
+		frame := make([]byte, len(m.frame))
+		copy(frame, m.frame)
+		m.mu.Unlock()
+
+		if flow := m.src.PushBuffer(gst.NewBufferFromBytes(frame)); flow != gst.FlowOK {
+			logger.Debugw("mute indicator stopped", "flow", flow.String())
+			return
+		}
+
+		select {
+		case <-m.stopped.Watch():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetVideoMuted shows the slate or the mute indicator while video is muted
+func (b *Bin) SetVideoMuted(muted bool) {
+	if b.timeline != nil {
+		b.timeline.SetActive(qc.EventVideoMuted, muted, time.Now())
+	}
+	if b.video == nil {
+		return
+	}
+	if b.video.slate != nil {
+		b.video.slate.setMuted(muted)
+	} else if b.video.mute != nil {
+		b.video.mute.setMuted(muted)
+	}
+}
+
+// SetAudioMuted keeps muted audio silent, instead of filling it with comfort noise
+func (b *Bin) SetAudioMuted(muted bool) {
+	if b.timeline != nil {
+		b.timeline.SetActive(qc.EventAudioMuted, muted, time.Now())
+	}
+	if b.audio != nil && b.audio.comfortNoise != nil {
+		b.audio.comfortNoise.setMuted(muted)
+	}
+}
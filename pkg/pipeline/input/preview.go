@@ -0,0 +1,73 @@
+package input
+
+import (
+	"time"
+
+	"github.com/tinyzimmer/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/protocol/logger"
+)
+
+// buildPreviewTap returns an identity element which copies a single decoded frame, once the delay has passed
+func (b *Bin) buildPreviewTap(p *config.PipelineConfig) (*gst.Element, error) {
+	identity, err := gst.NewElementWithName("identity", "video_preview")
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = identity.SetProperty("signal-handoffs", true); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	var first time.Duration = -1
+	captured := false
+	if _, err = identity.Connect("handoff", func(self *gst.Element, buffer *gst.Buffer) {
+		if captured {
+			return
+		}
+
+		pts := buffer.PresentationTimestamp()
+		if first < 0 {
+			first = pts
+		}
+		if pts-first < p.Preview.Delay {
+			return
+		}
+		captured = true
+
+		// web sources are converted to whichever format the encoder prefers
+		caps := self.GetStaticPad("src").GetCurrentCaps()
+		if caps == nil || caps.GetSize() == 0 {
+			return
+		}
+		s := caps.GetStructureAt(0)
+		format, _ := s.GetValue("format")
+		width, _ := s.GetValue("width")
+		height, _ := s.GetValue("height")
+		if format != "I420" {
+			logger.Warnw("preview not supported", nil, "format", format)
+			return
+		}
+		w, _ := width.(int)
+		h, _ := height.(int)
+
+		data := buffer.Map(gst.MapRead).Bytes()
+		frame := make([]byte, len(data))
+		copy(frame, data)
+		buffer.Unmap()
+
+		if b.onPreview != nil {
+			go b.onPreview(frame, w, h)
+		}
+	}); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	return identity, nil
+}
+
+// OnPreview is called once with a raw I420 frame
+func (b *Bin) OnPreview(f func(frame []byte, width, height int)) {
+	b.onPreview = f
+}
@@ -0,0 +1,119 @@
+package input
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/tinyzimmer/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/qc"
+	"github.com/livekit/egress/pkg/types"
+)
+
+// buildAudioAnalysis returns an identity element which passes raw audio to the analyzer
+func (b *Bin) buildAudioAnalysis(p *config.PipelineConfig) (*gst.Element, error) {
+	b.audioAnalyzer = qc.NewAudioAnalyzer(getSampleRate(p), int(p.AudioChannels))
+
+	return buildAnalysisTap("audio_qc", func(buffer *gst.Buffer) {
+		b.audioAnalyzer.Write(getSamples(buffer))
+	})
+}
+
+// getSampleRate returns the rate of raw audio in front of the encoder
+func getSampleRate(p *config.PipelineConfig) int {
+	if p.AudioOutCodec == types.MimeTypeAAC || p.AudioOutCodec == types.MimeTypeMP3 {
+		return int(p.AudioFrequency)
+	}
+	return 48000
+}
+
+// getSamples copies interleaved S16LE samples out of a buffer
+func getSamples(buffer *gst.Buffer) []int16 {
+	data := buffer.Map(gst.MapRead).Bytes()
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	buffer.Unmap()
+	return samples
+}
+
+// buildVideoAnalysis returns an identity element which passes decoded frames to the analyzer
+func (b *Bin) buildVideoAnalysis(p *config.PipelineConfig) (*gst.Element, error) {
+	b.videoAnalyzer = qc.NewVideoAnalyzer()
+
+	width, height := int(p.Width), int(p.Height)
+	return buildAnalysisTap("video_qc", func(buffer *gst.Buffer) {
+		data := buffer.Map(gst.MapRead).Bytes()
+		buffer.Unmap()
+
+		if luma, ok := qc.MeanLuma(data, width, height); ok {
+			b.videoAnalyzer.WriteFrame(buffer.PresentationTimestamp(), luma)
+		}
+	})
+}
+
+func buildAnalysisTap(name string, onBuffer func(buffer *gst.Buffer)) (*gst.Element, error) {
+	identity, err := gst.NewElementWithName("identity", name)
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = identity.SetProperty("signal-handoffs", true); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if _, err = identity.Connect("handoff", func(_ *gst.Element, buffer *gst.Buffer) {
+		onBuffer(buffer)
+	}); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	return identity, nil
+}
+
+// SetSignalingOutage records the start and end of room signaling outages
+func (b *Bin) SetSignalingOutage(outage bool) {
+	if b.timeline != nil {
+		b.timeline.SetActive(qc.EventSignalingOutage, outage, time.Now())
+	}
+}
+
+// WriteNetworkStats records the periodic network stats of the sdk source
+func (b *Bin) WriteNetworkStats(stats []*qc.NetworkStats) {
+	if b.network != nil {
+		b.network.Write(stats, time.Now())
+	}
+}
+
+// GetQCReport returns the analysis results, events and network stats, or nil if none of qc reports, mute indicators, sdk reconnects or network stats are enabled
+func (b *Bin) GetQCReport() *qc.Report {
+	if b.audioAnalyzer == nil && b.videoAnalyzer == nil && b.timeline == nil {
+		return nil
+	}
+
+	report := &qc.Report{}
+	if b.audioAnalyzer != nil {
+		report.Audio = b.audioAnalyzer.Report()
+	}
+	if b.videoAnalyzer != nil {
+		var dropped, duplicated uint64
+		if b.video.rate != nil {
+			if v, err := b.video.rate.GetProperty("drop"); err == nil {
+				dropped, _ = v.(uint64)
+			}
+			if v, err := b.video.rate.GetProperty("duplicate"); err == nil {
+				duplicated, _ = v.(uint64)
+			}
+		}
+		report.Video = b.videoAnalyzer.Report(dropped, duplicated)
+	}
+	if b.timeline != nil {
+		report.Events = b.timeline.Events(time.Now())
+	}
+	if b.network != nil {
+		report.Network = b.network.Report()
+	}
+
+	return report
+}
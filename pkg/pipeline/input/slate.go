@@ -0,0 +1,222 @@
+package input
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/tinyzimmer/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/builder"
+	"github.com/livekit/protocol/logger"
+)
+
+// slate switches decoded video to a still image or color before the first frame, while video is muted,
+// and after the video source ends, until the pipeline is sent EOS
+type slate struct {
+	selector *gst.Element
+	elements []*gst.Element
+	livePad  *gst.Pad
+	slatePad *gst.Pad
+
+	mu        sync.Mutex
+	started   bool
+	muted     bool
+	liveEnded bool
+	ending    bool
+	showing   bool
+}
+
+func (v *VideoInput) buildSlate(p *config.PipelineConfig) error {
+	selector, err := gst.NewElementWithName("input-selector", "video_slate_selector")
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	// both inputs are live, so switching must follow the clock rather than segment times
+	selector.SetArg("sync-mode", "clock")
+
+	var elements []*gst.Element
+	if p.Slate.Image != "" {
+		elements, err = buildSlateImage(p)
+	} else {
+		elements, err = buildSlateColor(p)
+	}
+	if err != nil {
+		return err
+	}
+
+	videoConvert, err := gst.NewElement("videoconvert")
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	videoScale, err := gst.NewElement("videoscale")
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	caps, err := gst.NewElement("capsfilter")
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = caps.SetProperty("caps", gst.NewCapsFromString(
+		fmt.Sprintf("video/x-raw,framerate=%d/1,format=I420,width=%d,height=%d,colorimetry=bt709,chroma-site=mpeg2,pixel-aspect-ratio=1/1",
+			p.Framerate, p.Width, p.Height,
+		)),
+	); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+
+	s := &slate{
+		selector: selector,
+		elements: append(elements, videoConvert, videoScale, caps),
+		livePad:  selector.GetRequestPad("sink_%u"),
+		slatePad: selector.GetRequestPad("sink_%u"),
+		showing:  true,
+	}
+	if err = selector.SetProperty("active-pad", s.slatePad); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+
+	s.livePad.AddProbe(gst.PadProbeTypeBuffer|gst.PadProbeTypeEventDownstream, func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+		if event := info.GetEvent(); event != nil {
+			if event.Type() != gst.EventTypeEOS {
+				return gst.PadProbeOK
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.ending {
+				return gst.PadProbeOK
+			}
+
+			// keep the output alive with the slate until the pipeline ends
+			logger.Infow("video source ended, showing slate")
+			s.liveEnded = true
+			s.update()
+			return gst.PadProbeDrop
+		}
+
+		s.mu.Lock()
+		if !s.started {
+			s.started = true
+			s.update()
+		}
+		s.mu.Unlock()
+		return gst.PadProbeOK
+	})
+
+	v.elements = append(v.elements, selector)
+	v.slate = s
+	return nil
+}
+
+func buildSlateImage(p *config.PipelineConfig) ([]*gst.Element, error) {
+	decoder, err := config.SlateDecoder(p.Slate.Image)
+	if err != nil {
+		return nil, err
+	}
+
+	fileSrc, err := gst.NewElementWithName("filesrc", "video_slate_src")
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = fileSrc.SetProperty("location", p.Slate.Image); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	imageDec, err := gst.NewElement(decoder)
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	imageFreeze, err := gst.NewElement("imagefreeze")
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = imageFreeze.SetProperty("is-live", true); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	return []*gst.Element{fileSrc, imageDec, imageFreeze}, nil
+}
+
+func buildSlateColor(p *config.PipelineConfig) ([]*gst.Element, error) {
+	color, err := config.ParseColor(p.Slate.Color)
+	if err != nil {
+		return nil, err
+	}
+
+	videoTestSrc, err := gst.NewElementWithName("videotestsrc", "video_slate_src")
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	videoTestSrc.SetArg("pattern", "solid-color")
+	if err = videoTestSrc.SetProperty("foreground-color", color); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = videoTestSrc.SetProperty("is-live", true); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	return []*gst.Element{videoTestSrc}, nil
+}
+
+func (s *slate) link() error {
+	if err := gst.ElementLinkMany(s.elements...); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	return builder.LinkPads(
+		"slate", s.elements[len(s.elements)-1].GetStaticPad("src"),
+		"video slate selector", s.slatePad,
+	)
+}
+
+func (s *slate) setMuted(muted bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.muted = muted
+	s.update()
+}
+
+// end lets EOS through. An image slate needs EOS pushed explicitly, since imagefreeze ignores it
+func (s *slate) end() {
+	s.mu.Lock()
+	s.ending = true
+	showing := s.showing
+	s.mu.Unlock()
+
+	if showing {
+		s.elements[len(s.elements)-1].GetStaticPad("src").PushEvent(gst.NewEOSEvent())
+	}
+}
+
+// update must be called while holding the lock
+func (s *slate) update() {
+	if s.ending {
+		return
+	}
+
+	show := !s.started || s.muted || s.liveEnded
+	if show == s.showing {
+		return
+	}
+
+	pad := s.livePad
+	if show {
+		pad = s.slatePad
+	}
+	if err := s.selector.SetProperty("active-pad", pad); err != nil {
+		logger.Errorw("failed to switch slate", err)
+		return
+	}
+	s.showing = show
+	logger.Debugw("slate switched", "showing", show)
+}
+
+// EndSlate is called before the pipeline is sent EOS
+func (b *Bin) EndSlate() {
+	if b.video != nil && b.video.slate != nil {
+		b.video.slate.end()
+	}
+}
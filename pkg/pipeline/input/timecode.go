@@ -0,0 +1,50 @@
+package input
+
+import (
+	"github.com/tinyzimmer/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+)
+
+// buildTimecode attaches SMPTE timecode meta to raw video, which is carried through the encoder.
+// mp4mux writes it as a timecode track.
+func buildTimecode(p *config.PipelineConfig) ([]*gst.Element, error) {
+	stamper, err := gst.NewElement("timecodestamper")
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	stamper.SetArg("set", "always")
+
+	if p.Timecode.Start == "" {
+		// count up from the wall clock
+		stamper.SetArg("source", "rtc")
+	} else {
+		offset, err := config.ParseTimecode(p.Timecode.Start, p.Framerate)
+		if err != nil {
+			return nil, errors.ErrInvalidInput("timecode start")
+		}
+		// count up from the start timecode
+		stamper.SetArg("source", "internal")
+		if err = stamper.SetProperty("timecode-offset", offset); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+	}
+
+	elements := []*gst.Element{stamper}
+	if p.Timecode.BurnIn {
+		overlay, err := gst.NewElement("timeoverlay")
+		if err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+		overlay.SetArg("time-mode", "time-code")
+		overlay.SetArg("valignment", "bottom")
+		overlay.SetArg("halignment", "center")
+		if err = overlay.SetProperty("font-desc", "Monospace, 24"); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+		elements = append(elements, overlay)
+	}
+
+	return elements, nil
+}
@@ -0,0 +1,56 @@
+package input
+
+import (
+	"github.com/tinyzimmer/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+)
+
+func trimEnabled(p *config.PipelineConfig) bool {
+	return p.Trim != nil && (p.Trim.StartOffset > 0 || p.Trim.EndOffset > 0)
+}
+
+// buildTrim returns an identity element which drops raw media outside the trim offsets.
+// Trimming before the encoder keeps it frame accurate, since the first frame after the start offset is encoded as a keyframe.
+func (b *Bin) buildTrim(name string, p *config.PipelineConfig) (*gst.Element, error) {
+	identity, err := gst.NewElementWithName("identity", name)
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	start, end := p.Trim.StartOffset, p.Trim.EndOffset
+	src := identity.GetStaticPad("src")
+	src.AddProbe(gst.PadProbeTypeBuffer, func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+		buffer := info.GetBuffer()
+		if buffer == nil {
+			return gst.PadProbeOK
+		}
+
+		pts := buffer.PresentationTimestamp()
+		if pts < start {
+			return gst.PadProbeDrop
+		}
+		if end > 0 && pts >= end {
+			b.trimEnded.Do(func() {
+				if b.onTrimEnd != nil {
+					go b.onTrimEnd()
+				}
+			})
+			return gst.PadProbeDrop
+		}
+		return gst.PadProbeOK
+	})
+
+	// shift running time so outputs start at zero
+	if start > 0 {
+		src.SetOffset(-int64(start))
+	}
+
+	return identity, nil
+}
+
+// OnTrimEnd is called once media reaches the end offset
+func (b *Bin) OnTrimEnd(f func()) {
+	b.onTrimEnd = f
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/frostbyte73/core"
 	"github.com/tinyzimmer/go-gst/gst"
 
 	"github.com/livekit/egress/pkg/config"
@@ -14,6 +15,16 @@ import (
 
 type VideoInput struct {
 	elements []*gst.Element
+	rate     *gst.Element // nil for web sources
+	captured core.Fuse    // broken by the first frame from display capture, web sources only
+	slate    *slate
+	mute     *muteIndicator
+
+	// proxy file and hls rendition encoders, fed by the tee in front of the main encoder
+	tee           *gst.Element
+	proxy         []*gst.Element
+	renditions    [][]*gst.Element
+	renditionPads []*gst.GhostPad
 }
 
 func (b *Bin) buildVideoInput(p *config.PipelineConfig) error {
@@ -31,7 +42,70 @@ func (b *Bin) buildVideoInput(p *config.PipelineConfig) error {
 		}
 	}
 
+	if p.VideoTranscoding && p.Slate != nil {
+		if err := v.buildSlate(p); err != nil {
+			return err
+		}
+	}
+
+	if p.VideoTranscoding && trimEnabled(p) {
+		trim, err := b.buildTrim("video_trim", p)
+		if err != nil {
+			return err
+		}
+		v.elements = append(v.elements, trim)
+	}
+
+	// the slate already covers muted video
+	if p.VideoTranscoding && p.MuteIndicator != nil && p.Slate == nil && p.SourceType == types.SourceTypeSDK {
+		if err := v.buildMuteIndicator(p); err != nil {
+			return err
+		}
+	}
+
+	if p.VideoTranscoding && p.Watermark != nil {
+		watermark, err := buildWatermark(p)
+		if err != nil {
+			return err
+		}
+		v.elements = append(v.elements, watermark)
+	}
+
+	if p.VideoTranscoding && p.Timecode != nil {
+		timecode, err := buildTimecode(p)
+		if err != nil {
+			return err
+		}
+		v.elements = append(v.elements, timecode...)
+	}
+
+	if p.VideoTranscoding && p.QCReport {
+		analysis, err := b.buildVideoAnalysis(p)
+		if err != nil {
+			return err
+		}
+		v.elements = append(v.elements, analysis)
+	}
+
+	if p.VideoTranscoding && p.Preview != nil {
+		tap, err := b.buildPreviewTap(p)
+		if err != nil {
+			return err
+		}
+		v.elements = append(v.elements, tap)
+	}
+
 	if p.VideoTranscoding {
+		if p.GetProxyFileConfig() != nil {
+			if err := v.buildProxyEncoder(p); err != nil {
+				return err
+			}
+		}
+		if o := p.GetSegmentConfig(); o != nil && len(o.Renditions) > 0 {
+			if err := v.buildRenditionEncoders(p, o.Renditions); err != nil {
+				return err
+			}
+		}
 		if err := v.buildEncoder(p); err != nil {
 			return err
 		}
@@ -41,17 +115,75 @@ func (b *Bin) buildVideoInput(p *config.PipelineConfig) error {
 	if err := b.bin.AddMany(v.elements...); err != nil {
 		return errors.ErrGstPipelineError(err)
 	}
+	if v.slate != nil {
+		if err := b.bin.AddMany(v.slate.elements...); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+	}
+	if v.mute != nil {
+		if err := b.bin.Add(v.mute.srcElem); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+	}
+	if len(v.proxy) > 0 {
+		if err := b.bin.AddMany(v.proxy...); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+	}
+	for _, rendition := range v.renditions {
+		if err := b.bin.AddMany(rendition...); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+	}
 	b.video = v
 	return nil
 }
 
-func (v *VideoInput) Link() (*gst.GhostPad, error) {
-	err := gst.ElementLinkMany(v.elements...)
-	if err != nil {
-		return nil, errors.ErrGstPipelineError(err)
+func (v *VideoInput) Link() (videoPad, videoProxyPad *gst.GhostPad, err error) {
+	// the slate and mute indicator are linked first, so that the decoder links to the remaining selector pads
+	if v.slate != nil {
+		if err = v.slate.link(); err != nil {
+			return nil, nil, err
+		}
 	}
+	if v.mute != nil {
+		if err = v.mute.link(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err = gst.ElementLinkMany(v.elements...); err != nil {
+		return nil, nil, errors.ErrGstPipelineError(err)
+	}
+	videoPad = gst.NewGhostPad("video_src", v.elements[len(v.elements)-1].GetStaticPad("src"))
 
-	return gst.NewGhostPad("video_src", v.elements[len(v.elements)-1].GetStaticPad("src")), nil
+	if len(v.proxy) > 0 {
+		if err = v.linkTee("video proxy queue", v.proxy); err != nil {
+			return nil, nil, err
+		}
+		videoProxyPad = gst.NewGhostPad("video_proxy_src", v.proxy[len(v.proxy)-1].GetStaticPad("src"))
+	}
+
+	for i, rendition := range v.renditions {
+		if err = v.linkTee("video rendition queue", rendition); err != nil {
+			return nil, nil, err
+		}
+		v.renditionPads = append(v.renditionPads,
+			gst.NewGhostPad(fmt.Sprintf("video_rendition_src_%d", i), rendition[len(rendition)-1].GetStaticPad("src")),
+		)
+	}
+
+	return videoPad, videoProxyPad, nil
+}
+
+func (v *VideoInput) linkTee(queueName string, elements []*gst.Element) error {
+	if err := gst.ElementLinkMany(elements...); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	return builder.LinkPads(
+		"video tee", v.tee.GetRequestPad("src_%u"),
+		queueName, elements[0].GetStaticPad("sink"),
+	)
 }
 
 func (v *VideoInput) GetSrcPad() *gst.Pad {
@@ -72,6 +204,11 @@ func (v *VideoInput) buildWebDecoder(p *config.PipelineConfig) error {
 	if err = xImageSrc.SetProperty("show-pointer", false); err != nil {
 		return errors.ErrGstPipelineError(err)
 	}
+	v.captured = core.NewFuse()
+	xImageSrc.GetStaticPad("src").AddProbe(gst.PadProbeTypeBuffer, func(_ *gst.Pad, _ *gst.PadProbeInfo) gst.PadProbeReturn {
+		v.captured.Break()
+		return gst.PadProbeRemove
+	})
 
 	videoQueue, err := builder.BuildQueue("video_input_queue", p.Latency, true)
 	if err != nil {
@@ -203,6 +340,7 @@ func (v *VideoInput) buildSDKDecoder(p *config.PipelineConfig) error {
 		return errors.ErrGstPipelineError(err)
 	}
 
+	v.rate = videoRate
 	v.elements = append(v.elements, videoQueue, videoConvert, videoScale, videoRate, caps)
 	return nil
 }
@@ -216,7 +354,7 @@ func (v *VideoInput) buildEncoder(p *config.PipelineConfig) error {
 	v.elements = append(v.elements, videoQueue)
 
 	switch p.VideoOutCodec {
-	// we only encode h264, the rest are too slow
+	// h264 is preferred, vp8 and vp9 are only used for webm outputs, and h265 when enabled for mp4 and ts files
 	case types.MimeTypeH264:
 		x264Enc, err := gst.NewElement("x264enc")
 		if err != nil {
@@ -233,9 +371,31 @@ func (v *VideoInput) buildEncoder(p *config.PipelineConfig) error {
 			}
 		}
 
+		var options []string
+		switch p.ContentHint {
+		case types.ContentHintDetail, types.ContentHintText:
+			// favor sharp, mostly static content (slides, documents, screen shares) over motion
+			x264Enc.SetArg("tune", "stillimage")
+			// smaller quantizer steps between frames keep text from blurring when the scene changes
+			if err = x264Enc.SetProperty("qp-step", uint(2)); err != nil {
+				return errors.ErrGstPipelineError(err)
+			}
+			options = append(options, "aq-mode=2", "deblock=-1,-1")
+		}
+
 		if p.GetSegmentConfig() != nil {
 			// Avoid key frames other than at segments boundaries as splitmuxsink can become inconsistent otherwise
-			if err = x264Enc.SetProperty("option-string", "scenecut=0"); err != nil {
+			options = append(options, "scenecut=0")
+		}
+
+		if p.CBREncoding() {
+			if options, err = applyCBR(p, x264Enc, options); err != nil {
+				return err
+			}
+		}
+
+		if len(options) > 0 {
+			if err = x264Enc.SetProperty("option-string", strings.Join(options, ":")); err != nil {
 				return errors.ErrGstPipelineError(err)
 			}
 		}
@@ -254,7 +414,215 @@ func (v *VideoInput) buildEncoder(p *config.PipelineConfig) error {
 		v.elements = append(v.elements, x264Enc, caps)
 		return nil
 
+	case types.MimeTypeH265:
+		x265Enc, err := gst.NewElement("x265enc")
+		if err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = x265Enc.SetProperty("bitrate", uint(p.VideoBitrate)); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		x265Enc.SetArg("speed-preset", "veryfast")
+
+		if p.KeyFrameInterval != 0 {
+			if err = x265Enc.SetProperty("key-int-max", int(p.KeyFrameInterval*float64(p.Framerate))); err != nil {
+				return errors.ErrGstPipelineError(err)
+			}
+		}
+
+		caps, err := gst.NewElement("capsfilter")
+		if err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = caps.SetProperty("caps", gst.NewCapsFromString("video/x-h265,profile=main")); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+
+		// mp4mux requires hvc1 or hev1 stream formats
+		h265parse, err := gst.NewElement("h265parse")
+		if err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+
+		v.elements = append(v.elements, x265Enc, caps, h265parse)
+		return nil
+
+	case types.MimeTypeVP8:
+		vp8Enc, err := gst.NewElement("vp8enc")
+		if err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		// realtime encoding, at the cost of quality
+		if err = vp8Enc.SetProperty("deadline", int64(1)); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = vp8Enc.SetProperty("cpu-used", 8); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = vp8Enc.SetProperty("target-bitrate", int(p.VideoBitrate*1000)); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		vp8Enc.SetArg("end-usage", "cbr")
+
+		if p.KeyFrameInterval != 0 {
+			if err = vp8Enc.SetProperty("keyframe-max-dist", int(p.KeyFrameInterval*float64(p.Framerate))); err != nil {
+				return errors.ErrGstPipelineError(err)
+			}
+		}
+
+		v.elements = append(v.elements, vp8Enc)
+		return nil
+
+	case types.MimeTypeVP9:
+		vp9Enc, err := gst.NewElement("vp9enc")
+		if err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		// realtime encoding, at the cost of quality
+		if err = vp9Enc.SetProperty("deadline", int64(1)); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = vp9Enc.SetProperty("cpu-used", 8); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		// encode tile columns in parallel
+		if err = vp9Enc.SetProperty("row-mt", true); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = vp9Enc.SetProperty("tile-columns", 2); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = vp9Enc.SetProperty("target-bitrate", int(p.VideoBitrate*1000)); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		vp9Enc.SetArg("end-usage", "cbr")
+
+		if p.KeyFrameInterval != 0 {
+			if err = vp9Enc.SetProperty("keyframe-max-dist", int(p.KeyFrameInterval*float64(p.Framerate))); err != nil {
+				return errors.ErrGstPipelineError(err)
+			}
+		}
+
+		v.elements = append(v.elements, vp9Enc)
+		return nil
+
 	default:
 		return errors.ErrNotSupported(fmt.Sprintf("%s encoding", p.VideoOutCodec))
 	}
 }
+
+func (v *VideoInput) buildProxyEncoder(p *config.PipelineConfig) error {
+	if err := v.addTee(); err != nil {
+		return err
+	}
+
+	width, height := p.ProxyResolution()
+	proxy, err := buildScaledEncoder(p, "proxy", width, height, p.ProxyFile.VideoBitrate, false)
+	if err != nil {
+		return err
+	}
+
+	v.proxy = proxy
+	return nil
+}
+
+// buildRenditionEncoders encodes a scaled copy for each hls rendition
+func (v *VideoInput) buildRenditionEncoders(p *config.PipelineConfig, renditions []*config.SegmentConfig) error {
+	if err := v.addTee(); err != nil {
+		return err
+	}
+
+	for _, r := range renditions {
+		width, height := r.Rendition.Resolution(p)
+		encoder, err := buildScaledEncoder(p, "rendition_"+r.Rendition.Name, width, height, r.Rendition.VideoBitrate, p.CBREncoding())
+		if err != nil {
+			return err
+		}
+		v.renditions = append(v.renditions, encoder)
+	}
+	return nil
+}
+
+// addTee splits raw video in front of the main encoder, for encoders with a different size or bitrate
+func (v *VideoInput) addTee() error {
+	if v.tee != nil {
+		return nil
+	}
+
+	tee, err := gst.NewElement("tee")
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	v.tee = tee
+	v.elements = append(v.elements, tee)
+	return nil
+}
+
+// buildScaledEncoder returns a queue, scaler, and h264 encoder, to be fed by the tee
+func buildScaledEncoder(p *config.PipelineConfig, name string, width, height, bitrate int32, cbr bool) ([]*gst.Element, error) {
+	videoQueue, err := builder.BuildQueue(fmt.Sprintf("video_%s_encoder_queue", name), p.Latency, false)
+	if err != nil {
+		return nil, err
+	}
+
+	videoScale, err := gst.NewElement("videoscale")
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	scaleCaps, err := gst.NewElement("capsfilter")
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = scaleCaps.SetProperty("caps", gst.NewCapsFromString(
+		fmt.Sprintf("video/x-raw,width=%d,height=%d,pixel-aspect-ratio=1/1", width, height),
+	)); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	x264Enc, err := gst.NewElement("x264enc")
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = x264Enc.SetProperty("bitrate", uint(bitrate)); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	x264Enc.SetArg("speed-preset", "veryfast")
+
+	if p.KeyFrameInterval != 0 {
+		if err = x264Enc.SetProperty("key-int-max", uint(p.KeyFrameInterval*float64(p.Framerate))); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+	}
+
+	if cbr {
+		options, err := applyCBR(p, x264Enc, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err = x264Enc.SetProperty("option-string", strings.Join(options, ":")); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+	}
+
+	caps, err := gst.NewElement("capsfilter")
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = caps.SetProperty("caps", gst.NewCapsFromString(
+		fmt.Sprintf("video/x-h264,profile=%s", types.ProfileMain),
+	)); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	return []*gst.Element{videoQueue, videoScale, scaleCaps, x264Enc, caps}, nil
+}
+
+// applyCBR encodes at a constant bitrate with hrd signaling, so that x264 pads frames with filler data
+func applyCBR(p *config.PipelineConfig, x264Enc *gst.Element, options []string) ([]string, error) {
+	x264Enc.SetArg("pass", "cbr")
+	if err := x264Enc.SetProperty("vbv-buf-capacity", uint(p.CBR.VBVBuffer.Milliseconds())); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	return append(options, "nal-hrd=cbr"), nil
+}
@@ -0,0 +1,81 @@
+package input
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/tinyzimmer/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+)
+
+const watermarkDownloadTimeout = time.Second * 30
+
+// buildWatermark draws an image over decoded video
+func buildWatermark(p *config.PipelineConfig) (*gst.Element, error) {
+	location := p.Watermark.Image
+	if p.Watermark.IsRemote() {
+		var err error
+		location, err = downloadWatermark(p)
+		if err != nil {
+			return nil, errors.ErrInvalidInput(fmt.Sprintf("watermark: %v", err))
+		}
+	}
+
+	overlay, err := gst.NewElementWithName("gdkpixbufoverlay", "video_watermark")
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = overlay.SetProperty("location", location); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	x, y := p.Watermark.Offsets()
+	if err = overlay.SetProperty("offset-x", x); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = overlay.SetProperty("offset-y", y); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = overlay.SetProperty("alpha", p.Watermark.Opacity); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if p.Watermark.Width != 0 {
+		// height is scaled to keep the aspect ratio
+		if err = overlay.SetProperty("overlay-width", p.Watermark.Width); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+	}
+
+	return overlay, nil
+}
+
+func downloadWatermark(p *config.PipelineConfig) (string, error) {
+	client := &http.Client{Timeout: watermarkDownloadTimeout}
+	resp, err := client.Get(p.Watermark.Image)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	location := path.Join(p.TmpDir, fmt.Sprintf("watermark%s", path.Ext(p.Watermark.ImageName())))
+	f, err := os.Create(location)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err = io.Copy(f, resp.Body); err != nil {
+		return "", err
+	}
+	return location, nil
+}
@@ -0,0 +1,101 @@
+package output
+
+import (
+	"fmt"
+
+	"github.com/tinyzimmer/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/builder"
+	"github.com/livekit/egress/pkg/types"
+)
+
+// alternateAudioBranch muxes an alternate audio track into an mp4 file, tagged with its language
+type alternateAudioBranch struct {
+	queue *gst.Element
+	tags  *gst.Element
+}
+
+// alternateAudioOutput is implemented by outputs which carry alternate audio
+type alternateAudioOutput interface {
+	LinkAlternateAudio(tees []*gst.Element) error
+}
+
+// buildAlternateAudioTees creates a tee for each alternate audio track, so that file and segment outputs can share it
+func (b *Bin) buildAlternateAudioTees(p *config.PipelineConfig) error {
+	for _, a := range p.AlternateAudioTracks {
+		tee, err := gst.NewElementWithName("tee", fmt.Sprintf("audio_%s_tee", a.Language))
+		if err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if p.OutputUpdates {
+			// the file output may be stopped while running
+			if err = tee.SetProperty("allow-not-linked", true); err != nil {
+				return errors.ErrGstPipelineError(err)
+			}
+		}
+		if err = b.bin.Add(tee); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		pad := gst.NewGhostPad(fmt.Sprintf("audio_%s", a.Language), tee.GetStaticPad("sink"))
+		if !b.bin.AddPad(pad.Pad) {
+			return errors.ErrGhostPadFailed
+		}
+		b.alternateAudioTees = append(b.alternateAudioTees, tee)
+		b.alternateAudioPads = append(b.alternateAudioPads, pad)
+	}
+	return nil
+}
+
+func (b *Bin) buildAlternateAudioBranches(p *config.PipelineConfig, egressType types.EgressType) ([]*alternateAudioBranch, error) {
+	branches := make([]*alternateAudioBranch, 0, len(p.AlternateAudioTracks))
+	for _, a := range p.AlternateAudioTracks {
+		queue, err := builder.BuildQueue(fmt.Sprintf("audio_%s_%s_queue", a.Language, egressType), p.Latency, true)
+		if err != nil {
+			return nil, err
+		}
+		tags, err := buildLanguageTags(a.Language)
+		if err != nil {
+			return nil, err
+		}
+		if err = b.bin.AddMany(queue, tags); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+		branches = append(branches, &alternateAudioBranch{queue: queue, tags: tags})
+	}
+	return branches, nil
+}
+
+// buildLanguageTags tags an audio stream with its language, which mp4mux writes to the track header
+func buildLanguageTags(language string) (*gst.Element, error) {
+	tags, err := gst.NewElement("taginject")
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = tags.SetProperty("tags", fmt.Sprintf(`language-code="%s"`, language)); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	return tags, nil
+}
+
+// LinkAlternateAudio links the encoded audio of each alternate audio track, in order
+func (b *Bin) LinkAlternateAudio(alternateSrcs []*gst.GhostPad) error {
+	for i, src := range alternateSrcs {
+		if err := builder.LinkPads(
+			"alternate audio src", src,
+			"alternate audio output", b.alternateAudioPads[i].Pad,
+		); err != nil {
+			return err
+		}
+	}
+
+	for _, out := range b.outputs {
+		if o, ok := out.(alternateAudioOutput); ok {
+			if err := o.LinkAlternateAudio(b.alternateAudioTees); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package output
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/tinyzimmer/go-gst/gst"
 
@@ -19,6 +20,11 @@ type Bin struct {
 
 	audioTee *gst.Element
 	videoTee *gst.Element
+	useTees  bool
+
+	// one tee for each alternate audio track, linked to mp4 file and hls outputs
+	alternateAudioTees []*gst.Element
+	alternateAudioPads []*gst.GhostPad
 
 	outputs map[types.EgressType]output
 }
@@ -44,9 +50,16 @@ func New(ctx context.Context, pipeline *gst.Pipeline, p *config.PipelineConfig)
 		}
 	}
 
+	// hls renditions share the audio, so they need the tees even as a single output.
+	// Output updates link and unlink branches of the tees while running.
+	b.useTees = len(b.outputs) > 1 || p.OutputUpdates
+	if o := p.GetSegmentConfig(); o != nil && len(o.Renditions) > 0 {
+		b.useTees = true
+	}
+
 	// create ghost pads
 	var audioPad, videoPad *gst.GhostPad
-	if len(b.outputs) == 1 {
+	if !b.useTees {
 		for _, out := range b.outputs {
 			audioPad, videoPad = out.CreateGhostPads()
 		}
@@ -58,6 +71,12 @@ func New(ctx context.Context, pipeline *gst.Pipeline, p *config.PipelineConfig)
 			if err != nil {
 				return nil, errors.ErrGstPipelineError(err)
 			}
+			if p.OutputUpdates {
+				// the tee may briefly have no outputs while they are being updated
+				if err = b.audioTee.SetProperty("allow-not-linked", true); err != nil {
+					return nil, errors.ErrGstPipelineError(err)
+				}
+			}
 			if err = b.bin.Add(b.audioTee); err != nil {
 				return nil, errors.ErrGstPipelineError(err)
 			}
@@ -70,6 +89,12 @@ func New(ctx context.Context, pipeline *gst.Pipeline, p *config.PipelineConfig)
 			if err != nil {
 				return nil, errors.ErrGstPipelineError(err)
 			}
+			if p.OutputUpdates {
+				// the tee may briefly have no outputs while they are being updated
+				if err = b.videoTee.SetProperty("allow-not-linked", true); err != nil {
+					return nil, errors.ErrGstPipelineError(err)
+				}
+			}
 			if err = b.bin.Add(b.videoTee); err != nil {
 				return nil, errors.ErrGstPipelineError(err)
 			}
@@ -77,6 +102,30 @@ func New(ctx context.Context, pipeline *gst.Pipeline, p *config.PipelineConfig)
 		}
 	}
 
+	// the proxy file has its own encoder, so it bypasses the video tee
+	if o, ok := b.outputs[types.EgressTypeProxyFile]; ok {
+		videoProxyPad := gst.NewGhostPad("video_proxy", o.(*FileOutput).videoQueue.GetStaticPad("sink"))
+		if !b.bin.AddPad(videoProxyPad.Pad) {
+			return nil, errors.ErrGhostPadFailed
+		}
+	}
+
+	// hls renditions have their own encoders, so they bypass the video tee too
+	if o, ok := b.outputs[types.EgressTypeSegments]; ok {
+		for i, r := range o.(*SegmentOutput).renditions {
+			renditionPad := gst.NewGhostPad(fmt.Sprintf("video_rendition_%d", i), r.videoQueue.GetStaticPad("sink"))
+			if !b.bin.AddPad(renditionPad.Pad) {
+				return nil, errors.ErrGhostPadFailed
+			}
+		}
+	}
+
+	if len(p.AlternateAudioTracks) > 0 {
+		if err := b.buildAlternateAudioTees(p); err != nil {
+			return nil, err
+		}
+	}
+
 	// add ghost pads
 	if audioPad != nil && !b.bin.AddPad(audioPad.Pad) {
 		return nil, errors.ErrGhostPadFailed
@@ -95,7 +144,14 @@ func New(ctx context.Context, pipeline *gst.Pipeline, p *config.PipelineConfig)
 func (b *Bin) buildOutput(p *config.PipelineConfig, egressType types.EgressType) error {
 	switch egressType {
 	case types.EgressTypeFile:
-		o, err := b.buildFileOutput(p)
+		o, err := b.buildFileOutput(p, p.GetFileConfig(), egressType)
+		if err != nil {
+			return err
+		}
+		b.outputs[egressType] = o
+
+	case types.EgressTypeProxyFile:
+		o, err := b.buildFileOutput(p, p.GetProxyFileConfig(), egressType)
 		if err != nil {
 			return err
 		}
@@ -129,7 +185,7 @@ func (b *Bin) buildOutput(p *config.PipelineConfig, egressType types.EgressType)
 	return nil
 }
 
-func (b *Bin) Link(audioSrc, videoSrc *gst.GhostPad) error {
+func (b *Bin) Link(audioSrc, videoSrc, videoProxySrc *gst.GhostPad) error {
 	if audioSrc != nil {
 		if err := builder.LinkPads(
 			"audio src", audioSrc,
@@ -146,8 +202,16 @@ func (b *Bin) Link(audioSrc, videoSrc *gst.GhostPad) error {
 			return err
 		}
 	}
+	if videoProxySrc != nil {
+		if err := builder.LinkPads(
+			"video proxy src", videoProxySrc,
+			"video proxy output", b.bin.GetStaticPad("video_proxy"),
+		); err != nil {
+			return err
+		}
+	}
 
-	if len(b.outputs) == 1 {
+	if !b.useTees {
 		for _, out := range b.outputs {
 			if err := out.Link(); err != nil {
 				return err
@@ -155,8 +219,12 @@ func (b *Bin) Link(audioSrc, videoSrc *gst.GhostPad) error {
 		}
 	} else {
 		// link tees to outputs
-		for _, out := range b.outputs {
-			if err := out.LinkTees(b.audioTee, b.videoTee); err != nil {
+		for egressType, out := range b.outputs {
+			videoTee := b.videoTee
+			if egressType == types.EgressTypeProxyFile {
+				videoTee = nil
+			}
+			if err := out.LinkTees(b.audioTee, videoTee); err != nil {
 				return err
 			}
 			if err := out.Link(); err != nil {
@@ -168,6 +236,19 @@ func (b *Bin) Link(audioSrc, videoSrc *gst.GhostPad) error {
 	return nil
 }
 
+// LinkRenditions links the encoded video of each hls rendition, in order
+func (b *Bin) LinkRenditions(renditionSrcs []*gst.GhostPad) error {
+	for i, src := range renditionSrcs {
+		if err := builder.LinkPads(
+			"video rendition src", src,
+			"video rendition output", b.bin.GetStaticPad(fmt.Sprintf("video_rendition_%d", i)),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (b *Bin) AddStream(url string) error {
 	o := b.outputs[types.EgressTypeStream]
 	if o == nil {
@@ -186,6 +267,42 @@ func (b *Bin) GetStreamUrl(name string) (string, error) {
 	return o.(*StreamOutput).GetUrl(name)
 }
 
+func (b *Bin) GetStreamBytesSent(url string) uint64 {
+	o := b.outputs[types.EgressTypeStream]
+	if o == nil {
+		return 0
+	}
+
+	return o.(*StreamOutput).GetBytesSent(url)
+}
+
+func (b *Bin) BeginStreamReconnect(url string) bool {
+	o := b.outputs[types.EgressTypeStream]
+	if o == nil {
+		return false
+	}
+
+	return o.(*StreamOutput).BeginReconnect(url)
+}
+
+func (b *Bin) ReconnectStream(url string) error {
+	o := b.outputs[types.EgressTypeStream]
+	if o == nil {
+		return errors.ErrStreamNotFound(url)
+	}
+
+	return o.(*StreamOutput).Reconnect(b.bin, url)
+}
+
+func (b *Bin) GetStreamReconnects(url string) int {
+	o := b.outputs[types.EgressTypeStream]
+	if o == nil {
+		return 0
+	}
+
+	return o.(*StreamOutput).GetReconnects(url)
+}
+
 func (b *Bin) RemoveStream(url string) error {
 	o := b.outputs[types.EgressTypeStream]
 	if o == nil {
@@ -195,6 +312,17 @@ func (b *Bin) RemoveStream(url string) error {
 	return o.(*StreamOutput).RemoveSink(b.bin, url)
 }
 
+// SetFileIndex records the offsets of buffers written by the file output
+func (b *Bin) SetFileIndex(index *sink.FileIndex) error {
+	o := b.outputs[types.EgressTypeFile]
+	if o == nil {
+		return psrpc.NewErrorf(psrpc.Internal, "missing file output")
+	}
+
+	o.(*FileOutput).SetIndex(index)
+	return nil
+}
+
 func (b *Bin) SetWebsocketSink(writer *sink.WebsocketSink) error {
 	o := b.outputs[types.EgressTypeWebsocket]
 	if o == nil {
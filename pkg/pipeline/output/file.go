@@ -1,30 +1,36 @@
 package output
 
 import (
+	"fmt"
+
 	"github.com/tinyzimmer/go-gst/gst"
 
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/pipeline/builder"
+	"github.com/livekit/egress/pkg/pipeline/sink"
 	"github.com/livekit/egress/pkg/types"
 )
 
 type FileOutput struct {
 	*outputBase
 
+	tags *gst.Element // timecode tag for webm, which has no timecode track
 	mux  *gst.Element
 	sink *gst.Element
-}
 
-func (b *Bin) buildFileOutput(p *config.PipelineConfig) (*FileOutput, error) {
-	o := p.GetFileConfig()
+	// mp4 files with alternate audio tag each audio track with its language
+	audioTags      *gst.Element
+	alternateAudio []*alternateAudioBranch
+}
 
-	base, err := b.buildOutputBase(p, types.EgressTypeFile)
+func (b *Bin) buildFileOutput(p *config.PipelineConfig, o *config.FileConfig, egressType types.EgressType) (*FileOutput, error) {
+	base, err := b.buildOutputBase(p, egressType)
 	if err != nil {
 		return nil, errors.ErrGstPipelineError(err)
 	}
 
-	mux, err := buildFileMux(o)
+	mux, err := buildFileMux(p, o)
 	if err != nil {
 		return nil, err
 	}
@@ -41,39 +47,130 @@ func (b *Bin) buildFileOutput(p *config.PipelineConfig) (*FileOutput, error) {
 		return nil, errors.ErrGstPipelineError(err)
 	}
 
-	if err = b.bin.AddMany(mux, sink); err != nil {
+	if err = b.bin.Add(sink); err != nil {
 		return nil, errors.ErrGstPipelineError(err)
 	}
+	if mux != nil {
+		if err = b.bin.Add(mux); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+	}
 
-	return &FileOutput{
+	f := &FileOutput{
 		outputBase: base,
 		mux:        mux,
 		sink:       sink,
-	}, nil
+	}
+
+	if o.OutputType == types.OutputTypeWebM && p.VideoTranscoding && p.Timecode != nil && p.Timecode.Start != "" {
+		f.tags, err = gst.NewElement("taginject")
+		if err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+		if err = f.tags.SetProperty("tags", fmt.Sprintf(`extended-comment="TIMECODE=%s"`, p.Timecode.Start)); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+		if err = b.bin.Add(f.tags); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+	}
+
+	if egressType == types.EgressTypeFile && o.OutputType == types.OutputTypeMP4 && len(p.AlternateAudioTracks) > 0 {
+		if f.audioTags, err = buildLanguageTags(p.AlternateAudio.Language); err != nil {
+			return nil, err
+		}
+		if err = b.bin.Add(f.audioTags); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+		if f.alternateAudio, err = b.buildAlternateAudioBranches(p, egressType); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
 }
 
-func buildFileMux(o *config.FileConfig) (*gst.Element, error) {
+func buildFileMux(p *config.PipelineConfig, o *config.FileConfig) (*gst.Element, error) {
 	switch o.OutputType {
-	case types.OutputTypeOGG:
-		return gst.NewElement("oggmux")
+	case types.OutputTypeOGG, types.OutputTypeIVF, types.OutputTypeWebM, types.OutputTypeMP3, types.OutputTypeWAV:
+		return buildMuxer(p, o.OutputType)
 
-	case types.OutputTypeIVF:
-		return gst.NewElement("avmux_ivf")
+	case types.OutputTypeRaw:
+		// raw pcm is written without a container
+		return nil, nil
 
 	case types.OutputTypeMP4:
-		return gst.NewElement("mp4mux")
+		mux, err := buildMuxer(p, o.OutputType)
+		if err != nil {
+			return nil, err
+		}
 
-	case types.OutputTypeWebM:
-		return gst.NewElement("webmmux")
+		// muxer property overrides take precedence
+		if _, properties := p.GetMuxer(o.OutputType); p.FaststartMP4 && properties["faststart"] == "" {
+			// media is written to a temporary file, then copied after the moov atom on EOS
+			if err = mux.SetProperty("faststart", true); err != nil {
+				return nil, errors.ErrGstPipelineError(err)
+			}
+			if err = mux.SetProperty("faststart-file", o.FaststartFilepath()); err != nil {
+				return nil, errors.ErrGstPipelineError(err)
+			}
+		}
+		return mux, nil
 
 	default:
 		return nil, errors.ErrInvalidInput("output type")
 	}
 }
 
+// SetIndex passes the timestamp and size of each buffer written to the file to the index
+func (o *FileOutput) SetIndex(index *sink.FileIndex) {
+	o.sink.GetStaticPad("sink").AddProbe(gst.PadProbeTypeBuffer|gst.PadProbeTypeEventDownstream, func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+		if event := info.GetEvent(); event != nil {
+			// muxers seek back to rewrite their headers with byte segments
+			if event.Type() == gst.EventTypeSegment {
+				if segment := event.ParseSegment(); segment.GetFormat() == gst.FormatBytes {
+					index.OnSeek(int64(segment.GetStart()))
+				}
+			}
+			return gst.PadProbeOK
+		}
+
+		if buffer := info.GetBuffer(); buffer != nil {
+			index.OnBuffer(buffer.PresentationTimestamp(), buffer.GetSize(), !buffer.HasFlags(gst.BufferFlagDeltaUnit))
+		}
+		return gst.PadProbeOK
+	})
+}
+
 func (o *FileOutput) Link() error {
+	// raw pcm is written directly
+	if o.mux == nil {
+		if err := o.audioQueue.Link(o.sink); err != nil {
+			return errors.ErrPadLinkFailed("audio queue", "sink", err.Error())
+		}
+		return nil
+	}
+
 	// link audio to mux
-	if o.audioQueue != nil {
+	if o.audioQueue != nil && o.mux.GetStaticPad("sink") != nil {
+		// mp3 and wav muxers take a single stream
+		if err := builder.LinkPads(
+			"audio queue", o.audioQueue.GetStaticPad("src"),
+			"file mux", o.mux.GetStaticPad("sink"),
+		); err != nil {
+			return err
+		}
+	} else if o.audioQueue != nil && o.audioTags != nil {
+		if err := o.audioQueue.Link(o.audioTags); err != nil {
+			return errors.ErrPadLinkFailed("audio queue", "taginject", err.Error())
+		}
+		if err := builder.LinkPads(
+			"taginject", o.audioTags.GetStaticPad("src"),
+			"file mux", o.mux.GetRequestPad("audio_%u"),
+		); err != nil {
+			return err
+		}
+	} else if o.audioQueue != nil {
 		if err := builder.LinkPads(
 			"audio queue", o.audioQueue.GetStaticPad("src"),
 			"file mux", o.mux.GetRequestPad("audio_%u"),
@@ -83,7 +180,17 @@ func (o *FileOutput) Link() error {
 	}
 
 	// link video to mux
-	if o.videoQueue != nil {
+	if o.videoQueue != nil && o.tags != nil {
+		if err := o.videoQueue.Link(o.tags); err != nil {
+			return errors.ErrPadLinkFailed("video queue", "taginject", err.Error())
+		}
+		if err := builder.LinkPads(
+			"taginject", o.tags.GetStaticPad("src"),
+			"file mux", o.mux.GetRequestPad("video_%u"),
+		); err != nil {
+			return err
+		}
+	} else if o.videoQueue != nil {
 		if err := builder.LinkPads(
 			"video queue", o.videoQueue.GetStaticPad("src"),
 			"file mux", o.mux.GetRequestPad("video_%u"),
@@ -99,3 +206,25 @@ func (o *FileOutput) Link() error {
 
 	return nil
 }
+
+// LinkAlternateAudio muxes each alternate audio track after the main audio and video
+func (o *FileOutput) LinkAlternateAudio(tees []*gst.Element) error {
+	for i, a := range o.alternateAudio {
+		if err := builder.LinkPads(
+			"alternate audio tee", tees[i].GetRequestPad("src_%u"),
+			"alternate audio queue", a.queue.GetStaticPad("sink"),
+		); err != nil {
+			return err
+		}
+		if err := a.queue.Link(a.tags); err != nil {
+			return errors.ErrPadLinkFailed("alternate audio queue", "taginject", err.Error())
+		}
+		if err := builder.LinkPads(
+			"taginject", a.tags.GetStaticPad("src"),
+			"file mux", o.mux.GetRequestPad("audio_%u"),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package output
+
+import (
+	"github.com/tinyzimmer/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
+)
+
+// buildMuxer creates the configured muxer for an output type, and applies any property overrides
+func buildMuxer(p *config.PipelineConfig, outputType types.OutputType) (*gst.Element, error) {
+	element, properties := p.GetMuxer(outputType)
+	mux, err := gst.NewElement(element)
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	for name, value := range properties {
+		// parsed according to the property type
+		mux.SetArg(name, value)
+	}
+
+	return mux, nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/tinyzimmer/go-gst/gst"
 
+	"github.com/livekit/egress/pkg/clock"
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/pipeline/builder"
@@ -19,9 +20,19 @@ type SegmentOutput struct {
 	*outputBase
 
 	sink      *gst.Element
-	h264parse *gst.Element
+	h264parse *gst.Element // nil for webm segments
 
-	startDate time.Time
+	renditions      []*segmentRendition
+	audioRenditions []*segmentRendition // alternate audio, without video
+}
+
+// segmentRendition is a lower resolution copy of the hls output. Its video is encoded separately, and bypasses the video tee.
+// Alternate audio renditions have no video, and their audio comes from an alternate audio tee
+type segmentRendition struct {
+	*outputBase
+
+	sink      *gst.Element
+	h264parse *gst.Element
 }
 
 type FirstSampleMetadata struct {
@@ -31,32 +42,161 @@ type FirstSampleMetadata struct {
 func (b *Bin) buildSegmentOutput(p *config.PipelineConfig) (*SegmentOutput, error) {
 	o := p.GetSegmentConfig()
 
-	s := &SegmentOutput{}
-
 	base, err := b.buildOutputBase(p, types.EgressTypeSegments)
 	if err != nil {
 		return nil, errors.ErrGstPipelineError(err)
 	}
-
-	h264parse, err := gst.NewElement("h264parse")
+	sink, h264parse, err := b.buildSplitMuxSink(p, o)
 	if err != nil {
 		return nil, err
 	}
 
-	sink, err := gst.NewElement("splitmuxsink")
+	s := &SegmentOutput{
+		outputBase: base,
+		sink:       sink,
+		h264parse:  h264parse,
+	}
+
+	for _, r := range o.Renditions {
+		base, err = b.buildOutputBase(p, types.EgressType("rendition_"+r.Rendition.Name))
+		if err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+		sink, h264parse, err = b.buildSplitMuxSink(p, r)
+		if err != nil {
+			return nil, err
+		}
+		s.renditions = append(s.renditions, &segmentRendition{
+			outputBase: base,
+			sink:       sink,
+			h264parse:  h264parse,
+		})
+	}
+
+	for _, r := range o.AudioRenditions {
+		audioQueue, err := builder.BuildQueue(fmt.Sprintf("audio_%s_%s_queue", r.AudioRendition.Language, types.EgressTypeSegments), p.Latency, true)
+		if err != nil {
+			return nil, err
+		}
+		if err = b.bin.Add(audioQueue); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+		if sink, _, err = b.buildSplitMuxSink(p, r); err != nil {
+			return nil, err
+		}
+		s.audioRenditions = append(s.audioRenditions, &segmentRendition{
+			outputBase: &outputBase{audioQueue: audioQueue},
+			sink:       sink,
+		})
+	}
+
+	return s, nil
+}
+
+func (b *Bin) buildSplitMuxSink(p *config.PipelineConfig, o *config.SegmentConfig) (*gst.Element, *gst.Element, error) {
+	var sink *gst.Element
+	var err error
+	if name := o.SinkName(); name != "" {
+		// renditions are named, so that their messages can be told apart
+		sink, err = gst.NewElementWithName("splitmuxsink", name)
+	} else {
+		sink, err = gst.NewElement("splitmuxsink")
+	}
 	if err != nil {
-		return nil, errors.ErrGstPipelineError(err)
+		return nil, nil, errors.ErrGstPipelineError(err)
 	}
-	if err = sink.SetProperty("max-size-time", uint64(time.Duration(o.SegmentDuration)*time.Second)); err != nil {
-		return nil, errors.ErrGstPipelineError(err)
+	maxSizeTime := time.Duration(o.SegmentDuration) * time.Second
+	if o.PartDuration > 0 {
+		// each fragment is a part, and the segment sink joins them into segments
+		maxSizeTime = o.PartDuration
+	}
+	if err = sink.SetProperty("max-size-time", uint64(maxSizeTime)); err != nil {
+		return nil, nil, errors.ErrGstPipelineError(err)
 	}
 	if err = sink.SetProperty("send-keyframe-requests", true); err != nil {
-		return nil, errors.ErrGstPipelineError(err)
+		return nil, nil, errors.ErrGstPipelineError(err)
 	}
-	if err = sink.SetProperty("muxer-factory", "mpegtsmux"); err != nil {
-		return nil, errors.ErrGstPipelineError(err)
+
+	ext := "ts"
+	switch {
+	case o.OutputType == types.OutputTypeMSE:
+		ext = "webm"
+
+		// streamable webm has no cues and unknown element sizes, so clusters can be appended to the init segment
+		webmMux, err := buildMuxer(p, types.OutputTypeWebM)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = webmMux.SetProperty("streamable", true); err != nil {
+			return nil, nil, errors.ErrGstPipelineError(err)
+		}
+		if err = sink.SetProperty("muxer", webmMux); err != nil {
+			return nil, nil, errors.ErrGstPipelineError(err)
+		}
+
+	case o.FMP4:
+		ext = "m4s"
+
+		// each segment is written as a fragmented mp4, which the segment sink splits into the init segment and media
+		mp4Mux, err := buildMuxer(p, types.OutputTypeMP4)
+		if err != nil {
+			return nil, nil, err
+		}
+		fragmentDuration := uint(o.SegmentDuration * 1000)
+		if o.ChunkDuration > 0 {
+			// fragments are streamed as they are written, so headers are never rewritten and writes are not buffered
+			fragmentDuration = uint(o.ChunkDuration.Milliseconds())
+			if err = mp4Mux.SetProperty("streamable", true); err != nil {
+				return nil, nil, errors.ErrGstPipelineError(err)
+			}
+			fileSink, err := gst.NewElement("filesink")
+			if err != nil {
+				return nil, nil, errors.ErrGstPipelineError(err)
+			}
+			fileSink.SetArg("buffer-mode", "unbuffered")
+			if err = sink.SetProperty("sink", fileSink); err != nil {
+				return nil, nil, errors.ErrGstPipelineError(err)
+			}
+		}
+		if err = mp4Mux.SetProperty("fragment-duration", fragmentDuration); err != nil {
+			return nil, nil, errors.ErrGstPipelineError(err)
+		}
+		if err = sink.SetProperty("muxer", mp4Mux); err != nil {
+			return nil, nil, errors.ErrGstPipelineError(err)
+		}
+
+	default:
+		tsMux, err := buildMuxer(p, types.OutputTypeTS)
+		if err != nil {
+			return nil, nil, err
+		}
+		// muxer property overrides take precedence
+		if _, properties := p.GetMuxer(types.OutputTypeTS); properties["bitrate"] == "" {
+			if rate := p.TSMuxRate(o); rate > 0 {
+				// null packets pad the multiplex to a constant rate
+				if err = tsMux.SetProperty("bitrate", rate); err != nil {
+					return nil, nil, errors.ErrGstPipelineError(err)
+				}
+			}
+		}
+		if err = sink.SetProperty("muxer", tsMux); err != nil {
+			return nil, nil, errors.ErrGstPipelineError(err)
+		}
 	}
 
+	var h264parse *gst.Element
+	if o.OutputType != types.OutputTypeMSE && o.AudioRendition == nil {
+		h264parse, err = gst.NewElement("h264parse")
+		if err != nil {
+			return nil, nil, errors.ErrGstPipelineError(err)
+		}
+		if err = b.bin.Add(h264parse); err != nil {
+			return nil, nil, errors.ErrGstPipelineError(err)
+		}
+	}
+
+	var startDate time.Time
+
 	_, err = sink.Connect("format-location-full", func(self *gst.Element, fragmentId uint, firstSample *gst.Sample) string {
 		var pts time.Duration
 		if firstSample != nil && firstSample.GetBuffer() != nil {
@@ -65,10 +205,10 @@ func (b *Bin) buildSegmentOutput(p *config.PipelineConfig) (*SegmentOutput, erro
 			logger.Infow("nil sample passed into 'format-location-full' event handler, assuming 0 pts")
 		}
 
-		if s.startDate.IsZero() {
-			now := time.Now()
+		if startDate.IsZero() {
+			now := clock.Now()
 
-			s.startDate = now.Add(-pts)
+			startDate = now.Add(-pts)
 
 			mdata := FirstSampleMetadata{
 				StartDate: now.UnixNano(),
@@ -78,50 +218,101 @@ func (b *Bin) buildSegmentOutput(p *config.PipelineConfig) (*SegmentOutput, erro
 			sink.GetBus().Post(msg)
 		}
 
+		if o.PartDuration > 0 {
+			return path.Join(o.LocalDir, o.PartFilename(int(fragmentId)))
+		}
+
 		var segmentName string
 		switch o.SegmentSuffix {
 		case livekit.SegmentedFileSuffix_TIMESTAMP:
-			ts := s.startDate.Add(pts)
-			segmentName = fmt.Sprintf("%s_%s%03d.ts", o.SegmentPrefix, ts.Format("20060102150405"), ts.UnixMilli()%1000)
+			ts := startDate.Add(pts)
+			segmentName = fmt.Sprintf("%s_%s%03d.%s", o.SegmentPrefix, ts.Format("20060102150405"), ts.UnixMilli()%1000, ext)
 		default:
-			segmentName = fmt.Sprintf("%s_%05d.ts", o.SegmentPrefix, fragmentId)
+			segmentName = fmt.Sprintf("%s_%05d.%s", o.SegmentPrefix, fragmentId, ext)
 		}
 		return path.Join(o.LocalDir, segmentName)
 	})
 	if err != nil {
-		return nil, errors.ErrGstPipelineError(err)
+		return nil, nil, errors.ErrGstPipelineError(err)
 	}
 
-	if err = b.bin.AddMany(h264parse, sink); err != nil {
-		return nil, errors.ErrGstPipelineError(err)
+	if err = b.bin.Add(sink); err != nil {
+		return nil, nil, errors.ErrGstPipelineError(err)
 	}
 
-	s.outputBase = base
-	s.h264parse = h264parse
-	s.sink = sink
+	return sink, h264parse, nil
+}
+
+func (o *SegmentOutput) LinkTees(audioTee, videoTee *gst.Element) error {
+	if err := o.outputBase.LinkTees(audioTee, videoTee); err != nil {
+		return err
+	}
 
-	return s, nil
+	// rendition video comes from its own encoder
+	for _, r := range o.renditions {
+		if err := r.LinkTees(audioTee, nil); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (o *SegmentOutput) Link() error {
+	if err := linkSplitMuxSink(o.outputBase, o.h264parse, o.sink); err != nil {
+		return err
+	}
+	for _, r := range o.renditions {
+		if err := linkSplitMuxSink(r.outputBase, r.h264parse, r.sink); err != nil {
+			return err
+		}
+	}
+	for _, r := range o.audioRenditions {
+		if err := linkSplitMuxSink(r.outputBase, nil, r.sink); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LinkAlternateAudio links each alternate audio track to its audio only rendition
+func (o *SegmentOutput) LinkAlternateAudio(tees []*gst.Element) error {
+	for i, r := range o.audioRenditions {
+		if err := builder.LinkPads(
+			"alternate audio tee", tees[i].GetRequestPad("src_%u"),
+			"alternate audio queue", r.audioQueue.GetStaticPad("sink"),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func linkSplitMuxSink(o *outputBase, h264parse, sink *gst.Element) error {
 	// link audio to sink
 	if o.audioQueue != nil {
 		if err := builder.LinkPads(
 			"audio queue", o.audioQueue.GetStaticPad("src"),
-			"split mux", o.sink.GetRequestPad("audio_%u"),
+			"split mux", sink.GetRequestPad("audio_%u"),
 		); err != nil {
 			return err
 		}
 	}
 
 	// link video to sink
-	if o.videoQueue != nil {
-		if err := o.videoQueue.Link(o.h264parse); err != nil {
+	if o.videoQueue != nil && h264parse == nil {
+		if err := builder.LinkPads(
+			"video queue", o.videoQueue.GetStaticPad("src"),
+			"split mux", sink.GetRequestPad("video"),
+		); err != nil {
+			return err
+		}
+	} else if o.videoQueue != nil {
+		if err := o.videoQueue.Link(h264parse); err != nil {
 			return errors.ErrPadLinkFailed("video queue", "h264parse", err.Error())
 		}
 		if err := builder.LinkPads(
-			"h264parse", o.h264parse.GetStaticPad("src"),
-			"split mux", o.sink.GetRequestPad("video"),
+			"h264parse", h264parse.GetStaticPad("src"),
+			"split mux", sink.GetRequestPad("video"),
 		); err != nil {
 			return err
 		}
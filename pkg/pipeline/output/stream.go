@@ -3,8 +3,10 @@ package output
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/tinyzimmer/go-gst/gst"
+	"go.uber.org/atomic"
 
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
@@ -20,9 +22,10 @@ type StreamOutput struct {
 	sync.RWMutex
 	protocol types.OutputType
 
-	mux   *gst.Element
-	tee   *gst.Element
-	sinks map[string]*streamSink
+	mux    *gst.Element
+	tee    *gst.Element
+	sinks  map[string]*streamSink
+	buffer time.Duration // queued while reconnecting, 0 without reconnects
 }
 
 func (b *Bin) buildStreamOutput(p *config.PipelineConfig) (*StreamOutput, error) {
@@ -51,9 +54,14 @@ func (b *Bin) buildStreamOutput(p *config.PipelineConfig) (*StreamOutput, error)
 		return nil, errors.ErrGstPipelineError(err)
 	}
 
+	var buffer time.Duration
+	if p.RTMPReconnect != nil {
+		buffer = p.RTMPReconnect.Buffer
+	}
+
 	sinks := make(map[string]*streamSink)
 	for _, url := range o.Urls {
-		sink, err := buildStreamSink(o.OutputType, url)
+		sink, err := buildStreamSink(o.OutputType, url, buffer)
 		if err != nil {
 			return nil, err
 		}
@@ -71,6 +79,7 @@ func (b *Bin) buildStreamOutput(p *config.PipelineConfig) (*StreamOutput, error)
 		mux:        mux,
 		tee:        tee,
 		sinks:      sinks,
+		buffer:     buffer,
 	}, nil
 }
 
@@ -96,30 +105,31 @@ func buildStreamMux(p *config.PipelineConfig, o *config.StreamConfig) (*gst.Elem
 	}
 }
 
-func buildStreamSink(protocol types.OutputType, url string) (*streamSink, error) {
+func buildStreamSink(protocol types.OutputType, url string, buffer time.Duration) (*streamSink, error) {
 	id := utils.NewGuid("")
 
-	queue, err := gst.NewElementWithName("queue", fmt.Sprintf("stream_queue_%s", id))
-	if err != nil {
-		return nil, errors.ErrGstPipelineError(err)
+	var queue *gst.Element
+	var err error
+	if buffer > 0 {
+		// the queue holds the last few seconds while the sink is reconnecting
+		queue, err = builder.BuildQueue(fmt.Sprintf("stream_queue_%s", id), uint64(buffer), true)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		queue, err = gst.NewElementWithName("queue", fmt.Sprintf("stream_queue_%s", id))
+		if err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+		queue.SetArg("leaky", "downstream")
 	}
-	queue.SetArg("leaky", "downstream")
 
 	var sink *gst.Element
 	switch protocol {
 	case types.OutputTypeRTMP:
-		sink, err = gst.NewElementWithName("rtmp2sink", fmt.Sprintf("rtmp2sink_%s", id))
+		sink, err = buildRTMPSink(fmt.Sprintf("rtmp2sink_%s", id), url)
 		if err != nil {
-			return nil, errors.ErrGstPipelineError(err)
-		}
-		if err = sink.SetProperty("sync", false); err != nil {
-			return nil, errors.ErrGstPipelineError(err)
-		}
-		if err = sink.SetProperty("async-connect", false); err != nil {
-			return nil, errors.ErrGstPipelineError(err)
-		}
-		if err = sink.Set("location", url); err != nil {
-			return nil, errors.ErrGstPipelineError(err)
+			return nil, err
 		}
 	}
 
@@ -129,6 +139,23 @@ func buildStreamSink(protocol types.OutputType, url string) (*streamSink, error)
 	}, nil
 }
 
+func buildRTMPSink(name, url string) (*gst.Element, error) {
+	sink, err := gst.NewElementWithName("rtmp2sink", name)
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = sink.SetProperty("sync", false); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = sink.SetProperty("async-connect", false); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = sink.Set("location", url); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	return sink, nil
+}
+
 func (o *StreamOutput) Link() error {
 	o.RLock()
 	defer o.RUnlock()
@@ -181,6 +208,17 @@ func (o *StreamOutput) GetUrl(name string) (string, error) {
 	return "", errors.ErrStreamNotFound(name)
 }
 
+// GetBytesSent returns the number of bytes written to the url's sink
+func (o *StreamOutput) GetBytesSent(url string) uint64 {
+	o.RLock()
+	defer o.RUnlock()
+
+	if sink, ok := o.sinks[url]; ok {
+		return sink.bytesSent.Load()
+	}
+	return 0
+}
+
 func (o *StreamOutput) AddSink(bin *gst.Bin, url string) error {
 	o.Lock()
 	defer o.Unlock()
@@ -189,7 +227,7 @@ func (o *StreamOutput) AddSink(bin *gst.Bin, url string) error {
 		return errors.ErrStreamAlreadyExists
 	}
 
-	sink, err := buildStreamSink(o.protocol, url)
+	sink, err := buildStreamSink(o.protocol, url, o.buffer)
 	if err != nil {
 		return err
 	}
@@ -249,10 +287,92 @@ func (o *StreamOutput) RemoveSink(bin *gst.Bin, url string) error {
 	return nil
 }
 
+// BeginReconnect holds the url's queue until Reconnect succeeds.
+// It returns false if the url is unknown or already reconnecting.
+func (o *StreamOutput) BeginReconnect(url string) bool {
+	o.Lock()
+	defer o.Unlock()
+
+	sink, ok := o.sinks[url]
+	if !ok || sink.reconnecting {
+		return false
+	}
+
+	// block the queue, which keeps the last buffer duration of media until the sink is replaced
+	sink.reconnecting = true
+	sink.blockProbe = sink.queue.GetStaticPad("src").AddProbe(gst.PadProbeTypeBlockDownstream,
+		func(_ *gst.Pad, _ *gst.PadProbeInfo) gst.PadProbeReturn {
+			return gst.PadProbeOK
+		},
+	)
+	return true
+}
+
+// Reconnect replaces the url's rtmp2sink with a new connection, and releases the queue on success
+func (o *StreamOutput) Reconnect(bin *gst.Bin, url string) error {
+	o.Lock()
+	defer o.Unlock()
+
+	sink, ok := o.sinks[url]
+	if !ok {
+		return errors.ErrStreamNotFound(url)
+	}
+
+	name := sink.sink.GetName()
+	if err := sink.sink.SetState(gst.StateNull); err != nil {
+		logger.Warnw("failed to stop rtmp sink", err)
+	}
+	if err := bin.Remove(sink.sink); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+
+	rtmpSink, err := buildRTMPSink(name, url)
+	if err != nil {
+		return err
+	}
+	if err = bin.Add(rtmpSink); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	sink.sink = rtmpSink
+
+	if !sink.proxy.SetTarget(rtmpSink.GetStaticPad("sink")) {
+		return errors.ErrGstPipelineError(errors.New("failed to retarget rtmp proxy"))
+	}
+	if !rtmpSink.SyncStateWithParent() {
+		// leave the failed sink in the bin, to be replaced by the next attempt
+		_ = rtmpSink.SetState(gst.StateNull)
+		return errors.ErrGstPipelineError(errors.New("failed to connect rtmp sink"))
+	}
+
+	sink.queue.GetStaticPad("src").RemoveProbe(sink.blockProbe)
+	sink.blockProbe = 0
+	sink.reconnecting = false
+	sink.reconnects++
+	return nil
+}
+
+// GetReconnects returns the number of successful reconnects for the url
+func (o *StreamOutput) GetReconnects(url string) int {
+	o.RLock()
+	defer o.RUnlock()
+
+	if sink, ok := o.sinks[url]; ok {
+		return sink.reconnects
+	}
+	return 0
+}
+
 type streamSink struct {
-	pad   string
-	queue *gst.Element
-	sink  *gst.Element
+	pad       string
+	queue     *gst.Element
+	sink      *gst.Element
+	proxy     *gst.GhostPad
+	bytesSent atomic.Uint64
+
+	// reconnects only
+	blockProbe   uint64 // holds the queue while disconnected
+	reconnecting bool
+	reconnects   int
 }
 
 func (o *streamSink) link(tee *gst.Element, live bool) error {
@@ -260,9 +380,10 @@ func (o *streamSink) link(tee *gst.Element, live bool) error {
 
 	proxy := gst.NewGhostPad("proxy", sinkPad)
 
-	// Proxy isn't saved/stored anywhere, so we need to call ref.
+	// Proxy isn't stored in a bin, so we need to call ref.
 	// It is later released in RemoveSink
 	proxy.Ref()
+	o.proxy = proxy
 
 	// Intercept flows from rtmp2sink. Anything besides EOS will be ignored
 	proxy.SetChainFunction(func(self *gst.Pad, _ *gst.Object, buffer *gst.Buffer) gst.FlowReturn {
@@ -278,9 +399,11 @@ func (o *streamSink) link(tee *gst.Element, live bool) error {
 		}
 
 		// push buffer to rtmp2sink sink pad
+		size := buffer.GetSize()
 		if internal[0].Push(buffer) == gst.FlowEOS {
 			return gst.FlowEOS
 		}
+		o.bytesSent.Add(uint64(size))
 
 		return gst.FlowOK
 	})
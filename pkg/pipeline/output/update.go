@@ -0,0 +1,125 @@
+package output
+
+import (
+	"github.com/tinyzimmer/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/builder"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/logger"
+)
+
+// AddSegmentOutput builds a segment output while the pipeline is running, and links it to the tees
+func (b *Bin) AddSegmentOutput(p *config.PipelineConfig) error {
+	if !b.useTees {
+		return errors.ErrNotSupported("output updates without output_updates enabled")
+	}
+	if _, ok := b.outputs[types.EgressTypeSegments]; ok {
+		return errors.ErrInvalidInput("multiple segmented file outputs")
+	}
+
+	o, err := b.buildSegmentOutput(p)
+	if err != nil {
+		return err
+	}
+	if err = o.Link(); err != nil {
+		return err
+	}
+
+	// start from the sink, so that the branch is ready before it receives data
+	for _, e := range []*gst.Element{o.sink, o.h264parse, o.audioQueue, o.videoQueue} {
+		if e != nil {
+			e.SyncStateWithParent()
+		}
+	}
+
+	if o.audioQueue != nil {
+		linkTeeLive("audio", b.audioTee, o.audioQueue)
+	}
+	if o.videoQueue != nil {
+		linkTeeLive("video", b.videoTee, o.videoQueue)
+	}
+
+	b.outputs[types.EgressTypeSegments] = o
+	return nil
+}
+
+// linkTeeLive links a tee to a queue once the tee pad is blocked, as required for an active pipeline
+func linkTeeLive(name string, tee, queue *gst.Element) {
+	tee.GetRequestPad("src_%u").AddProbe(gst.PadProbeTypeBlockDownstream, func(pad *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+		if err := builder.LinkPads(name+" tee", pad, name+" queue", queue.GetStaticPad("sink")); err != nil {
+			logger.Errorw("failed to link tee to queue", err)
+			return gst.PadProbeUnhandled
+		}
+		return gst.PadProbeRemove
+	})
+}
+
+// RemoveFileOutput sends EOS to the file output while the rest of the pipeline keeps running.
+// onStopped is called once the file has been written and its elements removed.
+func (b *Bin) RemoveFileOutput(onStopped func()) error {
+	if !b.useTees {
+		return errors.ErrNotSupported("output updates without output_updates enabled")
+	}
+	out, ok := b.outputs[types.EgressTypeFile]
+	if !ok {
+		return errors.ErrInvalidInput("file output")
+	}
+	o := out.(*FileOutput)
+
+	// the muxer writes its trailer on EOS, so the file is complete once EOS reaches the sink
+	o.sink.GetStaticPad("sink").AddProbe(gst.PadProbeTypeEventDownstream, func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+		if info.GetEvent().Type() != gst.EventTypeEOS {
+			return gst.PadProbeOK
+		}
+
+		// elements can't be stopped from their own streaming thread
+		go func() {
+			// setting the state waits for the sink to handle EOS
+			for _, e := range []*gst.Element{o.audioQueue, o.videoQueue, o.tags, o.mux, o.sink} {
+				if e == nil {
+					continue
+				}
+				if err := e.SetState(gst.StateNull); err != nil {
+					logger.Errorw("failed to stop file output element", err, "element", e.GetName())
+				}
+				if err := b.bin.Remove(e); err != nil {
+					logger.Errorw("failed to remove file output element", err, "element", e.GetName())
+				}
+			}
+			onStopped()
+		}()
+		return gst.PadProbeRemove
+	})
+
+	if o.audioQueue != nil {
+		unlinkTeeLive(b.audioTee, o.audioQueue)
+	}
+	if o.videoQueue != nil {
+		unlinkTeeLive(b.videoTee, o.videoQueue)
+	}
+
+	delete(b.outputs, types.EgressTypeFile)
+	return nil
+}
+
+// unlinkTeeLive unlinks a queue from its tee once the tee pad is blocked, and sends it EOS
+func unlinkTeeLive(tee, queue *gst.Element) {
+	sinkPad := queue.GetStaticPad("sink")
+	sinkPad.GetPeer().AddProbe(gst.PadProbeTypeBlockDownstream, func(pad *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+		// remove probe
+		pad.RemoveProbe(uint64(info.ID()))
+
+		// unlink queue
+		pad.Unlink(sinkPad)
+
+		// send EOS to queue
+		sinkPad.SendEvent(gst.NewEOSEvent())
+
+		// release tee src pad
+		tee.ReleaseRequestPad(pad)
+
+		return gst.PadProbeOK
+	})
+}
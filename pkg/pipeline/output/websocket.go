@@ -18,6 +18,9 @@ type WebsocketOutput struct {
 
 	conf *config.PipelineConfig
 	sink *app.Sink
+
+	// h264 is sent as annex b access units, so that each message holds a whole frame
+	h264Caps *gst.Element
 }
 
 func (b *Bin) buildWebsocketOutput(p *config.PipelineConfig) (*WebsocketOutput, error) {
@@ -35,10 +38,28 @@ func (b *Bin) buildWebsocketOutput(p *config.PipelineConfig) (*WebsocketOutput,
 		return nil, errors.ErrGstPipelineError(err)
 	}
 
-	return &WebsocketOutput{
+	o := &WebsocketOutput{
 		outputBase: base,
+		conf:       p,
 		sink:       appSink,
-	}, nil
+	}
+
+	if p.VideoEnabled && p.VideoOutCodec == types.MimeTypeH264 {
+		o.h264Caps, err = gst.NewElement("capsfilter")
+		if err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+		if err = o.h264Caps.SetProperty("caps", gst.NewCapsFromString(
+			"video/x-h264,stream-format=byte-stream,alignment=au",
+		)); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+		if err = b.bin.Add(o.h264Caps); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+	}
+
+	return o, nil
 }
 
 func (o *WebsocketOutput) SetSink(writer *sink.WebsocketSink) {
@@ -66,7 +87,12 @@ func (o *WebsocketOutput) SetSink(writer *sink.WebsocketSink) {
 			samples := buffer.Map(gst.MapRead).Bytes()
 
 			// From the extracted bytes, send to writer
-			_, err := writer.Write(samples)
+			var err error
+			if o.videoQueue != nil {
+				err = writer.WriteFrame(buffer.PresentationTimestamp(), !buffer.HasFlags(gst.BufferFlagDeltaUnit), samples)
+			} else {
+				_, err = writer.Write(samples)
+			}
 			if err != nil {
 				if err == io.EOF {
 					return gst.FlowEOS
@@ -87,5 +113,16 @@ func (o *WebsocketOutput) Link() error {
 		}
 	}
 
+	// link video to sink
+	if o.videoQueue != nil {
+		if o.h264Caps != nil {
+			if err := gst.ElementLinkMany(o.videoQueue, o.h264Caps, o.sink.Element); err != nil {
+				return errors.ErrPadLinkFailed("video queue", "app sink", err.Error())
+			}
+		} else if err := o.videoQueue.Link(o.sink.Element); err != nil {
+			return errors.ErrPadLinkFailed("video queue", "app sink", err.Error())
+		}
+	}
+
 	return nil
 }
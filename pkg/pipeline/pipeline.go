@@ -2,6 +2,8 @@ package pipeline
 
 import (
 	"context"
+	"os"
+	"path"
 	"sync"
 	"time"
 
@@ -9,10 +11,12 @@ import (
 	"github.com/tinyzimmer/go-glib/glib"
 	"github.com/tinyzimmer/go-gst/gst"
 
+	"github.com/livekit/egress/pkg/clock"
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/pipeline/input"
 	"github.com/livekit/egress/pkg/pipeline/output"
+	"github.com/livekit/egress/pkg/pipeline/preview"
 	"github.com/livekit/egress/pkg/pipeline/sink"
 	"github.com/livekit/egress/pkg/pipeline/source"
 	"github.com/livekit/egress/pkg/types"
@@ -25,6 +29,8 @@ import (
 const (
 	pipelineSource = "pipeline"
 	eosTimeout     = time.Second * 30
+
+	limitCheckInterval = time.Second * 5
 )
 
 type UpdateFunc func(context.Context, *livekit.EgressInfo)
@@ -43,6 +49,7 @@ type Pipeline struct {
 	// internal
 	mu         sync.Mutex
 	playing    bool
+	panicErr   *errors.PanicError
 	limitTimer *time.Timer
 	closed     core.Fuse
 	eosTimer   *time.Timer
@@ -55,13 +62,15 @@ func New(ctx context.Context, p *config.PipelineConfig, onStatusUpdate UpdateFun
 	ctx, span := tracer.Start(ctx, "Pipeline.New")
 	defer span.End()
 
-	// initialize gst
-	go func() {
+	// initialize gst. GstReady is closed even if init panics, so that nothing waits on it forever
+	gstInitialized := false
+	util.Go(p.Failure, func() {
+		defer close(p.GstReady)
 		_, span := tracer.Start(ctx, "gst.Init")
 		defer span.End()
 		gst.Init(nil)
-		close(p.GstReady)
-	}()
+		gstInitialized = true
+	})
 
 	// create source
 	src, err := source.New(ctx, p)
@@ -71,6 +80,9 @@ func New(ctx context.Context, p *config.PipelineConfig, onStatusUpdate UpdateFun
 
 	// create pipeline
 	<-p.GstReady
+	if !gstInitialized {
+		return nil, errors.ErrGstPipelineError(errors.New("gstreamer init failed"))
+	}
 	gp, err := gst.NewPipeline("pipeline")
 	if err != nil {
 		return nil, errors.ErrGstPipelineError(err)
@@ -89,13 +101,19 @@ func New(ctx context.Context, p *config.PipelineConfig, onStatusUpdate UpdateFun
 	}
 
 	// link input bin
-	audioSrcPad, videoSrcPad, err := in.Link()
+	audioSrcPad, videoSrcPad, videoProxySrcPad, err := in.Link()
 	if err != nil {
 		return nil, err
 	}
 
 	// link output bin
-	if err = out.Link(audioSrcPad, videoSrcPad); err != nil {
+	if err = out.Link(audioSrcPad, videoSrcPad, videoProxySrcPad); err != nil {
+		return nil, err
+	}
+	if err = out.LinkRenditions(in.GetRenditionPads()); err != nil {
+		return nil, err
+	}
+	if err = out.LinkAlternateAudio(in.GetAlternateAudioPads()); err != nil {
 		return nil, err
 	}
 
@@ -116,6 +134,39 @@ func New(ctx context.Context, p *config.PipelineConfig, onStatusUpdate UpdateFun
 		sendUpdate:     onStatusUpdate,
 	}
 
+	in.OnTrimEnd(func() {
+		logger.Infow("trim end offset reached")
+		pipeline.SetEndedBy(config.EndedByTrim)
+		pipeline.SendEOS(context.Background())
+	})
+
+	if p.Preview != nil {
+		in.OnPreview(pipeline.uploadPreview)
+	}
+
+	if sdkSrc, ok := src.(*source.SDKSource); ok {
+		if p.Slate != nil || p.MuteIndicator != nil {
+			sdkSrc.OnVideoMuted(in.SetVideoMuted)
+		}
+		if p.MuteIndicator != nil {
+			sdkSrc.OnAudioMuted(in.SetAudioMuted)
+		}
+		if p.SDKReconnect > 0 {
+			sdkSrc.OnSignalingOutage(in.SetSignalingOutage)
+		}
+		if p.NetworkStats != nil {
+			sdkSrc.OnNetworkStats(in.WriteNetworkStats)
+		}
+	}
+
+	if s, ok := sinks[types.EgressTypeFile]; ok {
+		if index := s.(*sink.FileSink).Index(); index != nil {
+			if err = out.SetFileIndex(index); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	if s, ok := sinks[types.EgressTypeWebsocket]; ok {
 		websocketSink := s.(*sink.WebsocketSink)
 		src.(*source.SDKSource).OnTrackMuted(websocketSink.OnTrackMuted)
@@ -131,9 +182,9 @@ func (p *Pipeline) Run(ctx context.Context) *livekit.EgressInfo {
 	ctx, span := tracer.Start(ctx, "Pipeline.Run")
 	defer span.End()
 
-	p.Info.StartedAt = time.Now().UnixNano()
+	p.Info.StartedAt = clock.Now().UnixNano()
 	defer func() {
-		now := time.Now().UnixNano()
+		now := clock.Now().UnixNano()
 		p.Info.UpdatedAt = now
 		p.Info.EndedAt = now
 
@@ -150,6 +201,10 @@ func (p *Pipeline) Run(ctx context.Context) *livekit.EgressInfo {
 		case livekit.EgressStatus_EGRESS_ACTIVE,
 			livekit.EgressStatus_EGRESS_ENDING:
 			p.Info.Status = livekit.EgressStatus_EGRESS_COMPLETE
+
+		case livekit.EgressStatus_EGRESS_LIMIT_REACHED:
+			// set after finalizing, since an error would otherwise fail the egress
+			p.Info.Error = types.LimitErrors[p.LimitReached]
 		}
 
 		for _, s := range p.sinks {
@@ -160,6 +215,9 @@ func (p *Pipeline) Run(ctx context.Context) *livekit.EgressInfo {
 	// session limit timer
 	p.startSessionLimitTimer(ctx)
 
+	// local storage, file size, and segment count limits
+	p.startLimitMonitor(ctx)
+
 	// wait until room is ready
 	start := p.src.StartRecording()
 	if start != nil {
@@ -175,15 +233,16 @@ func (p *Pipeline) Run(ctx context.Context) *livekit.EgressInfo {
 	}
 
 	// close when room ends
-	go func() {
+	util.Go(p.Failure, func() {
 		<-p.src.EndRecording()
+		p.SetEndedBy(p.src.EndedBy())
 		p.SendEOS(ctx)
-	}()
+	})
 
 	for _, s := range p.sinks {
 		if err := s.Start(); err != nil {
 			p.src.Close()
-			p.Info.Error = err.Error()
+			p.SetFailure(err)
 			return p.Info
 		}
 	}
@@ -196,15 +255,24 @@ func (p *Pipeline) Run(ctx context.Context) *livekit.EgressInfo {
 	if err := p.pipeline.SetState(gst.StatePlaying); err != nil {
 		span.RecordError(err)
 		logger.Errorw("failed to set pipeline state", err)
-		p.Info.Error = err.Error()
+		p.SetFailure(err)
 		return p.Info
 	}
 
+	// fail if display capture never starts
+	p.startFirstFrameTimer()
+
 	// stop if one of the sources or sinks fails
 	go func() {
 		err := <-p.Failure
+		var panicErr *errors.PanicError
+		if errors.As(err, &panicErr) {
+			p.mu.Lock()
+			p.panicErr = panicErr
+			p.mu.Unlock()
+		}
 		if p.Info.Error == "" {
-			p.Info.Error = err.Error()
+			p.SetFailure(err)
 		}
 		p.stop()
 	}()
@@ -226,19 +294,38 @@ func (p *Pipeline) Run(ctx context.Context) *livekit.EgressInfo {
 	}
 
 	// finalize
+	qcReport := p.in.GetQCReport()
+	if qcReport != nil {
+		qcReport.EgressID = p.Info.EgressId
+	}
 	errs := errors.ErrArray{}
 	for _, s := range p.sinks {
 		if err := s.Finalize(); err != nil {
 			errs.AppendErr(err)
+			continue
+		}
+		if r, ok := s.(sink.QCReporter); ok && qcReport != nil {
+			// a missing report should not fail the recording
+			if err := r.UploadQCReport(qcReport); err != nil {
+				logger.Warnw("failed to upload qc report", err)
+			}
 		}
 	}
 	if err := errs.ToError(); err != nil {
-		p.Info.Error = err.Error()
+		p.SetFailure(err)
 	}
 
 	return p.Info
 }
 
+// GetPanic returns the panic which failed the pipeline, if any
+func (p *Pipeline) GetPanic() *errors.PanicError {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.panicErr
+}
+
 func (p *Pipeline) UpdateStream(ctx context.Context, req *livekit.UpdateStreamRequest) error {
 	ctx, span := tracer.Start(ctx, "Pipeline.UpdateStream")
 	defer span.End()
@@ -250,7 +337,7 @@ func (p *Pipeline) UpdateStream(ctx context.Context, req *livekit.UpdateStreamRe
 
 	sendUpdate := false
 	errs := errors.ErrArray{}
-	now := time.Now().UnixNano()
+	now := clock.Now().UnixNano()
 
 	// add stream outputs first
 	for _, url := range req.AddOutputUrls {
@@ -296,15 +383,132 @@ func (p *Pipeline) UpdateStream(ctx context.Context, req *livekit.UpdateStreamRe
 	}
 
 	if sendUpdate {
-		p.Info.UpdatedAt = time.Now().UnixNano()
+		p.Info.UpdatedAt = clock.Now().UnixNano()
 		p.sendUpdate(ctx, p.Info)
 	}
 
 	return errs.ToError()
 }
 
+// UpdateOutputs adds a segment output or stops the file output while the egress is running
+func (p *Pipeline) UpdateOutputs(ctx context.Context, addSegments *livekit.SegmentedFileOutput, stopFile bool) error {
+	ctx, span := tracer.Start(ctx, "Pipeline.UpdateOutputs")
+	defer span.End()
+
+	if !p.OutputUpdates {
+		return errors.ErrNotSupported("output updates without output_updates enabled")
+	}
+	if p.closed.IsBroken() {
+		return errors.ErrEgressEnding
+	}
+
+	errs := errors.ErrArray{}
+	if addSegments != nil {
+		if err := p.addSegmentOutput(addSegments); err != nil {
+			errs.AppendErr(err)
+		} else {
+			p.Info.UpdatedAt = clock.Now().UnixNano()
+			p.sendUpdate(ctx, p.Info)
+		}
+	}
+
+	// the update is sent once the file has been uploaded
+	if stopFile {
+		if err := p.stopFileOutput(ctx); err != nil {
+			errs.AppendErr(err)
+		}
+	}
+
+	return errs.ToError()
+}
+
+func (p *Pipeline) addSegmentOutput(segments *livekit.SegmentedFileOutput) error {
+	p.mu.Lock()
+	o, err := p.AddSegmentOutput(segments)
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s, err := sink.CreateSegmentSink(p.PipelineConfig, o)
+	if err == nil {
+		err = p.out.AddSegmentOutput(p.PipelineConfig)
+	}
+	if err != nil {
+		p.mu.Lock()
+		delete(p.Outputs, types.EgressTypeSegments)
+		p.OutputCount--
+		p.Info.SegmentResults = p.Info.SegmentResults[:len(p.Info.SegmentResults)-1]
+		p.mu.Unlock()
+		return err
+	}
+
+	o.SegmentsInfo.StartedAt = clock.Now().UnixNano()
+	p.setSink(types.EgressTypeSegments, s)
+	if err = s.Start(); err != nil {
+		return err
+	}
+
+	logger.Infow("segment output added", "playlist", o.SegmentsInfo.PlaylistName)
+	return nil
+}
+
+func (p *Pipeline) stopFileOutput(ctx context.Context) error {
+	o := p.GetFileConfig()
+	if o == nil {
+		return errors.ErrInvalidInput("file output")
+	}
+	if p.GetProxyFileConfig() != nil {
+		// the proxy has its own encoder, which can't be stopped separately
+		return errors.ErrNotSupported("stopping file outputs with a proxy file")
+	}
+	if p.OutputCount == 1 {
+		p.SendEOS(ctx)
+		return nil
+	}
+
+	return p.out.RemoveFileOutput(func() {
+		now := clock.Now().UnixNano()
+		p.mu.Lock()
+		o.FileInfo.EndedAt = now
+		o.FileInfo.Duration = now - o.FileInfo.StartedAt
+		delete(p.Outputs, types.EgressTypeFile)
+		p.OutputCount--
+		p.mu.Unlock()
+
+		s := p.sinks[types.EgressTypeFile]
+		p.setSink(types.EgressTypeFile, nil)
+		if err := s.Finalize(); err != nil {
+			logger.Errorw("failed to finalize stopped file output", err)
+		}
+		s.Cleanup()
+		logger.Infow("file output stopped", "location", o.FileInfo.Location)
+
+		p.Info.UpdatedAt = clock.Now().UnixNano()
+		p.sendUpdate(context.Background(), p.Info)
+	})
+}
+
+// setSink replaces the sinks instead of modifying them, since the bus watch reads them while running.
+// A nil sink removes the output's sink.
+func (p *Pipeline) setSink(egressType types.EgressType, s sink.Sink) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sinks := make(map[types.EgressType]sink.Sink, len(p.sinks)+1)
+	for t, existing := range p.sinks {
+		sinks[t] = existing
+	}
+	if s == nil {
+		delete(sinks, egressType)
+	} else {
+		sinks[egressType] = s
+	}
+	p.sinks = sinks
+}
+
 func (p *Pipeline) removeSink(ctx context.Context, url string, streamErr error) error {
-	now := time.Now().UnixNano()
+	now := clock.Now().UnixNano()
 
 	p.mu.Lock()
 	o := p.GetStreamConfig()
@@ -330,6 +534,7 @@ func (p *Pipeline) removeSink(ctx context.Context, url string, streamErr error)
 	} else {
 		streamInfo.Duration = now - streamInfo.StartedAt
 	}
+	p.recordStreamStats(o, url, streamInfo, streamErr)
 
 	// remove output
 	delete(o.StreamInfo, url)
@@ -356,13 +561,54 @@ func (p *Pipeline) removeSink(ctx context.Context, url string, streamErr error)
 
 	// only send updates if the egress will continue, otherwise it's handled by UpdateStream RPC
 	if streamErr != nil {
-		p.Info.UpdatedAt = time.Now().UnixNano()
+		p.Info.UpdatedAt = clock.Now().UnixNano()
 		p.sendUpdate(ctx, p.Info)
 	}
 
 	return p.out.RemoveStream(url)
 }
 
+// reconnectStream retries a failed rtmp output with exponential backoff, and removes it once the window has passed
+// or the attempts have run out
+func (p *Pipeline) reconnectStream(url string, streamErr error) {
+	conf := p.RTMPReconnect
+	redacted, _ := util.RedactStreamKey(url)
+	logger.Warnw("rtmp output failed, reconnecting", streamErr, "url", redacted)
+
+	if conf.GetBackoff().Retry(p.closed.Watch(), func(attempt int) bool {
+		err := p.out.ReconnectStream(url)
+		if err == nil {
+			logger.Infow("rtmp output reconnected", "url", redacted, "attempt", attempt)
+			return true
+		}
+		logger.Debugw("rtmp reconnect failed", "url", redacted, "attempt", attempt, "error", err)
+		return false
+	}) || p.closed.IsBroken() {
+		return
+	}
+
+	if err := p.removeSink(context.Background(), url, errors.ErrStreamFailed(streamErr)); err != nil {
+		p.Failure <- err
+	}
+}
+
+// recordStreamStats keeps totals for a finished stream, to be included in the manifest
+func (p *Pipeline) recordStreamStats(o *config.StreamConfig, url string, info *livekit.StreamInfo, streamErr error) {
+	stats := config.NewStreamStats(info, p.out.GetStreamBytesSent(url), p.out.GetStreamReconnects(url))
+	if streamErr != nil {
+		stats.FailureCause = string(errors.GetFailureCause(streamErr))
+	}
+	o.Stats = append(o.Stats, stats)
+
+	logger.Infow("stream stats",
+		"url", stats.Url,
+		"duration", time.Duration(stats.Duration),
+		"bytesSent", stats.BytesSent,
+		"averageBitrate", stats.AverageBitrate,
+		"reconnects", stats.Reconnects,
+	)
+}
+
 func (p *Pipeline) GetGstPipelineDebugDot() string {
 	return p.pipeline.DebugBinToDotData(gst.DebugGraphShowAll)
 }
@@ -387,13 +633,13 @@ func (p *Pipeline) SendEOS(ctx context.Context) {
 
 		case livekit.EgressStatus_EGRESS_ACTIVE:
 			p.Info.Status = livekit.EgressStatus_EGRESS_ENDING
-			p.Info.UpdatedAt = time.Now().UnixNano()
+			p.Info.UpdatedAt = clock.Now().UnixNano()
 			p.sendUpdate(ctx, p.Info)
 			fallthrough
 
 		case livekit.EgressStatus_EGRESS_ENDING,
 			livekit.EgressStatus_EGRESS_LIMIT_REACHED:
-			go func() {
+			util.Go(p.Failure, func() {
 				logger.Infow("sending EOS to pipeline")
 
 				p.eosTimer = time.AfterFunc(eosTimeout, func() {
@@ -401,12 +647,33 @@ func (p *Pipeline) SendEOS(ctx context.Context) {
 					p.Failure <- errors.New("pipeline frozen")
 				})
 
+				p.in.EndSlate()
 				if p.SourceType == types.SourceTypeSDK {
 					p.src.(*source.SDKSource).CloseWriters()
 				}
 
 				p.pipeline.SendEvent(gst.NewEOSEvent())
-			}()
+			})
+		}
+	})
+}
+
+func (p *Pipeline) startFirstFrameTimer() {
+	firstFrame := p.in.FirstFrame()
+	if firstFrame == nil || p.ChromeLaunch.FirstFrameTimeout <= 0 {
+		return
+	}
+
+	util.Go(p.Failure, func() {
+		timer := time.NewTimer(p.ChromeLaunch.FirstFrameTimeout)
+		defer timer.Stop()
+
+		select {
+		case <-firstFrame:
+		case <-p.closed.Watch():
+		case <-timer.C:
+			logger.Errorw("no frames from display capture", nil, "timeout", p.ChromeLaunch.FirstFrameTimeout)
+			p.Failure <- errors.ErrNoFrames
 		}
 	})
 }
@@ -416,7 +683,7 @@ func (p *Pipeline) startSessionLimitTimer(ctx context.Context) {
 	for egressType := range p.Outputs {
 		var t time.Duration
 		switch egressType {
-		case types.EgressTypeFile:
+		case types.EgressTypeFile, types.EgressTypeProxyFile:
 			t = p.FileOutputMaxDuration
 		case types.EgressTypeStream, types.EgressTypeWebsocket:
 			t = p.StreamOutputMaxDuration
@@ -430,16 +697,102 @@ func (p *Pipeline) startSessionLimitTimer(ctx context.Context) {
 
 	if timeout > 0 {
 		p.limitTimer = time.AfterFunc(timeout, func() {
-			switch p.Info.Status {
-			case livekit.EgressStatus_EGRESS_STARTING,
-				livekit.EgressStatus_EGRESS_ACTIVE:
-				p.Info.Status = livekit.EgressStatus_EGRESS_LIMIT_REACHED
-			}
-			p.SendEOS(ctx)
+			p.onLimitReached(ctx, types.LimitTypeDuration)
 		})
 	}
 }
 
+func (p *Pipeline) startLimitMonitor(ctx context.Context) {
+	var scratchQuota, fileSize, segmentCount int64
+	if p.ScratchQuota > 0 {
+		scratchQuota = p.ScratchQuota * 1024 * 1024
+	}
+	fileConfig := p.GetFileConfig()
+	if fileConfig != nil && p.FileOutputMaxSize > 0 {
+		fileSize = p.FileOutputMaxSize * 1024 * 1024
+	}
+	segmentConfig := p.GetSegmentConfig()
+	if segmentConfig != nil && p.SegmentOutputMaxCount > 0 {
+		segmentCount = p.SegmentOutputMaxCount
+	}
+	if scratchQuota == 0 && fileSize == 0 && segmentCount == 0 {
+		return
+	}
+
+	localDir := path.Join(p.LocalOutputDirectory, p.Info.EgressId)
+
+	util.Go(p.Failure, func() {
+		ticker := time.NewTicker(limitCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.closed.Watch():
+				return
+			case <-ticker.C:
+				if scratchQuota > 0 {
+					// errors mean nothing has been written yet
+					if size, err := util.GetDirSize(localDir); err == nil && size > scratchQuota {
+						logger.Warnw("scratch quota exceeded", nil, "size", size, "quota", scratchQuota)
+						p.onLimitReached(ctx, types.LimitTypeScratchQuota)
+						return
+					}
+				}
+				if fileSize > 0 {
+					size := getFileSize(fileConfig.LocalFilepath)
+					if p.FaststartMP4 {
+						// media is buffered here until EOS
+						size += getFileSize(fileConfig.FaststartFilepath())
+					}
+					if size >= fileSize {
+						logger.Infow("file size limit reached", "size", size, "limit", fileSize)
+						p.onLimitReached(ctx, types.LimitTypeFileSize)
+						return
+					}
+				}
+				if segmentCount > 0 {
+					if count := segmentConfig.GetSegmentCount(); count >= segmentCount {
+						logger.Infow("segment count limit reached", "count", count, "limit", segmentCount)
+						p.onLimitReached(ctx, types.LimitTypeSegmentCount)
+						return
+					}
+				}
+			}
+		}
+	})
+}
+
+func getFileSize(filepath string) int64 {
+	stat, err := os.Stat(filepath)
+	if err != nil {
+		return 0
+	}
+	return stat.Size()
+}
+
+// onLimitReached ends the egress with EGRESS_LIMIT_REACHED, recording which limit was hit
+func (p *Pipeline) onLimitReached(ctx context.Context, limit types.LimitType) {
+	switch p.Info.Status {
+	case livekit.EgressStatus_EGRESS_STARTING,
+		livekit.EgressStatus_EGRESS_ACTIVE:
+		p.Info.Status = livekit.EgressStatus_EGRESS_LIMIT_REACHED
+		p.LimitReached = limit
+	}
+	p.SetEndedBy(config.EndedByLimitReached)
+	p.SendEOS(ctx)
+}
+
+// SetEndedBy records what ended the egress. Only the first reason is kept
+func (p *Pipeline) SetEndedBy(endedBy string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.EndedBy == "" {
+		p.EndedBy = endedBy
+		logger.Infow("egress ending", "endedBy", endedBy, "endTrigger", p.EndTrigger)
+	}
+}
+
 func (p *Pipeline) updateStartTime(startedAt int64) {
 	for egressType, c := range p.Outputs {
 		switch egressType {
@@ -451,7 +804,7 @@ func (p *Pipeline) updateStartTime(startedAt int64) {
 			}
 			p.mu.Unlock()
 
-		case types.EgressTypeFile:
+		case types.EgressTypeFile, types.EgressTypeProxyFile:
 			c.(*config.FileConfig).FileInfo.StartedAt = startedAt
 
 		case types.EgressTypeSegments:
@@ -459,13 +812,49 @@ func (p *Pipeline) updateStartTime(startedAt int64) {
 		}
 	}
 
+	if p.SyncGroup != nil {
+		p.StartOffset = startedAt - p.SyncGroup.Epoch
+	}
+
 	if p.Info.Status == livekit.EgressStatus_EGRESS_STARTING {
 		p.Info.Status = livekit.EgressStatus_EGRESS_ACTIVE
-		p.Info.UpdatedAt = time.Now().UnixNano()
+		p.Info.UpdatedAt = clock.Now().UnixNano()
 		p.sendUpdate(context.Background(), p.Info)
 	}
 }
 
+// uploadPreview encodes a single frame as jpeg, and stores it next to the file or segment output
+func (p *Pipeline) uploadPreview(frame []byte, width, height int) {
+	var uploader sink.PreviewUploader
+	for _, egressType := range []types.EgressType{types.EgressTypeFile, types.EgressTypeSegments} {
+		if s, ok := p.sinks[egressType].(sink.PreviewUploader); ok {
+			uploader = s
+			break
+		}
+	}
+	if uploader == nil {
+		return
+	}
+
+	image, err := preview.EncodeI420(frame, width, height, p.Preview.Quality)
+	if err != nil {
+		logger.Warnw("failed to encode preview", err)
+		return
+	}
+
+	fileInfo, err := uploader.UploadPreview(image)
+	if err != nil {
+		logger.Warnw("failed to upload preview", err)
+		return
+	}
+	logger.Infow("preview uploaded", "location", fileInfo.Location)
+
+	// listed in the manifest, since clients treat every file result as a recording
+	p.mu.Lock()
+	p.PreviewFile = fileInfo
+	p.mu.Unlock()
+}
+
 func (p *Pipeline) updateDuration(endedAt int64) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -473,16 +862,20 @@ func (p *Pipeline) updateDuration(endedAt int64) {
 	for egressType, c := range p.Outputs {
 		switch egressType {
 		case types.EgressTypeStream, types.EgressTypeWebsocket:
-			for _, info := range c.(*config.StreamConfig).StreamInfo {
+			o := c.(*config.StreamConfig)
+			for url, info := range o.StreamInfo {
 				info.Status = livekit.StreamInfo_FINISHED
 				if info.StartedAt == 0 {
 					info.StartedAt = endedAt
 				}
 				info.EndedAt = endedAt
 				info.Duration = endedAt - info.StartedAt
+				if egressType == types.EgressTypeStream {
+					p.recordStreamStats(o, url, info, nil)
+				}
 			}
 
-		case types.EgressTypeFile:
+		case types.EgressTypeFile, types.EgressTypeProxyFile:
 			fileInfo := c.(*config.FileConfig).FileInfo
 			if fileInfo.StartedAt == 0 {
 				fileInfo.StartedAt = endedAt
@@ -501,6 +894,12 @@ func (p *Pipeline) updateDuration(endedAt int64) {
 	}
 }
 
+// Abort stops the pipeline without finalizing its outputs
+func (p *Pipeline) Abort() {
+	p.Info.Status = livekit.EgressStatus_EGRESS_ABORTED
+	p.stop()
+}
+
 func (p *Pipeline) stop() {
 	p.mu.Lock()
 
@@ -510,7 +909,7 @@ func (p *Pipeline) stop() {
 	}
 
 	_ = p.pipeline.BlockSetState(gst.StateNull)
-	endedAt := time.Now().UnixNano()
+	endedAt := clock.Now().UnixNano()
 	logger.Infow("pipeline stopped")
 
 	p.loop.Quit()
@@ -0,0 +1,42 @@
+package preview
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+)
+
+var errShortFrame = errors.New("frame is smaller than expected")
+
+// EncodeI420 encodes a raw I420 frame as a jpeg, using the default GStreamer plane layout
+func EncodeI420(frame []byte, width, height, quality int) ([]byte, error) {
+	yStride := roundUp(width, 4)
+	cStride := roundUp(roundUp(width, 2)/2, 4)
+	cHeight := roundUp(height, 2) / 2
+	cbOffset := yStride * roundUp(height, 2)
+	crOffset := cbOffset + cStride*cHeight
+	if len(frame) < crOffset+cStride*cHeight {
+		return nil, errShortFrame
+	}
+
+	img := &image.YCbCr{
+		Y:              frame[:cbOffset],
+		Cb:             frame[cbOffset:crOffset],
+		Cr:             frame[crOffset : crOffset+cStride*cHeight],
+		YStride:        yStride,
+		CStride:        cStride,
+		SubsampleRatio: image.YCbCrSubsampleRatio420,
+		Rect:           image.Rect(0, 0, width, height),
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func roundUp(v, n int) int {
+	return (v + n - 1) / n * n
+}
@@ -0,0 +1,28 @@
+package preview
+
+import (
+	"bytes"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeI420(t *testing.T) {
+	for _, size := range [][2]int{{1280, 720}, {642, 362}} {
+		width, height := size[0], size[1]
+		yStride, cStride := roundUp(width, 4), roundUp(width/2, 4)
+		frame := bytes.Repeat([]byte{128}, yStride*height+2*cStride*height/2)
+
+		b, err := EncodeI420(frame, width, height, 80)
+		require.NoError(t, err)
+
+		img, err := jpeg.Decode(bytes.NewReader(b))
+		require.NoError(t, err)
+		require.Equal(t, width, img.Bounds().Dx())
+		require.Equal(t, height, img.Bounds().Dy())
+
+		_, err = EncodeI420(frame[:len(frame)-1], width, height, 80)
+		require.ErrorIs(t, err, errShortFrame)
+	}
+}
@@ -0,0 +1,306 @@
+package qc
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// reported when there is nothing above the absolute gate, or no signal at all
+	MinLoudness = -70.0
+	MinPeak     = -96.0
+
+	subBlockDuration   = 100 * time.Millisecond
+	subBlocksPerBlock  = 4 // 400ms gating blocks with 75% overlap
+	relativeGate       = -10.0
+	silenceThreshold   = -60.0 // dBFS
+	minSilenceDuration = 2 * time.Second
+
+	oversampling = 4
+	peakTaps     = 12
+)
+
+// AudioAnalyzer measures loudness, true peak and silence of interleaved S16 audio
+type AudioAnalyzer struct {
+	mu sync.Mutex
+
+	sampleRate int
+	channels   int
+
+	// K-weighting filter state, per channel
+	shelf    []*biquad
+	highPass []*biquad
+
+	// true peak interpolation history, per channel
+	history [][]float64
+	phases  [][]float64
+	peak    float64
+
+	// current 100ms sub-block
+	subBlockSize int
+	position     int
+	weighted     float64
+	unweighted   float64
+
+	subBlocks []float64 // mean square of each sub-block, summed over channels
+	blocks    []float64
+
+	samples      int64
+	silenceStart int64 // -1 when not silent
+	silence      []Range
+}
+
+func NewAudioAnalyzer(sampleRate, channels int) *AudioAnalyzer {
+	a := &AudioAnalyzer{
+		sampleRate:   sampleRate,
+		channels:     channels,
+		phases:       interpolationPhases(),
+		subBlockSize: sampleRate * int(subBlockDuration/time.Millisecond) / 1000,
+		silenceStart: -1,
+	}
+
+	for c := 0; c < channels; c++ {
+		a.shelf = append(a.shelf, newHighShelf(float64(sampleRate)))
+		a.highPass = append(a.highPass, newHighPass(float64(sampleRate)))
+		a.history = append(a.history, make([]float64, peakTaps))
+	}
+
+	return a
+}
+
+// Write analyzes interleaved samples. Partial frames are ignored.
+func (a *AudioAnalyzer) Write(samples []int16) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	frames := len(samples) / a.channels
+	for i := 0; i < frames; i++ {
+		for c := 0; c < a.channels; c++ {
+			x := float64(samples[i*a.channels+c]) / 32768
+
+			y := a.highPass[c].process(a.shelf[c].process(x))
+			a.weighted += y * y
+			a.unweighted += x * x
+
+			a.updatePeak(c, x)
+		}
+
+		a.position++
+		if a.position == a.subBlockSize {
+			a.endSubBlock()
+		}
+	}
+}
+
+func (a *AudioAnalyzer) updatePeak(c int, x float64) {
+	history := a.history[c]
+	copy(history[1:], history[:peakTaps-1])
+	history[0] = x
+
+	if abs := math.Abs(x); abs > a.peak {
+		a.peak = abs
+	}
+	for _, phase := range a.phases {
+		var y float64
+		for j, h := range phase {
+			y += h * history[j]
+		}
+		if abs := math.Abs(y); abs > a.peak {
+			a.peak = abs
+		}
+	}
+}
+
+func (a *AudioAnalyzer) endSubBlock() {
+	a.subBlocks = append(a.subBlocks, a.weighted/float64(a.subBlockSize))
+	if n := len(a.subBlocks); n >= subBlocksPerBlock {
+		var z float64
+		for _, s := range a.subBlocks[n-subBlocksPerBlock:] {
+			z += s
+		}
+		a.blocks = append(a.blocks, z/subBlocksPerBlock)
+	}
+
+	rms := math.Sqrt(a.unweighted / float64(a.subBlockSize*a.channels))
+	if toDecibels(rms) < silenceThreshold {
+		if a.silenceStart < 0 {
+			a.silenceStart = a.samples
+		}
+	} else {
+		a.endSilence()
+	}
+
+	a.samples += int64(a.subBlockSize)
+	a.position = 0
+	a.weighted = 0
+	a.unweighted = 0
+}
+
+func (a *AudioAnalyzer) endSilence() {
+	if a.silenceStart < 0 {
+		return
+	}
+
+	start := a.duration(a.silenceStart)
+	end := a.duration(a.samples)
+	if end-start >= minSilenceDuration {
+		a.silence = append(a.silence, newRange(start, end))
+	}
+	a.silenceStart = -1
+}
+
+func (a *AudioAnalyzer) duration(samples int64) time.Duration {
+	return time.Duration(samples) * time.Second / time.Duration(a.sampleRate)
+}
+
+func (a *AudioAnalyzer) Report() *AudioReport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.endSilence()
+
+	silence := a.silence
+	if silence == nil {
+		silence = make([]Range, 0)
+	}
+
+	return &AudioReport{
+		IntegratedLoudness: integratedLoudness(a.blocks),
+		TruePeak:           math.Max(toDecibels(a.peak), MinPeak),
+		SilenceRanges:      silence,
+		Duration:           a.duration(a.samples + int64(a.position)).Seconds(),
+	}
+}
+
+// integratedLoudness applies the absolute and relative gates from ITU-R BS.1770-4
+func integratedLoudness(blocks []float64) float64 {
+	gated := func(threshold float64) (float64, int) {
+		var sum float64
+		var count int
+		for _, z := range blocks {
+			if blockLoudness(z) > threshold {
+				sum += z
+				count++
+			}
+		}
+		return sum, count
+	}
+
+	sum, count := gated(MinLoudness)
+	if count == 0 {
+		return MinLoudness
+	}
+
+	threshold := blockLoudness(sum/float64(count)) + relativeGate
+	sum, count = gated(threshold)
+	if count == 0 {
+		return MinLoudness
+	}
+
+	return math.Max(blockLoudness(sum/float64(count)), MinLoudness)
+}
+
+func blockLoudness(z float64) float64 {
+	if z <= 0 {
+		return math.Inf(-1)
+	}
+	return -0.691 + 10*math.Log10(z)
+}
+
+func toDecibels(amplitude float64) float64 {
+	if amplitude <= 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(amplitude)
+}
+
+// interpolationPhases returns a windowed sinc filter for 4x oversampling, split into one filter per phase
+func interpolationPhases() [][]float64 {
+	length := oversampling * peakTaps
+	center := float64(length-1) / 2
+
+	phases := make([][]float64, oversampling)
+	for k := range phases {
+		phases[k] = make([]float64, peakTaps)
+	}
+	for i := 0; i < length; i++ {
+		t := (float64(i) - center) / oversampling
+		h := 1.0
+		if t != 0 {
+			h = math.Sin(math.Pi*t) / (math.Pi * t)
+		}
+		// hann window
+		h *= 0.5 - 0.5*math.Cos(2*math.Pi*(float64(i)+0.5)/float64(length))
+		phases[i%oversampling][i/oversampling] = h
+	}
+
+	// normalize each phase to unity gain
+	for _, phase := range phases {
+		var sum float64
+		for _, h := range phase {
+			sum += h
+		}
+		for j := range phase {
+			phase[j] /= sum
+		}
+	}
+
+	return phases
+}
+
+type biquad struct {
+	b0, b1, b2 float64
+	a1, a2     float64
+	x1, x2     float64
+	y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// newHighShelf returns the first stage of the K-weighting filter, which models the acoustic effect of the head.
+// At 48kHz, the coefficients match those given in ITU-R BS.1770-4.
+func newHighShelf(sampleRate float64) *biquad {
+	const (
+		gain = 3.999843853973347
+		q    = 0.7071752369554196
+		fc   = 1681.974450955533
+	)
+
+	k := math.Tan(math.Pi * fc / sampleRate)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+
+	a0 := 1 + k/q + k*k
+	return &biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+}
+
+// newHighPass returns the second stage of the K-weighting filter (RLB weighting)
+func newHighPass(sampleRate float64) *biquad {
+	const (
+		q  = 0.5003270373238773
+		fc = 38.13547087602444
+	)
+
+	k := math.Tan(math.Pi * fc / sampleRate)
+
+	a0 := 1 + k/q + k*k
+	return &biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+}
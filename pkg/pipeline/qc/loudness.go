@@ -0,0 +1,100 @@
+package qc
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// LoudnessMeter measures the gated loudness of interleaved S16 audio over a sliding window,
+// which is used to steer loudness normalization while audio is being encoded
+type LoudnessMeter struct {
+	mu sync.Mutex
+
+	channels int
+
+	// K-weighting filter state, per channel
+	shelf    []*biquad
+	highPass []*biquad
+
+	subBlockSize int
+	position     int
+	weighted     float64
+
+	subBlocks []float64
+	blocks    []float64
+	maxBlocks int
+}
+
+func NewLoudnessMeter(sampleRate, channels int, window time.Duration) *LoudnessMeter {
+	m := &LoudnessMeter{
+		channels:     channels,
+		subBlockSize: sampleRate * int(subBlockDuration/time.Millisecond) / 1000,
+		maxBlocks:    int(window / subBlockDuration),
+	}
+
+	for c := 0; c < channels; c++ {
+		m.shelf = append(m.shelf, newHighShelf(float64(sampleRate)))
+		m.highPass = append(m.highPass, newHighPass(float64(sampleRate)))
+	}
+
+	return m
+}
+
+// Write measures interleaved samples. Partial frames are ignored.
+func (m *LoudnessMeter) Write(samples []int16) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	frames := len(samples) / m.channels
+	for i := 0; i < frames; i++ {
+		for c := 0; c < m.channels; c++ {
+			x := float64(samples[i*m.channels+c]) / 32768
+			y := m.highPass[c].process(m.shelf[c].process(x))
+			m.weighted += y * y
+		}
+
+		m.position++
+		if m.position == m.subBlockSize {
+			m.endSubBlock()
+		}
+	}
+}
+
+func (m *LoudnessMeter) endSubBlock() {
+	m.subBlocks = append(m.subBlocks, m.weighted/float64(m.subBlockSize))
+	if n := len(m.subBlocks); n >= subBlocksPerBlock {
+		var z float64
+		for _, s := range m.subBlocks[n-subBlocksPerBlock:] {
+			z += s
+		}
+		m.blocks = append(m.blocks, z/subBlocksPerBlock)
+		m.subBlocks = m.subBlocks[n-subBlocksPerBlock+1:]
+	}
+	if len(m.blocks) > m.maxBlocks {
+		m.blocks = m.blocks[len(m.blocks)-m.maxBlocks:]
+	}
+
+	m.position = 0
+	m.weighted = 0
+}
+
+// Loudness returns the gated loudness of the window in LUFS, or MinLoudness if nothing is above the absolute gate
+func (m *LoudnessMeter) Loudness() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return integratedLoudness(m.blocks)
+}
+
+// NormalizationGain moves the current gain towards the gain which brings the measured loudness to the target,
+// by at most maxStep dB, and limited to +/- maxGain dB. The gain is held while the input is silent.
+func NormalizationGain(current, measured, target, maxGain, maxStep float64) float64 {
+	if measured <= MinLoudness {
+		return current
+	}
+
+	desired := math.Max(math.Min(target-measured, maxGain), -maxGain)
+	step := math.Max(math.Min(desired-current, maxStep), -maxStep)
+	return current + step
+}
@@ -0,0 +1,113 @@
+package qc
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const EventPacketLoss = "packet_loss"
+
+// NetworkStats are measured from the rtp packets received for a subscribed track, over one stats interval
+type NetworkStats struct {
+	TrackID         string  `json:"track_id"`
+	Kind            string  `json:"kind"`
+	Bitrate         float64 `json:"bitrate_kbps"` // received bitrate
+	PacketsReceived int64   `json:"packets_received"`
+	PacketsLost     int64   `json:"packets_lost"`
+	PacketLoss      float64 `json:"packet_loss"` // fraction of expected packets which were not received
+	Jitter          float64 `json:"jitter_ms"`   // RFC 3550 interarrival jitter
+}
+
+// NetworkReport summarizes the network stats of a track over the whole recording
+type NetworkReport struct {
+	TrackID     string  `json:"track_id"`
+	Kind        string  `json:"kind"`
+	AvgBitrate  float64 `json:"avg_bitrate_kbps"`
+	MinBitrate  float64 `json:"min_bitrate_kbps"`
+	PacketsLost int64   `json:"packets_lost"`
+	PacketLoss  float64 `json:"packet_loss"` // overall fraction of expected packets which were not received
+	AvgJitter   float64 `json:"avg_jitter_ms"`
+	MaxJitter   float64 `json:"max_jitter_ms"`
+}
+
+// NetworkAnalyzer accumulates periodic network stats, and records intervals with high packet loss in the timeline
+type NetworkAnalyzer struct {
+	mu sync.Mutex
+
+	timeline      *Timeline
+	lossThreshold float64
+	tracks        map[string]*networkTrack
+	order         []string
+}
+
+type networkTrack struct {
+	report    NetworkReport
+	intervals int
+	bitrate   float64
+	jitter    float64
+	expected  int64
+}
+
+func NewNetworkAnalyzer(timeline *Timeline, lossThreshold float64) *NetworkAnalyzer {
+	return &NetworkAnalyzer{
+		timeline:      timeline,
+		lossThreshold: lossThreshold,
+		tracks:        make(map[string]*networkTrack),
+	}
+}
+
+func (a *NetworkAnalyzer) Write(stats []*NetworkStats, at time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	lossy := false
+	for _, s := range stats {
+		t := a.tracks[s.TrackID]
+		if t == nil {
+			t = &networkTrack{
+				report: NetworkReport{
+					TrackID:    s.TrackID,
+					Kind:       s.Kind,
+					MinBitrate: math.Inf(1),
+				},
+			}
+			a.tracks[s.TrackID] = t
+			a.order = append(a.order, s.TrackID)
+		}
+
+		t.intervals++
+		t.bitrate += s.Bitrate
+		t.jitter += s.Jitter
+		t.expected += s.PacketsReceived + s.PacketsLost
+		t.report.PacketsLost += s.PacketsLost
+		t.report.MinBitrate = math.Min(t.report.MinBitrate, s.Bitrate)
+		t.report.MaxJitter = math.Max(t.report.MaxJitter, s.Jitter)
+		if s.PacketLoss >= a.lossThreshold {
+			lossy = true
+		}
+	}
+
+	if a.timeline != nil {
+		a.timeline.SetActive(EventPacketLoss, lossy, at)
+	}
+}
+
+// Report returns a summary of each track, in the order they were first seen
+func (a *NetworkAnalyzer) Report() []*NetworkReport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	reports := make([]*NetworkReport, 0, len(a.order))
+	for _, trackID := range a.order {
+		t := a.tracks[trackID]
+		report := t.report
+		report.AvgBitrate = t.bitrate / float64(t.intervals)
+		report.AvgJitter = t.jitter / float64(t.intervals)
+		if t.expected > 0 {
+			report.PacketLoss = float64(report.PacketsLost) / float64(t.expected)
+		}
+		reports = append(reports, &report)
+	}
+	return reports
+}
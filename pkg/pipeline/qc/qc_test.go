@@ -0,0 +1,180 @@
+package qc
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sine(sampleRate, channels int, frequency, amplitude float64, duration time.Duration) []int16 {
+	frames := int(duration.Seconds() * float64(sampleRate))
+	samples := make([]int16, frames*channels)
+	for i := 0; i < frames; i++ {
+		v := int16(amplitude * 32767 * math.Sin(2*math.Pi*frequency*float64(i)/float64(sampleRate)))
+		for c := 0; c < channels; c++ {
+			samples[i*channels+c] = v
+		}
+	}
+	return samples
+}
+
+func TestAudioAnalyzer(t *testing.T) {
+	a := NewAudioAnalyzer(48000, 2)
+
+	// a full scale 1kHz sine in both channels measures 0 LUFS
+	a.Write(sine(48000, 2, 1000, 1, 5*time.Second))
+	// followed by 3s of silence
+	a.Write(make([]int16, 3*48000*2))
+	// and a -20dBFS sine
+	a.Write(sine(48000, 2, 1000, 0.1, 5*time.Second))
+
+	r := a.Report()
+	require.InDelta(t, 13, r.Duration, 0.01)
+	require.InDelta(t, 0, r.TruePeak, 0.1)
+	require.Len(t, r.SilenceRanges, 1)
+	require.InDelta(t, 5, r.SilenceRanges[0].Start, 0.11)
+	require.InDelta(t, 8, r.SilenceRanges[0].End, 0.11)
+
+	// the quiet section is more than 10 LU below the loud section, so it is excluded by the relative gate
+	loud := NewAudioAnalyzer(48000, 2)
+	loud.Write(sine(48000, 2, 1000, 1, 5*time.Second))
+	require.InDelta(t, loud.Report().IntegratedLoudness, r.IntegratedLoudness, 0.5)
+	require.InDelta(t, 0, loud.Report().IntegratedLoudness, 0.1)
+}
+
+func TestAudioAnalyzerSilence(t *testing.T) {
+	a := NewAudioAnalyzer(48000, 2)
+	a.Write(make([]int16, 48000*2))
+
+	r := a.Report()
+	require.Equal(t, MinLoudness, r.IntegratedLoudness)
+	require.Equal(t, MinPeak, r.TruePeak)
+	// too short to be reported
+	require.Empty(t, r.SilenceRanges)
+}
+
+func TestVideoAnalyzer(t *testing.T) {
+	v := NewVideoAnalyzer()
+	frame := time.Second / 30
+	for i := 0; i < 90; i++ {
+		luma := 120.0
+		if i >= 30 && i < 60 {
+			luma = 16
+		}
+		v.WriteFrame(time.Duration(i)*frame, luma)
+	}
+
+	r := v.Report(2, 3)
+	require.Equal(t, uint64(90), r.Frames)
+	require.Equal(t, uint64(2), r.DroppedFrames)
+	require.Equal(t, uint64(3), r.DuplicatedFrames)
+	require.Len(t, r.BlackFrameRanges, 1)
+	require.InDelta(t, 1, r.BlackFrameRanges[0].Start, 0.01)
+	require.InDelta(t, 2, r.BlackFrameRanges[0].End, 0.01)
+}
+
+func TestMeanLuma(t *testing.T) {
+	i420 := make([]byte, 64*64*3/2)
+	for i := range i420 {
+		i420[i] = 16
+	}
+	luma, ok := MeanLuma(i420, 64, 64)
+	require.True(t, ok)
+	require.Equal(t, 16.0, luma)
+
+	bgrx := make([]byte, 64*64*4)
+	for i := range bgrx {
+		bgrx[i] = 255
+	}
+	luma, ok = MeanLuma(bgrx, 64, 64)
+	require.True(t, ok)
+	require.InDelta(t, 235, luma, 0.5)
+
+	_, ok = MeanLuma(make([]byte, 10), 64, 64)
+	require.False(t, ok)
+}
+
+func TestLoudnessMeter(t *testing.T) {
+	m := NewLoudnessMeter(48000, 2, 3*time.Second)
+	require.Equal(t, MinLoudness, m.Loudness())
+
+	// a -20dBFS sine measures -20 LUFS
+	m.Write(sine(48000, 2, 1000, 0.1, 5*time.Second))
+	require.InDelta(t, -20, m.Loudness(), 0.1)
+
+	// older audio leaves the window
+	m.Write(sine(48000, 2, 1000, 1, 5*time.Second))
+	require.InDelta(t, 0, m.Loudness(), 0.1)
+}
+
+func TestNormalizationGain(t *testing.T) {
+	// moves towards the target by at most the step
+	require.Equal(t, 0.5, NormalizationGain(0, -33, -23, 12, 0.5))
+	require.Equal(t, -0.5, NormalizationGain(0, -13, -23, 12, 0.5))
+	require.InDelta(t, 10, NormalizationGain(9.8, -33, -23, 12, 0.5), 1e-9)
+
+	// limited to the max gain
+	require.Equal(t, 12.0, NormalizationGain(11.8, -60, -23, 12, 0.5))
+
+	// held during silence
+	require.Equal(t, 3.0, NormalizationGain(3, MinLoudness, -23, 12, 0.5))
+}
+
+func TestTimeline(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tl := NewTimeline(start)
+	tl.SetActive(EventVideoMuted, true, start.Add(2*time.Second))
+	tl.SetActive(EventVideoMuted, true, start.Add(3*time.Second))
+	tl.SetActive(EventAudioMuted, true, start.Add(time.Second))
+	tl.SetActive(EventVideoMuted, false, start.Add(4*time.Second))
+	tl.SetActive(EventVideoMuted, false, start.Add(5*time.Second))
+
+	events := tl.Events(start.Add(10 * time.Second))
+	require.Equal(t, []Event{
+		{Type: EventAudioMuted, Range: Range{Start: 1, End: 10}},
+		{Type: EventVideoMuted, Range: Range{Start: 2, End: 4}},
+	}, events)
+}
+
+func TestNetworkAnalyzer(t *testing.T) {
+	start := time.Now()
+	timeline := NewTimeline(start)
+	a := NewNetworkAnalyzer(timeline, 0.05)
+
+	a.Write([]*NetworkStats{
+		{TrackID: "TR_audio", Kind: "audio", Bitrate: 32, PacketsReceived: 500, Jitter: 4},
+		{TrackID: "TR_video", Kind: "video", Bitrate: 2000, PacketsReceived: 1000, Jitter: 10},
+	}, start.Add(10*time.Second))
+	a.Write([]*NetworkStats{
+		{TrackID: "TR_audio", Kind: "audio", Bitrate: 30, PacketsReceived: 490, PacketsLost: 10, PacketLoss: 0.02, Jitter: 6},
+		{TrackID: "TR_video", Kind: "video", Bitrate: 1000, PacketsReceived: 900, PacketsLost: 100, PacketLoss: 0.1, Jitter: 30},
+	}, start.Add(20*time.Second))
+	a.Write([]*NetworkStats{
+		{TrackID: "TR_audio", Kind: "audio", Bitrate: 34, PacketsReceived: 500, Jitter: 5},
+		{TrackID: "TR_video", Kind: "video", Bitrate: 2000, PacketsReceived: 1000, Jitter: 20},
+	}, start.Add(30*time.Second))
+
+	reports := a.Report()
+	require.Len(t, reports, 2)
+	require.Equal(t, "TR_audio", reports[0].TrackID)
+	require.InDelta(t, 32, reports[0].AvgBitrate, 0.01)
+	require.InDelta(t, 30, reports[0].MinBitrate, 0.01)
+	require.Equal(t, int64(10), reports[0].PacketsLost)
+	require.InDelta(t, 10.0/1500, reports[0].PacketLoss, 0.0001)
+	require.InDelta(t, 5, reports[0].AvgJitter, 0.01)
+	require.InDelta(t, 6, reports[0].MaxJitter, 0.01)
+
+	require.Equal(t, "TR_video", reports[1].TrackID)
+	require.Equal(t, int64(100), reports[1].PacketsLost)
+	require.InDelta(t, 100.0/3000, reports[1].PacketLoss, 0.0001)
+	require.InDelta(t, 30, reports[1].MaxJitter, 0.01)
+
+	// only the interval with video loss above the threshold is recorded
+	events := timeline.Events(start.Add(30 * time.Second))
+	require.Len(t, events, 1)
+	require.Equal(t, EventPacketLoss, events[0].Type)
+	require.InDelta(t, 20, events[0].Start, 0.01)
+	require.InDelta(t, 30, events[0].End, 0.01)
+}
@@ -0,0 +1,41 @@
+package qc
+
+import (
+	"time"
+)
+
+// Report is uploaded as json next to the recording once it completes
+type Report struct {
+	EgressID string           `json:"egress_id"`
+	Audio    *AudioReport     `json:"audio,omitempty"`
+	Video    *VideoReport     `json:"video,omitempty"`
+	Events   []Event          `json:"events,omitempty"`  // mute periods, outages, and packet loss
+	Network  []*NetworkReport `json:"network,omitempty"` // per subscribed track, when network stats are enabled
+}
+
+type AudioReport struct {
+	IntegratedLoudness float64 `json:"integrated_loudness_lufs"` // EBU R128 / ITU-R BS.1770-4
+	TruePeak           float64 `json:"true_peak_dbtp"`
+	SilenceRanges      []Range `json:"silence_ranges"`
+	Duration           float64 `json:"duration"` // seconds of audio analyzed
+}
+
+type VideoReport struct {
+	BlackFrameRanges []Range `json:"black_frame_ranges"`
+	Frames           uint64  `json:"frames"`
+	DroppedFrames    uint64  `json:"dropped_frames"`
+	DuplicatedFrames uint64  `json:"duplicated_frames"`
+}
+
+// Range is a time range in seconds, relative to the start of the recording
+type Range struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+func newRange(start, end time.Duration) Range {
+	return Range{
+		Start: start.Seconds(),
+		End:   end.Seconds(),
+	}
+}
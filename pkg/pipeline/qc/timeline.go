@@ -0,0 +1,77 @@
+package qc
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	EventAudioMuted = "audio_muted"
+	EventVideoMuted = "video_muted"
+
+	EventSignalingOutage = "signaling_outage"
+)
+
+// Event is a range of the recording during which a track was in a given state
+type Event struct {
+	Type string `json:"type"`
+	Range
+}
+
+// Timeline records track events, relative to the start of the recording
+type Timeline struct {
+	mu sync.Mutex
+
+	start  time.Time
+	open   map[string]time.Duration
+	events []Event
+}
+
+func NewTimeline(start time.Time) *Timeline {
+	return &Timeline{
+		start: start,
+		open:  make(map[string]time.Duration),
+	}
+}
+
+// SetActive starts or ends an event. Repeated starts and ends are ignored
+func (t *Timeline) SetActive(eventType string, active bool, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	offset := at.Sub(t.start)
+	if offset < 0 {
+		offset = 0
+	}
+
+	start, ok := t.open[eventType]
+	switch {
+	case active && !ok:
+		t.open[eventType] = offset
+	case !active && ok:
+		t.events = append(t.events, Event{Type: eventType, Range: newRange(start, offset)})
+		delete(t.open, eventType)
+	}
+}
+
+// Events returns all events ordered by start time, ending any which are still active
+func (t *Timeline) Events(end time.Time) []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	offset := end.Sub(t.start)
+	events := make([]Event, len(t.events), len(t.events)+len(t.open))
+	copy(events, t.events)
+	for eventType, start := range t.open {
+		events = append(events, Event{Type: eventType, Range: newRange(start, offset)})
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Start == events[j].Start {
+			return events[i].Type < events[j].Type
+		}
+		return events[i].Start < events[j].Start
+	})
+	return events
+}
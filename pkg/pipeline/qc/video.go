@@ -0,0 +1,114 @@
+package qc
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	blackThreshold        = 24.0 // mean luma, where limited range black is 16
+	minBlackFrameDuration = 500 * time.Millisecond
+	lumaSampleStep        = 16
+)
+
+// VideoAnalyzer finds black frame ranges in raw video
+type VideoAnalyzer struct {
+	mu sync.Mutex
+
+	frames     uint64
+	firstPTS   time.Duration
+	lastPTS    time.Duration
+	blackStart time.Duration // -1 when not black
+	black      []Range
+}
+
+func NewVideoAnalyzer() *VideoAnalyzer {
+	return &VideoAnalyzer{
+		blackStart: -1,
+	}
+}
+
+// WriteFrame records a frame's mean luma (0-255)
+func (v *VideoAnalyzer) WriteFrame(pts time.Duration, meanLuma float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.frames == 0 {
+		v.firstPTS = pts
+	}
+	v.frames++
+	pts -= v.firstPTS
+	v.lastPTS = pts
+
+	if meanLuma <= blackThreshold {
+		if v.blackStart < 0 {
+			v.blackStart = pts
+		}
+	} else {
+		v.endBlack(pts)
+	}
+}
+
+func (v *VideoAnalyzer) endBlack(end time.Duration) {
+	if v.blackStart < 0 {
+		return
+	}
+
+	if end-v.blackStart >= minBlackFrameDuration {
+		v.black = append(v.black, newRange(v.blackStart, end))
+	}
+	v.blackStart = -1
+}
+
+func (v *VideoAnalyzer) Report(dropped, duplicated uint64) *VideoReport {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.endBlack(v.lastPTS)
+
+	black := v.black
+	if black == nil {
+		black = make([]Range, 0)
+	}
+
+	return &VideoReport{
+		BlackFrameRanges: black,
+		Frames:           v.frames,
+		DroppedFrames:    dropped,
+		DuplicatedFrames: duplicated,
+	}
+}
+
+// MeanLuma estimates the mean luma of an I420 or packed 32-bit RGB frame by sampling pixels.
+// Returns false for other formats.
+func MeanLuma(data []byte, width, height int) (float64, bool) {
+	pixels := width * height
+	if pixels == 0 {
+		return 0, false
+	}
+
+	var sum float64
+	var count int
+	switch len(data) {
+	case pixels * 3 / 2:
+		// I420 - the Y plane comes first
+		for i := 0; i < pixels; i += lumaSampleStep {
+			sum += float64(data[i])
+			count++
+		}
+
+	case pixels * 4:
+		// BGRx, from ximagesrc
+		for i := 0; i < pixels; i += lumaSampleStep {
+			p := data[i*4 : i*4+3]
+			// BT.601, scaled to limited range
+			sum += 16 + (0.299*float64(p[2])+0.587*float64(p[1])+0.114*float64(p[0]))*219/255
+			count++
+		}
+
+	default:
+		return 0, false
+	}
+
+	return sum / float64(count), true
+}
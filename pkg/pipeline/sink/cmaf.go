@@ -0,0 +1,149 @@
+package sink
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/frostbyte73/core"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/sink/fmp4"
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+)
+
+const chunkPollInterval = time.Millisecond * 10
+
+var errNoInitSegment = errors.New("fragment before init segment")
+
+// chunkedSegment streams the fragments of an fmp4 segment to storage while splitmuxsink writes it.
+// The init segment (ftyp and moov) is handed to onInit, and only the fragments (moof and mdat) are sent
+type chunkedSegment struct {
+	upload      *uploader.ChunkedUpload
+	localPath   string
+	storageName string // as listed in the playlist
+	storagePath string
+	startTime   time.Duration // added to fragment decode times
+	onInit      func([]byte) error
+
+	closed core.Fuse // the segment has been written
+	done   core.Fuse
+
+	location string
+	size     int64
+	err      error
+}
+
+func newChunkedSegment(upload *uploader.ChunkedUpload, localPath string, startTime time.Duration, onInit func([]byte) error) *chunkedSegment {
+	c := &chunkedSegment{
+		upload:    upload,
+		localPath: localPath,
+		startTime: startTime,
+		onInit:    onInit,
+		closed:    core.NewFuse(),
+		done:      core.NewFuse(),
+	}
+	go c.run()
+	return c
+}
+
+// wait returns the result of the upload, once the segment has been closed and sent
+func (c *chunkedSegment) wait() (string, int64, error) {
+	<-c.done.Watch()
+	return c.location, c.size, c.err
+}
+
+func (c *chunkedSegment) run() {
+	defer c.done.Break()
+
+	if err := c.stream(); err != nil {
+		c.upload.Abort(err)
+		c.err = err
+		return
+	}
+	c.location, c.size, c.err = c.upload.Close()
+}
+
+func (c *chunkedSegment) stream() error {
+	ticker := time.NewTicker(chunkPollInterval)
+	defer ticker.Stop()
+
+	var f *os.File
+	defer func() {
+		if f != nil {
+			_ = f.Close()
+		}
+	}()
+
+	var buf, initSegment []byte
+	var timescales map[uint32]uint32
+	readBuf := make([]byte, 64*1024)
+	for {
+		// checked before reading, so that everything written before the segment closed is read
+		closed := c.closed.IsBroken()
+
+		if f == nil {
+			var err error
+			if f, err = os.Open(c.localPath); err != nil {
+				if !os.IsNotExist(err) || closed {
+					return err
+				}
+				<-ticker.C
+				continue
+			}
+		}
+
+		for {
+			n, err := f.Read(readBuf)
+			buf = append(buf, readBuf[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		for {
+			typ, size, ok := fmp4.NextBox(buf)
+			if !ok {
+				break
+			}
+			box := buf[:size]
+			buf = buf[size:]
+
+			switch typ {
+			case "ftyp":
+				initSegment = append(initSegment, box...)
+			case "moov":
+				initSegment = append(initSegment, box...)
+				var err error
+				if timescales, err = fmp4.Timescales(initSegment); err != nil {
+					return err
+				}
+				if err = c.onInit(initSegment); err != nil {
+					return err
+				}
+			case "moof":
+				if timescales == nil {
+					return errNoInitSegment
+				}
+				if err := fmp4.ShiftDecodeTime(box, timescales, c.startTime); err != nil {
+					return err
+				}
+				if _, err := c.upload.Write(box); err != nil {
+					return err
+				}
+			case "mdat":
+				if _, err := c.upload.Write(box); err != nil {
+					return err
+				}
+			}
+		}
+
+		if closed {
+			return nil
+		}
+		<-ticker.C
+	}
+}
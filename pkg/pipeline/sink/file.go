@@ -4,48 +4,159 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sync"
+	"time"
+
+	"github.com/frostbyte73/core"
+	"google.golang.org/protobuf/encoding/protojson"
 
 	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/logging"
 	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
 	"github.com/livekit/protocol/logger"
 )
 
 type FileSink struct {
 	*uploader.Uploader
 
-	conf *config.PipelineConfig
+	conf   *config.PipelineConfig
+	logger logger.Logger
 	*config.FileConfig
+
+	artifacts []*Artifact
+
+	index       *FileIndex
+	indexFormat string
+	indexMu     sync.Mutex // held while the index is written and uploaded
+	indexDone   core.Fuse
 }
 
 func newFileSink(u *uploader.Uploader, conf *config.PipelineConfig, o *config.FileConfig) *FileSink {
-	return &FileSink{
+	s := &FileSink{
 		Uploader:   u,
 		conf:       conf,
+		logger:     logging.Logger(logging.Sink),
 		FileConfig: o,
 	}
+
+	if _, ok := conf.Info.Request.(*livekit.EgressInfo_Track); ok && conf.FileIndex != nil {
+		switch o.OutputType {
+		case types.OutputTypeIVF:
+			s.index = newFileIndex(conf.FileIndex.Interval, true)
+			s.indexFormat = "ivf"
+		case types.OutputTypeOGG:
+			s.index = newFileIndex(conf.FileIndex.Interval, false)
+			s.indexFormat = "ogg"
+		}
+	}
+	if s.index != nil {
+		s.indexDone = core.NewFuse()
+	}
+
+	return s
+}
+
+// Index returns the file's index, or nil if it is not indexed
+func (s *FileSink) Index() *FileIndex {
+	return s.index
 }
 
 func (s *FileSink) Start() error {
+	if s.index != nil {
+		go s.updateIndex()
+	}
 	return nil
 }
 
+// updateIndex uploads the index periodically while recording, so that it can be used before the file is complete
+func (s *FileSink) updateIndex() {
+	ticker := time.NewTicker(s.conf.FileIndex.UpdateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.indexDone.Watch():
+			return
+		case <-ticker.C:
+			if err := s.uploadIndex(false); err != nil {
+				s.logger.Warnw("failed to upload file index", err)
+			}
+		}
+	}
+}
+
+func (s *FileSink) uploadIndex(complete bool) error {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	localFilepath := fmt.Sprintf("%s.index.json", s.LocalFilepath)
+	updated, err := s.index.Write(localFilepath, s.indexFormat, complete)
+	if err != nil || !updated {
+		return err
+	}
+
+	_, _, err = s.Upload(localFilepath, fmt.Sprintf("%s.index.json", s.StorageFilepath), types.OutputTypeJSON)
+	return err
+}
+
 func (s *FileSink) Finalize() error {
-	location, size, err := s.Upload(s.LocalFilepath, s.StorageFilepath, s.OutputType)
+	if s.index != nil {
+		s.indexDone.Break()
+		// a missing index should not fail the recording
+		if err := s.uploadIndex(true); err != nil {
+			s.logger.Warnw("failed to upload file index", err)
+		}
+	}
+
+	if len(s.conf.PostProcessing) > 0 {
+		s.postProcess()
+	}
+
+	pending := s.writePendingUpload()
+	location, size, checksums, err := s.UploadWithChecksums(s.LocalFilepath, s.StorageFilepath, s.OutputType)
 	if err != nil {
 		return err
 	}
 	s.FileInfo.Location = location
 	s.FileInfo.Size = size
+	s.Checksums = checksums
+	if pending != nil {
+		if err = pending.Remove(); err != nil {
+			s.logger.Warnw("failed to remove pending upload", err)
+		}
+	}
 
 	if !s.DisableManifest {
 		manifestLocalPath := fmt.Sprintf("%s.json", s.LocalFilepath)
 		manifestStoragePath := fmt.Sprintf("%s.json", s.StorageFilepath)
-		if err = uploadManifest(s.conf, s.Uploader, manifestLocalPath, manifestStoragePath); err != nil {
+		if err = uploadManifest(s.conf, s.Uploader, manifestLocalPath, manifestStoragePath, s.artifacts, s.Checksums); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	// the file keeps its location, but the egress fails
+	return s.RequiredReplicaError()
+}
+
+// writePendingUpload records the upload, so that it can be resumed by the service if this process crashes before it completes
+func (s *FileSink) writePendingUpload() *uploader.PendingUpload {
+	if !s.conf.RecoverUploads || s.LocalFilepath == s.StorageFilepath {
+		return nil
+	}
+
+	info, err := protojson.Marshal(s.conf.Info)
+	if err != nil {
+		s.logger.Warnw("failed to write pending upload", err)
+		return nil
+	}
+	pending := uploader.NewPendingUpload(s.conf.Info.EgressId, s.LocalFilepath, s.StorageFilepath, s.OutputType, info, s.UploadConfig)
+	if err = pending.Write(); err != nil {
+		s.logger.Warnw("failed to write pending upload", err)
+		return nil
+	}
+	return pending
 }
 
 func (s *FileSink) Cleanup() {
@@ -55,9 +166,9 @@ func (s *FileSink) Cleanup() {
 
 	dir, _ := path.Split(s.LocalFilepath)
 	if dir != "" {
-		logger.Debugw("removing temporary directory", "path", dir)
+		s.logger.Debugw("removing temporary directory", "path", dir)
 		if err := os.RemoveAll(dir); err != nil {
-			logger.Errorw("could not delete temp dir", err)
+			s.logger.Errorw("could not delete temp dir", err)
 		}
 	}
 }
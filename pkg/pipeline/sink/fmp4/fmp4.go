@@ -0,0 +1,262 @@
+package fmp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+var (
+	errInvalidMP4 = errors.New("invalid mp4")
+	errNoFragment = errors.New("mp4 has no fragments")
+	errOverflow   = errors.New("decode time does not fit in a version 0 tfdt")
+)
+
+type box struct {
+	typ    string
+	start  int // offset of the box header
+	header int // header length
+	size   int // total length, including the header
+}
+
+func (b box) payload(buf []byte) []byte {
+	return buf[b.start+b.header : b.start+b.size]
+}
+
+// readBoxes returns the top level boxes in b
+func readBoxes(b []byte) ([]box, error) {
+	var boxes []box
+	for pos := 0; pos < len(b); {
+		if len(b)-pos < 8 {
+			return nil, errInvalidMP4
+		}
+
+		size := int(binary.BigEndian.Uint32(b[pos:]))
+		header := 8
+		switch size {
+		case 0:
+			// extends to the end of the file
+			size = len(b) - pos
+		case 1:
+			if len(b)-pos < 16 {
+				return nil, errInvalidMP4
+			}
+			size = int(binary.BigEndian.Uint64(b[pos+8:]))
+			header = 16
+		}
+		if size < header || pos+size > len(b) {
+			return nil, errInvalidMP4
+		}
+
+		boxes = append(boxes, box{
+			typ:    string(b[pos+4 : pos+8]),
+			start:  pos,
+			header: header,
+			size:   size,
+		})
+		pos += size
+	}
+	return boxes, nil
+}
+
+// NextBox returns the type and size of the first box in b, and false if b doesn't hold the whole box yet.
+// Boxes which extend to the end of the file never complete
+func NextBox(b []byte) (typ string, size int, ok bool) {
+	if len(b) < 8 {
+		return "", 0, false
+	}
+	size = int(binary.BigEndian.Uint32(b))
+	header := 8
+	if size == 1 {
+		if len(b) < 16 {
+			return "", 0, false
+		}
+		size = int(binary.BigEndian.Uint64(b[8:]))
+		header = 16
+	}
+	if size < header || size > len(b) {
+		return "", 0, false
+	}
+	return string(b[4:8]), size, true
+}
+
+// SplitInitSegment splits a fragmented mp4 file into its init segment (ftyp and moov), and its media
+// (each moof and mdat). Anything after the last fragment, such as the mfra index, is dropped.
+func SplitInitSegment(b []byte) (initSegment []byte, media []byte, err error) {
+	boxes, err := readBoxes(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(boxes) == 0 || boxes[0].typ != "ftyp" {
+		return nil, nil, errInvalidMP4
+	}
+
+	first, end := -1, -1
+	for _, bx := range boxes {
+		switch bx.typ {
+		case "moof", "mdat":
+			if first < 0 {
+				if bx.typ != "moof" {
+					return nil, nil, errInvalidMP4
+				}
+				first = bx.start
+			}
+			end = bx.start + bx.size
+		}
+	}
+	if first < 0 {
+		return nil, nil, errNoFragment
+	}
+
+	return b[:first], b[first:end], nil
+}
+
+// Timescales returns the media timescale of each track in an init segment, by track ID
+func Timescales(initSegment []byte) (map[uint32]uint32, error) {
+	boxes, err := readBoxes(initSegment)
+	if err != nil {
+		return nil, err
+	}
+
+	timescales := make(map[uint32]uint32)
+	for _, moov := range boxes {
+		if moov.typ != "moov" {
+			continue
+		}
+		moovPayload := moov.payload(initSegment)
+		traks, err := readBoxes(moovPayload)
+		if err != nil {
+			return nil, err
+		}
+		for _, trak := range traks {
+			if trak.typ != "trak" {
+				continue
+			}
+			id, timescale, err := readTrak(trak.payload(moovPayload))
+			if err != nil {
+				return nil, err
+			}
+			timescales[id] = timescale
+		}
+	}
+	return timescales, nil
+}
+
+func readTrak(trak []byte) (id uint32, timescale uint32, err error) {
+	children, err := readBoxes(trak)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, child := range children {
+		payload := child.payload(trak)
+		switch child.typ {
+		case "tkhd":
+			// full box header, then creation and modification times
+			offset := 12
+			if len(payload) > 0 && payload[0] == 1 {
+				offset = 20
+			}
+			if len(payload) < offset+4 {
+				return 0, 0, errInvalidMP4
+			}
+			id = binary.BigEndian.Uint32(payload[offset:])
+
+		case "mdia":
+			mdia, err := readBoxes(payload)
+			if err != nil {
+				return 0, 0, err
+			}
+			for _, mdhd := range mdia {
+				if mdhd.typ != "mdhd" {
+					continue
+				}
+				p := mdhd.payload(payload)
+				offset := 12
+				if len(p) > 0 && p[0] == 1 {
+					offset = 20
+				}
+				if len(p) < offset+4 {
+					return 0, 0, errInvalidMP4
+				}
+				timescale = binary.BigEndian.Uint32(p[offset:])
+			}
+		}
+	}
+
+	if timescale == 0 {
+		return 0, 0, errInvalidMP4
+	}
+	return id, timescale, nil
+}
+
+// ShiftDecodeTime adds offset to the base media decode time of every fragment, in place.
+// Each segment is muxed as its own file starting at zero, so this restores a continuous timeline.
+func ShiftDecodeTime(media []byte, timescales map[uint32]uint32, offset time.Duration) error {
+	boxes, err := readBoxes(media)
+	if err != nil {
+		return err
+	}
+
+	for _, moof := range boxes {
+		if moof.typ != "moof" {
+			continue
+		}
+		moofPayload := moof.payload(media)
+		trafs, err := readBoxes(moofPayload)
+		if err != nil {
+			return err
+		}
+		for _, traf := range trafs {
+			if traf.typ != "traf" {
+				continue
+			}
+			if err = shiftTraf(traf.payload(moofPayload), timescales, offset); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func shiftTraf(traf []byte, timescales map[uint32]uint32, offset time.Duration) error {
+	children, err := readBoxes(traf)
+	if err != nil {
+		return err
+	}
+
+	var timescale uint32
+	for _, child := range children {
+		payload := child.payload(traf)
+		switch child.typ {
+		case "tfhd":
+			if len(payload) < 8 {
+				return errInvalidMP4
+			}
+			timescale = timescales[binary.BigEndian.Uint32(payload[4:])]
+
+		case "tfdt":
+			if timescale == 0 {
+				return errInvalidMP4
+			}
+			// split to avoid overflowing long offsets
+			shift := uint64(offset/time.Second)*uint64(timescale) + uint64(offset%time.Second)*uint64(timescale)/uint64(time.Second)
+			if len(payload) > 0 && payload[0] == 1 {
+				if len(payload) < 12 {
+					return errInvalidMP4
+				}
+				binary.BigEndian.PutUint64(payload[4:], binary.BigEndian.Uint64(payload[4:])+shift)
+			} else {
+				if len(payload) < 8 {
+					return errInvalidMP4
+				}
+				t := uint64(binary.BigEndian.Uint32(payload[4:])) + shift
+				if t > 0xffffffff {
+					return errOverflow
+				}
+				binary.BigEndian.PutUint32(payload[4:], uint32(t))
+			}
+		}
+	}
+	return nil
+}
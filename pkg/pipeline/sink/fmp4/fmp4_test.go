@@ -0,0 +1,103 @@
+package fmp4
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func mp4Box(typ string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	b := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(b, uint32(size))
+	copy(b[4:], typ)
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func fullBox(version byte, fields ...uint32) []byte {
+	b := []byte{version, 0, 0, 0}
+	for _, f := range fields {
+		field := make([]byte, 4)
+		binary.BigEndian.PutUint32(field, f)
+		b = append(b, field...)
+	}
+	return b
+}
+
+func TestSplitInitSegment(t *testing.T) {
+	initSegment := append(
+		mp4Box("ftyp", []byte("iso6")),
+		mp4Box("moov",
+			mp4Box("trak",
+				mp4Box("tkhd", fullBox(0, 0, 0, 1)),
+				mp4Box("mdia", mp4Box("mdhd", fullBox(0, 0, 0, 90000))),
+			),
+			mp4Box("trak",
+				mp4Box("tkhd", fullBox(0, 0, 0, 2)),
+				mp4Box("mdia", mp4Box("mdhd", fullBox(0, 0, 0, 48000))),
+			),
+		)...,
+	)
+	moof := mp4Box("moof",
+		mp4Box("traf", mp4Box("tfhd", fullBox(0, 1)), mp4Box("tfdt", fullBox(1, 0, 9000))),
+		mp4Box("traf", mp4Box("tfhd", fullBox(0, 2)), mp4Box("tfdt", fullBox(0, 4800))),
+	)
+	mdat := mp4Box("mdat", []byte{1, 2, 3})
+	mfra := mp4Box("mfra")
+
+	file := append(append(append(append([]byte{}, initSegment...), moof...), mdat...), mfra...)
+	i, media, err := SplitInitSegment(file)
+	require.NoError(t, err)
+	require.Equal(t, initSegment, i)
+	require.Equal(t, append(append([]byte{}, moof...), mdat...), media)
+
+	timescales, err := Timescales(i)
+	require.NoError(t, err)
+	require.Equal(t, map[uint32]uint32{1: 90000, 2: 48000}, timescales)
+
+	require.NoError(t, ShiftDecodeTime(media, timescales, time.Second*2))
+	shifted := append(
+		mp4Box("moof",
+			mp4Box("traf", mp4Box("tfhd", fullBox(0, 1)), mp4Box("tfdt", fullBox(1, 0, 189000))),
+			mp4Box("traf", mp4Box("tfhd", fullBox(0, 2)), mp4Box("tfdt", fullBox(0, 100800))),
+		),
+		mdat...,
+	)
+	require.Equal(t, shifted, media)
+
+	_, _, err = SplitInitSegment(initSegment)
+	require.ErrorIs(t, err, errNoFragment)
+
+	_, _, err = SplitInitSegment(mdat)
+	require.ErrorIs(t, err, errInvalidMP4)
+}
+
+func TestNextBox(t *testing.T) {
+	moof := mp4Box("moof", mp4Box("traf"))
+	mdat := mp4Box("mdat", []byte{1, 2, 3})
+	b := append(append([]byte{}, moof...), mdat...)
+
+	typ, size, ok := NextBox(b)
+	require.True(t, ok)
+	require.Equal(t, "moof", typ)
+	require.Equal(t, len(moof), size)
+
+	// partially written
+	_, _, ok = NextBox(b[len(moof) : len(b)-1])
+	require.False(t, ok)
+	_, _, ok = NextBox(b[:4])
+	require.False(t, ok)
+
+	typ, size, ok = NextBox(b[len(moof):])
+	require.True(t, ok)
+	require.Equal(t, "mdat", typ)
+	require.Equal(t, len(mdat), size)
+}
@@ -0,0 +1,31 @@
+package sink
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const (
+	frameVersion    = 1
+	frameHeaderSize = 10
+
+	frameFlagKeyframe = 1 << 0
+)
+
+// encodeFrame prefixes an encoded video frame with a header, so that websocket receivers can decode frames without
+// parsing the bitstream:
+//
+//	byte 0:     version (1)
+//	byte 1:     flags (bit 0 set for keyframes)
+//	bytes 2-9:  presentation timestamp in ns since the start of the egress, big endian, or -1 if unknown
+//	bytes 10-:  the frame (VP8 frame, or H264 access unit in annex b byte-stream format)
+func encodeFrame(pts time.Duration, keyframe bool, frame []byte) []byte {
+	b := make([]byte, frameHeaderSize+len(frame))
+	b[0] = frameVersion
+	if keyframe {
+		b[1] |= frameFlagKeyframe
+	}
+	binary.BigEndian.PutUint64(b[2:], uint64(pts))
+	copy(b[frameHeaderSize:], frame)
+	return b
+}
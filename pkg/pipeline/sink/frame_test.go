@@ -0,0 +1,24 @@
+package sink
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeFrame(t *testing.T) {
+	frame := []byte{0x9d, 0x01, 0x2a}
+
+	b := encodeFrame(1500*time.Millisecond, true, frame)
+	require.Len(t, b, frameHeaderSize+len(frame))
+	require.Equal(t, byte(frameVersion), b[0])
+	require.Equal(t, byte(frameFlagKeyframe), b[1])
+	require.Equal(t, int64(1500*time.Millisecond), int64(binary.BigEndian.Uint64(b[2:])))
+	require.Equal(t, frame, b[frameHeaderSize:])
+
+	b = encodeFrame(-1, false, frame)
+	require.Equal(t, byte(0), b[1])
+	require.Equal(t, int64(-1), int64(binary.BigEndian.Uint64(b[2:])))
+}
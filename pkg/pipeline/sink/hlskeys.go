@@ -0,0 +1,108 @@
+package sink
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/livekit/egress/pkg/pipeline/sink/keys"
+	"github.com/livekit/egress/pkg/pipeline/sink/m3u8"
+	"github.com/livekit/egress/pkg/types"
+)
+
+// hlsKeys encrypts hls segments, and adds EXT-X-KEY tags to the playlist whenever the key changes
+type hlsKeys struct {
+	playlist *m3u8.PlaylistWriter
+	provider keys.Provider
+	static   bool
+	key      []byte
+	period   int // number of keys used so far
+	segments int // segments encrypted with the current key
+}
+
+func newHLSKeys(s *SegmentSink, playlist *m3u8.PlaylistWriter) (*hlsKeys, error) {
+	k := &hlsKeys{
+		playlist: playlist,
+	}
+
+	conf := s.HLSEncryption
+	switch {
+	case conf.KeyServer != nil:
+		k.provider = keys.NewKeyServerProvider(conf.KeyServer, s.conf.Info.EgressId)
+	case conf.Key != "":
+		key, err := hex.DecodeString(conf.Key)
+		if err != nil {
+			return nil, err
+		}
+		k.provider = keys.NewStaticProvider(key, conf.KeyURI)
+		k.static = true
+	default:
+		k.provider = keys.NewGeneratedProvider(conf.KeyURI)
+	}
+
+	return k, nil
+}
+
+// encryptSegment replaces a local segment with its encrypted copy, rotating the key first if needed
+func (s *SegmentSink) encryptSegment(segmentLocalPath string, sequence uint64) error {
+	if err := s.rotateKey(); err != nil {
+		return err
+	}
+
+	b, err := os.ReadFile(segmentLocalPath)
+	if err != nil {
+		return err
+	}
+	encrypted, err := m3u8.EncryptSegment(b, s.keys.key, sequence)
+	if err != nil {
+		return err
+	}
+	s.keys.segments++
+
+	return os.WriteFile(segmentLocalPath, encrypted, 0644)
+}
+
+func (s *SegmentSink) rotateKey() error {
+	k := s.keys
+	if k.period > 0 && (k.static || s.HLSEncryption.RotationInterval == 0 || k.segments < s.HLSEncryption.RotationInterval) {
+		return nil
+	}
+
+	ck, err := k.provider.GetKey(k.period)
+	if err != nil {
+		return err
+	}
+
+	keyName := fmt.Sprintf("%s_key%05d.key", s.SegmentPrefix, k.period)
+	if k.static {
+		keyName = fmt.Sprintf("%s.key", s.SegmentPrefix)
+	}
+
+	var uri string
+	if ck.URI != "" {
+		uri = strings.ReplaceAll(ck.URI, "{key}", path.Base(keyName))
+	} else if uri, err = s.getPlaylistURI(keyName); err != nil {
+		return err
+	}
+
+	if ck.Upload || ck.URI == "" {
+		keyLocalPath := path.Join(s.LocalDir, keyName)
+		if err = os.WriteFile(keyLocalPath, ck.Key, 0600); err != nil {
+			return err
+		}
+		if _, _, err = s.Upload(keyLocalPath, path.Join(s.StorageDir, keyName), types.OutputTypeKey); err != nil {
+			return err
+		}
+	}
+
+	if err = k.playlist.SetKey(append([]m3u8.Key{{URI: uri}}, ck.Signaling...)...); err != nil {
+		return err
+	}
+
+	k.key = ck.Key
+	k.period++
+	k.segments = 0
+	return nil
+}
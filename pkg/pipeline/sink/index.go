@@ -0,0 +1,102 @@
+package sink
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileIndex maps timestamps to byte offsets of a passthrough ivf or ogg file,
+// so that long recordings can be seeked or clipped without parsing the whole file
+type FileIndex struct {
+	mu sync.Mutex
+
+	interval time.Duration
+	video    bool
+
+	position int64 // offset of the next buffer written
+	end      int64 // bytes written, excluding header rewrites
+	last     time.Duration
+	entries  []IndexEntry
+	dirty    bool
+}
+
+type IndexEntry struct {
+	PTS    int64 `json:"pts"`    // ns from the start of the recording
+	Offset int64 `json:"offset"` // of the first byte of the frame or page
+}
+
+type indexFile struct {
+	Format   string       `json:"format"`   // ivf or ogg
+	Complete bool         `json:"complete"` // false while the file is still being written
+	Size     int64        `json:"size"`     // bytes covered by the entries
+	Entries  []IndexEntry `json:"entries"`
+}
+
+// newFileIndex adds an entry at most once per interval. Video entries are only added at keyframes
+func newFileIndex(interval time.Duration, video bool) *FileIndex {
+	return &FileIndex{
+		interval: interval,
+		video:    video,
+		last:     -interval,
+	}
+}
+
+// OnBuffer is called for each buffer written to the file. pts is negative for buffers without timestamps
+func (i *FileIndex) OnBuffer(pts time.Duration, size int64, keyframe bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	offset := i.position
+	i.position += size
+	if offset < i.end {
+		// muxers rewrite their headers on eos
+		return
+	}
+	i.end = i.position
+
+	if pts < 0 || (i.video && !keyframe) || pts-i.last < i.interval {
+		return
+	}
+	i.entries = append(i.entries, IndexEntry{PTS: int64(pts), Offset: offset})
+	i.last = pts
+	i.dirty = true
+}
+
+// OnSeek is called when the file writer moves to a new byte offset
+func (i *FileIndex) OnSeek(offset int64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.position = offset
+}
+
+// Write writes the index as json, returning false if nothing changed since the last incomplete write
+func (i *FileIndex) Write(localFilepath, format string, complete bool) (bool, error) {
+	i.mu.Lock()
+	if !i.dirty && !complete {
+		i.mu.Unlock()
+		return false, nil
+	}
+	f := &indexFile{
+		Format:   format,
+		Complete: complete,
+		Size:     i.end,
+		Entries:  append([]IndexEntry{}, i.entries...),
+	}
+	i.dirty = false
+	i.mu.Unlock()
+
+	b, err := json.Marshal(f)
+	if err != nil {
+		return false, err
+	}
+
+	// the previous index stays readable until it is replaced
+	tmp := localFilepath + ".tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp, localFilepath)
+}
@@ -0,0 +1,69 @@
+package sink
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileIndex(t *testing.T) {
+	index := newFileIndex(time.Second, true)
+
+	// file header without a timestamp
+	index.OnBuffer(-1, 32, true)
+	for i := 0; i < 90; i++ {
+		// a keyframe every 40 frames at 30fps
+		index.OnBuffer(time.Duration(i)*time.Second/30, 100, i%40 == 0)
+	}
+	// header rewritten on eos
+	index.OnSeek(0)
+	index.OnBuffer(-1, 32, true)
+
+	require.Equal(t, []IndexEntry{
+		{PTS: 0, Offset: 32},
+		{PTS: int64(40 * time.Second / 30), Offset: 32 + 40*100},
+		{PTS: int64(80 * time.Second / 30), Offset: 32 + 80*100},
+	}, index.entries)
+
+	localFilepath := path.Join(t.TempDir(), "track.ivf.index.json")
+	updated, err := index.Write(localFilepath, "ivf", false)
+	require.NoError(t, err)
+	require.True(t, updated)
+
+	// unchanged
+	updated, err = index.Write(localFilepath, "ivf", false)
+	require.NoError(t, err)
+	require.False(t, updated)
+
+	updated, err = index.Write(localFilepath, "ivf", true)
+	require.NoError(t, err)
+	require.True(t, updated)
+
+	b, err := os.ReadFile(localFilepath)
+	require.NoError(t, err)
+	f := &indexFile{}
+	require.NoError(t, json.Unmarshal(b, f))
+	require.True(t, f.Complete)
+	require.Equal(t, int64(32+90*100), f.Size)
+	require.Len(t, f.Entries, 3)
+}
+
+func TestFileIndexAudio(t *testing.T) {
+	index := newFileIndex(time.Second, false)
+
+	// ogg pages of 20 frames
+	for i := 0; i < 10; i++ {
+		index.OnBuffer(time.Duration(i)*400*time.Millisecond, 1000, false)
+	}
+
+	require.Equal(t, []IndexEntry{
+		{PTS: 0, Offset: 0},
+		{PTS: int64(1200 * time.Millisecond), Offset: 3000},
+		{PTS: int64(2400 * time.Millisecond), Offset: 6000},
+		{PTS: int64(3600 * time.Millisecond), Offset: 9000},
+	}, index.entries)
+}
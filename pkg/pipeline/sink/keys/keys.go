@@ -0,0 +1,67 @@
+package keys
+
+import (
+	"crypto/rand"
+
+	"github.com/livekit/egress/pkg/pipeline/sink/m3u8"
+)
+
+// Provider supplies the content key for each key period. A new period starts whenever the key is rotated.
+type Provider interface {
+	GetKey(period int) (*ContentKey, error)
+}
+
+type ContentKey struct {
+	Key []byte // 16 byte AES-128 key
+
+	// URI is the EXT-X-KEY uri. {key} is replaced by the key filename.
+	// When empty, or when Upload is set, the key is uploaded next to the segments.
+	URI    string
+	Upload bool
+
+	// Signaling is written to the playlist after the key, for DRM systems
+	Signaling []m3u8.Key
+}
+
+type staticProvider struct {
+	key *ContentKey
+}
+
+// NewStaticProvider always returns the same key
+func NewStaticProvider(key []byte, uri string) Provider {
+	return &staticProvider{
+		key: &ContentKey{
+			Key:    key,
+			URI:    uri,
+			Upload: uri == "",
+		},
+	}
+}
+
+func (p *staticProvider) GetKey(_ int) (*ContentKey, error) {
+	return p.key, nil
+}
+
+type generatedProvider struct {
+	uri string
+}
+
+// NewGeneratedProvider returns a random key for each period, which is uploaded next to the segments
+func NewGeneratedProvider(uri string) Provider {
+	return &generatedProvider{
+		uri: uri,
+	}
+}
+
+func (p *generatedProvider) GetKey(_ int) (*ContentKey, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return &ContentKey{
+		Key:    key,
+		URI:    p.uri,
+		Upload: true,
+	}, nil
+}
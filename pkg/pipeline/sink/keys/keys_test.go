@@ -0,0 +1,78 @@
+package keys
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/pipeline/sink/m3u8"
+)
+
+func TestKeyServerProvider(t *testing.T) {
+	key := []byte("0123456789abcdef")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &keyRequest{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+		require.Equal(t, "EG_test", req.ContentID)
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+		_ = json.NewEncoder(w).Encode(&keyResponse{
+			Key: key,
+			URI: "https://keys.example.com/EG_test/1",
+			Signaling: []drmSignaling{{
+				System:            config.DRMFairPlay,
+				Method:            "SAMPLE-AES",
+				URI:               "skd://EG_test",
+				KeyFormat:         "com.apple.streamingkeydelivery",
+				KeyFormatVersions: "1",
+			}, {
+				System: config.DRMWidevine,
+				Method: "SAMPLE-AES",
+				URI:    "data:text/plain;base64,AAAA",
+			}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	conf := &config.KeyServerConfig{
+		URL:        server.URL,
+		Headers:    map[string]string{"Authorization": "Bearer token"},
+		DRMSystems: []string{config.DRMFairPlay},
+		Timeout:    time.Second,
+	}
+
+	ck, err := NewKeyServerProvider(conf, "EG_test").GetKey(1)
+	require.NoError(t, err)
+	require.Equal(t, key, ck.Key)
+	require.Equal(t, "https://keys.example.com/EG_test/1", ck.URI)
+	require.False(t, ck.Upload)
+	require.Equal(t, []m3u8.Key{{
+		Method:            "SAMPLE-AES",
+		URI:               "skd://EG_test",
+		KeyFormat:         "com.apple.streamingkeydelivery",
+		KeyFormatVersions: "1",
+	}}, ck.Signaling)
+
+	// missing signaling for a requested system
+	conf.DRMSystems = []string{config.DRMFairPlay, "playready"}
+	_, err = NewKeyServerProvider(conf, "EG_test").GetKey(1)
+	require.Error(t, err)
+}
+
+func TestGeneratedProvider(t *testing.T) {
+	p := NewGeneratedProvider("")
+	first, err := p.GetKey(0)
+	require.NoError(t, err)
+	second, err := p.GetKey(1)
+	require.NoError(t, err)
+
+	require.Len(t, first.Key, 16)
+	require.True(t, first.Upload)
+	require.NotEqual(t, first.Key, second.Key)
+}
@@ -0,0 +1,137 @@
+package keys
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/pipeline/sink/m3u8"
+)
+
+type keyServerProvider struct {
+	conf      *config.KeyServerConfig
+	contentID string
+	client    *http.Client
+}
+
+type keyRequest struct {
+	ContentID  string   `json:"content_id"`
+	KeyPeriod  int      `json:"key_period"`
+	DRMSystems []string `json:"drm_systems,omitempty"`
+}
+
+type keyResponse struct {
+	Key       []byte         `json:"key"` // base64
+	URI       string         `json:"uri"`
+	Signaling []drmSignaling `json:"drm_signaling"`
+}
+
+type drmSignaling struct {
+	System            string `json:"system"`
+	Method            string `json:"method"`
+	URI               string `json:"uri"`
+	KeyFormat         string `json:"keyformat"`
+	KeyFormatVersions string `json:"keyformatversions"`
+}
+
+// NewKeyServerProvider requests a key for each period from a key server, similar to SPEKE.
+// The content ID identifies the egress, so the key server can return the same keys to players.
+func NewKeyServerProvider(conf *config.KeyServerConfig, contentID string) Provider {
+	return &keyServerProvider{
+		conf:      conf,
+		contentID: contentID,
+		client:    &http.Client{},
+	}
+}
+
+func (p *keyServerProvider) GetKey(period int) (*ContentKey, error) {
+	body, err := json.Marshal(&keyRequest{
+		ContentID:  p.contentID,
+		KeyPeriod:  period,
+		DRMSystems: p.conf.DRMSystems,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.conf.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range p.conf.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("key server returned %d: %s", resp.StatusCode, string(b))
+	}
+
+	res := &keyResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return nil, err
+	}
+	if len(res.Key) != 16 {
+		return nil, fmt.Errorf("key server returned a %d byte key", len(res.Key))
+	}
+	if res.URI == "" {
+		return nil, fmt.Errorf("key server returned no key uri")
+	}
+
+	key := &ContentKey{
+		Key: res.Key,
+		URI: res.URI,
+	}
+	for _, s := range res.Signaling {
+		if !p.requested(s.System) {
+			continue
+		}
+		key.Signaling = append(key.Signaling, m3u8.Key{
+			Method:            s.Method,
+			URI:               s.URI,
+			KeyFormat:         s.KeyFormat,
+			KeyFormatVersions: s.KeyFormatVersions,
+		})
+	}
+	for _, system := range p.conf.DRMSystems {
+		if !hasSystem(res.Signaling, system) {
+			return nil, fmt.Errorf("key server returned no %s signaling", system)
+		}
+	}
+
+	return key, nil
+}
+
+func (p *keyServerProvider) requested(system string) bool {
+	for _, s := range p.conf.DRMSystems {
+		if s == system {
+			return true
+		}
+	}
+	return false
+}
+
+func hasSystem(signaling []drmSignaling, system string) bool {
+	for _, s := range signaling {
+		if s.System == system {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+)
+
+// uploadPart uploads a low latency hls part, and completes the segment once it has enough parts
+func (s *SegmentSink) uploadPart(update SegmentUpdate) error {
+	if update.endTime <= s.currentItemStartTimestamp {
+		return fmt.Errorf("part end time before start time")
+	}
+
+	partLocalPath := path.Join(s.LocalDir, update.filename)
+	partStoragePath := path.Join(s.StorageDir, update.filename)
+	if _, _, err := s.Upload(partLocalPath, partStoragePath, types.OutputTypeTS); err != nil {
+		return err
+	}
+
+	part, err := s.closeSegment(update.filename, update.endTime)
+	if err != nil {
+		return err
+	}
+
+	if len(s.parts) == 0 {
+		s.partsStartPTS = part.StartPTS
+		s.partsStartDate = part.StartTime
+	}
+	s.parts = append(s.parts, update.filename)
+	s.partsDuration += part.Duration
+	s.partCount++
+
+	partURI, err := s.getPlaylistURI(update.filename)
+	if err != nil {
+		return err
+	}
+	nextURI, err := s.getPlaylistURI(s.PartFilename(s.partCount))
+	if err != nil {
+		return err
+	}
+	if err = s.lowLatency.AppendPart(part.Duration, partURI, nextURI); err != nil {
+		return err
+	}
+
+	if len(s.parts) >= s.PartsPerSegment {
+		return s.completeSegment()
+	}
+	return nil
+}
+
+// completeSegment joins the current parts into a segment, which is uploaded and added to the playlist
+func (s *SegmentSink) completeSegment() error {
+	filename := s.getSegmentName()
+	segmentLocalPath := path.Join(s.LocalDir, filename)
+	storageName := s.getStorageName(filename, s.partsStartDate)
+	segmentStoragePath := path.Join(s.StorageDir, storageName)
+
+	// mpeg ts parts can be concatenated without remuxing
+	if err := s.joinParts(segmentLocalPath); err != nil {
+		return err
+	}
+
+	location, size, checksums, err := s.UploadWithChecksums(segmentLocalPath, segmentStoragePath, types.OutputTypeTS)
+	if err != nil {
+		s.Segments = append(s.Segments, &config.SegmentEntry{
+			Filename:     storageName,
+			UploadStatus: config.SegmentUploadFailed,
+		})
+		return err
+	}
+
+	s.IncSegmentCount()
+	s.SegmentsInfo.Size += size
+	segment := &config.SegmentEntry{
+		Filename:     storageName,
+		Duration:     s.partsDuration,
+		Size:         size,
+		StartPTS:     s.partsStartPTS,
+		StartTime:    s.partsStartDate,
+		UploadStatus: s.getUploadStatus(location),
+	}
+	if checksums != nil {
+		segment.Checksums = *checksums
+	}
+	s.Segments = append(s.Segments, segment)
+	s.logger.Debugw("segment uploaded", "path", segmentStoragePath, "size", size, "parts", len(s.parts))
+
+	uri, err := s.getPlaylistURI(storageName)
+	if err != nil {
+		return err
+	}
+	if err = s.playlist.Append(s.partsStartDate, s.partsDuration, uri); err != nil {
+		return err
+	}
+
+	s.parts = nil
+	s.partsDuration = 0
+	return nil
+}
+
+func (s *SegmentSink) getSegmentName() string {
+	switch s.SegmentSuffix {
+	case livekit.SegmentedFileSuffix_TIMESTAMP:
+		ts := s.partsStartDate
+		return fmt.Sprintf("%s_%s%03d%s", s.SegmentPrefix, ts.Format("20060102150405"), ts.UnixMilli()%1000, types.FileExtensionTS)
+	default:
+		return fmt.Sprintf("%s_%05d%s", s.SegmentPrefix, s.SegmentsInfo.SegmentCount, types.FileExtensionTS)
+	}
+}
+
+func (s *SegmentSink) joinParts(segmentLocalPath string) error {
+	f, err := os.Create(segmentLocalPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, part := range s.parts {
+		p, err := os.Open(path.Join(s.LocalDir, part))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, p)
+		_ = p.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
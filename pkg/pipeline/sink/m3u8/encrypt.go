@@ -0,0 +1,28 @@
+package m3u8
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+)
+
+// EncryptSegment encrypts a segment with AES-128-CBC and PKCS7 padding, as required by METHOD=AES-128.
+// The IV is the segment's media sequence number, which players use when the EXT-X-KEY tag has no IV.
+func EncryptSegment(segment, key []byte, sequence uint64) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	padding := aes.BlockSize - len(segment)%aes.BlockSize
+	b := make([]byte, len(segment), len(segment)+padding)
+	copy(b, segment)
+	b = append(b, bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], sequence)
+
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(b, b)
+	return b, nil
+}
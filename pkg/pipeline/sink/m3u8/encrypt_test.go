@@ -0,0 +1,36 @@
+package m3u8
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptSegment(t *testing.T) {
+	key := []byte("0123456789abcdef")
+
+	for _, size := range []int{0, 15, 16, 188 * 7} {
+		segment := bytes.Repeat([]byte{0x47}, size)
+		encrypted, err := EncryptSegment(segment, key, 3)
+		require.NoError(t, err)
+		require.Equal(t, 0, len(encrypted)%aes.BlockSize)
+		require.Greater(t, len(encrypted), size)
+
+		block, err := aes.NewCipher(key)
+		require.NoError(t, err)
+		iv := make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(iv[8:], 3)
+		decrypted := make([]byte, len(encrypted))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, encrypted)
+
+		padding := int(decrypted[len(decrypted)-1])
+		require.Equal(t, segment, decrypted[:len(decrypted)-padding])
+	}
+
+	_, err := EncryptSegment(nil, []byte("short"), 0)
+	require.Error(t, err)
+}
@@ -0,0 +1,139 @@
+package m3u8
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parts are listed for the most recent segments only, as recommended by the LL-HLS spec
+const partSegments = 3
+
+// LowLatencyPlaylistWriter writes an LL-HLS playlist, in which segments are split into independent parts.
+// Unlike the PlaylistWriter, the playlist is rewritten on each update, since parts and preload hints are removed
+// as the playlist grows.
+type LowLatencyPlaylistWriter struct {
+	filename       string
+	targetDuration int
+	partTarget     float64
+
+	segments    []*segment
+	parts       []*part // parts of the segment in progress
+	preloadHint string
+	closed      bool
+}
+
+type segment struct {
+	dateTime time.Time
+	duration float64
+	filename string
+	parts    []*part
+}
+
+type part struct {
+	duration float64
+	filename string
+}
+
+func NewLowLatencyPlaylistWriter(filename string, targetDuration int, partDuration time.Duration) (*LowLatencyPlaylistWriter, error) {
+	p := &LowLatencyPlaylistWriter{
+		filename:       filename,
+		targetDuration: targetDuration,
+		partTarget:     partDuration.Seconds(),
+	}
+
+	if err := p.write(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// AppendPart adds a part to the segment in progress, and hints the name of the next part
+func (p *LowLatencyPlaylistWriter) AppendPart(duration float64, filename, next string) error {
+	p.parts = append(p.parts, &part{
+		duration: duration,
+		filename: filename,
+	})
+	p.preloadHint = next
+
+	return p.write()
+}
+
+// Append completes the segment in progress. Its parts must have been appended first.
+func (p *LowLatencyPlaylistWriter) Append(dateTime time.Time, duration float64, filename string) error {
+	p.segments = append(p.segments, &segment{
+		dateTime: dateTime,
+		duration: duration,
+		filename: filename,
+		parts:    p.parts,
+	})
+	p.parts = nil
+
+	// older segments no longer need their parts
+	if len(p.segments) > partSegments {
+		p.segments[len(p.segments)-partSegments-1].parts = nil
+	}
+
+	return p.write()
+}
+
+func (p *LowLatencyPlaylistWriter) Close() error {
+	p.closed = true
+	p.parts = nil
+	p.preloadHint = ""
+
+	return p.write()
+}
+
+func (p *LowLatencyPlaylistWriter) write() error {
+	var sb strings.Builder
+	sb.WriteString("#EXTM3U\n")
+	sb.WriteString("#EXT-X-VERSION:6\n")
+	sb.WriteString("#EXT-X-PLAYLIST-TYPE:EVENT\n")
+	sb.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+	sb.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", p.targetDuration))
+	// players should stay at least 3 parts behind the live edge
+	sb.WriteString(fmt.Sprintf("#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=%s\n", formatDuration(3*p.partTarget)))
+	sb.WriteString(fmt.Sprintf("#EXT-X-PART-INF:PART-TARGET=%s\n", formatDuration(p.partTarget)))
+
+	for _, s := range p.segments {
+		sb.WriteString("#EXT-X-PROGRAM-DATE-TIME:")
+		sb.WriteString(s.dateTime.UTC().Format("2006-01-02T15:04:05.999Z07:00"))
+		sb.WriteString("\n")
+		writeParts(&sb, s.parts)
+		sb.WriteString("#EXTINF:")
+		sb.WriteString(formatDuration(s.duration))
+		sb.WriteString(",\n")
+		sb.WriteString(s.filename)
+		sb.WriteString("\n")
+	}
+
+	writeParts(&sb, p.parts)
+	if p.preloadHint != "" {
+		sb.WriteString(fmt.Sprintf("#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"%s\"\n", p.preloadHint))
+	}
+	if p.closed {
+		sb.WriteString("#EXT-X-ENDLIST\n")
+	}
+
+	// write to a temporary file first, so the playlist is never read half written
+	tmp := p.filename + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sb.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.filename)
+}
+
+func writeParts(sb *strings.Builder, parts []*part) {
+	for _, pt := range parts {
+		// every part starts with a key frame
+		sb.WriteString(fmt.Sprintf("#EXT-X-PART:DURATION=%s,URI=\"%s\",INDEPENDENT=YES\n", formatDuration(pt.duration), pt.filename))
+	}
+}
+
+func formatDuration(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 32)
+}
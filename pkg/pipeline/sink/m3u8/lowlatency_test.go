@@ -0,0 +1,45 @@
+package m3u8
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLowLatencyPlaylistWriter(t *testing.T) {
+	playlistName := "playlist_ll.m3u8"
+
+	w, err := NewLowLatencyPlaylistWriter(playlistName, 2, time.Second)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { os.Remove(playlistName) })
+
+	now := time.Unix(0, 1683154504814142000)
+
+	require.NoError(t, w.AppendPart(1, "playlist_part00000.ts", "playlist_part00001.ts"))
+	b, err := os.ReadFile(playlistName)
+	require.NoError(t, err)
+
+	header := "#EXTM3U\n#EXT-X-VERSION:6\n#EXT-X-PLAYLIST-TYPE:EVENT\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-TARGETDURATION:2\n#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=3.000\n#EXT-X-PART-INF:PART-TARGET=1.000\n"
+	expected := header +
+		"#EXT-X-PART:DURATION=1.000,URI=\"playlist_part00000.ts\",INDEPENDENT=YES\n" +
+		"#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"playlist_part00001.ts\"\n"
+	require.Equal(t, expected, string(b))
+
+	require.NoError(t, w.AppendPart(1, "playlist_part00001.ts", "playlist_part00002.ts"))
+	require.NoError(t, w.Append(now, 2, "playlist_00000.ts"))
+	require.NoError(t, w.Close())
+
+	b, err = os.ReadFile(playlistName)
+	require.NoError(t, err)
+
+	expected = header +
+		"#EXT-X-PROGRAM-DATE-TIME:2023-05-03T22:55:04.814Z\n" +
+		"#EXT-X-PART:DURATION=1.000,URI=\"playlist_part00000.ts\",INDEPENDENT=YES\n" +
+		"#EXT-X-PART:DURATION=1.000,URI=\"playlist_part00001.ts\",INDEPENDENT=YES\n" +
+		"#EXTINF:2.000,\nplaylist_00000.ts\n" +
+		"#EXT-X-ENDLIST\n"
+	require.Equal(t, expected, string(b))
+}
@@ -0,0 +1,61 @@
+package m3u8
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const audioGroupID = "audio"
+
+// Variant is a single rendition listed in a master playlist
+type Variant struct {
+	URI       string
+	Bandwidth int // peak bits per second
+	Width     int32
+	Height    int32
+}
+
+// AudioRendition is an alternate audio track, listed as EXT-X-MEDIA in a master playlist
+type AudioRendition struct {
+	URI      string // empty for the audio muxed into the variants
+	Language string
+	Name     string
+	Default  bool
+}
+
+// WriteMasterPlaylist writes a multivariant playlist, with variants in the given order.
+// If there are audio renditions, every variant belongs to their group
+func WriteMasterPlaylist(filename string, variants []Variant, audio []AudioRendition) error {
+	var sb strings.Builder
+	sb.WriteString("#EXTM3U\n")
+	sb.WriteString("#EXT-X-VERSION:3\n")
+	sb.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, a := range audio {
+		isDefault := "NO"
+		if a.Default {
+			isDefault = "YES"
+		}
+		sb.WriteString(fmt.Sprintf("#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"%s\",LANGUAGE=\"%s\",NAME=\"%s\",DEFAULT=%s,AUTOSELECT=YES",
+			audioGroupID, a.Language, a.Name, isDefault,
+		))
+		if a.URI != "" {
+			sb.WriteString(fmt.Sprintf(",URI=\"%s\"", a.URI))
+		}
+		sb.WriteString("\n")
+	}
+	for _, v := range variants {
+		sb.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d", v.Bandwidth))
+		if v.Width > 0 && v.Height > 0 {
+			sb.WriteString(fmt.Sprintf(",RESOLUTION=%dx%d", v.Width, v.Height))
+		}
+		if len(audio) > 0 {
+			sb.WriteString(fmt.Sprintf(",AUDIO=\"%s\"", audioGroupID))
+		}
+		sb.WriteString("\n")
+		sb.WriteString(v.URI)
+		sb.WriteString("\n")
+	}
+
+	return os.WriteFile(filename, []byte(sb.String()), 0644)
+}
@@ -15,6 +15,15 @@ type PlaylistWriter struct {
 }
 
 func NewPlaylistWriter(filename string, targetDuration int) (*PlaylistWriter, error) {
+	return newPlaylistWriter(filename, targetDuration, 4, "")
+}
+
+// NewFMP4PlaylistWriter writes a playlist of fragmented mp4 segments, which share an init segment
+func NewFMP4PlaylistWriter(filename string, targetDuration int, initSegment string) (*PlaylistWriter, error) {
+	return newPlaylistWriter(filename, targetDuration, 7, initSegment)
+}
+
+func newPlaylistWriter(filename string, targetDuration, version int, initSegment string) (*PlaylistWriter, error) {
 	p := &PlaylistWriter{
 		filename:       filename,
 		targetDuration: targetDuration,
@@ -28,11 +37,14 @@ func NewPlaylistWriter(filename string, targetDuration int) (*PlaylistWriter, er
 
 	var sb strings.Builder
 	sb.WriteString("#EXTM3U\n")
-	sb.WriteString("#EXT-X-VERSION:4\n")
+	sb.WriteString(fmt.Sprintf("#EXT-X-VERSION:%d\n", version))
 	sb.WriteString("#EXT-X-PLAYLIST-TYPE:EVENT\n")
 	sb.WriteString("#EXT-X-ALLOW-CACHE:NO\n")
 	sb.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
 	sb.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", p.targetDuration))
+	if initSegment != "" {
+		sb.WriteString(fmt.Sprintf("#EXT-X-MAP:URI=\"%s\"\n", initSegment))
+	}
 
 	_, err = f.WriteString(sb.String())
 	if err != nil {
@@ -62,6 +74,50 @@ func (p *PlaylistWriter) Append(dateTime time.Time, duration float64, filename s
 	return err
 }
 
+// Key is an EXT-X-KEY tag. The IV is left out, so players use each segment's media sequence number.
+type Key struct {
+	Method            string // default AES-128
+	URI               string
+	KeyFormat         string // DRM system, e.g. com.apple.streamingkeydelivery for FairPlay
+	KeyFormatVersions string
+}
+
+func (k Key) String() string {
+	method := k.Method
+	if method == "" {
+		method = "AES-128"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("#EXT-X-KEY:METHOD=%s,URI=\"%s\"", method, k.URI))
+	if k.KeyFormat != "" {
+		sb.WriteString(fmt.Sprintf(",KEYFORMAT=\"%s\"", k.KeyFormat))
+	}
+	if k.KeyFormatVersions != "" {
+		sb.WriteString(fmt.Sprintf(",KEYFORMATVERSIONS=\"%s\"", k.KeyFormatVersions))
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// SetKey adds EXT-X-KEY tags, which apply to every following segment.
+// Keys with different formats can be listed together, for players which support different DRM systems.
+func (p *PlaylistWriter) SetKey(keys ...Key) error {
+	f, err := os.OpenFile(p.filename, os.O_WRONLY|os.O_APPEND, fs.ModeAppend)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var sb strings.Builder
+	for _, key := range keys {
+		sb.WriteString(key.String())
+	}
+
+	_, err = f.WriteString(sb.String())
+	return err
+}
+
 // Close sliding playlist and make them fixed.
 func (p *PlaylistWriter) Close() error {
 	f, err := os.OpenFile(p.filename, os.O_WRONLY|os.O_APPEND, fs.ModeAppend)
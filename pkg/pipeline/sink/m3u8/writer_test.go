@@ -3,6 +3,7 @@ package m3u8
 import (
 	"fmt"
 	"os"
+	"path"
 	"testing"
 	"time"
 
@@ -33,3 +34,77 @@ func TestPlaylistWriter(t *testing.T) {
 	expected := "#EXTM3U\n#EXT-X-VERSION:4\n#EXT-X-PLAYLIST-TYPE:EVENT\n#EXT-X-ALLOW-CACHE:NO\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-TARGETDURATION:6\n#EXT-X-PROGRAM-DATE-TIME:2023-05-03T22:55:04.814Z\n#EXTINF:5.994,\nplaylist_00000.ts\n#EXT-X-PROGRAM-DATE-TIME:2023-05-03T22:55:10.808Z\n#EXTINF:5.994,\nplaylist_00001.ts\n#EXT-X-PROGRAM-DATE-TIME:2023-05-03T22:55:16.802Z\n#EXTINF:5.994,\nplaylist_00002.ts\n#EXT-X-ENDLIST\n"
 	require.Equal(t, expected, string(b))
 }
+
+func TestFMP4PlaylistWriter(t *testing.T) {
+	playlistName := path.Join(t.TempDir(), "playlist.m3u8")
+
+	w, err := NewFMP4PlaylistWriter(playlistName, 4, "playlist_init.mp4")
+	require.NoError(t, err)
+
+	require.NoError(t, w.Append(time.Unix(0, 1683154504814142000), 4, "playlist_00000.m4s"))
+	require.NoError(t, w.Close())
+
+	b, err := os.ReadFile(playlistName)
+	require.NoError(t, err)
+
+	expected := "#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-PLAYLIST-TYPE:EVENT\n#EXT-X-ALLOW-CACHE:NO\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-TARGETDURATION:4\n#EXT-X-MAP:URI=\"playlist_init.mp4\"\n#EXT-X-PROGRAM-DATE-TIME:2023-05-03T22:55:04.814Z\n#EXTINF:4.000,\nplaylist_00000.m4s\n#EXT-X-ENDLIST\n"
+	require.Equal(t, expected, string(b))
+}
+
+func TestEncryptedPlaylistWriter(t *testing.T) {
+	playlistName := path.Join(t.TempDir(), "playlist.m3u8")
+
+	w, err := NewPlaylistWriter(playlistName, 4)
+	require.NoError(t, err)
+
+	now := time.Unix(0, 1683154504814142000)
+	require.NoError(t, w.SetKey(Key{URI: "playlist_key00000.key"}))
+	require.NoError(t, w.Append(now, 4, "playlist_00000.ts"))
+	require.NoError(t, w.SetKey(
+		Key{URI: "https://keys.example.com/1"},
+		Key{Method: "SAMPLE-AES", URI: "skd://1", KeyFormat: "com.apple.streamingkeydelivery", KeyFormatVersions: "1"},
+	))
+	require.NoError(t, w.Append(now.Add(time.Second*4), 4, "playlist_00001.ts"))
+	require.NoError(t, w.Close())
+
+	b, err := os.ReadFile(playlistName)
+	require.NoError(t, err)
+
+	expected := "#EXTM3U\n#EXT-X-VERSION:4\n#EXT-X-PLAYLIST-TYPE:EVENT\n#EXT-X-ALLOW-CACHE:NO\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-TARGETDURATION:4\n#EXT-X-KEY:METHOD=AES-128,URI=\"playlist_key00000.key\"\n#EXT-X-PROGRAM-DATE-TIME:2023-05-03T22:55:04.814Z\n#EXTINF:4.000,\nplaylist_00000.ts\n#EXT-X-KEY:METHOD=AES-128,URI=\"https://keys.example.com/1\"\n#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"skd://1\",KEYFORMAT=\"com.apple.streamingkeydelivery\",KEYFORMATVERSIONS=\"1\"\n#EXT-X-PROGRAM-DATE-TIME:2023-05-03T22:55:08.814Z\n#EXTINF:4.000,\nplaylist_00001.ts\n#EXT-X-ENDLIST\n"
+	require.Equal(t, expected, string(b))
+}
+
+func TestMasterPlaylist(t *testing.T) {
+	playlistName := path.Join(t.TempDir(), "playlist_master.m3u8")
+
+	require.NoError(t, WriteMasterPlaylist(playlistName, []Variant{
+		{URI: "playlist.m3u8", Bandwidth: 4628000, Width: 1920, Height: 1080},
+		{URI: "playlist_360p.m3u8", Bandwidth: 628000, Width: 640, Height: 360},
+	}, nil))
+
+	b, err := os.ReadFile(playlistName)
+	require.NoError(t, err)
+
+	expected := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n#EXT-X-STREAM-INF:BANDWIDTH=4628000,RESOLUTION=1920x1080\nplaylist.m3u8\n#EXT-X-STREAM-INF:BANDWIDTH=628000,RESOLUTION=640x360\nplaylist_360p.m3u8\n"
+	require.Equal(t, expected, string(b))
+}
+
+func TestMasterPlaylistAlternateAudio(t *testing.T) {
+	playlistName := path.Join(t.TempDir(), "playlist_master.m3u8")
+
+	require.NoError(t, WriteMasterPlaylist(playlistName, []Variant{
+		{URI: "playlist.m3u8", Bandwidth: 128000},
+	}, []AudioRendition{
+		{Language: "en", Name: "Main", Default: true},
+		{URI: "playlist_es.m3u8", Language: "es", Name: "Español"},
+	}))
+
+	b, err := os.ReadFile(playlistName)
+	require.NoError(t, err)
+
+	expected := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n" +
+		"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"audio\",LANGUAGE=\"en\",NAME=\"Main\",DEFAULT=YES,AUTOSELECT=YES\n" +
+		"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"audio\",LANGUAGE=\"es\",NAME=\"Español\",DEFAULT=NO,AUTOSELECT=YES,URI=\"playlist_es.m3u8\"\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=128000,AUDIO=\"audio\"\nplaylist.m3u8\n"
+	require.Equal(t, expected, string(b))
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/livekit/egress/pkg/types"
 )
 
+// Manifest is written with manifest_format v1. It is also parsed by pkg/results, which mirrors its json format without depending on gstreamer
 type Manifest struct {
 	EgressID          string `json:"egress_id,omitempty"`
 	RoomID            string `json:"room_id,omitempty"`
@@ -23,15 +24,48 @@ type Manifest struct {
 	AudioTrackID      string `json:"audio_track_id,omitempty"`
 	VideoTrackID      string `json:"video_track_id,omitempty"`
 	SegmentCount      int64  `json:"segment_count,omitempty"`
+	AudioCodec        string `json:"audio_codec,omitempty"`
+	AudioCodecReason  string `json:"audio_codec_reason,omitempty"`
+	VideoCodec        string `json:"video_codec,omitempty"`
+	VideoCodecReason  string `json:"video_codec_reason,omitempty"`
+	LimitReached      string `json:"limit_reached,omitempty"`
+	EndTrigger        string `json:"end_trigger,omitempty"`
+	EndedBy           string `json:"ended_by,omitempty"`
+	FailureCause      string `json:"failure_cause,omitempty"`
+	VideoLostAt       int64  `json:"video_lost_at,omitempty"`
+	SyncGroupID       string `json:"sync_group_id,omitempty"`
+	SyncEpoch         int64  `json:"sync_epoch,omitempty"`
+	StartOffset       int64  `json:"start_offset,omitempty"`
+
+	Checksums *config.Checksums         `json:"checksums,omitempty"` // of the file output
+	Preview   *Artifact                 `json:"preview,omitempty"`
+	Artifacts []*Artifact               `json:"artifacts,omitempty"`
+	Streams   []*config.StreamStats     `json:"streams,omitempty"`
+	Segments  []*config.SegmentEntry    `json:"segments,omitempty"`
+	Replicas  []*uploader.ReplicaStatus `json:"replicas,omitempty"` // uploads of the output's files to each replica, before the manifest
+}
+
+// Artifact is an additional file produced by post-processing
+type Artifact struct {
+	Step     string `json:"step"`
+	Filename string `json:"filename"`
+	Location string `json:"location"`
+	Size     int64  `json:"size"`
 }
 
-func uploadManifest(p *config.PipelineConfig, u *uploader.Uploader, localFilepath, storageFilepath string) error {
+func uploadManifest(
+	p *config.PipelineConfig,
+	u *uploader.Uploader,
+	localFilepath, storageFilepath string,
+	artifacts []*Artifact,
+	checksums *config.Checksums,
+) error {
 	manifest, err := os.Create(localFilepath)
 	if err != nil {
 		return err
 	}
 
-	b, err := getManifest(p)
+	b, err := getManifest(p, artifacts, checksums, u.ReplicaStatus())
 	if err != nil {
 		return err
 	}
@@ -45,7 +79,11 @@ func uploadManifest(p *config.PipelineConfig, u *uploader.Uploader, localFilepat
 	return err
 }
 
-func getManifest(p *config.PipelineConfig) ([]byte, error) {
+func getManifest(p *config.PipelineConfig, artifacts []*Artifact, checksums *config.Checksums, replicas []*uploader.ReplicaStatus) ([]byte, error) {
+	if p.ManifestFormat == config.ManifestFormatV2 {
+		return getManifestV2(p, artifacts, replicas)
+	}
+
 	manifest := Manifest{
 		EgressID:          p.Info.EgressId,
 		RoomID:            p.Info.RoomId,
@@ -59,11 +97,45 @@ func getManifest(p *config.PipelineConfig) ([]byte, error) {
 		TrackSource:       p.TrackSource,
 		AudioTrackID:      p.AudioTrackID,
 		VideoTrackID:      p.VideoTrackID,
+		AudioCodec:        string(p.AudioOutCodec),
+		AudioCodecReason:  p.AudioCodecReason,
+		VideoCodec:        string(p.VideoOutCodec),
+		VideoCodecReason:  p.VideoCodecReason,
+		LimitReached:      string(p.LimitReached),
+		EndTrigger:        p.EndTrigger,
+		EndedBy:           p.EndedBy,
+		FailureCause:      string(p.FailureCause),
+		VideoLostAt:       p.VideoLostAt,
+		Checksums:         checksums,
+		Preview:           getPreviewArtifact(p),
+		Artifacts:         artifacts,
+		Replicas:          replicas,
 	}
 
+	if p.SyncGroup != nil {
+		manifest.SyncGroupID = p.SyncGroup.ID
+		manifest.SyncEpoch = p.SyncGroup.Epoch
+		manifest.StartOffset = p.StartOffset
+	}
 	if o := p.GetSegmentConfig(); o != nil {
 		manifest.SegmentCount = o.SegmentsInfo.SegmentCount
+		manifest.Segments = o.Segments
+	}
+	if o := p.GetStreamConfig(); o != nil {
+		manifest.Streams = o.Stats
 	}
 
 	return json.Marshal(manifest)
 }
+
+func getPreviewArtifact(p *config.PipelineConfig) *Artifact {
+	if p.PreviewFile == nil {
+		return nil
+	}
+	return &Artifact{
+		Step:     "preview",
+		Filename: p.PreviewFile.Filename,
+		Location: p.PreviewFile.Location,
+		Size:     p.PreviewFile.Size,
+	}
+}
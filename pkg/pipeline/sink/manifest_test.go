@@ -0,0 +1,44 @@
+package sink
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/protocol/livekit"
+)
+
+func TestRedactedRequest(t *testing.T) {
+	info := &livekit.EgressInfo{
+		Request: &livekit.EgressInfo_RoomComposite{
+			RoomComposite: &livekit.RoomCompositeEgressRequest{
+				RoomName: "room",
+				Layout:   "grid",
+				FileOutputs: []*livekit.EncodedFileOutput{{
+					Filepath: "recordings/room.mp4",
+					Output: &livekit.EncodedFileOutput_S3{S3: &livekit.S3Upload{
+						AccessKey: "key",
+						Secret:    "secret",
+						Bucket:    "bucket",
+					}},
+				}},
+				StreamOutputs: []*livekit.StreamOutput{{
+					Urls: []string{"rtmp://live.example.com/app/stream_key"},
+				}},
+			},
+		},
+	}
+
+	b, err := getRedactedRequest(info)
+	require.NoError(t, err)
+	require.NotContains(t, string(b), "secret")
+	require.NotContains(t, string(b), "stream_key")
+
+	var req map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &req))
+	require.Equal(t, "grid", req["layout"])
+	s3 := req["file_outputs"].([]interface{})[0].(map[string]interface{})["s3"].(map[string]interface{})
+	require.Equal(t, "bucket", s3["bucket"])
+	require.NotContains(t, s3, "access_key")
+}
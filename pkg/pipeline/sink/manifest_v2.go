@@ -0,0 +1,263 @@
+package sink
+
+import (
+	"encoding/json"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+)
+
+const manifestVersion2 = 2
+
+// request fields which are left out of the manifest, as they hold storage credentials or stream keys
+var redactedRequestFields = map[string]bool{
+	"access_key":    true,
+	"secret":        true,
+	"session_token": true,
+	"credentials":   true,
+	"account_key":   true,
+	"urls":          true,
+	"websocket_url": true,
+}
+
+// ManifestV2 is written with manifest_format v2, and parsed by pkg/results. Fields are only added, never changed or removed
+type ManifestV2 struct {
+	Version     int             `json:"version"`
+	EgressID    string          `json:"egress_id"`
+	RoomID      string          `json:"room_id,omitempty"`
+	RoomName    string          `json:"room_name,omitempty"`
+	RequestType string          `json:"request_type"`
+	Request     json.RawMessage `json:"request,omitempty"`
+
+	Timings ManifestTimings `json:"timings"`
+	End     ManifestEnd     `json:"end"`
+	Source  ManifestSource  `json:"source"`
+	Video   *ManifestVideo  `json:"video,omitempty"`
+	Audio   *ManifestAudio  `json:"audio,omitempty"`
+	Sync    *ManifestSync   `json:"sync,omitempty"`
+
+	Outputs   []*ManifestOutput         `json:"outputs"`
+	Preview   *Artifact                 `json:"preview,omitempty"`
+	Artifacts []*Artifact               `json:"artifacts,omitempty"`
+	Replicas  []*uploader.ReplicaStatus `json:"replicas,omitempty"`
+}
+
+type ManifestTimings struct {
+	StartedAt   int64 `json:"started_at"`
+	EndedAt     int64 `json:"ended_at,omitempty"`
+	Duration    int64 `json:"duration,omitempty"`
+	VideoLostAt int64 `json:"video_lost_at,omitempty"`
+}
+
+type ManifestEnd struct {
+	Trigger      string `json:"trigger,omitempty"`
+	EndedBy      string `json:"ended_by,omitempty"`
+	LimitReached string `json:"limit_reached,omitempty"`
+	FailureCause string `json:"failure_cause,omitempty"`
+}
+
+type ManifestSource struct {
+	Url               string `json:"url,omitempty"`
+	PublisherIdentity string `json:"publisher_identity,omitempty"`
+	TrackID           string `json:"track_id,omitempty"`
+	TrackKind         string `json:"track_kind,omitempty"`
+	TrackSource       string `json:"track_source,omitempty"`
+	AudioTrackID      string `json:"audio_track_id,omitempty"`
+	VideoTrackID      string `json:"video_track_id,omitempty"`
+}
+
+type ManifestVideo struct {
+	Codec            string  `json:"codec"`
+	CodecReason      string  `json:"codec_reason,omitempty"`
+	Width            int32   `json:"width,omitempty"`
+	Height           int32   `json:"height,omitempty"`
+	Framerate        int32   `json:"framerate,omitempty"`
+	Bitrate          int32   `json:"bitrate,omitempty"`
+	KeyFrameInterval float64 `json:"key_frame_interval,omitempty"`
+}
+
+type ManifestAudio struct {
+	Codec       string `json:"codec"`
+	CodecReason string `json:"codec_reason,omitempty"`
+	Bitrate     int32  `json:"bitrate,omitempty"`
+	Frequency   int32  `json:"frequency,omitempty"`
+}
+
+type ManifestSync struct {
+	GroupID     string `json:"group_id"`
+	Epoch       int64  `json:"epoch"`
+	StartOffset int64  `json:"start_offset"`
+}
+
+type ManifestOutput struct {
+	Type       string            `json:"type"`
+	OutputType string            `json:"output_type,omitempty"`
+	Filename   string            `json:"filename,omitempty"`
+	Location   string            `json:"location,omitempty"`
+	Size       int64             `json:"size,omitempty"`
+	Checksums  *config.Checksums `json:"checksums,omitempty"`
+
+	SegmentCount int64                  `json:"segment_count,omitempty"`
+	Segments     []*config.SegmentEntry `json:"segments,omitempty"`
+	Streams      []*config.StreamStats  `json:"streams,omitempty"`
+}
+
+func getManifestV2(p *config.PipelineConfig, artifacts []*Artifact, replicas []*uploader.ReplicaStatus) ([]byte, error) {
+	request, err := getRedactedRequest(p.Info)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &ManifestV2{
+		Version:     manifestVersion2,
+		EgressID:    p.Info.EgressId,
+		RoomID:      p.Info.RoomId,
+		RoomName:    p.Info.RoomName,
+		RequestType: p.RequestType,
+		Request:     request,
+		Timings: ManifestTimings{
+			StartedAt:   p.Info.StartedAt,
+			EndedAt:     p.Info.EndedAt,
+			VideoLostAt: p.VideoLostAt,
+		},
+		End: ManifestEnd{
+			Trigger:      p.EndTrigger,
+			EndedBy:      p.EndedBy,
+			LimitReached: string(p.LimitReached),
+			FailureCause: string(p.FailureCause),
+		},
+		Source: ManifestSource{
+			Url:               p.WebUrl,
+			PublisherIdentity: p.ParticipantIdentity,
+			TrackID:           p.TrackID,
+			TrackKind:         p.TrackKind,
+			TrackSource:       p.TrackSource,
+			AudioTrackID:      p.AudioTrackID,
+			VideoTrackID:      p.VideoTrackID,
+		},
+		Outputs:   getManifestOutputs(p),
+		Preview:   getPreviewArtifact(p),
+		Artifacts: artifacts,
+		Replicas:  replicas,
+	}
+
+	if p.Info.StartedAt != 0 && p.Info.EndedAt > p.Info.StartedAt {
+		manifest.Timings.Duration = p.Info.EndedAt - p.Info.StartedAt
+	}
+	if p.VideoEnabled {
+		manifest.Video = &ManifestVideo{
+			Codec:            string(p.VideoOutCodec),
+			CodecReason:      p.VideoCodecReason,
+			Width:            p.Width,
+			Height:           p.Height,
+			Framerate:        p.Framerate,
+			Bitrate:          p.VideoBitrate,
+			KeyFrameInterval: p.KeyFrameInterval,
+		}
+	}
+	if p.AudioEnabled {
+		manifest.Audio = &ManifestAudio{
+			Codec:       string(p.AudioOutCodec),
+			CodecReason: p.AudioCodecReason,
+			Bitrate:     p.AudioBitrate,
+			Frequency:   p.AudioFrequency,
+		}
+	}
+	if p.SyncGroup != nil {
+		manifest.Sync = &ManifestSync{
+			GroupID:     p.SyncGroup.ID,
+			Epoch:       p.SyncGroup.Epoch,
+			StartOffset: p.StartOffset,
+		}
+	}
+
+	return json.Marshal(manifest)
+}
+
+// getManifestOutputs lists every output, as of when the manifest is written
+func getManifestOutputs(p *config.PipelineConfig) []*ManifestOutput {
+	outputs := make([]*ManifestOutput, 0, len(p.Outputs))
+	for egressType, o := range p.Outputs {
+		output := &ManifestOutput{
+			Type:       string(egressType),
+			OutputType: string(o.GetOutputType()),
+		}
+
+		switch c := o.(type) {
+		case *config.FileConfig:
+			output.Filename = c.StorageFilepath
+			output.Location = c.FileInfo.Location
+			output.Size = c.FileInfo.Size
+			output.Checksums = c.Checksums
+		case *config.SegmentConfig:
+			output.Filename = c.SegmentsInfo.PlaylistName
+			output.Location = c.SegmentsInfo.PlaylistLocation
+			output.Size = c.SegmentsInfo.Size
+			output.SegmentCount = c.GetSegmentCount()
+			output.Segments = c.Segments
+		case *config.StreamConfig:
+			if egressType == types.EgressTypeStream {
+				output.Streams = c.Stats
+			}
+		}
+
+		outputs = append(outputs, output)
+	}
+
+	sort.Slice(outputs, func(i, j int) bool {
+		return outputs[i].Type < outputs[j].Type
+	})
+	return outputs
+}
+
+// getRedactedRequest returns the request of the egress as json, without credentials or stream urls
+func getRedactedRequest(info *livekit.EgressInfo) (json.RawMessage, error) {
+	var req proto.Message
+	switch r := info.Request.(type) {
+	case *livekit.EgressInfo_RoomComposite:
+		req = r.RoomComposite
+	case *livekit.EgressInfo_Web:
+		req = r.Web
+	case *livekit.EgressInfo_TrackComposite:
+		req = r.TrackComposite
+	case *livekit.EgressInfo_Track:
+		req = r.Track
+	default:
+		return nil, nil
+	}
+
+	b, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	redact(fields)
+
+	return json.Marshal(fields)
+}
+
+func redact(v interface{}) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, field := range value {
+			if redactedRequestFields[k] {
+				delete(value, k)
+			} else {
+				redact(field)
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			redact(item)
+		}
+	}
+}
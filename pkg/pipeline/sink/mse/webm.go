@@ -0,0 +1,95 @@
+package mse
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// EBML element IDs, including their length markers
+const (
+	idEBML    = 0x1A45DFA3
+	idSegment = 0x18538067
+	idCluster = 0x1F43B675
+)
+
+var (
+	errInvalidWebM = errors.New("invalid webm")
+	errNoCluster   = errors.New("webm has no clusters")
+)
+
+// SplitInitSegment splits a streamable webm file into its init segment (EBML header, segment header,
+// info, and tracks), and its media (the clusters). The segment must have an unknown size.
+func SplitInitSegment(b []byte) (initSegment []byte, media []byte, err error) {
+	// EBML header
+	id, n, err := readVint(b, true)
+	if err != nil || id != idEBML {
+		return nil, nil, errInvalidWebM
+	}
+	size, m, err := readVint(b[n:], false)
+	if err != nil {
+		return nil, nil, err
+	}
+	pos := n + m + int(size)
+	if pos > len(b) {
+		return nil, nil, errInvalidWebM
+	}
+
+	// segment, which contains the remaining elements
+	id, n, err = readVint(b[pos:], true)
+	if err != nil || id != idSegment {
+		return nil, nil, errInvalidWebM
+	}
+	_, m, err = readVint(b[pos+n:], false)
+	if err != nil {
+		return nil, nil, err
+	}
+	pos += n + m
+
+	for pos < len(b) {
+		id, n, err = readVint(b[pos:], true)
+		if err != nil {
+			return nil, nil, err
+		}
+		if id == idCluster {
+			return b[:pos], b[pos:], nil
+		}
+
+		size, m, err = readVint(b[pos+n:], false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if isUnknownSize(size, m) {
+			return nil, nil, errInvalidWebM
+		}
+		pos += n + m + int(size)
+	}
+
+	return nil, nil, errNoCluster
+}
+
+// readVint reads an EBML variable length integer, returning its value and length.
+// Element IDs keep their length marker.
+func readVint(b []byte, keepMarker bool) (uint64, int, error) {
+	if len(b) == 0 {
+		return 0, 0, errInvalidWebM
+	}
+
+	n := bits.LeadingZeros8(b[0]) + 1
+	if n > 8 || len(b) < n {
+		return 0, 0, errInvalidWebM
+	}
+
+	value := uint64(b[0])
+	if !keepMarker {
+		value &= uint64(0xFF >> n)
+	}
+	for i := 1; i < n; i++ {
+		value = value<<8 | uint64(b[i])
+	}
+
+	return value, n, nil
+}
+
+func isUnknownSize(size uint64, n int) bool {
+	return size == 1<<(7*n)-1
+}
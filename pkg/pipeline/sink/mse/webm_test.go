@@ -0,0 +1,47 @@
+package mse
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitInitSegment(t *testing.T) {
+	header := []byte{
+		0x1A, 0x45, 0xDF, 0xA3, 0x84, 'w', 'e', 'b', 'm', // EBML header, size 4
+		0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, // segment, unknown size
+		0x15, 0x49, 0xA9, 0x66, 0x82, 0x00, 0x00, // info, size 2
+		0x16, 0x54, 0xAE, 0x6B, 0x83, 0x00, 0x00, 0x00, // tracks, size 3
+	}
+	clusters := []byte{
+		0x1F, 0x43, 0xB6, 0x75, 0xFF, 0x01, 0x02, // cluster, unknown size
+	}
+
+	initSegment, media, err := SplitInitSegment(append(append([]byte{}, header...), clusters...))
+	require.NoError(t, err)
+	require.Equal(t, header, initSegment)
+	require.Equal(t, clusters, media)
+
+	_, _, err = SplitInitSegment(header)
+	require.ErrorIs(t, err, errNoCluster)
+
+	_, _, err = SplitInitSegment(clusters)
+	require.ErrorIs(t, err, errInvalidWebM)
+}
+
+func TestIndexWriter(t *testing.T) {
+	filename := path.Join(t.TempDir(), "live.json")
+	w, err := NewIndexWriter(filename, "live_init.webm", `video/webm; codecs="vp8, opus"`, 4)
+	require.NoError(t, err)
+
+	require.NoError(t, w.Append(time.UnixMilli(1000), 4.0, "live_00000.webm"))
+	require.NoError(t, w.Close())
+
+	b, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Contains(t, string(b), `"segments":[{"filename":"live_00000.webm","start_date":1000,"duration":4}]`)
+	require.Contains(t, string(b), `"ended":true`)
+}
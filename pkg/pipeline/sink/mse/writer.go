@@ -0,0 +1,73 @@
+package mse
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// IndexWriter writes a json index of webm segments, which players poll to find new segments.
+// Segments should be appended to a SourceBuffer in "sequence" mode, after the init segment.
+type IndexWriter struct {
+	filename string
+	index    Index
+}
+
+type Index struct {
+	InitSegment    string    `json:"init_segment"`
+	TargetDuration int       `json:"target_duration"`
+	Segments       []Segment `json:"segments"`
+	Ended          bool      `json:"ended"`
+	CodecMimeType  string    `json:"codec_mime_type,omitempty"` // for MediaSource.isTypeSupported and addSourceBuffer
+	UpdatedAt      int64     `json:"updated_at"`                // unix millis
+}
+
+type Segment struct {
+	Filename  string  `json:"filename"`
+	StartDate int64   `json:"start_date"` // unix millis
+	Duration  float64 `json:"duration"`   // seconds
+}
+
+func NewIndexWriter(filename, initSegment, codecMimeType string, targetDuration int) (*IndexWriter, error) {
+	w := &IndexWriter{
+		filename: filename,
+		index: Index{
+			InitSegment:    initSegment,
+			TargetDuration: targetDuration,
+			Segments:       make([]Segment, 0),
+			CodecMimeType:  codecMimeType,
+		},
+	}
+
+	return w, w.write()
+}
+
+func (w *IndexWriter) Append(dateTime time.Time, duration float64, filename string) error {
+	w.index.Segments = append(w.index.Segments, Segment{
+		Filename:  filename,
+		StartDate: dateTime.UnixMilli(),
+		Duration:  duration,
+	})
+	return w.write()
+}
+
+// Close marks the index as ended, so players stop polling
+func (w *IndexWriter) Close() error {
+	w.index.Ended = true
+	return w.write()
+}
+
+func (w *IndexWriter) write() error {
+	w.index.UpdatedAt = time.Now().UnixMilli()
+	b, err := json.Marshal(w.index)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so the index is never partially written
+	tmp := w.filename + ".tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.filename)
+}
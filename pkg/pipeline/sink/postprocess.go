@@ -0,0 +1,102 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+)
+
+// postProcess runs each configured step on the local file. A failed step is skipped, so the unprocessed file is still uploaded.
+func (s *FileSink) postProcess() {
+	for i := range s.conf.PostProcessing {
+		step := &s.conf.PostProcessing[i]
+		if err := s.runStep(step); err != nil {
+			s.logger.Errorw("post processing failed", err, "step", step.Name)
+			continue
+		}
+		s.logger.Infow("post processing complete", "step", step.Name)
+	}
+}
+
+func (s *FileSink) runStep(step *config.PostProcessConfig) error {
+	dir, filename := path.Split(s.LocalFilepath)
+	ext := path.Ext(filename)
+
+	output := path.Join(dir, fmt.Sprintf("%s_%s%s", strings.TrimSuffix(filename, ext), step.Name, ext))
+	artifacts := path.Join(dir, fmt.Sprintf("%s_artifacts", step.Name))
+	if err := os.MkdirAll(artifacts, 0755); err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(output)
+		_ = os.RemoveAll(artifacts)
+	}()
+
+	replacer := strings.NewReplacer("{input}", s.LocalFilepath, "{output}", output, "{artifacts}", artifacts)
+	args := make([]string, len(step.Command))
+	for i, arg := range step.Command {
+		args[i] = replacer.Replace(arg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), step.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	// a written output replaces the file for later steps and upload
+	if stat, err := os.Stat(output); err == nil && stat.Size() > 0 {
+		if err = os.Rename(output, s.LocalFilepath); err != nil {
+			return err
+		}
+	}
+
+	return s.uploadArtifacts(step, artifacts)
+}
+
+// uploadArtifacts uploads files written to the artifacts directory next to the output, prefixed by its name
+func (s *FileSink) uploadArtifacts(step *config.PostProcessConfig, artifacts string) error {
+	entries, err := os.ReadDir(artifacts)
+	if err != nil {
+		return err
+	}
+
+	storagePrefix := strings.TrimSuffix(s.StorageFilepath, path.Ext(s.StorageFilepath))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		outputType := types.OutputType(mime.TypeByExtension(path.Ext(name)))
+		if outputType == "" {
+			outputType = types.OutputTypeBinary
+		}
+
+		location, size, err := s.Upload(path.Join(artifacts, name), fmt.Sprintf("%s_%s", storagePrefix, name), outputType)
+		if err != nil {
+			return err
+		}
+
+		s.artifacts = append(s.artifacts, &Artifact{
+			Step:     step.Name,
+			Filename: name,
+			Location: location,
+			Size:     size,
+		})
+	}
+
+	return nil
+}
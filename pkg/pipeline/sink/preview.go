@@ -0,0 +1,46 @@
+package sink
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+)
+
+const previewSuffix = "_preview.jpg"
+
+// PreviewUploader is implemented by sinks which can store a preview image next to their output
+type PreviewUploader interface {
+	UploadPreview(image []byte) (*livekit.FileInfo, error)
+}
+
+func (s *FileSink) UploadPreview(image []byte) (*livekit.FileInfo, error) {
+	localPath := strings.TrimSuffix(s.LocalFilepath, path.Ext(s.LocalFilepath)) + previewSuffix
+	storagePath := strings.TrimSuffix(s.StorageFilepath, path.Ext(s.StorageFilepath)) + previewSuffix
+	return uploadPreview(s.Uploader, image, localPath, storagePath)
+}
+
+func (s *SegmentSink) UploadPreview(image []byte) (*livekit.FileInfo, error) {
+	name := strings.TrimSuffix(s.PlaylistFilename, path.Ext(s.PlaylistFilename)) + previewSuffix
+	return uploadPreview(s.Uploader, image, path.Join(s.LocalDir, name), path.Join(s.StorageDir, name))
+}
+
+func uploadPreview(u *uploader.Uploader, image []byte, localPath, storagePath string) (*livekit.FileInfo, error) {
+	if err := os.WriteFile(localPath, image, 0644); err != nil {
+		return nil, err
+	}
+
+	location, size, err := u.Upload(localPath, storagePath, types.OutputTypeJPEG)
+	if err != nil {
+		return nil, err
+	}
+
+	return &livekit.FileInfo{
+		Filename: storagePath,
+		Location: location,
+		Size:     size,
+	}, nil
+}
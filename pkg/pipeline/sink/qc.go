@@ -0,0 +1,46 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/livekit/egress/pkg/pipeline/qc"
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/egress/pkg/types"
+)
+
+// QCReporter is implemented by sinks which upload qc reports next to their output
+type QCReporter interface {
+	UploadQCReport(report *qc.Report) error
+}
+
+func (s *FileSink) UploadQCReport(report *qc.Report) error {
+	return uploadQCReport(s.Uploader, report,
+		fmt.Sprintf("%s.qc.json", s.LocalFilepath),
+		fmt.Sprintf("%s.qc.json", s.StorageFilepath),
+	)
+}
+
+func (s *SegmentSink) UploadQCReport(report *qc.Report) error {
+	filename := fmt.Sprintf("%s.qc.json", s.PlaylistFilename)
+	return uploadQCReport(s.Uploader, report,
+		path.Join(s.LocalDir, filename),
+		path.Join(s.StorageDir, filename),
+	)
+}
+
+func uploadQCReport(u *uploader.Uploader, report *qc.Report, localFilepath, storageFilepath string) error {
+	b, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(localFilepath, b, 0644); err != nil {
+		return err
+	}
+
+	_, _, err = u.Upload(localFilepath, storageFilepath, types.OutputTypeJSON)
+	return err
+}
@@ -12,9 +12,13 @@ import (
 
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/logging"
+	"github.com/livekit/egress/pkg/pipeline/sink/fmp4"
 	"github.com/livekit/egress/pkg/pipeline/sink/m3u8"
+	"github.com/livekit/egress/pkg/pipeline/sink/mse"
 	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
 	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/egress/pkg/util"
 	"github.com/livekit/protocol/logger"
 )
 
@@ -23,20 +27,41 @@ const maxPendingUploads = 100
 type SegmentSink struct {
 	*uploader.Uploader
 
-	conf *config.PipelineConfig
+	conf   *config.PipelineConfig
+	logger logger.Logger
 	*config.SegmentConfig
 
-	playlist                  *m3u8.PlaylistWriter
+	playlist                  playlistWriter
+	keys                      *hlsKeys // aes-128 only
+	initSegmentUploaded       bool
+	initSegmentLock           sync.Mutex
+	timescales                map[uint32]uint32 // fmp4 track timescales, from the init segment
 	currentItemStartTimestamp int64
 	currentItemFilename       string
 	startDate                 time.Time
 	startDateTimestamp        time.Duration
 
+	// low latency hls only
+	lowLatency     *m3u8.LowLatencyPlaylistWriter
+	parts          []string
+	partsStartPTS  int64
+	partsStartDate time.Time
+	partsDuration  float64
+	partCount      int
+
 	openSegmentsStartTime map[string]int64
+	openSegmentsChunked   map[string]*chunkedSegment // chunked cmaf only
 	openSegmentsLock      sync.Mutex
 
 	endedSegments chan SegmentUpdate
 	done          core.Fuse
+
+	renditions []*SegmentSink // multi-rendition hls and alternate audio only
+}
+
+type playlistWriter interface {
+	Append(dateTime time.Time, duration float64, filename string) error
+	Close() error
 }
 
 type SegmentUpdate struct {
@@ -46,25 +71,97 @@ type SegmentUpdate struct {
 
 func newSegmentSink(u *uploader.Uploader, p *config.PipelineConfig, o *config.SegmentConfig) (*SegmentSink, error) {
 	playlistName := path.Join(o.LocalDir, o.PlaylistFilename)
-	playlist, err := m3u8.NewPlaylistWriter(playlistName, o.SegmentDuration)
+
+	if p.PlaylistURIs != nil && p.PlaylistURIs.Presign && o.UploadConfig != nil && !u.CanPresign() {
+		return nil, errors.ErrNotSupported("presigned playlist uris for this storage")
+	}
+	initSegmentURI, err := getPlaylistURI(u, p, o, getInitSegmentName(o))
 	if err != nil {
 		return nil, err
 	}
 
-	return &SegmentSink{
+	var playlist playlistWriter
+	var hls *m3u8.PlaylistWriter
+	var lowLatency *m3u8.LowLatencyPlaylistWriter
+	switch {
+	case o.OutputType == types.OutputTypeMSE:
+		playlist, err = mse.NewIndexWriter(playlistName, initSegmentURI, getMSECodecs(p), o.SegmentDuration)
+	case o.FMP4:
+		hls, err = m3u8.NewFMP4PlaylistWriter(playlistName, o.SegmentDuration, initSegmentURI)
+		playlist = hls
+	case o.PartDuration > 0:
+		lowLatency, err = m3u8.NewLowLatencyPlaylistWriter(playlistName, o.SegmentDuration, o.PartDuration)
+		playlist = lowLatency
+	default:
+		hls, err = m3u8.NewPlaylistWriter(playlistName, o.SegmentDuration)
+		playlist = hls
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SegmentSink{
 		Uploader:              u,
 		SegmentConfig:         o,
 		conf:                  p,
+		logger:                logging.Logger(logging.Sink),
 		playlist:              playlist,
+		lowLatency:            lowLatency,
 		openSegmentsStartTime: make(map[string]int64),
+		openSegmentsChunked:   make(map[string]*chunkedSegment),
 		endedSegments:         make(chan SegmentUpdate, maxPendingUploads),
 		done:                  core.NewFuse(),
 		startDateTimestamp:    -1,
-	}, nil
+	}
+
+	if o.HLSEncryption != nil && hls != nil {
+		if s.keys, err = newHLSKeys(s, hls); err != nil {
+			return nil, err
+		}
+	}
+
+	// renditions are stored next to the main playlist, so they share its uploader
+	for _, r := range o.Renditions {
+		rendition, err := newSegmentSink(u, p, r)
+		if err != nil {
+			return nil, err
+		}
+		s.renditions = append(s.renditions, rendition)
+	}
+	for _, r := range o.AudioRenditions {
+		rendition, err := newSegmentSink(u, p, r)
+		if err != nil {
+			return nil, err
+		}
+		s.renditions = append(s.renditions, rendition)
+	}
+
+	return s, nil
+}
+
+// ForElement returns the sink for the splitmuxsink with the given name
+func (s *SegmentSink) ForElement(name string) *SegmentSink {
+	for _, r := range s.renditions {
+		if r.SinkName() == name {
+			return r
+		}
+	}
+	return s
 }
 
 func (s *SegmentSink) Start() error {
-	go func() {
+	for _, r := range s.renditions {
+		if err := r.Start(); err != nil {
+			return err
+		}
+	}
+	if s.MasterPlaylistFilename != "" {
+		if err := s.uploadMasterPlaylist(); err != nil {
+			return err
+		}
+	}
+
+	util.Go(s.conf.Failure, func() {
 		var err error
 		defer func() {
 			if err != nil {
@@ -74,46 +171,277 @@ func (s *SegmentSink) Start() error {
 		}()
 
 		for update := range s.endedSegments {
+			if s.lowLatency != nil {
+				if err = s.uploadPart(update); err != nil {
+					return
+				}
+				if err = s.uploadPlaylist(); err != nil {
+					return
+				}
+				continue
+			}
+
+			var location string
 			var size int64
-			s.SegmentsInfo.SegmentCount++
+			var checksums *config.Checksums
+			s.IncSegmentCount()
 
 			segmentLocalPath := path.Join(s.LocalDir, update.filename)
-			segmentStoragePath := path.Join(s.StorageDir, update.filename)
-			_, size, err = s.Upload(segmentLocalPath, segmentStoragePath, s.getSegmentOutputType())
-			if err != nil {
-				return
+			storageName := s.getStorageName(update.filename, s.getSegmentStartDate(update.filename))
+			segmentStoragePath := path.Join(s.StorageDir, storageName)
+
+			streamed := false
+			if c := s.takeChunkedSegment(update.filename); c != nil {
+				if location, size, err = c.wait(); err != nil {
+					// the complete segment replaces whatever was sent
+					s.logger.Warnw("chunked segment upload failed, uploading whole segment", err, "path", c.storagePath)
+				} else {
+					streamed = true
+					storageName = c.storageName
+					segmentStoragePath = c.storagePath
+				}
+			}
+
+			if !streamed {
+				if s.OutputType == types.OutputTypeMSE || s.FMP4 {
+					if err = s.splitInitSegment(segmentLocalPath, update.filename); err != nil {
+						return
+					}
+				}
+				if s.keys != nil {
+					// the media sequence starts at 0
+					if err = s.encryptSegment(segmentLocalPath, uint64(s.SegmentsInfo.SegmentCount-1)); err != nil {
+						return
+					}
+				}
+				location, size, checksums, err = s.UploadWithChecksums(segmentLocalPath, segmentStoragePath, s.getSegmentOutputType())
+				if err != nil {
+					s.Segments = append(s.Segments, &config.SegmentEntry{
+						Filename:     storageName,
+						UploadStatus: config.SegmentUploadFailed,
+					})
+					return
+				}
 			}
 
 			s.SegmentsInfo.Size += size
+			s.logger.Debugw("segment uploaded", "path", segmentStoragePath, "size", size)
 
-			err = s.endSegment(update.filename, update.endTime)
+			err = s.endSegment(update.filename, storageName, update.endTime, size, s.getUploadStatus(location), checksums)
 			if err != nil {
-				logger.Errorw("failed to end segment", err, "path", segmentLocalPath)
+				s.logger.Errorw("failed to end segment", err, "path", segmentLocalPath)
 				return
 			}
 
-			playlistLocalPath := path.Join(s.LocalDir, s.PlaylistFilename)
-			playlistStoragePath := path.Join(s.StorageDir, s.PlaylistFilename)
-			s.SegmentsInfo.PlaylistLocation, _, err = s.Upload(playlistLocalPath, playlistStoragePath, s.OutputType)
-			if err != nil {
+			if err = s.uploadPlaylist(); err != nil {
 				return
 			}
 		}
-	}()
+	})
 
 	return nil
 }
 
+func (s *SegmentSink) uploadPlaylist() error {
+	playlistLocalPath := path.Join(s.LocalDir, s.PlaylistFilename)
+	playlistStoragePath := path.Join(s.StorageDir, s.PlaylistFilename)
+
+	var err error
+	s.SegmentsInfo.PlaylistLocation, _, err = s.Upload(playlistLocalPath, playlistStoragePath, s.OutputType)
+	return err
+}
+
+// uploadMasterPlaylist lists the main output and each of its renditions, highest bandwidth first,
+// followed by any alternate audio
+func (s *SegmentSink) uploadMasterPlaylist() error {
+	var bandwidth int32
+	var width, height int32
+	if s.conf.VideoEnabled {
+		bandwidth = s.conf.VideoBitrate
+		width, height = s.conf.Width, s.conf.Height
+	}
+	if s.conf.AudioEnabled {
+		bandwidth += s.conf.AudioBitrate
+	}
+	uri, err := s.getPlaylistURI(s.PlaylistFilename)
+	if err != nil {
+		return err
+	}
+	variants := []m3u8.Variant{{
+		URI:       uri,
+		Bandwidth: int(bandwidth) * 1000,
+		Width:     width,
+		Height:    height,
+	}}
+
+	var audio []m3u8.AudioRendition
+	if len(s.AudioRenditions) > 0 {
+		// the main audio is muxed into the variants
+		audio = append(audio, m3u8.AudioRendition{
+			Language: s.conf.AlternateAudio.Language,
+			Name:     s.conf.AlternateAudio.Name,
+			Default:  true,
+		})
+	}
+
+	for _, r := range s.renditions {
+		if r.AudioRendition != nil {
+			if uri, err = r.getPlaylistURI(r.PlaylistFilename); err != nil {
+				return err
+			}
+			audio = append(audio, m3u8.AudioRendition{
+				URI:      uri,
+				Language: r.AudioRendition.Language,
+				Name:     r.AudioRendition.Name,
+			})
+			continue
+		}
+
+		bandwidth = r.Rendition.VideoBitrate
+		if s.conf.AudioEnabled {
+			bandwidth += s.conf.AudioBitrate
+		}
+		if uri, err = r.getPlaylistURI(r.PlaylistFilename); err != nil {
+			return err
+		}
+		width, height = r.Rendition.Resolution(s.conf)
+		variants = append(variants, m3u8.Variant{
+			URI:       uri,
+			Bandwidth: int(bandwidth) * 1000,
+			Width:     width,
+			Height:    height,
+		})
+	}
+
+	localPath := path.Join(s.LocalDir, s.MasterPlaylistFilename)
+	if err = m3u8.WriteMasterPlaylist(localPath, variants, audio); err != nil {
+		return err
+	}
+	_, _, err = s.Upload(localPath, path.Join(s.StorageDir, s.MasterPlaylistFilename), s.OutputType)
+	return err
+}
+
+func (s *SegmentSink) getUploadStatus(location string) string {
+	if s.IsBackup(location) {
+		return config.SegmentBackedUp
+	}
+	return config.SegmentUploaded
+}
+
 func (s *SegmentSink) getSegmentOutputType() types.OutputType {
 	switch s.OutputType {
 	case types.OutputTypeHLS:
-		// HLS is always mpeg ts for now. We may implement fmp4 in the future
+		if s.FMP4 {
+			return types.OutputTypeMP4
+		}
 		return types.OutputTypeTS
+	case types.OutputTypeMSE:
+		return types.OutputTypeWebM
 	default:
 		return s.OutputType
 	}
 }
 
+// splitInitSegment removes the webm or mp4 headers from a segment, so that it can be appended after the init segment.
+// The headers from the first segment are uploaded as the init segment.
+func (s *SegmentSink) splitInitSegment(segmentLocalPath, filename string) error {
+	b, err := os.ReadFile(segmentLocalPath)
+	if err != nil {
+		return err
+	}
+
+	var initSegment, media []byte
+	initOutputType := types.OutputTypeWebM
+	if s.FMP4 {
+		initOutputType = types.OutputTypeMP4
+		initSegment, media, err = fmp4.SplitInitSegment(b)
+		if err != nil {
+			return err
+		}
+		if s.timescales == nil {
+			if s.timescales, err = fmp4.Timescales(initSegment); err != nil {
+				return err
+			}
+		}
+		if err = fmp4.ShiftDecodeTime(media, s.timescales, time.Duration(s.getSegmentStartTime(filename))); err != nil {
+			return err
+		}
+	} else {
+		initSegment, media, err = mse.SplitInitSegment(b)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = s.uploadInitSegment(initSegment, initOutputType); err != nil {
+		return err
+	}
+
+	return os.WriteFile(segmentLocalPath, media, 0644)
+}
+
+// uploadInitSegment uploads the headers of the first segment, and ignores the rest
+func (s *SegmentSink) uploadInitSegment(initSegment []byte, outputType types.OutputType) error {
+	s.initSegmentLock.Lock()
+	defer s.initSegmentLock.Unlock()
+
+	if s.initSegmentUploaded {
+		return nil
+	}
+
+	initName := getInitSegmentName(s.SegmentConfig)
+	initLocalPath := path.Join(s.LocalDir, initName)
+	if err := os.WriteFile(initLocalPath, initSegment, 0644); err != nil {
+		return err
+	}
+	if _, _, err := s.Upload(initLocalPath, path.Join(s.StorageDir, initName), outputType); err != nil {
+		return err
+	}
+	s.initSegmentUploaded = true
+	return nil
+}
+
+// the init segment is written next to the segments, and named relative to the playlist
+func getInitSegmentName(o *config.SegmentConfig) string {
+	if o.FMP4 {
+		return fmt.Sprintf("%s_init%s", o.SegmentPrefix, types.FileExtensionMP4)
+	}
+	return fmt.Sprintf("%s_init%s", o.SegmentPrefix, types.FileExtensionWebM)
+}
+
+// getPlaylistURI returns the uri of a stored file in the playlist, which is relative to the playlist unless playlist_uris is configured
+func (s *SegmentSink) getPlaylistURI(name string) (string, error) {
+	return getPlaylistURI(s.Uploader, s.conf, s.SegmentConfig, name)
+}
+
+func getPlaylistURI(u *uploader.Uploader, p *config.PipelineConfig, o *config.SegmentConfig, name string) (string, error) {
+	if p.PlaylistURIs == nil || o.UploadConfig == nil {
+		return name, nil
+	}
+
+	storagePath := path.Join(o.StorageDir, name)
+	if p.PlaylistURIs.Presign {
+		return u.Presign(storagePath, p.PlaylistURIs.PresignExpiry)
+	}
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(p.PlaylistURIs.BaseURL, "/"), storagePath), nil
+}
+
+// getMSECodecs returns the mime type used to create a SourceBuffer
+func getMSECodecs(p *config.PipelineConfig) string {
+	var codecs []string
+	if p.VideoEnabled {
+		if p.VideoOutCodec == types.MimeTypeVP9 {
+			codecs = append(codecs, "vp9")
+		} else {
+			codecs = append(codecs, "vp8")
+		}
+	}
+	if p.AudioEnabled {
+		codecs = append(codecs, "opus")
+	}
+	return fmt.Sprintf(`%s; codecs="%s"`, types.OutputTypeWebM, strings.Join(codecs, ", "))
+}
+
 func (s *SegmentSink) StartSegment(filepath string, startTime int64) error {
 	if !strings.HasPrefix(filepath, s.LocalDir) {
 		return fmt.Errorf("invalid filepath")
@@ -138,9 +466,56 @@ func (s *SegmentSink) StartSegment(filepath string, startTime int64) error {
 
 	s.openSegmentsStartTime[filename] = startTime
 
+	if s.ChunkDuration > 0 {
+		storageName := s.getStorageName(filename, s.startDate.Add(-s.startDateTimestamp).Add(time.Duration(startTime)))
+		storagePath := path.Join(s.StorageDir, storageName)
+		if upload := s.StartChunkedUpload(storagePath, types.OutputTypeMP4); upload != nil {
+			c := newChunkedSegment(upload, filepath, time.Duration(startTime), func(initSegment []byte) error {
+				return s.uploadInitSegment(initSegment, types.OutputTypeMP4)
+			})
+			c.storageName = storageName
+			c.storagePath = storagePath
+			s.openSegmentsChunked[filename] = c
+		}
+	}
+
 	return nil
 }
 
+// takeChunkedSegment returns the upload of a closed segment, if it is being streamed
+func (s *SegmentSink) takeChunkedSegment(filename string) *chunkedSegment {
+	s.openSegmentsLock.Lock()
+	defer s.openSegmentsLock.Unlock()
+
+	c := s.openSegmentsChunked[filename]
+	delete(s.openSegmentsChunked, filename)
+	return c
+}
+
+// getSegmentStartDate returns the wall clock time at which an open segment started
+func (s *SegmentSink) getSegmentStartDate(filename string) time.Time {
+	s.openSegmentsLock.Lock()
+	defer s.openSegmentsLock.Unlock()
+
+	return s.startDate.Add(-s.startDateTimestamp).Add(time.Duration(s.openSegmentsStartTime[filename]))
+}
+
+// getStorageName prefixes a segment with its date partition, and is used in the playlist
+func (s *SegmentSink) getStorageName(filename string, startDate time.Time) string {
+	if s.PartitionLayout == "" {
+		return filename
+	}
+	return path.Join(startDate.UTC().Format(s.PartitionLayout), filename)
+}
+
+// getSegmentStartTime returns the running time at which an open segment started
+func (s *SegmentSink) getSegmentStartTime(filename string) int64 {
+	s.openSegmentsLock.Lock()
+	defer s.openSegmentsLock.Unlock()
+
+	return s.openSegmentsStartTime[filename]
+}
+
 func (s *SegmentSink) UpdateStartDate(t time.Time) {
 	s.openSegmentsLock.Lock()
 	defer s.openSegmentsLock.Unlock()
@@ -155,48 +530,98 @@ func (s *SegmentSink) EnqueueSegmentUpload(filepath string, endTime int64) error
 
 	filename := filepath[len(s.LocalDir):]
 
+	s.openSegmentsLock.Lock()
+	if c := s.openSegmentsChunked[filename]; c != nil {
+		c.closed.Break()
+	}
+	s.openSegmentsLock.Unlock()
+
 	select {
 	case s.endedSegments <- SegmentUpdate{filename: filename, endTime: endTime}:
 		return nil
 
 	default:
 		err := errors.New("segment upload job queue is full")
-		logger.Infow("failed to upload segment", "error", err)
+		s.logger.Infow("failed to upload segment", "error", err)
 		return errors.ErrUploadFailed(filename, err)
 	}
 }
 
-func (s *SegmentSink) endSegment(filename string, endTime int64) error {
+func (s *SegmentSink) endSegment(filename, storageName string, endTime, size int64, uploadStatus string, checksums *config.Checksums) error {
 	if endTime <= s.currentItemStartTimestamp {
 		return fmt.Errorf("segment end time before start time")
 	}
 
+	segment, err := s.closeSegment(filename, endTime)
+	if err != nil {
+		return err
+	}
+	segment.Filename = storageName
+	segment.Size = size
+	segment.UploadStatus = uploadStatus
+	if checksums != nil {
+		segment.Checksums = *checksums
+	}
+	s.Segments = append(s.Segments, segment)
+
+	uri, err := s.getPlaylistURI(storageName)
+	if err != nil {
+		return err
+	}
+	if err = s.playlist.Append(segment.StartTime, segment.Duration, uri); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// closeSegment returns the start time and duration of an open segment
+func (s *SegmentSink) closeSegment(filename string, endTime int64) (*config.SegmentEntry, error) {
 	s.openSegmentsLock.Lock()
 	defer s.openSegmentsLock.Unlock()
 
 	t, ok := s.openSegmentsStartTime[filename]
 	if !ok {
-		return fmt.Errorf("no open segment with the name %s", filename)
+		return nil, fmt.Errorf("no open segment with the name %s", filename)
 	}
 	delete(s.openSegmentsStartTime, filename)
 
-	duration := float64(endTime-t) / float64(time.Second)
-
-	segmentStartDate := s.startDate.Add(-s.startDateTimestamp).Add(time.Duration(t))
-	if err := s.playlist.Append(segmentStartDate, duration, filename); err != nil {
-		return err
-	}
-
-	return nil
+	return &config.SegmentEntry{
+		Filename:  filename,
+		Duration:  float64(endTime-t) / float64(time.Second),
+		StartPTS:  t,
+		StartTime: s.startDate.Add(-s.startDateTimestamp).Add(time.Duration(t)),
+	}, nil
 }
 
 func (s *SegmentSink) Finalize() error {
+	for _, r := range s.renditions {
+		if err := r.Finalize(); err != nil {
+			s.logger.Errorw("failed to finalize rendition", err, "playlist", r.PlaylistFilename)
+		}
+	}
+
 	// wait for all pending upload jobs to finish
 	close(s.endedSegments)
 	<-s.done.Watch()
 
+	// segments which were never closed are not listed, but their uploads still need to end
+	s.openSegmentsLock.Lock()
+	for filename, c := range s.openSegmentsChunked {
+		c.closed.Break()
+		_, _, _ = c.wait()
+		delete(s.openSegmentsChunked, filename)
+	}
+	s.openSegmentsLock.Unlock()
+
+	if len(s.parts) > 0 {
+		if err := s.completeSegment(); err != nil {
+			s.logger.Errorw("failed to complete segment", err)
+		}
+	}
+
 	if err := s.playlist.Close(); err != nil {
-		logger.Errorw("failed to send EOS to playlist writer", err)
+		s.logger.Errorw("failed to send EOS to playlist writer", err)
 	}
 
 	// upload the finalized playlist
@@ -207,12 +632,13 @@ func (s *SegmentSink) Finalize() error {
 	if !s.DisableManifest {
 		manifestLocalPath := fmt.Sprintf("%s.json", playlistLocalPath)
 		manifestStoragePath := fmt.Sprintf("%s.json", playlistStoragePath)
-		if err := uploadManifest(s.conf, s.Uploader, manifestLocalPath, manifestStoragePath); err != nil {
+		if err := uploadManifest(s.conf, s.Uploader, manifestLocalPath, manifestStoragePath, nil, nil); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	// the playlist keeps its location, but the egress fails
+	return s.RequiredReplicaError()
 }
 
 func (s *SegmentSink) Cleanup() {
@@ -221,9 +647,9 @@ func (s *SegmentSink) Cleanup() {
 	}
 
 	if s.LocalDir != "" {
-		logger.Debugw("removing temporary directory", "path", s.LocalDir)
+		s.logger.Debugw("removing temporary directory", "path", s.LocalDir)
 		if err := os.RemoveAll(s.LocalDir); err != nil {
-			logger.Errorw("could not delete temp dir", err)
+			s.logger.Errorw("could not delete temp dir", err)
 		}
 	}
 }
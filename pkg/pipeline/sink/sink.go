@@ -2,6 +2,7 @@ package sink
 
 import (
 	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/encryption"
 	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
 	"github.com/livekit/egress/pkg/types"
 )
@@ -16,10 +17,10 @@ func CreateSinks(p *config.PipelineConfig) (map[types.EgressType]Sink, error) {
 	sinks := make(map[types.EgressType]Sink)
 	for egressType, c := range p.Outputs {
 		switch egressType {
-		case types.EgressTypeFile:
+		case types.EgressTypeFile, types.EgressTypeProxyFile:
 			o := c.(*config.FileConfig)
 
-			u, err := uploader.New(o.UploadConfig, p.BackupStorage)
+			u, err := newUploader(p, o.UploadConfig)
 			if err != nil {
 				return nil, err
 			}
@@ -27,14 +28,7 @@ func CreateSinks(p *config.PipelineConfig) (map[types.EgressType]Sink, error) {
 			sinks[egressType] = newFileSink(u, p, o)
 
 		case types.EgressTypeSegments:
-			o := c.(*config.SegmentConfig)
-
-			u, err := uploader.New(o.UploadConfig, p.BackupStorage)
-			if err != nil {
-				return nil, err
-			}
-
-			s, err := newSegmentSink(u, p, o)
+			s, err := CreateSegmentSink(p, c.(*config.SegmentConfig))
 			if err != nil {
 				return nil, err
 			}
@@ -46,7 +40,13 @@ func CreateSinks(p *config.PipelineConfig) (map[types.EgressType]Sink, error) {
 		case types.EgressTypeWebsocket:
 			o := c.(*config.StreamConfig)
 
-			s, err := newWebsocketSink(o, types.MimeTypeRawAudio)
+			// video tracks are sent as framed VP8 or H264, audio tracks as raw pcm
+			mimeType := types.MimeTypeRawAudio
+			if p.VideoEnabled {
+				mimeType = p.VideoOutCodec
+			}
+
+			s, err := newWebsocketSink(o, mimeType)
 			if err != nil {
 				return nil, err
 			}
@@ -56,3 +56,74 @@ func CreateSinks(p *config.PipelineConfig) (map[types.EgressType]Sink, error) {
 
 	return sinks, nil
 }
+
+// CreateSegmentSink is also used for segment outputs added to a running egress
+func CreateSegmentSink(p *config.PipelineConfig, o *config.SegmentConfig) (*SegmentSink, error) {
+	u, err := newUploader(p, o.UploadConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSegmentSink(u, p, o)
+}
+
+func newUploader(p *config.PipelineConfig, conf interface{}) (*uploader.Uploader, error) {
+	u, err := uploader.New(conf, p.BackupStorage)
+	if err != nil {
+		return nil, err
+	}
+	if err = ConfigureUploader(u, &p.BaseConfig); err != nil {
+		return nil, err
+	}
+	if p.UploadSpool != nil {
+		u.SetSpool(p.UploadSpool, p.Info)
+	}
+	return u, nil
+}
+
+// ConfigureUploader is also used for uploads resumed by the service after a crash
+func ConfigureUploader(u *uploader.Uploader, p *config.BaseConfig) error {
+	if len(p.UploadReplicas) > 0 {
+		if err := u.SetReplicas(p.UploadReplicas); err != nil {
+			return err
+		}
+	}
+	u.SetRetry(&p.UploadRetry)
+	if p.Checksums != nil {
+		u.SetChecksums(p.Checksums)
+	}
+	if p.LocalCopyDirectory != "" {
+		u.KeepLocalCopies(p.LocalCopyDirectory)
+	}
+	if p.UploadHook != nil {
+		u.SetHook(p.UploadHook)
+	}
+	if len(p.UploadHeaders) > 0 {
+		u.SetHeaders(p.UploadHeaders)
+	}
+	if p.AliOSS != nil {
+		u.SetAliOSS(p.AliOSS)
+	}
+	if p.S3Multipart != nil {
+		u.SetS3Multipart(p.S3Multipart)
+	}
+	if p.S3SSE != nil {
+		u.SetS3SSE(p.S3SSE)
+	}
+	if p.S3Object != nil {
+		u.SetS3Object(p.S3Object)
+	}
+	if len(p.S3AssumeRole) > 0 {
+		if err := u.SetS3AssumeRole(p.S3AssumeRole); err != nil {
+			return err
+		}
+	}
+	if p.Encryption != nil {
+		key, err := encryption.ParsePublicKey(p.Encryption.PublicKey)
+		if err != nil {
+			return err
+		}
+		u.EncryptWith(key)
+	}
+	return u.Init()
+}
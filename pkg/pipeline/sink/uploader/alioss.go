@@ -6,40 +6,110 @@ import (
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 
+	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
 )
 
+const (
+	envAliOSSAccessKey     = "ALIBABA_CLOUD_ACCESS_KEY_ID"
+	envAliOSSSecret        = "ALIBABA_CLOUD_ACCESS_KEY_SECRET"
+	envAliOSSSecurityToken = "ALIBABA_CLOUD_SECURITY_TOKEN"
+
+	aliOSSCheckpointSuffix = ".ossparts.json"
+	aliOSSPartSize         = 16 // MB
+	aliOSSConcurrency      = 4
+)
+
 type AliOSSUploader struct {
-	conf *livekit.AliOSSUpload
+	conf        *livekit.AliOSSUpload
+	bucket      *oss.Bucket
+	partSize    int64 // bytes
+	concurrency int
 }
 
 func newAliOSSUploader(conf *livekit.AliOSSUpload) (uploader, error) {
+	// credentials from the environment, such as those of a RAM role, are used if the request has none
+	accessKey, secret := conf.AccessKey, conf.Secret
+	var options []oss.ClientOption
+	if accessKey == "" && secret == "" {
+		accessKey = os.Getenv(envAliOSSAccessKey)
+		secret = os.Getenv(envAliOSSSecret)
+		if token := os.Getenv(envAliOSSSecurityToken); token != "" {
+			options = append(options, oss.SecurityToken(token))
+		}
+	}
+
+	client, err := oss.New(conf.Endpoint, accessKey, secret, options...)
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := client.Bucket(conf.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
 	return &AliOSSUploader{
-		conf: conf,
+		conf:        conf,
+		bucket:      bucket,
+		partSize:    aliOSSPartSize << 20,
+		concurrency: aliOSSConcurrency,
 	}, nil
 }
 
-func (u *AliOSSUploader) upload(localFilePath, requestedPath string, _ types.OutputType) (string, int64, error) {
-	stat, err := os.Stat(localFilePath)
-	if err != nil {
-		return "", 0, err
+// SetAliOSS uploads alioss files larger than the configured part size in parallel, checkpointed parts
+func (u *Uploader) SetAliOSS(conf *config.AliOSSConfig) {
+	for _, b := range u.backends() {
+		a, ok := b.(*AliOSSUploader)
+		if !ok {
+			continue
+		}
+		if conf.PartSize > 0 {
+			a.partSize = conf.PartSize << 20
+		}
+		if conf.Concurrency > 0 {
+			a.concurrency = conf.Concurrency
+		}
 	}
+}
+
+func (u *AliOSSUploader) upload(localFilepath, storageFilepath string, outputType types.OutputType, cacheControl string) (string, int64, error) {
+	return u.uploadWithMetadata(localFilepath, storageFilepath, outputType, cacheControl, nil)
+}
 
-	client, err := oss.New(u.conf.Endpoint, u.conf.AccessKey, u.conf.Secret)
+// uploadWithMetadata stores annotations as object metadata
+func (u *AliOSSUploader) uploadWithMetadata(
+	localFilepath, storageFilepath string,
+	outputType types.OutputType,
+	cacheControl string,
+	annotations map[string]string,
+) (string, int64, error) {
+	stat, err := os.Stat(localFilepath)
 	if err != nil {
 		return "", 0, err
 	}
 
-	bucket, err := client.Bucket(u.conf.Bucket)
-	if err != nil {
-		return "", 0, err
+	options := []oss.Option{oss.ContentType(string(outputType))}
+	if cacheControl != "" {
+		options = append(options, oss.CacheControl(cacheControl))
+	}
+	for k, v := range annotations {
+		options = append(options, oss.Meta(k, v))
 	}
 
-	err = bucket.PutObjectFromFile(requestedPath, localFilePath)
+	if stat.Size() > u.partSize {
+		// completed parts are checkpointed next to the local file, so that a failed or recovered upload only sends the missing parts
+		options = append(options,
+			oss.Routines(u.concurrency),
+			oss.Checkpoint(true, localFilepath+aliOSSCheckpointSuffix),
+		)
+		err = u.bucket.UploadFile(storageFilepath, localFilepath, u.partSize, options...)
+	} else {
+		err = u.bucket.PutObjectFromFile(storageFilepath, localFilepath, options...)
+	}
 	if err != nil {
 		return "", 0, err
 	}
 
-	return fmt.Sprintf("https://%s.%s/%s", u.conf.Bucket, u.conf.Endpoint, requestedPath), stat.Size(), nil
+	return fmt.Sprintf("https://%s.%s/%s", u.conf.Bucket, u.conf.Endpoint, storageFilepath), stat.Size(), nil
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"time"
 
 	"github.com/Azure/azure-storage-blob-go/azblob"
 
@@ -15,6 +16,7 @@ import (
 type AzureUploader struct {
 	conf      *livekit.AzureBlobUpload
 	container string
+	timeout   time.Duration // of each request
 }
 
 func newAzureUploader(conf *livekit.AzureBlobUpload) (uploader, error) {
@@ -24,7 +26,11 @@ func newAzureUploader(conf *livekit.AzureBlobUpload) (uploader, error) {
 	}, nil
 }
 
-func (u *AzureUploader) upload(localFilepath, storageFilepath string, outputType types.OutputType) (string, int64, error) {
+func (u *AzureUploader) setRequestTimeout(timeout time.Duration) {
+	u.timeout = timeout
+}
+
+func (u *AzureUploader) upload(localFilepath, storageFilepath string, outputType types.OutputType, cacheControl string) (string, int64, error) {
 	credential, err := azblob.NewSharedKeyCredential(
 		u.conf.AccountName,
 		u.conf.AccountKey,
@@ -40,10 +46,8 @@ func (u *AzureUploader) upload(localFilepath, storageFilepath string, outputType
 
 	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{
 		Retry: azblob.RetryOptions{
-			Policy:        azblob.RetryPolicyExponential,
-			MaxTries:      maxRetries,
-			RetryDelay:    minDelay,
-			MaxRetryDelay: maxDelay,
+			MaxTries:   1, // retried by the uploader
+			TryTimeout: u.timeout,
 		},
 	})
 	containerURL := azblob.NewContainerURL(*azUrl, pipeline)
@@ -65,7 +69,7 @@ func (u *AzureUploader) upload(localFilepath, storageFilepath string, outputType
 	// upload blocks in parallel for optimal performance
 	// it calls PutBlock/PutBlockList for files larger than 256 MBs and PutBlob for smaller files
 	_, err = azblob.UploadFileToBlockBlob(context.Background(), file, blobURL, azblob.UploadToBlockBlobOptions{
-		BlobHTTPHeaders: azblob.BlobHTTPHeaders{ContentType: string(outputType)},
+		BlobHTTPHeaders: azblob.BlobHTTPHeaders{ContentType: string(outputType), CacheControl: cacheControl},
 		BlockSize:       4 * 1024 * 1024,
 		Parallelism:     16,
 	})
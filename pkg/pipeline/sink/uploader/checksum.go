@@ -0,0 +1,68 @@
+package uploader
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/livekit/egress/pkg/config"
+)
+
+// SetChecksums computes checksums of each file as it is stored, returned by UploadWithChecksums
+func (u *Uploader) SetChecksums(conf *config.ChecksumConfig) {
+	u.checksums = conf
+}
+
+func (u *Uploader) getChecksums(localFilepath string) (*config.Checksums, error) {
+	var sha, md hash.Hash
+	var writers []io.Writer
+	for _, a := range u.checksums.Algorithms {
+		switch a {
+		case config.ChecksumSHA256:
+			sha = sha256.New()
+			writers = append(writers, sha)
+		case config.ChecksumMD5:
+			md = md5.New()
+			writers = append(writers, md)
+		}
+	}
+
+	f, err := os.Open(localFilepath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if _, err = io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return nil, err
+	}
+
+	c := &config.Checksums{}
+	if sha != nil {
+		c.SHA256 = hex.EncodeToString(sha.Sum(nil))
+	}
+	if md != nil {
+		c.MD5 = hex.EncodeToString(md.Sum(nil))
+	}
+	return c, nil
+}
+
+// withChecksums adds the checksums to the annotations stored as object metadata
+func withChecksums(annotations map[string]string, c *config.Checksums) map[string]string {
+	m := make(map[string]string, len(annotations)+2)
+	for k, v := range annotations {
+		m[k] = v
+	}
+	if c.SHA256 != "" {
+		m[config.ChecksumSHA256] = c.SHA256
+	}
+	if c.MD5 != "" {
+		m[config.ChecksumMD5] = c.MD5
+	}
+	return m
+}
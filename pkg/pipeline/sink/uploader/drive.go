@@ -0,0 +1,77 @@
+package uploader
+
+import (
+	"context"
+	"os"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+)
+
+type GoogleDriveUploader struct {
+	conf        *config.GoogleDriveConfig
+	tokenSource oauth2.TokenSource
+}
+
+func newGoogleDriveUploader(conf *config.GoogleDriveConfig) (uploader, error) {
+	oauthConfig := &oauth2.Config{
+		ClientID:     conf.ClientID,
+		ClientSecret: conf.ClientSecret,
+		Endpoint:     google.Endpoint,
+		Scopes:       []string{drive.DriveFileScope},
+	}
+
+	return &GoogleDriveUploader{
+		conf: conf,
+		// access tokens are refreshed as needed, and reused between uploads
+		tokenSource: oauthConfig.TokenSource(context.Background(), &oauth2.Token{RefreshToken: conf.RefreshToken}),
+	}, nil
+}
+
+// upload creates a new file named after the storage path, since drive folders are addressed by id
+func (u *GoogleDriveUploader) upload(localFilepath, storageFilepath string, outputType types.OutputType, _ string) (string, int64, error) {
+	ctx := context.Background()
+
+	file, err := os.Open(localFilepath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+
+	svc, err := drive.NewService(ctx, option.WithTokenSource(u.tokenSource))
+	if err != nil {
+		return "", 0, err
+	}
+
+	f := &drive.File{
+		Name:     storageFilepath,
+		MimeType: string(outputType),
+	}
+	if u.conf.FolderID != "" {
+		f.Parents = []string{u.conf.FolderID}
+	}
+
+	created, err := svc.Files.Create(f).
+		Media(file, googleapi.ContentType(string(outputType))).
+		Fields("id", "webViewLink").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return "", 0, err
+	}
+
+	return created.WebViewLink, stat.Size(), nil
+}
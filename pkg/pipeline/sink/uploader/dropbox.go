@@ -0,0 +1,161 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+)
+
+const (
+	dropboxContentURL = "https://content.dropboxapi.com/2/files"
+	dropboxChunkSize  = 8 << 20
+)
+
+var dropboxEndpoint = oauth2.Endpoint{
+	AuthURL:  "https://www.dropbox.com/oauth2/authorize",
+	TokenURL: "https://api.dropboxapi.com/oauth2/token",
+}
+
+type DropboxUploader struct {
+	conf   *config.DropboxConfig
+	client *http.Client
+}
+
+type dropboxCursor struct {
+	SessionID string `json:"session_id"`
+	Offset    int64  `json:"offset"`
+}
+
+type dropboxCommit struct {
+	Path       string `json:"path"`
+	Mode       string `json:"mode"`
+	Autorename bool   `json:"autorename"`
+	Mute       bool   `json:"mute"`
+}
+
+func newDropboxUploader(conf *config.DropboxConfig) (uploader, error) {
+	oauthConfig := &oauth2.Config{
+		ClientID:     conf.AppKey,
+		ClientSecret: conf.AppSecret,
+		Endpoint:     dropboxEndpoint,
+	}
+
+	ctx := context.Background()
+	return &DropboxUploader{
+		conf:   conf,
+		client: oauth2.NewClient(ctx, oauthConfig.TokenSource(ctx, &oauth2.Token{RefreshToken: conf.RefreshToken})),
+	}, nil
+}
+
+func (u *DropboxUploader) setRequestTimeout(timeout time.Duration) {
+	u.client.Timeout = timeout
+}
+
+// upload uses an upload session, which has no file size limit
+func (u *DropboxUploader) upload(localFilepath, storageFilepath string, _ types.OutputType, _ string) (string, int64, error) {
+	file, err := os.Open(localFilepath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	cursor := &dropboxCursor{}
+	chunk := make([]byte, dropboxChunkSize)
+	for {
+		n, err := io.ReadFull(file, chunk)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return "", 0, err
+		}
+
+		if cursor.SessionID == "" {
+			res := &struct {
+				SessionID string `json:"session_id"`
+			}{}
+			if err = u.call("upload_session/start", map[string]interface{}{"close": false}, chunk[:n], res); err != nil {
+				return "", 0, err
+			}
+			cursor.SessionID = res.SessionID
+		} else {
+			if err = u.call("upload_session/append_v2", map[string]interface{}{"cursor": cursor, "close": false}, chunk[:n], nil); err != nil {
+				return "", 0, err
+			}
+		}
+		cursor.Offset += int64(n)
+	}
+
+	if cursor.SessionID == "" {
+		// empty file
+		res := &struct {
+			SessionID string `json:"session_id"`
+		}{}
+		if err = u.call("upload_session/start", map[string]interface{}{"close": false}, nil, res); err != nil {
+			return "", 0, err
+		}
+		cursor.SessionID = res.SessionID
+	}
+
+	dropboxPath := path.Join("/", u.conf.Directory, storageFilepath)
+	res := &struct {
+		PathDisplay string `json:"path_display"`
+	}{}
+	if err = u.call("upload_session/finish", map[string]interface{}{
+		"cursor": cursor,
+		"commit": &dropboxCommit{
+			Path: dropboxPath,
+			Mode: "overwrite",
+			Mute: true,
+		},
+	}, nil, res); err != nil {
+		return "", 0, err
+	}
+
+	return fmt.Sprintf("dropbox://%s", res.PathDisplay), cursor.Offset, nil
+}
+
+func (u *DropboxUploader) call(endpoint string, arg interface{}, body []byte, res interface{}) error {
+	argJSON, err := json.Marshal(arg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/%s", dropboxContentURL, endpoint), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Dropbox-API-Arg", string(argJSON))
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("dropbox %s failed: %s: %s", endpoint, resp.Status, string(b))
+	}
+
+	if res != nil {
+		return json.NewDecoder(resp.Body).Decode(res)
+	}
+	return nil
+}
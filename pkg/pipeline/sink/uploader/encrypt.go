@@ -0,0 +1,46 @@
+package uploader
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"os"
+
+	"github.com/livekit/egress/pkg/encryption"
+)
+
+// EncryptWith encrypts each file before it is uploaded or moved to backup storage.
+// Local copies are kept unencrypted.
+func (u *Uploader) EncryptWith(publicKey *rsa.PublicKey) {
+	if _, ok := u.uploader.(*noOpUploader); ok {
+		// files are not uploaded, and playlists are still being appended to
+		return
+	}
+	u.publicKey = publicKey
+}
+
+func (u *Uploader) encrypt(localFilepath string) (string, error) {
+	src, err := os.Open(localFilepath)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	encryptedFilepath := fmt.Sprintf("%s.enc", localFilepath)
+	dest, err := os.Create(encryptedFilepath)
+	if err != nil {
+		return "", err
+	}
+
+	err = encryption.Encrypt(dest, src, u.publicKey)
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(encryptedFilepath)
+		return "", err
+	}
+
+	return encryptedFilepath, nil
+}
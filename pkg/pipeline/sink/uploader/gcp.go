@@ -8,7 +8,6 @@ import (
 	"time"
 
 	"cloud.google.com/go/storage"
-	"github.com/googleapis/gax-go/v2"
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 
@@ -16,17 +15,25 @@ import (
 	"github.com/livekit/protocol/livekit"
 )
 
+const gcpDefaultTimeout = time.Second * 32
+
 type GCPUploader struct {
-	conf *livekit.GCPUpload
+	conf    *livekit.GCPUpload
+	timeout time.Duration // of uploads up to googleapi.DefaultUploadChunkSize, and of each chunk of larger uploads
 }
 
 func newGCPUploader(conf *livekit.GCPUpload) (uploader, error) {
 	return &GCPUploader{
-		conf: conf,
+		conf:    conf,
+		timeout: gcpDefaultTimeout,
 	}, nil
 }
 
-func (u *GCPUploader) upload(localFilepath, storageFilepath string, _ types.OutputType) (string, int64, error) {
+func (u *GCPUploader) setRequestTimeout(timeout time.Duration) {
+	u.timeout = timeout
+}
+
+func (u *GCPUploader) upload(localFilepath, storageFilepath string, outputType types.OutputType, cacheControl string) (string, int64, error) {
 	ctx := context.Background()
 
 	file, err := os.Open(localFilepath)
@@ -56,25 +63,24 @@ func (u *GCPUploader) upload(localFilepath, storageFilepath string, _ types.Outp
 	}()
 
 	// In case where the total amount of data to upload is larger than googleapi.DefaultUploadChunkSize, each upload request will have a timeout of
-	// ChunkRetryDeadline, which is 32s by default. If the request payload is smaller than googleapi.DefaultUploadChunkSize, use a context deadline
+	// ChunkRetryDeadline. If the request payload is smaller than googleapi.DefaultUploadChunkSize, use a context deadline
 	// to apply the same timeout
 	var wctx context.Context
 	if stat.Size() <= googleapi.DefaultUploadChunkSize {
 		var cancel context.CancelFunc
-		wctx, cancel = context.WithTimeout(ctx, time.Second*32)
+		wctx, cancel = context.WithTimeout(ctx, u.timeout)
 		defer cancel()
 	} else {
 		wctx = ctx
 	}
 
+	// retried by the uploader
 	wc := client.Bucket(u.conf.Bucket).Object(storageFilepath).Retryer(
-		storage.WithBackoff(gax.Backoff{
-			Initial:    minDelay,
-			Max:        maxDelay,
-			Multiplier: 2,
-		}),
-		storage.WithPolicy(storage.RetryAlways),
+		storage.WithPolicy(storage.RetryNever),
 	).NewWriter(wctx)
+	wc.ChunkRetryDeadline = u.timeout
+	wc.ContentType = string(outputType)
+	wc.CacheControl = cacheControl
 
 	if _, err = io.Copy(wc, file); err != nil {
 		return "", 0, err
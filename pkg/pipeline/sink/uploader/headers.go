@@ -0,0 +1,28 @@
+package uploader
+
+import (
+	"path"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+)
+
+// SetHeaders sets the content type and cache control of uploaded files by filename, so that playlists
+// and segments can be cached differently. The first matching pattern is used
+func (u *Uploader) SetHeaders(conf []config.UploadHeadersConfig) {
+	u.headers = conf
+}
+
+// getHeaders returns the content type and cache control of a file
+func (u *Uploader) getHeaders(storageFilepath string, outputType types.OutputType) (types.OutputType, string) {
+	name := path.Base(storageFilepath)
+	for _, h := range u.headers {
+		if ok, _ := path.Match(h.Match, name); ok {
+			if h.ContentType != "" {
+				outputType = types.OutputType(h.ContentType)
+			}
+			return outputType, h.CacheControl
+		}
+	}
+	return outputType, ""
+}
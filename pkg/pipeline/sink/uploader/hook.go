@@ -0,0 +1,132 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
+)
+
+// uploadHook scans each file before it is stored. It can veto the upload, or annotate it.
+type uploadHook struct {
+	conf   *config.UploadHookConfig
+	client *http.Client
+}
+
+type hookResponse struct {
+	Annotations map[string]string `json:"annotations"`
+}
+
+// metadataUploader is implemented by backends which can store annotations as object metadata
+type metadataUploader interface {
+	uploadWithMetadata(string, string, types.OutputType, string, map[string]string) (string, int64, error)
+}
+
+// SetHook runs a command or calls an endpoint with each file before it is stored
+func (u *Uploader) SetHook(conf *config.UploadHookConfig) {
+	u.hook = &uploadHook{
+		conf:   conf,
+		client: &http.Client{},
+	}
+}
+
+// run returns annotations for the file, or an error if the upload was vetoed or the hook failed
+func (h *uploadHook) run(localFilepath, storageFilepath string, outputType types.OutputType) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.conf.Timeout)
+	defer cancel()
+
+	var output []byte
+	var err error
+	if len(h.conf.Command) > 0 {
+		output, err = h.exec(ctx, localFilepath, storageFilepath, outputType)
+	} else {
+		output, err = h.post(ctx, localFilepath, storageFilepath, outputType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := &hookResponse{}
+	if len(bytes.TrimSpace(output)) > 0 {
+		if err = json.Unmarshal(output, res); err != nil {
+			return nil, fmt.Errorf("invalid upload hook response: %w", err)
+		}
+	}
+	return res.Annotations, nil
+}
+
+// exec runs the command with the local file path as its last argument. A non-zero exit code vetoes the upload.
+func (h *uploadHook) exec(ctx context.Context, localFilepath, storageFilepath string, outputType types.OutputType) ([]byte, error) {
+	args := append(h.conf.Command[1:len(h.conf.Command):len(h.conf.Command)], localFilepath)
+	cmd := exec.CommandContext(ctx, h.conf.Command[0], args...)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("EGRESS_STORAGE_PATH=%s", storageFilepath),
+		fmt.Sprintf("EGRESS_CONTENT_TYPE=%s", outputType),
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok && ctx.Err() == nil {
+		return nil, errors.ErrUploadVetoed(storageFilepath, fmt.Sprintf("exit code %d: %s", exitErr.ExitCode(), strings.TrimSpace(stderr.String())))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("upload hook failed: %w", err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// post sends the file to the endpoint. A 4xx response vetoes the upload.
+func (h *uploadHook) post(ctx context.Context, localFilepath, storageFilepath string, outputType types.OutputType) ([]byte, error) {
+	file, err := os.Open(localFilepath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.conf.URL, file)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", string(outputType))
+	req.Header.Set("X-Egress-Storage-Path", storageFilepath)
+	for k, v := range h.conf.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("upload hook failed: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return body, nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return nil, errors.ErrUploadVetoed(storageFilepath, fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(string(body))))
+	default:
+		return nil, fmt.Errorf("upload hook failed: %s", resp.Status)
+	}
+}
@@ -0,0 +1,143 @@
+package uploader
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+)
+
+func TestUploadHookCommand(t *testing.T) {
+	localFilepath := writeTestFile(t)
+
+	for _, test := range []struct {
+		name        string
+		script      string
+		annotations map[string]string
+		vetoed      bool
+		failed      bool
+	}{
+		{
+			name:   "Empty",
+			script: `exit 0`,
+		},
+		{
+			name:        "Annotated",
+			script:      `echo "{\"annotations\": {\"path\": \"$EGRESS_STORAGE_PATH\", \"type\": \"$EGRESS_CONTENT_TYPE\"}}"`,
+			annotations: map[string]string{"path": "recordings/room.mp4", "type": "video/mp4"},
+		},
+		{
+			name:   "Vetoed",
+			script: `echo "infected" >&2; exit 1`,
+			vetoed: true,
+		},
+		{
+			name:   "InvalidResponse",
+			script: `echo "not json"`,
+			failed: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			h := &uploadHook{conf: &config.UploadHookConfig{
+				Command: []string{"sh", "-c", test.script},
+				Timeout: time.Second * 5,
+			}}
+			annotations, err := h.run(localFilepath, "recordings/room.mp4", types.OutputTypeMP4)
+			switch {
+			case test.vetoed:
+				require.ErrorContains(t, err, "vetoed")
+				require.ErrorContains(t, err, "infected")
+			case test.failed:
+				require.Error(t, err)
+				require.NotContains(t, err.Error(), "vetoed")
+			default:
+				require.NoError(t, err)
+				require.Equal(t, test.annotations, annotations)
+			}
+		})
+	}
+}
+
+func TestUploadHookURL(t *testing.T) {
+	localFilepath := writeTestFile(t)
+
+	for _, test := range []struct {
+		name        string
+		status      int
+		response    string
+		annotations map[string]string
+		vetoed      bool
+		failed      bool
+	}{
+		{
+			name:        "Annotated",
+			status:      http.StatusOK,
+			response:    `{"annotations": {"scanned": "true"}}`,
+			annotations: map[string]string{"scanned": "true"},
+		},
+		{
+			name:     "Vetoed",
+			status:   http.StatusForbidden,
+			response: "infected",
+			vetoed:   true,
+		},
+		{
+			name:   "Unavailable",
+			status: http.StatusServiceUnavailable,
+			failed: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "video/mp4", r.Header.Get("Content-Type"))
+				require.Equal(t, "recordings/room.mp4", r.Header.Get("X-Egress-Storage-Path"))
+				require.Equal(t, "token", r.Header.Get("Authorization"))
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				require.Equal(t, "recording", string(body))
+
+				w.WriteHeader(test.status)
+				_, _ = w.Write([]byte(test.response))
+			}))
+			defer server.Close()
+
+			h := &uploadHook{
+				conf: &config.UploadHookConfig{
+					URL:     server.URL,
+					Headers: map[string]string{"Authorization": "token"},
+					Timeout: time.Second * 5,
+				},
+				client: server.Client(),
+			}
+			annotations, err := h.run(localFilepath, "recordings/room.mp4", types.OutputTypeMP4)
+			switch {
+			case test.vetoed:
+				require.ErrorContains(t, err, "vetoed")
+				require.ErrorContains(t, err, "infected")
+			case test.failed:
+				require.Error(t, err)
+				require.NotContains(t, err.Error(), "vetoed")
+			default:
+				require.NoError(t, err)
+				require.Equal(t, test.annotations, annotations)
+			}
+		})
+	}
+}
+
+func TestUploadHookVeto(t *testing.T) {
+	// vetoed files are not stored anywhere
+	primary := &testUploader{location: "s3://bucket"}
+	u := newTestUploader(primary)
+	u.SetHook(&config.UploadHookConfig{Command: []string{"false"}, Timeout: time.Second * 5})
+
+	_, _, err := u.Upload(writeTestFile(t), "recordings/room.mp4", types.OutputTypeMP4)
+	require.ErrorContains(t, err, "vetoed")
+	require.Equal(t, 0, primary.attempts)
+}
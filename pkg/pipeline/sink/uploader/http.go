@@ -0,0 +1,224 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+)
+
+type HTTPUploader struct {
+	conf    *config.HTTPUploadConfig
+	client  *http.Client
+	timeout time.Duration // of each upload, but not of chunked uploads
+}
+
+func newHTTPUploader(conf *config.HTTPUploadConfig) (uploader, error) {
+	return &HTTPUploader{
+		conf:   conf,
+		client: &http.Client{},
+	}, nil
+}
+
+func (u *HTTPUploader) upload(localFilepath, storageFilepath string, outputType types.OutputType, cacheControl string) (string, int64, error) {
+	stat, err := os.Stat(localFilepath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	url := u.getURL(storageFilepath)
+	retry, err := u.send(url, localFilepath, path.Base(storageFilepath), outputType, cacheControl)
+	if err != nil {
+		if !retry {
+			return "", 0, permanentError{err}
+		}
+		return "", 0, err
+	}
+
+	return url, stat.Size(), nil
+}
+
+func (u *HTTPUploader) setRequestTimeout(timeout time.Duration) {
+	u.timeout = timeout
+}
+
+func (u *HTTPUploader) getURL(storageFilepath string) string {
+	if strings.Contains(u.conf.URL, "{path}") {
+		return strings.ReplaceAll(u.conf.URL, "{path}", storageFilepath)
+	}
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(u.conf.URL, "/"), storageFilepath)
+}
+
+// send makes a single attempt, and returns whether the error can be retried
+func (u *HTTPUploader) send(url, localFilepath, filename string, outputType types.OutputType, cacheControl string) (bool, error) {
+	file, err := os.Open(localFilepath)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	ctx := context.Background()
+	if u.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.timeout)
+		defer cancel()
+	}
+
+	var req *http.Request
+	if u.conf.Method == http.MethodPost {
+		// stream the form, rather than buffering the whole file
+		pr, pw := io.Pipe()
+		mw := multipart.NewWriter(pw)
+		go func() {
+			part, err := mw.CreateFormFile(u.conf.FormField, filename)
+			if err == nil {
+				_, err = io.Copy(part, file)
+			}
+			if err == nil {
+				err = mw.Close()
+			}
+			_ = pw.CloseWithError(err)
+		}()
+
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, url, pr)
+		if err != nil {
+			_ = pr.Close()
+			return false, err
+		}
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+	} else {
+		stat, err := file.Stat()
+		if err != nil {
+			return false, err
+		}
+
+		req, err = http.NewRequestWithContext(ctx, http.MethodPut, url, file)
+		if err != nil {
+			return false, err
+		}
+		req.ContentLength = stat.Size()
+		req.Header.Set("Content-Type", string(outputType))
+	}
+	if cacheControl != "" {
+		req.Header.Set("Cache-Control", cacheControl)
+	}
+
+	for k, v := range u.conf.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err = fmt.Errorf("http upload failed: %s: %s", resp.Status, string(b))
+		return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+	}
+
+	return false, nil
+}
+
+// ChunkedUpload streams a file to http storage while it is being written, using chunked transfer encoding
+type ChunkedUpload struct {
+	pw   *io.PipeWriter
+	url  string
+	size int64
+	done chan struct{}
+	err  error
+}
+
+// StartChunkedUpload returns nil if files can't be streamed to the storage, in which case they should be uploaded once complete.
+// Files which need to be scanned, encrypted, copied or replicated are never streamed
+func (u *Uploader) StartChunkedUpload(storageFilepath string, outputType types.OutputType) *ChunkedUpload {
+	h, ok := u.uploader.(*HTTPUploader)
+	if !ok || h.conf.Method == http.MethodPost || u.hook != nil || u.publicKey != nil || u.localCopy != "" || len(u.replicas) > 0 {
+		return nil
+	}
+	contentType, cacheControl := u.getHeaders(storageFilepath, outputType)
+	return h.startChunkedUpload(storageFilepath, contentType, cacheControl)
+}
+
+func (u *HTTPUploader) startChunkedUpload(storageFilepath string, outputType types.OutputType, cacheControl string) *ChunkedUpload {
+	pr, pw := io.Pipe()
+	c := &ChunkedUpload{
+		pw:   pw,
+		url:  u.getURL(storageFilepath),
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(c.done)
+
+		// the body has no length, so it is sent in chunks
+		req, err := http.NewRequest(http.MethodPut, c.url, pr)
+		if err != nil {
+			c.err = err
+			_ = pr.CloseWithError(err)
+			return
+		}
+		req.Header.Set("Content-Type", string(outputType))
+		if cacheControl != "" {
+			req.Header.Set("Cache-Control", cacheControl)
+		}
+		for k, v := range u.conf.Headers {
+			req.Header.Set(k, v)
+		}
+
+		resp, err := u.client.Do(req)
+		if err != nil {
+			c.err = err
+			_ = pr.CloseWithError(err)
+			return
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			c.err = fmt.Errorf("http upload failed: %s: %s", resp.Status, string(b))
+		}
+		// unblocks writes if the server responded before the body was complete
+		_ = pr.CloseWithError(c.err)
+	}()
+
+	return c
+}
+
+func (c *ChunkedUpload) Write(b []byte) (int, error) {
+	n, err := c.pw.Write(b)
+	c.size += int64(n)
+	return n, err
+}
+
+// Close ends the body, and waits for the response
+func (c *ChunkedUpload) Close() (string, int64, error) {
+	_ = c.pw.Close()
+	<-c.done
+	if c.err != nil {
+		return "", 0, c.err
+	}
+	return c.url, c.size, nil
+}
+
+// Abort ends the request without completing the body
+func (c *ChunkedUpload) Abort(err error) {
+	_ = c.pw.CloseWithError(err)
+	<-c.done
+}
@@ -0,0 +1,116 @@
+package uploader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+)
+
+type LocalUploader struct {
+	conf *config.LocalConfig
+}
+
+func newLocalUploader(conf *config.LocalConfig) (uploader, error) {
+	return &LocalUploader{
+		conf: conf,
+	}, nil
+}
+
+// upload copies the file to a temporary name on the mount, syncs it, then renames it so that
+// readers never see partial files
+func (u *LocalUploader) upload(localFilepath, storageFilepath string, _ types.OutputType, _ string) (string, int64, error) {
+	src, err := os.Open(localFilepath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	stat, err := src.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+
+	destination, err := u.getDestination(storageFilepath)
+	if err != nil {
+		return "", 0, permanentError{err}
+	}
+	dir := path.Dir(destination)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, err
+	}
+
+	if err = u.checkFreeSpace(dir, stat.Size()); err != nil {
+		return "", 0, err
+	}
+
+	tmp := fmt.Sprintf("%s.tmp", destination)
+	dest, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", 0, err
+	}
+
+	size, err := io.Copy(dest, src)
+	if err == nil && size != stat.Size() {
+		err = fmt.Errorf("short write: %d of %d bytes", size, stat.Size())
+	}
+	if err == nil {
+		err = dest.Sync()
+	}
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return "", 0, err
+	}
+
+	if err = os.Rename(tmp, destination); err != nil {
+		_ = os.Remove(tmp)
+		return "", 0, err
+	}
+
+	// persist the rename
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+
+	return destination, size, nil
+}
+
+// getDestination returns the path of the file on the mount. Room names, identities and track IDs are
+// filled in after the filepath is cleaned, so paths which escape the mount through them are rejected
+func (u *LocalUploader) getDestination(storageFilepath string) (string, error) {
+	root := filepath.Clean(u.conf.Directory)
+	destination := filepath.Join(root, storageFilepath)
+
+	rel, err := filepath.Rel(root, destination)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("storage path %s is outside of %s", storageFilepath, root)
+	}
+	return destination, nil
+}
+
+func (u *LocalUploader) checkFreeSpace(dir string, size int64) error {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err != nil {
+		return err
+	}
+
+	available := int64(fs.Bavail) * fs.Bsize
+	required := size + u.conf.MinFreeSpace*1024*1024
+	if available < required {
+		return fmt.Errorf("not enough free space in %s: %d bytes available, %d required", dir, available, required)
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package uploader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+)
+
+func TestLocalDestination(t *testing.T) {
+	u := &LocalUploader{conf: &config.LocalConfig{Directory: "/mnt/recordings/"}}
+
+	for _, test := range []struct {
+		storageFilepath string
+		expected        string
+	}{
+		{"room/track.ogg", "/mnt/recordings/room/track.ogg"},
+		{"/room/track.ogg", "/mnt/recordings/room/track.ogg"},
+		{"room/../track.ogg", "/mnt/recordings/track.ogg"},
+		{"..room/track.ogg", "/mnt/recordings/..room/track.ogg"},
+		{"../track.ogg", ""},
+		{"room/../../etc/track.ogg", ""},
+		{"..", ""},
+		{"", ""},
+	} {
+		destination, err := u.getDestination(test.storageFilepath)
+		if test.expected == "" {
+			require.Error(t, err, test.storageFilepath)
+		} else {
+			require.NoError(t, err, test.storageFilepath)
+			require.Equal(t, test.expected, destination)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package uploader
+
+import (
+	"io"
+	"os"
+	"path"
+)
+
+// KeepLocalCopies persists a copy of each file under directory, whether or not its upload succeeds
+func (u *Uploader) KeepLocalCopies(directory string) {
+	if _, ok := u.uploader.(*noOpUploader); ok {
+		// files are not uploaded or removed
+		return
+	}
+	u.localCopy = directory
+}
+
+func (u *Uploader) keepLocalCopy(localFilepath, storageFilepath string) error {
+	destination := path.Join(u.localCopy, storageFilepath)
+	if err := os.MkdirAll(path.Dir(destination), 0755); err != nil {
+		return err
+	}
+
+	return linkOrCopy(localFilepath, destination)
+}
+
+// linkOrCopy replaces destination with a hard link to the local file when possible, since the local file is removed after the egress
+func linkOrCopy(localFilepath, destination string) error {
+	// playlists and manifests are uploaded more than once
+	_ = os.Remove(destination)
+
+	if err := os.Link(localFilepath, destination); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(localFilepath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	dest, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dest, src)
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
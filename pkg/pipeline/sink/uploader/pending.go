@@ -0,0 +1,138 @@
+package uploader
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+)
+
+const pendingUploadSuffix = ".upload.json"
+
+// PendingUpload is written next to a completed file before it is uploaded, and removed once the upload succeeds,
+// so that the upload can be resumed if the handler or service crashes in between
+type PendingUpload struct {
+	EgressID        string           `json:"egress_id"`
+	LocalFilepath   string           `json:"local_filepath"`
+	StorageFilepath string           `json:"storage_filepath"`
+	OutputType      types.OutputType `json:"output_type"`
+	Info            json.RawMessage  `json:"info"` // protojson EgressInfo at the time the file was completed
+
+	// one of
+	S3          *livekit.S3Upload         `json:"s3,omitempty"`
+	GCP         *livekit.GCPUpload        `json:"gcp,omitempty"`
+	Azure       *livekit.AzureBlobUpload  `json:"azure,omitempty"`
+	AliOSS      *livekit.AliOSSUpload     `json:"alioss,omitempty"`
+	Local       *config.LocalConfig       `json:"local,omitempty"`
+	GoogleDrive *config.GoogleDriveConfig `json:"google_drive,omitempty"`
+	Dropbox     *config.DropboxConfig     `json:"dropbox,omitempty"`
+	HTTP        *config.HTTPUploadConfig  `json:"http,omitempty"`
+}
+
+func NewPendingUpload(egressID, localFilepath, storageFilepath string, outputType types.OutputType, info json.RawMessage, conf interface{}) *PendingUpload {
+	p := &PendingUpload{
+		EgressID:        egressID,
+		LocalFilepath:   localFilepath,
+		StorageFilepath: storageFilepath,
+		OutputType:      outputType,
+		Info:            info,
+	}
+
+	switch c := conf.(type) {
+	case *livekit.S3Upload:
+		p.S3 = c
+	case *livekit.GCPUpload:
+		p.GCP = c
+	case *livekit.AzureBlobUpload:
+		p.Azure = c
+	case *livekit.AliOSSUpload:
+		p.AliOSS = c
+	case *config.LocalConfig:
+		p.Local = c
+	case *config.GoogleDriveConfig:
+		p.GoogleDrive = c
+	case *config.DropboxConfig:
+		p.Dropbox = c
+	case *config.HTTPUploadConfig:
+		p.HTTP = c
+	}
+
+	return p
+}
+
+// UploadConfig returns the storage the file was going to be uploaded to, for use with New
+func (p *PendingUpload) UploadConfig() interface{} {
+	switch {
+	case p.S3 != nil:
+		return p.S3
+	case p.GCP != nil:
+		return p.GCP
+	case p.Azure != nil:
+		return p.Azure
+	case p.AliOSS != nil:
+		return p.AliOSS
+	case p.Local != nil:
+		return p.Local
+	case p.GoogleDrive != nil:
+		return p.GoogleDrive
+	case p.Dropbox != nil:
+		return p.Dropbox
+	case p.HTTP != nil:
+		return p.HTTP
+	default:
+		return nil
+	}
+}
+
+// Write stores the pending upload next to the local file. It contains storage credentials, so it is only readable by the owner
+func (p *PendingUpload) Write() error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	tmp := p.LocalFilepath + pendingUploadSuffix + ".tmp"
+	if err = os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.LocalFilepath+pendingUploadSuffix)
+}
+
+// Remove deletes the pending upload once the file has been uploaded
+func (p *PendingUpload) Remove() error {
+	if err := os.Remove(p.LocalFilepath + pendingUploadSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// FindPendingUploads returns the pending uploads in the egress directories under dir.
+// Unreadable files are returned as errors alongside the uploads which could be read
+func FindPendingUploads(dir string) ([]*PendingUpload, []error) {
+	matches, err := filepath.Glob(path.Join(dir, "*", "*"+pendingUploadSuffix))
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var pending []*PendingUpload
+	var errs []error
+	for _, match := range matches {
+		b, err := os.ReadFile(match)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		p := &PendingUpload{}
+		if err = json.Unmarshal(b, p); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		pending = append(pending, p)
+	}
+
+	return pending, errs
+}
@@ -0,0 +1,73 @@
+package uploader
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+)
+
+func TestPendingUpload(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		conf interface{}
+	}{
+		{"S3", &livekit.S3Upload{AccessKey: "key", Secret: "secret", Bucket: "bucket", Region: "us-east-1"}},
+		{"GCP", &livekit.GCPUpload{Credentials: "{}", Bucket: "bucket"}},
+		{"Azure", &livekit.AzureBlobUpload{AccountName: "account", AccountKey: "key", ContainerName: "container"}},
+		{"AliOSS", &livekit.AliOSSUpload{AccessKey: "key", Secret: "secret", Bucket: "bucket", Endpoint: "oss-cn-hangzhou.aliyuncs.com"}},
+		{"Local", &config.LocalConfig{Directory: "/mnt/recordings"}},
+		{"HTTP", &config.HTTPUploadConfig{URL: "https://ingest.example.com/upload"}},
+		{"None", nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			localFilepath := path.Join(dir, "EG_pending", "room.mp4")
+			require.NoError(t, os.MkdirAll(path.Dir(localFilepath), 0755))
+
+			p := NewPendingUpload("EG_pending", localFilepath, "recordings/room.mp4", types.OutputTypeMP4, []byte(`{"egressId":"EG_pending"}`), test.conf)
+			require.NoError(t, p.Write())
+
+			// storage credentials are only readable by the owner
+			stat, err := os.Stat(localFilepath + pendingUploadSuffix)
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+
+			pending, errs := FindPendingUploads(dir)
+			require.Empty(t, errs)
+			require.Len(t, pending, 1)
+			require.Equal(t, p.StorageFilepath, pending[0].StorageFilepath)
+			require.Equal(t, p.OutputType, pending[0].OutputType)
+			require.JSONEq(t, string(p.Info), string(pending[0].Info))
+			if test.conf == nil {
+				require.Nil(t, pending[0].UploadConfig())
+			} else {
+				require.Equal(t, test.conf, pending[0].UploadConfig())
+			}
+
+			require.NoError(t, pending[0].Remove())
+			require.NoError(t, pending[0].Remove())
+			pending, _ = FindPendingUploads(dir)
+			require.Empty(t, pending)
+		})
+	}
+}
+
+func TestFindPendingUploadsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(path.Join(dir, "EG_valid"), 0755))
+	require.NoError(t, os.MkdirAll(path.Join(dir, "EG_invalid"), 0755))
+	require.NoError(t, NewPendingUpload("EG_valid", path.Join(dir, "EG_valid", "room.mp4"), "room.mp4", types.OutputTypeMP4, nil, nil).Write())
+	require.NoError(t, os.WriteFile(path.Join(dir, "EG_invalid", "room.mp4"+pendingUploadSuffix), []byte("{"), 0600))
+
+	// unreadable files are returned as errors alongside the valid uploads
+	pending, errs := FindPendingUploads(dir)
+	require.Len(t, pending, 1)
+	require.Equal(t, "EG_valid", pending[0].EgressID)
+	require.Len(t, errs, 1)
+}
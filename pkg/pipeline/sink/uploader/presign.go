@@ -0,0 +1,47 @@
+package uploader
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+var errPresignNotSupported = errors.New("presigned urls are only supported for s3 and alioss uploads")
+
+type presigner interface {
+	presign(storageFilepath string, expiry time.Duration) (string, error)
+}
+
+// CanPresign returns true if the storage supports presigned download urls
+func (u *Uploader) CanPresign() bool {
+	_, ok := u.uploader.(presigner)
+	return ok
+}
+
+// Presign returns a url which can be used to download a stored file until it expires
+func (u *Uploader) Presign(storageFilepath string, expiry time.Duration) (string, error) {
+	p, ok := u.uploader.(presigner)
+	if !ok {
+		return "", errPresignNotSupported
+	}
+	return p.presign(storageFilepath, expiry)
+}
+
+func (u *S3Uploader) presign(storageFilepath string, expiry time.Duration) (string, error) {
+	sess, err := u.newSession()
+	if err != nil {
+		return "", err
+	}
+
+	req, _ := s3.New(sess).GetObjectRequest(&s3.GetObjectInput{
+		Bucket: u.bucket,
+		Key:    &storageFilepath,
+	})
+	return req.Presign(expiry)
+}
+
+func (u *AliOSSUploader) presign(storageFilepath string, expiry time.Duration) (string, error) {
+	return u.bucket.SignURL(storageFilepath, oss.HTTPGet, int64(expiry.Seconds()))
+}
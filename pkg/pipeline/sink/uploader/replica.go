@@ -0,0 +1,116 @@
+package uploader
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+)
+
+// replica is an additional storage every file is uploaded to
+type replica struct {
+	uploader
+	required bool
+
+	mu     sync.Mutex
+	status ReplicaStatus
+}
+
+// ReplicaStatus counts the files uploaded to a replica, and is listed in the manifest
+type ReplicaStatus struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required,omitempty"`
+	Uploaded int    `json:"uploaded"`
+	Failed   int    `json:"failed"`
+	Error    string `json:"error,omitempty"` // the last failure
+}
+
+// SetReplicas uploads every file to each replica as well as to the output storage
+func (u *Uploader) SetReplicas(conf []config.UploadReplicaConfig) error {
+	for i := range conf {
+		r, err := newUploader(conf[i].GetUploadConfig())
+		if err != nil {
+			return err
+		}
+		u.replicas = append(u.replicas, &replica{
+			uploader: r,
+			required: conf[i].Required,
+			status:   ReplicaStatus{Name: conf[i].Name, Required: conf[i].Required},
+		})
+	}
+	return nil
+}
+
+// backends returns the output storage followed by each replica
+func (u *Uploader) backends() []uploader {
+	backends := []uploader{u.uploader}
+	for _, r := range u.replicas {
+		backends = append(backends, r.uploader)
+	}
+	return backends
+}
+
+// uploadReplicas uploads the file to every replica at once
+func (u *Uploader) uploadReplicas(
+	localFilepath, storageFilepath string,
+	contentType types.OutputType,
+	cacheControl string,
+	annotations map[string]string,
+) {
+	var wg sync.WaitGroup
+	for _, r := range u.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			_, _, err := u.retry.store(r.uploader, localFilepath, storageFilepath, contentType, cacheControl, annotations)
+
+			r.mu.Lock()
+			if err != nil {
+				r.status.Failed++
+				r.status.Error = err.Error()
+			} else {
+				r.status.Uploaded++
+			}
+			r.mu.Unlock()
+
+			if err != nil {
+				u.logger.Warnw("replica upload failed", err, "replica", r.status.Name, "required", r.required, "path", storageFilepath)
+			}
+		}(r)
+	}
+	wg.Wait()
+}
+
+// RequiredReplicaError returns an error if an upload to a required replica has failed so far
+func (u *Uploader) RequiredReplicaError() error {
+	for _, r := range u.replicas {
+		if !r.required {
+			continue
+		}
+
+		r.mu.Lock()
+		failed, last := r.status.Failed, r.status.Error
+		r.mu.Unlock()
+		if failed > 0 {
+			return fmt.Errorf("required replica %s: %d uploads failed, last: %s", r.status.Name, failed, last)
+		}
+	}
+	return nil
+}
+
+// ReplicaStatus returns the uploads to each replica so far
+func (u *Uploader) ReplicaStatus() []*ReplicaStatus {
+	if len(u.replicas) == 0 {
+		return nil
+	}
+
+	status := make([]*ReplicaStatus, 0, len(u.replicas))
+	for _, r := range u.replicas {
+		r.mu.Lock()
+		s := r.status
+		r.mu.Unlock()
+		status = append(status, &s)
+	}
+	return status
+}
@@ -0,0 +1,86 @@
+package uploader
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/logger"
+)
+
+// testUploader fails the first failures uploads with err, and then stores files at location
+type testUploader struct {
+	mu       sync.Mutex
+	location string
+	err      error
+	failures int
+	attempts int
+}
+
+func (u *testUploader) upload(localFilepath, storageFilepath string, _ types.OutputType, _ string) (string, int64, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.attempts++
+	if u.attempts <= u.failures {
+		return "", 0, u.err
+	}
+	stat, err := os.Stat(localFilepath)
+	if err != nil {
+		return "", 0, err
+	}
+	return u.location + "/" + storageFilepath, stat.Size(), nil
+}
+
+func newTestUploader(primary uploader) *Uploader {
+	return &Uploader{
+		uploader: primary,
+		retry:    retryPolicy{multiplier: 2},
+		logger:   logger.GetLogger(),
+	}
+}
+
+func writeTestFile(t *testing.T) string {
+	localFilepath := path.Join(t.TempDir(), "room.mp4")
+	require.NoError(t, os.WriteFile(localFilepath, []byte("recording"), 0644))
+	return localFilepath
+}
+
+func TestRequiredReplica(t *testing.T) {
+	u := newTestUploader(&testUploader{location: "s3://primary"})
+	u.replicas = []*replica{
+		{
+			uploader: &testUploader{location: "gs://required", err: errors.New("forbidden"), failures: 1},
+			required: true,
+			status:   ReplicaStatus{Name: "required", Required: true},
+		},
+		{
+			uploader: &testUploader{location: "az://optional", err: errors.New("timeout"), failures: 2},
+			status:   ReplicaStatus{Name: "optional"},
+		},
+	}
+	localFilepath := writeTestFile(t)
+
+	// replica failures do not replace the output storage's location
+	location, size, err := u.Upload(localFilepath, "recordings/room.mp4", types.OutputTypeMP4)
+	require.NoError(t, err)
+	require.Equal(t, "s3://primary/recordings/room.mp4", location)
+	require.Equal(t, int64(9), size)
+	require.ErrorContains(t, u.RequiredReplicaError(), "required replica required")
+
+	_, _, err = u.Upload(localFilepath, "recordings/room.mp4.json", types.OutputTypeJSON)
+	require.NoError(t, err)
+	require.Equal(t, []*ReplicaStatus{
+		{Name: "required", Required: true, Uploaded: 1, Failed: 1, Error: "forbidden"},
+		{Name: "optional", Failed: 2, Error: "timeout"},
+	}, u.ReplicaStatus())
+
+	// optional replicas are only listed in the manifest
+	u.replicas = u.replicas[1:]
+	require.NoError(t, u.RequiredReplicaError())
+}
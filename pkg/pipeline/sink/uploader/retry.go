@@ -0,0 +1,139 @@
+package uploader
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/logging"
+	"github.com/livekit/egress/pkg/types"
+)
+
+var (
+	promUploadRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "livekit",
+		Subsystem: "egress",
+		Name:      "upload_retries",
+	}, []string{"storage"})
+	promUploadFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "livekit",
+		Subsystem: "egress",
+		Name:      "upload_failures",
+	}, []string{"storage"})
+	registerMetrics sync.Once
+)
+
+// retryPolicy is used for every storage, in place of the retries of each SDK
+type retryPolicy struct {
+	maxRetries int
+	minDelay   time.Duration
+	maxDelay   time.Duration
+	multiplier float64
+}
+
+var defaultRetryPolicy = retryPolicy{
+	maxRetries: maxRetries,
+	minDelay:   minDelay,
+	maxDelay:   maxDelay,
+	multiplier: 2,
+}
+
+// permanentError is returned by storage for failures which would not succeed on retry
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+// requestTimeout is implemented by storage which can limit how long each request takes
+type requestTimeout interface {
+	setRequestTimeout(time.Duration)
+}
+
+// SetRetry sets the retries and backoff of uploads to every storage, and the deadline of each request to storage which supports it
+func (u *Uploader) SetRetry(conf *config.UploadRetryConfig) {
+	registerMetrics.Do(func() {
+		prometheus.MustRegister(promUploadRetries, promUploadFailures)
+	})
+
+	if conf.MaxRetries > 0 {
+		u.retry.maxRetries = conf.MaxRetries
+	}
+	if conf.MinDelay > 0 {
+		u.retry.minDelay = conf.MinDelay
+	}
+	if conf.MaxDelay > 0 {
+		u.retry.maxDelay = conf.MaxDelay
+	}
+	if conf.Multiplier >= 1 {
+		u.retry.multiplier = conf.Multiplier
+	}
+	if conf.RequestTimeout > 0 {
+		for _, b := range u.backends() {
+			if t, ok := b.(requestTimeout); ok {
+				t.setRequestTimeout(conf.RequestTimeout)
+			}
+		}
+	}
+}
+
+// store uploads to a single storage, retrying failed attempts
+func (r retryPolicy) store(
+	i uploader,
+	localFilepath, storageFilepath string,
+	contentType types.OutputType,
+	cacheControl string,
+	annotations map[string]string,
+) (string, int64, error) {
+	storage := storageName(i)
+	delay := r.minDelay
+	for attempt := 0; ; attempt++ {
+		location, size, err := store(i, localFilepath, storageFilepath, contentType, cacheControl, annotations)
+		if err == nil {
+			return location, size, nil
+		}
+
+		var permanent permanentError
+		if errors.As(err, &permanent) || errors.Is(err, os.ErrNotExist) || attempt >= r.maxRetries {
+			promUploadFailures.WithLabelValues(storage).Inc()
+			return "", 0, err
+		}
+
+		logging.Logger(logging.Upload).Debugw("upload failed, retrying", "error", err,
+			"storage", storage, "path", storageFilepath, "attempt", attempt+1, "delay", delay)
+		promUploadRetries.WithLabelValues(storage).Inc()
+		time.Sleep(delay)
+		if delay = time.Duration(float64(delay) * r.multiplier); delay > r.maxDelay {
+			delay = r.maxDelay
+		}
+	}
+}
+
+func storageName(i uploader) string {
+	switch i.(type) {
+	case *S3Uploader:
+		return "s3"
+	case *GCPUploader:
+		return "gcp"
+	case *AzureUploader:
+		return "azure"
+	case *AliOSSUploader:
+		return "alioss"
+	case *LocalUploader:
+		return "local"
+	case *GoogleDriveUploader:
+		return "google_drive"
+	case *DropboxUploader:
+		return "dropbox"
+	case *HTTPUploader:
+		return "http_upload"
+	default:
+		return "none"
+	}
+}
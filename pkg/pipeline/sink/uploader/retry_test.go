@@ -0,0 +1,80 @@
+package uploader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/types"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	localFilepath := writeTestFile(t)
+	policy := retryPolicy{
+		maxRetries: 2,
+		minDelay:   time.Millisecond,
+		maxDelay:   time.Millisecond * 2,
+		multiplier: 2,
+	}
+
+	for _, test := range []struct {
+		name     string
+		err      error
+		failures int
+		attempts int
+		location string
+	}{
+		{
+			name:     "Succeeds",
+			attempts: 1,
+			location: "s3://bucket/room.mp4",
+		},
+		{
+			name:     "SucceedsOnRetry",
+			err:      errors.New("timeout"),
+			failures: 2,
+			attempts: 3,
+			location: "s3://bucket/room.mp4",
+		},
+		{
+			name:     "RetriesExhausted",
+			err:      errors.New("timeout"),
+			failures: 3,
+			attempts: 3,
+		},
+		{
+			name:     "Permanent",
+			err:      permanentError{errors.New("forbidden")},
+			failures: 3,
+			attempts: 1,
+		},
+		{
+			name:     "WrappedPermanent",
+			err:      fmt.Errorf("upload failed: %w", permanentError{errors.New("forbidden")}),
+			failures: 3,
+			attempts: 1,
+		},
+		{
+			name:     "FileNotFound",
+			err:      os.ErrNotExist,
+			failures: 3,
+			attempts: 1,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			u := &testUploader{location: "s3://bucket", err: test.err, failures: test.failures}
+			location, _, err := policy.store(u, localFilepath, "room.mp4", types.OutputTypeMP4, "", nil)
+			require.Equal(t, test.attempts, u.attempts)
+			if test.location == "" {
+				require.ErrorIs(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, test.location, location)
+			}
+		})
+	}
+}
@@ -2,34 +2,47 @@ package uploader
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/logging"
 	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
-	"github.com/livekit/protocol/logger"
 	"github.com/livekit/psrpc"
 )
 
 const (
 	getBucketLocationRegion = "us-east-1"
+	stsRegion               = "us-east-1"
 )
 
 type S3Uploader struct {
+	mu        sync.Mutex
 	awsConfig *aws.Config
 	bucket    *string
 	metadata  map[string]*string
 	tagging   *string
+	multipart *config.S3MultipartConfig
+	sse       *string // ServerSideEncryption header
+	sseKeyID  *string // SSEKMSKeyId header
+	class     *string // StorageClass header
+	acl       *string // canned ACL header
 }
 
 func newS3Uploader(conf *livekit.S3Upload) (uploader, error) {
 	awsConfig := &aws.Config{
-		MaxRetries:       aws.Int(maxRetries), // Switching to v2 of the aws Go SDK would allow to set a maxDelay as well.
+		MaxRetries:       aws.Int(0), // retried by the uploader
 		S3ForcePathStyle: aws.Bool(conf.ForcePathStyle),
 	}
 	if conf.AccessKey != "" && conf.Secret != "" {
@@ -42,21 +55,12 @@ func newS3Uploader(conf *livekit.S3Upload) (uploader, error) {
 		awsConfig.Region = aws.String(conf.Region)
 	}
 
+	// without a region, the bucket location is retrieved by init, once the credentials have been configured
 	u := &S3Uploader{
 		awsConfig: awsConfig,
 		bucket:    aws.String(conf.Bucket),
 	}
 
-	if u.awsConfig.Region == nil {
-		region, err := u.getBucketLocation()
-		if err != nil {
-			return nil, err
-		}
-
-		logger.Infow("retrieved bucket location", "bucket", u.bucket, "location", region)
-		u.awsConfig.Region = aws.String(region)
-	}
-
 	if len(conf.Metadata) > 0 {
 		u.metadata = make(map[string]*string, len(conf.Metadata))
 		for k, v := range conf.Metadata {
@@ -72,10 +76,143 @@ func newS3Uploader(conf *livekit.S3Upload) (uploader, error) {
 	return u, nil
 }
 
+func (u *S3Uploader) setRequestTimeout(timeout time.Duration) {
+	u.awsConfig.HTTPClient = &http.Client{Timeout: timeout}
+}
+
+// SetS3SSE adds server-side encryption headers to s3 uploads
+func (u *Uploader) SetS3SSE(conf *config.S3SSEConfig) {
+	for _, b := range u.backends() {
+		if s, ok := b.(*S3Uploader); ok {
+			s.setSSE(conf)
+		}
+	}
+}
+
+func (s *S3Uploader) setSSE(conf *config.S3SSEConfig) {
+	switch conf.Type {
+	case config.S3SSETypeS3:
+		s.sse = aws.String(s3.ServerSideEncryptionAes256)
+	case config.S3SSETypeKMS:
+		s.sse = aws.String(s3.ServerSideEncryptionAwsKms)
+		if conf.KMSKeyID != "" {
+			s.sseKeyID = aws.String(conf.KMSKeyID)
+		}
+	}
+}
+
+// SetS3Object sets the storage class, acl and tags of s3 uploads. Tags from the request take precedence
+func (u *Uploader) SetS3Object(conf *config.S3ObjectConfig) {
+	for _, b := range u.backends() {
+		if s, ok := b.(*S3Uploader); ok {
+			s.setObject(conf)
+		}
+	}
+}
+
+func (s *S3Uploader) setObject(conf *config.S3ObjectConfig) {
+	if conf.StorageClass != "" {
+		s.class = aws.String(conf.StorageClass)
+	}
+	if conf.ACL != "" {
+		s.acl = aws.String(conf.ACL)
+	}
+	if len(conf.Tags) > 0 {
+		tags := url.Values{}
+		if s.tagging != nil {
+			if requested, err := url.ParseQuery(*s.tagging); err == nil {
+				tags = requested
+			}
+		}
+		for k, v := range conf.Tags {
+			if _, ok := tags[k]; !ok {
+				tags.Set(k, v)
+			}
+		}
+		s.tagging = aws.String(tags.Encode())
+	}
+}
+
+// SetS3AssumeRole uploads with temporary credentials of the role configured for the bucket, if any.
+// The credentials of the request, or of the node, are used to assume the role
+func (u *Uploader) SetS3AssumeRole(roles []config.S3AssumeRoleConfig) error {
+	for _, b := range u.backends() {
+		if s, ok := b.(*S3Uploader); ok {
+			if err := s.setAssumeRole(roles); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *S3Uploader) setAssumeRole(roles []config.S3AssumeRoleConfig) error {
+	var role *config.S3AssumeRoleConfig
+	for i := range roles {
+		if roles[i].Bucket == *s.bucket {
+			role = &roles[i]
+			break
+		}
+		if roles[i].Bucket == "" && role == nil {
+			role = &roles[i]
+		}
+	}
+	if role == nil {
+		return nil
+	}
+
+	// sts is not reached through custom s3 endpoints
+	region := aws.String(stsRegion)
+	if s.awsConfig.Region != nil {
+		region = s.awsConfig.Region
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: s.awsConfig.Credentials,
+		Region:      region,
+		MaxRetries:  aws.Int(maxRetries),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.awsConfig.Credentials = stscreds.NewCredentials(sess, role.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = role.SessionName
+		p.Duration = role.Duration
+		if role.ExternalID != "" {
+			p.ExternalID = aws.String(role.ExternalID)
+		}
+	})
+	return nil
+}
+
+func (u *S3Uploader) init() error {
+	_, err := u.newSession()
+	return err
+}
+
+// newSession retrieves the bucket location the first time it is needed
+func (u *S3Uploader) newSession() (*session.Session, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.awsConfig.Region == nil {
+		region, err := u.getBucketLocation()
+		if err != nil {
+			return nil, err
+		}
+
+		logging.Logger(logging.Upload).Infow("retrieved bucket location", "bucket", u.bucket, "location", region)
+		u.awsConfig.Region = aws.String(region)
+	}
+
+	return session.NewSession(u.awsConfig)
+}
+
 func (u *S3Uploader) getBucketLocation() (string, error) {
-	u.awsConfig.Region = aws.String(getBucketLocationRegion)
+	awsConfig := u.awsConfig.Copy()
+	awsConfig.Region = aws.String(getBucketLocationRegion)
 
-	sess, err := session.NewSession(u.awsConfig)
+	sess, err := session.NewSession(awsConfig)
 	if err != nil {
 		return "", err
 	}
@@ -97,8 +234,34 @@ func (u *S3Uploader) getBucketLocation() (string, error) {
 	return *resp.LocationConstraint, nil
 }
 
-func (u *S3Uploader) upload(localFilepath, storageFilepath string, outputType types.OutputType) (string, int64, error) {
-	sess, err := session.NewSession(u.awsConfig)
+func (u *S3Uploader) upload(localFilepath, storageFilepath string, outputType types.OutputType, cacheControl string) (string, int64, error) {
+	return u.uploadWithMetadata(localFilepath, storageFilepath, outputType, cacheControl, nil)
+}
+
+// uploadWithMetadata adds annotations to the request metadata
+func (u *S3Uploader) uploadWithMetadata(
+	localFilepath, storageFilepath string,
+	outputType types.OutputType,
+	cacheControl string,
+	annotations map[string]string,
+) (string, int64, error) {
+	metadata := u.metadata
+	if len(annotations) > 0 {
+		metadata = make(map[string]*string, len(u.metadata)+len(annotations))
+		for k, v := range u.metadata {
+			metadata[k] = v
+		}
+		for k, v := range annotations {
+			metadata[k] = aws.String(v)
+		}
+	}
+
+	var cacheControlHeader *string
+	if cacheControl != "" {
+		cacheControlHeader = aws.String(cacheControl)
+	}
+
+	sess, err := u.newSession()
 	if err != nil {
 		return "", 0, err
 	}
@@ -116,13 +279,27 @@ func (u *S3Uploader) upload(localFilepath, storageFilepath string, outputType ty
 		return "", 0, err
 	}
 
+	if u.multipart != nil && stat.Size() > u.multipart.PartSize<<20 {
+		err = u.uploadMultipart(s3.New(sess), file, stat, storageFilepath, outputType, cacheControlHeader, metadata)
+		if err != nil {
+			return "", 0, err
+		}
+		return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", *u.bucket, storageFilepath), stat.Size(), nil
+	}
+
 	_, err = s3manager.NewUploader(sess).Upload(&s3manager.UploadInput{
-		Body:        file,
-		Bucket:      u.bucket,
-		ContentType: aws.String(string(outputType)),
-		Key:         aws.String(storageFilepath),
-		Metadata:    u.metadata,
-		Tagging:     u.tagging,
+		Body:         file,
+		Bucket:       u.bucket,
+		ContentType:  aws.String(string(outputType)),
+		CacheControl: cacheControlHeader,
+		Key:          aws.String(storageFilepath),
+		Metadata:     metadata,
+		Tagging:      u.tagging,
+
+		ServerSideEncryption: u.sse,
+		SSEKMSKeyId:          u.sseKeyID,
+		StorageClass:         u.class,
+		ACL:                  u.acl,
 	})
 	if err != nil {
 		return "", 0, err
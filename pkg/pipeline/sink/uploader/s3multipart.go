@@ -0,0 +1,254 @@
+package uploader
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/logging"
+	"github.com/livekit/egress/pkg/types"
+)
+
+const (
+	s3CheckpointSuffix = ".s3parts.json"
+	s3MaxParts         = 10000
+)
+
+// SetS3Multipart uploads s3 files larger than one part in checkpointed parts
+func (u *Uploader) SetS3Multipart(conf *config.S3MultipartConfig) {
+	for _, b := range u.backends() {
+		if s, ok := b.(*S3Uploader); ok {
+			s.multipart = conf
+		}
+	}
+}
+
+// s3Checkpoint is written next to the local file after each completed part, and removed once the upload completes
+type s3Checkpoint struct {
+	UploadID string         `json:"upload_id"`
+	Bucket   string         `json:"bucket"`
+	Key      string         `json:"key"`
+	Size     int64          `json:"size"`
+	ModTime  int64          `json:"mod_time"` // unix ns, so that a rewritten file is never resumed
+	PartSize int64          `json:"part_size"`
+	Parts    []s3PartResult `json:"parts"`
+}
+
+type s3PartResult struct {
+	Number int64  `json:"number"`
+	ETag   string `json:"etag"`
+}
+
+// s3PartSize returns the smallest multiple of partSize which fits the file in s3MaxParts parts
+func s3PartSize(size, partSize int64) int64 {
+	for (size+partSize-1)/partSize > s3MaxParts {
+		partSize *= 2
+	}
+	return partSize
+}
+
+func (c *s3Checkpoint) partCount() int64 {
+	return (c.Size + c.PartSize - 1) / c.PartSize
+}
+
+func (c *s3Checkpoint) write(filename string) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	tmp := filename + ".tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+func readS3Checkpoint(filename string) (*s3Checkpoint, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	c := &s3Checkpoint{}
+	return c, json.Unmarshal(b, c)
+}
+
+// uploadMultipart uploads the missing parts of the file, resuming from its checkpoint if there is one
+func (u *S3Uploader) uploadMultipart(
+	svc *s3.S3,
+	file *os.File,
+	stat os.FileInfo,
+	storageFilepath string,
+	outputType types.OutputType,
+	cacheControl *string,
+	metadata map[string]*string,
+) error {
+	log := logging.Logger(logging.Upload).WithValues("path", storageFilepath)
+	checkpointPath := file.Name() + s3CheckpointSuffix
+
+	c, err := u.resume(svc, checkpointPath, storageFilepath, stat)
+	if err != nil {
+		// the checkpoint is kept for the next attempt
+		return err
+	}
+	if c == nil {
+		out, err := svc.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+			Bucket:       u.bucket,
+			Key:          aws.String(storageFilepath),
+			ContentType:  aws.String(string(outputType)),
+			CacheControl: cacheControl,
+			Metadata:     metadata,
+			Tagging:      u.tagging,
+
+			ServerSideEncryption: u.sse,
+			SSEKMSKeyId:          u.sseKeyID,
+			StorageClass:         u.class,
+			ACL:                  u.acl,
+		})
+		if err != nil {
+			return err
+		}
+		c = &s3Checkpoint{
+			UploadID: aws.StringValue(out.UploadId),
+			Bucket:   *u.bucket,
+			Key:      storageFilepath,
+			Size:     stat.Size(),
+			ModTime:  stat.ModTime().UnixNano(),
+			PartSize: s3PartSize(stat.Size(), u.multipart.PartSize<<20),
+		}
+		if err = c.write(checkpointPath); err != nil {
+			return err
+		}
+	} else {
+		log.Infow("resuming upload", "completedParts", len(c.Parts), "parts", c.partCount())
+	}
+
+	completed := make(map[int64]bool, len(c.Parts))
+	for _, p := range c.Parts {
+		completed[p.Number] = true
+	}
+	parts := make(chan int64, c.partCount())
+	for n := int64(1); n <= c.partCount(); n++ {
+		if !completed[n] {
+			parts <- n
+		}
+	}
+	close(parts)
+
+	var mu sync.Mutex
+	var uploadErr error
+	var wg sync.WaitGroup
+	for i := 0; i < u.multipart.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range parts {
+				offset := (n - 1) * c.PartSize
+				length := c.PartSize
+				if offset+length > c.Size {
+					length = c.Size - offset
+				}
+
+				out, err := svc.UploadPart(&s3.UploadPartInput{
+					Bucket:        u.bucket,
+					Key:           aws.String(storageFilepath),
+					UploadId:      aws.String(c.UploadID),
+					PartNumber:    aws.Int64(n),
+					Body:          io.NewSectionReader(file, offset, length),
+					ContentLength: aws.Int64(length),
+				})
+
+				mu.Lock()
+				if err == nil {
+					c.Parts = append(c.Parts, s3PartResult{Number: n, ETag: aws.StringValue(out.ETag)})
+					err = c.write(checkpointPath)
+				}
+				if err != nil && uploadErr == nil {
+					uploadErr = err
+				}
+				failed := uploadErr != nil
+				mu.Unlock()
+				if failed {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if uploadErr != nil {
+		return uploadErr
+	}
+
+	sort.Slice(c.Parts, func(i, j int) bool { return c.Parts[i].Number < c.Parts[j].Number })
+	completedParts := make([]*s3.CompletedPart, 0, len(c.Parts))
+	for _, p := range c.Parts {
+		completedParts = append(completedParts, &s3.CompletedPart{
+			ETag:       aws.String(p.ETag),
+			PartNumber: aws.Int64(p.Number),
+		})
+	}
+	_, err = svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          u.bucket,
+		Key:             aws.String(storageFilepath),
+		UploadId:        aws.String(c.UploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completedParts},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(checkpointPath); err != nil {
+		log.Warnw("failed to remove upload checkpoint", err)
+	}
+	return nil
+}
+
+// resume returns the checkpoint of an earlier attempt to upload the same file, with only the parts still stored by s3.
+// It returns nil if the upload needs to start over
+func (u *S3Uploader) resume(svc *s3.S3, checkpointPath, storageFilepath string, stat os.FileInfo) (*s3Checkpoint, error) {
+	c, err := readS3Checkpoint(checkpointPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logging.Logger(logging.Upload).Warnw("could not read upload checkpoint", err, "path", storageFilepath)
+		}
+		return nil, nil
+	}
+	if c.Bucket != *u.bucket || c.Key != storageFilepath || c.Size != stat.Size() || c.ModTime != stat.ModTime().UnixNano() {
+		return nil, nil
+	}
+
+	stored := make(map[int64]string)
+	err = svc.ListPartsPages(&s3.ListPartsInput{
+		Bucket:   u.bucket,
+		Key:      aws.String(storageFilepath),
+		UploadId: aws.String(c.UploadID),
+	}, func(page *s3.ListPartsOutput, _ bool) bool {
+		for _, p := range page.Parts {
+			stored[aws.Int64Value(p.PartNumber)] = aws.StringValue(p.ETag)
+		}
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchUpload {
+			// aborted, or already completed
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	parts := c.Parts[:0]
+	for _, p := range c.Parts {
+		if stored[p.Number] == p.ETag {
+			parts = append(parts, p)
+		}
+	}
+	c.Parts = parts
+	return c, nil
+}
@@ -0,0 +1,60 @@
+package uploader
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+)
+
+// SetSpool keeps files which could not be uploaded in the spool directory with a pending upload, instead of failing
+// or moving them to backup storage, so that the upload can be completed by the service or reconcile-uploads
+func (u *Uploader) SetSpool(conf *config.UploadSpoolConfig, info *livekit.EgressInfo) {
+	if _, ok := u.uploader.(*noOpUploader); ok {
+		// files are not uploaded or removed
+		return
+	}
+	u.spool = conf.Directory
+	u.info = info
+}
+
+// spoolFile links or copies the file into the egress directory of the spool, and returns its location
+func (u *Uploader) spoolFile(localFilepath, storageFilepath string, outputType types.OutputType) (string, int64, error) {
+	stat, err := os.Stat(localFilepath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	dir := path.Join(u.spool, u.info.EgressId)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, err
+	}
+
+	// playlists and manifests are spooled more than once, replacing the earlier version
+	spooled := path.Join(dir, strings.ReplaceAll(strings.TrimPrefix(storageFilepath, "/"), "/", "_"))
+	if err = linkOrCopy(localFilepath, spooled); err != nil {
+		return "", 0, err
+	}
+
+	info, err := protojson.Marshal(u.info)
+	if err != nil {
+		return "", 0, err
+	}
+	pending := NewPendingUpload(u.info.EgressId, spooled, storageFilepath, outputType, info, u.conf)
+	if err = pending.Write(); err != nil {
+		_ = os.Remove(spooled)
+		return "", 0, err
+	}
+
+	return spooled, stat.Size(), nil
+}
+
+// IsSpooled returns true if the location returned by Upload is in the spool
+func (u *Uploader) IsSpooled(location string) bool {
+	return u.spool != "" && strings.HasPrefix(location, u.spool)
+}
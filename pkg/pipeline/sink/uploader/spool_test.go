@@ -0,0 +1,61 @@
+package uploader
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+)
+
+func TestSpool(t *testing.T) {
+	spool := t.TempDir()
+	storage := &config.LocalConfig{Directory: "/mnt/recordings"}
+
+	u := newTestUploader(&testUploader{err: permanentError{errors.New("forbidden")}, failures: 2})
+	u.conf = storage
+	u.SetSpool(&config.UploadSpoolConfig{Directory: spool}, &livekit.EgressInfo{EgressId: "EG_spool"})
+
+	// failed uploads are spooled with their storage path flattened
+	localFilepath := path.Join(t.TempDir(), "live.m3u8")
+	require.NoError(t, os.WriteFile(localFilepath, []byte("first"), 0644))
+	location, size, err := u.Upload(localFilepath, "/streams/live/live.m3u8", types.OutputTypeHLS)
+	require.NoError(t, err)
+	require.Equal(t, path.Join(spool, "EG_spool", "streams_live_live.m3u8"), location)
+	require.Equal(t, int64(5), size)
+	require.True(t, u.IsSpooled(location))
+
+	// spooling the playlist again replaces the earlier version
+	require.NoError(t, os.WriteFile(localFilepath, []byte("second"), 0644))
+	location, _, err = u.Upload(localFilepath, "/streams/live/live.m3u8", types.OutputTypeHLS)
+	require.NoError(t, err)
+	b, err := os.ReadFile(location)
+	require.NoError(t, err)
+	require.Equal(t, "second", string(b))
+
+	pending, errs := FindPendingUploads(spool)
+	require.Empty(t, errs)
+	require.Len(t, pending, 1)
+	require.Equal(t, "EG_spool", pending[0].EgressID)
+	require.Equal(t, location, pending[0].LocalFilepath)
+	require.Equal(t, "/streams/live/live.m3u8", pending[0].StorageFilepath)
+	require.Equal(t, types.OutputTypeHLS, pending[0].OutputType)
+	require.Equal(t, storage, pending[0].UploadConfig())
+
+	// once the storage recovers, nothing is spooled
+	location, _, err = u.Upload(localFilepath, "/streams/live/live.m3u8", types.OutputTypeHLS)
+	require.NoError(t, err)
+	require.False(t, u.IsSpooled(location))
+}
+
+func TestSpoolNoOp(t *testing.T) {
+	// files without storage are not uploaded, so they are never spooled
+	u := newTestUploader(&noOpUploader{})
+	u.SetSpool(&config.UploadSpoolConfig{Directory: t.TempDir()}, &livekit.EgressInfo{EgressId: "EG_spool"})
+	require.Empty(t, u.spool)
+}
@@ -1,12 +1,17 @@
 package uploader
 
 import (
+	"crypto/rsa"
 	"os"
 	"path"
+	"strings"
 	"time"
 
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/logging"
 	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
 )
 
 const (
@@ -17,66 +22,194 @@ const (
 
 type Uploader struct {
 	uploader
-	backup string
+	conf      interface{}
+	backup    string
+	spool     string
+	info      *livekit.EgressInfo // of the egress, for spooled files
+	localCopy string
+	publicKey *rsa.PublicKey
+	hook      *uploadHook
+	headers   []config.UploadHeadersConfig
+	replicas  []*replica
+	retry     retryPolicy
+	checksums *config.ChecksumConfig
+	logger    logger.Logger
 }
 
 type uploader interface {
-	upload(string, string, types.OutputType) (string, int64, error)
+	// upload stores the file with its content type and cache control, if the storage supports it
+	upload(string, string, types.OutputType, string) (string, int64, error)
 }
 
 func New(conf interface{}, backup string) (*Uploader, error) {
-	u := &Uploader{
-		backup: backup,
+	i, err := newUploader(conf)
+	if err != nil {
+		return nil, err
 	}
 
-	var i uploader
-	var err error
+	return &Uploader{
+		uploader: i,
+		conf:     conf,
+		backup:   backup,
+		retry:    defaultRetryPolicy,
+		logger:   logging.Logger(logging.Upload),
+	}, nil
+}
+
+func newUploader(conf interface{}) (uploader, error) {
 	switch c := conf.(type) {
 	case *livekit.S3Upload:
-		i, err = newS3Uploader(c)
+		return newS3Uploader(c)
 	case *livekit.GCPUpload:
-		i, err = newGCPUploader(c)
+		return newGCPUploader(c)
 	case *livekit.AzureBlobUpload:
-		i, err = newAzureUploader(c)
+		return newAzureUploader(c)
 	case *livekit.AliOSSUpload:
-		i, err = newAliOSSUploader(c)
+		return newAliOSSUploader(c)
+	case *config.LocalConfig:
+		return newLocalUploader(c)
+	case *config.GoogleDriveConfig:
+		return newGoogleDriveUploader(c)
+	case *config.DropboxConfig:
+		return newDropboxUploader(c)
+	case *config.HTTPUploadConfig:
+		return newHTTPUploader(c)
 	default:
-		i = &noOpUploader{}
+		return &noOpUploader{}, nil
 	}
-	if err != nil {
-		return nil, err
-	}
-
-	u.uploader = i
-	return u, nil
 }
 
 func (u *Uploader) Upload(localFilepath, storageFilepath string, outputType types.OutputType) (string, int64, error) {
-	location, size, err := u.upload(localFilepath, storageFilepath, outputType)
+	location, size, _, err := u.UploadWithChecksums(localFilepath, storageFilepath, outputType)
+	return location, size, err
+}
+
+// UploadWithChecksums also returns the checksums of the stored file, or nil if checksums are not configured
+func (u *Uploader) UploadWithChecksums(localFilepath, storageFilepath string, outputType types.OutputType) (string, int64, *config.Checksums, error) {
+	var annotations map[string]string
+	if u.hook != nil {
+		var err error
+		annotations, err = u.hook.run(localFilepath, storageFilepath, outputType)
+		if err != nil {
+			// vetoed files are not stored anywhere
+			u.logger.Warnw("upload hook rejected file", err, "path", storageFilepath)
+			return "", 0, nil, err
+		}
+		if len(annotations) > 0 {
+			u.logger.Infow("upload annotated", "path", storageFilepath, "annotations", annotations)
+		}
+	}
+
+	if u.localCopy != "" {
+		if copyErr := u.keepLocalCopy(localFilepath, storageFilepath); copyErr != nil {
+			u.logger.Warnw("failed to keep local copy", copyErr, "path", storageFilepath)
+		}
+	}
+
+	// spooled files are encrypted again when their upload is completed
+	originalFilepath := localFilepath
+	if u.publicKey != nil {
+		encryptedFilepath, err := u.encrypt(localFilepath)
+		if err != nil {
+			return "", 0, nil, err
+		}
+		defer func() {
+			_ = os.Remove(encryptedFilepath)
+		}()
+		localFilepath = encryptedFilepath
+	}
+
+	var checksums *config.Checksums
+	if u.checksums != nil {
+		var err error
+		if checksums, err = u.getChecksums(localFilepath); err != nil {
+			return "", 0, nil, err
+		}
+		if u.checksums.SetOnObject {
+			annotations = withChecksums(annotations, checksums)
+		}
+	}
+
+	contentType, cacheControl := u.getHeaders(storageFilepath, outputType)
+
+	// replicas are uploaded at the same time, and before the file can be moved to backup storage.
+	// Their failures are counted separately (see RequiredReplicaError), and never replace the output storage's location
+	replicasDone := make(chan struct{})
+	go func() {
+		u.uploadReplicas(localFilepath, storageFilepath, contentType, cacheControl, annotations)
+		close(replicasDone)
+	}()
+
+	location, size, err := u.retry.store(u.uploader, localFilepath, storageFilepath, contentType, cacheControl, annotations)
+	<-replicasDone
 	if err == nil {
-		return location, size, nil
+		u.logger.Debugw("upload complete", "location", location, "size", size)
+		return location, size, checksums, nil
+	}
+
+	if u.spool != "" {
+		u.logger.Warnw("upload failed, spooling", err, "path", storageFilepath)
+		location, size, err = u.spoolFile(originalFilepath, storageFilepath, outputType)
+		return location, size, checksums, err
 	}
 
 	if u.backup != "" {
+		u.logger.Warnw("upload failed, moving to backup storage", err, "path", storageFilepath)
 		stat, err := os.Stat(localFilepath)
 		if err != nil {
-			return "", 0, err
+			return "", 0, nil, err
 		}
 
 		backupFilepath := path.Join(u.backup, storageFilepath)
 		if err = os.Rename(localFilepath, backupFilepath); err != nil {
-			return "", 0, err
+			return "", 0, nil, err
 		}
 
-		return backupFilepath, stat.Size(), nil
+		return backupFilepath, stat.Size(), checksums, nil
+	}
+
+	return "", 0, nil, err
+}
+
+// store uploads to a single storage, with annotations as metadata if it supports them
+func store(
+	i uploader,
+	localFilepath, storageFilepath string,
+	contentType types.OutputType,
+	cacheControl string,
+	annotations map[string]string,
+) (string, int64, error) {
+	if m, ok := i.(metadataUploader); ok && len(annotations) > 0 {
+		return m.uploadWithMetadata(localFilepath, storageFilepath, contentType, cacheControl, annotations)
+	}
+	return i.upload(localFilepath, storageFilepath, contentType, cacheControl)
+}
+
+// initializer is implemented by storage which needs to be reached before the first upload
+type initializer interface {
+	init() error
+}
+
+// Init reaches the storage once the uploader has been configured, so that an egress with unreachable storage fails before it starts
+func (u *Uploader) Init() error {
+	for _, b := range u.backends() {
+		if i, ok := b.(initializer); ok {
+			if err := i.init(); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
+}
 
-	return "", 0, err
+// IsBackup returns true if the location returned by Upload is in backup storage
+func (u *Uploader) IsBackup(location string) bool {
+	return u.backup != "" && strings.HasPrefix(location, u.backup)
 }
 
 type noOpUploader struct{}
 
-func (u *noOpUploader) upload(localFilepath, _ string, _ types.OutputType) (string, int64, error) {
+func (u *noOpUploader) upload(localFilepath, _ string, _ types.OutputType, _ string) (string, int64, error) {
 	stat, err := os.Stat(localFilepath)
 	if err != nil {
 		return "", 0, err
@@ -69,6 +69,12 @@ func (s *WebsocketSink) Write(p []byte) (int, error) {
 	return len(p), s.conn.WriteMessage(websocket.BinaryMessage, p)
 }
 
+// WriteFrame sends an encoded video frame as a single binary message, prefixed by its timestamp and keyframe flag
+func (s *WebsocketSink) WriteFrame(pts time.Duration, keyframe bool, frame []byte) error {
+	_, err := s.Write(encodeFrame(pts, keyframe, frame))
+	return err
+}
+
 func (s *WebsocketSink) OnTrackMuted(muted bool) {
 	err := s.writeMutedMessage(muted)
 	if err != nil {
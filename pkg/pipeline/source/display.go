@@ -0,0 +1,103 @@
+package source
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/protocol/logger"
+)
+
+const (
+	displayDir = "displays"
+
+	xLockFormat   = "/tmp/.X%d-lock"
+	xSocketFormat = "/tmp/.X11-unix/X%d"
+)
+
+// display is an X display number from the pool. Like launch slots, displays are file locks in the
+// scratch directory, so a display is reclaimed as soon as the handler holding it exits.
+type display struct {
+	num int
+	f   *os.File
+}
+
+// allocateDisplay takes the first free display in the pool
+func allocateDisplay(p *config.PipelineConfig) (*display, error) {
+	dir := path.Join(p.ScratchDirectory, displayDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Fatal(errors.Retryable(errors.ErrProcessStartFailed(err)))
+	}
+
+	for num := p.DisplayPool.Start; num < p.DisplayPool.Start+p.DisplayPool.Size; num++ {
+		f, err := tryLockFile(path.Join(dir, fmt.Sprintf("%d.lock", num)))
+		if err != nil {
+			return nil, errors.Fatal(errors.Retryable(errors.ErrProcessStartFailed(err)))
+		}
+		if f == nil {
+			continue
+		}
+
+		if displayInUse(num) {
+			// taken by an X server outside of the pool
+			_ = f.Close()
+			continue
+		}
+
+		return &display{num: num, f: f}, nil
+	}
+
+	return nil, errors.Fatal(errors.Retryable(errors.ErrProcessStartFailed(
+		fmt.Errorf("no display available in %d-%d", p.DisplayPool.Start, p.DisplayPool.Start+p.DisplayPool.Size-1),
+	)))
+}
+
+// displayInUse checks for a running X server, and removes the lock and socket of one which didn't exit cleanly
+func displayInUse(num int) bool {
+	lockFile := fmt.Sprintf(xLockFormat, num)
+	socket := fmt.Sprintf(xSocketFormat, num)
+
+	b, err := os.ReadFile(lockFile)
+	if err != nil {
+		// a socket without a lock could still be a server which is starting
+		_, err = os.Stat(socket)
+		return err == nil
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err == nil && processExists(pid) {
+		return true
+	}
+
+	logger.Infow("removing stale display lock", "display", num, "pid", pid)
+	if err = os.Remove(lockFile); err != nil && !os.IsNotExist(err) {
+		logger.Warnw("failed to remove stale display lock", err, "display", num)
+		return true
+	}
+	if err = os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		logger.Warnw("failed to remove stale display socket", err, "display", num)
+		return true
+	}
+	return false
+}
+
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+func (d *display) String() string {
+	return fmt.Sprintf(":%d", d.num)
+}
+
+func (d *display) Release() {
+	// closing the file releases the lock
+	if err := d.f.Close(); err != nil {
+		logger.Warnw("failed to release display", err, "display", d.num)
+	}
+}
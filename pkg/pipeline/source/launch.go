@@ -0,0 +1,84 @@
+package source
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/protocol/logger"
+)
+
+const (
+	launchSlotDir        = "chrome_launch"
+	launchSlotMinBackoff = time.Millisecond * 50
+	launchSlotMaxBackoff = time.Second
+)
+
+// launchSlot is one of the node's xvfb and chrome launch slots. Handlers run in separate processes,
+// so slots are file locks in the scratch directory, which are released by the kernel if a handler dies.
+type launchSlot struct {
+	f *os.File
+}
+
+// acquireLaunchSlot waits in line for a free slot, until the queue timeout
+func acquireLaunchSlot(p *config.PipelineConfig) (*launchSlot, error) {
+	dir := path.Join(p.ScratchDirectory, launchSlotDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Fatal(errors.Retryable(errors.ErrProcessStartFailed(err)))
+	}
+
+	start := time.Now()
+	deadline := start.Add(p.ChromeLaunch.QueueTimeout)
+	backoff := launchSlotMinBackoff
+	for {
+		for i := 0; i < p.ChromeLaunch.MaxConcurrent; i++ {
+			f, err := tryLockFile(path.Join(dir, fmt.Sprintf("%d.lock", i)))
+			if err != nil {
+				return nil, errors.Fatal(errors.Retryable(errors.ErrProcessStartFailed(err)))
+			}
+			if f != nil {
+				if waited := time.Since(start); waited > launchSlotMinBackoff {
+					logger.Debugw("acquired chrome launch slot", "slot", i, "waited", waited)
+				}
+				return &launchSlot{f: f}, nil
+			}
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			return nil, errors.Fatal(errors.Retryable(errors.ErrProcessStartFailed(
+				fmt.Errorf("no chrome launch slot available after %s", p.ChromeLaunch.QueueTimeout),
+			)))
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > launchSlotMaxBackoff {
+			backoff = launchSlotMaxBackoff
+		}
+	}
+}
+
+// tryLockFile returns nil if the file is locked by another handler
+func tryLockFile(filename string) (*os.File, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func (l *launchSlot) Release() {
+	// closing the file releases the lock
+	if err := l.f.Close(); err != nil {
+		logger.Warnw("failed to release chrome launch slot", err)
+	}
+}
@@ -11,8 +11,11 @@ import (
 	"github.com/tinyzimmer/go-gst/gst/app"
 	"go.uber.org/atomic"
 
+	"github.com/livekit/egress/pkg/clock"
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/logging"
+	"github.com/livekit/egress/pkg/pipeline/qc"
 	"github.com/livekit/egress/pkg/pipeline/source/sdk"
 	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
@@ -30,15 +33,29 @@ const (
 )
 
 type SDKSource struct {
-	room *lksdk.Room
-	sync *synchronizer.Synchronizer
+	mu     sync.Mutex
+	room   *lksdk.Room
+	closed bool
+	shared *sharedRoom // set when the room connection is shared with other sources
+	sync   *synchronizer.Synchronizer
+	logger logger.Logger
+
+	// rejoining after signaling outages
+	wsUrl     string
+	token     string
+	opts      []lksdk.ConnectOption
+	callback  *lksdk.RoomCallback
+	maxOutage time.Duration
+	rejoining atomic.Bool
+	onOutage  func(bool)
 
 	// track
 	trackID string
 
 	// track composite
-	audioTrackID string
-	videoTrackID string
+	audioTrackID   string
+	videoTrackID   string
+	alternateAudio map[string]*alternateAudio // by track ID
 
 	// participant
 	participantIdentity string
@@ -49,8 +66,14 @@ type SDKSource struct {
 	active         atomic.Int32
 	startRecording chan struct{}
 	endRecording   chan struct{}
+	endTrigger     string
+	endedBy        string
 
 	onTrackMute func(bool)
+	onVideoMute func(bool)
+	onAudioMute func(bool)
+
+	onNetworkStats func([]*qc.NetworkStats)
 }
 
 func NewSDKSource(ctx context.Context, p *config.PipelineConfig) (*SDKSource, error) {
@@ -62,13 +85,31 @@ func NewSDKSource(ctx context.Context, p *config.PipelineConfig) (*SDKSource, er
 		sync: synchronizer.NewSynchronizer(func() {
 			close(startRecording)
 		}),
+		logger:         logging.Logger(logging.Source),
+		wsUrl:          p.WsUrl,
+		token:          p.Token,
+		opts:           connectOptions(p),
+		maxOutage:      p.SDKReconnect,
 		startRecording: startRecording,
 		endRecording:   make(chan struct{}),
+		endTrigger:     p.EndTrigger,
 	}
 
 	if err := s.joinRoom(p); err != nil {
+		if s.shared != nil {
+			s.shared.leave(s)
+		}
 		return nil, err
 	}
+
+	if s.maxOutage > 0 && s.shared == nil {
+		for _, w := range s.getWriters() {
+			w.SetResumable(true)
+		}
+	}
+	if p.NetworkStats != nil {
+		go s.monitorNetwork(p.NetworkStats.Interval)
+	}
 	return s, nil
 }
 
@@ -77,7 +118,12 @@ func (s *SDKSource) StartRecording() chan struct{} {
 }
 
 func (s *SDKSource) GetStartTime() int64 {
-	return s.sync.GetStartedAt()
+	startedAt := s.sync.GetStartedAt()
+	if startedAt == 0 {
+		return 0
+	}
+	// the synchronizer uses the system clock
+	return startedAt + int64(clock.Offset())
 }
 
 func (s *SDKSource) Playing(name string) {
@@ -86,6 +132,10 @@ func (s *SDKSource) Playing(name string) {
 		s.audioWriter.Play()
 	case VideoAppSource:
 		s.videoWriter.Play()
+	default:
+		if w := s.getAlternateWriterForAppSource(name); w != nil {
+			w.Play()
+		}
 	}
 }
 
@@ -93,6 +143,12 @@ func (s *SDKSource) EndRecording() chan struct{} {
 	return s.endRecording
 }
 
+func (s *SDKSource) EndedBy() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.endedBy
+}
+
 func (s *SDKSource) GetEndTime() int64 {
 	return s.sync.GetEndedAt()
 }
@@ -115,6 +171,15 @@ func (s *SDKSource) CloseWriters() {
 			s.videoWriter.Drain(false)
 		}()
 	}
+	for _, a := range s.alternateAudio {
+		if w := a.writer; w != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w.Drain(false)
+			}()
+		}
+	}
 	wg.Wait()
 }
 
@@ -123,18 +188,31 @@ func (s *SDKSource) StreamStopped(name string) {
 	case AudioAppSource:
 		s.audioWriter.Drain(true)
 		if s.active.Dec() == 0 {
-			s.onDisconnected()
+			s.onDisconnected(config.EndTriggerParticipantLeft)
 		}
 	case VideoAppSource:
 		s.videoWriter.Drain(true)
 		if s.active.Dec() == 0 {
-			s.onDisconnected()
+			s.onDisconnected(config.EndTriggerParticipantLeft)
+		}
+	default:
+		if w := s.getAlternateWriterForAppSource(name); w != nil {
+			w.Drain(true)
 		}
 	}
 }
 
 func (s *SDKSource) Close() {
-	s.room.Disconnect()
+	s.mu.Lock()
+	s.closed = true
+	room := s.room
+	s.mu.Unlock()
+
+	if s.shared != nil {
+		s.shared.leave(s)
+	} else {
+		room.Disconnect()
+	}
 }
 
 func (s *SDKSource) joinRoom(p *config.PipelineConfig) error {
@@ -148,8 +226,9 @@ func (s *SDKSource) joinRoom(p *config.PipelineConfig) error {
 			},
 			OnTrackUnpublished: s.onTrackUnpublished,
 		},
-		OnDisconnected: s.onDisconnected,
+		OnDisconnected: s.onRoomDisconnected,
 	}
+	s.callback = cb
 
 	var mu sync.Mutex
 	filenameReplacements := make(map[string]string)
@@ -158,7 +237,14 @@ func (s *SDKSource) joinRoom(p *config.PipelineConfig) error {
 	var wg sync.WaitGroup
 	cb.OnTrackSubscribed = func(track *webrtc.TrackRemote, pub *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
 		defer wg.Done()
-		logger.Debugw("track subscribed", "trackID", track.ID(), "mime", track.Codec().MimeType)
+		s.logger.Debugw("track subscribed", "trackID", track.ID(), "mime", track.Codec().MimeType)
+
+		if a := s.alternateAudio[pub.SID()]; a != nil {
+			if err := s.onAlternateAudioSubscribed(p, a, track, rp); err != nil {
+				onSubscribeErr = err
+			}
+			return
+		}
 
 		s.active.Inc()
 		t := s.sync.AddTrack(track, rp.Identity())
@@ -203,7 +289,15 @@ func (s *SDKSource) joinRoom(p *config.PipelineConfig) error {
 
 			if p.TrackID != "" {
 				if o := p.GetFileConfig(); o != nil {
-					o.OutputType = types.OutputTypeOGG
+					switch o.OutputType {
+					case types.OutputTypeMP3:
+						p.AudioOutCodec = types.MimeTypeMP3
+					case types.OutputTypeWAV, types.OutputTypeRaw:
+						// decoded to pcm, without an encoder
+						p.AudioOutCodec = types.MimeTypeRawAudio
+					default:
+						o.OutputType = types.OutputTypeOGG
+					}
 				}
 			}
 
@@ -258,9 +352,18 @@ func (s *SDKSource) joinRoom(p *config.PipelineConfig) error {
 		}
 		appSrc := app.SrcFromElement(src)
 
-		writer, err := sdk.NewAppWriter(track, rp, codec, appSrc, s.sync, t, writeBlanks)
+		// transcoded track composite video can be replaced by blank frames, so that the egress continues audio only
+		var onTrackEnded func()
+		if p.AudioOnlyFallback && appSrcName == VideoAppSource && p.AudioTrackID != "" && p.VideoTranscoding {
+			onTrackEnded = func() {
+				s.logger.Warnw("video track lost, continuing audio only", nil, "trackID", track.ID())
+				p.VideoLostAt = clock.Now().UnixNano()
+			}
+		}
+
+		writer, err := sdk.NewAppWriter(track, rp, codec, appSrc, s.sync, t, writeBlanks, onTrackEnded, p.Failure)
 		if err != nil {
-			logger.Errorw("could not create app writer", err)
+			s.logger.Errorw("could not create app writer", err)
 			onSubscribeErr = err
 			return
 		}
@@ -278,12 +381,6 @@ func (s *SDKSource) joinRoom(p *config.PipelineConfig) error {
 		}
 	}
 
-	s.room = lksdk.CreateRoom(cb)
-	logger.Debugw("connecting to room")
-	if err := s.room.JoinWithToken(p.WsUrl, p.Token, lksdk.WithAutoSubscribe(false)); err != nil {
-		return err
-	}
-
 	var fileIdentifier string
 	tracks := make(map[string]struct{})
 
@@ -305,6 +402,24 @@ func (s *SDKSource) joinRoom(p *config.PipelineConfig) error {
 		tracks[s.trackID] = struct{}{}
 	}
 
+	if p.ShareRoomConnections {
+		shared, err := roomPool.join(p, s, cb, tracks)
+		if err != nil {
+			return err
+		}
+		if shared != nil {
+			s.shared = shared
+			s.room = shared.room
+		}
+	}
+	if s.room == nil {
+		s.room = lksdk.CreateRoom(cb)
+		s.logger.Debugw("connecting to room")
+		if err := s.room.JoinWithToken(p.WsUrl, p.Token, s.opts...); err != nil {
+			return err
+		}
+	}
+
 	wg.Add(len(tracks))
 	if err := s.subscribeToTracks(tracks); err != nil {
 		return err
@@ -314,14 +429,35 @@ func (s *SDKSource) joinRoom(p *config.PipelineConfig) error {
 		return onSubscribeErr
 	}
 
+	// alternate audio is looked up once the main tracks are subscribed, and is left out if not published
+	if len(p.AlternateAudioTracks) > 0 {
+		alternateTracks := s.findAlternateAudio(p)
+		wg.Add(len(alternateTracks))
+		if err := s.subscribeToTracks(alternateTracks); err != nil {
+			return err
+		}
+		wg.Wait()
+		if onSubscribeErr != nil {
+			return onSubscribeErr
+		}
+	}
+
 	if err := p.UpdateInfoFromSDK(fileIdentifier, filenameReplacements); err != nil {
-		logger.Errorw("could not update file params", err)
+		s.logger.Errorw("could not update file params", err)
 		return err
 	}
 
 	return nil
 }
 
+func connectOptions(p *config.PipelineConfig) []lksdk.ConnectOption {
+	opts := []lksdk.ConnectOption{lksdk.WithAutoSubscribe(false)}
+	if p.ICE != nil && p.ICE.ForceRelay {
+		opts = append(opts, lksdk.WithICETransportPolicy(webrtc.ICETransportPolicyRelay))
+	}
+	return opts
+}
+
 func (s *SDKSource) subscribeToTracks(expecting map[string]struct{}) error {
 	deadline := time.Now().Add(subscriptionTimeout)
 	for time.Now().Before(deadline) {
@@ -359,12 +495,74 @@ func (s *SDKSource) OnTrackMuted(onTrackMuted func(bool)) {
 	s.onTrackMute = onTrackMuted
 }
 
+// OnVideoMuted is called when the video track is muted or unmuted
+func (s *SDKSource) OnVideoMuted(onVideoMuted func(bool)) {
+	s.onVideoMute = onVideoMuted
+}
+
+// OnAudioMuted is called when the audio track is muted or unmuted
+func (s *SDKSource) OnAudioMuted(onAudioMuted func(bool)) {
+	s.onAudioMute = onAudioMuted
+}
+
+// OnNetworkStats is called periodically with the network stats of each subscribed track
+func (s *SDKSource) OnNetworkStats(onNetworkStats func([]*qc.NetworkStats)) {
+	s.mu.Lock()
+	s.onNetworkStats = onNetworkStats
+	s.mu.Unlock()
+}
+
+func (s *SDKSource) monitorNetwork(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.endRecording:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		closed := s.closed
+		onNetworkStats := s.onNetworkStats
+		s.mu.Unlock()
+		if closed {
+			return
+		}
+
+		writers := s.getWriters()
+		stats := make([]*qc.NetworkStats, 0, len(writers))
+		for _, w := range writers {
+			st := w.GetNetworkStats()
+			s.logger.Infow("network stats",
+				"trackID", st.TrackID,
+				"kind", st.Kind,
+				"bitrateKbps", st.Bitrate,
+				"packetsLost", st.PacketsLost,
+				"packetLoss", st.PacketLoss,
+				"jitterMs", st.Jitter,
+			)
+			stats = append(stats, st)
+		}
+		if onNetworkStats != nil {
+			onNetworkStats(stats)
+		}
+	}
+}
+
 func (s *SDKSource) onTrackMuteChanged(pub lksdk.TrackPublication, muted bool) {
 	track := pub.Track()
 	if track == nil {
 		return
 	}
 
+	// mute indicators only follow the main tracks
+	if w := s.getAlternateWriter(track.ID()); w != nil {
+		w.SetTrackMuted(muted)
+		return
+	}
+
 	if w := s.getWriterForTrack(track.ID()); w != nil {
 		w.SetTrackMuted(muted)
 	}
@@ -372,22 +570,45 @@ func (s *SDKSource) onTrackMuteChanged(pub lksdk.TrackPublication, muted bool) {
 	if s.onTrackMute != nil {
 		s.onTrackMute(muted)
 	}
+	if s.onVideoMute != nil && pub.Kind() == lksdk.TrackKindVideo {
+		s.onVideoMute(muted)
+	}
+	if s.onAudioMute != nil && pub.Kind() == lksdk.TrackKindAudio {
+		s.onAudioMute(muted)
+	}
 }
 
 func (s *SDKSource) onTrackUnpublished(pub *lksdk.RemoteTrackPublication, _ *lksdk.RemoteParticipant) {
+	if w := s.getAlternateWriter(pub.SID()); w != nil {
+		w.Drain(true)
+		return
+	}
 	if w := s.getWriterForTrack(pub.SID()); w != nil {
+		if w.EndTrack() {
+			return
+		}
+		if s.endTrigger != config.EndTriggerParticipantLeft {
+			// the writer holds its position, in case the track is published again
+			w.Interrupt()
+			return
+		}
 		w.Drain(true)
 		if s.active.Dec() == 0 {
-			s.onDisconnected()
+			s.onDisconnected(config.EndTriggerParticipantLeft)
 		}
 	}
 }
 
-func (s *SDKSource) onDisconnected() {
+// onDisconnected ends the recording, recording the end trigger
+func (s *SDKSource) onDisconnected(endedBy string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	select {
 	case <-s.endRecording:
 		return
 	default:
+		s.endedBy = endedBy
 		close(s.endRecording)
 	}
 }
@@ -406,5 +627,5 @@ func (s *SDKSource) getWriterForTrack(trackID string) *sdk.AppWriter {
 		return s.videoWriter
 	}
 
-	return nil
+	return s.getAlternateWriter(trackID)
 }
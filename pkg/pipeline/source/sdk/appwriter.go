@@ -3,6 +3,7 @@ package sdk
 import (
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/frostbyte73/core"
@@ -14,7 +15,10 @@ import (
 	"go.uber.org/atomic"
 
 	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/logging"
+	"github.com/livekit/egress/pkg/pipeline/qc"
 	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/egress/pkg/util"
 	"github.com/livekit/protocol/logger"
 	lksdk "github.com/livekit/server-sdk-go"
 	"github.com/livekit/server-sdk-go/pkg/jitter"
@@ -38,26 +42,42 @@ const (
 type AppWriter struct {
 	logger      logger.Logger
 	track       *webrtc.TrackRemote
+	rp          *lksdk.RemoteParticipant
 	identity    string
 	codec       types.MimeType
 	src         *app.Source
 	startTime   time.Time
 	writeBlanks bool
 
-	buffer     *jitter.Buffer
-	translator Translator
-	sendPLI    func()
+	// called once if the track ends and is replaced by blank frames
+	onTrackEnded func()
+
+	buffer       *jitter.Buffer
+	stats        *receiverStats
+	depacketizer rtp.Depacketizer
+	translator   Translator
+	sendPLI      func()
+
+	// replacement track after a signaling outage, swapped in by run
+	mu          sync.Mutex
+	resumed     *webrtc.TrackRemote
+	resumedRP   *lksdk.RemoteParticipant
+	resumable   atomic.Bool
+	interrupted atomic.Bool
 
 	// a/v sync
 	sync *synchronizer.Synchronizer
 	*synchronizer.TrackSynchronizer
-	lastPTS time.Duration
+	lastPTS   time.Duration
+	ptsOffset time.Duration // added to the pts of resumed tracks
+	resuming  bool
 
 	// state
 	state       state
 	initialized bool
 	ticker      *time.Ticker
 	muted       atomic.Bool
+	trackEnded  atomic.Bool
 	playing     core.Fuse
 	draining    core.Fuse
 	endStream   core.Fuse
@@ -72,14 +92,18 @@ func NewAppWriter(
 	sync *synchronizer.Synchronizer,
 	syncInfo *synchronizer.TrackSynchronizer,
 	writeBlanks bool,
+	onTrackEnded func(),
+	failure chan<- error,
 ) (*AppWriter, error) {
 	w := &AppWriter{
-		logger:            logger.GetLogger().WithValues("trackID", track.ID(), "kind", track.Kind().String()),
+		logger:            logging.Logger(logging.Source).WithValues("trackID", track.ID(), "kind", track.Kind().String()),
 		track:             track,
+		rp:                rp,
 		identity:          rp.Identity(),
 		codec:             codec,
 		src:               src,
 		writeBlanks:       writeBlanks,
+		onTrackEnded:      onTrackEnded,
 		sync:              sync,
 		TrackSynchronizer: syncInfo,
 		playing:           core.NewFuse(),
@@ -88,36 +112,47 @@ func NewAppWriter(
 		finished:          core.NewFuse(),
 	}
 
-	var depacketizer rtp.Depacketizer
 	switch codec {
 	case types.MimeTypeVP8:
-		depacketizer = &codecs.VP8Packet{}
+		w.depacketizer = &codecs.VP8Packet{}
 		w.translator = NewVP8Translator(w.logger)
-		w.sendPLI = func() { rp.WritePLI(track.SSRC()) }
+		w.sendPLI = w.writePLI
 
 	case types.MimeTypeH264:
-		depacketizer = &codecs.H264Packet{}
+		w.depacketizer = &codecs.H264Packet{}
 		w.translator = NewH264Translator()
-		w.sendPLI = func() { rp.WritePLI(track.SSRC()) }
+		w.sendPLI = w.writePLI
 
 	case types.MimeTypeOpus:
-		depacketizer = &codecs.OpusPacket{}
+		w.depacketizer = &codecs.OpusPacket{}
 		w.translator = NewOpusTranslator()
 
 	default:
 		return nil, errors.ErrNotSupported(track.Codec().MimeType)
 	}
 
-	w.buffer = jitter.NewBuffer(
-		depacketizer,
-		track.Codec().ClockRate,
+	w.buffer = w.newBuffer()
+	w.stats = newReceiverStats(track.Codec().ClockRate)
+
+	util.Go(failure, w.run)
+	return w, nil
+}
+
+func (w *AppWriter) newBuffer() *jitter.Buffer {
+	return jitter.NewBuffer(
+		w.depacketizer,
+		w.track.Codec().ClockRate,
 		latency,
 		jitter.WithPacketDroppedHandler(w.sendPLI),
 		jitter.WithLogger(w.logger),
 	)
+}
 
-	go w.run()
-	return w, nil
+func (w *AppWriter) writePLI() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.rp.WritePLI(w.track.SSRC())
 }
 
 func (w *AppWriter) Play() {
@@ -125,6 +160,10 @@ func (w *AppWriter) Play() {
 }
 
 func (w *AppWriter) SetTrackMuted(muted bool) {
+	if w.trackEnded.Load() {
+		return
+	}
+
 	w.muted.Store(muted)
 	if muted {
 		w.logger.Debugw("track muted", "timestamp", time.Since(w.startTime).Seconds())
@@ -136,6 +175,56 @@ func (w *AppWriter) SetTrackMuted(muted bool) {
 	}
 }
 
+// EndTrack replaces the remainder of the track with blank frames, returning false if the writer has no fallback
+func (w *AppWriter) EndTrack() bool {
+	if w.onTrackEnded == nil {
+		return false
+	}
+
+	if w.trackEnded.CompareAndSwap(false, true) {
+		w.logger.Debugw("track ended", "timestamp", time.Since(w.startTime).Seconds())
+		w.muted.Store(true)
+		w.onTrackEnded()
+	}
+	return true
+}
+
+// SetResumable keeps the writer waiting for a replacement track when the track ends,
+// instead of ending the stream. Used while the room connection can be rejoined
+func (w *AppWriter) SetResumable(resumable bool) {
+	w.resumable.Store(resumable)
+}
+
+// Interrupt holds the writer in the muted state until Resume is called,
+// filling the gap with blank frames if the writer would write them for a mute
+func (w *AppWriter) Interrupt() {
+	if w.interrupted.CompareAndSwap(false, true) {
+		w.logger.Debugw("track interrupted", "timestamp", time.Since(w.startTime).Seconds())
+	}
+}
+
+// Resume continues writing from the track's subscription in a new room connection
+func (w *AppWriter) Resume(track *webrtc.TrackRemote, rp *lksdk.RemoteParticipant) {
+	w.mu.Lock()
+	w.resumed = track
+	w.resumedRP = rp
+	w.mu.Unlock()
+
+	w.interrupted.Store(false)
+}
+
+// GetNetworkStats returns the loss, jitter and bitrate of the track since the previous call
+func (w *AppWriter) GetNetworkStats() *qc.NetworkStats {
+	stats := w.stats.snapshot(time.Now())
+
+	w.mu.Lock()
+	stats.TrackID = w.track.ID()
+	stats.Kind = w.track.Kind().String()
+	w.mu.Unlock()
+
+	return stats
+}
+
 // Drain blocks until finished
 func (w *AppWriter) Drain(force bool) {
 	w.draining.Once(func() {
@@ -154,6 +243,9 @@ func (w *AppWriter) Drain(force bool) {
 }
 
 func (w *AppWriter) run() {
+	// break on panic too, so Drain does not block
+	defer w.finished.Break()
+
 	w.startTime = time.Now()
 
 	for !w.endStream.IsBroken() {
@@ -180,7 +272,6 @@ func (w *AppWriter) run() {
 		"avg drift", stats.AvgDrift,
 		"max drift", stats.MaxDrift,
 	)
-	w.finished.Break()
 }
 
 func (w *AppWriter) handlePlaying() {
@@ -191,6 +282,7 @@ func (w *AppWriter) handlePlaying() {
 		w.handleReadError(err)
 		return
 	}
+	w.stats.update(pkt, time.Now())
 
 	// initialize track synchronizer
 	if !w.initialized {
@@ -213,9 +305,15 @@ func (w *AppWriter) handleMuted() {
 		w.ticker.Stop()
 		w.endStream.Break()
 
-	case !w.muted.Load():
+	case !w.muted.Load() && !w.interrupted.Load():
 		w.ticker.Stop()
-		if w.writeBlanks {
+		if w.resumeTrack() {
+			// the new track has its own timestamps, so the synchronizer starts again from its first packet
+			w.state = statePlaying
+			if w.sendPLI != nil {
+				w.sendPLI()
+			}
+		} else if w.writeBlanks {
 			w.state = stateUnmuting
 		} else {
 			w.state = statePlaying
@@ -223,7 +321,7 @@ func (w *AppWriter) handleMuted() {
 
 	default:
 		<-w.ticker.C
-		if w.writeBlanks {
+		if w.writeBlanks || w.trackEnded.Load() {
 			_, err := w.insertBlankFrame(nil)
 			if err != nil {
 				w.ticker.Stop()
@@ -233,6 +331,28 @@ func (w *AppWriter) handleMuted() {
 	}
 }
 
+// resumeTrack swaps in the track passed to Resume, returning false if there is none
+func (w *AppWriter) resumeTrack() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.resumed == nil {
+		return false
+	}
+
+	w.track = w.resumed
+	w.rp = w.resumedRP
+	w.resumed = nil
+	w.resumedRP = nil
+
+	w.initialized = false
+	w.resuming = true
+	w.buffer = w.newBuffer()
+	w.stats.reset()
+	w.logger.Debugw("track resumed", "timestamp", time.Since(w.startTime).Seconds())
+	return true
+}
+
 func (w *AppWriter) handleUnmute() {
 	_ = w.track.SetReadDeadline(time.Now().Add(time.Millisecond * 500))
 	pkt, _, err := w.track.ReadRTP()
@@ -240,6 +360,7 @@ func (w *AppWriter) handleUnmute() {
 		w.handleReadError(err)
 		return
 	}
+	w.stats.update(pkt, time.Now())
 
 	// the blank frames will be ~500ms behind and need to fill the gap
 	for !w.endStream.IsBroken() {
@@ -268,8 +389,13 @@ func (w *AppWriter) handleReadError(err error) {
 		return
 	}
 
-	// check if muted
-	if w.muted.Load() {
+	// wait for a new subscription if the room connection is being rejoined
+	if errors.Is(err, io.EOF) && w.resumable.Load() {
+		w.Interrupt()
+	}
+
+	// check if muted or interrupted, or if the track has ended and will be replaced with blank frames
+	if w.muted.Load() || w.interrupted.Load() || (errors.Is(err, io.EOF) && w.EndTrack()) {
 		_ = w.pushSamples(true)
 		w.ticker = time.NewTicker(w.GetFrameDuration())
 		w.state = stateMuted
@@ -349,6 +475,13 @@ func (w *AppWriter) pushSamples(force bool) error {
 }
 
 func (w *AppWriter) pushPacket(pkt *rtp.Packet, pts time.Duration) error {
+	if w.resuming {
+		// the first packet of a resumed track sets its offset, so that it continues after the blank frames
+		w.ptsOffset += getResumeOffset(w.lastPTS, pts+w.ptsOffset, w.GetFrameDuration())
+		w.resuming = false
+	}
+	pts += w.ptsOffset
+
 	if pts < w.lastPTS {
 		// don't push backwards pts
 		w.logger.Warnw("backwards pts", nil, "pts", pts, "lastPTS", w.lastPTS)
@@ -371,3 +504,12 @@ func (w *AppWriter) pushPacket(pkt *rtp.Packet, pts time.Duration) error {
 
 	return nil
 }
+
+// getResumeOffset returns the shift which keeps a resumed track from overlapping what was already pushed,
+// placing its first packet one frame after lastPTS. Tracks which resume after lastPTS are not shifted
+func getResumeOffset(lastPTS, firstPTS, frameDuration time.Duration) time.Duration {
+	if firstPTS > lastPTS {
+		return 0
+	}
+	return lastPTS + frameDuration - firstPTS
+}
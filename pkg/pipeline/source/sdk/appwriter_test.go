@@ -0,0 +1,26 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumeOffset(t *testing.T) {
+	frame := time.Millisecond * 20
+	lastPTS := time.Second * 10
+
+	// timestamps which restart with the new track continue one frame after the last packet
+	offset := getResumeOffset(lastPTS, time.Millisecond*100, frame)
+	require.Equal(t, lastPTS+frame, time.Millisecond*100+offset)
+
+	// a track resuming at the last pts is not pushed backwards or onto it
+	require.Equal(t, frame, getResumeOffset(lastPTS, lastPTS, frame))
+
+	// tracks resuming after the gap keep their timestamps
+	require.Zero(t, getResumeOffset(lastPTS, lastPTS+time.Second, frame))
+
+	// nothing was pushed before the outage
+	require.Zero(t, getResumeOffset(0, time.Millisecond*100, frame))
+}
@@ -0,0 +1,120 @@
+package sdk
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+
+	"github.com/livekit/egress/pkg/pipeline/qc"
+)
+
+// receiverStats tracks loss, jitter and bitrate of received rtp packets, as described in RFC 3550 appendix A
+type receiverStats struct {
+	mu sync.Mutex
+
+	clockRate     uint32
+	initialized   bool
+	baseSeq       uint32
+	maxSeq        uint16
+	cycles        uint32
+	priorExpected int64 // expected packets from previous tracks, before a reset
+	received      int64
+	bytes         int64
+	lastTransit   int64
+	jitter        float64 // in rtp timestamp units
+
+	// values at the previous snapshot
+	lastExpected int64
+	lastReceived int64
+	lastBytes    int64
+	lastSnapshot time.Time
+}
+
+func newReceiverStats(clockRate uint32) *receiverStats {
+	return &receiverStats{
+		clockRate:    clockRate,
+		lastSnapshot: time.Now(),
+	}
+}
+
+func (s *receiverStats) update(pkt *rtp.Packet, arrival time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	first := !s.initialized
+	if first {
+		s.initialized = true
+		s.baseSeq = uint32(pkt.SequenceNumber)
+		s.maxSeq = pkt.SequenceNumber
+	} else if diff := pkt.SequenceNumber - s.maxSeq; diff != 0 && diff < 1<<15 {
+		if pkt.SequenceNumber < s.maxSeq {
+			s.cycles += 1 << 16
+		}
+		s.maxSeq = pkt.SequenceNumber
+	}
+
+	s.received++
+	s.bytes += int64(pkt.MarshalSize())
+
+	if s.clockRate == 0 {
+		return
+	}
+	arrivalTS := arrival.UnixNano() * int64(s.clockRate) / 1e9
+	transit := arrivalTS - int64(pkt.Timestamp)
+	if !first {
+		d := math.Abs(float64(transit - s.lastTransit))
+		s.jitter += (d - s.jitter) / 16
+	}
+	s.lastTransit = transit
+}
+
+// snapshot returns the stats since the previous snapshot
+func (s *receiverStats) snapshot(now time.Time) *qc.NetworkStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expected := s.expected()
+	stats := &qc.NetworkStats{
+		PacketsReceived: s.received - s.lastReceived,
+		PacketsLost:     (expected - s.lastExpected) - (s.received - s.lastReceived),
+	}
+	if stats.PacketsLost < 0 {
+		// duplicates
+		stats.PacketsLost = 0
+	}
+	if total := stats.PacketsReceived + stats.PacketsLost; total > 0 {
+		stats.PacketLoss = float64(stats.PacketsLost) / float64(total)
+	}
+	if elapsed := now.Sub(s.lastSnapshot).Seconds(); elapsed > 0 {
+		stats.Bitrate = float64(s.bytes-s.lastBytes) * 8 / 1000 / elapsed
+	}
+	if s.clockRate > 0 {
+		stats.Jitter = s.jitter * 1000 / float64(s.clockRate)
+	}
+
+	s.lastExpected = expected
+	s.lastReceived = s.received
+	s.lastBytes = s.bytes
+	s.lastSnapshot = now
+	return stats
+}
+
+func (s *receiverStats) expected() int64 {
+	if !s.initialized {
+		return s.priorExpected
+	}
+	return s.priorExpected + int64(s.cycles+uint32(s.maxSeq)) - int64(s.baseSeq) + 1
+}
+
+// reset starts over with a new sequence number and timestamp space, after the track is replaced
+func (s *receiverStats) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.priorExpected = s.expected()
+	s.initialized = false
+	s.cycles = 0
+	s.jitter = 0
+}
@@ -0,0 +1,54 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceiverStats(t *testing.T) {
+	s := newReceiverStats(90000)
+	start := time.Now()
+	s.lastSnapshot = start
+
+	write := func(seq uint16, at time.Duration, jitter time.Duration) {
+		s.update(&rtp.Packet{
+			Header:  rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(at.Seconds() * 90000)},
+			Payload: make([]byte, 88),
+		}, start.Add(at+jitter))
+	}
+
+	// sequence numbers wrap, and every tenth packet is lost
+	seq := uint16(65500)
+	for i := 0; i < 100; i++ {
+		if i%10 != 5 {
+			write(seq, time.Duration(i)*10*time.Millisecond, 0)
+		}
+		seq++
+	}
+
+	stats := s.snapshot(start.Add(time.Second))
+	require.Equal(t, int64(90), stats.PacketsReceived)
+	require.Equal(t, int64(10), stats.PacketsLost)
+	require.InDelta(t, 0.1, stats.PacketLoss, 0.001)
+	// 90 packets of 100 bytes each
+	require.InDelta(t, 72, stats.Bitrate, 0.01)
+	require.InDelta(t, 0, stats.Jitter, 0.01)
+
+	// a replacement track starts a new sequence number space
+	s.reset()
+	for i := 0; i < 50; i++ {
+		jitter := time.Duration(0)
+		if i%2 == 1 {
+			jitter = 20 * time.Millisecond
+		}
+		write(uint16(1000+i), time.Duration(i)*20*time.Millisecond, jitter)
+	}
+
+	stats = s.snapshot(start.Add(2 * time.Second))
+	require.Equal(t, int64(50), stats.PacketsReceived)
+	require.Equal(t, int64(0), stats.PacketsLost)
+	require.Greater(t, stats.Jitter, 10.0)
+}
@@ -0,0 +1,119 @@
+package source
+
+import (
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/tinyzimmer/go-gst/gst"
+	"github.com/tinyzimmer/go-gst/gst/app"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/source/sdk"
+	"github.com/livekit/egress/pkg/types"
+	lksdk "github.com/livekit/server-sdk-go"
+)
+
+// alternateAudio is an extra audio track, such as an interpretation, muxed next to the main audio.
+// It does not keep the recording going, so it is not counted as an active track
+type alternateAudio struct {
+	*config.AlternateAudio
+	writer *sdk.AppWriter
+}
+
+// AlternateAudioAppSource returns the name of the app source for an alternate audio language
+func AlternateAudioAppSource(language string) string {
+	return AudioAppSource + "_" + language
+}
+
+// IsAppSource returns true for the app source of any subscribed track
+func IsAppSource(name string) bool {
+	return name == AudioAppSource || name == VideoAppSource || strings.HasPrefix(name, AudioAppSource+"_")
+}
+
+// findAlternateAudio matches each alternate audio track to a publication, and removes the ones which
+// are not published from the pipeline config. It returns the track IDs to subscribe to
+func (s *SDKSource) findAlternateAudio(p *config.PipelineConfig) map[string]struct{} {
+	tracks := make(map[string]struct{})
+	s.alternateAudio = make(map[string]*alternateAudio)
+
+	found := make([]*config.AlternateAudio, 0, len(p.AlternateAudioTracks))
+	for _, a := range p.AlternateAudioTracks {
+		trackID := s.findAudioPublication(a.ParticipantIdentity, a.TrackName)
+		if _, ok := tracks[trackID]; ok || trackID == "" || trackID == s.audioTrackID {
+			s.logger.Warnw("alternate audio track not found", nil,
+				"language", a.Language,
+				"participantIdentity", a.ParticipantIdentity,
+				"trackName", a.TrackName,
+			)
+			continue
+		}
+
+		a.TrackID = trackID
+		tracks[trackID] = struct{}{}
+		s.alternateAudio[trackID] = &alternateAudio{AlternateAudio: a}
+		found = append(found, a)
+	}
+	p.AlternateAudioTracks = found
+
+	return tracks
+}
+
+func (s *SDKSource) findAudioPublication(identity, trackName string) string {
+	for _, rp := range s.room.GetParticipants() {
+		if rp.Identity() != identity {
+			continue
+		}
+		for _, pub := range rp.Tracks() {
+			if pub.Kind() == lksdk.TrackKindAudio && (trackName == "" || pub.Name() == trackName) {
+				return pub.SID()
+			}
+		}
+	}
+	return ""
+}
+
+func (s *SDKSource) onAlternateAudioSubscribed(
+	p *config.PipelineConfig,
+	a *alternateAudio,
+	track *webrtc.TrackRemote,
+	rp *lksdk.RemoteParticipant,
+) error {
+	if !strings.EqualFold(track.Codec().MimeType, string(types.MimeTypeOpus)) {
+		return errors.ErrNotSupported(track.Codec().MimeType)
+	}
+	t := s.sync.AddTrack(track, rp.Identity())
+
+	<-p.GstReady
+	src, err := gst.NewElementWithName("appsrc", AlternateAudioAppSource(a.Language))
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	appSrc := app.SrcFromElement(src)
+
+	writer, err := sdk.NewAppWriter(track, rp, types.MimeTypeOpus, appSrc, s.sync, t, false, nil, p.Failure)
+	if err != nil {
+		return err
+	}
+
+	a.writer = writer
+	a.Src = appSrc
+	a.CodecParams = track.Codec()
+	return nil
+}
+
+func (s *SDKSource) getAlternateWriter(trackID string) *sdk.AppWriter {
+	if a := s.alternateAudio[trackID]; a != nil {
+		return a.writer
+	}
+	return nil
+}
+
+func (s *SDKSource) getAlternateWriterForAppSource(name string) *sdk.AppWriter {
+	for _, a := range s.alternateAudio {
+		if AlternateAudioAppSource(a.Language) == name {
+			return a.writer
+		}
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package source
+
+import (
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/protocol/auth"
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go"
+)
+
+// rooms are shared by sdk sources running in the same process, when enabled
+var roomPool = &connectionPool{
+	rooms: make(map[string]*sharedRoom),
+}
+
+type connectionPool struct {
+	mu    sync.Mutex
+	rooms map[string]*sharedRoom
+}
+
+// sharedRoom is a single room connection, with each track routed to the source which subscribed to it
+type sharedRoom struct {
+	key   string
+	room  *lksdk.Room
+	ready chan struct{}
+	err   error
+
+	mu      sync.Mutex
+	closed  bool
+	sources map[*SDKSource]*lksdk.RoomCallback
+	tracks  map[string]*SDKSource
+	refs    int
+}
+
+// join returns a shared connection to the room, or nil if one of the tracks already belongs to another source
+func (c *connectionPool) join(p *config.PipelineConfig, s *SDKSource, cb *lksdk.RoomCallback, tracks map[string]struct{}) (*sharedRoom, error) {
+	key, ok := getPoolKey(p)
+	if !ok {
+		return nil, nil
+	}
+
+	c.mu.Lock()
+	r, ok := c.rooms[key]
+	if !ok {
+		r = &sharedRoom{
+			key:     key,
+			ready:   make(chan struct{}),
+			sources: make(map[*SDKSource]*lksdk.RoomCallback),
+			tracks:  make(map[string]*SDKSource),
+		}
+		c.rooms[key] = r
+		c.mu.Unlock()
+
+		s.logger.Debugw("connecting to shared room")
+		r.room = lksdk.CreateRoom(r.callback())
+		r.err = r.room.JoinWithToken(p.WsUrl, p.Token, connectOptions(p)...)
+		close(r.ready)
+		if r.err != nil {
+			c.remove(r)
+			return nil, r.err
+		}
+	} else {
+		c.mu.Unlock()
+		<-r.ready
+		if r.err != nil {
+			return nil, r.err
+		}
+	}
+
+	if !r.claim(s, cb, tracks) {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// getPoolKey returns the key of the connections a source can share. The connection joins with the token of the first source,
+// so only sources with a token from the same api key share it, and visible participants are keyed by their own identity.
+func getPoolKey(p *config.PipelineConfig) (string, bool) {
+	v, err := auth.ParseAPIToken(p.Token)
+	if err != nil {
+		return "", false
+	}
+
+	key := p.WsUrl + "/" + p.Info.RoomName + "/" + v.APIKey()
+	if p.Participant != nil && p.Participant.Visible {
+		key += "/" + v.Identity()
+	}
+	return key, true
+}
+
+func (c *connectionPool) remove(r *sharedRoom) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.rooms[r.key] == r {
+		delete(c.rooms, r.key)
+	}
+}
+
+func (r *sharedRoom) claim(s *SDKSource, cb *lksdk.RoomCallback, tracks map[string]struct{}) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return false
+	}
+	// each track can only be read by one source
+	for trackID := range tracks {
+		if _, ok := r.tracks[trackID]; ok {
+			return false
+		}
+	}
+
+	for trackID := range tracks {
+		r.tracks[trackID] = s
+	}
+	r.sources[s] = cb
+	r.refs++
+	return true
+}
+
+// leave unsubscribes from the source's tracks, and disconnects once no sources are left
+func (r *sharedRoom) leave(s *SDKSource) {
+	owned, disconnect := r.release(s)
+	if disconnect {
+		roomPool.remove(r)
+		r.room.Disconnect()
+		return
+	}
+
+	for _, rp := range r.room.GetParticipants() {
+		for _, pub := range rp.Tracks() {
+			if _, ok := owned[pub.SID()]; ok {
+				if remote, ok := pub.(*lksdk.RemoteTrackPublication); ok {
+					_ = remote.SetSubscribed(false)
+				}
+			}
+		}
+	}
+}
+
+// release removes the source, returning the tracks it owned, and true if it was the last source
+func (r *sharedRoom) release(s *SDKSource) (map[string]struct{}, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sources[s]; !ok {
+		return nil, false
+	}
+
+	owned := make(map[string]struct{})
+	for trackID, source := range r.tracks {
+		if source == s {
+			owned[trackID] = struct{}{}
+			delete(r.tracks, trackID)
+		}
+	}
+	delete(r.sources, s)
+	r.refs--
+	disconnect := r.refs == 0
+	if disconnect {
+		r.closed = true
+	}
+	return owned, disconnect
+}
+
+func (r *sharedRoom) getCallbacks() []*lksdk.RoomCallback {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	callbacks := make([]*lksdk.RoomCallback, 0, len(r.sources))
+	for _, cb := range r.sources {
+		callbacks = append(callbacks, cb)
+	}
+	return callbacks
+}
+
+func (r *sharedRoom) getTrackCallback(trackID string) *lksdk.RoomCallback {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s, ok := r.tracks[trackID]; ok {
+		return r.sources[s]
+	}
+	return nil
+}
+
+// callback routes track subscriptions to the source which owns the track, and everything else to every source
+func (r *sharedRoom) callback() *lksdk.RoomCallback {
+	return &lksdk.RoomCallback{
+		ParticipantCallback: lksdk.ParticipantCallback{
+			OnTrackMuted: func(pub lksdk.TrackPublication, p lksdk.Participant) {
+				for _, cb := range r.getCallbacks() {
+					if cb.OnTrackMuted != nil {
+						cb.OnTrackMuted(pub, p)
+					}
+				}
+			},
+			OnTrackUnmuted: func(pub lksdk.TrackPublication, p lksdk.Participant) {
+				for _, cb := range r.getCallbacks() {
+					if cb.OnTrackUnmuted != nil {
+						cb.OnTrackUnmuted(pub, p)
+					}
+				}
+			},
+			OnMetadataChanged: func(oldMetadata string, p lksdk.Participant) {
+				for _, cb := range r.getCallbacks() {
+					if cb.OnMetadataChanged != nil {
+						cb.OnMetadataChanged(oldMetadata, p)
+					}
+				}
+			},
+			OnIsSpeakingChanged: func(p lksdk.Participant) {
+				for _, cb := range r.getCallbacks() {
+					if cb.OnIsSpeakingChanged != nil {
+						cb.OnIsSpeakingChanged(p)
+					}
+				}
+			},
+			OnConnectionQualityChanged: func(update *livekit.ConnectionQualityInfo, p lksdk.Participant) {
+				for _, cb := range r.getCallbacks() {
+					if cb.OnConnectionQualityChanged != nil {
+						cb.OnConnectionQualityChanged(update, p)
+					}
+				}
+			},
+			OnTrackSubscribed: func(track *webrtc.TrackRemote, pub *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
+				if cb := r.getTrackCallback(pub.SID()); cb != nil && cb.OnTrackSubscribed != nil {
+					cb.OnTrackSubscribed(track, pub, rp)
+				}
+			},
+			OnTrackUnsubscribed: func(track *webrtc.TrackRemote, pub *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
+				if cb := r.getTrackCallback(pub.SID()); cb != nil && cb.OnTrackUnsubscribed != nil {
+					cb.OnTrackUnsubscribed(track, pub, rp)
+				}
+			},
+			OnTrackSubscriptionFailed: func(sid string, rp *lksdk.RemoteParticipant) {
+				if cb := r.getTrackCallback(sid); cb != nil && cb.OnTrackSubscriptionFailed != nil {
+					cb.OnTrackSubscriptionFailed(sid, rp)
+				}
+			},
+			OnTrackPublished: func(pub *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
+				for _, cb := range r.getCallbacks() {
+					if cb.OnTrackPublished != nil {
+						cb.OnTrackPublished(pub, rp)
+					}
+				}
+			},
+			OnTrackUnpublished: func(pub *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
+				for _, cb := range r.getCallbacks() {
+					if cb.OnTrackUnpublished != nil {
+						cb.OnTrackUnpublished(pub, rp)
+					}
+				}
+			},
+			OnDataReceived: func(data []byte, rp *lksdk.RemoteParticipant) {
+				for _, cb := range r.getCallbacks() {
+					if cb.OnDataReceived != nil {
+						cb.OnDataReceived(data, rp)
+					}
+				}
+			},
+		},
+		OnParticipantConnected: func(rp *lksdk.RemoteParticipant) {
+			for _, cb := range r.getCallbacks() {
+				if cb.OnParticipantConnected != nil {
+					cb.OnParticipantConnected(rp)
+				}
+			}
+		},
+		OnParticipantDisconnected: func(rp *lksdk.RemoteParticipant) {
+			for _, cb := range r.getCallbacks() {
+				if cb.OnParticipantDisconnected != nil {
+					cb.OnParticipantDisconnected(rp)
+				}
+			}
+		},
+		OnActiveSpeakersChanged: func(speakers []lksdk.Participant) {
+			for _, cb := range r.getCallbacks() {
+				if cb.OnActiveSpeakersChanged != nil {
+					cb.OnActiveSpeakersChanged(speakers)
+				}
+			}
+		},
+		OnRoomMetadataChanged: func(metadata string) {
+			for _, cb := range r.getCallbacks() {
+				if cb.OnRoomMetadataChanged != nil {
+					cb.OnRoomMetadataChanged(metadata)
+				}
+			}
+		},
+		OnReconnecting: func() {
+			for _, cb := range r.getCallbacks() {
+				if cb.OnReconnecting != nil {
+					cb.OnReconnecting()
+				}
+			}
+		},
+		OnReconnected: func() {
+			for _, cb := range r.getCallbacks() {
+				if cb.OnReconnected != nil {
+					cb.OnReconnected()
+				}
+			}
+		},
+		OnDisconnected: func() {
+			// new sources need a new connection
+			r.mu.Lock()
+			r.closed = true
+			r.mu.Unlock()
+			roomPool.remove(r)
+
+			for _, cb := range r.getCallbacks() {
+				if cb.OnDisconnected != nil {
+					cb.OnDisconnected()
+				}
+			}
+		},
+	}
+}
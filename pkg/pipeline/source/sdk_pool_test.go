@@ -0,0 +1,129 @@
+package source
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/protocol/auth"
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go"
+)
+
+func newTestSharedRoom() *sharedRoom {
+	return &sharedRoom{
+		ready:   make(chan struct{}),
+		sources: make(map[*SDKSource]*lksdk.RoomCallback),
+		tracks:  make(map[string]*SDKSource),
+	}
+}
+
+func TestSharedRoomClaim(t *testing.T) {
+	r := newTestSharedRoom()
+	a, b, c := &SDKSource{}, &SDKSource{}, &SDKSource{}
+
+	require.True(t, r.claim(a, &lksdk.RoomCallback{}, map[string]struct{}{"TR_audio": {}, "TR_video": {}}))
+	require.True(t, r.claim(b, &lksdk.RoomCallback{}, map[string]struct{}{"TR_other": {}}))
+
+	// tracks belong to a single source
+	require.False(t, r.claim(c, &lksdk.RoomCallback{}, map[string]struct{}{"TR_video": {}, "TR_new": {}}))
+	require.NotContains(t, r.tracks, "TR_new")
+	require.NotContains(t, r.sources, c)
+	require.Equal(t, 2, r.refs)
+
+	owned, disconnect := r.release(a)
+	require.False(t, disconnect)
+	require.Equal(t, map[string]struct{}{"TR_audio": {}, "TR_video": {}}, owned)
+	require.Equal(t, 1, r.refs)
+
+	// released tracks can be claimed again
+	require.True(t, r.claim(c, &lksdk.RoomCallback{}, map[string]struct{}{"TR_video": {}}))
+	require.Equal(t, c, r.tracks["TR_video"])
+
+	// leaving twice does not release the connection early
+	_, disconnect = r.release(a)
+	require.False(t, disconnect)
+	require.Equal(t, 2, r.refs)
+
+	_, disconnect = r.release(b)
+	require.False(t, disconnect)
+	_, disconnect = r.release(c)
+	require.True(t, disconnect)
+	require.Equal(t, 0, r.refs)
+	require.Empty(t, r.tracks)
+
+	// closed connections can't be claimed
+	require.False(t, r.claim(a, &lksdk.RoomCallback{}, nil))
+}
+
+func TestSharedRoomCallbacks(t *testing.T) {
+	r := newTestSharedRoom()
+
+	connected := 0
+	metadata := make([]string, 0)
+	reconnecting := 0
+	require.True(t, r.claim(&SDKSource{}, &lksdk.RoomCallback{
+		OnParticipantConnected: func(_ *lksdk.RemoteParticipant) { connected++ },
+		OnRoomMetadataChanged:  func(m string) { metadata = append(metadata, m) },
+		OnReconnecting:         func() { reconnecting++ },
+	}, nil))
+	require.True(t, r.claim(&SDKSource{}, &lksdk.RoomCallback{
+		OnParticipantConnected: func(_ *lksdk.RemoteParticipant) { connected++ },
+	}, nil))
+
+	cb := r.callback()
+	cb.OnParticipantConnected(nil)
+	cb.OnRoomMetadataChanged("metadata")
+	cb.OnReconnecting()
+	cb.OnReconnected()
+	cb.OnDataReceived([]byte("data"), nil)
+	cb.OnTrackSubscriptionFailed("TR_unknown", nil)
+
+	require.Equal(t, 2, connected)
+	require.Equal(t, []string{"metadata"}, metadata)
+	require.Equal(t, 1, reconnecting)
+}
+
+func TestPoolKey(t *testing.T) {
+	newConfig := func(apiKey, identity string, participant *config.ParticipantConfig) *config.PipelineConfig {
+		token, err := auth.NewAccessToken(apiKey, "secret").
+			SetIdentity(identity).
+			AddGrant(&auth.VideoGrant{RoomJoin: true, Room: "room"}).
+			ToJWT()
+		require.NoError(t, err)
+
+		p := &config.PipelineConfig{
+			Info:  &livekit.EgressInfo{RoomName: "room"},
+			Token: token,
+		}
+		p.WsUrl = "wss://livekit.example.com"
+		p.Participant = participant
+		return p
+	}
+
+	a, ok := getPoolKey(newConfig("key", "EG_a", nil))
+	require.True(t, ok)
+	b, ok := getPoolKey(newConfig("key", "EG_b", nil))
+	require.True(t, ok)
+	require.Equal(t, a, b)
+
+	// tokens from another api key get their own connection
+	other, ok := getPoolKey(newConfig("other", "EG_c", nil))
+	require.True(t, ok)
+	require.NotEqual(t, a, other)
+
+	// visible participants are keyed by identity
+	visible := &config.ParticipantConfig{Visible: true}
+	c, ok := getPoolKey(newConfig("key", "EG_c", visible))
+	require.True(t, ok)
+	d, ok := getPoolKey(newConfig("key", "EG_d", visible))
+	require.True(t, ok)
+	require.NotEqual(t, a, c)
+	require.NotEqual(t, c, d)
+
+	p := newConfig("key", "EG_e", nil)
+	p.Token = "invalid"
+	_, ok = getPoolKey(p)
+	require.False(t, ok)
+}
@@ -0,0 +1,191 @@
+package source
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v3"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/source/sdk"
+	"github.com/livekit/egress/pkg/util"
+	lksdk "github.com/livekit/server-sdk-go"
+)
+
+const (
+	rejoinBackoff    = time.Second
+	rejoinMaxBackoff = time.Second * 5
+)
+
+var (
+	errSourceClosed        = errors.New("source closed")
+	errResubscribeTimedOut = errors.New("tracks were not resubscribed in time")
+)
+
+// OnSignalingOutage is called when the room connection drops and is rejoined
+func (s *SDKSource) OnSignalingOutage(onOutage func(bool)) {
+	s.onOutage = onOutage
+}
+
+// onRoomDisconnected rejoins the room if sdk reconnects are enabled, and otherwise ends the recording
+func (s *SDKSource) onRoomDisconnected() {
+	select {
+	case <-s.endRecording:
+		return
+	default:
+	}
+
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+
+	if closed {
+		s.onDisconnected(config.EndTriggerRoomClosed)
+		return
+	}
+	if s.maxOutage == 0 || s.shared != nil {
+		s.onRoomClosed()
+		return
+	}
+	if !s.rejoining.CompareAndSwap(false, true) {
+		return
+	}
+
+	// writers keep their pipeline position, filling the gap until their tracks are resubscribed
+	for _, w := range s.getWriters() {
+		w.Interrupt()
+	}
+	if s.onOutage != nil {
+		s.onOutage(true)
+	}
+
+	go s.rejoin()
+}
+
+func (s *SDKSource) rejoin() {
+	defer s.rejoining.Store(false)
+
+	s.logger.Warnw("room disconnected, rejoining", nil, "maxOutage", s.maxOutage)
+	start := time.Now()
+
+	var err error
+	backoff := util.Backoff{
+		Immediate:  true,
+		Backoff:    rejoinBackoff,
+		MaxBackoff: rejoinMaxBackoff,
+		Window:     s.maxOutage,
+	}
+	if backoff.Retry(s.endRecording, func(attempt int) bool {
+		if err = s.rejoinRoom(); err == nil {
+			s.logger.Infow("room rejoined", "attempt", attempt, "outage", time.Since(start))
+			if s.onOutage != nil {
+				s.onOutage(false)
+			}
+			return true
+		}
+		if err == errSourceClosed {
+			return true
+		}
+		s.logger.Debugw("could not rejoin room", "attempt", attempt, "error", err)
+		return false
+	}) {
+		return
+	}
+
+	select {
+	case <-s.endRecording:
+		return
+	default:
+	}
+	s.logger.Warnw("could not rejoin room", err)
+	s.onRoomClosed()
+}
+
+// onRoomClosed ends the recording, unless only StopEgress ends the egress.
+// In that case the writers are held until then, filling the rest with blank frames
+func (s *SDKSource) onRoomClosed() {
+	if s.endTrigger != config.EndTriggerStopEgress {
+		s.onDisconnected(config.EndTriggerRoomClosed)
+		return
+	}
+
+	s.logger.Infow("room closed, waiting for StopEgress")
+	for _, w := range s.getWriters() {
+		w.Interrupt()
+	}
+}
+
+// rejoinRoom connects to the room again, and resumes each writer from its new subscription
+func (s *SDKSource) rejoinRoom() error {
+	tracks := make(map[string]struct{})
+	for _, trackID := range []string{s.trackID, s.audioTrackID, s.videoTrackID} {
+		if trackID != "" && s.getWriterForTrack(trackID) != nil {
+			tracks[trackID] = struct{}{}
+		}
+	}
+	for trackID, a := range s.alternateAudio {
+		if a.writer != nil {
+			tracks[trackID] = struct{}{}
+		}
+	}
+	expected := len(tracks)
+
+	subscribed := make(chan struct{}, expected)
+	cb := *s.callback
+	cb.OnTrackSubscribed = func(track *webrtc.TrackRemote, pub *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
+		s.logger.Debugw("track resubscribed", "trackID", track.ID())
+		if w := s.getWriterForTrack(pub.SID()); w != nil {
+			w.Resume(track, rp)
+			select {
+			case subscribed <- struct{}{}:
+			default:
+			}
+		}
+	}
+
+	room := lksdk.CreateRoom(&cb)
+	if err := room.JoinWithToken(s.wsUrl, s.token, s.opts...); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		room.Disconnect()
+		return errSourceClosed
+	}
+	s.room = room
+	s.mu.Unlock()
+
+	if err := s.subscribeToTracks(tracks); err != nil {
+		room.Disconnect()
+		return err
+	}
+
+	timeout := time.After(subscriptionTimeout)
+	for i := 0; i < expected; i++ {
+		select {
+		case <-subscribed:
+		case <-timeout:
+			room.Disconnect()
+			return errResubscribeTimedOut
+		}
+	}
+	return nil
+}
+
+func (s *SDKSource) getWriters() []*sdk.AppWriter {
+	var writers []*sdk.AppWriter
+	if s.audioWriter != nil {
+		writers = append(writers, s.audioWriter)
+	}
+	if s.videoWriter != nil {
+		writers = append(writers, s.videoWriter)
+	}
+	for _, a := range s.alternateAudio {
+		if a.writer != nil {
+			writers = append(writers, a.writer)
+		}
+	}
+	return writers
+}
@@ -11,6 +11,7 @@ import (
 type Source interface {
 	StartRecording() chan struct{}
 	EndRecording() chan struct{}
+	EndedBy() string // the end trigger which closed EndRecording
 	Close()
 }
 
@@ -5,10 +5,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"net/url"
 	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,29 +25,28 @@ import (
 const (
 	startRecordingLog = "START_RECORDING"
 	endRecordingLog   = "END_RECORDING"
+
+	pulseHandlerProperty = "egress.handler_pid"
 )
 
 type WebSource struct {
 	pulseSink    string
+	display      *display
 	xvfb         *exec.Cmd
 	chromeCancel context.CancelFunc
 
 	startRecording chan struct{}
 	endRecording   chan struct{}
-}
-
-func init() {
-	rand.Seed(time.Now().UnixNano())
+	ignoreEnd      bool // END_RECORDING is logged, but only StopEgress ends the egress
 }
 
 func NewWebSource(ctx context.Context, p *config.PipelineConfig) (*WebSource, error) {
 	ctx, span := tracer.Start(ctx, "WebInput.New")
 	defer span.End()
 
-	p.Display = fmt.Sprintf(":%d", 10+rand.Intn(2147483637))
-
 	s := &WebSource{
 		endRecording: make(chan struct{}),
+		ignoreEnd:    p.EndTrigger == config.EndTriggerStopEgress,
 	}
 	if p.AwaitStartSignal {
 		s.startRecording = make(chan struct{})
@@ -58,13 +58,29 @@ func NewWebSource(ctx context.Context, p *config.PipelineConfig) (*WebSource, er
 		return nil, err
 	}
 
-	if err := s.launchXvfb(ctx, p); err != nil {
+	// xvfb and chrome launches are serialized across the node
+	slot, err := acquireLaunchSlot(p)
+	if err != nil {
+		logger.Errorw("failed to acquire chrome launch slot", err)
+		s.Close()
+		return nil, err
+	}
+	defer slot.Release()
+
+	if s.display, err = allocateDisplay(p); err != nil {
+		logger.Errorw("failed to allocate display", err)
+		s.Close()
+		return nil, err
+	}
+	p.Display = s.display.String()
+
+	if err = s.launchXvfb(ctx, p); err != nil {
 		logger.Errorw("failed to launch xvfb", err, "display", p.Display)
 		s.Close()
 		return nil, err
 	}
 
-	if err := s.launchChrome(ctx, p, p.Insecure); err != nil {
+	if err = s.launchChromeWithRetries(ctx, p); err != nil {
 		logger.Errorw("failed to launch chrome", err, "display", p.Display)
 		s.Close()
 		return nil, err
@@ -81,6 +97,10 @@ func (s *WebSource) EndRecording() chan struct{} {
 	return s.endRecording
 }
 
+func (s *WebSource) EndedBy() string {
+	return config.EndTriggerTemplate
+}
+
 func (s *WebSource) Close() {
 	if s.chromeCancel != nil {
 		s.chromeCancel()
@@ -95,6 +115,11 @@ func (s *WebSource) Close() {
 		s.xvfb = nil
 	}
 
+	if s.display != nil {
+		s.display.Release()
+		s.display = nil
+	}
+
 	if s.pulseSink != "" {
 		err := exec.Command("pactl", "unload-module", s.pulseSink).Run()
 		if err != nil {
@@ -117,23 +142,60 @@ func (s *WebSource) createPulseSink(ctx context.Context, p *config.PipelineConfi
 	ctx, span := tracer.Start(ctx, "WebInput.createPulseSink")
 	defer span.End()
 
+	// sinks of handlers which died were never unloaded
+	reclaimPulseSinks()
+
+	// the sink is tagged with the handler pid, so that it can be reclaimed
 	cmd := exec.Command("pactl",
 		"load-module", "module-null-sink",
 		fmt.Sprintf("sink_name=\"%s\"", p.Info.EgressId),
-		fmt.Sprintf("sink_properties=device.description=\"%s\"", p.Info.EgressId),
+		fmt.Sprintf("sink_properties='device.description=\"%s\" %s=%d'", p.Info.EgressId, pulseHandlerProperty, os.Getpid()),
+		fmt.Sprintf("rate=%d", p.PulseSink.SampleRate),
+		fmt.Sprintf("channels=%d", p.PulseSink.Channels),
 	)
 	var b bytes.Buffer
 	cmd.Stdout = &b
 	cmd.Stderr = &errorLogger{cmd: "pactl"}
 	err := cmd.Run()
 	if err != nil {
-		return errors.Fatal(errors.ErrProcessStartFailed(err))
+		return errors.Fatal(errors.Retryable(errors.ErrProcessStartFailed(err)))
 	}
 
 	s.pulseSink = strings.TrimRight(b.String(), "\n")
 	return nil
 }
 
+var pulseHandlerRegexp = regexp.MustCompile(pulseHandlerProperty + `=(\d+)`)
+
+// reclaimPulseSinks unloads egress sinks whose handler process no longer exists
+func reclaimPulseSinks() {
+	out, err := exec.Command("pactl", "list", "short", "modules").Output()
+	if err != nil {
+		logger.Warnw("failed to list pulse modules", err)
+		return
+	}
+
+	// each line is "<index>\t<name>\t<args>"
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) < 3 || fields[1] != "module-null-sink" {
+			continue
+		}
+		match := pulseHandlerRegexp.FindStringSubmatch(fields[2])
+		if match == nil {
+			continue
+		}
+		if pid, _ := strconv.Atoi(match[1]); processExists(pid) {
+			continue
+		}
+
+		logger.Infow("unloading orphaned pulse sink", "module", fields[0], "pid", match[1])
+		if err = exec.Command("pactl", "unload-module", fields[0]).Run(); err != nil {
+			logger.Warnw("failed to unload orphaned pulse sink", err, "module", fields[0])
+		}
+	}
+}
+
 // creates a new xvfb display
 func (s *WebSource) launchXvfb(ctx context.Context, p *config.PipelineConfig) error {
 	ctx, span := tracer.Start(ctx, "WebInput.launchXvfb")
@@ -144,13 +206,40 @@ func (s *WebSource) launchXvfb(ctx context.Context, p *config.PipelineConfig) er
 	xvfb := exec.Command("Xvfb", p.Display, "-screen", "0", dims, "-ac", "-nolisten", "tcp")
 	xvfb.Stderr = &errorLogger{cmd: "xvfb"}
 	if err := xvfb.Start(); err != nil {
-		return errors.Fatal(errors.ErrProcessStartFailed(err))
+		return errors.Fatal(errors.Retryable(errors.ErrProcessStartFailed(err)))
 	}
 
 	s.xvfb = xvfb
 	return nil
 }
 
+// pageError is shown by the template, so relaunching chrome would not help
+type pageError string
+
+func (e pageError) Error() string {
+	return string(e)
+}
+
+// relaunches chrome with backoff after launch failures and timeouts
+func (s *WebSource) launchChromeWithRetries(ctx context.Context, p *config.PipelineConfig) error {
+	backoff := p.ChromeLaunch.Backoff
+	for attempt := 0; ; attempt++ {
+		err := s.launchChrome(ctx, p, p.Insecure)
+		var pageErr pageError
+		if err == nil || attempt >= p.ChromeLaunch.Retries || errors.As(err, &pageErr) {
+			return err
+		}
+
+		logger.Warnw("chrome launch failed, retrying", err, "attempt", attempt+1, "backoff", backoff)
+		if s.chromeCancel != nil {
+			s.chromeCancel()
+			s.chromeCancel = nil
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
 // launches chrome and navigates to the url
 func (s *WebSource) launchChrome(ctx context.Context, p *config.PipelineConfig, insecure bool) error {
 	ctx, span := tracer.Start(ctx, "WebInput.launchChrome")
@@ -249,8 +338,8 @@ func (s *WebSource) launchChrome(ctx context.Context, p *config.PipelineConfig,
 						}
 					}
 				case endRecordingLog:
-					logger.Infow("chrome: END_RECORDING")
-					if s.endRecording != nil {
+					logger.Infow("chrome: END_RECORDING", "ignored", s.ignoreEnd)
+					if s.endRecording != nil && !s.ignoreEnd {
 						select {
 						case <-s.endRecording:
 							continue
@@ -267,20 +356,30 @@ func (s *WebSource) launchChrome(ctx context.Context, p *config.PipelineConfig,
 	})
 
 	var errString string
-	err := chromedp.Run(chromeCtx,
-		chromedp.Navigate(webUrl),
-		chromedp.Evaluate(`
+	done := make(chan error, 1)
+	go func() {
+		done <- chromedp.Run(chromeCtx,
+			chromedp.Navigate(webUrl),
+			chromedp.Evaluate(`
 			if (document.querySelector('div.error')) {
 				document.querySelector('div.error').innerText;
 			} else {
 				''
 			}`, &errString,
-		),
-	)
-	if err == nil && errString != "" {
-		err = errors.New(errString)
+			),
+		)
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil && errString != "" {
+			err = pageError(errString)
+		}
+		return err
+	case <-time.After(p.ChromeLaunch.Timeout):
+		// the run ends once chrome is canceled
+		return errors.ErrProcessStartFailed(fmt.Errorf("chrome did not load the page within %s", p.ChromeLaunch.Timeout))
 	}
-	return err
 }
 
 func logChrome(eventType string, ev interface{ MarshalJSON() ([]byte, error) }) {
@@ -8,6 +8,7 @@ import (
 
 	"github.com/tinyzimmer/go-gst/gst"
 
+	"github.com/livekit/egress/pkg/clock"
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/pipeline/output"
 	"github.com/livekit/egress/pkg/pipeline/sink"
@@ -94,7 +95,14 @@ func (p *Pipeline) handleMessageError(gErr *gst.GError) error {
 			logger.Warnw("rtmp output not found", err, "url", url)
 			return err
 		}
-		return p.removeSink(context.Background(), url, gErr)
+		if p.RTMPReconnect != nil {
+			// keep buffering while reconnecting. Errors from a sink already being replaced are ignored
+			if p.out.BeginStreamReconnect(url) {
+				go p.reconnectStream(url, gErr)
+			}
+			return nil
+		}
+		return p.removeSink(context.Background(), url, errors.ErrStreamFailed(gErr))
 
 	case element == elementGstAppSrc:
 		if message == msgStreamingNotNegotiated {
@@ -143,12 +151,12 @@ func (p *Pipeline) handleMessageStateChanged(msg *gst.Message) {
 		return
 	}
 
-	switch s := msg.Source(); s {
-	case source.AudioAppSource, source.VideoAppSource:
+	switch s := msg.Source(); {
+	case source.IsAppSource(s):
 		logger.Infow(fmt.Sprintf("%s playing", s))
 		p.src.(*source.SDKSource).Playing(s)
 
-	case pipelineSource:
+	case s == pipelineSource:
 		logger.Infow("pipeline playing")
 
 		p.playing = true
@@ -156,7 +164,7 @@ func (p *Pipeline) handleMessageStateChanged(msg *gst.Message) {
 		case types.SourceTypeSDK:
 			p.updateStartTime(p.src.(*source.SDKSource).GetStartTime())
 		case types.SourceTypeWeb:
-			p.updateStartTime(time.Now().UnixNano())
+			p.updateStartTime(clock.Now().UnixNano())
 		}
 	}
 
@@ -178,7 +186,7 @@ func (p *Pipeline) handleMessageElement(msg *gst.Message) error {
 				return err
 			}
 
-			if err = p.getSegmentSink().StartSegment(filepath, t); err != nil {
+			if err = p.getSegmentSink(msg.Source()).StartSegment(filepath, t); err != nil {
 				logger.Errorw("failed to register new segment with playlist writer", err, "location", filepath, "running time", t)
 				return err
 			}
@@ -199,7 +207,7 @@ func (p *Pipeline) handleMessageElement(msg *gst.Message) error {
 			// We need to dispatch to a queue to:
 			// 1. Avoid concurrent access to the SegmentsInfo structure
 			// 2. Ensure that playlists are uploaded in the same order they are enqueued to avoid an older playlist overwriting a newer one
-			if err = p.getSegmentSink().EnqueueSegmentUpload(filepath, t); err != nil {
+			if err = p.getSegmentSink(msg.Source()).EnqueueSegmentUpload(filepath, t); err != nil {
 				logger.Errorw("failed to end segment with playlist writer", err, "running time", t)
 				return err
 			}
@@ -211,7 +219,7 @@ func (p *Pipeline) handleMessageElement(msg *gst.Message) error {
 			}
 			logger.Debugw("received FirstSampleMetadata message", "startDate", startDate)
 
-			p.getSegmentSink().UpdateStartDate(startDate)
+			p.getSegmentSink(msg.Source()).UpdateStartDate(startDate)
 		}
 	}
 
@@ -250,6 +258,7 @@ func getFirstSampleMetadataFromGstStructure(s *gst.Structure) (startDate time.Ti
 	return time.Unix(0, firstSampleMetadata.StartDate), nil
 }
 
-func (p *Pipeline) getSegmentSink() *sink.SegmentSink {
-	return p.sinks[types.EgressTypeSegments].(*sink.SegmentSink)
+// getSegmentSink returns the sink for the splitmuxsink which posted a message, which may be a rendition
+func (p *Pipeline) getSegmentSink(name string) *sink.SegmentSink {
+	return p.sinks[types.EgressTypeSegments].(*sink.SegmentSink).ForElement(name)
 }
@@ -0,0 +1,162 @@
+package pprof
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/frostbyte73/core"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/logger"
+)
+
+const (
+	pyroscopeAppName = "egress"
+	pyroscopeTimeout = time.Second * 10
+)
+
+// ContinuousProfiler periodically collects profiles for a single egress, to help diagnose gradual
+// memory or cpu growth in long recordings
+type ContinuousProfiler struct {
+	conf     *config.ProfilingConfig
+	nodeID   string
+	egressID string
+	tmpDir   string
+	uploader *uploader.Uploader
+	client   *http.Client
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   core.Fuse
+}
+
+func StartContinuousProfiler(p *config.PipelineConfig, egressID string) (*ContinuousProfiler, error) {
+	if p.Profiling == nil {
+		return nil, nil
+	}
+
+	c := &ContinuousProfiler{
+		conf:     p.Profiling,
+		nodeID:   p.NodeID,
+		egressID: egressID,
+		tmpDir:   p.TmpDir,
+		done:     core.NewFuse(),
+	}
+
+	if c.conf.PyroscopeURL != "" {
+		c.client = &http.Client{Timeout: pyroscopeTimeout}
+	} else {
+		u, err := uploader.New(p.GetDefaultUploadConfig(), "")
+		if err != nil {
+			return nil, err
+		}
+		c.uploader = u
+	}
+
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	go c.run()
+
+	return c, nil
+}
+
+func (c *ContinuousProfiler) Stop() {
+	if c == nil {
+		return
+	}
+	c.cancel()
+	<-c.done.Watch()
+}
+
+func (c *ContinuousProfiler) run() {
+	defer c.done.Break()
+
+	ticker := time.NewTicker(c.conf.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			for _, profile := range c.conf.Profiles {
+				if err := c.collect(profile); err != nil {
+					if c.ctx.Err() != nil {
+						return
+					}
+					logger.Warnw("failed to collect profile", err, "profile", profile)
+				}
+			}
+		}
+	}
+}
+
+func (c *ContinuousProfiler) collect(profile string) error {
+	from := time.Now()
+
+	var b []byte
+	var err error
+	if profile == cpuProfileName {
+		b, err = GetCpuProfileData(c.ctx, int(c.conf.CPUDuration.Seconds()))
+	} else {
+		b, err = GetGenericProfileData(profile, 0)
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.client != nil {
+		return c.sendToPyroscope(profile, b, from, time.Now())
+	}
+	return c.upload(profile, b, from)
+}
+
+func (c *ContinuousProfiler) upload(profile string, b []byte, from time.Time) error {
+	filename := fmt.Sprintf("%s_%s.pb.gz", profile, from.UTC().Format("20060102T150405Z"))
+	localFilepath := path.Join(c.tmpDir, filename)
+	if err := os.WriteFile(localFilepath, b, 0644); err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(localFilepath)
+	}()
+
+	storageFilepath := path.Join(c.conf.StoragePrefix, c.egressID, filename)
+	_, _, err := c.uploader.Upload(localFilepath, storageFilepath, types.OutputTypePProf)
+	return err
+}
+
+func (c *ContinuousProfiler) sendToPyroscope(profile string, b []byte, from, until time.Time) error {
+	query := url.Values{}
+	query.Set("name", fmt.Sprintf("%s.%s{egress_id=%s,node_id=%s}", pyroscopeAppName, profile, c.egressID, c.nodeID))
+	query.Set("from", fmt.Sprint(from.Unix()))
+	query.Set("until", fmt.Sprint(until.Unix()))
+	query.Set("format", "pprof")
+	query.Set("spyName", "gospy")
+
+	u := fmt.Sprintf("%s/ingest?%s", strings.TrimSuffix(c.conf.PyroscopeURL, "/"), query.Encode())
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", string(types.OutputTypePProf))
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("pyroscope returned %s", res.Status)
+	}
+	return nil
+}
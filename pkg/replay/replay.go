@@ -0,0 +1,144 @@
+package replay
+
+import (
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/sink"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/rpc"
+	"github.com/livekit/protocol/utils"
+)
+
+// output fields shared by every request type, in addition to the output oneof
+var repeatedOutputFields = []protoreflect.Name{"file_outputs", "stream_outputs", "segment_outputs"}
+
+// FromEgressInfo rebuilds the request which started an egress, with a new egress ID.
+// Upload credentials and stream keys are redacted in EgressInfo, so outputs usually need to be replaced.
+func FromEgressInfo(info *livekit.EgressInfo) (*rpc.StartEgressRequest, error) {
+	req := &rpc.StartEgressRequest{
+		EgressId: utils.NewGuid(utils.EgressPrefix),
+		RoomId:   info.RoomId,
+	}
+
+	switch r := info.Request.(type) {
+	case *livekit.EgressInfo_RoomComposite:
+		req.Request = &rpc.StartEgressRequest_RoomComposite{
+			RoomComposite: proto.Clone(r.RoomComposite).(*livekit.RoomCompositeEgressRequest),
+		}
+	case *livekit.EgressInfo_Web:
+		req.Request = &rpc.StartEgressRequest_Web{
+			Web: proto.Clone(r.Web).(*livekit.WebEgressRequest),
+		}
+	case *livekit.EgressInfo_TrackComposite:
+		req.Request = &rpc.StartEgressRequest_TrackComposite{
+			TrackComposite: proto.Clone(r.TrackComposite).(*livekit.TrackCompositeEgressRequest),
+		}
+	case *livekit.EgressInfo_Track:
+		req.Request = &rpc.StartEgressRequest_Track{
+			Track: proto.Clone(r.Track).(*livekit.TrackEgressRequest),
+		}
+	default:
+		return nil, errors.ErrInvalidInput("request")
+	}
+
+	return req, nil
+}
+
+// FromManifest rebuilds a request from an egress manifest, with a new egress ID.
+// Manifests do not include outputs or encoding options, so outputs must be added with ReplaceOutputs.
+func FromManifest(m *sink.Manifest) (*rpc.StartEgressRequest, error) {
+	req := &rpc.StartEgressRequest{
+		EgressId: utils.NewGuid(utils.EgressPrefix),
+		RoomId:   m.RoomID,
+	}
+
+	switch {
+	case m.TrackID != "":
+		req.Request = &rpc.StartEgressRequest_Track{
+			Track: &livekit.TrackEgressRequest{
+				RoomName: m.RoomName,
+				TrackId:  m.TrackID,
+			},
+		}
+	case m.AudioTrackID != "" || m.VideoTrackID != "":
+		req.Request = &rpc.StartEgressRequest_TrackComposite{
+			TrackComposite: &livekit.TrackCompositeEgressRequest{
+				RoomName:     m.RoomName,
+				AudioTrackId: m.AudioTrackID,
+				VideoTrackId: m.VideoTrackID,
+			},
+		}
+	case m.RoomName != "":
+		req.Request = &rpc.StartEgressRequest_RoomComposite{
+			RoomComposite: &livekit.RoomCompositeEgressRequest{
+				RoomName: m.RoomName,
+			},
+		}
+	case m.Url != "":
+		req.Request = &rpc.StartEgressRequest_Web{
+			Web: &livekit.WebEgressRequest{
+				Url: m.Url,
+			},
+		}
+	default:
+		return nil, errors.ErrInvalidInput("manifest")
+	}
+
+	return req, nil
+}
+
+// ReplaceOutputs updates the request with every field set in overrides, which is json for the same
+// request type (for example a RoomCompositeEgressRequest). If overrides contains any outputs, all
+// existing outputs are removed first.
+func ReplaceOutputs(req *rpc.StartEgressRequest, overrides []byte) error {
+	r := req.ProtoReflect()
+	oneof := r.Descriptor().Oneofs().ByName("request")
+	fd := r.WhichOneof(oneof)
+	if fd == nil {
+		return errors.ErrInvalidInput("request")
+	}
+	inner := r.Mutable(fd).Message()
+
+	o := inner.New()
+	if err := protojson.Unmarshal(overrides, o.Interface()); err != nil {
+		return errors.ErrInvalidInput("outputs")
+	}
+
+	if hasOutputs(o) {
+		clearOutputs(inner)
+	}
+	o.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		inner.Set(fd, v)
+		return true
+	})
+
+	return nil
+}
+
+func hasOutputs(m protoreflect.Message) bool {
+	if oneof := m.Descriptor().Oneofs().ByName("output"); oneof != nil && m.WhichOneof(oneof) != nil {
+		return true
+	}
+	for _, name := range repeatedOutputFields {
+		if fd := m.Descriptor().Fields().ByName(name); fd != nil && m.Has(fd) {
+			return true
+		}
+	}
+	return false
+}
+
+func clearOutputs(m protoreflect.Message) {
+	if oneof := m.Descriptor().Oneofs().ByName("output"); oneof != nil {
+		if fd := m.WhichOneof(oneof); fd != nil {
+			m.Clear(fd)
+		}
+	}
+	for _, name := range repeatedOutputFields {
+		if fd := m.Descriptor().Fields().ByName(name); fd != nil {
+			m.Clear(fd)
+		}
+	}
+}
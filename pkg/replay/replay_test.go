@@ -0,0 +1,60 @@
+package replay
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/pipeline/sink"
+	"github.com/livekit/protocol/livekit"
+)
+
+func TestFromEgressInfo(t *testing.T) {
+	info := &livekit.EgressInfo{
+		EgressId: "EG_original",
+		RoomId:   "RM_room",
+		Request: &livekit.EgressInfo_RoomComposite{
+			RoomComposite: &livekit.RoomCompositeEgressRequest{
+				RoomName: "room",
+				Layout:   "speaker",
+				Output: &livekit.RoomCompositeEgressRequest_File{
+					File: &livekit.EncodedFileOutput{Filepath: "old.mp4"},
+				},
+			},
+		},
+	}
+
+	req, err := FromEgressInfo(info)
+	require.NoError(t, err)
+	require.NotEqual(t, info.EgressId, req.EgressId)
+	require.Equal(t, "RM_room", req.RoomId)
+	require.Equal(t, "speaker", req.GetRoomComposite().Layout)
+
+	err = ReplaceOutputs(req, []byte(`{"stream_outputs": [{"urls": ["rtmp://localhost/live/key"]}]}`))
+	require.NoError(t, err)
+
+	rc := req.GetRoomComposite()
+	require.Nil(t, rc.GetFile())
+	require.Len(t, rc.StreamOutputs, 1)
+	require.Equal(t, "speaker", rc.Layout)
+
+	// original info is unchanged
+	require.NotNil(t, info.GetRoomComposite().GetFile())
+}
+
+func TestFromManifest(t *testing.T) {
+	req, err := FromManifest(&sink.Manifest{RoomName: "room", TrackID: "TR_track"})
+	require.NoError(t, err)
+	require.Equal(t, "TR_track", req.GetTrack().TrackId)
+
+	req, err = FromManifest(&sink.Manifest{RoomName: "room", AudioTrackID: "TR_audio"})
+	require.NoError(t, err)
+	require.Equal(t, "TR_audio", req.GetTrackComposite().AudioTrackId)
+
+	req, err = FromManifest(&sink.Manifest{Url: "https://livekit.io"})
+	require.NoError(t, err)
+	require.Equal(t, "https://livekit.io", req.GetWeb().Url)
+
+	_, err = FromManifest(&sink.Manifest{})
+	require.Error(t, err)
+}
@@ -0,0 +1,117 @@
+package results
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Manifest is the <filename>.json (or <playlist>.json) file uploaded next to file and segment outputs, with manifest_format v1
+type Manifest struct {
+	EgressID          string `json:"egress_id,omitempty"`
+	RoomID            string `json:"room_id,omitempty"`
+	RoomName          string `json:"room_name,omitempty"`
+	Url               string `json:"url,omitempty"`
+	StartedAt         int64  `json:"started_at,omitempty"`
+	EndedAt           int64  `json:"ended_at,omitempty"`
+	PublisherIdentity string `json:"publisher_identity,omitempty"`
+	TrackID           string `json:"track_id,omitempty"`
+	TrackKind         string `json:"track_kind,omitempty"`
+	TrackSource       string `json:"track_source,omitempty"`
+	AudioTrackID      string `json:"audio_track_id,omitempty"`
+	VideoTrackID      string `json:"video_track_id,omitempty"`
+	SegmentCount      int64  `json:"segment_count,omitempty"`
+	AudioCodec        string `json:"audio_codec,omitempty"`
+	AudioCodecReason  string `json:"audio_codec_reason,omitempty"`
+	VideoCodec        string `json:"video_codec,omitempty"`
+	VideoCodecReason  string `json:"video_codec_reason,omitempty"`
+	LimitReached      string `json:"limit_reached,omitempty"`
+	EndTrigger        string `json:"end_trigger,omitempty"`   // template, room_closed, participant_left or stop_egress
+	EndedBy           string `json:"ended_by,omitempty"`      // the end trigger, or limit_reached, trim or shutdown
+	FailureCause      string `json:"failure_cause,omitempty"` // user, system or unknown, if the egress failed
+	VideoLostAt       int64  `json:"video_lost_at,omitempty"`
+	SyncGroupID       string `json:"sync_group_id,omitempty"`
+	SyncEpoch         int64  `json:"sync_epoch,omitempty"`
+	StartOffset       int64  `json:"start_offset,omitempty"`
+
+	Checksums *Checksums       `json:"checksums,omitempty"` // of the file output
+	Preview   *Artifact        `json:"preview,omitempty"`   // the preview image, with step preview
+	Artifacts []*Artifact      `json:"artifacts,omitempty"`
+	Streams   []*StreamStats   `json:"streams,omitempty"`
+	Segments  []*SegmentEntry  `json:"segments,omitempty"`
+	Replicas  []*ReplicaStatus `json:"replicas,omitempty"`
+}
+
+// Artifact is an additional file produced by post-processing
+type Artifact struct {
+	Step     string `json:"step"`
+	Filename string `json:"filename"`
+	Location string `json:"location"`
+	Size     int64  `json:"size"`
+}
+
+type StreamStats struct {
+	Url            string `json:"url"` // redacted
+	Duration       int64  `json:"duration"`
+	BytesSent      uint64 `json:"bytes_sent"`
+	AverageBitrate int64  `json:"average_bitrate"` // bits per second
+	Reconnects     int    `json:"reconnects"`
+	Error          string `json:"error,omitempty"`
+	FailureCause   string `json:"failure_cause,omitempty"` // user, system or unknown, if the stream failed
+}
+
+// ReplicaStatus counts the files of the output uploaded to a replica
+type ReplicaStatus struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required,omitempty"` // the egress failed if any upload to the replica failed
+	Uploaded int    `json:"uploaded"`
+	Failed   int    `json:"failed"`
+	Error    string `json:"error,omitempty"` // the last failure
+}
+
+type SegmentEntry struct {
+	Filename     string    `json:"filename"`
+	Duration     float64   `json:"duration"`   // seconds
+	Size         int64     `json:"size"`       // bytes
+	StartPTS     int64     `json:"start_pts"`  // running time of the first buffer, in ns
+	StartTime    time.Time `json:"start_time"` // wall clock time of the first buffer
+	UploadStatus string    `json:"upload_status"`
+	SHA256       string    `json:"sha256,omitempty"`
+	MD5          string    `json:"md5,omitempty"`
+}
+
+// Checksums are hex encoded, of the file as stored
+type Checksums struct {
+	SHA256 string `json:"sha256,omitempty"`
+	MD5    string `json:"md5,omitempty"`
+}
+
+// ParseManifest parses a manifest of either format. Fields only in ManifestV2 are not returned
+func ParseManifest(b []byte) (*Manifest, error) {
+	version := &struct {
+		Version int `json:"version"`
+	}{}
+	if err := json.Unmarshal(b, version); err != nil {
+		return nil, err
+	}
+	if version.Version != 0 {
+		m, err := ParseManifestV2(b)
+		if err != nil {
+			return nil, err
+		}
+		return m.toManifest(), nil
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SyncOffset returns the time from the sync group epoch to the first sample, for aligning files from the same sync group
+func (m *Manifest) SyncOffset() (time.Time, time.Duration, bool) {
+	if m.SyncGroupID == "" {
+		return time.Time{}, 0, false
+	}
+	return time.Unix(0, m.SyncEpoch), time.Duration(m.StartOffset), true
+}
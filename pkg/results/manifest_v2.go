@@ -0,0 +1,155 @@
+package results
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const ManifestVersion2 = 2
+
+// ManifestV2 is the manifest written with manifest_format v2. Fields are only added to a version, never changed or removed
+type ManifestV2 struct {
+	Version     int             `json:"version"`
+	EgressID    string          `json:"egress_id"`
+	RoomID      string          `json:"room_id,omitempty"`
+	RoomName    string          `json:"room_name,omitempty"`
+	RequestType string          `json:"request_type"`      // room_composite, web, track_composite or track
+	Request     json.RawMessage `json:"request,omitempty"` // the egress request, without storage credentials or stream urls
+
+	Timings ManifestTimings `json:"timings"`
+	End     ManifestEnd     `json:"end"`
+	Source  ManifestSource  `json:"source"`
+	Video   *ManifestVideo  `json:"video,omitempty"`
+	Audio   *ManifestAudio  `json:"audio,omitempty"`
+	Sync    *ManifestSync   `json:"sync,omitempty"`
+
+	Outputs   []*ManifestOutput `json:"outputs"`
+	Preview   *Artifact         `json:"preview,omitempty"` // the preview image, with step preview
+	Artifacts []*Artifact       `json:"artifacts,omitempty"`
+	Replicas  []*ReplicaStatus  `json:"replicas,omitempty"`
+}
+
+// ManifestTimings are unix ns, except for the duration
+type ManifestTimings struct {
+	StartedAt   int64 `json:"started_at"`
+	EndedAt     int64 `json:"ended_at,omitempty"`
+	Duration    int64 `json:"duration,omitempty"` // ns
+	VideoLostAt int64 `json:"video_lost_at,omitempty"`
+}
+
+type ManifestEnd struct {
+	Trigger      string `json:"trigger,omitempty"`       // template, room_closed, participant_left or stop_egress
+	EndedBy      string `json:"ended_by,omitempty"`      // the trigger, or limit_reached, trim or shutdown
+	LimitReached string `json:"limit_reached,omitempty"` // the limit, if ended by limit_reached
+	FailureCause string `json:"failure_cause,omitempty"` // user, system or unknown, if the egress failed
+}
+
+type ManifestSource struct {
+	Url               string `json:"url,omitempty"`
+	PublisherIdentity string `json:"publisher_identity,omitempty"`
+	TrackID           string `json:"track_id,omitempty"`
+	TrackKind         string `json:"track_kind,omitempty"`
+	TrackSource       string `json:"track_source,omitempty"`
+	AudioTrackID      string `json:"audio_track_id,omitempty"`
+	VideoTrackID      string `json:"video_track_id,omitempty"`
+}
+
+type ManifestVideo struct {
+	Codec            string  `json:"codec"`
+	CodecReason      string  `json:"codec_reason,omitempty"`
+	Width            int32   `json:"width,omitempty"`
+	Height           int32   `json:"height,omitempty"`
+	Framerate        int32   `json:"framerate,omitempty"`
+	Bitrate          int32   `json:"bitrate,omitempty"` // kbps
+	KeyFrameInterval float64 `json:"key_frame_interval,omitempty"`
+}
+
+type ManifestAudio struct {
+	Codec       string `json:"codec"`
+	CodecReason string `json:"codec_reason,omitempty"`
+	Bitrate     int32  `json:"bitrate,omitempty"` // kbps
+	Frequency   int32  `json:"frequency,omitempty"`
+}
+
+type ManifestSync struct {
+	GroupID     string `json:"group_id"`
+	Epoch       int64  `json:"epoch"`        // unix ns
+	StartOffset int64  `json:"start_offset"` // ns from the epoch to the first sample
+}
+
+// ManifestOutput is the result of a file, proxy_file, segments or stream output, as of when the manifest was written
+type ManifestOutput struct {
+	Type       string     `json:"type"`
+	OutputType string     `json:"output_type,omitempty"` // content type
+	Filename   string     `json:"filename,omitempty"`    // storage path of the file or playlist
+	Location   string     `json:"location,omitempty"`
+	Size       int64      `json:"size,omitempty"`
+	Checksums  *Checksums `json:"checksums,omitempty"`
+
+	SegmentCount int64           `json:"segment_count,omitempty"`
+	Segments     []*SegmentEntry `json:"segments,omitempty"`
+	Streams      []*StreamStats  `json:"streams,omitempty"`
+}
+
+// ParseManifestV2 parses a manifest written with manifest_format v2
+func ParseManifestV2(b []byte) (*ManifestV2, error) {
+	m := &ManifestV2{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+	if m.Version != ManifestVersion2 {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	return m, nil
+}
+
+// toManifest returns the fields of the unversioned manifest
+func (m *ManifestV2) toManifest() *Manifest {
+	v1 := &Manifest{
+		EgressID:          m.EgressID,
+		RoomID:            m.RoomID,
+		RoomName:          m.RoomName,
+		Url:               m.Source.Url,
+		StartedAt:         m.Timings.StartedAt,
+		EndedAt:           m.Timings.EndedAt,
+		PublisherIdentity: m.Source.PublisherIdentity,
+		TrackID:           m.Source.TrackID,
+		TrackKind:         m.Source.TrackKind,
+		TrackSource:       m.Source.TrackSource,
+		AudioTrackID:      m.Source.AudioTrackID,
+		VideoTrackID:      m.Source.VideoTrackID,
+		LimitReached:      m.End.LimitReached,
+		EndTrigger:        m.End.Trigger,
+		EndedBy:           m.End.EndedBy,
+		FailureCause:      m.End.FailureCause,
+		VideoLostAt:       m.Timings.VideoLostAt,
+		Preview:           m.Preview,
+		Artifacts:         m.Artifacts,
+		Replicas:          m.Replicas,
+	}
+	if m.Video != nil {
+		v1.VideoCodec = m.Video.Codec
+		v1.VideoCodecReason = m.Video.CodecReason
+	}
+	if m.Audio != nil {
+		v1.AudioCodec = m.Audio.Codec
+		v1.AudioCodecReason = m.Audio.CodecReason
+	}
+	if m.Sync != nil {
+		v1.SyncGroupID = m.Sync.GroupID
+		v1.SyncEpoch = m.Sync.Epoch
+		v1.StartOffset = m.Sync.StartOffset
+	}
+	for _, o := range m.Outputs {
+		switch o.Type {
+		case "file":
+			v1.Checksums = o.Checksums
+		case "segments":
+			v1.SegmentCount = o.SegmentCount
+			v1.Segments = o.Segments
+		case "stream":
+			v1.Streams = o.Streams
+		}
+	}
+	return v1
+}
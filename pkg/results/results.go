@@ -0,0 +1,140 @@
+// Package results parses egress results, from EgressInfo updates and the json files uploaded next to outputs,
+// into typed structs. It does not depend on gstreamer, so it can be imported by applications using egress.
+package results
+
+import (
+	"encoding/json"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/livekit/egress/pkg/pipeline/qc"
+	"github.com/livekit/protocol/livekit"
+)
+
+// Result is the outcome of an egress
+type Result struct {
+	EgressID  string
+	RoomName  string
+	Status    livekit.EgressStatus
+	Error     string
+	StartedAt time.Time
+	EndedAt   time.Time
+
+	Files    []*File
+	Segments []*Segments
+	Streams  []*Stream
+}
+
+type File struct {
+	Filename  string // storage path
+	Location  string // url returned by the storage backend
+	Size      int64
+	StartedAt time.Time
+	EndedAt   time.Time
+	Duration  time.Duration
+}
+
+type Segments struct {
+	PlaylistName     string
+	PlaylistLocation string
+	SegmentCount     int64
+	Size             int64
+	Duration         time.Duration
+	StartedAt        time.Time
+	EndedAt          time.Time
+}
+
+type Stream struct {
+	URL       string // stream keys are redacted
+	Status    livekit.StreamInfo_Status
+	Error     string
+	StartedAt time.Time
+	EndedAt   time.Time
+	Duration  time.Duration
+}
+
+// ParseEgressInfo parses a json EgressInfo, such as a webhook payload or the response to ListEgress
+func ParseEgressInfo(b []byte) (*Result, error) {
+	info := &livekit.EgressInfo{}
+	if err := protojson.Unmarshal(b, info); err != nil {
+		return nil, err
+	}
+	return FromEgressInfo(info), nil
+}
+
+func FromEgressInfo(info *livekit.EgressInfo) *Result {
+	r := &Result{
+		EgressID:  info.EgressId,
+		RoomName:  info.RoomName,
+		Status:    info.Status,
+		Error:     info.Error,
+		StartedAt: fromUnixNano(info.StartedAt),
+		EndedAt:   fromUnixNano(info.EndedAt),
+	}
+
+	files := info.FileResults
+	if f := info.GetFile(); f != nil && len(files) == 0 {
+		// deprecated single result
+		files = []*livekit.FileInfo{f}
+	}
+	for _, f := range files {
+		r.Files = append(r.Files, &File{
+			Filename:  f.Filename,
+			Location:  f.Location,
+			Size:      f.Size,
+			StartedAt: fromUnixNano(f.StartedAt),
+			EndedAt:   fromUnixNano(f.EndedAt),
+			Duration:  time.Duration(f.Duration),
+		})
+	}
+
+	segments := info.SegmentResults
+	if s := info.GetSegments(); s != nil && len(segments) == 0 {
+		segments = []*livekit.SegmentsInfo{s}
+	}
+	for _, s := range segments {
+		r.Segments = append(r.Segments, &Segments{
+			PlaylistName:     s.PlaylistName,
+			PlaylistLocation: s.PlaylistLocation,
+			SegmentCount:     s.SegmentCount,
+			Size:             s.Size,
+			Duration:         time.Duration(s.Duration),
+			StartedAt:        fromUnixNano(s.StartedAt),
+			EndedAt:          fromUnixNano(s.EndedAt),
+		})
+	}
+
+	streams := info.StreamResults
+	if s := info.GetStream(); s != nil && len(streams) == 0 {
+		streams = s.Info
+	}
+	for _, s := range streams {
+		r.Streams = append(r.Streams, &Stream{
+			URL:       s.Url,
+			Status:    s.Status,
+			Error:     s.Error,
+			StartedAt: fromUnixNano(s.StartedAt),
+			EndedAt:   fromUnixNano(s.EndedAt),
+			Duration:  time.Duration(s.Duration),
+		})
+	}
+
+	return r
+}
+
+// ParseQCReport parses a <filename>.qc.json report, which includes the event timeline of the recording
+func ParseQCReport(b []byte) (*qc.Report, error) {
+	report := &qc.Report{}
+	if err := json.Unmarshal(b, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func fromUnixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
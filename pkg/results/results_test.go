@@ -0,0 +1,151 @@
+package results
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/livekit/protocol/livekit"
+)
+
+func TestFromEgressInfo(t *testing.T) {
+	info := &livekit.EgressInfo{
+		EgressId:  "EG_test",
+		RoomName:  "room",
+		Status:    livekit.EgressStatus_EGRESS_COMPLETE,
+		StartedAt: 1e18,
+		EndedAt:   1e18 + 60e9,
+		Result: &livekit.EgressInfo_File{
+			File: &livekit.FileInfo{
+				Filename: "recordings/room.mp4",
+				Location: "https://bucket.s3.amazonaws.com/recordings/room.mp4",
+				Size:     1024,
+				Duration: 60e9,
+			},
+		},
+		StreamResults: []*livekit.StreamInfo{{
+			Url:    "rtmp://live.example.com/app/{sk_redacted}",
+			Status: livekit.StreamInfo_FAILED,
+			Error:  "connection refused",
+		}},
+	}
+
+	b, err := protojson.Marshal(info)
+	require.NoError(t, err)
+	r, err := ParseEgressInfo(b)
+	require.NoError(t, err)
+
+	require.Equal(t, "EG_test", r.EgressID)
+	require.Equal(t, livekit.EgressStatus_EGRESS_COMPLETE, r.Status)
+	require.Equal(t, time.Minute, r.EndedAt.Sub(r.StartedAt))
+
+	// the deprecated single result is used when there are no file results
+	require.Len(t, r.Files, 1)
+	require.Equal(t, "recordings/room.mp4", r.Files[0].Filename)
+	require.Equal(t, time.Minute, r.Files[0].Duration)
+
+	require.Len(t, r.Streams, 1)
+	require.Equal(t, livekit.StreamInfo_FAILED, r.Streams[0].Status)
+	require.True(t, r.Streams[0].StartedAt.IsZero())
+	require.Empty(t, r.Segments)
+}
+
+func TestManifest(t *testing.T) {
+	m, err := ParseManifest([]byte(`{
+		"egress_id": "EG_test",
+		"room_name": "room",
+		"sync_group_id": "SG_test",
+		"sync_epoch": 1000000000,
+		"start_offset": 250000000,
+		"checksums": {"sha256": "abc"},
+		"segments": [
+			{"filename": "live_00000.ts", "duration": 6, "size": 100, "upload_status": "uploaded", "sha256": "def"},
+			{"filename": "live_00001.ts", "duration": 6, "size": 100, "upload_status": "uploaded"}
+		],
+		"replicas": [
+			{"name": "gcs", "uploaded": 3, "failed": 1, "error": "timeout"}
+		]
+	}`))
+	require.NoError(t, err)
+	require.Equal(t, []*ReplicaStatus{{Name: "gcs", Uploaded: 3, Failed: 1, Error: "timeout"}}, m.Replicas)
+	require.Equal(t, "abc", m.Checksums.SHA256)
+	require.Equal(t, "def", m.Segments[0].SHA256)
+
+	epoch, offset, ok := m.SyncOffset()
+	require.True(t, ok)
+	require.Equal(t, time.Unix(1, 0), epoch)
+	require.Equal(t, 250*time.Millisecond, offset)
+
+	urls, err := m.SegmentURLs(&livekit.GCPUpload{Bucket: "bucket"}, "streams/live.m3u8")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"https://bucket.storage.googleapis.com/streams/live_00000.ts",
+		"https://bucket.storage.googleapis.com/streams/live_00001.ts",
+	}, urls)
+}
+
+func TestManifestV2(t *testing.T) {
+	b := []byte(`{
+		"version": 2,
+		"egress_id": "EG_test",
+		"room_name": "room",
+		"request_type": "room_composite",
+		"request": {"room_name": "room", "layout": "grid"},
+		"timings": {"started_at": 1000000000, "ended_at": 61000000000, "duration": 60000000000},
+		"end": {"trigger": "room_closed", "ended_by": "room_closed"},
+		"source": {},
+		"video": {"codec": "video/h264", "width": 1920, "height": 1080, "framerate": 30, "bitrate": 4500},
+		"audio": {"codec": "audio/opus", "bitrate": 128, "frequency": 48000},
+		"sync": {"group_id": "SG_test", "epoch": 1000000000, "start_offset": 250000000},
+		"outputs": [
+			{"type": "file", "filename": "room.mp4", "size": 100, "checksums": {"sha256": "abc"}},
+			{"type": "segments", "filename": "live.m3u8", "segment_count": 1, "segments": [
+				{"filename": "live_00000.ts", "duration": 6, "size": 100, "upload_status": "uploaded"}
+			]}
+		],
+		"preview": {"step": "preview", "filename": "room_preview.jpg", "location": "s3://bucket/room_preview.jpg", "size": 10}
+	}`)
+
+	m, err := ParseManifestV2(b)
+	require.NoError(t, err)
+	require.Equal(t, "room_composite", m.RequestType)
+	require.Equal(t, int32(1080), m.Video.Height)
+	require.Len(t, m.Outputs, 2)
+
+	// v2 manifests can be read as v1
+	v1, err := ParseManifest(b)
+	require.NoError(t, err)
+	require.Equal(t, "EG_test", v1.EgressID)
+	require.Equal(t, "room_closed", v1.EndTrigger)
+	require.Equal(t, "video/h264", v1.VideoCodec)
+	require.Equal(t, "abc", v1.Checksums.SHA256)
+	require.Equal(t, int64(1), v1.SegmentCount)
+	require.Equal(t, "room_preview.jpg", v1.Preview.Filename)
+	_, offset, ok := v1.SyncOffset()
+	require.True(t, ok)
+	require.Equal(t, 250*time.Millisecond, offset)
+
+	_, err = ParseManifestV2([]byte(`{"egress_id": "EG_test"}`))
+	require.Error(t, err)
+}
+
+func TestStorageURL(t *testing.T) {
+	for _, test := range []struct {
+		upload   interface{}
+		expected string
+	}{
+		{&livekit.S3Upload{Bucket: "bucket"}, "https://bucket.s3.amazonaws.com/a/b.mp4"},
+		{&livekit.S3Upload{Bucket: "bucket", Endpoint: "https://minio.example.com/"}, "https://minio.example.com/bucket/a/b.mp4"},
+		{&livekit.AzureBlobUpload{AccountName: "account", ContainerName: "container"}, "https://account.blob.core.windows.net/container/a/b.mp4"},
+		{&livekit.AliOSSUpload{Bucket: "bucket", Endpoint: "oss-cn-hangzhou.aliyuncs.com"}, "https://bucket.oss-cn-hangzhou.aliyuncs.com/a/b.mp4"},
+	} {
+		url, err := StorageURL(test.upload, "/a/b.mp4")
+		require.NoError(t, err)
+		require.Equal(t, test.expected, url)
+	}
+
+	_, err := StorageURL(nil, "a/b.mp4")
+	require.Error(t, err)
+}
@@ -0,0 +1,46 @@
+package results
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/livekit/protocol/livekit"
+)
+
+// StorageURL returns the url of a file uploaded to storage, in the same format as the locations in egress results.
+// S3 compatible storage with a custom endpoint is addressed path style. Use it for files which are listed by path only, such as segments
+func StorageURL(upload interface{}, storageFilepath string) (string, error) {
+	storageFilepath = strings.TrimPrefix(storageFilepath, "/")
+
+	switch u := upload.(type) {
+	case *livekit.S3Upload:
+		if u.Endpoint != "" {
+			return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(u.Endpoint, "/"), u.Bucket, storageFilepath), nil
+		}
+		return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", u.Bucket, storageFilepath), nil
+	case *livekit.GCPUpload:
+		return fmt.Sprintf("https://%s.storage.googleapis.com/%s", u.Bucket, storageFilepath), nil
+	case *livekit.AzureBlobUpload:
+		return fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", u.AccountName, u.ContainerName, storageFilepath), nil
+	case *livekit.AliOSSUpload:
+		return fmt.Sprintf("https://%s.%s/%s", u.Bucket, u.Endpoint, storageFilepath), nil
+	default:
+		return "", fmt.Errorf("unsupported upload type %T", upload)
+	}
+}
+
+// SegmentURLs returns the url of each segment listed in the manifest of a segment output.
+// Segment filenames are relative to the playlist, which is listed in the egress results
+func (m *Manifest) SegmentURLs(upload interface{}, playlistName string) ([]string, error) {
+	dir := path.Dir(playlistName)
+	urls := make([]string, 0, len(m.Segments))
+	for _, s := range m.Segments {
+		url, err := StorageURL(upload, path.Join(dir, s.Filename))
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, nil
+}
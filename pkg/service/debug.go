@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -9,7 +10,9 @@ import (
 
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/ipc"
+	"github.com/livekit/egress/pkg/logging"
 	"github.com/livekit/egress/pkg/pprof"
+	"github.com/livekit/protocol/auth"
 	"github.com/livekit/protocol/logger"
 	"github.com/livekit/psrpc"
 )
@@ -17,6 +20,9 @@ import (
 const (
 	gstPipelineDotFileApp = "gst_pipeline"
 	pprofApp              = "pprof"
+	logLevelApp           = "log_level"
+	featureFlagsApp       = "feature_flags"
+	outputsApp            = "outputs"
 )
 
 func (s *Service) StartDebugHandlers() {
@@ -28,6 +34,11 @@ func (s *Service) StartDebugHandlers() {
 	mux := http.NewServeMux()
 	mux.HandleFunc(fmt.Sprintf("/%s/", gstPipelineDotFileApp), s.handleGstPipelineDotFile)
 	mux.HandleFunc(fmt.Sprintf("/%s/", pprofApp), s.handlePProf)
+	mux.HandleFunc(fmt.Sprintf("/%s/", logLevelApp), s.handleLogLevel)
+	mux.HandleFunc(fmt.Sprintf("/%s/", featureFlagsApp), s.handleFeatureFlags)
+	if s.conf.OutputUpdates {
+		mux.HandleFunc(fmt.Sprintf("/%s/", outputsApp), s.handleUpdateOutputs)
+	}
 
 	go func() {
 		addr := fmt.Sprintf(":%d", s.conf.DebugHandlerPort)
@@ -51,7 +62,7 @@ func (s *Service) handleGstPipelineDotFile(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	res, err := c.GetPipelineDot(context.Background(), &ipc.GstPipelineDebugDotRequest{})
+	res, err := c.GetPipelineDot(context.Background(), &ipc.GstPipelineDebugDotRequest{EgressId: egressID})
 	if err == nil {
 		_, err = w.Write([]byte(res.DotFile))
 	}
@@ -107,6 +118,138 @@ func (s *Service) handlePProf(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// URL path format is "/<application>/<egress_id>/<subsystem>" or "/<application>/<subsystem>" to update the service,
+// with optional level and sample query params. An empty level resets the subsystem to the default level.
+func (s *Service) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	level := r.URL.Query().Get("level")
+	sampleInterval, _ := strconv.ParseUint(r.URL.Query().Get("sample"), 10, 64)
+
+	pathElements := strings.Split(r.URL.Path, "/")
+	switch len(pathElements) {
+	case 3:
+		// update main service
+		if err = logging.Configure(pathElements[2], level, sampleInterval); err != nil {
+			err = psrpc.NewError(psrpc.InvalidArgument, err)
+		}
+
+	case 4:
+		c, clientErr := s.manager.getGRPCClient(pathElements[2])
+		if clientErr != nil {
+			http.Error(w, "handler not found", http.StatusNotFound)
+			return
+		}
+
+		_, err = c.SetLogLevel(context.Background(), &ipc.SetLogLevelRequest{
+			Subsystem:      pathElements[3],
+			Level:          level,
+			SampleInterval: sampleInterval,
+		})
+
+	default:
+		http.Error(w, "malformed url", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), getErrorCode(err))
+	}
+}
+
+// URL path format is "/<application>/<egress_id>" or "/<application>/" for the service.
+// Enabled flags are returned as a json array.
+func (s *Service) handleFeatureFlags(w http.ResponseWriter, r *http.Request) {
+	var enabled []string
+
+	pathElements := strings.Split(r.URL.Path, "/")
+	if len(pathElements) < 3 {
+		http.Error(w, "malformed url", http.StatusNotFound)
+		return
+	}
+
+	if egressID := pathElements[2]; egressID == "" {
+		enabled = s.conf.EnabledFeatures()
+	} else {
+		c, err := s.manager.getGRPCClient(egressID)
+		if err != nil {
+			http.Error(w, "handler not found", http.StatusNotFound)
+			return
+		}
+
+		res, err := c.GetFeatureFlags(context.Background(), &ipc.FeatureFlagsRequest{})
+		if err != nil {
+			http.Error(w, err.Error(), getErrorCode(err))
+			return
+		}
+		enabled = res.Enabled
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(enabled); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// URL path format is "/<application>/<egress_id>", with a json body such as
+// {"add_segment_output": {"filename_prefix": "...", "s3": {...}}, "stop_file_output": true}.
+// The request must have a bearer token signed with the node's api key and secret, with the roomRecord grant.
+// This is a node-local admin endpoint, since the egress rpc has no output updates: it only reaches egresses running on this node
+func (s *Service) handleUpdateOutputs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.authorizeOutputUpdate(r); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	pathElements := strings.Split(r.URL.Path, "/")
+	if len(pathElements) < 3 || pathElements[2] == "" {
+		http.Error(w, "malformed url", http.StatusNotFound)
+		return
+	}
+
+	var body struct {
+		AddSegmentOutput json.RawMessage `json:"add_segment_output"`
+		StopFileOutput   bool            `json:"stop_file_output"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err := s.UpdateOutputs(r.Context(), &ipc.UpdateOutputsRequest{
+		EgressId:         pathElements[2],
+		AddSegmentOutput: string(body.AddSegmentOutput),
+		StopFileOutput:   body.StopFileOutput,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), getErrorCode(err))
+	}
+}
+
+func (s *Service) authorizeOutputUpdate(r *http.Request) error {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || s.conf.ApiKey == "" || s.conf.ApiSecret == "" {
+		return errors.New("unauthorized")
+	}
+
+	v, err := auth.ParseAPIToken(token)
+	if err != nil || v.APIKey() != s.conf.ApiKey {
+		return errors.New("invalid token")
+	}
+	claims, err := v.Verify(s.conf.ApiSecret)
+	if err != nil {
+		return errors.New("invalid token")
+	}
+	if claims.Video == nil || !claims.Video.RoomRecord {
+		return errors.New("permission denied")
+	}
+	return nil
+}
+
 func getErrorCode(err error) int {
 	var e psrpc.Error
 
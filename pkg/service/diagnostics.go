@@ -0,0 +1,62 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/egress/version"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+)
+
+const diagnosticsPrefix = "diagnostics"
+
+// uploadPanicReport saves the stack trace of a panic which failed the egress to the default storage,
+// so that it can be debugged without access to the node's logs
+func (h *Handler) uploadPanicReport(info *livekit.EgressInfo, panicErr *errors.PanicError) {
+	uploadConfig := h.conf.GetDefaultUploadConfig()
+	if uploadConfig == nil {
+		// stack trace has already been logged
+		return
+	}
+
+	u, err := uploader.New(uploadConfig, h.conf.BackupStorage)
+	if err != nil {
+		logger.Errorw("failed to create panic report uploader", err)
+		return
+	}
+
+	var b bytes.Buffer
+	_, _ = fmt.Fprintf(&b, "egress_id: %s\n", info.EgressId)
+	_, _ = fmt.Fprintf(&b, "node_id: %s\n", h.conf.NodeID)
+	_, _ = fmt.Fprintf(&b, "handler_id: %s\n", h.conf.HandlerID)
+	_, _ = fmt.Fprintf(&b, "version: %s\n", version.Version)
+	_, _ = fmt.Fprintf(&b, "status: %s\n", info.Status)
+	_, _ = fmt.Fprintf(&b, "error: %s\n\n", panicErr.Error())
+	_, _ = b.Write(panicErr.Stack)
+
+	filename := fmt.Sprintf("panic_%s.txt", time.Now().UTC().Format("20060102T150405Z"))
+	localFilepath := path.Join(h.conf.TmpDir, filename)
+	if err = os.WriteFile(localFilepath, b.Bytes(), 0644); err != nil {
+		logger.Errorw("failed to write panic report", err)
+		return
+	}
+	defer func() {
+		_ = os.Remove(localFilepath)
+	}()
+
+	storageFilepath := path.Join(diagnosticsPrefix, info.EgressId, filename)
+	location, _, err := u.Upload(localFilepath, storageFilepath, types.OutputTypeText)
+	if err != nil {
+		logger.Errorw("failed to upload panic report", err)
+		return
+	}
+
+	logger.Infow("panic report uploaded", "location", location)
+}
@@ -4,18 +4,22 @@ import (
 	"context"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/frostbyte73/core"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
 
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/ipc"
+	"github.com/livekit/egress/pkg/logging"
 	"github.com/livekit/egress/pkg/pipeline"
 	"github.com/livekit/egress/pkg/pprof"
+	"github.com/livekit/egress/version"
 	"github.com/livekit/protocol/livekit"
 	"github.com/livekit/protocol/logger"
 	"github.com/livekit/protocol/rpc"
@@ -31,17 +35,42 @@ type Handler struct {
 	conf       *config.PipelineConfig
 	pipeline   *pipeline.Pipeline
 	rpcServer  rpc.EgressHandlerServer
+	bus        psrpc.MessageBus
 	ioClient   rpc.IOInfoClient
 	grpcServer *grpc.Server
 	kill       core.Fuse
+
+	// track egresses added to this handler process
+	mu             sync.Mutex
+	closing        bool
+	shared         sync.WaitGroup
+	sharedEgresses map[string]*sharedEgress
 }
 
 func NewHandler(conf *config.PipelineConfig, bus psrpc.MessageBus, ioClient rpc.IOInfoClient) (*Handler, error) {
+	h, err := newHandler(conf, bus, ioClient, true)
+	if err != nil {
+		return nil, err
+	}
+	if err = h.buildPipeline(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// NewInProcessHandler creates a handler which is called directly by the service, without a grpc server.
+// The pipeline is built by Run, so that it does not hold up the start request
+func NewInProcessHandler(conf *config.PipelineConfig, bus psrpc.MessageBus, ioClient rpc.IOInfoClient) (*Handler, error) {
+	return newHandler(conf, bus, ioClient, false)
+}
+
+func newHandler(conf *config.PipelineConfig, bus psrpc.MessageBus, ioClient rpc.IOInfoClient, serveGRPC bool) (*Handler, error) {
 	h := &Handler{
-		conf:       conf,
-		ioClient:   ioClient,
-		grpcServer: grpc.NewServer(),
-		kill:       core.NewFuse(),
+		conf:           conf,
+		bus:            bus,
+		ioClient:       ioClient,
+		kill:           core.NewFuse(),
+		sharedEgresses: make(map[string]*sharedEgress),
 	}
 
 	rpcServer, err := rpc.NewEgressHandlerServer(conf.HandlerID, h, bus)
@@ -56,44 +85,84 @@ func NewHandler(conf *config.PipelineConfig, bus psrpc.MessageBus, ioClient rpc.
 	}
 	h.rpcServer = rpcServer
 
-	listener, err := net.Listen(network, getSocketAddress(conf.TmpDir))
-	if err != nil {
-		return nil, errors.Fatal(err)
-	}
-
-	ipc.RegisterEgressHandlerServer(h.grpcServer, h)
-
-	go func() {
-		err := h.grpcServer.Serve(listener)
+	if serveGRPC {
+		listener, err := net.Listen(network, getSocketAddress(conf.TmpDir))
 		if err != nil {
-			logger.Errorw("failed to start grpc handler", err)
+			return nil, errors.Fatal(err)
 		}
-	}()
 
-	h.pipeline, err = pipeline.New(context.Background(), h.conf, h.sendUpdate)
+		h.grpcServer = grpc.NewServer()
+		ipc.RegisterEgressHandlerServer(h.grpcServer, h)
+
+		go func() {
+			err := h.grpcServer.Serve(listener)
+			if err != nil {
+				logger.Errorw("failed to start grpc handler", err)
+			}
+		}()
+	}
+
+	return h, nil
+}
+
+func (h *Handler) buildPipeline() error {
+	p, err := pipeline.New(context.Background(), h.conf, h.sendUpdate)
 	if err != nil {
+		if h.conf.RetryFailedStarts && errors.IsRetryable(err) {
+			// service will retry on another node
+			h.rpcServer.Shutdown()
+			if h.grpcServer != nil {
+				h.grpcServer.Stop()
+			}
+			return err
+		}
 		if !errors.IsFatal(err) {
 			// user error, send update
 			now := time.Now().UnixNano()
-			conf.Info.UpdatedAt = now
-			conf.Info.EndedAt = now
-			conf.Info.Status = livekit.EgressStatus_EGRESS_FAILED
-			conf.Info.Error = err.Error()
-			h.sendUpdate(context.Background(), conf.Info)
+			h.conf.Info.UpdatedAt = now
+			h.conf.Info.EndedAt = now
+			h.conf.Info.Status = livekit.EgressStatus_EGRESS_FAILED
+			h.conf.SetFailure(err)
+			h.sendUpdate(context.Background(), h.conf.Info)
 		}
-		return nil, err
+		if h.grpcServer == nil {
+			// in-process handlers do not exit with the pipeline
+			h.rpcServer.Shutdown()
+		}
+		return err
 	}
 
-	return h, nil
+	h.pipeline = p
+	return nil
 }
 
 func (h *Handler) Run() error {
 	ctx, span := tracer.Start(context.Background(), "Handler.Run")
 	defer span.End()
 
+	if h.pipeline == nil {
+		if err := h.buildPipeline(); err != nil {
+			return err
+		}
+	}
+
 	// start egress
 	result := make(chan *livekit.EgressInfo, 1)
+	var panicErr *errors.PanicError
 	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				panicErr = errors.NewPanicError(r)
+				logger.Errorw("pipeline panic", panicErr, "stack", string(panicErr.Stack))
+
+				now := time.Now().UnixNano()
+				h.conf.Info.UpdatedAt = now
+				h.conf.Info.EndedAt = now
+				h.conf.Info.Status = livekit.EgressStatus_EGRESS_FAILED
+				h.conf.SetFailure(panicErr)
+				result <- h.conf.Info
+			}
+		}()
 		result <- h.pipeline.Run(ctx)
 	}()
 
@@ -102,13 +171,26 @@ func (h *Handler) Run() error {
 		select {
 		case <-kill:
 			// kill signal received
+			kill = nil
+			h.pipeline.SetEndedBy(config.EndedByShutdown)
 			h.pipeline.SendEOS(ctx)
+			h.killSharedEgresses()
 
 		case res := <-result:
 			// recording finished
+			if panicErr == nil {
+				panicErr = h.pipeline.GetPanic()
+			}
+			if panicErr != nil {
+				h.uploadPanicReport(res, panicErr)
+			}
+
 			h.sendUpdate(ctx, res)
+			h.waitForSharedEgresses()
 			h.rpcServer.Shutdown()
-			h.grpcServer.Stop()
+			if h.grpcServer != nil {
+				h.grpcServer.Stop()
+			}
 			return nil
 		}
 	}
@@ -129,6 +211,39 @@ func (h *Handler) UpdateStream(ctx context.Context, req *livekit.UpdateStreamReq
 	return h.pipeline.Info, nil
 }
 
+func (h *Handler) UpdateOutputs(ctx context.Context, req *ipc.UpdateOutputsRequest) (*ipc.UpdateOutputsResponse, error) {
+	ctx, span := tracer.Start(ctx, "Handler.UpdateOutputs")
+	defer span.End()
+
+	if req.EgressId != "" && req.EgressId != h.conf.Info.EgressId {
+		e := h.getSharedEgress(req.EgressId)
+		if e == nil {
+			return nil, errors.ErrEgressNotFound
+		}
+		return e.handler.UpdateOutputs(ctx, &ipc.UpdateOutputsRequest{
+			AddSegmentOutput: req.AddSegmentOutput,
+			StopFileOutput:   req.StopFileOutput,
+		})
+	}
+
+	if h.pipeline == nil {
+		return nil, errors.ErrEgressNotFound
+	}
+
+	var segments *livekit.SegmentedFileOutput
+	if req.AddSegmentOutput != "" {
+		segments = &livekit.SegmentedFileOutput{}
+		if err := protojson.Unmarshal([]byte(req.AddSegmentOutput), segments); err != nil {
+			return nil, psrpc.NewError(psrpc.MalformedRequest, err)
+		}
+	}
+
+	if err := h.pipeline.UpdateOutputs(ctx, segments, req.StopFileOutput); err != nil {
+		return nil, err
+	}
+	return &ipc.UpdateOutputsResponse{}, nil
+}
+
 func (h *Handler) StopEgress(ctx context.Context, _ *livekit.StopEgressRequest) (*livekit.EgressInfo, error) {
 	ctx, span := tracer.Start(ctx, "Handler.StopEgress")
 	defer span.End()
@@ -137,14 +252,39 @@ func (h *Handler) StopEgress(ctx context.Context, _ *livekit.StopEgressRequest)
 		return nil, errors.ErrEgressNotFound
 	}
 
+	h.pipeline.SetEndedBy(config.EndTriggerStopEgress)
 	h.pipeline.SendEOS(ctx)
 	return h.pipeline.Info, nil
 }
 
-func (h *Handler) GetPipelineDot(ctx context.Context, _ *ipc.GstPipelineDebugDotRequest) (*ipc.GstPipelineDebugDotResponse, error) {
+func (h *Handler) Handshake(ctx context.Context, req *ipc.HandshakeRequest) (*ipc.HandshakeResponse, error) {
+	res := &ipc.HandshakeResponse{
+		ProtocolVersion:    ipc.ProtocolVersion,
+		MinProtocolVersion: ipc.MinProtocolVersion,
+		Version:            version.Version,
+	}
+	if !ipc.IsCompatible(req.ProtocolVersion, req.MinProtocolVersion) {
+		logger.Errorw("incompatible service", nil,
+			"serviceVersion", req.Version,
+			"protocolVersion", req.ProtocolVersion,
+			"minProtocolVersion", req.MinProtocolVersion,
+		)
+	}
+	return res, nil
+}
+
+func (h *Handler) GetPipelineDot(ctx context.Context, req *ipc.GstPipelineDebugDotRequest) (*ipc.GstPipelineDebugDotResponse, error) {
 	ctx, span := tracer.Start(ctx, "Handler.GetPipelineDot")
 	defer span.End()
 
+	if req.EgressId != "" && req.EgressId != h.conf.Info.EgressId {
+		e := h.getSharedEgress(req.EgressId)
+		if e == nil {
+			return nil, errors.ErrEgressNotFound
+		}
+		return e.handler.GetPipelineDot(ctx, &ipc.GstPipelineDebugDotRequest{})
+	}
+
 	if h.pipeline == nil {
 		return nil, errors.ErrEgressNotFound
 	}
@@ -183,20 +323,86 @@ func (h *Handler) GetPProf(ctx context.Context, req *ipc.PProfRequest) (*ipc.PPr
 	}, nil
 }
 
+func (h *Handler) SetLogLevel(ctx context.Context, req *ipc.SetLogLevelRequest) (*ipc.SetLogLevelResponse, error) {
+	if err := logging.Configure(req.Subsystem, req.Level, req.SampleInterval); err != nil {
+		return nil, psrpc.NewError(psrpc.InvalidArgument, err)
+	}
+
+	logger.Infow("log level updated",
+		"subsystem", req.Subsystem,
+		"level", req.Level,
+		"sampleInterval", req.SampleInterval,
+	)
+	return &ipc.SetLogLevelResponse{}, nil
+}
+
+func (h *Handler) GetFeatureFlags(_ context.Context, _ *ipc.FeatureFlagsRequest) (*ipc.FeatureFlagsResponse, error) {
+	return &ipc.FeatureFlagsResponse{
+		Enabled: h.conf.EnabledFeatures(),
+	}, nil
+}
+
 func (h *Handler) Kill() {
 	h.kill.Break()
 }
 
+// Abort stops an in-process handler's pipeline without finalizing, once it is past the shutdown grace period
+func (h *Handler) Abort() {
+	if h.pipeline != nil {
+		h.pipeline.Abort()
+	}
+}
+
+// inProcessClient calls an in-process handler directly, in place of the grpc client
+type inProcessClient struct {
+	h *Handler
+}
+
+func (c *inProcessClient) Handshake(ctx context.Context, in *ipc.HandshakeRequest, _ ...grpc.CallOption) (*ipc.HandshakeResponse, error) {
+	return c.h.Handshake(ctx, in)
+}
+
+func (c *inProcessClient) GetPipelineDot(ctx context.Context, in *ipc.GstPipelineDebugDotRequest, _ ...grpc.CallOption) (*ipc.GstPipelineDebugDotResponse, error) {
+	return c.h.GetPipelineDot(ctx, in)
+}
+
+func (c *inProcessClient) GetPProf(ctx context.Context, in *ipc.PProfRequest, _ ...grpc.CallOption) (*ipc.PProfResponse, error) {
+	return c.h.GetPProf(ctx, in)
+}
+
+func (c *inProcessClient) SetLogLevel(ctx context.Context, in *ipc.SetLogLevelRequest, _ ...grpc.CallOption) (*ipc.SetLogLevelResponse, error) {
+	return c.h.SetLogLevel(ctx, in)
+}
+
+func (c *inProcessClient) GetFeatureFlags(ctx context.Context, in *ipc.FeatureFlagsRequest, _ ...grpc.CallOption) (*ipc.FeatureFlagsResponse, error) {
+	return c.h.GetFeatureFlags(ctx, in)
+}
+
+func (c *inProcessClient) UpdateOutputs(ctx context.Context, in *ipc.UpdateOutputsRequest, _ ...grpc.CallOption) (*ipc.UpdateOutputsResponse, error) {
+	return c.h.UpdateOutputs(ctx, in)
+}
+
+func (c *inProcessClient) AddEgress(_ context.Context, _ *ipc.AddEgressRequest, _ ...grpc.CallOption) (*ipc.AddEgressResponse, error) {
+	// in-process handlers already share the service process
+	return nil, status.Error(codes.Unimplemented, "in-process handlers cannot add egresses")
+}
+
+func (c *inProcessClient) WaitEgress(_ context.Context, _ *ipc.WaitEgressRequest, _ ...grpc.CallOption) (*ipc.WaitEgressResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "in-process handlers cannot add egresses")
+}
+
 func (h *Handler) sendUpdate(ctx context.Context, info *livekit.EgressInfo) {
-	sendUpdate(ctx, h.ioClient, info)
+	sendUpdate(ctx, h.ioClient, info, h.conf.FailureCause)
 }
 
-func sendUpdate(ctx context.Context, c rpc.IOInfoClient, info *livekit.EgressInfo) {
+// sendUpdate sends the info to the server. The cause of a failure is logged, as EgressInfo has no field for it
+func sendUpdate(ctx context.Context, c rpc.IOInfoClient, info *livekit.EgressInfo, cause errors.FailureCause) {
 	requestType, outputType := getTypes(info)
 	switch info.Status {
 	case livekit.EgressStatus_EGRESS_FAILED:
 		logger.Warnw("egress failed", errors.New(info.Error),
 			"egressID", info.EgressId,
+			"cause", cause,
 			"request_type", requestType,
 			"output_type", outputType,
 		)
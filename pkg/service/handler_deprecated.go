@@ -90,6 +90,7 @@ func (h *HandlerV0) Run() error {
 		select {
 		case <-kill:
 			// kill signal received
+			p.SetEndedBy(config.EndedByShutdown)
 			p.SendEOS(ctx)
 
 		case res := <-result:
@@ -111,6 +112,7 @@ func (h *HandlerV0) Run() error {
 			case *livekit.EgressRequest_UpdateStream:
 				err = p.UpdateStream(ctx, r.UpdateStream)
 			case *livekit.EgressRequest_Stop:
+				p.SetEndedBy(config.EndTriggerStopEgress)
 				p.SendEOS(ctx)
 			default:
 				err = errors.ErrInvalidRPC
@@ -128,7 +130,7 @@ func (h *HandlerV0) buildPipeline(ctx context.Context) (*pipeline.Pipeline, erro
 	// build/verify params
 	p, err := pipeline.New(ctx, h.conf, h.sendUpdate)
 	if err != nil {
-		h.conf.Info.Error = err.Error()
+		h.conf.SetFailure(err)
 		h.conf.Info.Status = livekit.EgressStatus_EGRESS_FAILED
 		h.sendUpdate(ctx, h.conf.Info)
 		span.RecordError(err)
@@ -144,6 +146,7 @@ func (h *HandlerV0) sendUpdate(ctx context.Context, info *livekit.EgressInfo) {
 	case livekit.EgressStatus_EGRESS_FAILED:
 		logger.Warnw("egress failed", errors.New(info.Error),
 			"egressID", info.EgressId,
+			"cause", h.conf.FailureCause,
 			"request_type", requestType,
 			"output_type", outputType,
 		)
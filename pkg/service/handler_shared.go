@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+
+	"github.com/frostbyte73/core"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/ipc"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/rpc"
+	"github.com/livekit/protocol/tracer"
+	"github.com/livekit/protocol/utils"
+)
+
+// sharedEgress is a track egress added to a running handler process, to share its process overhead
+type sharedEgress struct {
+	handler *Handler
+	done    core.Fuse
+}
+
+func (h *Handler) AddEgress(ctx context.Context, req *ipc.AddEgressRequest) (*ipc.AddEgressResponse, error) {
+	ctx, span := tracer.Start(ctx, "Handler.AddEgress")
+	defer span.End()
+
+	startReq := &rpc.StartEgressRequest{}
+	if err := protojson.Unmarshal([]byte(req.Request), startReq); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	h.mu.Lock()
+	if h.closing {
+		h.mu.Unlock()
+		// the service will launch a new handler instead
+		return nil, status.Error(codes.Unavailable, "handler is shutting down")
+	}
+	h.shared.Add(1)
+	h.mu.Unlock()
+
+	p, err := config.NewSharedPipelineConfig(h.conf, utils.NewGuid("EGH_"), startReq)
+	if err != nil {
+		h.shared.Done()
+		return nil, err
+	}
+
+	handler, err := newHandler(p, h.bus, h.ioClient, false)
+	if err != nil {
+		h.shared.Done()
+		if h.conf.RetryFailedStarts && errors.IsRetryable(err) {
+			// the service will retry on another node
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		if errors.IsFatal(err) {
+			return nil, err
+		}
+		// update sent by handler
+		return &ipc.AddEgressResponse{}, nil
+	}
+
+	e := &sharedEgress{
+		handler: handler,
+		done:    core.NewFuse(),
+	}
+	h.mu.Lock()
+	h.sharedEgresses[startReq.EgressId] = e
+	h.mu.Unlock()
+
+	logger.Infow("running egress in shared handler", "egressID", startReq.EgressId, "hostEgressID", h.conf.Info.EgressId)
+	go func() {
+		defer h.shared.Done()
+		_ = handler.Run()
+
+		h.mu.Lock()
+		delete(h.sharedEgresses, startReq.EgressId)
+		h.mu.Unlock()
+		e.done.Break()
+	}()
+
+	return &ipc.AddEgressResponse{}, nil
+}
+
+func (h *Handler) WaitEgress(ctx context.Context, req *ipc.WaitEgressRequest) (*ipc.WaitEgressResponse, error) {
+	e := h.getSharedEgress(req.EgressId)
+	if e == nil {
+		// already finished
+		return &ipc.WaitEgressResponse{}, nil
+	}
+
+	select {
+	case <-e.done.Watch():
+		return &ipc.WaitEgressResponse{}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (h *Handler) getSharedEgress(egressID string) *sharedEgress {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.sharedEgresses[egressID]
+}
+
+func (h *Handler) killSharedEgresses() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, e := range h.sharedEgresses {
+		e.handler.Kill()
+	}
+}
+
+// waitForSharedEgresses stops accepting new egresses, and waits for running ones to finish
+func (h *Handler) waitForSharedEgresses() {
+	h.mu.Lock()
+	h.closing = true
+	h.mu.Unlock()
+
+	h.shared.Wait()
+}
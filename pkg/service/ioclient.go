@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/logging"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/rpc"
+	"github.com/livekit/psrpc"
+	"github.com/livekit/psrpc/pkg/middleware"
+)
+
+// ioClient wraps the IOInfo client with per attempt deadlines, retries, and a circuit breaker.
+// Updates are sent in order by a worker for each egress, so that a slow IO service cannot hold up the pipeline
+type ioClient struct {
+	rpc.IOInfoClient
+
+	conf   config.IOClientConfig
+	logger logger.Logger
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	egresses  map[string]*egressUpdates // by egress ID, while its worker is running
+}
+
+// egressUpdates holds the latest unsent update of an egress, which replaces any older one
+type egressUpdates struct {
+	latest *livekit.EgressInfo
+	done   chan error // set with final updates, which the caller waits for
+	ended  bool       // a final update was queued, so older statuses are dropped
+	wake   chan struct{}
+}
+
+func NewIOClient(conf config.IOClientConfig, clientID string, bus psrpc.MessageBus) (rpc.IOInfoClient, error) {
+	client, err := rpc.NewIOInfoClient(clientID, bus, middleware.WithRPCRetries(middleware.RetryOptions{
+		MaxAttempts: conf.MaxAttempts,
+		Timeout:     conf.Timeout,
+		Backoff:     conf.Backoff,
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ioClient{
+		IOInfoClient: client,
+		conf:         conf,
+		logger:       logging.Logger(logging.IPC),
+		egresses:     make(map[string]*egressUpdates),
+	}, nil
+}
+
+// UpdateEgressInfo queues the update and returns. Final updates are waited for, so that they are sent before the handler exits
+func (c *ioClient) UpdateEgressInfo(ctx context.Context, info *livekit.EgressInfo, _ ...psrpc.RequestOption) (*emptypb.Empty, error) {
+	final := isFinalStatus(info.Status)
+
+	c.mu.Lock()
+	u := c.egresses[info.EgressId]
+	if u == nil {
+		u = &egressUpdates{wake: make(chan struct{}, 1)}
+		c.egresses[info.EgressId] = u
+		go c.sendUpdates(info.EgressId, u)
+	}
+	if u.ended && !final {
+		c.mu.Unlock()
+		return &emptypb.Empty{}, nil
+	}
+	if u.done != nil {
+		// replaced by the newer final update
+		u.done <- nil
+	}
+
+	var done chan error
+	if final {
+		done = make(chan error, 1)
+	}
+	u.latest = proto.Clone(info).(*livekit.EgressInfo)
+	u.done = done
+	u.ended = u.ended || final
+	c.mu.Unlock()
+
+	select {
+	case u.wake <- struct{}{}:
+	default:
+	}
+
+	if !final {
+		return &emptypb.Empty{}, nil
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+		return &emptypb.Empty{}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// sendUpdates sends the latest update of the egress until there are none left.
+// Non-final updates wait while the circuit is open, and failed ones are resent after the cooldown unless replaced
+func (c *ioClient) sendUpdates(egressID string, u *egressUpdates) {
+	var retryAt time.Time
+	for {
+		c.mu.Lock()
+		info, done := u.latest, u.done
+		if info == nil {
+			delete(c.egresses, egressID)
+			c.mu.Unlock()
+			return
+		}
+
+		// final updates are always attempted
+		var wait time.Duration
+		if done == nil {
+			wait = time.Until(retryAt)
+			if untilClosed := time.Until(c.openUntil); untilClosed > wait {
+				wait = untilClosed
+			}
+		}
+		if wait > 0 {
+			c.mu.Unlock()
+			select {
+			case <-u.wake:
+			case <-time.After(wait):
+			}
+			continue
+		}
+
+		u.latest = nil
+		u.done = nil
+		c.mu.Unlock()
+
+		_, err := c.IOInfoClient.UpdateEgressInfo(context.Background(), info)
+		c.record(err)
+		if done != nil {
+			done <- err
+			continue
+		}
+		if err == nil {
+			retryAt = time.Time{}
+			continue
+		}
+
+		c.logger.Warnw("failed to send egress update", err, "egressID", egressID)
+		c.mu.Lock()
+		if u.latest == nil {
+			u.latest = info
+		}
+		c.mu.Unlock()
+		retryAt = time.Now().Add(c.conf.BreakerCooldown)
+	}
+}
+
+func (c *ioClient) record(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil {
+		c.failures = 0
+		return
+	}
+
+	c.failures++
+	if c.failures >= c.conf.BreakerThreshold {
+		c.logger.Warnw("io client circuit open", err, "failures", c.failures, "cooldown", c.conf.BreakerCooldown)
+		c.openUntil = time.Now().Add(c.conf.BreakerCooldown)
+		c.failures = 0
+	}
+}
+
+func isFinalStatus(status livekit.EgressStatus) bool {
+	switch status {
+	case livekit.EgressStatus_EGRESS_COMPLETE,
+		livekit.EgressStatus_EGRESS_FAILED,
+		livekit.EgressStatus_EGRESS_ABORTED,
+		livekit.EgressStatus_EGRESS_LIMIT_REACHED:
+		return true
+	default:
+		return false
+	}
+}
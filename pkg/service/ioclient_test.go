@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/rpc"
+	"github.com/livekit/psrpc"
+)
+
+type testIOClient struct {
+	rpc.IOInfoClient
+
+	gate    chan struct{} // holds each update until closed, if set
+	mu      sync.Mutex
+	fail    bool
+	updates []*livekit.EgressInfo
+}
+
+func (c *testIOClient) UpdateEgressInfo(_ context.Context, info *livekit.EgressInfo, _ ...psrpc.RequestOption) (*emptypb.Empty, error) {
+	if c.gate != nil {
+		<-c.gate
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.fail {
+		return nil, errors.New("unavailable")
+	}
+	c.updates = append(c.updates, info)
+	return &emptypb.Empty{}, nil
+}
+
+func (c *testIOClient) setFail(fail bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fail = fail
+}
+
+func (c *testIOClient) getUpdates() []*livekit.EgressInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*livekit.EgressInfo{}, c.updates...)
+}
+
+func newTestIOClient(inner *testIOClient) *ioClient {
+	return &ioClient{
+		IOInfoClient: inner,
+		conf: config.IOClientConfig{
+			BreakerThreshold: 1,
+			BreakerCooldown:  time.Millisecond * 100,
+		},
+		logger:   logger.GetLogger(),
+		egresses: make(map[string]*egressUpdates),
+	}
+}
+
+func newTestInfo(status livekit.EgressStatus, errorString string) *livekit.EgressInfo {
+	return &livekit.EgressInfo{EgressId: "EG_1", Status: status, Error: errorString}
+}
+
+func TestIOClientOrder(t *testing.T) {
+	inner := &testIOClient{gate: make(chan struct{})}
+	c := newTestIOClient(inner)
+	ctx := context.Background()
+
+	// non-final updates return while the first one is still being sent
+	_, err := c.UpdateEgressInfo(ctx, newTestInfo(livekit.EgressStatus_EGRESS_STARTING, "first"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.egresses["EG_1"].latest == nil
+	}, time.Second, time.Millisecond*10)
+	_, err = c.UpdateEgressInfo(ctx, newTestInfo(livekit.EgressStatus_EGRESS_ACTIVE, "second"))
+	require.NoError(t, err)
+
+	// the final update replaces the queued one, and is waited for
+	final := make(chan error, 1)
+	go func() {
+		_, err := c.UpdateEgressInfo(ctx, newTestInfo(livekit.EgressStatus_EGRESS_COMPLETE, "final"))
+		final <- err
+	}()
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.egresses["EG_1"].ended
+	}, time.Second, time.Millisecond*10)
+
+	// older statuses are dropped once a final update is queued
+	_, err = c.UpdateEgressInfo(ctx, newTestInfo(livekit.EgressStatus_EGRESS_ACTIVE, "late"))
+	require.NoError(t, err)
+
+	close(inner.gate)
+	require.NoError(t, <-final)
+
+	updates := inner.getUpdates()
+	require.Len(t, updates, 2)
+	require.Equal(t, "first", updates[0].Error)
+	require.Equal(t, "final", updates[1].Error)
+
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.egresses) == 0
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestIOClientBreaker(t *testing.T) {
+	inner := &testIOClient{fail: true}
+	c := newTestIOClient(inner)
+	ctx := context.Background()
+
+	// a failed update opens the circuit, and is resent after the cooldown
+	_, err := c.UpdateEgressInfo(ctx, newTestInfo(livekit.EgressStatus_EGRESS_ACTIVE, "first"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return time.Now().Before(c.openUntil)
+	}, time.Second, time.Millisecond*10)
+	inner.setFail(false)
+
+	// newer updates replace it while the circuit is open
+	_, err = c.UpdateEgressInfo(ctx, newTestInfo(livekit.EgressStatus_EGRESS_ACTIVE, "second"))
+	require.NoError(t, err)
+	require.Empty(t, inner.getUpdates())
+
+	require.Eventually(t, func() bool {
+		return len(inner.getUpdates()) == 1
+	}, time.Second, time.Millisecond*10)
+	require.Equal(t, "second", inner.getUpdates()[0].Error)
+
+	// final updates are sent while the circuit is open, and the queued update is dropped
+	inner.setFail(true)
+	_, err = c.UpdateEgressInfo(ctx, newTestInfo(livekit.EgressStatus_EGRESS_ACTIVE, "third"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return time.Now().Before(c.openUntil)
+	}, time.Second, time.Millisecond*10)
+	inner.setFail(false)
+
+	_, err = c.UpdateEgressInfo(ctx, newTestInfo(livekit.EgressStatus_EGRESS_COMPLETE, "final"))
+	require.NoError(t, err)
+
+	time.Sleep(time.Millisecond * 200)
+	updates := inner.getUpdates()
+	require.Len(t, updates, 2)
+	require.Equal(t, "final", updates[1].Error)
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/livekit/protocol/logger"
+)
+
+// handlerLogWriter captures a handler process output stream. Lines written by the handler's own logger
+// already include its handlerID and are passed through, while anything else (GStreamer, Chrome, panics)
+// is wrapped with the egress and handler IDs so it can be attributed on multi-egress nodes.
+type handlerLogWriter struct {
+	logger    logger.Logger
+	handlerID string
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func newHandlerLogWriter(egressID, handlerID, stream string) *handlerLogWriter {
+	return &handlerLogWriter{
+		logger:    logger.GetLogger().WithValues("egressID", egressID, "handlerID", handlerID, "stream", stream),
+		handlerID: handlerID,
+	}
+}
+
+func (w *handlerLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := string(w.buf.Next(i + 1))
+		w.writeLine(line[:len(line)-1])
+	}
+
+	return len(p), nil
+}
+
+// Flush writes any trailing output without a newline
+func (w *handlerLogWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.buf.Len() > 0 {
+		w.writeLine(w.buf.String())
+		w.buf.Reset()
+	}
+}
+
+func (w *handlerLogWriter) writeLine(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if strings.Contains(line, w.handlerID) {
+		_, _ = os.Stdout.WriteString(line + "\n")
+		return
+	}
+	w.logger.Infow(line)
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"net"
 	"os"
 	"os/exec"
@@ -13,57 +14,132 @@ import (
 
 	"github.com/frostbyte73/core"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 	"gopkg.in/yaml.v3"
 
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/ipc"
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
 	"github.com/livekit/egress/pkg/stats"
+	"github.com/livekit/egress/pkg/telemetry"
+	"github.com/livekit/egress/version"
 	"github.com/livekit/protocol/livekit"
 	"github.com/livekit/protocol/logger"
 	"github.com/livekit/protocol/rpc"
 	"github.com/livekit/protocol/tracer"
 	"github.com/livekit/protocol/utils"
+	"github.com/livekit/psrpc"
+)
+
+const (
+	defaultHandlerBinary = "egress"
+	handshakeTimeout     = time.Second * 10
+	addEgressTimeout     = time.Second * 30
+
+	// RetryExitCode is used by handlers which failed to start because of a node-local issue
+	RetryExitCode = 3
 )
 
 type ProcessManager struct {
-	conf    *config.ServiceConfig
-	monitor *stats.Monitor
+	conf     *config.ServiceConfig
+	monitor  *stats.Monitor
+	bus      psrpc.MessageBus
+	ioClient rpc.IOInfoClient
 
 	mu             sync.RWMutex
 	activeHandlers map[string]*process
+	syncGroups     *syncGroups // nil unless sync_groups is enabled
 	onFatalError   func(*livekit.EgressInfo)
+	onRetry        func(*rpc.StartEgressRequest, *livekit.EgressInfo)
 }
 
 type process struct {
 	handlerID  string
+	tmpDir     string
 	req        *rpc.StartEgressRequest
 	info       *livekit.EgressInfo
-	cmd        *exec.Cmd
+	cmd        *exec.Cmd // nil when running in process
+	handler    *Handler  // only set when running in process
+	logs       []*handlerLogWriter
+	conn       *grpc.ClientConn // nil when running in process
 	grpcClient ipc.EgressHandlerClient
 	closed     core.Fuse
+	aborted    core.Fuse // force killed after the grace period
+
+	protocolVersion int32
+	host            *process // set when sharing another egress's handler process
+	shared          int      // egresses added to this handler process
 }
 
-func NewProcessManager(conf *config.ServiceConfig, monitor *stats.Monitor, onFatalError func(*livekit.EgressInfo)) *ProcessManager {
-	return &ProcessManager{
+func NewProcessManager(
+	conf *config.ServiceConfig,
+	monitor *stats.Monitor,
+	bus psrpc.MessageBus,
+	ioClient rpc.IOInfoClient,
+	onFatalError func(*livekit.EgressInfo),
+	onRetry func(*rpc.StartEgressRequest, *livekit.EgressInfo),
+) *ProcessManager {
+	s := &ProcessManager{
 		conf:           conf,
 		monitor:        monitor,
+		bus:            bus,
+		ioClient:       ioClient,
 		activeHandlers: make(map[string]*process),
 		onFatalError:   onFatalError,
+		onRetry:        onRetry,
+	}
+	if conf.SyncGroups {
+		s.syncGroups = newSyncGroups()
+	}
+
+	return s
+}
+
+func (s *ProcessManager) launchHandler(ctx context.Context, req *rpc.StartEgressRequest, info *livekit.EgressInfo, version int) error {
+	// the group is left when the egress is cleaned up, or if it fails to launch
+	syncGroup := s.syncGroups.join(req.EgressId, info.RoomName)
+	err := s.launch(ctx, req, info, version, syncGroup)
+	if err != nil {
+		s.syncGroups.leave(req.EgressId)
 	}
+	return err
 }
 
-func (s *ProcessManager) launchHandler(req *rpc.StartEgressRequest, info *livekit.EgressInfo, version int) error {
-	_, span := tracer.Start(context.Background(), "Service.launchHandler")
+func (s *ProcessManager) launch(ctx context.Context, req *rpc.StartEgressRequest, info *livekit.EgressInfo, version int, syncGroup *config.SyncGroup) error {
+	ctx, span := tracer.Start(ctx, "Service.launchHandler")
 	defer span.End()
 
+	// version 0 requests come from the deprecated rpc server, which only handler processes serve (see handler_deprecated.go)
+	if s.conf.InProcessHandlers && version > 0 {
+		return s.launchInProcessHandler(req, info, syncGroup)
+	}
+
+	if host := s.getSharedHandler(req); host != nil {
+		err := s.addToHandler(host, req, info)
+		if err == nil {
+			return nil
+		}
+		if s.conf.RetryFailedStarts && status.Code(err) == codes.ResourceExhausted {
+			logger.Warnw("retryable error", err, "egressID", req.EgressId)
+			s.onRetry(req, info)
+			return nil
+		}
+		logger.Warnw("could not add egress to shared handler, launching new handler", err,
+			"egressID", req.EgressId,
+			"hostEgressID", host.req.EgressId,
+		)
+	}
+
 	handlerID := utils.NewGuid("EGH_")
 	p := &config.PipelineConfig{
 		BaseConfig: s.conf.BaseConfig,
 		HandlerID:  handlerID,
-		TmpDir:     path.Join(os.TempDir(), handlerID),
+		TmpDir:     path.Join(s.conf.ScratchDirectory, handlerID),
+		SyncGroup:  syncGroup,
 	}
 
 	confString, err := yaml.Marshal(p)
@@ -80,15 +156,22 @@ func (s *ProcessManager) launchHandler(req *rpc.StartEgressRequest, info *liveki
 		return err
 	}
 
-	cmd := exec.Command("egress",
+	binary := s.getHandlerBinary(info)
+	logger.Debugw("launching handler", "egressID", req.EgressId, "binary", binary)
+
+	cmd := exec.Command(binary,
 		"run-handler",
 		"--config", string(confString),
 		"--request", string(reqString),
 		"--version", fmt.Sprint(version),
+		"--trace-parent", telemetry.TraceParent(ctx),
 	)
+	stdout := newHandlerLogWriter(req.EgressId, handlerID, "stdout")
+	stderr := newHandlerLogWriter(req.EgressId, handlerID, "stderr")
 	cmd.Dir = "/"
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Env = s.getHandlerEnv()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
 	if err = cmd.Start(); err != nil {
 		span.RecordError(err)
@@ -99,10 +182,13 @@ func (s *ProcessManager) launchHandler(req *rpc.StartEgressRequest, info *liveki
 	s.monitor.EgressStarted(req)
 	h := &process{
 		handlerID: handlerID,
+		tmpDir:    p.TmpDir,
 		req:       req,
 		info:      info,
 		cmd:       cmd,
+		logs:      []*handlerLogWriter{stdout, stderr},
 		closed:    core.NewFuse(),
+		aborted:   core.NewFuse(),
 	}
 
 	socketAddr := getSocketAddress(p.TmpDir)
@@ -117,8 +203,142 @@ func (s *ProcessManager) launchHandler(req *rpc.StartEgressRequest, info *liveki
 		logger.Errorw("could not dial grpc handler", err)
 		return err
 	}
+	h.conn = conn
 	h.grpcClient = ipc.NewEgressHandlerClient(conn)
 
+	if err = s.handshake(h); err != nil {
+		span.RecordError(err)
+		logger.Errorw("handshake failed", err, "egressID", req.EgressId)
+		_ = conn.Close()
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		s.monitor.EgressEnded(req)
+		return err
+	}
+
+	s.mu.Lock()
+	s.activeHandlers[req.EgressId] = h
+	s.mu.Unlock()
+
+	go s.awaitCleanup(h)
+
+	return nil
+}
+
+// getHandlerBinary allows canarying new handler builds on a share of requests
+func (s *ProcessManager) getHandlerBinary(info *livekit.EgressInfo) string {
+	requestType, _ := getTypes(info)
+	return selectHandlerBinary(s.conf.HandlerBinaries, requestType, rand.Float64())
+}
+
+// selectHandlerBinary compares a single draw in [0, 1) against the running total of the matching binaries' fractions,
+// so that each binary gets its own share of requests
+func selectHandlerBinary(binaries []config.HandlerBinaryConfig, requestType string, draw float64) string {
+	var total float64
+	for _, b := range binaries {
+		matches := len(b.RequestTypes) == 0
+		for _, t := range b.RequestTypes {
+			if t == requestType {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+		if total += b.Fraction; draw < total {
+			return b.Path
+		}
+	}
+	return defaultHandlerBinary
+}
+
+// getHandlerEnv adds the configured gc settings to the environment of the service. Nil keeps the environment as is
+func (s *ProcessManager) getHandlerEnv() []string {
+	gc := s.conf.HandlerGC
+	if gc == nil || (gc.GOGC == "" && gc.MemoryLimit == "") {
+		return nil
+	}
+
+	// later values take precedence over those of the service
+	env := os.Environ()
+	if gc.GOGC != "" {
+		env = append(env, "GOGC="+gc.GOGC)
+	}
+	if gc.MemoryLimit != "" {
+		env = append(env, "GOMEMLIMIT="+gc.MemoryLimit)
+	}
+	return env
+}
+
+// handshake makes sure the handler binary speaks a compatible protocol, allowing a newer service
+// to run older handlers during rolling upgrades
+func (s *ProcessManager) handshake(h *process) error {
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+
+	res, err := h.grpcClient.Handshake(ctx, &ipc.HandshakeRequest{
+		ProtocolVersion:    ipc.ProtocolVersion,
+		MinProtocolVersion: ipc.MinProtocolVersion,
+		Version:            version.Version,
+	}, grpc.WaitForReady(true))
+	if err != nil {
+		switch status.Code(err) {
+		case codes.Unimplemented:
+			// handler predates the handshake
+			res = &ipc.HandshakeResponse{ProtocolVersion: 1, MinProtocolVersion: 1}
+		default:
+			// the handler exited or is unresponsive, and is killed by the caller
+			return errors.ErrProcessStartFailed(err)
+		}
+	}
+
+	if !ipc.IsCompatible(res.ProtocolVersion, res.MinProtocolVersion) {
+		return errors.ErrIncompatibleHandler(res.Version, res.ProtocolVersion, res.MinProtocolVersion)
+	}
+	h.protocolVersion = res.ProtocolVersion
+
+	logger.Debugw("handshake complete",
+		"egressID", h.req.EgressId,
+		"handlerVersion", res.Version,
+		"protocolVersion", res.ProtocolVersion,
+	)
+	return nil
+}
+
+func (s *ProcessManager) launchInProcessHandler(req *rpc.StartEgressRequest, info *livekit.EgressInfo, syncGroup *config.SyncGroup) error {
+	handlerID := utils.NewGuid("EGH_")
+	p, err := config.NewInProcessPipelineConfig(s.conf, handlerID, req)
+	if err != nil {
+		logger.Errorw("could not create pipeline config", err)
+		return err
+	}
+	p.SyncGroup = syncGroup
+
+	// created by run-handler for handler processes
+	if err = os.MkdirAll(p.TmpDir, 0755); err != nil {
+		logger.Errorw("could not create tmp dir", err, "egressID", req.EgressId)
+		return err
+	}
+
+	handler, err := NewInProcessHandler(p, s.bus, s.ioClient)
+	if err != nil {
+		logger.Errorw("could not create handler", err)
+		return err
+	}
+
+	s.monitor.EgressStarted(req)
+	h := &process{
+		handlerID:  handlerID,
+		tmpDir:     p.TmpDir,
+		req:        req,
+		info:       info,
+		handler:    handler,
+		grpcClient: &inProcessClient{h: handler},
+		closed:     core.NewFuse(),
+		aborted:    core.NewFuse(),
+	}
+
 	s.mu.Lock()
 	s.activeHandlers[req.EgressId] = h
 	s.mu.Unlock()
@@ -129,7 +349,33 @@ func (s *ProcessManager) launchHandler(req *rpc.StartEgressRequest, info *liveki
 }
 
 func (s *ProcessManager) awaitCleanup(h *process) {
-	if err := h.cmd.Wait(); err != nil {
+	var err error
+	if h.cmd != nil {
+		err = h.cmd.Wait()
+		for _, w := range h.logs {
+			w.Flush()
+		}
+	} else if h.host != nil {
+		// fails if the host process exits first
+		_, err = h.host.grpcClient.WaitEgress(context.Background(), &ipc.WaitEgressRequest{EgressId: h.req.EgressId})
+		if h.host.aborted.IsBroken() {
+			h.aborted.Break()
+			err = nil
+		}
+	} else {
+		err = s.runInProcessHandler(h)
+	}
+
+	if h.aborted.IsBroken() {
+		now := time.Now().UnixNano()
+		h.info.UpdatedAt = now
+		h.info.EndedAt = now
+		h.info.Status = livekit.EgressStatus_EGRESS_ABORTED
+		h.info.Error = "egress killed after shutdown grace period"
+		sendUpdate(context.Background(), s.ioClient, h.info, errors.FailureCauseSystem)
+	} else if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == RetryExitCode {
+		s.onRetry(h.req, h.info)
+	} else if err != nil {
 		now := time.Now().UnixNano()
 		h.info.UpdatedAt = now
 		h.info.EndedAt = now
@@ -138,13 +384,87 @@ func (s *ProcessManager) awaitCleanup(h *process) {
 		s.onFatalError(h.info)
 	}
 
+	if h.conn != nil {
+		_ = h.conn.Close()
+	}
 	h.closed.Break()
 	s.monitor.EgressEnded(h.req)
+	s.verifyCleanup(h)
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if h.host != nil {
+		h.host.shared--
+	}
 	delete(s.activeHandlers, h.req.EgressId)
+	s.syncGroups.leave(h.req.EgressId)
+}
+
+// runInProcessHandler builds and runs the pipeline, after the start request has returned like a handler process does.
+// Once the handler is aborted it is no longer waited on, since it cannot be killed
+func (s *ProcessManager) runInProcessHandler(h *process) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- h.handler.Run()
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-h.aborted.Watch():
+		return nil
+	}
+
+	if err == nil {
+		return nil
+	}
+	if s.conf.RetryFailedStarts && errors.IsRetryable(err) {
+		logger.Warnw("retryable error", err, "egressID", h.req.EgressId)
+		s.onRetry(h.req, h.info)
+		return nil
+	}
+	if errors.IsFatal(err) {
+		logger.Errorw("could not create pipeline", err, "egressID", h.req.EgressId)
+		return err
+	}
+	// update sent by handler
+	return nil
+}
+
+// the handler is responsible for removing its local files, but a crashed handler can leave them behind
+func (s *ProcessManager) verifyCleanup(h *process) {
+	localDir := path.Join(s.conf.LocalOutputDirectory, h.req.EgressId)
+	if _, err := os.Stat(localDir); err == nil && h.aborted.IsBroken() && s.conf.BackupStorage != "" {
+		// keep partial results from a force killed handler
+		backupDir := path.Join(s.conf.BackupStorage, h.req.EgressId)
+		logger.Warnw("moving partial results to backup storage", nil, "egressID", h.req.EgressId, "path", backupDir)
+		if err = os.Rename(localDir, backupDir); err != nil {
+			logger.Errorw("could not move partial results", err, "egressID", h.req.EgressId)
+		}
+	}
+	var pending []*uploader.PendingUpload
+	if s.conf.RecoverUploads {
+		pending = s.findPendingUploads(h.req.EgressId)
+	}
+	if len(pending) > 0 {
+		// the directory is removed by the recovery once the upload succeeds
+		logger.Warnw("resuming interrupted upload", nil, "egressID", h.req.EgressId)
+		go s.recoverUploads(pending)
+	} else if _, err := os.Stat(localDir); err == nil {
+		logger.Warnw("removing leftover local files", nil, "egressID", h.req.EgressId, "path", localDir)
+		if err = os.RemoveAll(localDir); err != nil {
+			logger.Errorw("could not remove local files", err, "egressID", h.req.EgressId)
+		}
+	}
+
+	if h.host != nil {
+		// tmp dir belongs to the host
+		return
+	}
+	if err := os.RemoveAll(h.tmpDir); err != nil {
+		logger.Errorw("could not remove handler tmp dir", err, "egressID", h.req.EgressId)
+	}
 }
 
 func (s *ProcessManager) isIdle() bool {
@@ -191,18 +511,120 @@ func (s *ProcessManager) getGRPCClient(egressID string) (ipc.EgressHandlerClient
 }
 
 func (s *ProcessManager) killAll() {
+	s.stopAll(s.conf.KillGracePeriod)
+}
+
+// stopAll sends EOS to every egress, which then finalizes and uploads before its handler exits.
+// Handlers still running after the grace period are force killed
+func (s *ProcessManager) stopAll(gracePeriod time.Duration) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	for _, h := range s.activeHandlers {
+		if h.host != nil {
+			// killed by the host
+			continue
+		}
 		if !h.closed.IsBroken() {
-			if err := h.cmd.Process.Signal(syscall.SIGINT); err != nil {
+			if h.cmd == nil {
+				h.handler.Kill()
+				go s.forceKill(h, gracePeriod)
+			} else if err := h.cmd.Process.Signal(syscall.SIGINT); err != nil {
 				logger.Errorw("failed to kill process", err, "egressID", h.req.EgressId)
+			} else {
+				go s.forceKill(h, gracePeriod)
 			}
 		}
 	}
 }
 
+// forceKill gives the handler time to finalize and upload, then kills it
+func (s *ProcessManager) forceKill(h *process, gracePeriod time.Duration) {
+	select {
+	case <-h.closed.Watch():
+		return
+	case <-time.After(gracePeriod):
+	}
+
+	if h.aborted.IsBroken() || h.closed.IsBroken() {
+		return
+	}
+	logger.Warnw("handler did not exit, force killing", nil,
+		"egressID", h.req.EgressId,
+		"gracePeriod", gracePeriod,
+	)
+	h.aborted.Break()
+	if h.cmd == nil {
+		h.handler.Abort()
+	} else if err := h.cmd.Process.Kill(); err != nil {
+		logger.Errorw("failed to force kill process", err, "egressID", h.req.EgressId)
+	}
+}
+
 func getSocketAddress(handlerTmpDir string) string {
 	return path.Join(handlerTmpDir, "service_rpc.sock")
 }
+
+// getSharedHandler finds a running handler process which can take another track egress for the same room
+func (s *ProcessManager) getSharedHandler(req *rpc.StartEgressRequest) *process {
+	track := req.GetTrack()
+	if track == nil || s.conf.TracksPerHandler <= 1 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, h := range s.activeHandlers {
+		if h.cmd == nil || h.closed.IsBroken() || h.protocolVersion < ipc.SharedHandlerProtocolVersion {
+			continue
+		}
+		if hostTrack := h.req.GetTrack(); hostTrack == nil || hostTrack.RoomName != track.RoomName {
+			continue
+		}
+		if h.shared+1 >= s.conf.TracksPerHandler {
+			continue
+		}
+
+		// reserve a slot, released when the egress ends or fails to start
+		h.shared++
+		return h
+	}
+
+	return nil
+}
+
+func (s *ProcessManager) addToHandler(host *process, req *rpc.StartEgressRequest, info *livekit.EgressInfo) error {
+	reqString, err := protojson.Marshal(req)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), addEgressTimeout)
+		_, err = host.grpcClient.AddEgress(ctx, &ipc.AddEgressRequest{Request: string(reqString)})
+		cancel()
+	}
+	if err != nil {
+		s.mu.Lock()
+		host.shared--
+		s.mu.Unlock()
+		return err
+	}
+
+	s.monitor.EgressStarted(req)
+	h := &process{
+		handlerID:  host.handlerID,
+		tmpDir:     host.tmpDir,
+		req:        req,
+		info:       info,
+		grpcClient: host.grpcClient,
+		closed:     core.NewFuse(),
+		aborted:    core.NewFuse(),
+		host:       host,
+	}
+
+	s.mu.Lock()
+	s.activeHandlers[req.EgressId] = h
+	s.mu.Unlock()
+
+	go s.awaitCleanup(h)
+
+	return nil
+}
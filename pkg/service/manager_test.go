@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/frostbyte73/core"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/ipc"
+	"github.com/livekit/egress/pkg/stats"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/rpc"
+)
+
+type testHandlerClient struct {
+	ipc.EgressHandlerClient
+
+	mu     sync.Mutex
+	addErr error
+	waits  map[string]chan error
+}
+
+func (c *testHandlerClient) AddEgress(_ context.Context, _ *ipc.AddEgressRequest, _ ...grpc.CallOption) (*ipc.AddEgressResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.addErr != nil {
+		return nil, c.addErr
+	}
+	return &ipc.AddEgressResponse{}, nil
+}
+
+func (c *testHandlerClient) WaitEgress(_ context.Context, req *ipc.WaitEgressRequest, _ ...grpc.CallOption) (*ipc.WaitEgressResponse, error) {
+	if err := <-c.getWait(req.EgressId); err != nil {
+		return nil, err
+	}
+	return &ipc.WaitEgressResponse{}, nil
+}
+
+func (c *testHandlerClient) setAddErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addErr = err
+}
+
+// getWait returns the channel which ends the egress, with an error if it failed
+func (c *testHandlerClient) getWait(egressID string) chan error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.waits[egressID] == nil {
+		c.waits[egressID] = make(chan error, 1)
+	}
+	return c.waits[egressID]
+}
+
+func newTrackRequest(egressID, roomName string) *rpc.StartEgressRequest {
+	return &rpc.StartEgressRequest{
+		EgressId: egressID,
+		Request: &rpc.StartEgressRequest_Track{
+			Track: &livekit.TrackEgressRequest{RoomName: roomName},
+		},
+	}
+}
+
+func newTestManager(t *testing.T, onFatalError func(*livekit.EgressInfo)) (*ProcessManager, *process, *testHandlerClient) {
+	conf := &config.ServiceConfig{TracksPerHandler: 3}
+	conf.LocalOutputDirectory = t.TempDir()
+
+	client := &testHandlerClient{waits: make(map[string]chan error)}
+	host := &process{
+		handlerID:       "EGH_host",
+		tmpDir:          t.TempDir(),
+		req:             newTrackRequest("EG_host", "room"),
+		info:            &livekit.EgressInfo{EgressId: "EG_host"},
+		cmd:             &exec.Cmd{},
+		grpcClient:      client,
+		closed:          core.NewFuse(),
+		aborted:         core.NewFuse(),
+		protocolVersion: ipc.SharedHandlerProtocolVersion,
+	}
+
+	s := &ProcessManager{
+		conf:           conf,
+		monitor:        stats.NewMonitor(conf),
+		activeHandlers: map[string]*process{"EG_host": host},
+		onFatalError:   onFatalError,
+	}
+	return s, host, client
+}
+
+func (s *ProcessManager) getShared(h *process) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return h.shared
+}
+
+func (s *ProcessManager) addShared(t *testing.T, egressID string) *rpc.StartEgressRequest {
+	req := newTrackRequest(egressID, "room")
+	host := s.getSharedHandler(req)
+	require.NotNil(t, host)
+	require.NoError(t, s.addToHandler(host, req, &livekit.EgressInfo{EgressId: egressID}))
+	return req
+}
+
+func TestSharedHandlerSlots(t *testing.T) {
+	s, host, client := newTestManager(t, func(*livekit.EgressInfo) {})
+
+	// only track egresses for the same room share a handler
+	require.Nil(t, s.getSharedHandler(newTrackRequest("EG_other", "other")))
+	require.Nil(t, s.getSharedHandler(&rpc.StartEgressRequest{
+		EgressId: "EG_composite",
+		Request:  &rpc.StartEgressRequest_TrackComposite{TrackComposite: &livekit.TrackCompositeEgressRequest{RoomName: "room"}},
+	}))
+	require.Equal(t, 0, s.getShared(host))
+
+	// the host counts towards tracks_per_handler
+	s.addShared(t, "EG_1")
+	s.addShared(t, "EG_2")
+	require.Equal(t, 2, s.getShared(host))
+	require.Nil(t, s.getSharedHandler(newTrackRequest("EG_3", "room")))
+
+	// the slot is released when the egress ends
+	client.getWait("EG_1") <- nil
+	require.Eventually(t, func() bool {
+		return s.getShared(host) == 1 && !s.isActive("EG_1")
+	}, time.Second, time.Millisecond*10)
+
+	// and when it fails to start
+	client.setAddErr(errors.New("handler is shutting down"))
+	req := newTrackRequest("EG_3", "room")
+	require.Equal(t, host, s.getSharedHandler(req))
+	require.Equal(t, 2, s.getShared(host))
+	require.Error(t, s.addToHandler(host, req, &livekit.EgressInfo{EgressId: "EG_3"}))
+	require.Equal(t, 1, s.getShared(host))
+	require.False(t, s.isActive("EG_3"))
+
+	// handlers which are closing take no new egresses
+	client.setAddErr(nil)
+	host.closed.Break()
+	require.Nil(t, s.getSharedHandler(newTrackRequest("EG_4", "room")))
+}
+
+func TestSharedHandlerFailure(t *testing.T) {
+	var mu sync.Mutex
+	failed := make([]string, 0)
+	s, host, client := newTestManager(t, func(info *livekit.EgressInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, info.EgressId)
+	})
+
+	s.addShared(t, "EG_1")
+	s.addShared(t, "EG_2")
+
+	// a failing egress ends alone, without its host or the other egresses
+	client.getWait("EG_1") <- errors.New("pipeline failed")
+	require.Eventually(t, func() bool {
+		return !s.isActive("EG_1")
+	}, time.Second, time.Millisecond*10)
+
+	mu.Lock()
+	require.Equal(t, []string{"EG_1"}, failed)
+	mu.Unlock()
+	require.True(t, s.isActive("EG_host"))
+	require.True(t, s.isActive("EG_2"))
+	require.False(t, host.closed.IsBroken())
+	require.Equal(t, 1, s.getShared(host))
+
+	// its slot can be taken by a new egress
+	s.addShared(t, "EG_3")
+	require.Equal(t, 2, s.getShared(host))
+
+	client.getWait("EG_2") <- nil
+	client.getWait("EG_3") <- nil
+	require.Eventually(t, func() bool {
+		return s.getShared(host) == 0
+	}, time.Second, time.Millisecond*10)
+
+	mu.Lock()
+	require.Equal(t, []string{"EG_1"}, failed)
+	mu.Unlock()
+}
+
+func TestSharedHandlerRetry(t *testing.T) {
+	s, host, client := newTestManager(t, func(*livekit.EgressInfo) {})
+	s.conf.RetryFailedStarts = true
+
+	retried := make(chan string, 1)
+	s.onRetry = func(req *rpc.StartEgressRequest, _ *livekit.EgressInfo) {
+		retried <- req.EgressId
+	}
+
+	// a node-local failure in the shared handler sends the request to another node
+	client.setAddErr(status.Error(codes.ResourceExhausted, "could not launch chrome"))
+	req := newTrackRequest("EG_1", "room")
+	require.NoError(t, s.launchHandler(context.Background(), req, &livekit.EgressInfo{EgressId: "EG_1"}, 1))
+	require.Equal(t, "EG_1", <-retried)
+	require.Equal(t, 0, s.getShared(host))
+	require.False(t, s.isActive("EG_1"))
+}
+
+func TestSelectHandlerBinary(t *testing.T) {
+	binaries := []config.HandlerBinaryConfig{
+		{Path: "canary", RequestTypes: []string{"web"}, Fraction: 0.1},
+		{Path: "next", Fraction: 0.2},
+	}
+
+	for _, test := range []struct {
+		requestType string
+		draw        float64
+		expected    string
+	}{
+		{"web", 0, "canary"},
+		{"web", 0.09, "canary"},
+		{"web", 0.1, "next"},
+		{"web", 0.29, "next"},
+		{"web", 0.31, defaultHandlerBinary},
+		{"track", 0.1, "next"},
+		{"track", 0.2, defaultHandlerBinary},
+	} {
+		require.Equal(t, test.expected, selectHandlerBinary(binaries, test.requestType, test.draw), "%s %v", test.requestType, test.draw)
+	}
+}
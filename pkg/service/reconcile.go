@@ -0,0 +1,100 @@
+package service
+
+import (
+	"os"
+	"path"
+	"time"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/logging"
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/rpc"
+)
+
+// ReconcileUploads uploads the files in the upload spool, and reports file outputs with their new location if ioClient is set.
+// Files which fail again are kept for the next attempt. Egresses for which skip returns true are left in the spool.
+// It returns the number of files uploaded, and the number still pending
+func ReconcileUploads(conf *config.ServiceConfig, ioClient rpc.IOInfoClient, skip func(egressID string) bool) (int, int) {
+	if conf.UploadSpool == nil {
+		return 0, 0
+	}
+
+	pending, errs := uploader.FindPendingUploads(conf.UploadSpool.Directory)
+	for _, err := range errs {
+		logger.Warnw("could not read spooled upload", err)
+	}
+
+	uploaded := 0
+	for _, p := range pending {
+		if skip != nil && skip(p.EgressID) {
+			continue
+		}
+		if reconcileUpload(conf, ioClient, p) {
+			uploaded++
+		}
+	}
+
+	return uploaded, len(pending) - uploaded
+}
+
+func reconcileUpload(conf *config.ServiceConfig, ioClient rpc.IOInfoClient, p *uploader.PendingUpload) bool {
+	log := logging.Logger(logging.Upload).WithValues("egressID", p.EgressID, "path", p.StorageFilepath)
+
+	if _, err := os.Stat(p.LocalFilepath); err != nil {
+		log.Warnw("spooled upload has no local file", err)
+		removeSpooled(p)
+		return false
+	}
+
+	// failures stay in the spool, rather than moving to backup storage
+	location, size, err := uploadPending(conf, p, "")
+	if err != nil {
+		log.Warnw("could not upload spooled file", err)
+		return false
+	}
+	log.Infow("uploaded spooled file", "location", location, "size", size)
+	removeSpooled(p)
+
+	if ioClient != nil {
+		reportUploaded(ioClient, p, location, size, true)
+	}
+	return true
+}
+
+// removeSpooled removes the file and its pending upload, and the egress directory once it is empty
+func removeSpooled(p *uploader.PendingUpload) {
+	if err := os.Remove(p.LocalFilepath); err != nil && !os.IsNotExist(err) {
+		logger.Warnw("could not remove spooled file", err, "path", p.LocalFilepath)
+	}
+	if err := p.Remove(); err != nil {
+		logger.Warnw("could not remove spooled upload", err, "path", p.LocalFilepath)
+	}
+	_ = os.Remove(path.Dir(p.LocalFilepath))
+}
+
+// reconcileSpool uploads spooled files of egresses which are no longer running on this node, until shutdown
+func (s *ProcessManager) reconcileSpool(shutdown <-chan struct{}) {
+	ticker := time.NewTicker(s.conf.UploadSpool.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-shutdown:
+			return
+		case <-ticker.C:
+			uploaded, remaining := ReconcileUploads(s.conf, s.ioClient, s.isActive)
+			if uploaded > 0 || remaining > 0 {
+				logger.Infow("reconciled spooled uploads", "uploaded", uploaded, "remaining", remaining)
+			}
+		}
+	}
+}
+
+func (s *ProcessManager) isActive(egressID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.activeHandlers[egressID]
+	return ok
+}
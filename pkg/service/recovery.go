@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/logging"
+	"github.com/livekit/egress/pkg/pipeline/sink"
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/rpc"
+)
+
+// findPendingUploads returns file uploads which were interrupted by a crash. If egressID is empty, every egress directory is scanned
+func (s *ProcessManager) findPendingUploads(egressID string) []*uploader.PendingUpload {
+	pending, errs := uploader.FindPendingUploads(s.conf.LocalOutputDirectory)
+	for _, err := range errs {
+		logger.Warnw("could not read pending upload", err)
+	}
+	if egressID == "" {
+		return pending
+	}
+
+	var filtered []*uploader.PendingUpload
+	for _, p := range pending {
+		if p.EgressID == egressID {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// recoverUploads resumes the uploads, and reports the recovered egresses through the io client
+func (s *ProcessManager) recoverUploads(pending []*uploader.PendingUpload) {
+	recovered := make([]string, 0, len(pending))
+	for _, p := range pending {
+		if s.recoverUpload(p) {
+			recovered = append(recovered, p.EgressID)
+		}
+	}
+	if len(recovered) > 0 {
+		logger.Infow("recovered uploads", "egressIDs", recovered)
+	}
+}
+
+func (s *ProcessManager) recoverUpload(p *uploader.PendingUpload) bool {
+	log := logging.Logger(logging.Upload).WithValues("egressID", p.EgressID, "path", p.StorageFilepath)
+	localDir := path.Dir(p.LocalFilepath)
+
+	if _, err := os.Stat(p.LocalFilepath); err != nil {
+		log.Warnw("pending upload has no local file", err)
+		s.removeRecoveredDir(localDir)
+		return false
+	}
+
+	location, size, err := uploadPending(s.conf, p, s.conf.BackupStorage)
+	if err != nil {
+		// the files are kept, and retried the next time the service starts
+		log.Errorw("could not recover upload", err)
+		return false
+	}
+	log.Infow("recovered upload", "location", location, "size", size)
+	s.removeRecoveredDir(localDir)
+
+	reportUploaded(s.ioClient, p, location, size, false)
+	return true
+}
+
+// uploadPending uploads the file of a pending upload with the node's uploader config
+func uploadPending(conf *config.ServiceConfig, p *uploader.PendingUpload, backup string) (string, int64, error) {
+	u, err := uploader.New(p.UploadConfig(), backup)
+	if err == nil {
+		err = sink.ConfigureUploader(u, &conf.BaseConfig)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	return u.Upload(p.LocalFilepath, p.StorageFilepath, p.OutputType)
+}
+
+// reportUploaded reports the egress saved with the pending upload as complete, with the file's location.
+// If fileOnly is set, it is only reported if the file is one of its file results
+func reportUploaded(ioClient rpc.IOInfoClient, p *uploader.PendingUpload, location string, size int64, fileOnly bool) {
+	log := logging.Logger(logging.Upload).WithValues("egressID", p.EgressID, "path", p.StorageFilepath)
+
+	info := &livekit.EgressInfo{}
+	if err := protojson.Unmarshal(p.Info, info); err != nil {
+		log.Warnw("could not read pending upload info", err)
+		return
+	}
+
+	found := false
+	for _, f := range info.FileResults {
+		if f.Filename == p.StorageFilepath {
+			f.Location = location
+			f.Size = size
+			found = true
+		}
+	}
+	if f := info.GetFile(); f != nil && f.Filename == p.StorageFilepath {
+		f.Location = location
+		f.Size = size
+		found = true
+	}
+	if fileOnly && !found {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	info.Status = livekit.EgressStatus_EGRESS_COMPLETE
+	info.Error = ""
+	info.UpdatedAt = now
+	if info.EndedAt == 0 {
+		info.EndedAt = now
+	}
+
+	if _, err := ioClient.UpdateEgressInfo(context.Background(), info); err != nil {
+		log.Errorw("failed to report recovered upload", err)
+	}
+}
+
+func (s *ProcessManager) removeRecoveredDir(localDir string) {
+	// only egress directories are removed, never the local output directory itself
+	if path.Dir(localDir) != path.Clean(s.conf.LocalOutputDirectory) {
+		return
+	}
+	if err := os.RemoveAll(localDir); err != nil {
+		logger.Errorw("could not remove recovered upload directory", err, "path", localDir)
+	}
+}
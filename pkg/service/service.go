@@ -6,12 +6,17 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/frostbyte73/core"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/ipc"
 	"github.com/livekit/egress/pkg/stats"
 	"github.com/livekit/egress/version"
 	"github.com/livekit/protocol/egress"
@@ -22,17 +27,32 @@ import (
 	"github.com/livekit/psrpc"
 )
 
-const shutdownTimer = time.Second * 30
+const (
+	shutdownTimer          = time.Second * 30
+	capacityUpdateInterval = time.Second * 5
+	retryTimeout           = time.Second * 30
+	retryExclusionTTL      = time.Minute * 10
+
+	// CapacityChannel is the bus channel used for capacity updates
+	CapacityChannel = "egress_capacity"
+)
 
 type Service struct {
 	conf        *config.ServiceConfig
 	rpcServerV0 egress.RPCServer
 	psrpcServer rpc.EgressInternalServer
+	psrpcClient rpc.EgressInternalClient
 	ioClient    rpc.IOInfoClient
+	bus         psrpc.MessageBus
 	promServer  *http.Server
 	monitor     *stats.Monitor
+	watchdog    *stats.Watchdog
 	manager     *ProcessManager
 
+	// egress which failed to start on this node, and should be handled by another node
+	retriedMu sync.Mutex
+	retried   map[string]time.Time
+
 	shutdown core.Fuse
 }
 
@@ -43,10 +63,12 @@ func NewService(conf *config.ServiceConfig, bus psrpc.MessageBus, rpcServerV0 eg
 		conf:        conf,
 		rpcServerV0: rpcServerV0,
 		ioClient:    ioClient,
+		bus:         bus,
 		monitor:     monitor,
+		retried:     make(map[string]time.Time),
 		shutdown:    core.NewFuse(),
 	}
-	s.manager = NewProcessManager(conf, monitor, s.onFatalError)
+	s.manager = NewProcessManager(conf, monitor, bus, ioClient, s.onFatalError, s.onRetry)
 
 	psrpcServer, err := rpc.NewEgressInternalServer(conf.NodeID, s, bus)
 	if err != nil {
@@ -54,6 +76,13 @@ func NewService(conf *config.ServiceConfig, bus psrpc.MessageBus, rpcServerV0 eg
 	}
 	s.psrpcServer = psrpcServer
 
+	if conf.RetryFailedStarts {
+		s.psrpcClient, err = rpc.NewEgressInternalClient(conf.NodeID, bus)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	err = s.psrpcServer.RegisterStartEgressTopic(conf.ClusterID)
 	if err != nil {
 		return nil, err
@@ -69,6 +98,7 @@ func NewService(conf *config.ServiceConfig, bus psrpc.MessageBus, rpcServerV0 eg
 	if err := s.monitor.Start(s.conf, s.isAvailable); err != nil {
 		return nil, err
 	}
+	s.watchdog = stats.NewWatchdog(conf, s.manager.isIdle)
 
 	return s, nil
 }
@@ -86,11 +116,22 @@ func (s *Service) Run() error {
 		}()
 	}
 
+	s.watchdog.Start()
+	defer s.watchdog.Stop()
+
 	if s.rpcServerV0 != nil {
 		return s.runV0()
 	}
 
+	if s.conf.RecoverUploads {
+		go s.manager.recoverUploads(s.manager.findPendingUploads(""))
+	}
+	if s.conf.UploadSpool != nil {
+		go s.manager.reconcileSpool(s.shutdown.Watch())
+	}
+
 	logger.Infow("service ready")
+	go s.publishCapacity()
 
 	<-s.shutdown.Watch()
 	logger.Infow("shutting down")
@@ -104,10 +145,12 @@ func (s *Service) Run() error {
 }
 
 func (s *Service) StartEgress(ctx context.Context, req *rpc.StartEgressRequest) (*livekit.EgressInfo, error) {
-	ctx, span := tracer.Start(ctx, "Service.StartEgress")
+	// the span continues the trace of the request, if the caller propagated one
+	ctx, span := tracer.Start(ctx, "Service.StartEgress", trace.WithAttributes(attribute.String("egress.id", req.EgressId)))
 	defer span.End()
 
 	s.monitor.AcceptRequest(req)
+	defer s.monitor.ReleaseRequest(req)
 	logger.Infow("request received", "egressID", req.EgressId)
 
 	p, err := config.GetValidatedPipelineConfig(s.conf, req)
@@ -124,7 +167,7 @@ func (s *Service) StartEgress(ctx context.Context, req *rpc.StartEgressRequest)
 		"request", p.Info.Request,
 	)
 
-	err = s.manager.launchHandler(req, p.Info, 1)
+	err = s.manager.launchHandler(ctx, req, p.Info, 1)
 	if err != nil {
 		return nil, err
 	}
@@ -133,6 +176,16 @@ func (s *Service) StartEgress(ctx context.Context, req *rpc.StartEgressRequest)
 }
 
 func (s *Service) StartEgressAffinity(req *rpc.StartEgressRequest) float32 {
+	if !s.conf.MatchesPlacement(req) {
+		// missing required node labels
+		return -1
+	}
+
+	if s.wasRetried(req.EgressId) {
+		// already failed on this node
+		return -1
+	}
+
 	if !s.monitor.CanAcceptRequest(req) {
 		// cannot accept
 		return -1
@@ -159,6 +212,23 @@ func (s *Service) ListActiveEgress(ctx context.Context, _ *rpc.ListActiveEgressR
 	}, nil
 }
 
+// UpdateOutputs adds a segment output to, or stops the file output of, a running egress on this node
+func (s *Service) UpdateOutputs(ctx context.Context, req *ipc.UpdateOutputsRequest) (*ipc.UpdateOutputsResponse, error) {
+	ctx, span := tracer.Start(ctx, "Service.UpdateOutputs")
+	defer span.End()
+
+	if !s.conf.OutputUpdates {
+		return nil, errors.ErrNotSupported("output updates without output_updates enabled")
+	}
+
+	c, err := s.manager.getGRPCClient(req.EgressId)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infow("updating outputs", "egressID", req.EgressId, "stopFileOutput", req.StopFileOutput)
+	return c.UpdateOutputs(ctx, req)
+}
+
 func (s *Service) Status() ([]byte, error) {
 	return json.Marshal(s.manager.status())
 }
@@ -170,8 +240,66 @@ func (s *Service) isAvailable() float64 {
 	return 0
 }
 
+// publishCapacity lets autoscalers scale on available capacity instead of raw cpu
+func (s *Service) publishCapacity() {
+	ticker := time.NewTicker(capacityUpdateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.shutdown.Watch():
+			return
+		case <-ticker.C:
+			if err := s.bus.Publish(context.Background(), CapacityChannel, s.monitor.GetCapacity()); err != nil {
+				logger.Debugw("failed to publish capacity", "error", err)
+			}
+		}
+	}
+}
+
+// onRetry sends a request which failed to start because of a node-local issue to another node
+func (s *Service) onRetry(req *rpc.StartEgressRequest, info *livekit.EgressInfo) {
+	s.retriedMu.Lock()
+	now := time.Now()
+	for egressID, t := range s.retried {
+		if now.Sub(t) > retryExclusionTTL {
+			delete(s.retried, egressID)
+		}
+	}
+	s.retried[req.EgressId] = now
+	s.retriedMu.Unlock()
+
+	logger.Infow("retrying egress on another node", "egressID", req.EgressId)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), retryTimeout)
+		defer cancel()
+
+		err := errors.New("retry not enabled")
+		if s.psrpcClient != nil {
+			_, err = s.psrpcClient.StartEgress(ctx, s.conf.ClusterID, req)
+		}
+		if err != nil {
+			logger.Warnw("failed to retry egress", err, "egressID", req.EgressId)
+			now := time.Now().UnixNano()
+			info.UpdatedAt = now
+			info.EndedAt = now
+			info.Status = livekit.EgressStatus_EGRESS_FAILED
+			info.Error = err.Error()
+			sendUpdate(context.Background(), s.ioClient, info, errors.GetFailureCause(err))
+		}
+	}()
+}
+
+func (s *Service) wasRetried(egressID string) bool {
+	s.retriedMu.Lock()
+	defer s.retriedMu.Unlock()
+
+	_, ok := s.retried[egressID]
+	return ok
+}
+
 func (s *Service) onFatalError(info *livekit.EgressInfo) {
-	sendUpdate(context.Background(), s.ioClient, info)
+	sendUpdate(context.Background(), s.ioClient, info, errors.FailureCauseSystem)
 	s.Stop(false)
 }
 
@@ -182,6 +310,12 @@ func (s *Service) Stop(kill bool) {
 	}
 }
 
+// Drain stops every egress, and gives them until the shutdown deadline to finalize and upload before they are force killed
+func (s *Service) Drain() {
+	s.shutdown.Break()
+	s.manager.stopAll(s.conf.ShutdownDeadline)
+}
+
 func (s *Service) KillAll() {
 	s.manager.killAll()
 }
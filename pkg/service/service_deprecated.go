@@ -80,8 +80,9 @@ func (s *Service) handleRequestV0(req *rpc.StartEgressRequest, deprecated *livek
 		// validate before passing to handler
 		p, err := config.GetValidatedPipelineConfig(s.conf, req)
 		if err == nil {
-			err = s.manager.launchHandler(req, p.Info, 0)
+			err = s.manager.launchHandler(ctx, req, p.Info, 0)
 		}
+		s.monitor.ReleaseRequest(req)
 
 		s.sendResponseV0(ctx, deprecated, p.Info, err)
 		if err != nil {
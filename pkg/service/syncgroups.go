@@ -0,0 +1,73 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/livekit/egress/pkg/clock"
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/protocol/utils"
+)
+
+// syncGroups gives egresses for the same room which overlap on this node a shared sync epoch.
+// A group ends when its last egress ends.
+type syncGroups struct {
+	mu       sync.Mutex
+	groups   map[string]*config.SyncGroup // by room name
+	egresses map[string]string            // room name by egress ID
+	counts   map[string]int               // active egresses by room name
+}
+
+func newSyncGroups() *syncGroups {
+	return &syncGroups{
+		groups:   make(map[string]*config.SyncGroup),
+		egresses: make(map[string]string),
+		counts:   make(map[string]int),
+	}
+}
+
+// join returns the egress's sync group, or nil if sync groups are disabled
+func (g *syncGroups) join(egressID, roomName string) *config.SyncGroup {
+	if g == nil || roomName == "" {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.egresses[egressID]; ok {
+		return g.groups[roomName]
+	}
+
+	group := g.groups[roomName]
+	if group == nil {
+		group = &config.SyncGroup{
+			ID:    utils.NewGuid("SG_"),
+			Epoch: clock.Now().UnixNano(),
+		}
+		g.groups[roomName] = group
+	}
+	g.egresses[egressID] = roomName
+	g.counts[roomName]++
+	return group
+}
+
+func (g *syncGroups) leave(egressID string) {
+	if g == nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	roomName, ok := g.egresses[egressID]
+	if !ok {
+		return
+	}
+	delete(g.egresses, egressID)
+
+	g.counts[roomName]--
+	if g.counts[roomName] == 0 {
+		delete(g.counts, roomName)
+		delete(g.groups, roomName)
+	}
+}
@@ -0,0 +1,196 @@
+package stats
+
+import (
+	"errors"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/atomic"
+
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/utils"
+)
+
+const cgroupV2Root = "/sys/fs/cgroup"
+
+var (
+	errNoCgroupV2 = errors.New("cgroup v2 not found")
+	usageRegex    = regexp.MustCompile(`usage_usec ([0-9]+)`)
+)
+
+type cpuStats interface {
+	GetCPUIdle() float64
+	NumCPU() float64
+}
+
+// newCPUStats prefers cgroup v2 accounting, which allows fractional cpu quotas,
+// and falls back to the protocol cpu stats for cgroup v1 or bare metal
+func newCPUStats(updateCallback func(idle float64)) (cpuStats, error) {
+	cg, err := newCgroupCPUStats(cgroupV2Root, updateCallback)
+	if err == nil {
+		logger.Infow("using cgroup v2 cpu stats", "cpus", cg.NumCPU())
+		return cg, nil
+	}
+	if !errors.Is(err, errNoCgroupV2) {
+		logger.Warnw("failed to read cgroup v2 cpu stats", err)
+	}
+
+	s, err := utils.NewCPUStats(updateCallback)
+	if err != nil {
+		return nil, err
+	}
+	return &systemCPUStats{s}, nil
+}
+
+type systemCPUStats struct {
+	*utils.CPUStats
+}
+
+func (s *systemCPUStats) NumCPU() float64 {
+	return float64(s.CPUStats.NumCPU())
+}
+
+type cgroupCPUStats struct {
+	root           string
+	nCPU           float64
+	lastSampleTime int64
+	lastUsage      int64
+	updateCallback func(idle float64)
+
+	idleCPUs atomic.Float64
+}
+
+func newCgroupCPUStats(root string, updateCallback func(idle float64)) (*cgroupCPUStats, error) {
+	if _, err := os.Stat(path.Join(root, "cgroup.controllers")); err != nil {
+		return nil, errNoCgroupV2
+	}
+
+	nCPU, err := readCPUMax(root)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := readCPUUsage(root)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &cgroupCPUStats{
+		root:           root,
+		nCPU:           nCPU,
+		lastSampleTime: time.Now().UnixNano(),
+		lastUsage:      usage,
+		updateCallback: updateCallback,
+	}
+	c.idleCPUs.Store(nCPU)
+
+	go c.monitorCPULoad()
+
+	return c, nil
+}
+
+func (c *cgroupCPUStats) GetCPUIdle() float64 {
+	return c.idleCPUs.Load()
+}
+
+func (c *cgroupCPUStats) NumCPU() float64 {
+	return c.nCPU
+}
+
+func (c *cgroupCPUStats) monitorCPULoad() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		usage, err := readCPUUsage(c.root)
+		if err != nil {
+			logger.Errorw("failed retrieving CPU usage", err)
+			continue
+		}
+		now := time.Now().UnixNano()
+
+		busy := float64(usage-c.lastUsage) / float64(now-c.lastSampleTime)
+		idle := c.nCPU - busy
+		// clamp, since usage and time are not sampled together
+		if idle > c.nCPU {
+			idle = c.nCPU
+		} else if idle < 0 {
+			idle = 0
+		}
+
+		c.lastSampleTime = now
+		c.lastUsage = usage
+		c.idleCPUs.Store(idle)
+
+		if c.updateCallback != nil {
+			c.updateCallback(idle)
+		}
+	}
+}
+
+// readCPUMax returns the cpu quota, or the host cpu count if there is no quota
+func readCPUMax(root string) (float64, error) {
+	hostCPUs := float64(runtime.NumCPU())
+
+	b, err := os.ReadFile(path.Join(root, "cpu.max"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// no cpu controller at this level
+			return hostCPUs, nil
+		}
+		return 0, err
+	}
+
+	return parseCPUMax(string(b), hostCPUs)
+}
+
+func parseCPUMax(s string, hostCPUs float64) (float64, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return 0, errors.New("could not parse cpu.max")
+	}
+	if fields[0] == "max" {
+		return hostCPUs, nil
+	}
+
+	quota, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	period, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	if quota <= 0 || period <= 0 {
+		return 0, errors.New("invalid cpu.max")
+	}
+
+	nCPU := quota / period
+	if nCPU > hostCPUs {
+		nCPU = hostCPUs
+	}
+	return nCPU, nil
+}
+
+// readCPUUsage returns the total cpu time used by the cgroup in ns
+func readCPUUsage(root string) (int64, error) {
+	b, err := os.ReadFile(path.Join(root, "cpu.stat"))
+	if err != nil {
+		return 0, err
+	}
+
+	m := usageRegex.FindSubmatch(b)
+	if len(m) <= 1 {
+		return 0, errors.New("could not parse cpu.stat")
+	}
+
+	usage, err := strconv.ParseInt(string(m[1]), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return usage * 1000, nil
+}
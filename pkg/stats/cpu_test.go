@@ -0,0 +1,36 @@
+package stats
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCPUMax(t *testing.T) {
+	nCPU, err := parseCPUMax("max 100000\n", 8)
+	require.NoError(t, err)
+	require.Equal(t, float64(8), nCPU)
+
+	nCPU, err = parseCPUMax("250000 100000\n", 8)
+	require.NoError(t, err)
+	require.Equal(t, 2.5, nCPU)
+
+	nCPU, err = parseCPUMax("1600000 100000\n", 8)
+	require.NoError(t, err)
+	require.Equal(t, float64(8), nCPU)
+
+	_, err = parseCPUMax("max", 8)
+	require.Error(t, err)
+}
+
+func TestReadCPUUsage(t *testing.T) {
+	root := t.TempDir()
+	stat := "usage_usec 1500\nuser_usec 1000\nsystem_usec 500\n"
+	require.NoError(t, os.WriteFile(path.Join(root, "cpu.stat"), []byte(stat), 0644))
+
+	usage, err := readCPUUsage(root)
+	require.NoError(t, err)
+	require.Equal(t, int64(1500000), usage)
+}
@@ -2,7 +2,9 @@ package stats
 
 import (
 	"fmt"
+	"math"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -10,31 +12,55 @@ import (
 
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/ipc"
 	"github.com/livekit/protocol/logger"
 	"github.com/livekit/protocol/rpc"
-	"github.com/livekit/protocol/utils"
 )
 
 type Monitor struct {
+	nodeID        string
+	clusterID     string
 	cpuCostConfig config.CPUCostConfig
+	maxWeb        int32
 
-	promCPULoad  prometheus.Gauge
-	requestGauge *prometheus.GaugeVec
+	promCPULoad       prometheus.Gauge
+	requestGauge      *prometheus.GaugeVec
+	promCapacity      *prometheus.GaugeVec
+	promCapacityUnits prometheus.Gauge
 
-	cpuStats *utils.CPUStats
+	cpuStats cpuStats
 
 	pendingCPUs atomic.Float64
+	activeWeb   atomic.Int32 // room composite and web egress, including pending
+
+	mu         sync.Mutex
+	pendingWeb map[string]*time.Timer // accepted web egresses which have not started yet, by egress ID
 }
 
+// pendingWebTimeout releases the hold of a web egress which neither started nor failed to launch
+const pendingWebTimeout = time.Second * 10
+
 func NewMonitor(conf *config.ServiceConfig) *Monitor {
 	return &Monitor{
+		nodeID:        conf.NodeID,
+		clusterID:     conf.ClusterID,
 		cpuCostConfig: conf.CPUCostConfig,
+		maxWeb:        int32(conf.MaxConcurrentWeb),
+		// created here so that egresses are counted before the monitor starts, registered by Start
+		requestGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   "livekit",
+			Subsystem:   "egress",
+			Name:        "requests",
+			ConstLabels: prometheus.Labels{"node_id": conf.NodeID, "cluster_id": conf.ClusterID},
+		}, []string{"type"}),
+		pendingWeb: make(map[string]*time.Timer),
 	}
 }
 
 func (m *Monitor) Start(conf *config.ServiceConfig, isAvailable func() float64) error {
-	cpuStats, err := utils.NewCPUStats(func(idle float64) {
-		m.promCPULoad.Set(1 - idle/float64(m.cpuStats.NumCPU()))
+	cpuStats, err := newCPUStats(func(idle float64) {
+		m.promCPULoad.Set(1 - idle/m.cpuStats.NumCPU())
+		m.updateCapacity()
 	})
 	if err != nil {
 		return err
@@ -60,14 +86,21 @@ func (m *Monitor) Start(conf *config.ServiceConfig, isAvailable func() float64)
 		ConstLabels: prometheus.Labels{"node_id": conf.NodeID, "node_type": "EGRESS", "cluster_id": conf.ClusterID},
 	})
 
-	m.requestGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	m.promCapacity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace:   "livekit",
 		Subsystem:   "egress",
-		Name:        "requests",
+		Name:        "capacity",
 		ConstLabels: prometheus.Labels{"node_id": conf.NodeID, "cluster_id": conf.ClusterID},
 	}, []string{"type"})
 
-	prometheus.MustRegister(promNodeAvailable, m.promCPULoad, m.requestGauge)
+	m.promCapacityUnits = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "livekit",
+		Subsystem:   "egress",
+		Name:        "capacity_units",
+		ConstLabels: prometheus.Labels{"node_id": conf.NodeID, "cluster_id": conf.ClusterID},
+	})
+
+	prometheus.MustRegister(promNodeAvailable, m.promCPULoad, m.requestGauge, m.promCapacity, m.promCapacityUnits)
 
 	return nil
 }
@@ -115,7 +148,7 @@ func (m *Monitor) checkCPUConfig() error {
 		recommendedMinimum = 3
 	}
 
-	if float64(m.cpuStats.NumCPU()) < requirements[0] {
+	if m.cpuStats.NumCPU() < requirements[0] {
 		logger.Errorw("not enough cpu", nil,
 			"minimum cpu", requirements[0],
 			"recommended", recommendedMinimum,
@@ -124,7 +157,7 @@ func (m *Monitor) checkCPUConfig() error {
 		return errors.New("not enough cpu")
 	}
 
-	if float64(m.cpuStats.NumCPU()) < requirements[len(requirements)-1] {
+	if m.cpuStats.NumCPU() < requirements[len(requirements)-1] {
 		logger.Errorw("not enough cpu for some egress types", nil,
 			"minimum cpu", requirements[len(requirements)-1],
 			"recommended", recommendedMinimum,
@@ -132,19 +165,50 @@ func (m *Monitor) checkCPUConfig() error {
 		)
 	}
 
-	logger.Infow(fmt.Sprintf("available CPU cores: %d max cost: %f", m.cpuStats.NumCPU(), requirements[len(requirements)-1]))
+	logger.Infow(fmt.Sprintf("available CPU cores: %.2f max cost: %f", m.cpuStats.NumCPU(), requirements[len(requirements)-1]))
 
 	return nil
 }
 
 func (m *Monitor) GetCPULoad() float64 {
-	return (float64(m.cpuStats.NumCPU()) - m.cpuStats.GetCPUIdle()) / float64(m.cpuStats.NumCPU()) * 100
+	return (m.cpuStats.NumCPU() - m.cpuStats.GetCPUIdle()) / m.cpuStats.NumCPU() * 100
 }
 
-func (m *Monitor) CanAcceptRequest(req *rpc.StartEgressRequest) bool {
-	accept := false
+// GetCapacity returns the number of additional requests of each type this node can accept.
+// One capacity unit is the cost of a track egress.
+func (m *Monitor) GetCapacity() *ipc.CapacityUpdate {
+	available := m.getAvailableCPU()
+
+	return &ipc.CapacityUpdate{
+		NodeId:         m.nodeID,
+		ClusterId:      m.clusterID,
+		CapacityUnits:  math.Max(available/m.cpuCostConfig.TrackCpuCost, 0),
+		RoomComposite:  getCapacity(available, m.cpuCostConfig.RoomCompositeCpuCost),
+		Web:            getCapacity(available, m.cpuCostConfig.WebCpuCost),
+		TrackComposite: getCapacity(available, m.cpuCostConfig.TrackCompositeCpuCost),
+		Track:          getCapacity(available, m.cpuCostConfig.TrackCpuCost),
+		UpdatedAt:      time.Now().UnixNano(),
+	}
+}
+
+func (m *Monitor) updateCapacity() {
+	capacity := m.GetCapacity()
+	m.promCapacityUnits.Set(capacity.CapacityUnits)
+	m.promCapacity.With(prometheus.Labels{"type": "room_composite"}).Set(float64(capacity.RoomComposite))
+	m.promCapacity.With(prometheus.Labels{"type": "web"}).Set(float64(capacity.Web))
+	m.promCapacity.With(prometheus.Labels{"type": "track_composite"}).Set(float64(capacity.TrackComposite))
+	m.promCapacity.With(prometheus.Labels{"type": "track"}).Set(float64(capacity.Track))
+}
 
-	total := float64(m.cpuStats.NumCPU())
+func getCapacity(available, cost float64) int32 {
+	if available < cost {
+		return 0
+	}
+	return int32(available / cost)
+}
+
+func (m *Monitor) getAvailableCPU() float64 {
+	total := m.cpuStats.NumCPU()
 	available := m.cpuStats.GetCPUIdle() - m.pendingCPUs.Load()
 
 	if total-available <= 0.01 {
@@ -155,43 +219,100 @@ func (m *Monitor) CanAcceptRequest(req *rpc.StartEgressRequest) bool {
 		available -= total * 0.2
 	}
 
-	switch req.Request.(type) {
-	case *rpc.StartEgressRequest_RoomComposite:
-		accept = available >= m.cpuCostConfig.RoomCompositeCpuCost
-	case *rpc.StartEgressRequest_Web:
-		accept = available >= m.cpuCostConfig.WebCpuCost
-	case *rpc.StartEgressRequest_TrackComposite:
-		accept = available >= m.cpuCostConfig.TrackCompositeCpuCost
-	case *rpc.StartEgressRequest_Track:
-		accept = available >= m.cpuCostConfig.TrackCpuCost
+	return available
+}
+
+func (m *Monitor) CanAcceptRequest(req *rpc.StartEgressRequest) bool {
+	if isWebRequest(req) && m.maxWeb > 0 && m.activeWeb.Load() >= m.maxWeb {
+		return false
 	}
 
-	return accept
+	total := m.cpuStats.NumCPU()
+	available := m.getAvailableCPU()
+
+	cost := m.getRequestCost(req)
+	if cost > total {
+		logger.Warnw("not enough cpu for request", nil,
+			"egressID", req.EgressId,
+			"cost", cost,
+			"available", total,
+		)
+		return false
+	}
+
+	return available >= cost
 }
 
 func (m *Monitor) AcceptRequest(req *rpc.StartEgressRequest) {
-	var cpuHold float64
+	cpuHold := m.getRequestCost(req)
+
+	m.pendingCPUs.Add(cpuHold)
+	time.AfterFunc(time.Second, func() { m.pendingCPUs.Sub(cpuHold) })
+
+	if isWebRequest(req) {
+		// counted until EgressStarted counts it instead, or ReleaseRequest
+		egressID := req.EgressId
+		m.activeWeb.Inc()
+		m.mu.Lock()
+		m.pendingWeb[egressID] = time.AfterFunc(pendingWebTimeout, func() { m.releasePendingWeb(egressID) })
+		m.mu.Unlock()
+	}
+}
+
+// ReleaseRequest releases what AcceptRequest held for a request, once it has been launched or could not be
+func (m *Monitor) ReleaseRequest(req *rpc.StartEgressRequest) {
+	m.releasePendingWeb(req.EgressId)
+}
+
+func (m *Monitor) releasePendingWeb(egressID string) {
+	m.mu.Lock()
+	timer, ok := m.pendingWeb[egressID]
+	delete(m.pendingWeb, egressID)
+	m.mu.Unlock()
+
+	if ok {
+		timer.Stop()
+		m.activeWeb.Dec()
+	}
+}
+
+// isWebRequest returns true for requests which launch chrome
+func isWebRequest(req *rpc.StartEgressRequest) bool {
+	switch req.Request.(type) {
+	case *rpc.StartEgressRequest_RoomComposite, *rpc.StartEgressRequest_Web:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *Monitor) getRequestCost(req *rpc.StartEgressRequest) float64 {
+	var cost float64
 	switch req.Request.(type) {
 	case *rpc.StartEgressRequest_RoomComposite:
-		cpuHold = m.cpuCostConfig.RoomCompositeCpuCost
+		cost = m.cpuCostConfig.RoomCompositeCpuCost
 	case *rpc.StartEgressRequest_Web:
-		cpuHold = m.cpuCostConfig.WebCpuCost
+		cost = m.cpuCostConfig.WebCpuCost
 	case *rpc.StartEgressRequest_TrackComposite:
-		cpuHold = m.cpuCostConfig.TrackCompositeCpuCost
+		cost = m.cpuCostConfig.TrackCompositeCpuCost
 	case *rpc.StartEgressRequest_Track:
-		cpuHold = m.cpuCostConfig.TrackCpuCost
+		cost = m.cpuCostConfig.TrackCpuCost
 	}
 
-	m.pendingCPUs.Add(cpuHold)
-	time.AfterFunc(time.Second, func() { m.pendingCPUs.Sub(cpuHold) })
+	// high resolution and high framerate encodings scale with pixel rate
+	return cost * config.GetEncodingCostFactor(req)
 }
 
 func (m *Monitor) EgressStarted(req *rpc.StartEgressRequest) {
 	switch req.Request.(type) {
 	case *rpc.StartEgressRequest_RoomComposite:
 		m.requestGauge.With(prometheus.Labels{"type": "room_composite"}).Add(1)
+		m.activeWeb.Inc()
+		m.releasePendingWeb(req.EgressId)
 	case *rpc.StartEgressRequest_Web:
 		m.requestGauge.With(prometheus.Labels{"type": "web"}).Add(1)
+		m.activeWeb.Inc()
+		m.releasePendingWeb(req.EgressId)
 	case *rpc.StartEgressRequest_TrackComposite:
 		m.requestGauge.With(prometheus.Labels{"type": "track_composite"}).Add(1)
 	case *rpc.StartEgressRequest_Track:
@@ -203,8 +324,10 @@ func (m *Monitor) EgressEnded(req *rpc.StartEgressRequest) {
 	switch req.Request.(type) {
 	case *rpc.StartEgressRequest_RoomComposite:
 		m.requestGauge.With(prometheus.Labels{"type": "room_composite"}).Sub(1)
+		m.activeWeb.Dec()
 	case *rpc.StartEgressRequest_Web:
 		m.requestGauge.With(prometheus.Labels{"type": "web"}).Sub(1)
+		m.activeWeb.Dec()
 	case *rpc.StartEgressRequest_TrackComposite:
 		m.requestGauge.With(prometheus.Labels{"type": "track_composite"}).Sub(1)
 	case *rpc.StartEgressRequest_Track:
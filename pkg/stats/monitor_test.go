@@ -0,0 +1,41 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/rpc"
+)
+
+func TestActiveWeb(t *testing.T) {
+	m := NewMonitor(&config.ServiceConfig{})
+	m.requestGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_requests"}, []string{"type"})
+
+	started := &rpc.StartEgressRequest{
+		EgressId: "EG_started",
+		Request:  &rpc.StartEgressRequest_Web{Web: &livekit.WebEgressRequest{}},
+	}
+	failed := &rpc.StartEgressRequest{
+		EgressId: "EG_failed",
+		Request:  &rpc.StartEgressRequest_RoomComposite{RoomComposite: &livekit.RoomCompositeEgressRequest{}},
+	}
+
+	// pending requests are counted once
+	m.AcceptRequest(started)
+	m.AcceptRequest(failed)
+	require.Equal(t, int32(2), m.activeWeb.Load())
+
+	// the hold is replaced once started, and released after a failed launch
+	m.EgressStarted(started)
+	m.ReleaseRequest(started)
+	m.ReleaseRequest(failed)
+	require.Equal(t, int32(1), m.activeWeb.Load())
+
+	m.EgressEnded(started)
+	require.Equal(t, int32(0), m.activeWeb.Load())
+	require.Empty(t, m.pendingWeb)
+}
@@ -0,0 +1,199 @@
+package stats
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/frostbyte73/core"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/protocol/logger"
+)
+
+const (
+	procFDPath   = "/proc/self/fd"
+	procUnixPath = "/proc/net/unix"
+)
+
+type resourceCounts struct {
+	goroutines  int
+	fds         int
+	unixSockets int
+}
+
+// Watchdog tracks service process resources, so that leaks from handler lifecycles are noticed
+// before a long-running node degrades
+type Watchdog struct {
+	conf     config.WatchdogConfig
+	isIdle   func() bool
+	baseline *resourceCounts
+	maxFDs   int
+
+	promGoroutines  prometheus.Gauge
+	promFDs         prometheus.Gauge
+	promUnixSockets prometheus.Gauge
+	promLeaks       *prometheus.CounterVec
+
+	shutdown core.Fuse
+}
+
+func NewWatchdog(conf *config.ServiceConfig, isIdle func() bool) *Watchdog {
+	labels := prometheus.Labels{"node_id": conf.NodeID, "cluster_id": conf.ClusterID}
+
+	w := &Watchdog{
+		conf:     conf.Watchdog,
+		isIdle:   isIdle,
+		maxFDs:   conf.Watchdog.MaxFDs,
+		shutdown: core.NewFuse(),
+		promGoroutines: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   "livekit",
+			Subsystem:   "egress",
+			Name:        "goroutines",
+			ConstLabels: labels,
+		}),
+		promFDs: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   "livekit",
+			Subsystem:   "egress",
+			Name:        "open_fds",
+			ConstLabels: labels,
+		}),
+		promUnixSockets: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   "livekit",
+			Subsystem:   "egress",
+			Name:        "unix_sockets",
+			ConstLabels: labels,
+		}),
+		promLeaks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   "livekit",
+			Subsystem:   "egress",
+			Name:        "leak_warnings",
+			ConstLabels: labels,
+		}, []string{"type"}),
+	}
+
+	if w.maxFDs == 0 {
+		// default to 80% of the soft limit
+		var rLimit syscall.Rlimit
+		if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rLimit); err == nil {
+			w.maxFDs = int(float64(rLimit.Cur) * 0.8)
+		}
+	}
+
+	prometheus.MustRegister(w.promGoroutines, w.promFDs, w.promUnixSockets, w.promLeaks)
+	return w
+}
+
+func (w *Watchdog) Start() {
+	go func() {
+		ticker := time.NewTicker(w.conf.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.shutdown.Watch():
+				return
+			case <-ticker.C:
+				w.check()
+			}
+		}
+	}()
+}
+
+func (w *Watchdog) Stop() {
+	w.shutdown.Break()
+}
+
+func (w *Watchdog) check() {
+	// read idle first, so that a handler starting during the check is not counted as a leak
+	idle := w.isIdle()
+
+	counts := getResourceCounts()
+	w.promGoroutines.Set(float64(counts.goroutines))
+	w.promFDs.Set(float64(counts.fds))
+	w.promUnixSockets.Set(float64(counts.unixSockets))
+
+	if counts.goroutines > w.conf.MaxGoroutines {
+		w.warn("goroutines", "goroutine count above threshold", "count", counts.goroutines, "max", w.conf.MaxGoroutines)
+	}
+	if w.maxFDs > 0 && counts.fds > w.maxFDs {
+		w.warn("fds", "open file descriptors above threshold", "count", counts.fds, "max", w.maxFDs)
+	}
+
+	if !idle {
+		return
+	}
+	if w.baseline == nil {
+		w.baseline = counts
+		return
+	}
+
+	// with no active handlers, anything above the first idle measurement was left behind by a handler
+	if counts.goroutines > w.baseline.goroutines+w.conf.GoroutineGrowth {
+		w.warn("goroutines", "possible goroutine leak", "count", counts.goroutines, "baseline", w.baseline.goroutines)
+	}
+	if counts.fds > w.baseline.fds+w.conf.FDGrowth {
+		w.warn("fds", "possible file descriptor leak", "count", counts.fds, "baseline", w.baseline.fds)
+	}
+	if counts.unixSockets > w.baseline.unixSockets+w.conf.FDGrowth {
+		w.warn("unix_sockets", "possible unix socket leak", "count", counts.unixSockets, "baseline", w.baseline.unixSockets)
+	}
+}
+
+func (w *Watchdog) warn(leakType, msg string, keysAndValues ...interface{}) {
+	w.promLeaks.With(prometheus.Labels{"type": leakType}).Inc()
+	logger.Warnw(msg, nil, keysAndValues...)
+}
+
+func getResourceCounts() *resourceCounts {
+	counts := &resourceCounts{
+		goroutines: runtime.NumGoroutine(),
+	}
+
+	entries, err := os.ReadDir(procFDPath)
+	if err != nil {
+		// not linux
+		return counts
+	}
+	counts.fds = len(entries)
+
+	unixInodes := getUnixSocketInodes()
+	for _, entry := range entries {
+		link, err := os.Readlink(path.Join(procFDPath, entry.Name()))
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		if _, ok := unixInodes[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")]; ok {
+			counts.unixSockets++
+		}
+	}
+
+	return counts
+}
+
+func getUnixSocketInodes() map[string]struct{} {
+	inodes := make(map[string]struct{})
+
+	f, err := os.Open(procUnixPath)
+	if err != nil {
+		return inodes
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// Num RefCount Protocol Flags Type St Inode Path
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 7 {
+			inodes[fields[6]] = struct{}{}
+		}
+	}
+
+	return inodes
+}
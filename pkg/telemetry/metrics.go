@@ -0,0 +1,98 @@
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/livekit/egress/version"
+)
+
+// prometheusProducer exports the registered prometheus gauges and counters through the otel metric reader
+type prometheusProducer struct {
+	gatherer prometheus.Gatherer
+	scope    instrumentation.Scope
+}
+
+func newPrometheusProducer(name string) *prometheusProducer {
+	return &prometheusProducer{
+		gatherer: prometheus.DefaultGatherer,
+		scope:    instrumentation.Scope{Name: name, Version: version.Version},
+	}
+}
+
+func (p *prometheusProducer) Produce(_ context.Context) ([]metricdata.ScopeMetrics, error) {
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := convertMetrics(families, time.Now())
+	if len(metrics) == 0 {
+		return nil, nil
+	}
+
+	return []metricdata.ScopeMetrics{{
+		Scope:   p.scope,
+		Metrics: metrics,
+	}}, nil
+}
+
+func convertMetrics(families []*dto.MetricFamily, now time.Time) []metricdata.Metrics {
+	metrics := make([]metricdata.Metrics, 0, len(families))
+	for _, mf := range families {
+		m := metricdata.Metrics{
+			Name:        mf.GetName(),
+			Description: mf.GetHelp(),
+		}
+
+		switch mf.GetType() {
+		case dto.MetricType_GAUGE:
+			gauge := metricdata.Gauge[float64]{}
+			for _, metric := range mf.GetMetric() {
+				gauge.DataPoints = append(gauge.DataPoints, newDataPoint(metric, metric.GetGauge().GetValue(), now))
+			}
+			m.Data = gauge
+		case dto.MetricType_UNTYPED:
+			gauge := metricdata.Gauge[float64]{}
+			for _, metric := range mf.GetMetric() {
+				gauge.DataPoints = append(gauge.DataPoints, newDataPoint(metric, metric.GetUntyped().GetValue(), now))
+			}
+			m.Data = gauge
+		case dto.MetricType_COUNTER:
+			sum := metricdata.Sum[float64]{
+				Temporality: metricdata.CumulativeTemporality,
+				IsMonotonic: true,
+			}
+			for _, metric := range mf.GetMetric() {
+				sum.DataPoints = append(sum.DataPoints, newDataPoint(metric, metric.GetCounter().GetValue(), now))
+			}
+			m.Data = sum
+		default:
+			// histograms and summaries are only available through prometheus
+			continue
+		}
+
+		metrics = append(metrics, m)
+	}
+
+	return metrics
+}
+
+func newDataPoint(metric *dto.Metric, value float64, now time.Time) metricdata.DataPoint[float64] {
+	labels := make([]attribute.KeyValue, 0, len(metric.GetLabel()))
+	for _, l := range metric.GetLabel() {
+		labels = append(labels, attribute.String(l.GetName(), l.GetValue()))
+	}
+
+	return metricdata.DataPoint[float64]{
+		Attributes: attribute.NewSet(labels...),
+		Time:       now,
+		Value:      value,
+	}
+}
@@ -0,0 +1,133 @@
+package telemetry
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/version"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/tracer"
+)
+
+const (
+	shutdownTimeout = time.Second * 10
+
+	tracesPath  = "/v1/traces"
+	metricsPath = "/v1/metrics"
+)
+
+var (
+	traceProvider *sdktrace.TracerProvider
+	meterProvider *sdkmetric.MeterProvider
+)
+
+// StartService exports traces and prometheus metrics for the service process
+func StartService(conf *config.TelemetryConfig, nodeID, clusterID string) error {
+	if conf == nil {
+		return nil
+	}
+	return start(conf, "", !conf.DisableMetrics,
+		attribute.String("node.id", nodeID),
+		attribute.String("cluster.id", clusterID),
+	)
+}
+
+// StartHandler exports traces for a handler process. Spans without a parent are added to the trace
+// of the service span which launched the handler, given as a W3C traceparent.
+func StartHandler(conf *config.TelemetryConfig, nodeID, clusterID, handlerID, egressID, traceParent string) error {
+	if conf == nil {
+		return nil
+	}
+	return start(conf, traceParent, false,
+		attribute.String("node.id", nodeID),
+		attribute.String("cluster.id", clusterID),
+		attribute.String("handler.id", handlerID),
+		attribute.String("egress.id", egressID),
+	)
+}
+
+func start(conf *config.TelemetryConfig, traceParent string, exportMetrics bool, attributes ...attribute.KeyValue) error {
+	endpoint, err := url.Parse(conf.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	res := resource.NewSchemaless(append(attributes,
+		attribute.String("service.name", conf.ServiceName),
+		attribute.String("service.version", version.Version),
+	)...)
+
+	traceOpts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(endpoint.Host),
+		otlptracehttp.WithURLPath(path.Join("/", endpoint.Path, tracesPath)),
+		otlptracehttp.WithHeaders(conf.Headers),
+	}
+	if endpoint.Scheme == "http" {
+		traceOpts = append(traceOpts, otlptracehttp.WithInsecure())
+	}
+	traceExporter, err := otlptracehttp.New(context.Background(), traceOpts...)
+	if err != nil {
+		return err
+	}
+
+	traceProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(traceExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(traceProvider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	tracer.SetTracer(newTracer(traceProvider, conf.ServiceName, traceParent))
+
+	if exportMetrics {
+		metricOpts := []otlpmetrichttp.Option{
+			otlpmetrichttp.WithEndpoint(endpoint.Host),
+			otlpmetrichttp.WithURLPath(path.Join("/", endpoint.Path, metricsPath)),
+			otlpmetrichttp.WithHeaders(conf.Headers),
+		}
+		if endpoint.Scheme == "http" {
+			metricOpts = append(metricOpts, otlpmetrichttp.WithInsecure())
+		}
+		metricExporter, err := otlpmetrichttp.New(context.Background(), metricOpts...)
+		if err != nil {
+			return err
+		}
+
+		reader := sdkmetric.NewPeriodicReader(metricExporter, sdkmetric.WithInterval(conf.MetricsInterval))
+		reader.RegisterProducer(newPrometheusProducer(conf.ServiceName))
+		meterProvider = sdkmetric.NewMeterProvider(
+			sdkmetric.WithReader(reader),
+			sdkmetric.WithResource(res),
+		)
+	}
+
+	return nil
+}
+
+// Stop flushes any pending spans and metrics
+func Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if traceProvider != nil {
+		if err := traceProvider.Shutdown(ctx); err != nil {
+			logger.Debugw("failed to flush spans", "error", err)
+		}
+	}
+	if meterProvider != nil {
+		if err := meterProvider.Shutdown(ctx); err != nil {
+			logger.Debugw("failed to flush metrics", "error", err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceParent(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	tr := newTracer(provider, "egress", "")
+	ctx, parent := tr.Start(context.Background(), "parent")
+	_, child := tr.Start(ctx, "child")
+	child.RecordError(errors.New("failed"))
+	child.End()
+	parent.End()
+
+	ended := recorder.Ended()
+	require.Len(t, ended, 2)
+	c, p := ended[0], ended[1]
+	require.Equal(t, p.SpanContext().TraceID(), c.SpanContext().TraceID())
+	require.Equal(t, p.SpanContext().SpanID(), c.Parent().SpanID())
+	require.Equal(t, codes.Error, c.Status().Code)
+	require.Equal(t, codes.Unset, p.Status().Code)
+
+	// the handler joins the trace of the service span which launched it
+	traceParent := TraceParent(ctx)
+	require.NotEmpty(t, traceParent)
+	handler := newTracer(provider, "egress", traceParent)
+	_, s := handler.Start(context.Background(), "handler")
+	s.End()
+
+	h := recorder.Ended()[2]
+	require.Equal(t, p.SpanContext().TraceID(), h.SpanContext().TraceID())
+	require.Equal(t, p.SpanContext().SpanID(), h.Parent().SpanID())
+	require.True(t, h.Parent().IsRemote())
+}
+
+func TestConvertMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "egress_available", Help: "available"})
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "egress_requests"}, []string{"type"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "egress_latency"})
+	registry.MustRegister(gauge, counter, histogram)
+
+	gauge.Set(2)
+	counter.WithLabelValues("web").Add(3)
+	histogram.Observe(1)
+
+	p := newPrometheusProducer("egress")
+	p.gatherer = registry
+	scopes, err := p.Produce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, scopes, 1)
+
+	metrics := scopes[0].Metrics
+	require.Len(t, metrics, 2)
+
+	require.Equal(t, "egress_available", metrics[0].Name)
+	g := metrics[0].Data.(metricdata.Gauge[float64])
+	require.Equal(t, float64(2), g.DataPoints[0].Value)
+
+	require.Equal(t, "egress_requests", metrics[1].Name)
+	sum := metrics[1].Data.(metricdata.Sum[float64])
+	require.True(t, sum.IsMonotonic)
+	require.Equal(t, float64(3), sum.DataPoints[0].Value)
+	v, ok := sum.DataPoints[0].Attributes.Value("type")
+	require.True(t, ok)
+	require.Equal(t, "web", v.AsString())
+}
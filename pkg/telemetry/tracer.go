@@ -0,0 +1,74 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/livekit/egress/version"
+	"github.com/livekit/protocol/tracer"
+)
+
+const traceParentHeader = "traceparent"
+
+// TraceParent returns the W3C traceparent of the span in ctx, or an empty string if there is none
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get(traceParentHeader)
+}
+
+func parseTraceParent(traceParent string) trace.SpanContext {
+	if traceParent == "" {
+		return trace.SpanContext{}
+	}
+	ctx := propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier{traceParentHeader: traceParent})
+	return trace.SpanContextFromContext(ctx)
+}
+
+// otelTracer starts spans for the protocol tracer. Options of type trace.SpanStartOption are passed on.
+type otelTracer struct {
+	tracer trace.Tracer
+	parent trace.SpanContext
+}
+
+func newTracer(provider trace.TracerProvider, name, traceParent string) *otelTracer {
+	return &otelTracer{
+		tracer: provider.Tracer(name, trace.WithInstrumentationVersion(version.Version)),
+		parent: parseTraceParent(traceParent),
+	}
+}
+
+func (t *otelTracer) Start(ctx context.Context, spanName string, opts ...interface{}) (context.Context, tracer.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() && t.parent.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, t.parent)
+	}
+
+	startOpts := make([]trace.SpanStartOption, 0, len(opts))
+	for _, opt := range opts {
+		if o, ok := opt.(trace.SpanStartOption); ok {
+			startOpts = append(startOpts, o)
+		}
+	}
+
+	ctx, s := t.tracer.Start(ctx, spanName, startOpts...)
+	return ctx, &span{span: s}
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (s *span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s *span) End() {
+	s.span.End()
+}
@@ -1,11 +1,15 @@
 package types
 
+import "sort"
+
 type MimeType string
 type Profile string
 type SourceType string
 type EgressType string
 type OutputType string
 type FileExtension string
+type ContentHint string
+type LimitType string
 
 const (
 	// source types
@@ -14,10 +18,13 @@ const (
 
 	// input types
 	MimeTypeAAC      MimeType = "audio/aac"
+	MimeTypeMP3      MimeType = "audio/mpeg"
 	MimeTypeOpus     MimeType = "audio/opus"
 	MimeTypeRawAudio MimeType = "audio/x-raw"
 	MimeTypeH264     MimeType = "video/h264"
+	MimeTypeH265     MimeType = "video/h265"
 	MimeTypeVP8      MimeType = "video/vp8"
+	MimeTypeVP9      MimeType = "video/vp9"
 	MimeTypeRawVideo MimeType = "video/x-raw"
 
 	// video profiles
@@ -25,43 +32,69 @@ const (
 	ProfileMain     Profile = "main"
 	ProfileHigh     Profile = "high"
 
+	// content hints
+	ContentHintMotion ContentHint = "motion"
+	ContentHintDetail ContentHint = "detail"
+	ContentHintText   ContentHint = "text"
+
+	// session limits
+	LimitTypeDuration     LimitType = "duration"
+	LimitTypeFileSize     LimitType = "file_size"
+	LimitTypeSegmentCount LimitType = "segment_count"
+	LimitTypeScratchQuota LimitType = "scratch_quota"
+
 	// egress types
 	EgressTypeStream    EgressType = "stream"
 	EgressTypeWebsocket EgressType = "websocket"
 	EgressTypeFile      EgressType = "file"
+	EgressTypeProxyFile EgressType = "proxy_file"
 	EgressTypeSegments  EgressType = "segments"
 
 	// output types
 	OutputTypeUnknownFile OutputType = ""
 	OutputTypeRaw         OutputType = "audio/x-raw"
 	OutputTypeOGG         OutputType = "audio/ogg"
+	OutputTypeMP3         OutputType = "audio/mpeg"
+	OutputTypeWAV         OutputType = "audio/wav"
 	OutputTypeIVF         OutputType = "video/x-ivf"
 	OutputTypeMP4         OutputType = "video/mp4"
 	OutputTypeTS          OutputType = "video/mp2t"
 	OutputTypeWebM        OutputType = "video/webm"
 	OutputTypeRTMP        OutputType = "rtmp"
 	OutputTypeHLS         OutputType = "application/x-mpegurl"
+	OutputTypeMSE         OutputType = "application/vnd.livekit.mse+json" // webm segments with a json index, for media source extensions
 	OutputTypeJSON        OutputType = "application/json"
+	OutputTypePProf       OutputType = "application/octet-stream"
+	OutputTypeText        OutputType = "text/plain"
+	OutputTypeKey         OutputType = "application/octet-stream" // hls aes-128 keys
+	OutputTypeJPEG        OutputType = "image/jpeg"
+	OutputTypeBinary      OutputType = "application/octet-stream" // files of any other type, e.g. post-processing artifacts
 
 	// file extensions
 	FileExtensionRaw  = ".raw"
 	FileExtensionOGG  = ".ogg"
+	FileExtensionMP3  = ".mp3"
+	FileExtensionWAV  = ".wav"
 	FileExtensionIVF  = ".ivf"
 	FileExtensionMP4  = ".mp4"
 	FileExtensionTS   = ".ts"
 	FileExtensionWebM = ".webm"
 	FileExtensionM3U8 = ".m3u8"
+	FileExtensionJSON = ".json"
 )
 
 var (
 	DefaultAudioCodecs = map[OutputType]MimeType{
 		OutputTypeRaw:  MimeTypeRawAudio,
 		OutputTypeOGG:  MimeTypeOpus,
+		OutputTypeMP3:  MimeTypeMP3,
+		OutputTypeWAV:  MimeTypeRawAudio,
 		OutputTypeMP4:  MimeTypeAAC,
 		OutputTypeTS:   MimeTypeAAC,
 		OutputTypeWebM: MimeTypeOpus,
 		OutputTypeRTMP: MimeTypeAAC,
 		OutputTypeHLS:  MimeTypeAAC,
+		OutputTypeMSE:  MimeTypeOpus,
 	}
 
 	DefaultVideoCodecs = map[OutputType]MimeType{
@@ -71,26 +104,33 @@ var (
 		OutputTypeWebM: MimeTypeVP8,
 		OutputTypeRTMP: MimeTypeH264,
 		OutputTypeHLS:  MimeTypeH264,
+		OutputTypeMSE:  MimeTypeVP8,
 	}
 
 	FileExtensions = map[FileExtension]struct{}{
 		FileExtensionRaw:  {},
 		FileExtensionOGG:  {},
+		FileExtensionMP3:  {},
+		FileExtensionWAV:  {},
 		FileExtensionIVF:  {},
 		FileExtensionMP4:  {},
 		FileExtensionTS:   {},
 		FileExtensionWebM: {},
 		FileExtensionM3U8: {},
+		FileExtensionJSON: {},
 	}
 
 	FileExtensionForOutputType = map[OutputType]FileExtension{
 		OutputTypeRaw:  FileExtensionRaw,
 		OutputTypeOGG:  FileExtensionOGG,
+		OutputTypeMP3:  FileExtensionMP3,
+		OutputTypeWAV:  FileExtensionWAV,
 		OutputTypeIVF:  FileExtensionIVF,
 		OutputTypeMP4:  FileExtensionMP4,
 		OutputTypeTS:   FileExtensionTS,
 		OutputTypeWebM: FileExtensionWebM,
 		OutputTypeHLS:  FileExtensionM3U8,
+		OutputTypeMSE:  FileExtensionJSON,
 	}
 
 	CodecCompatibility = map[OutputType]map[MimeType]bool{
@@ -100,6 +140,12 @@ var (
 		OutputTypeOGG: {
 			MimeTypeOpus: true,
 		},
+		OutputTypeMP3: {
+			MimeTypeMP3: true,
+		},
+		OutputTypeWAV: {
+			MimeTypeRawAudio: true,
+		},
 		OutputTypeIVF: {
 			MimeTypeVP8: true,
 		},
@@ -107,15 +153,18 @@ var (
 			MimeTypeAAC:  true,
 			MimeTypeOpus: true,
 			MimeTypeH264: true,
+			MimeTypeH265: true,
 		},
 		OutputTypeTS: {
 			MimeTypeAAC:  true,
 			MimeTypeOpus: true,
 			MimeTypeH264: true,
+			MimeTypeH265: true,
 		},
 		OutputTypeWebM: {
 			MimeTypeOpus: true,
 			MimeTypeVP8:  true,
+			MimeTypeVP9:  true,
 		},
 		OutputTypeRTMP: {
 			MimeTypeAAC:  true,
@@ -125,22 +174,61 @@ var (
 			MimeTypeAAC:  true,
 			MimeTypeH264: true,
 		},
+		OutputTypeMSE: {
+			MimeTypeOpus: true,
+			MimeTypeVP8:  true,
+			MimeTypeVP9:  true,
+		},
 		OutputTypeUnknownFile: {
 			MimeTypeAAC:  true,
+			MimeTypeMP3:  true,
 			MimeTypeOpus: true,
 			MimeTypeH264: true,
+			MimeTypeH265: true,
 			MimeTypeVP8:  true,
+			MimeTypeVP9:  true,
 		},
 	}
 
 	AllOutputAudioCodecs = map[MimeType]bool{
 		MimeTypeAAC:      true,
+		MimeTypeMP3:      true,
 		MimeTypeOpus:     true,
 		MimeTypeRawAudio: true,
 	}
 
 	AllOutputVideoCodecs = map[MimeType]bool{
 		MimeTypeH264: true,
+		MimeTypeH265: true,
+		MimeTypeVP8:  true,
+		MimeTypeVP9:  true,
+	}
+
+	// used when no output's default codec is compatible with every output, most preferred first
+	AudioCodecPriority = []MimeType{
+		MimeTypeAAC,
+		MimeTypeOpus,
+		MimeTypeMP3,
+		MimeTypeRawAudio,
+	}
+	VideoCodecPriority = []MimeType{
+		MimeTypeH264,
+		MimeTypeVP8,
+		MimeTypeVP9,
+		MimeTypeH265,
+	}
+
+	// supported encoder bitrates (kbps)
+	AudioBitrateRanges = map[MimeType][2]int32{
+		MimeTypeOpus: {6, 510},
+		MimeTypeAAC:  {8, 320},
+		MimeTypeMP3:  {8, 320},
+	}
+
+	// supported sample rates, opus is always encoded at 48kHz
+	AudioFrequencies = map[MimeType][]int32{
+		MimeTypeAAC: {8000, 16000, 22050, 24000, 32000, 44100, 48000},
+		MimeTypeMP3: {8000, 11025, 12000, 16000, 22050, 24000, 32000, 44100, 48000},
 	}
 
 	AudioOnlyFileOutputTypes = []OutputType{
@@ -153,6 +241,14 @@ var (
 	AudioVideoFileOutputTypes = []OutputType{
 		OutputTypeMP4,
 	}
+
+	// errors of egresses ending with EGRESS_LIMIT_REACHED. The limit itself is listed in the manifest
+	LimitErrors = map[LimitType]string{
+		LimitTypeDuration:     "session duration limit reached",
+		LimitTypeFileSize:     "file size limit reached",
+		LimitTypeSegmentCount: "segment count limit reached",
+		LimitTypeScratchQuota: "local storage quota reached",
+	}
 )
 
 func GetOutputTypeCompatibleWithCodecs(types []OutputType, audioCodecs map[MimeType]bool, videoCodecs map[MimeType]bool) OutputType {
@@ -180,6 +276,16 @@ func IsOutputTypeCompatibleWithCodecs(ot OutputType, codecs map[MimeType]bool) b
 	return false
 }
 
+// GetCompatibleCodecs returns the sorted codecs from the given set that can be used with the output type
+func GetCompatibleCodecs(ot OutputType, codecs map[MimeType]bool) []string {
+	var res []string
+	for k := range GetMapIntersection(codecs, CodecCompatibility[ot]) {
+		res = append(res, string(k))
+	}
+	sort.Strings(res)
+	return res
+}
+
 func GetMapIntersection[K comparable](mapA map[K]bool, mapB map[K]bool) map[K]bool {
 	res := make(map[K]bool)
 
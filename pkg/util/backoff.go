@@ -0,0 +1,61 @@
+package util
+
+import (
+	"time"
+)
+
+// Backoff is a retry schedule. The wait doubles after each attempt, up to MaxBackoff
+type Backoff struct {
+	Immediate   bool          // make the first attempt right away, instead of after Backoff
+	Backoff     time.Duration // the first wait
+	MaxBackoff  time.Duration
+	Window      time.Duration // no attempt is made after the window, other than the first
+	MaxAttempts int           // 0 for no limit
+}
+
+// Delays returns the wait before each attempt
+func (b Backoff) Delays() []time.Duration {
+	var delays []time.Duration
+	if b.Immediate {
+		delays = append(delays, 0)
+	}
+
+	var elapsed time.Duration
+	backoff := b.Backoff
+	for b.MaxAttempts == 0 || len(delays) < b.MaxAttempts {
+		// the first attempt is always made
+		if len(delays) > 0 && elapsed+backoff > b.Window {
+			break
+		}
+		delays = append(delays, backoff)
+		elapsed += backoff
+
+		if backoff *= 2; backoff > b.MaxBackoff {
+			backoff = b.MaxBackoff
+		}
+	}
+	return delays
+}
+
+// Retry calls attempt on the schedule until it returns true, and returns false if it never does.
+// Attempts can take a while, so they count towards the window as well. Retrying stops once done is closed
+func (b Backoff) Retry(done <-chan struct{}, attempt func(n int) bool) bool {
+	deadline := time.Now().Add(b.Window)
+	for i, delay := range b.Delays() {
+		if i > 0 && time.Now().Add(delay).After(deadline) {
+			return false
+		}
+		if delay > 0 {
+			select {
+			case <-done:
+				return false
+			case <-time.After(delay):
+			}
+		}
+
+		if attempt(i + 1) {
+			return true
+		}
+	}
+	return false
+}
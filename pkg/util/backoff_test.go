@@ -0,0 +1,88 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoffDelays(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		backoff  Backoff
+		expected []time.Duration
+	}{
+		{
+			name:    "MaxBackoff",
+			backoff: Backoff{Backoff: time.Second, MaxBackoff: time.Second * 10, Window: time.Minute},
+			expected: []time.Duration{
+				time.Second, time.Second * 2, time.Second * 4, time.Second * 8,
+				time.Second * 10, time.Second * 10, time.Second * 10, time.Second * 10,
+			},
+		},
+		{
+			name:     "FirstAttemptAfterWindow",
+			backoff:  Backoff{Backoff: time.Second * 5, MaxBackoff: time.Second * 5, Window: time.Second},
+			expected: []time.Duration{time.Second * 5},
+		},
+		{
+			name:     "MaxAttempts",
+			backoff:  Backoff{Backoff: time.Second, MaxBackoff: time.Second * 10, Window: time.Minute, MaxAttempts: 3},
+			expected: []time.Duration{time.Second, time.Second * 2, time.Second * 4},
+		},
+		{
+			name:     "ImmediateShorterThanBackoff",
+			backoff:  Backoff{Immediate: true, Backoff: time.Second, MaxBackoff: time.Second * 5, Window: time.Millisecond * 500},
+			expected: []time.Duration{0},
+		},
+		{
+			name:     "ImmediateEndsAtWindow",
+			backoff:  Backoff{Immediate: true, Backoff: time.Second, MaxBackoff: time.Second * 5, Window: time.Second * 3},
+			expected: []time.Duration{0, time.Second, time.Second * 2},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			delays := test.backoff.Delays()
+			require.Equal(t, test.expected, delays)
+
+			// no attempt other than the first is made after the window
+			var total time.Duration
+			for _, delay := range delays[1:] {
+				total += delay
+			}
+			require.LessOrEqual(t, total, test.backoff.Window)
+		})
+	}
+}
+
+func TestBackoffRetry(t *testing.T) {
+	backoff := Backoff{Immediate: true, Backoff: time.Millisecond, MaxBackoff: time.Millisecond * 4, Window: time.Millisecond * 200}
+
+	attempts := 0
+	require.True(t, backoff.Retry(nil, func(n int) bool {
+		attempts++
+		require.Equal(t, attempts, n)
+		return n == 3
+	}))
+	require.Equal(t, 3, attempts)
+
+	// slow attempts count towards the window
+	attempts = 0
+	require.False(t, backoff.Retry(nil, func(_ int) bool {
+		attempts++
+		time.Sleep(time.Millisecond * 150)
+		return false
+	}))
+	require.Equal(t, 2, attempts)
+
+	// no attempts are made once done is closed
+	done := make(chan struct{})
+	close(done)
+	attempts = 0
+	require.False(t, backoff.Retry(done, func(_ int) bool {
+		attempts++
+		return false
+	}))
+	require.Equal(t, 1, attempts)
+}
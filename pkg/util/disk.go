@@ -0,0 +1,25 @@
+package util
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// GetDirSize returns the total size in bytes of all regular files under dir
+func GetDirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,27 @@
+package util
+
+import (
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/protocol/logger"
+)
+
+// Go runs f in a new goroutine. If f panics, the panic is sent to failure instead of crashing the handler.
+func Go(failure chan<- error, f func()) {
+	go func() {
+		defer Recover(failure)
+		f()
+	}()
+}
+
+// Recover must be deferred directly. It sends any panic to failure as an errors.PanicError.
+func Recover(failure chan<- error) {
+	if r := recover(); r != nil {
+		err := errors.NewPanicError(r)
+		logger.Errorw("recovered from panic", err, "stack", string(err.Stack))
+		select {
+		case failure <- err:
+		default:
+			// pipeline is already failing
+		}
+	}
+}
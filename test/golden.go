@@ -0,0 +1,144 @@
+//go:build integration
+
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/protocol/livekit"
+)
+
+const (
+	goldenCompare = "compare"
+	goldenUpdate  = "update"
+
+	defaultGoldenDir             = "/out/golden" // the mounted test directory, so that updates are kept
+	defaultDurationTolerance     = 2.0
+	defaultSegmentCountTolerance = 1
+	goldenFileExtension          = ".golden.json"
+)
+
+// Golden is the expected metadata of an output, stored per test under the golden directory.
+// Bitrates and frame rates vary between runs, so they are checked by verify instead
+type Golden struct {
+	FormatName            string         `json:"format_name"`
+	Duration              float64        `json:"duration"`                // seconds
+	DurationTolerance     float64        `json:"duration_tolerance"`      // seconds
+	SegmentCount          int64          `json:"segment_count,omitempty"` // segment outputs only
+	SegmentCountTolerance int64          `json:"segment_count_tolerance,omitempty"`
+	Streams               []GoldenStream `json:"streams"`
+}
+
+type GoldenStream struct {
+	CodecType  string `json:"codec_type"`
+	CodecName  string `json:"codec_name"`
+	Profile    string `json:"profile,omitempty"`
+	Width      int32  `json:"width,omitempty"`
+	Height     int32  `json:"height,omitempty"`
+	SampleRate string `json:"sample_rate,omitempty"`
+	Channels   int    `json:"channels,omitempty"`
+}
+
+// checkGolden compares an output with its golden metadata, or replaces the golden metadata in update mode
+func (r *Runner) checkGolden(t *testing.T, in string, res *livekit.EgressInfo) {
+	if r.Golden != goldenCompare && r.Golden != goldenUpdate {
+		return
+	}
+
+	info, err := ffprobe(in)
+	require.NoError(t, err)
+	actual, err := newGolden(info, res)
+	require.NoError(t, err)
+
+	filename := path.Join(r.GoldenDir, strings.ReplaceAll(t.Name(), "/", "_")+goldenFileExtension)
+	if r.Golden == goldenUpdate {
+		if existing, err := readGolden(filename); err == nil {
+			// tolerances are tuned by hand
+			actual.DurationTolerance = existing.DurationTolerance
+			actual.SegmentCountTolerance = existing.SegmentCountTolerance
+		}
+		b, err := json.MarshalIndent(actual, "", "  ")
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(r.GoldenDir, 0755))
+		require.NoError(t, os.WriteFile(filename, append(b, '\n'), 0644))
+		return
+	}
+
+	expected, err := readGolden(filename)
+	require.NoError(t, err, "missing golden metadata, run with golden: update to create it")
+	diffs := compareGolden(expected, actual)
+	require.Empty(t, diffs, "output does not match %s", filename)
+}
+
+func newGolden(info *FFProbeInfo, res *livekit.EgressInfo) (*Golden, error) {
+	g := &Golden{
+		FormatName:            info.Format.FormatName,
+		DurationTolerance:     defaultDurationTolerance,
+		SegmentCountTolerance: defaultSegmentCountTolerance,
+	}
+	if info.Format.Duration != "" {
+		duration, err := strconv.ParseFloat(info.Format.Duration, 64)
+		if err != nil {
+			return nil, err
+		}
+		g.Duration = math.Round(duration*10) / 10
+	}
+	if segments := res.GetSegmentResults(); len(segments) == 1 {
+		g.SegmentCount = segments[0].SegmentCount
+	} else {
+		g.SegmentCountTolerance = 0
+	}
+	for _, s := range info.Streams {
+		g.Streams = append(g.Streams, GoldenStream{
+			CodecType:  s.CodecType,
+			CodecName:  s.CodecName,
+			Profile:    s.Profile,
+			Width:      s.Width,
+			Height:     s.Height,
+			SampleRate: s.SampleRate,
+			Channels:   s.Channels,
+		})
+	}
+	return g, nil
+}
+
+func readGolden(filename string) (*Golden, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	g := &Golden{}
+	return g, json.Unmarshal(b, g)
+}
+
+// compareGolden returns a description of each difference
+func compareGolden(expected, actual *Golden) []string {
+	var diffs []string
+	if expected.FormatName != actual.FormatName {
+		diffs = append(diffs, fmt.Sprintf("format: expected %s, got %s", expected.FormatName, actual.FormatName))
+	}
+	if math.Abs(expected.Duration-actual.Duration) > expected.DurationTolerance {
+		diffs = append(diffs, fmt.Sprintf("duration: expected %.1fs ±%.1fs, got %.1fs", expected.Duration, expected.DurationTolerance, actual.Duration))
+	}
+	if d := expected.SegmentCount - actual.SegmentCount; d > expected.SegmentCountTolerance || -d > expected.SegmentCountTolerance {
+		diffs = append(diffs, fmt.Sprintf("segment count: expected %d ±%d, got %d", expected.SegmentCount, expected.SegmentCountTolerance, actual.SegmentCount))
+	}
+	if len(expected.Streams) != len(actual.Streams) {
+		return append(diffs, fmt.Sprintf("streams: expected %d, got %d", len(expected.Streams), len(actual.Streams)))
+	}
+	for i := range expected.Streams {
+		if expected.Streams[i] != actual.Streams[i] {
+			diffs = append(diffs, fmt.Sprintf("stream %d: expected %+v, got %+v", i, expected.Streams[i], actual.Streams[i]))
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,99 @@
+//go:build integration
+
+package test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/livekit/egress/pkg/types"
+)
+
+const (
+	requestTypeRoomComposite  = "room_composite"
+	requestTypeWeb            = "web"
+	requestTypeTrackComposite = "track_composite"
+	requestTypeTrack          = "track"
+
+	outputFile     = "file"
+	outputStream   = "stream"
+	outputSegments = "segments"
+	outputMulti    = "multi"
+
+	storageS3    = "s3"
+	storageGCP   = "gcp"
+	storageAzure = "azure"
+)
+
+// Matrix selects the integration tests to run. An empty list selects everything in its dimension
+type Matrix struct {
+	RequestTypes []string `yaml:"request_types"` // room_composite, web, track_composite, track
+	Outputs      []string `yaml:"outputs"`       // file, stream (including websocket), segments, multi
+	Codecs       []string `yaml:"codecs"`        // codecs of the published samples: opus, vp8, h264
+	Storage      []string `yaml:"storage"`       // upload backends used by the tests which upload: s3, gcp, azure
+}
+
+func loadMatrix(t *testing.T, filename string) *Matrix {
+	m := &Matrix{}
+	if filename == "" {
+		return m
+	}
+
+	b, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal(b, m))
+
+	validate := func(dimension string, values []string, valid ...string) {
+		for _, value := range values {
+			require.Contains(t, valid, value, "invalid %s in test matrix", dimension)
+		}
+	}
+	validate("request type", m.RequestTypes, requestTypeRoomComposite, requestTypeWeb, requestTypeTrackComposite, requestTypeTrack)
+	validate("output", m.Outputs, outputFile, outputStream, outputSegments, outputMulti)
+	validate("codec", m.Codecs, "opus", "vp8", "h264")
+	validate("storage", m.Storage, storageS3, storageGCP, storageAzure)
+
+	return m
+}
+
+func (m *Matrix) includesRequestType(requestType string) bool {
+	return includes(m.RequestTypes, requestType)
+}
+
+func (m *Matrix) includesOutput(output string) bool {
+	return includes(m.Outputs, output)
+}
+
+func (m *Matrix) includesStorage(storage string) bool {
+	return includes(m.Storage, storage)
+}
+
+// includesCodecs returns false if either published codec is excluded
+func (m *Matrix) includesCodecs(codecs ...types.MimeType) bool {
+	for _, codec := range codecs {
+		if codec == "" {
+			continue
+		}
+		name := string(codec)[strings.Index(string(codec), "/")+1:]
+		if !includes(m.Codecs, name) {
+			return false
+		}
+	}
+	return true
+}
+
+func includes(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
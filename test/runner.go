@@ -31,6 +31,7 @@ type Runner struct {
 	room            *lksdk.Room              `yaml:"-"`
 	updates         chan *livekit.EgressInfo `yaml:"-"`
 	sourceFramerate float64                  `yaml:"-"`
+	matrix          *Matrix                  `yaml:"-"`
 
 	// service config
 	*config.ServiceConfig `yaml:",inline"`
@@ -39,19 +40,13 @@ type Runner struct {
 	AzureUpload           *livekit.AzureBlobUpload `yaml:"-"`
 
 	// testing config
-	RoomName                string `yaml:"room_name"`
-	RoomTestsOnly           bool   `yaml:"room_only"`
-	ParticipantTestsOnly    bool   `yaml:"participant_only"`
-	TrackCompositeTestsOnly bool   `yaml:"track_composite_only"`
-	TrackTestsOnly          bool   `yaml:"track_only"`
-	WebTestsOnly            bool   `yaml:"web_only"`
-	FileTestsOnly           bool   `yaml:"file_only"`
-	StreamTestsOnly         bool   `yaml:"stream_only"`
-	SegmentTestsOnly        bool   `yaml:"segments_only"`
-	MultiTestsOnly          bool   `yaml:"multi_only"`
-	Muting                  bool   `yaml:"muting"`
-	GstDebug                string `yaml:"gst_debug"`
-	Short                   bool   `yaml:"short"`
+	RoomName   string `yaml:"room_name"`
+	MatrixFile string `yaml:"matrix_file"` // tests to run, see matrix-sample.yaml (env EGRESS_TEST_MATRIX)
+	Golden     string `yaml:"golden"`      // compare or update outputs against golden metadata (env EGRESS_TEST_GOLDEN)
+	GoldenDir  string `yaml:"golden_dir"`  // default /out/golden
+	Muting     bool   `yaml:"muting"`
+	GstDebug   string `yaml:"gst_debug"`
+	Short      bool   `yaml:"short"`
 }
 
 func NewRunner(t *testing.T) *Runner {
@@ -83,7 +78,19 @@ func NewRunner(t *testing.T) *Runner {
 		t.Fatal("redis required")
 	}
 
-	if s3 := os.Getenv("S3_UPLOAD"); s3 != "" {
+	if matrixFile := os.Getenv("EGRESS_TEST_MATRIX"); matrixFile != "" {
+		r.MatrixFile = matrixFile
+	}
+	r.matrix = loadMatrix(t, r.MatrixFile)
+
+	if golden := os.Getenv("EGRESS_TEST_GOLDEN"); golden != "" {
+		r.Golden = golden
+	}
+	if r.GoldenDir == "" {
+		r.GoldenDir = defaultGoldenDir
+	}
+
+	if s3 := os.Getenv("S3_UPLOAD"); s3 != "" && r.matrix.includesStorage(storageS3) {
 		logger.Infow("using s3 uploads")
 		r.S3Upload = &livekit.S3Upload{}
 		require.NoError(t, json.Unmarshal([]byte(s3), r.S3Upload))
@@ -91,7 +98,7 @@ func NewRunner(t *testing.T) *Runner {
 		logger.Infow("no s3 config supplied")
 	}
 
-	if gcp := os.Getenv("GCP_UPLOAD"); gcp != "" {
+	if gcp := os.Getenv("GCP_UPLOAD"); gcp != "" && r.matrix.includesStorage(storageGCP) {
 		logger.Infow("using gcp uploads")
 		r.GCPUpload = &livekit.GCPUpload{}
 		require.NoError(t, json.Unmarshal([]byte(gcp), r.GCPUpload))
@@ -99,7 +106,7 @@ func NewRunner(t *testing.T) *Runner {
 		logger.Infow("no gcp config supplied")
 	}
 
-	if azure := os.Getenv("AZURE_UPLOAD"); azure != "" {
+	if azure := os.Getenv("AZURE_UPLOAD"); azure != "" && r.matrix.includesStorage(storageAzure) {
 		logger.Infow("using azure uploads")
 		r.AzureUpload = &livekit.AzureBlobUpload{}
 		require.NoError(t, json.Unmarshal([]byte(azure), r.AzureUpload))
@@ -176,37 +183,33 @@ func (r *Runner) Run(t *testing.T, bus psrpc.MessageBus, templateFs fs.FS) {
 }
 
 func (r *Runner) runRoomTests() bool {
-	return !r.ParticipantTestsOnly && !r.TrackCompositeTestsOnly && !r.TrackTestsOnly && !r.WebTestsOnly
+	return r.matrix.includesRequestType(requestTypeRoomComposite)
 }
 
 func (r *Runner) runWebTests() bool {
-	return !r.RoomTestsOnly && !r.ParticipantTestsOnly && !r.TrackCompositeTestsOnly && !r.TrackTestsOnly
-}
-
-func (r *Runner) runParticipantTests() bool {
-	return !r.RoomTestsOnly && !r.TrackCompositeTestsOnly && !r.TrackTestsOnly && !r.WebTestsOnly
+	return r.matrix.includesRequestType(requestTypeWeb)
 }
 
 func (r *Runner) runTrackCompositeTests() bool {
-	return !r.RoomTestsOnly && !r.ParticipantTestsOnly && !r.TrackTestsOnly && !r.WebTestsOnly
+	return r.matrix.includesRequestType(requestTypeTrackComposite)
 }
 
 func (r *Runner) runTrackTests() bool {
-	return !r.RoomTestsOnly && !r.ParticipantTestsOnly && !r.TrackCompositeTestsOnly && !r.WebTestsOnly
+	return r.matrix.includesRequestType(requestTypeTrack)
 }
 
 func (r *Runner) runFileTests() bool {
-	return !r.StreamTestsOnly && !r.SegmentTestsOnly && !r.MultiTestsOnly
+	return r.matrix.includesOutput(outputFile)
 }
 
 func (r *Runner) runStreamTests() bool {
-	return !r.FileTestsOnly && !r.SegmentTestsOnly && !r.MultiTestsOnly
+	return r.matrix.includesOutput(outputStream)
 }
 
 func (r *Runner) runSegmentTests() bool {
-	return !r.FileTestsOnly && !r.StreamTestsOnly && !r.MultiTestsOnly
+	return r.matrix.includesOutput(outputSegments)
 }
 
 func (r *Runner) runMultiTests() bool {
-	return !r.FileTestsOnly && !r.StreamTestsOnly && !r.SegmentTestsOnly
+	return r.matrix.includesOutput(outputMulti)
 }
@@ -69,6 +69,7 @@ func (r *Runner) verifySegments(t *testing.T, p *config.PipelineConfig, filename
 
 	// verify
 	verify(t, localPlaylistPath, p, res, types.EgressTypeSegments, r.Muting, r.sourceFramerate)
+	r.checkGolden(t, localPlaylistPath, res)
 }
 
 func verifyPlaylistProgramDateTime(t *testing.T, filenameSuffix livekit.SegmentedFileSuffix, localPlaylistPath string) {